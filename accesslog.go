@@ -0,0 +1,201 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the format of lines written by AccessLog.
+type AccessLogFormat int
+
+// Access log formats.
+const (
+	// AccessLogCommon writes lines similar to the Common Log Format,
+	// followed by the latency in microseconds:
+	//
+	//	127.0.0.1 - alice [10/Oct/2016:13:55:36 -0700] "square" ok 3 1250
+	AccessLogCommon AccessLogFormat = iota
+
+	// AccessLogJSON writes AccessLogEntry values encoded as JSON objects.
+	AccessLogJSON
+
+	// AccessLogLogfmt writes lines of key=value pairs:
+	//
+	//	time=2016-10-10T13:55:36-07:00 method=square caller=alice ...
+	AccessLogLogfmt
+)
+
+// accessLogStartKey holds the time the call was dispatched at in the
+// request context.
+const accessLogStartKey = "kite.accessLogStart"
+
+// AccessLogEntry describes a call logged by AccessLog.
+type AccessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	Method     string        `json:"method"`
+	Caller     string        `json:"caller"`               // username of the caller
+	Kite       string        `json:"kite,omitempty"`       // name of the calling kite
+	RemoteAddr string        `json:"remoteAddr,omitempty"` // address of the calling kite, if known
+	Status     string        `json:"status"`               // "ok" or the type of the error
+	Bytes      int           `json:"bytes"`                // size of the encoded result
+	Latency    time.Duration `json:"latency"`
+}
+
+// AccessLog is a middleware, which writes one line per call served
+// by the kite. Register it with Use:
+//
+//	kite.NewAccessLog(os.Stdout, kite.AccessLogLogfmt).Use(k)
+//
+// Calls rejected before they are dispatched to handlers, e.g. due to
+// failed authentication or throttling, are not logged.
+type AccessLog struct {
+	// Writer the lines are written to.
+	//
+	// Required.
+	Writer io.Writer
+
+	// Format of the lines.
+	Format AccessLogFormat
+
+	mu sync.Mutex // serializes writes
+}
+
+// NewAccessLog gives new access log writing lines of the given format
+// to the writer.
+func NewAccessLog(w io.Writer, format AccessLogFormat) *AccessLog {
+	return &AccessLog{
+		Writer: w,
+		Format: format,
+	}
+}
+
+// Use adds the access log to the middleware chain of the kite, with
+// PreHandle and FinalFunc. It must be called before the kite serves
+// requests.
+func (a *AccessLog) Use(k *Kite) {
+	k.PreHandleFunc(a.start)
+	k.FinalFunc(a.log)
+}
+
+func (a *AccessLog) start(r *Request) (interface{}, error) {
+	r.Context.Set(accessLogStartKey, time.Now())
+	return nil, nil
+}
+
+func (a *AccessLog) log(r *Request, resp interface{}, err error) (interface{}, error) {
+	now := time.Now()
+
+	e := &AccessLogEntry{
+		Time:   now,
+		Method: r.Method,
+		Caller: r.Username,
+		Status: errorType(err),
+	}
+
+	if v, err := r.Context.Get(accessLogStartKey); err == nil {
+		if start, ok := v.(time.Time); ok {
+			e.Time = start
+			e.Latency = now.Sub(start)
+		}
+	}
+
+	if r.Client != nil {
+		e.Kite = r.Client.Kite.Name
+		e.RemoteAddr = r.Client.RemoteAddr()
+	}
+
+	if e.Status == "" {
+		e.Status = "ok"
+
+		if p, err := json.Marshal(resp); err == nil {
+			e.Bytes = len(p)
+		}
+	}
+
+	a.Write(e)
+
+	return resp, err
+}
+
+// Write writes the entry to the log.
+func (a *AccessLog) Write(e *AccessLogEntry) {
+	var line []byte
+
+	switch a.Format {
+	case AccessLogJSON:
+		p, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(p, '\n')
+	case AccessLogLogfmt:
+		line = e.logfmt()
+	default:
+		line = e.common()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.Writer.Write(line)
+}
+
+func (e *AccessLogEntry) common() []byte {
+	return []byte(fmt.Sprintf("%s - %s [%s] %q %s %d %d\n",
+		orDash(e.RemoteAddr),
+		orDash(e.Caller),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method,
+		e.Status,
+		e.Bytes,
+		e.Latency/time.Microsecond,
+	))
+}
+
+func (e *AccessLogEntry) logfmt() []byte {
+	var buf bytes.Buffer
+
+	pairs := [][2]string{
+		{"time", e.Time.Format(time.RFC3339)},
+		{"method", e.Method},
+		{"caller", e.Caller},
+		{"kite", e.Kite},
+		{"remote_addr", e.RemoteAddr},
+		{"status", e.Status},
+		{"bytes", strconv.Itoa(e.Bytes)},
+		{"latency", e.Latency.String()},
+	}
+
+	for i, kv := range pairs {
+		if i != 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(kv[0])
+		buf.WriteByte('=')
+
+		if kv[1] == "" || strings.ContainsAny(kv[1], " =\"") {
+			buf.WriteString(strconv.Quote(kv[1]))
+		} else {
+			buf.WriteString(kv[1])
+		}
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
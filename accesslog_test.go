@@ -0,0 +1,129 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestAccessLog(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var buf syncBuffer
+
+	srv := NewWithConfig("accesslog-server", "0.0.1", cfg)
+	NewAccessLog(&buf, AccessLogJSON).Use(srv)
+
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+	srv.HandleFunc("fail", func(r *Request) (interface{}, error) {
+		return nil, &Error{Type: "invalidInput", Message: "fail"}
+	})
+	srv.HandleFunc("broken", func(r *Request) (interface{}, error) {
+		return nil, errors.New("broken")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("accesslog-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+	c.TellWithTimeout("fail", 4*time.Second)
+	c.TellWithTimeout("broken", 4*time.Second)
+
+	var entries []AccessLogEntry
+
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		var e AccessLogEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("Decode()=%s", err)
+		}
+		entries = append(entries, e)
+	}
+
+	want := []struct {
+		method, status string
+		bytes          int
+	}{
+		{"echo", "ok", len(`"hello"`)},
+		{"fail", "invalidInput", 0},
+		{"broken", "genericError", 0},
+	}
+
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+
+	for i, w := range want {
+		e := entries[i]
+
+		if e.Method != w.method || e.Status != w.status || e.Bytes != w.bytes {
+			t.Errorf("%d: got %s %s %d, want %s %s %d", i, e.Method, e.Status, e.Bytes, w.method, w.status, w.bytes)
+		}
+
+		if e.Kite != "accesslog-client" || e.Latency <= 0 {
+			t.Errorf("%d: got kite %q, latency %s", i, e.Kite, e.Latency)
+		}
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	e := &AccessLogEntry{
+		Time:    time.Date(2016, 10, 10, 13, 55, 36, 0, time.UTC),
+		Method:  "square",
+		Caller:  "alice",
+		Kite:    "math client",
+		Status:  "ok",
+		Bytes:   3,
+		Latency: 1250 * time.Microsecond,
+	}
+
+	cases := map[AccessLogFormat]string{
+		AccessLogCommon: `- - alice [10/Oct/2016:13:55:36 +0000] "square" ok 3 1250` + "\n",
+		AccessLogLogfmt: `time=2016-10-10T13:55:36Z method=square caller=alice kite="math client" remote_addr="" status=ok bytes=3 latency=1.25ms` + "\n",
+	}
+
+	for format, want := range cases {
+		var buf bytes.Buffer
+
+		NewAccessLog(&buf, format).Write(e)
+
+		if got := buf.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package kite
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of AdaptiveTimeout.
+var (
+	DefaultTimeoutPercentile = 0.99
+	DefaultTimeoutFactor     = 3.0
+	DefaultTimeoutWindow     = 100
+	DefaultTimeoutMinSamples = 10
+)
+
+// AdaptiveTimeout derives timeouts of calls from the latency of previous
+// calls of the same method, see WithAdaptiveTimeout. The timeout of
+// a method is a percentile of its recent latencies multiplied by a factor,
+// so calls of fast methods, like pings, fail fast, while slow ones, like
+// file transfers, are given the time they need.
+//
+// An AdaptiveTimeout may be shared by multiple clients.
+type AdaptiveTimeout struct {
+	// Percentile of latencies the timeout is derived from, in (0, 1].
+	//
+	// If zero, DefaultTimeoutPercentile is used.
+	Percentile float64
+
+	// Factor the percentile is multiplied by.
+	//
+	// If zero, DefaultTimeoutFactor is used.
+	Factor float64
+
+	// Min and Max bound the derived timeouts. Zero means no bound.
+	Min time.Duration
+	Max time.Duration
+
+	// Window is the number of recent latencies of a method kept.
+	//
+	// If zero, DefaultTimeoutWindow is used.
+	Window int
+
+	// MinSamples is the number of latencies, which must be observed for
+	// a method before its timeout is derived. Until then the default
+	// timeout of the client is used.
+	//
+	// If zero, DefaultTimeoutMinSamples is used.
+	MinSamples int
+
+	mu      sync.Mutex
+	methods map[string]*latencyWindow
+}
+
+// latencyWindow keeps recent latencies in a ring buffer.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// WithAdaptiveTimeout makes the client derive timeouts of calls made
+// without a timeout from the latencies of the methods, see AdaptiveTimeout.
+// Calls, which time out, are observed with the latency of their timeout.
+func WithAdaptiveTimeout(a *AdaptiveTimeout) ClientOption {
+	return func(c *Client) {
+		c.adaptive = a
+	}
+}
+
+// Observe records the latency of a call of the method.
+func (a *AdaptiveTimeout) Observe(method string, latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.methods == nil {
+		a.methods = make(map[string]*latencyWindow)
+	}
+
+	w, ok := a.methods[method]
+	if !ok {
+		w = &latencyWindow{}
+		a.methods[method] = w
+	}
+
+	size := a.Window
+	if size <= 0 {
+		size = DefaultTimeoutWindow
+	}
+
+	if len(w.samples) < size {
+		w.samples = append(w.samples, latency)
+		return
+	}
+
+	w.samples[w.next%len(w.samples)] = latency
+	w.next++
+}
+
+// Timeout gives the timeout of calls of the method, or zero if not enough
+// latencies of the method were observed.
+func (a *AdaptiveTimeout) Timeout(method string) time.Duration {
+	a.mu.Lock()
+	w, ok := a.methods[method]
+	var samples []time.Duration
+	if ok {
+		samples = append(samples, w.samples...)
+	}
+	a.mu.Unlock()
+
+	min := a.MinSamples
+	if min <= 0 {
+		min = DefaultTimeoutMinSamples
+	}
+
+	if len(samples) < min {
+		return 0
+	}
+
+	p := a.Percentile
+	if p <= 0 || p > 1 {
+		p = DefaultTimeoutPercentile
+	}
+
+	factor := a.Factor
+	if factor <= 0 {
+		factor = DefaultTimeoutFactor
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	i := int(p*float64(len(samples))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+
+	timeout := time.Duration(float64(samples[i]) * factor)
+
+	if a.Min > 0 && timeout < a.Min {
+		timeout = a.Min
+	}
+
+	if a.Max > 0 && timeout > a.Max {
+		timeout = a.Max
+	}
+
+	return timeout
+}
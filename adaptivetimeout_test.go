@@ -0,0 +1,99 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestAdaptiveTimeoutEstimate(t *testing.T) {
+	a := &AdaptiveTimeout{
+		Percentile: 0.9,
+		Factor:     2,
+		Window:     10,
+		MinSamples: 5,
+	}
+
+	for i := 1; i <= 4; i++ {
+		a.Observe("m", time.Duration(i)*time.Millisecond)
+	}
+
+	if got := a.Timeout("m"); got != 0 {
+		t.Fatalf("got %s, want no timeout before MinSamples", got)
+	}
+
+	for i := 5; i <= 10; i++ {
+		a.Observe("m", time.Duration(i)*time.Millisecond)
+	}
+
+	if got, want := a.Timeout("m"), 18*time.Millisecond; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// Overwrites the oldest latencies.
+	for i := 0; i < 10; i++ {
+		a.Observe("m", time.Millisecond)
+	}
+
+	if got, want := a.Timeout("m"), 2*time.Millisecond; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	a.Min = 5 * time.Millisecond
+	if got := a.Timeout("m"); got != a.Min {
+		t.Fatalf("got %s, want %s", got, a.Min)
+	}
+
+	if got := a.Timeout("other"); got != 0 {
+		t.Fatalf("got %s, want no timeout of unobserved method", got)
+	}
+}
+
+func TestAdaptiveTimeout(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("adaptive-server", "0.0.1", cfg)
+	srv.HandleFunc("sleep", func(r *Request) (interface{}, error) {
+		d := time.Duration(r.Args.One().MustFloat64()) * time.Millisecond
+		time.Sleep(d)
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := &AdaptiveTimeout{
+		Factor:     2,
+		Min:        50 * time.Millisecond,
+		MinSamples: 5,
+	}
+
+	c := New("adaptive-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL), WithAdaptiveTimeout(a))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.Tell("sleep", 0); err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+	}
+
+	if got := a.Timeout("sleep"); got != a.Min {
+		t.Fatalf("got %s, want %s", got, a.Min)
+	}
+
+	_, err := c.Tell("sleep", 500)
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("got %v, want timeout error", err)
+	}
+
+	if _, err := c.TellWithTimeout("sleep", 2*time.Second, 100); err != nil {
+		t.Fatalf("TellWithTimeout()=%s", err)
+	}
+}
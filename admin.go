@@ -0,0 +1,343 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/koding/cache"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+)
+
+// ErrConnectionNotFound is returned by kite.admin.disconnect when there
+// is no connected client with the given ID.
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// AdminConnection describes a single connection held by the kite,
+// as returned by the kite.admin.connections method.
+type AdminConnection struct {
+	ID         string            `json:"id"`
+	Kite       protocol.Kite     `json:"kite"`
+	RemoteAddr string            `json:"remoteAddr,omitempty"`
+	Connected  time.Time         `json:"connected"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// connectedClient is a client connected to the kite's server.
+type connectedClient struct {
+	client    *Client
+	connected time.Time
+}
+
+// Draining tells whether the kite is in drain mode.
+func (k *Kite) Draining() bool {
+	return atomic.LoadInt32(&k.draining) == 1
+}
+
+// SetDraining toggles drain mode. A draining kite refuses new
+// connections, while already connected clients are served as usual.
+func (k *Kite) SetDraining(drain bool) {
+	var v int32
+	if drain {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&k.draining, v) != v {
+		k.Log.Info("drain mode: %t", drain)
+	}
+}
+
+// Connections gives a list of clients currently connected to the kite.
+func (k *Kite) Connections() []*AdminConnection {
+	return k.QueryConnections(nil)
+}
+
+func (k *Kite) addClient(id string, c *Client) {
+	k.clientsMu.Lock()
+	k.clients[id] = &connectedClient{
+		client:    c,
+		connected: time.Now(),
+	}
+	k.clientsMu.Unlock()
+}
+
+func (k *Kite) removeClient(id string) {
+	k.clientsMu.Lock()
+	delete(k.clients, id)
+	k.clientsMu.Unlock()
+}
+
+// AdminOnly wraps the given handler, so it is allowed to be called
+// only by users for which IsAdmin returns true.
+func (k *Kite) AdminOnly(fn HandlerFunc) HandlerFunc {
+	return func(r *Request) (interface{}, error) {
+		if !k.IsAdmin(r.Username) {
+			return nil, &Error{
+				Type:    "authenticationError",
+				Message: fmt.Sprintf("user %q is not allowed to call %s", r.Username, r.Method),
+			}
+		}
+
+		return fn(r)
+	}
+}
+
+// IsAdmin tells whether the given user is listed in Kite.Admins, or is
+// the owner of the kite if the list is empty.
+func (k *Kite) IsAdmin(username string) bool {
+	if len(k.Admins) == 0 {
+		return username == k.Config.Username
+	}
+
+	for _, admin := range k.Admins {
+		if admin == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleAdminSetLogLevel changes the log level of the kite.
+func (k *Kite) handleAdminSetLogLevel(r *Request) (interface{}, error) {
+	level := r.Args.One().MustString()
+
+	if err := k.SetRuntimeConfig(&config.Runtime{LogLevel: level}); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// handleAdminSetConfig applies the runtime configuration given
+// as the argument.
+func (k *Kite) handleAdminSetConfig(r *Request) (interface{}, error) {
+	var rc config.Runtime
+
+	if err := r.Args.One().Unmarshal(&rc); err != nil {
+		return nil, err
+	}
+
+	if err := k.SetRuntimeConfig(&rc); err != nil {
+		return nil, err
+	}
+
+	return k.RuntimeConfig(), nil
+}
+
+// handleAdminGoroutines returns stack traces of all running goroutines.
+func (k *Kite) handleAdminGoroutines(r *Request) (interface{}, error) {
+	var buf bytes.Buffer
+
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return nil, err
+	}
+
+	return buf.String(), nil
+}
+
+// handleAdminConnections returns a list of connected clients, which
+// are selected by the optional ConnectionQuery argument.
+func (k *Kite) handleAdminConnections(r *Request) (interface{}, error) {
+	var q *ConnectionQuery
+
+	if r.Args != nil {
+		args, err := r.Args.Slice()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(args) > 0 {
+			if err := args[0].Unmarshal(&q); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return k.QueryConnections(q), nil
+}
+
+// Disconnect closes connection of the client with the given ID,
+// as reported by Connections.
+func (k *Kite) Disconnect(id string) error {
+	k.clientsMu.Lock()
+	cc, ok := k.clients[id]
+	k.clientsMu.Unlock()
+
+	if !ok {
+		return ErrConnectionNotFound
+	}
+
+	// Close asynchronously, as the client may be the caller itself.
+	go cc.client.Close()
+
+	return nil
+}
+
+// handleAdminDisconnect closes connection of the client with the given ID.
+func (k *Kite) handleAdminDisconnect(r *Request) (interface{}, error) {
+	return nil, k.Disconnect(r.Args.One().MustString())
+}
+
+// handleAdminDrain toggles drain mode of the kite.
+func (k *Kite) handleAdminDrain(r *Request) (interface{}, error) {
+	k.SetDraining(r.Args.One().MustBool())
+
+	return nil, nil
+}
+
+// AdminHandler gives an HTTP handler serving the admin API of the kite:
+//
+//   - GET /health gives the health of the kite, see Health; the status
+//     is 503 if the kite is not ready
+//   - GET /connections gives the connected clients
+//   - POST /drain?enabled=false toggles drain mode, it is enabled
+//     if the parameter is missing
+//   - GET /config gives the runtime configuration, POST /config applies
+//     the one given in the request body
+//   - GET /docs gives the API documentation, see DocsHandler
+//   - GET /debug/pprof/ serves the net/http/pprof endpoints and
+//     GET /debug/runtime gives RuntimeStats, if EnableProfiling was
+//     called; the admin must be granted AdminScope
+//
+// All requests must be authorized by an admin, see authorizeAdmin.
+func (k *Kite) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/health", k.adminOnlyHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h := k.Health(req.Context())
+
+		status := http.StatusOK
+		if !h.Ready {
+			status = http.StatusServiceUnavailable
+		}
+
+		k.writeAdminJSON(w, status, h)
+	})))
+
+	mux.Handle("/connections", k.adminOnlyHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		k.writeAdminJSON(w, http.StatusOK, k.Connections())
+	})))
+
+	mux.Handle("/drain", k.adminOnlyHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		drain := true
+
+		if v := req.URL.Query().Get("enabled"); v != "" {
+			var err error
+			if drain, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "invalid enabled parameter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		k.SetDraining(drain)
+
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	mux.Handle("/config", k.adminOnlyHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "POST" {
+			var rc config.Runtime
+
+			if err := json.NewDecoder(req.Body).Decode(&rc); err != nil {
+				http.Error(w, "invalid configuration: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := k.SetRuntimeConfig(&rc); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		k.writeAdminJSON(w, http.StatusOK, k.RuntimeConfig())
+	})))
+
+	mux.Handle("/docs", k.adminOnlyHTTP(k.DocsHandler()))
+
+	debug := k.adminOnlyHTTP(k.profilingHandler(), AdminScope)
+	mux.Handle("/debug/pprof/", debug)
+	mux.Handle("/debug/runtime", debug)
+
+	return mux
+}
+
+// adminOnlyHTTP wraps the given handler, so it serves only requests
+// authorized by an admin granted the given scopes, see authorizeAdmin.
+func (k *Kite) adminOnlyHTTP(h http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if status, err := k.authorizeAdmin(req, scopes...); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// authorizeAdmin authenticates the HTTP request with the credentials given
+// in the "Authorization: <type> <key>" header, e.g. "token eyJhbGci...",
+// using the Authenticators of the kite, and tells whether the user is an
+// admin granted the given scopes, as done for kite.admin.* methods, see
+// AdminOnly and Method.RequireScope. It returns the HTTP status for the
+// error.
+func (k *Kite) authorizeAdmin(req *http.Request, scopes ...string) (int, error) {
+	header := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(header) != 2 || header[1] == "" {
+		return http.StatusUnauthorized, errors.New("no authentication information is provided")
+	}
+
+	authType := header[0]
+	if strings.EqualFold(authType, "Bearer") {
+		authType = "token"
+	}
+
+	authenticate := k.Authenticators[authType]
+	if authenticate == nil {
+		return http.StatusUnauthorized, fmt.Errorf("unknown authentication type: %s", authType)
+	}
+
+	r := &Request{
+		LocalKite: k,
+		Auth:      &Auth{Type: authType, Key: header[1]},
+		Context:   cache.NewMemory(),
+	}
+
+	if err := authenticate(r); err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("%s: %s", authType, err)
+	}
+
+	if !k.IsAdmin(r.Username) {
+		return http.StatusForbidden, fmt.Errorf("user %q is not an admin", r.Username)
+	}
+
+	for _, scope := range scopes {
+		if !r.HasScope(scope) {
+			return http.StatusForbidden, fmt.Errorf("token is not granted %q scope", scope)
+		}
+	}
+
+	return 0, nil
+}
+
+func (k *Kite) writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		k.Log.Error("unable to write admin response: %s", err)
+	}
+}
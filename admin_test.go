@@ -0,0 +1,289 @@
+package kite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/testkeys"
+	"github.com/koding/kite/testutil"
+)
+
+func TestAdmin(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("admin-server", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("admin-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.TellWithTimeout("kite.admin.connections", 4*time.Second)
+	if err != nil {
+		t.Fatalf("kite.admin.connections: %s", err)
+	}
+
+	var conns []*AdminConnection
+	if err := result.Unmarshal(&conns); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if len(conns) != 1 {
+		t.Fatalf("got %d connections, want 1", len(conns))
+	}
+
+	if conns[0].Kite.Name != "admin-client" {
+		t.Fatalf("got %q, want %q", conns[0].Kite.Name, "admin-client")
+	}
+
+	result, err = c.TellWithTimeout("kite.admin.goroutines", 4*time.Second)
+	if err != nil {
+		t.Fatalf("kite.admin.goroutines: %s", err)
+	}
+
+	if s := result.MustString(); !strings.Contains(s, "goroutine") {
+		t.Fatalf("unexpected goroutine dump: %q", s)
+	}
+
+	if _, err := c.TellWithTimeout("kite.admin.setLogLevel", 4*time.Second, "warning"); err != nil {
+		t.Fatalf("kite.admin.setLogLevel: %s", err)
+	}
+
+	if lvl := srv.RuntimeConfig().LogLevel; lvl != "warning" {
+		t.Fatalf("got %q, want %q", lvl, "warning")
+	}
+
+	if _, err := c.TellWithTimeout("kite.admin.setLogLevel", 4*time.Second, "verbose"); err == nil {
+		t.Fatal("expected kite.admin.setLogLevel to fail for unknown level")
+	}
+
+	if _, err := c.TellWithTimeout("kite.admin.drain", 4*time.Second, true); err != nil {
+		t.Fatalf("kite.admin.drain: %s", err)
+	}
+
+	if !srv.Draining() {
+		t.Fatal("expected kite to be draining")
+	}
+
+	srv.Admins = []string{"root"}
+
+	_, err = c.TellWithTimeout("kite.admin.drain", 4*time.Second, false)
+	if e, ok := err.(*Error); !ok || e.Type != "authenticationError" {
+		t.Fatalf("got %#v, want authenticationError", err)
+	}
+
+	if !srv.Draining() {
+		t.Fatal("expected kite to be still draining")
+	}
+}
+
+func TestAdmin_QueryConnections(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("admin-server", "0.0.1", cfg)
+	srv.HandleFunc("join", func(r *Request) (interface{}, error) {
+		r.Client.SetLabel("room", r.Args.One().MustString())
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	notified := make(chan string, 2)
+
+	dial := func(name string) *Client {
+		k := New(name, "0.0.1")
+		k.HandleFunc("notify", func(r *Request) (interface{}, error) {
+			notified <- name + ":" + r.Args.One().MustString()
+			return nil, nil
+		})
+
+		c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+
+		return c
+	}
+
+	gopher := dial("gopher")
+	defer gopher.Close()
+
+	rustacean := dial("rustacean")
+	defer rustacean.Close()
+
+	if _, err := gopher.TellWithTimeout("join", 4*time.Second, "go"); err != nil {
+		t.Fatalf("join: %s", err)
+	}
+
+	// The identity of a connected kite is known after its first call.
+	if _, err := rustacean.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping: %s", err)
+	}
+
+	q := &ConnectionQuery{Labels: map[string]string{"room": "go"}}
+
+	result, err := gopher.TellWithTimeout("kite.admin.connections", 4*time.Second, q)
+	if err != nil {
+		t.Fatalf("kite.admin.connections: %s", err)
+	}
+
+	var conns []*AdminConnection
+	if err := result.Unmarshal(&conns); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if len(conns) != 1 {
+		t.Fatalf("got %d connections, want 1", len(conns))
+	}
+
+	if conns[0].Kite.Name != "gopher" || conns[0].Labels["room"] != "go" {
+		t.Fatalf("got %+v, want gopher connection in go room", conns[0])
+	}
+
+	if n := len(srv.QueryConnections(&ConnectionQuery{Name: "rustacean"})); n != 1 {
+		t.Fatalf("got %d rustacean connections, want 1", n)
+	}
+
+	if n := len(srv.QueryConnections(&ConnectionQuery{Username: "nobody"})); n != 0 {
+		t.Fatalf("got %d connections of nobody, want 0", n)
+	}
+
+	for _, c := range srv.Clients(q) {
+		if _, err := c.TellWithTimeout("notify", 4*time.Second, "hello"); err != nil {
+			t.Fatalf("notify: %s", err)
+		}
+	}
+
+	select {
+	case got := <-notified:
+		if got != "gopher:hello" {
+			t.Fatalf("got %q, want %q", got, "gopher:hello")
+		}
+	default:
+		t.Fatal("want gopher to be notified")
+	}
+
+	for _, c := range srv.Clients(nil) {
+		c.SetLabel("room", "")
+	}
+
+	if n := len(srv.Clients(q)); n != 0 {
+		t.Fatalf("got %d clients in go room, want 0", n)
+	}
+}
+
+func TestAdminHandler_Config(t *testing.T) {
+	cfg := config.New()
+	cfg.Username = "operator"
+	cfg.KontrolKey = testkeys.Public
+
+	k := NewWithConfig("admin-server", "0.0.1", cfg)
+	defer k.Close()
+
+	adminKey := testutil.NewKiteKeyUsername("operator").Raw
+
+	if err := k.SetRuntimeConfig(&config.Runtime{KiteKey: adminKey}); err != nil {
+		t.Fatalf("SetRuntimeConfig()=%s", err)
+	}
+
+	cases := map[string]struct {
+		auth   string
+		status int
+	}{
+		"no auth":       {"", http.StatusUnauthorized},
+		"invalid key":   {"kiteKey invalid", http.StatusUnauthorized},
+		"unknown type":  {"basic " + adminKey, http.StatusUnauthorized},
+		"not an admin":  {"kiteKey " + testutil.NewKiteKeyUsername("intruder").Raw, http.StatusForbidden},
+		"admin":         {"kiteKey " + adminKey, http.StatusOK},
+		"admin changes": {"kiteKey " + adminKey, http.StatusOK},
+	}
+
+	for name, cas := range cases {
+		method, body := "GET", ""
+		if name == "admin changes" {
+			method, body = "POST", `{"logLevel":"debug"}`
+		}
+
+		req := httptest.NewRequest(method, "/config", strings.NewReader(body))
+		if cas.auth != "" {
+			req.Header.Set("Authorization", cas.auth)
+		}
+
+		rec := httptest.NewRecorder()
+		k.AdminHandler().ServeHTTP(rec, req)
+
+		if rec.Code != cas.status {
+			t.Fatalf("%s: got status %d, want %d: %s", name, rec.Code, cas.status, rec.Body)
+		}
+
+		if strings.Contains(rec.Body.String(), adminKey) {
+			t.Fatalf("%s: response contains the kite key", name)
+		}
+	}
+
+	if lvl := k.RuntimeConfig().LogLevel; lvl != "debug" {
+		t.Fatalf("got log level %q, want %q", lvl, "debug")
+	}
+}
+
+func TestAdminHandler_Unauthorized(t *testing.T) {
+	cfg := config.New()
+	cfg.KontrolKey = testkeys.Public
+
+	k := NewWithConfig("admin-server", "0.0.1", cfg)
+	defer k.Close()
+
+	intruder := "kiteKey " + testutil.NewKiteKeyUsername("intruder").Raw
+
+	cases := []struct {
+		method, path, auth string
+		status             int
+	}{
+		{"GET", "/health", "", http.StatusUnauthorized},
+		{"GET", "/connections", "", http.StatusUnauthorized},
+		{"GET", "/connections", intruder, http.StatusForbidden},
+		{"POST", "/drain", "", http.StatusUnauthorized},
+		{"POST", "/drain", intruder, http.StatusForbidden},
+		{"GET", "/docs", "", http.StatusUnauthorized},
+	}
+
+	for _, cas := range cases {
+		req := httptest.NewRequest(cas.method, cas.path, nil)
+		if cas.auth != "" {
+			req.Header.Set("Authorization", cas.auth)
+		}
+
+		rec := httptest.NewRecorder()
+		k.AdminHandler().ServeHTTP(rec, req)
+
+		if rec.Code != cas.status {
+			t.Fatalf("%s %s: got status %d, want %d: %s", cas.method, cas.path, rec.Code, cas.status, rec.Body)
+		}
+	}
+
+	if k.Draining() {
+		t.Fatal("expected unauthorized requests not to drain the kite")
+	}
+
+	req := httptest.NewRequest("POST", "/drain", nil)
+	req.Header.Set("Authorization", "kiteKey "+testutil.NewKiteKeyUsername(cfg.Username).Raw)
+
+	rec := httptest.NewRecorder()
+	k.AdminHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || !k.Draining() {
+		t.Fatalf("got status %d, want the admin to drain the kite: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,70 @@
+package kite
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/koding/kite/protocol"
+)
+
+// selectURL gives the URL to connect to the kite with, see
+// Kite.URLPreference.
+func (k *Kite) selectURL(kite *protocol.KiteWithToken, nets []*net.IPNet) string {
+	if len(kite.URLs) == 0 {
+		return kite.URL
+	}
+
+	for _, labels := range k.URLPreference {
+		for _, u := range kite.URLs {
+			if u.Matches(labels) {
+				return u.URL
+			}
+		}
+	}
+
+	for _, u := range kite.URLs {
+		if ip := urlIP(u.URL); ip != nil && containsIP(nets, ip) {
+			return u.URL
+		}
+	}
+
+	if kite.URL != "" {
+		return kite.URL
+	}
+
+	return kite.URLs[0].URL
+}
+
+// urlIP gives the IP of the URL's host, or nil if the host is not an IP.
+func urlIP(rawurl string) net.IP {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil
+	}
+
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return net.ParseIP(host)
+}
+
+// localNetworks gives the networks of the local interfaces, excluding
+// loopback ones.
+func localNetworks() []*net.IPNet {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var nets []*net.IPNet
+
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && !n.IP.IsLoopback() {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
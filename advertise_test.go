@@ -0,0 +1,59 @@
+package kite
+
+import (
+	"net"
+	"testing"
+
+	"github.com/koding/kite/protocol"
+)
+
+func TestSelectURL(t *testing.T) {
+	_, internal, err := net.ParseCIDR("10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("ParseCIDR()=%s", err)
+	}
+
+	remote := &protocol.KiteWithToken{
+		URL: "https://math.example.com/kite",
+		URLs: []protocol.AdvertisedURL{
+			{URL: "http://10.1.2.3:4000/kite", Labels: map[string]string{"network": "internal"}},
+			{URL: "http://[2001:db8::1]:4000/kite", Labels: map[string]string{"family": "ipv6"}},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		preference []map[string]string
+		nets       []*net.IPNet
+		kite       *protocol.KiteWithToken
+		want       string
+	}{{
+		name: "primary",
+		kite: remote,
+		want: "https://math.example.com/kite",
+	}, {
+		name: "same network",
+		nets: []*net.IPNet{internal},
+		kite: remote,
+		want: "http://10.1.2.3:4000/kite",
+	}, {
+		name:       "preference",
+		preference: []map[string]string{{"family": "ipv4"}, {"family": "ipv6"}},
+		nets:       []*net.IPNet{internal},
+		kite:       remote,
+		want:       "http://[2001:db8::1]:4000/kite",
+	}, {
+		name:       "no additional urls",
+		preference: []map[string]string{{"family": "ipv6"}},
+		kite:       &protocol.KiteWithToken{URL: "http://localhost:4000/kite"},
+		want:       "http://localhost:4000/kite",
+	}}
+
+	for _, cas := range cases {
+		k := &Kite{URLPreference: cas.preference}
+
+		if got := k.selectURL(cas.kite, cas.nets); got != cas.want {
+			t.Errorf("%s: got %q, want %q", cas.name, got, cas.want)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package kite
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Doc sets the description of the method, which is used in generated
+// API documentation, see Kite.APIDoc.
+func (m *Method) Doc(text string) *Method {
+	m.doc = text
+	return m
+}
+
+// Args describes arguments of the method in generated API documentation.
+// Each value is an example of the type of the argument at its position,
+// e.g. a zero value of a struct the argument is unmarshaled to.
+func (m *Method) Args(args ...interface{}) *Method {
+	m.args = m.args[:0]
+	for _, v := range args {
+		m.args = append(m.args, reflect.TypeOf(v))
+	}
+	return m
+}
+
+// Returns describes the result of the method in generated API
+// documentation. The value is an example of the type of the result.
+func (m *Method) Returns(v interface{}) *Method {
+	m.result = reflect.TypeOf(v)
+	return m
+}
+
+// APIDoc describes methods of a kite.
+type APIDoc struct {
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Methods []*MethodDoc `json:"methods"`
+}
+
+// MethodDoc describes a single method of a kite.
+type MethodDoc struct {
+	Name          string        `json:"name"`
+	Doc           string        `json:"doc,omitempty"`
+	Args          []*Schema     `json:"args,omitempty"`
+	Result        *Schema       `json:"result,omitempty"`
+	Authenticated bool          `json:"authenticated"`
+	Scopes        []string      `json:"scopes,omitempty"`
+	Signed        bool          `json:"signed,omitempty"`
+	Timeout       time.Duration `json:"timeout,omitempty"`
+}
+
+// Schema is a JSON Schema of a Go type.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	GoType               string             `json:"x-go-type,omitempty"`
+}
+
+// String gives the schema as indented JSON.
+func (s *Schema) String() string {
+	p, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(p)
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// NewSchema gives a schema of the type of v, as it is encoded
+// with the encoding/json package.
+func NewSchema(v interface{}) *Schema {
+	return newSchema(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+func newSchema(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	}
+
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return &Schema{GoType: t.String()} // custom encoding
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: newSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: newSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		s := &Schema{Type: "object", GoType: t.String()}
+
+		if seen[t] {
+			return s // recursive type
+		}
+
+		seen[t] = true
+		defer delete(seen, t)
+
+		s.Properties = make(map[string]*Schema)
+		structSchema(t, s, seen)
+
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+func structSchema(t reflect.Type, s *Schema, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				structSchema(ft, s, seen)
+				continue
+			}
+		}
+
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+
+		s.Properties[name] = newSchema(f.Type, seen)
+
+		if !strings.Contains(f.Tag.Get("json"), ",omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// APIDoc describes methods registered with the kite. Built-in kite.*
+// methods are omitted.
+func (k *Kite) APIDoc() *APIDoc {
+	doc := &APIDoc{
+		Name:    k.name,
+		Version: k.version,
+	}
+
+	k.methods.mu.RLock()
+	defer k.methods.mu.RUnlock()
+
+	for name, m := range k.methods.m {
+		if strings.HasPrefix(name, "kite.") {
+			continue
+		}
+
+		md := &MethodDoc{
+			Name:          name,
+			Doc:           m.doc,
+			Authenticated: m.authenticate,
+			Scopes:        m.scopes,
+			Signed:        m.signed,
+			Timeout:       m.timeout,
+		}
+
+		for _, t := range m.args {
+			md.Args = append(md.Args, newSchema(t, make(map[reflect.Type]bool)))
+		}
+
+		if m.result != nil {
+			md.Result = newSchema(m.result, make(map[reflect.Type]bool))
+		}
+
+		doc.Methods = append(doc.Methods, md)
+	}
+
+	sort.Slice(doc.Methods, func(i, j int) bool {
+		return doc.Methods[i].Name < doc.Methods[j].Name
+	})
+
+	return doc
+}
+
+var markdownTmpl = template.Must(template.New("markdown").Parse(`# {{.Name}} {{.Version}}
+{{range .Methods}}
+## {{.Name}}
+{{if .Doc}}
+{{.Doc}}
+{{end}}
+- Authentication: {{if .Authenticated}}required{{else}}not required{{end}}
+{{- if .Scopes}}
+- Scopes: {{range $i, $s := .Scopes}}{{if $i}}, {{end}}` + "`{{$s}}`" + `{{end}}
+{{- end}}
+{{- if .Signed}}
+- Signature: required
+{{- end}}
+{{- if .Timeout}}
+- Timeout: {{.Timeout}}
+{{- end}}
+{{range $i, $a := .Args}}
+Argument {{$i}}:
+
+` + "```json" + `
+{{$a}}
+` + "```" + `
+{{end}}
+{{- if .Result}}
+Result:
+
+` + "```json" + `
+{{.Result}}
+` + "```" + `
+{{end}}
+{{- end}}`))
+
+var htmlTmpl = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} {{.Version}}</title>
+</head>
+<body>
+<h1>{{.Name}} {{.Version}}</h1>
+<ul>
+{{- range .Methods}}
+<li><a href="#{{.Name}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- range .Methods}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+{{- if .Doc}}
+<p>{{.Doc}}</p>
+{{- end}}
+<ul>
+<li>Authentication: {{if .Authenticated}}required{{else}}not required{{end}}</li>
+{{- if .Scopes}}
+<li>Scopes: {{range $i, $s := .Scopes}}{{if $i}}, {{end}}<code>{{$s}}</code>{{end}}</li>
+{{- end}}
+{{- if .Signed}}
+<li>Signature: required</li>
+{{- end}}
+{{- if .Timeout}}
+<li>Timeout: {{.Timeout}}</li>
+{{- end}}
+</ul>
+{{- range $i, $a := .Args}}
+<h3>Argument {{$i}}</h3>
+<pre>{{$a}}</pre>
+{{- end}}
+{{- if .Result}}
+<h3>Result</h3>
+<pre>{{.Result}}</pre>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteMarkdown writes the documentation in Markdown format.
+func (d *APIDoc) WriteMarkdown(w io.Writer) error {
+	return markdownTmpl.Execute(w, d)
+}
+
+// WriteHTML writes the documentation as an HTML page.
+func (d *APIDoc) WriteHTML(w io.Writer) error {
+	return htmlTmpl.Execute(w, d)
+}
+
+// AsyncAPI gives the documentation as an AsyncAPI 2.6 document. Each method
+// is described by a channel named after it, which receives calls.
+func (d *APIDoc) AsyncAPI() map[string]interface{} {
+	channels := make(map[string]interface{}, len(d.Methods))
+
+	for _, m := range d.Methods {
+		args := make([]*Schema, len(m.Args))
+		copy(args, m.Args)
+
+		message := map[string]interface{}{
+			"name": m.Name,
+			"payload": map[string]interface{}{
+				"type":  "array",
+				"items": args,
+			},
+		}
+
+		if m.Result != nil {
+			message["x-kite-result"] = m.Result
+		}
+
+		op := map[string]interface{}{
+			"operationId": m.Name,
+			"message":     message,
+		}
+
+		if m.Doc != "" {
+			op["description"] = m.Doc
+		}
+
+		if len(m.Scopes) != 0 {
+			op["x-kite-scopes"] = m.Scopes
+		}
+
+		channels[m.Name] = map[string]interface{}{
+			"publish": op,
+		}
+	}
+
+	return map[string]interface{}{
+		"asyncapi": "2.6.0",
+		"info": map[string]interface{}{
+			"title":   d.Name,
+			"version": d.Version,
+		},
+		"defaultContentType": "application/json",
+		"channels":           channels,
+	}
+}
+
+// DocsHandler gives an HTTP handler serving the API documentation of the
+// kite. The format is selected with the "format" query parameter, which
+// is one of "html" (default), "markdown", "json" or "asyncapi".
+//
+// Register it with HandleHTTP to publish the documentation:
+//
+//	k.HandleHTTP("/docs", k.DocsHandler())
+func (k *Kite) DocsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		doc := k.APIDoc()
+
+		var err error
+		switch format := req.URL.Query().Get("format"); format {
+		case "", "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = doc.WriteHTML(w)
+		case "markdown":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			err = doc.WriteMarkdown(w)
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(doc)
+		case "asyncapi":
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(doc.AsyncAPI())
+		default:
+			http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			k.Log.Error("unable to write API documentation: %s", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type apidocHost struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Parent *apidocHost       `json:"parent"`
+}
+
+type apidocRebootArgs struct {
+	Host  apidocHost    `json:"host"`
+	Delay time.Duration `json:"delay,omitempty"`
+	At    time.Time     `json:"at"`
+	Force bool          `json:"force"`
+	Data  []byte        `json:"data,omitempty"`
+	Notes []string      `json:"-"`
+}
+
+func TestAPIDoc(t *testing.T) {
+	k := New("apidoc", "1.0.0")
+	k.HandleFunc("reboot", func(*Request) (interface{}, error) { return nil, nil }).
+		Doc("Reboots the host.").
+		Args(apidocRebootArgs{}).
+		Returns(true).
+		RequireScope("hosts:write").
+		RequireSignature()
+	k.HandleFunc("status", func(*Request) (interface{}, error) { return nil, nil }).
+		DisableAuthentication()
+
+	doc := k.APIDoc()
+
+	if len(doc.Methods) != 2 || doc.Methods[0].Name != "reboot" || doc.Methods[1].Name != "status" {
+		t.Fatalf("got %+v, want reboot and status methods", doc.Methods)
+	}
+
+	reboot := doc.Methods[0]
+
+	if !reboot.Authenticated || !reboot.Signed || !reflect.DeepEqual(reboot.Scopes, []string{"hosts:write"}) {
+		t.Fatalf("got %+v", reboot)
+	}
+
+	if len(reboot.Args) != 1 {
+		t.Fatalf("got %d args, want 1", len(reboot.Args))
+	}
+
+	host := &Schema{
+		Type:   "object",
+		GoType: "kite.apidocHost",
+		Properties: map[string]*Schema{
+			"name":   {Type: "string"},
+			"labels": {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+			"parent": {Type: "object", GoType: "kite.apidocHost"},
+		},
+		Required: []string{"name"},
+	}
+
+	want := &Schema{
+		Type:   "object",
+		GoType: "kite.apidocRebootArgs",
+		Properties: map[string]*Schema{
+			"host":  host,
+			"delay": {Type: "integer"},
+			"at":    {Type: "string", Format: "date-time"},
+			"force": {Type: "boolean"},
+			"data":  {Type: "string", Format: "byte"},
+		},
+		Required: []string{"host", "at", "force"},
+	}
+
+	if got := reboot.Args[0]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	if !reflect.DeepEqual(reboot.Result, &Schema{Type: "boolean"}) {
+		t.Fatalf("got %s, want boolean", reboot.Result)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.WriteMarkdown(&buf); err != nil {
+		t.Fatalf("WriteMarkdown()=%s", err)
+	}
+
+	for _, s := range []string{"# apidoc 1.0.0", "## reboot", "Reboots the host.", "`hosts:write`", "## status", "Authentication: not required"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("want Markdown to contain %q:\n%s", s, &buf)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	k.DocsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/docs", nil))
+
+	if !strings.Contains(rec.Body.String(), `<h2 id="reboot">reboot</h2>`) {
+		t.Fatalf("want HTML documentation, got:\n%s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	k.DocsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/docs?format=asyncapi", nil))
+
+	var spec struct {
+		AsyncAPI string                     `json:"asyncapi"`
+		Channels map[string]json.RawMessage `json:"channels"`
+	}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if spec.AsyncAPI == "" || len(spec.Channels) != 2 || spec.Channels["reboot"] == nil {
+		t.Fatalf("got %+v", spec)
+	}
+}
@@ -0,0 +1,114 @@
+package kite
+
+import "github.com/koding/kite/dnode"
+
+// ArgsTransformer transforms arguments of method calls, for example to
+// compress, encrypt or convert them between versions of a method.
+//
+// Transformers added with Kite.TransformArgs form a pipeline: arguments
+// of outgoing calls pass the transformers in the order they were added,
+// arguments of incoming calls pass them in the reverse order, so each
+// transformer undoes on the receiving side what it did on the sending
+// side.
+type ArgsTransformer interface {
+	// TransformOut transforms arguments of a call to the method, before
+	// they are sent to the remote kite. Callbacks among the arguments
+	// are sent as usual.
+	TransformOut(method string, args []interface{}) ([]interface{}, error)
+
+	// TransformIn transforms arguments of a call to the method received
+	// from the remote kite, before the method handlers are called. A
+	// transformer changing args.Raw must keep paths of args.CallbackSpecs
+	// valid.
+	TransformIn(method string, args *dnode.Partial) (*dnode.Partial, error)
+}
+
+// ArgsTransformerFuncs is an adapter to use ordinary functions as
+// transformers. A nil function leaves the arguments as they are.
+type ArgsTransformerFuncs struct {
+	Out func(method string, args []interface{}) ([]interface{}, error)
+	In  func(method string, args *dnode.Partial) (*dnode.Partial, error)
+}
+
+var _ ArgsTransformer = ArgsTransformerFuncs{}
+
+// TransformOut calls f.Out(method, args), if f.Out is non-nil.
+func (f ArgsTransformerFuncs) TransformOut(method string, args []interface{}) ([]interface{}, error) {
+	if f.Out == nil {
+		return args, nil
+	}
+
+	return f.Out(method, args)
+}
+
+// TransformIn calls f.In(method, args), if f.In is non-nil.
+func (f ArgsTransformerFuncs) TransformIn(method string, args *dnode.Partial) (*dnode.Partial, error) {
+	if f.In == nil {
+		return args, nil
+	}
+
+	return f.In(method, args)
+}
+
+// TransformArgs adds the transformers to the end of the pipeline, which
+// transforms arguments of calls of all methods, sent by clients of the
+// kite or received by its handlers. Methods with the pipeline overridden
+// by TransformMethodArgs are not affected.
+func (k *Kite) TransformArgs(t ...ArgsTransformer) {
+	k.argsMu.Lock()
+	defer k.argsMu.Unlock()
+
+	k.argsTransformers = append(k.argsTransformers, t...)
+}
+
+// TransformMethodArgs overrides the pipeline for calls of the method,
+// both sent and received. When no transformers are given, arguments of
+// the method are not transformed.
+func (k *Kite) TransformMethodArgs(method string, t ...ArgsTransformer) {
+	k.argsMu.Lock()
+	defer k.argsMu.Unlock()
+
+	k.methodArgs[method] = append([]ArgsTransformer{}, t...)
+}
+
+// argsPipeline gives the transformers of arguments of the method.
+func (k *Kite) argsPipeline(method string) []ArgsTransformer {
+	k.argsMu.RLock()
+	defer k.argsMu.RUnlock()
+
+	if t, ok := k.methodArgs[method]; ok {
+		return t
+	}
+
+	return k.argsTransformers
+}
+
+// transformArgsOut passes arguments of an outgoing call to the method
+// through the pipeline.
+func (k *Kite) transformArgsOut(method string, args []interface{}) ([]interface{}, error) {
+	var err error
+
+	for _, t := range k.argsPipeline(method) {
+		if args, err = t.TransformOut(method, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+// transformArgsIn passes arguments of an incoming call to the method
+// through the pipeline, in the reverse order.
+func (k *Kite) transformArgsIn(method string, args *dnode.Partial) (*dnode.Partial, error) {
+	var err error
+
+	pipeline := k.argsPipeline(method)
+
+	for i := len(pipeline) - 1; i >= 0; i-- {
+		if args, err = pipeline[i].TransformIn(method, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+type taggedArgs struct {
+	Tag  string          `json:"tag"`
+	Args json.RawMessage `json:"args"`
+}
+
+// tagger wraps arguments in an object with the tag.
+func tagger(tag string) ArgsTransformer {
+	return ArgsTransformerFuncs{
+		Out: func(method string, args []interface{}) ([]interface{}, error) {
+			p, err := json.Marshal(args)
+			if err != nil {
+				return nil, err
+			}
+
+			return []interface{}{&taggedArgs{Tag: tag, Args: p}}, nil
+		},
+		In: func(method string, args *dnode.Partial) (*dnode.Partial, error) {
+			var e taggedArgs
+			if err := args.One().Unmarshal(&e); err != nil {
+				return nil, err
+			}
+
+			if e.Tag != tag {
+				return nil, fmt.Errorf("got %q tag, want %q", e.Tag, tag)
+			}
+
+			return &dnode.Partial{Raw: e.Args}, nil
+		},
+	}
+}
+
+func TestTransformArgs(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("args-server", "0.0.1", cfg)
+	srv.TransformArgs(tagger("a"), tagger("b"))
+	srv.TransformMethodArgs("plain")
+
+	echo := func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	}
+
+	srv.HandleFunc("echo", echo)
+	srv.HandleFunc("plain", echo)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("args-client", "0.0.1")
+	k.TransformArgs(tagger("a"), tagger("b"))
+	k.TransformMethodArgs("plain")
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	for _, method := range []string{"echo", "plain"} {
+		res, err := c.Tell(method, "hello")
+		if err != nil {
+			t.Fatalf("Tell(%q)=%s", method, err)
+		}
+
+		if s := res.MustString(); s != "hello" {
+			t.Fatalf("%s: got %q, want %q", method, s, "hello")
+		}
+	}
+
+	// The pipeline of the client is applied in the same order,
+	// so the server unwraps the tags in a wrong order.
+	k.TransformMethodArgs("echo", tagger("b"), tagger("a"))
+
+	_, err := c.Tell("echo", "hello")
+	if e, ok := err.(*Error); !ok || e.Type != "argumentError" {
+		t.Fatalf("got %#v, want argumentError", err)
+	}
+
+	k.TransformMethodArgs("echo", ArgsTransformerFuncs{
+		Out: func(string, []interface{}) ([]interface{}, error) {
+			return nil, errors.New("out of tags")
+		},
+	})
+
+	_, err = c.Tell("echo", "hello")
+	if e, ok := err.(*Error); !ok || e.Type != "sendError" {
+		t.Fatalf("got %#v, want sendError", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Package boltstore implements kite.OutboxStore backed by a local BoltDB
+// file, so messages pending delivery survive restarts of the kite.
+package boltstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/koding/kite"
+)
+
+// DefaultBucket is the bucket pending messages are stored in.
+const DefaultBucket = "kite-outbox"
+
+// OutboxStore is a kite.OutboxStore, which keeps each message as
+// a JSON-encoded value keyed by the message ID.
+type OutboxStore struct {
+	// DB is the database the messages are stored in.
+	//
+	// Required.
+	DB *bolt.DB
+
+	// Bucket is the name of the bucket the messages are stored in.
+	// Use different buckets for outboxes sharing the same database.
+	//
+	// If empty, DefaultBucket is used.
+	Bucket string
+}
+
+var _ kite.OutboxStore = (*OutboxStore)(nil)
+
+// NewOutboxStore gives new outbox store using the given database.
+func NewOutboxStore(db *bolt.DB) *OutboxStore {
+	return &OutboxStore{
+		DB: db,
+	}
+}
+
+// Open opens the database file at the given path, creating it if it does
+// not exist, and gives outbox store using it.
+func Open(path string) (*OutboxStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOutboxStore(db), nil
+}
+
+// Put implements the kite.OutboxStore interface.
+func (s *OutboxStore) Put(msg *kite.OutboxMessage) error {
+	p, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.bucket())
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(msg.ID), p)
+	})
+}
+
+// Delete implements the kite.OutboxStore interface.
+func (s *OutboxStore) Delete(id string) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket())
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(id))
+	})
+}
+
+// List implements the kite.OutboxStore interface.
+func (s *OutboxStore) List() ([]*kite.OutboxMessage, error) {
+	var msgs []*kite.OutboxMessage
+
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket())
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(_, v []byte) error {
+			var msg kite.OutboxMessage
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+
+			msgs = append(msgs, &msg)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// Close closes the underlying database.
+func (s *OutboxStore) Close() error {
+	return s.DB.Close()
+}
+
+func (s *OutboxStore) bucket() []byte {
+	if s.Bucket != "" {
+		return []byte(s.Bucket)
+	}
+
+	return []byte(DefaultBucket)
+}
@@ -0,0 +1,126 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// BroadcastOptions configures how Broadcast aggregates the replies.
+type BroadcastOptions struct {
+	// Partial, when true, makes Broadcast succeed with the results, which
+	// arrived before the ctx was done, as long as at least one kite
+	// replied successfully. Each of the remaining results carries its
+	// own error.
+	//
+	// By default Broadcast fails if any of the kites fails.
+	Partial bool
+
+	// Quorum is the number of kites, which must reply successfully for
+	// Broadcast to succeed. Broadcast returns as soon as the quorum is
+	// reached, without waiting for the other kites, whose results carry
+	// a "canceled" error then.
+	//
+	// If zero, all of the kites must reply, unless Partial is true.
+	Quorum int
+}
+
+// BroadcastResult is the reply of a single kite to Broadcast.
+type BroadcastResult struct {
+	// URL and Kite identify the remote kite.
+	URL  string
+	Kite protocol.Kite
+
+	Result *dnode.Partial
+	Err    error
+}
+
+// BroadcastError is returned by Broadcast when not enough kites replied
+// successfully.
+type BroadcastError struct {
+	Method string
+	Failed int // number of kites, which failed
+	Total  int // number of kites called
+}
+
+// Error implements the built-in error interface.
+func (err *BroadcastError) Error() string {
+	return fmt.Sprintf("broadcast of %q: %d of %d kites failed", err.Method, err.Failed, err.Total)
+}
+
+// Broadcast calls the method with args on all of the clients concurrently,
+// gathering their replies until the ctx is done. The results are ordered
+// as the clients.
+//
+// The opts, which may be nil, tell how many successful replies are
+// required, see BroadcastOptions. If not enough kites replied successfully,
+// a *BroadcastError is returned along with the results, which tell what
+// failed for each of the kites:
+//
+//	clients, _ := k.GetKites(&protocol.KontrolQuery{Name: "cache"})
+//	results, err := kite.Broadcast(ctx, clients, &kite.BroadcastOptions{Quorum: 2}, "cache.put", key, value)
+func Broadcast(ctx context.Context, clients []*Client, opts *BroadcastOptions, method string, args ...interface{}) ([]*BroadcastResult, error) {
+	if opts == nil {
+		opts = &BroadcastOptions{}
+	}
+
+	required := len(clients)
+	switch {
+	case opts.Quorum > 0:
+		required = opts.Quorum
+	case opts.Partial:
+		required = 1
+	}
+
+	// The calls still pending are canceled, once the quorum is reached.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		i      int
+		result *dnode.Partial
+		err    error
+	}
+
+	replies := make(chan reply, len(clients))
+	results := make([]*BroadcastResult, len(clients))
+
+	for i, c := range clients {
+		c.m.RLock()
+		results[i] = &BroadcastResult{
+			URL:  c.URL,
+			Kite: c.Kite,
+		}
+		c.m.RUnlock()
+
+		go func(i int, c *Client) {
+			result, err := c.TellWithContext(ctx, method, args...)
+			replies <- reply{i, result, err}
+		}(i, c)
+	}
+
+	succeeded := 0
+	for range clients {
+		r := <-replies
+
+		results[r.i].Result, results[r.i].Err = r.result, r.err
+
+		if r.err == nil {
+			if succeeded++; opts.Quorum > 0 && succeeded == opts.Quorum {
+				cancel()
+			}
+		}
+	}
+
+	if succeeded < required {
+		return results, &BroadcastError{
+			Method: method,
+			Failed: len(clients) - succeeded,
+			Total:  len(clients),
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,88 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestBroadcast(t *testing.T) {
+	var clients []*Client
+
+	for _, delay := range []time.Duration{0, 0, 2 * time.Second} {
+		cfg := config.New()
+		cfg.DisableAuthentication = true
+
+		delay := delay
+		srv := NewWithConfig("broadcast-server", "0.0.1", cfg)
+		srv.HandleFunc("square", func(r *Request) (interface{}, error) {
+			time.Sleep(delay)
+			n := r.Args.One().MustFloat64()
+			return n * n, nil
+		})
+
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		c := New("broadcast-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		defer c.Close()
+
+		clients = append(clients, c)
+	}
+
+	call := func(opts *BroadcastOptions) ([]*BroadcastResult, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		return Broadcast(ctx, clients, opts, "square", 3)
+	}
+
+	results, err := call(nil)
+	if _, ok := err.(*BroadcastError); !ok {
+		t.Fatalf("want *BroadcastError, got %v", err)
+	}
+
+	if results[2].Err == nil {
+		t.Fatal("want the slow kite to time out")
+	}
+
+	results, err = call(&BroadcastOptions{Partial: true})
+	if err != nil {
+		t.Fatalf("Broadcast()=%s", err)
+	}
+
+	for i, res := range results[:2] {
+		if res.Err != nil {
+			t.Fatalf("%d: %s", i, res.Err)
+		}
+
+		if got := res.Result.MustFloat64(); got != 9 {
+			t.Fatalf("%d: got %v, want 9", i, got)
+		}
+	}
+
+	if e, ok := results[2].Err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("want timeout error, got %v", results[2].Err)
+	}
+
+	start := time.Now()
+
+	if _, err = call(&BroadcastOptions{Quorum: 2}); err != nil {
+		t.Fatalf("Broadcast()=%s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("want Broadcast to return once the quorum is reached, took %s", elapsed)
+	}
+
+	if _, err = call(&BroadcastOptions{Quorum: 3}); err == nil {
+		t.Fatal("want error when the quorum is not reached")
+	}
+}
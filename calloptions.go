@@ -0,0 +1,182 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// CallOption configures a single method call. Call options are passed
+// among the arguments of Tell, Go and their variants, which remove them
+// before sending the call:
+//
+//	result, err := c.Tell("square", 4,
+//	    kite.WithHeader("tenant", "acme"),
+//	    kite.WithDeadline(time.Now().Add(time.Second)),
+//	)
+//
+// Calls persisted by an Outbox must not contain call options.
+type CallOption func(*callConfig)
+
+type callConfig struct {
+	headers  map[string]string
+	deadline time.Time
+	lane     Lane
+}
+
+// WithHeader sets a header of the call, which the remote kite reads
+// from Request.Headers, e.g. a tenant or a trace ID.
+func WithHeader(key, value string) CallOption {
+	return func(cfg *callConfig) {
+		if cfg.headers == nil {
+			cfg.headers = make(map[string]string)
+		}
+
+		cfg.headers[key] = value
+	}
+}
+
+// WithDeadline sets the time the caller stops waiting for the response.
+// The deadline is also sent as the expiry of the call, so the remote kite
+// does not run the call arriving too late, see WithExpiry.
+func WithDeadline(t time.Time) CallOption {
+	return func(cfg *callConfig) {
+		cfg.deadline = t
+	}
+}
+
+// WithPriority sends the call on the given lane, instead of the one
+// selected by the method name and the message size, see WithLane.
+func WithPriority(lane Lane) CallOption {
+	return func(cfg *callConfig) {
+		cfg.lane = lane
+	}
+}
+
+type headersKey struct{}
+
+func headersFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
+
+// applyCallOptions removes call options from the args and applies them
+// to the ctx and the timeout of the call.
+//
+// The ctx may be nil.
+func applyCallOptions(ctx context.Context, method string, args []interface{}, timeout time.Duration) (context.Context, []interface{}, time.Duration, error) {
+	var cfg *callConfig
+	var rest []interface{}
+
+	for i, arg := range args {
+		opt, ok := arg.(CallOption)
+		if !ok {
+			if cfg != nil {
+				rest = append(rest, arg)
+			}
+			continue
+		}
+
+		if cfg == nil {
+			cfg = &callConfig{}
+			rest = append(rest, args[:i]...)
+		}
+
+		opt(cfg)
+	}
+
+	if cfg == nil {
+		return ctx, args, timeout, nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if len(cfg.headers) != 0 {
+		headers := make(map[string]string)
+
+		for k, v := range headersFromContext(ctx) {
+			headers[k] = v
+		}
+
+		for k, v := range cfg.headers {
+			headers[k] = v
+		}
+
+		ctx = context.WithValue(ctx, headersKey{}, headers)
+	}
+
+	if cfg.lane != 0 {
+		ctx = WithLane(ctx, cfg.lane)
+	}
+
+	if !cfg.deadline.IsZero() {
+		left := cfg.deadline.Sub(time.Now())
+		if left <= 0 {
+			return nil, nil, 0, &Error{
+				Type:    "timeout",
+				Message: fmt.Sprintf("Deadline for %q method exceeded", method),
+			}
+		}
+
+		if timeout == 0 || left < timeout {
+			timeout = left
+		}
+
+		if expiry := expiryFromContext(ctx); expiry.IsZero() || cfg.deadline.Before(expiry) {
+			ctx = WithExpiry(ctx, cfg.deadline)
+		}
+	}
+
+	return ctx, rest, timeout, nil
+}
+
+// ResponseMetadata describes the response of a method call.
+type ResponseMetadata struct {
+	// ServerVersion is the version of the kite, which handled the call.
+	ServerVersion string `json:"serverVersion,omitempty"`
+
+	// Duration is the time in milliseconds the remote kite took
+	// to handle the call.
+	Duration int64 `json:"duration"`
+
+	// RateLimit and RateLimitRemaining describe the request limit of
+	// the method, if any: the number of requests allowed and the number
+	// of requests left.
+	RateLimit          int64 `json:"rateLimit,omitempty"`
+	RateLimitRemaining int64 `json:"rateLimitRemaining,omitempty"`
+}
+
+// ResponseMetadataOf gives the metadata of the response the result was
+// received with. It returns nil if the result is nil or the remote kite
+// did not send the metadata.
+func ResponseMetadataOf(result *dnode.Partial) *ResponseMetadata {
+	if result == nil {
+		return nil
+	}
+
+	meta, _ := result.Meta.(*ResponseMetadata)
+	return meta
+}
+
+// responseMetadata gives the metadata of the response to the request.
+func (r *Request) responseMetadata(start time.Time) *ResponseMetadata {
+	meta := &ResponseMetadata{
+		ServerVersion: r.LocalKite.Kite().Version,
+		Duration:      milliseconds(time.Since(start)),
+	}
+
+	if r.bucket != nil {
+		meta.RateLimit = r.bucket.Capacity()
+		meta.RateLimitRemaining = r.bucket.Available()
+	}
+
+	return meta
+}
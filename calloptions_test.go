@@ -0,0 +1,66 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestCallOptions(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("calloptions-server", "0.0.2", cfg)
+	srv.HandleFunc("tenant", func(r *Request) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+
+		return r.Headers["tenant"] + ":" + r.Args.One().MustString(), nil
+	}).Throttle(time.Minute, 10)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("calloptions-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("tenant", "hello",
+		WithHeader("tenant", "acme"),
+		WithPriority(LaneBulk),
+		WithDeadline(time.Now().Add(4*time.Second)),
+	)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != "acme:hello" {
+		t.Fatalf("got %q, want %q", got, "acme:hello")
+	}
+
+	meta := ResponseMetadataOf(result)
+	if meta == nil {
+		t.Fatal("expected response metadata")
+	}
+
+	if meta.ServerVersion != "0.0.2" {
+		t.Errorf("got %q, want %q", meta.ServerVersion, "0.0.2")
+	}
+
+	if meta.Duration < 10 {
+		t.Errorf("got %dms, want at least 10ms", meta.Duration)
+	}
+
+	if meta.RateLimit != 10 || meta.RateLimitRemaining != 9 {
+		t.Errorf("got %d/%d, want 9/10", meta.RateLimitRemaining, meta.RateLimit)
+	}
+
+	_, err = c.Tell("tenant", "hello", WithDeadline(time.Now().Add(-time.Second)))
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("got %v, want timeout error", err)
+	}
+}
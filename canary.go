@@ -0,0 +1,147 @@
+package kite
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// PoolMember describes a member of a StickyPool, see SetPoolMembers.
+type PoolMember struct {
+	// Auth is used to connect to the member, may be nil.
+	Auth *Auth
+
+	// Version is the version of the kite, which is used to split
+	// traffic between versions, see SetVersionSplit.
+	Version string
+
+	// Weight scales the fraction of keys routed to the member relative
+	// to other members, e.g. a member with weight 2 gets twice as many
+	// keys as a member with weight 1.
+	//
+	// If zero, the weight of 1 is used.
+	Weight float64
+}
+
+// SetPoolMembers replaces the pool members with the given ones, keyed by
+// URL of an instance. Unlike SetMembers it sets versions and weights
+// of the members.
+func (s *StickyPool) SetPoolMembers(members map[string]*PoolMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setMembers(members)
+}
+
+// SetWeight sets the weight of the pool member with the given URL,
+// see PoolMember.Weight. Keys are moved only to or from the member.
+func (s *StickyPool) SetWeight(url string, weight float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.auths[url]; !ok {
+		return
+	}
+
+	if weight == 0 {
+		weight = 1
+	}
+
+	s.weights[url] = weight
+	s.ring.SetWeights(s.weights)
+}
+
+// SetVersionSplit routes the given fractions of keys to members of the
+// given kite versions, the rest of keys is routed to members of other
+// versions. It is used to canary a new version of a kite with a small
+// fraction of calls before the full rollout:
+//
+//	s.SetVersionSplit(map[string]float64{"1.1.0": 0.05})
+//
+// Each key keeps being routed to the same version, as long as the split
+// does not change. If there are no members of the version a key is split
+// to, it is routed to members of other versions.
+//
+// Versions of members are set with SetPoolMembers or from kontrol on
+// Refresh. A nil split routes keys regardless of versions.
+func (s *StickyPool) SetVersionSplit(split map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.split = make(map[string]float64, len(split))
+	for version, fraction := range split {
+		s.split[version] = fraction
+	}
+}
+
+// splitVersion gives the version the key is split to, or empty string
+// if the key is routed to members of versions not in the split.
+//
+// It must be called with s.mu held.
+func (s *StickyPool) splitVersion(key string) string {
+	if len(s.split) == 0 {
+		return ""
+	}
+
+	versions := make([]string, 0, len(s.split))
+	for version := range s.split {
+		versions = append(versions, version)
+	}
+
+	sort.Strings(versions)
+
+	h := float64(crc32.ChecksumIEEE([]byte("split#"+key))) / (1 << 32)
+
+	var total float64
+	for _, version := range versions {
+		total += s.split[version]
+
+		if h < total {
+			return version
+		}
+	}
+
+	return ""
+}
+
+// inSplit tells whether calls of the key, which is split to the version,
+// may be routed to the member.
+//
+// It must be called with s.mu held.
+func (s *StickyPool) inSplit(url, version string) bool {
+	if len(s.split) == 0 {
+		return true
+	}
+
+	if version != "" {
+		return s.versions[url] == version
+	}
+
+	_, ok := s.split[s.versions[url]]
+	return !ok
+}
+
+// poolMembers gives the members of the kites, weighted with Weigh.
+func (s *StickyPool) poolMembers(clients []*Client, auths map[string]*Auth) map[string]*PoolMember {
+	members := make(map[string]*PoolMember, len(auths))
+
+	for _, c := range clients {
+		auth, ok := auths[c.URL]
+		if !ok {
+			continue
+		}
+
+		m := &PoolMember{
+			Auth:    auth,
+			Version: c.Kite.Version,
+		}
+
+		if s.Weigh != nil {
+			k := c.Kite
+			m.Weight = s.Weigh(&k)
+		}
+
+		members[c.URL] = m
+	}
+
+	return members
+}
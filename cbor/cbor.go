@@ -0,0 +1,562 @@
+// Package cbor implements the deterministic encoding of CBOR (RFC 8949),
+// which gives the same bytes for equal values regardless of their origin.
+// It is used to encode messages, which are signed, see kite.SigningCBOR.
+//
+// Values are encoded with the same rules as the encoding/json package
+// uses: structs are encoded as maps keyed by names of their fields, as
+// given by json tags, and types implementing json.Marshaler are encoded
+// as their JSON encoding would be. Byte slices are encoded as byte
+// strings, which is more compact than base64 used by JSON.
+//
+// The encoding is deterministic: integers and lengths are encoded in
+// the shortest form, map keys are sorted by their encoding and indefinite
+// lengths are not used.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Major types of CBOR data items.
+const (
+	majorUint   byte = 0
+	majorNegInt byte = 1
+	majorBytes  byte = 2
+	majorString byte = 3
+	majorArray  byte = 4
+	majorMap    byte = 5
+	majorTag    byte = 6
+	majorSimple byte = 7
+)
+
+// Simple values and tags.
+const (
+	simpleFalse     byte = 20
+	simpleTrue      byte = 21
+	simpleNull      byte = 22
+	simpleUndefined byte = 23
+	simpleFloat16   byte = 25
+	simpleFloat32   byte = 26
+	simpleFloat64   byte = 27
+
+	tagTime uint64 = 0 // RFC 3339 date/time string
+)
+
+// maxDepth limits nesting of decoded data items.
+const maxDepth = 1000
+
+var (
+	errTruncated  = errors.New("cbor: unexpected end of data")
+	errIndefinite = errors.New("cbor: indefinite length is not supported")
+	errDepth      = errors.New("cbor: exceeded max depth")
+)
+
+// UnsupportedTypeError is returned by Marshal when the value has a type,
+// which cannot be encoded.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "cbor: unsupported type: " + e.Type.String()
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Marshal gives the deterministic CBOR encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) head(major byte, n uint64) {
+	var p [9]byte
+
+	switch {
+	case n < 24:
+		p[0] = major<<5 | byte(n)
+		e.buf.Write(p[:1])
+	case n <= math.MaxUint8:
+		p[0], p[1] = major<<5|24, byte(n)
+		e.buf.Write(p[:2])
+	case n <= math.MaxUint16:
+		p[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(p[1:], uint16(n))
+		e.buf.Write(p[:3])
+	case n <= math.MaxUint32:
+		p[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(p[1:], uint32(n))
+		e.buf.Write(p[:5])
+	default:
+		p[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(p[1:], n)
+		e.buf.Write(p[:9])
+	}
+}
+
+func (e *encoder) int(n int64) {
+	if n < 0 {
+		e.head(majorNegInt, uint64(-1-n))
+	} else {
+		e.head(majorUint, uint64(n))
+	}
+}
+
+func (e *encoder) float(f float64) {
+	var p [9]byte
+
+	p[0] = majorSimple<<5 | simpleFloat64
+	binary.BigEndian.PutUint64(p[1:], math.Float64bits(f))
+	e.buf.Write(p[:])
+}
+
+func (e *encoder) string(s string) {
+	e.head(majorString, uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) encode(rv reflect.Value) error {
+	if !rv.IsValid() {
+		e.head(majorSimple, uint64(simpleNull))
+		return nil
+	}
+
+	switch t := rv.Type(); {
+	case t == timeType:
+		e.head(majorTag, tagTime)
+		e.string(rv.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+		return nil
+	case t == jsonNumberType:
+		return e.number(json.Number(rv.String()))
+	case t.Implements(jsonMarshalerType) && (rv.Kind() != reflect.Ptr || !rv.IsNil()):
+		return e.json(rv.Interface().(json.Marshaler))
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			e.head(majorSimple, uint64(simpleTrue))
+		} else {
+			e.head(majorSimple, uint64(simpleFalse))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(majorUint, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(rv.Float())
+	case reflect.String:
+		e.string(rv.String())
+	case reflect.Slice:
+		if rv.IsNil() {
+			e.head(majorSimple, uint64(simpleNull))
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			p := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(p), rv)
+			e.head(majorBytes, uint64(len(p)))
+			e.buf.Write(p)
+			return nil
+		}
+
+		e.head(majorArray, uint64(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.encode(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			e.head(majorSimple, uint64(simpleNull))
+			return nil
+		}
+
+		if rv.Type().Key().Kind() != reflect.String {
+			return &UnsupportedTypeError{rv.Type()}
+		}
+
+		var fields []field
+		for _, key := range rv.MapKeys() {
+			fields = append(fields, field{name: key.String(), value: rv.MapIndex(key)})
+		}
+
+		return e.fields(fields)
+	case reflect.Struct:
+		return e.fields(structFields(rv))
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			e.head(majorSimple, uint64(simpleNull))
+			return nil
+		}
+
+		return e.encode(rv.Elem())
+	default:
+		return &UnsupportedTypeError{rv.Type()}
+	}
+
+	return nil
+}
+
+// number encodes the JSON number as an integer, if it is one.
+func (e *encoder) number(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		e.int(i)
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("cbor: invalid number %q", n)
+	}
+
+	e.float(f)
+	return nil
+}
+
+// json encodes the value as its JSON encoding would be.
+func (e *encoder) json(m json.Marshaler) error {
+	p, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(p)) == 0 {
+		e.head(majorSimple, uint64(simpleNull))
+		return nil
+	}
+
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	return e.encode(reflect.ValueOf(v))
+}
+
+type field struct {
+	name  string
+	value reflect.Value
+	key   []byte // encoded name
+}
+
+// fields encodes a map with the fields sorted by the encoding of their
+// names.
+func (e *encoder) fields(fields []field) error {
+	for i := range fields {
+		var k encoder
+		k.string(fields[i].name)
+		fields[i].key = k.buf.Bytes()
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return bytes.Compare(fields[i].key, fields[j].key) < 0
+	})
+
+	e.head(majorMap, uint64(len(fields)))
+
+	for _, f := range fields {
+		e.buf.Write(f.key)
+
+		if err := e.encode(f.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structFields gives the exported fields of the struct, named according
+// to their json tags.
+func structFields(rv reflect.Value) []field {
+	var fields []field
+
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		fv := rv.Field(i)
+
+		if sf.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			fields = append(fields, structFields(fv)...)
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		if strings.Contains(opts, "omitempty") && isEmpty(fv) {
+			continue
+		}
+
+		fields = append(fields, field{name: name, value: fv})
+	}
+
+	return fields
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// Decode decodes a single data item. Integers are decoded as int64, or
+// uint64 if they overflow it, floats as float64, byte strings as []byte,
+// arrays as []interface{}, maps as map[string]interface{} and date/time
+// strings as time.Time.
+func Decode(p []byte) (interface{}, error) {
+	d := decoder{p: p}
+
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.off != len(p) {
+		return nil, fmt.Errorf("cbor: %d bytes of trailing data", len(p)-d.off)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the data item into v, as the encoding/json package
+// would decode its JSON encoding.
+func Unmarshal(p []byte, v interface{}) error {
+	item, err := Decode(p)
+	if err != nil {
+		return err
+	}
+
+	js, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(js, v)
+}
+
+type decoder struct {
+	p   []byte
+	off int
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.p)-d.off) {
+		return nil, errTruncated
+	}
+
+	p := d.p[d.off : d.off+int(n)]
+	d.off += int(n)
+
+	return p, nil
+}
+
+func (d *decoder) head() (major, info byte, n uint64, err error) {
+	p, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info = p[0]>>5, p[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		p, err = d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		for _, b := range p {
+			n = n<<8 | uint64(b)
+		}
+
+		return major, info, n, nil
+	case info == 31:
+		return 0, 0, 0, errIndefinite
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: invalid additional info %d", info)
+	}
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errDepth
+	}
+
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case majorBytes:
+		p, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), p...), nil
+	case majorString:
+		p, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(p), nil
+	case majorArray:
+		if n > uint64(len(d.p)-d.off) {
+			return nil, errTruncated
+		}
+
+		a := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case majorMap:
+		if n > uint64(len(d.p)-d.off) {
+			return nil, errTruncated
+		}
+
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("cbor: unsupported map key %v", k)
+			}
+
+			if m[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := v.(string); ok && n == tagTime {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+
+		return v, nil
+	default: // majorSimple
+		switch info {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		case simpleNull, simpleUndefined:
+			return nil, nil
+		case simpleFloat16:
+			return float16(uint16(n)), nil
+		case simpleFloat32:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case simpleFloat64:
+			return math.Float64frombits(n), nil
+		default:
+			return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+		}
+	}
+}
+
+// float16 gives the value of the IEEE 754 half-precision float.
+func float16(h uint16) float64 {
+	sign, exp, frac := h>>15, int(h>>10&0x1f), float64(h&0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+
+	if sign != 0 {
+		return -f
+	}
+
+	return f
+}
@@ -0,0 +1,151 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	// Examples of RFC 8949, Appendix A.
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"a", "6161"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[string]interface{}{"b": []int{2, 3}, "a": 1}, "a26161016162820203"},
+		{json.Number("10"), "0a"},
+		{json.RawMessage(`{"b": 1.5, "a": [true]}`), "a2616181f56162fb3ff8000000000000"},
+		{time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC), "c074323031332d30332d32315432303a30343a30305a"},
+	}
+
+	for _, cas := range cases {
+		p, err := Marshal(cas.v)
+		if err != nil {
+			t.Fatalf("Marshal(%v)=%s", cas.v, err)
+		}
+
+		if got := hex.EncodeToString(p); got != cas.want {
+			t.Errorf("Marshal(%v)=%s, want %s", cas.v, got, cas.want)
+		}
+	}
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	type inner struct {
+		Data []byte `json:"data"`
+	}
+
+	type message struct {
+		Name    string            `json:"name"`
+		Labels  map[string]string `json:"labels"`
+		Skipped string            `json:"-"`
+		Empty   string            `json:"empty,omitempty"`
+		inner
+	}
+
+	v := &message{
+		Name:   "x",
+		Labels: map[string]string{"zone": "a", "env": "prod", "app": "kite"},
+		inner:  inner{Data: []byte("abc")},
+	}
+
+	first, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		p, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		if !bytes.Equal(p, first) {
+			t.Fatalf("got %x, want %x", p, first)
+		}
+	}
+
+	item, err := Decode(first)
+	if err != nil {
+		t.Fatalf("Decode()=%s", err)
+	}
+
+	want := map[string]interface{}{
+		"name":   "x",
+		"labels": map[string]interface{}{"zone": "a", "env": "prod", "app": "kite"},
+		"data":   []byte("abc"),
+	}
+
+	if !reflect.DeepEqual(item, want) {
+		t.Fatalf("got %#v, want %#v", item, want)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type message struct {
+		ID      int64     `json:"id"`
+		Payload []byte    `json:"payload"`
+		Sent    time.Time `json:"sent"`
+		Tags    []string  `json:"tags"`
+	}
+
+	in := &message{
+		ID:      -42,
+		Payload: []byte{0, 1, 2, 255},
+		Sent:    time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Tags:    []string{"a", "b"},
+	}
+
+	p, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	var out message
+	if err := Unmarshal(p, &out); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if !reflect.DeepEqual(&out, in) {
+		t.Fatalf("got %+v, want %+v", &out, in)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",           // empty
+		"1a000f42",   // truncated integer
+		"9f01ff",     // indefinite array
+		"83010203ff", // trailing data
+		"a1010203",   // integer map key
+		"5bffffffffffffffff",
+	} {
+		p, _ := hex.DecodeString(s)
+
+		if _, err := Decode(p); err == nil {
+			t.Errorf("Decode(%s): want error", s)
+		}
+	}
+
+	p, _ := hex.DecodeString("f93c00") // half float 1.0
+	if v, err := Decode(p); err != nil || v != 1.0 {
+		t.Fatalf("Decode()=%v, %v, want 1", v, err)
+	}
+}
@@ -1,7 +1,8 @@
 package kite
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/protocol"
 	"github.com/koding/kite/sockjsclient"
+	"github.com/koding/kite/utils"
 
 	"github.com/cenkalti/backoff"
 	"github.com/gorilla/websocket"
@@ -51,6 +53,13 @@ type Client struct {
 	// broke.
 	Reconnect bool
 
+	// Resumable, when true, makes the client resume its session after
+	// reconnects: callbacks exchanged before a reconnect stay valid, if
+	// the remote kite still keeps the session, see Kite.ResumeTTL.
+	// Otherwise they are invalidated and subscriptions are replayed, see
+	// Subscribe and OnInvalidate.
+	Resumable bool
+
 	// URL specifies the SockJS URL of the remote kite.
 	URL string
 
@@ -97,6 +106,26 @@ type Client struct {
 	// that owns this connection, instead.
 	WriteBufferSize int
 
+	// BulkThreshold is the size in bytes, above which outgoing messages
+	// are sent on the bulk lane.
+	//
+	// If zero, DefaultBulkThreshold is used.
+	BulkThreshold int
+
+	// InteractiveWeight is the number of interactive messages sent for
+	// each bulk message, when both lanes have messages waiting.
+	//
+	// If zero, DefaultInteractiveWeight is used.
+	InteractiveWeight int
+
+	// MaxBulkSize is the maximum size in bytes of messages sent on the
+	// bulk and control lanes. Sending larger messages fails, as they
+	// would keep the connection busy for too long, see Lane.
+	//
+	// If zero, DefaultMaxBulkSize is used. If negative, the size is not
+	// limited.
+	MaxBulkSize int
+
 	muProt sync.Mutex // protects protocol.Kite access
 
 	// To signal waiters of Go() on disconnect.
@@ -106,6 +135,43 @@ type Client struct {
 	// authMu protects Auth field.
 	authMu sync.Mutex
 
+	// kiteSession is the session of the remote kite, see Request.Session.
+	kiteSession *Session
+	sessionMu   sync.Mutex // protects kiteSession
+
+	// skew is the last clock skew measured with SyncTime.
+	skew   *ClockSkew
+	skewMu sync.Mutex // protects skew
+
+	// info is the remote kite info cached by Info, infoErr is set
+	// instead if the remote kite does not serve kite.info.
+	info    *Info
+	infoErr error
+	infoMu  sync.Mutex // protects info and infoErr
+
+	resumeID      string          // of the resumable session
+	resumedBy     *Client         // connection, which resumed the session
+	connects      int             // number of connections made
+	subscriptions []*Subscription // made with Subscribe
+	resumeMu      sync.Mutex      // protects the fields above
+
+	idle idleState // traffic of the connection, see Kite.IdleTimeout
+
+	dict dictState // compression of arguments, see UseDictionary
+
+	delayed   *Outbox    // delivers calls made with SendAt
+	delayedMu sync.Mutex // protects delayed
+
+	// Set with client options, see NewClient.
+	timeout      time.Duration    // default call timeout
+	adaptive     *AdaptiveTimeout // derives call timeouts, if non-nil
+	shadow       *shadow          // mirrors calls, see WithShadow
+	shadowCmp    *ShadowComparer  // compares mirrored calls, if non-nil
+	delayedStore OutboxStore      // persists calls made with SendAt, if non-nil
+	interceptors []Interceptor    // wrap outgoing calls, see WithInterceptors
+	enc          Codec
+	log          Logger
+
 	// To signal about the close
 	closeChan chan struct{}
 
@@ -124,7 +190,8 @@ type Client struct {
 	// TODO: replace this with a proper interface to support multiple
 	// transport/protocols
 	session sockjs.Session
-	send    chan *message
+	lanes   map[Lane]chan *message // outgoing messages by lane
+	flow    flowControl
 
 	// muReconnect protects Reconnect
 	muReconnect sync.Mutex
@@ -144,6 +211,19 @@ type Client struct {
 	onDisconnectHandlers  []func()
 	onTokenExpireHandlers []func()
 	onTokenRenewHandlers  []func(string)
+	onInvalidateHandlers  []func()
+
+	// retryAt is the time the remote kite asked to wait until before
+	// calling it again, see RetryAfter.
+	retryAt time.Time
+	retryMu sync.Mutex // protects retryAt
+
+	// labels tag the connection, see SetLabel.
+	labels map[string]string
+
+	// nextURL gives the URL dialed after dialing the given one failed,
+	// when reconnecting.
+	nextURL func(url string) string
 
 	testHookSetSession func(sockjs.Session)
 
@@ -155,8 +235,10 @@ type Client struct {
 
 // message carries an encoded payload sent over connected session.
 type message struct {
-	p    []byte
-	errC chan<- error
+	p      []byte
+	lane   Lane
+	exempt bool // not subject to flow control
+	errC   chan<- error
 }
 
 // callOptions is the type of first argument in the dnode message.
@@ -167,6 +249,37 @@ type callOptions struct {
 	Auth             *Auth          `json:"authentication"`
 	WithArgs         *dnode.Partial `json:"withArgs" dnode:"-"`
 	ResponseCallback dnode.Function `json:"responseCallback"`
+
+	// Timeout is the time in milliseconds the caller is going to wait
+	// for the response. Zero means no timeout.
+	Timeout int64 `json:"timeout,omitempty"`
+
+	// MessageID uniquely identifies the call across retries,
+	// see WithMessageID.
+	MessageID string `json:"messageId,omitempty"`
+
+	// ExpiresAt is the Unix time in milliseconds, after which the call
+	// must not be run, see WithExpiry. Zero means no expiry.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+
+	// Signature of the call, see Kite.SigningKey.
+	Signature *Signature `json:"signature,omitempty"`
+
+	// Encryption describes how the arguments are encrypted, see
+	// PayloadPolicy.
+	Encryption *Encryption `json:"encryption,omitempty"`
+
+	// Dictionary is the ID of the dictionary the arguments are
+	// compressed with, see Client.UseDictionary.
+	Dictionary string `json:"dictionary,omitempty"`
+
+	// RequestID is generated by the caller for each call and sent back
+	// in the Response, so the call can be matched with its response
+	// without tracking callback IDs.
+	RequestID string `json:"requestId,omitempty"`
+
+	// Headers of the call, see WithHeader.
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // callOptionsOut is the same structure with callOptions.
@@ -194,7 +307,28 @@ type response struct {
 // NewClient returns a pointer to a new Client. The returned instance
 // is not connected. You have to call Dial() or DialForever() before calling
 // Tell() and Go() methods.
-func (k *Kite) NewClient(remoteURL string) *Client {
+//
+// The options are applied in order, after the defaults are set.
+func (k *Kite) NewClient(remoteURL string, opts ...ClientOption) *Client {
+	c := k.newClient(remoteURL)
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if d := k.callbackLeakThreshold(); d > 0 {
+		c.scrubber.Track()
+		go c.detectLeaks(d)
+	}
+
+	k.OnRegister(c.updateAuth)
+
+	return c
+}
+
+// newClient gives a client with the defaults set, which is not tracked
+// by the kite.
+func (k *Kite) newClient(remoteURL string) *Client {
 	c := &Client{
 		LocalKite:          k,
 		URL:                remoteURL,
@@ -204,11 +338,18 @@ func (k *Kite) NewClient(remoteURL string) *Client {
 		scrubber:           dnode.NewScrubber(),
 		testHookSetSession: nopSetSession,
 		Concurrent:         true,
-		send:               make(chan *message),
 		interrupt:          make(chan error, 1),
+		lanes: map[Lane]chan *message{
+			LaneControl:     make(chan *message, LaneQueueSize),
+			LaneInteractive: make(chan *message, LaneQueueSize),
+			LaneBulk:        make(chan *message, LaneQueueSize),
+		},
+		flow: flowControl{
+			notify: make(chan struct{}, 1),
+		},
 	}
 
-	k.OnRegister(c.updateAuth)
+	c.scrubber.Skip = k.hasMethodID
 
 	return c
 }
@@ -221,15 +362,15 @@ func (c *Client) SetUsername(username string) {
 
 // Dial connects to the remote Kite. Returns error if it can't.
 func (c *Client) Dial() (err error) {
-	// zero means no timeout
-	return c.DialTimeout(0)
+	// zero means no timeout, unless set with WithTimeout
+	return c.DialTimeout(c.timeout)
 }
 
 // DialTimeout acts like Dial but takes a timeout.
 func (c *Client) DialTimeout(timeout time.Duration) error {
 	err := c.dial(timeout)
 
-	c.LocalKite.Log.Debug("Dialing '%s' kite: %s (error: %v)", c.Kite.Name, c.URL, err)
+	c.logger().Debug("Dialing '%s' kite: %s (error: %v)", c.Kite.Name, c.URL, err)
 
 	if err != nil {
 		return err
@@ -277,21 +418,23 @@ func (c *Client) authCopy() *Auth {
 func (c *Client) dial(timeout time.Duration) (err error) {
 	transport := c.config().Transport
 
-	c.LocalKite.Log.Debug("Client transport is set to '%s'", transport)
+	c.logger().Debug("Client transport is set to '%s'", transport)
 
 	var session sockjs.Session
 
+	cfg := c.dialConfig()
+
 	switch transport {
 	case config.WebSocket:
-		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
+		session, err = sockjsclient.DialWebsocket(c.URL, cfg)
 	case config.XHRPolling:
-		session, err = sockjsclient.DialXHR(c.URL, c.config())
+		session, err = sockjsclient.DialXHR(c.URL, cfg)
 	case config.Auto:
-		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
+		session, err = sockjsclient.DialWebsocket(c.URL, cfg)
 		if err == websocket.ErrBadHandshake {
 			// In cases when kite server is behind a proxy that do
 			// not support websocket connections, fall back to XHR.
-			session, err = sockjsclient.DialXHR(c.URL, c.config())
+			session, err = sockjsclient.DialXHR(c.URL, cfg)
 		}
 	default:
 		return fmt.Errorf("Connection transport is not known '%v'", transport)
@@ -302,15 +445,21 @@ func (c *Client) dial(timeout time.Duration) (err error) {
 	}
 
 	c.setSession(session)
+	c.startFlow()
 	c.wg.Add(1)
 	go c.sendHub()
 
+	if c.reconnect() && c.LocalKite != nil {
+		c.LocalKite.trackDialed(c)
+	}
+
 	// Reset the wait time.
 	c.redialBackOff.Reset()
 
 	// Must be run in a goroutine because a handler may wait a response from
 	// server.
 	go c.callOnConnectHandlers()
+	go c.reconnected()
 
 	return nil
 }
@@ -321,10 +470,14 @@ func (c *Client) dialForever(connectNotifyChan chan bool) {
 			return nil
 		}
 
-		c.LocalKite.Log.Info("Dialing '%s' kite: %s", c.Kite.Name, c.URL)
+		c.logger().Info("Dialing '%s' kite: %s", c.Kite.Name, c.URL)
 
 		if err := c.dial(0); err != nil {
-			c.LocalKite.Log.Warning("Dialing '%s' kite error: %s: %v", c.Kite.Name, c.URL, err)
+			c.logger().Warning("Dialing '%s' kite error: %s: %v", c.Kite.Name, c.URL, err)
+
+			if c.nextURL != nil {
+				c.URL = c.nextURL(c.URL)
+			}
 
 			return err
 		}
@@ -347,24 +500,54 @@ func (c *Client) RemoteAddr() string {
 		return ""
 	}
 
-	websocketsession, ok := session.(*sockjsclient.WebsocketSession)
+	switch s := session.(type) {
+	case *sockjsclient.WebsocketSession:
+		return s.RemoteAddr()
+	case interface {
+		Request() *http.Request
+	}:
+		// Sessions accepted by the kite's server.
+		if req := s.Request(); req != nil {
+			return req.RemoteAddr
+		}
+	}
+
+	return ""
+}
+
+// TLSConnectionState gives the state of the TLS connection of a client
+// accepted by the kite's server, e.g. to inspect certificates presented
+// by the remote kite. It returns nil for connections made without TLS
+// and for clients dialed by the kite.
+func (c *Client) TLSConnectionState() *tls.ConnectionState {
+	s, ok := c.getSession().(interface {
+		Request() *http.Request
+	})
 	if !ok {
-		return ""
+		return nil
 	}
 
-	return websocketsession.RemoteAddr()
+	if req := s.Request(); req != nil {
+		return req.TLS
+	}
+
+	return nil
 }
 
 // run consumes incoming dnode messages. Reconnects if necessary.
 func (c *Client) run() {
 	err := c.readLoop()
 	if err != nil {
-		c.LocalKite.Log.Debug("readloop err: %s", err)
+		c.logger().Debug("readloop err: %s", err)
 	}
 
 	// falls here when connection disconnects
 	c.callOnDisconnectHandlers()
 
+	if !c.resumable() {
+		c.callOnInvalidateHandlers()
+	}
+
 	// let others know that the client has disconnected
 	c.disconnectMu.Lock()
 	if c.disconnect != nil {
@@ -373,6 +556,11 @@ func (c *Client) run() {
 	}
 	c.disconnectMu.Unlock()
 
+	c.dropQueued(errors.New("can't send, remote kite has disconnected"))
+
+	c.resetInfo()
+	c.dict.reset()
+
 	if c.reconnect() {
 		// we override it so it doesn't get selected next time. Because we are
 		// redialing, so after redial if a new method is called, the disconnect
@@ -397,32 +585,77 @@ func (c *Client) readLoop() error {
 	for {
 		p, err := c.receiveData()
 
-		c.LocalKite.Log.Debug("readloop received: %s %v", p, err)
+		c.logger().Debug("readloop received: %s %v", redacted{c.LocalKite, p}, err)
 
 		if err != nil {
 			return err
 		}
 
+		raw := p
+
+		p, err = c.serveFrame(Incoming, p)
+		if err != nil || p == nil {
+			if err != nil {
+				c.logger().Warning("dropping incoming frame: %s", err)
+			}
+
+			// The remote kite spent credit for the dropped frame.
+			if !flowExempt(frameMethod(raw)) {
+				c.consumed(len(raw))
+			}
+
+			continue
+		}
+
+		if c.LocalKite.StrictProtocol {
+			if err := c.checkProtocol(p); err != nil {
+				return err
+			}
+		}
+
 		msg, fn, err := c.processMessage(p)
 		if err != nil {
 			if _, ok := err.(dnode.CallbackNotFoundError); !ok {
-				c.LocalKite.Log.Warning("error processing message err: %s message: %s", err, msg)
+				c.logger().Warning("error processing message err: %s message: %v", err, msg)
 			}
 		}
 
+		if msg != nil {
+			c.idle.message(msg.Method, msg.Callbacks, false)
+		} else {
+			c.idle.message(nil, nil, false)
+		}
+
+		// Grant the credit back to the remote kite once the message is processed.
+		done := func() {}
+		if msg == nil || !flowExempt(msg.Method) {
+			n := len(raw)
+			done = func() { c.consumed(n) }
+		}
+
 		switch v := fn.(type) {
 		case *Method: // invoke method
 			if c.Concurrent {
-				go c.runMethod(v, msg.Arguments)
+				go func() {
+					c.runMethod(v, msg.Arguments)
+					done()
+				}()
 			} else {
 				c.runMethod(v, msg.Arguments)
+				done()
 			}
 		case func(*dnode.Partial): // invoke callback
 			if c.Concurrent && c.ConcurrentCallbacks {
-				go c.runCallback(v, msg.Arguments)
+				go func() {
+					c.runCallback(v, msg.Arguments)
+					done()
+				}()
 			} else {
 				c.runCallback(v, msg.Arguments)
+				done()
 			}
+		default:
+			done()
 		}
 	}
 }
@@ -456,28 +689,16 @@ func (c *Client) receiveData() ([]byte, error) {
 
 // processMessage processes a single message and calls a handler or callback.
 func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}, err error) {
-	// Call error handler.
-	defer func() {
-		if err != nil {
-			onError(err)
-		}
-	}()
-
 	msg = &dnode.Message{}
 
-	if err = json.Unmarshal(data, &msg); err != nil {
+	if err = c.codec().Unmarshal(data, &msg); err != nil {
+		c.decodeError(data, c.recoverArgs(data), err)
 		return nil, nil, err
 	}
 
-	sender := func(id uint64, args []interface{}) error {
-		// do not name the error variable to "err" here, it's a trap for
-		// shadowing variables
-		_, _, e := c.marshalAndSend(id, args)
-		return e
-	}
-
 	// Replace function placeholders with real functions.
-	if err := dnode.ParseCallbacks(msg, sender); err != nil {
+	if err := dnode.ParseCallbacks(msg, c.callRemote); err != nil {
+		c.decodeError(data, c.recoverArgs(data), err)
 		return nil, nil, err
 	}
 
@@ -485,6 +706,11 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 	switch method := msg.Method.(type) {
 	case float64:
 		id := uint64(method)
+
+		if m, ok := c.LocalKite.method(MethodID(id)); ok {
+			return msg, m, nil
+		}
+
 		callback := c.scrubber.GetCallback(id)
 		if callback == nil {
 			err = dnode.CallbackNotFoundError{
@@ -496,21 +722,31 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 
 		return msg, callback, nil
 	case string:
-		m, ok := c.LocalKite.handlers[method]
+		m, ok := c.LocalKite.method(method)
 		if !ok {
 			err = dnode.MethodNotFoundError{
 				Method: method,
 				Args:   msg.Arguments,
 			}
+			c.unknownMethod(data, msg.Arguments, err)
 			return nil, nil, err
 		}
 
 		return msg, m, nil
 	default:
-		return nil, nil, fmt.Errorf("Method is not string or integer: %+v (%T)", msg.Method, msg.Method)
+		err = fmt.Errorf("Method is not string or integer: %+v (%T)", msg.Method, msg.Method)
+		c.decodeError(data, msg.Arguments, err)
+		return nil, nil, err
 	}
 }
 
+// callRemote calls the callback with the given ID, which was received
+// from the remote kite.
+func (c *Client) callRemote(id uint64, args []interface{}) error {
+	_, _, err := c.callbackClient().marshalAndSend(0, id, args)
+	return err
+}
+
 func (c *Client) Close() {
 	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		return // TODO: ErrAlreadyClosed
@@ -524,6 +760,16 @@ func (c *Client) Close() {
 
 	close(c.closeChan)
 
+	if c.LocalKite != nil {
+		c.LocalKite.untrackDialed(c)
+	}
+
+	c.delayedMu.Lock()
+	if c.delayed != nil {
+		c.delayed.Close()
+	}
+	c.delayedMu.Unlock()
+
 	if c.closeRenewer != nil {
 		select {
 		case c.closeRenewer <- struct{}{}:
@@ -543,36 +789,38 @@ func (c *Client) Close() {
 func (c *Client) sendHub() {
 	defer c.wg.Done()
 
+	var sent int // interactive messages sent since the last bulk one
+
 	for {
-		select {
-		case msg := <-c.send:
-			c.LocalKite.Log.Debug("sending: %s", msg)
-			session := c.getSession()
-			if session == nil {
-				c.LocalKite.Log.Error("not connected")
-				continue
-			}
+		msg := c.nextMessage(&sent)
+		if msg == nil {
+			c.logger().Debug("Send hub is closed")
+			return
+		}
 
-			err := session.Send(string(msg.p))
-			if err != nil {
-				if msg.errC != nil {
-					msg.errC <- err
-				}
+		c.logger().Debug("sending on %s lane: %s", msg.lane, redacted{c.LocalKite, msg.p})
+		session := c.getSession()
+		if session == nil {
+			c.logger().Error("not connected")
+			continue
+		}
 
-				if sockjsclient.IsSessionClosed(err) {
-					// The readloop may already be interrupted, thus the non-blocking send.
-					select {
-					case c.interrupt <- err:
-					default:
-					}
+		err := session.Send(string(msg.p))
+		if err != nil {
+			if msg.errC != nil {
+				msg.errC <- err
+			}
 
-					c.LocalKite.Log.Error("error sending to %s: %s", session.ID(), err)
-					return
+			if sockjsclient.IsSessionClosed(err) {
+				// The readloop may already be interrupted, thus the non-blocking send.
+				select {
+				case c.interrupt <- err:
+				default:
 				}
+
+				c.logger().Error("error sending to %s: %s", session.ID(), err)
+				return
 			}
-		case <-c.closeChan:
-			c.LocalKite.Log.Debug("Send hub is closed")
-			return
 		}
 	}
 }
@@ -663,13 +911,24 @@ func (c *Client) callOnTokenRenewHandlers(token string) {
 	}
 }
 
-func (c *Client) wrapMethodArgs(args []interface{}, responseCallback dnode.Function) []interface{} {
+// wrapMethodArgs wraps the arguments in call options. The ctx may be nil.
+func (c *Client) wrapMethodArgs(ctx context.Context, args []interface{}, timeout time.Duration, responseCallback dnode.Function) []interface{} {
+	var expiresAt int64
+	if t := expiryFromContext(ctx); !t.IsZero() {
+		expiresAt = t.UnixNano() / int64(time.Millisecond)
+	}
+
 	options := callOptionsOut{
 		WithArgs: args,
 		callOptions: callOptions{
 			Kite:             *c.LocalKite.Kite(),
 			Auth:             c.authCopy(),
 			ResponseCallback: responseCallback,
+			Timeout:          int64(timeout / time.Millisecond),
+			MessageID:        messageIDFromContext(ctx),
+			ExpiresAt:        expiresAt,
+			RequestID:        utils.RandomString(16),
+			Headers:          headersFromContext(ctx),
 		},
 	}
 	return []interface{}{options}
@@ -704,14 +963,131 @@ func (c *Client) GoWithTimeout(method string, timeout time.Duration, args ...int
 	// It can wait on this channel to get the response.
 	responseChan := make(chan *response, 1)
 
-	c.sendMethod(method, args, timeout, responseChan)
+	c.sendMethod(nil, method, args, timeout, responseChan)
 
 	return responseChan
 }
 
-// sendMethod wraps the arguments, adds a response callback,
+// TellWithContext does the same thing with Tell() method except it takes
+// a context, which bounds the time waiting for the reply from the remote
+// Kite. The remaining time till the ctx deadline is sent to the remote Kite
+// as the call timeout, so nested calls made by its handler can respect it.
+//
+// Within a handler use Request.Ctx() to propagate the deadline and
+// cancellation of the incoming request.
+func (c *Client) TellWithContext(ctx context.Context, method string, args ...interface{}) (result *dnode.Partial, err error) {
+	response := <-c.GoWithContext(ctx, method, args...)
+	return response.Result, response.Err
+}
+
+// GoWithContext does the same thing with Go() method except it takes
+// a context. See TellWithContext for details.
+func (c *Client) GoWithContext(ctx context.Context, method string, args ...interface{}) chan *response {
+	responseChan := make(chan *response, 1)
+
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline.Sub(time.Now())
+	}
+
+	if err := ctx.Err(); err != nil || timeout < 0 {
+		responseChan <- &response{
+			Result: nil,
+			Err:    contextError(ctx, method),
+		}
+		return responseChan
+	}
+
+	c.sendMethod(ctx, method, args, timeout, responseChan)
+
+	return responseChan
+}
+
+// contextError gives a kite error for a context that is done.
+func contextError(ctx context.Context, method string) *Error {
+	if ctx.Err() == context.Canceled {
+		return &Error{
+			Type:    "canceled",
+			Message: fmt.Sprintf("Call to %q method was canceled", method),
+		}
+	}
+
+	return &Error{
+		Type:    "timeout",
+		Message: fmt.Sprintf("Deadline for %q method exceeded", method),
+	}
+}
+
+// sendMethod makes the call through the interceptors of the client,
+// if any, see WithInterceptors.
+//
+// The ctx may be nil.
+func (c *Client) sendMethod(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+	ctx, args, timeout, err := applyCallOptions(ctx, method, args, timeout)
+	if err != nil {
+		responseChan <- &response{Result: nil, Err: err}
+		return
+	}
+
+	if len(c.interceptors) == 0 {
+		c.send(ctx, method, args, timeout, responseChan)
+		return
+	}
+
+	go func() {
+		result, err := c.intercept(ctx, method, args, timeout)
+		responseChan <- &response{Result: result, Err: err}
+	}()
+}
+
+// send wraps the arguments, adds a response callback,
 // marshals the message and send it over the wire.
-func (c *Client) sendMethod(method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+//
+// The ctx may be nil.
+func (c *Client) send(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+	if timeout == 0 && c.adaptive != nil {
+		timeout = c.adaptive.Timeout(method)
+	}
+
+	if timeout == 0 {
+		timeout = c.timeout
+	}
+
+	if err := c.checkSendPolicy(method); err != nil {
+		responseChan <- &response{
+			Result: nil,
+			Err: &Error{
+				Type:    "policyError",
+				Message: err.Error(),
+			},
+		}
+		return
+	}
+
+	if primary := c.mirror(method, args, timeout); primary != nil {
+		// Passes the response to the comparer as well.
+		out := responseChan
+		responseChan = make(chan *response, 1)
+
+		go func() {
+			resp := <-responseChan
+			primary <- resp
+			out <- resp
+		}()
+	}
+
+	args, err := c.LocalKite.transformArgsOut(method, args)
+	if err != nil {
+		responseChan <- &response{
+			Result: nil,
+			Err: &Error{
+				Type:    "sendError",
+				Message: fmt.Sprintf("unable to transform arguments of %q call: %s", method, err),
+			},
+		}
+		return
+	}
+
 	// To clean the sent callback after response is received.
 	// Send/Receive in a channel to prevent race condition because
 	// the callback is run in a separate goroutine.
@@ -721,9 +1097,36 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 	doneChan := make(chan *response, 1)
 
 	cb := c.makeResponseCallback(doneChan, removeCallback, method, args)
-	args = c.wrapMethodArgs(args, cb)
+	args = c.wrapMethodArgs(ctx, args, timeout, cb)
 
-	callbacks, errC, err := c.marshalAndSend(method, args)
+	err = c.sign(method, args)
+	if err != nil {
+		responseChan <- &response{
+			Result: nil,
+			Err: &Error{
+				Type:    "sendError",
+				Message: fmt.Sprintf("unable to sign %q call: %s", method, err),
+			},
+		}
+		return
+	}
+
+	c.compressArgs(args)
+
+	if c.LocalKite.MethodPolicy(method)&PolicyEncrypted != 0 {
+		if err := c.encryptArgs(method, args); err != nil {
+			responseChan <- &response{
+				Result: nil,
+				Err: &Error{
+					Type:    "sendError",
+					Message: fmt.Sprintf("unable to encrypt %q call: %s", method, err),
+				},
+			}
+			return
+		}
+	}
+
+	callbacks, errC, err := c.marshalAndSend(laneFromContext(ctx), method, args)
 	if err != nil {
 		responseChan <- &response{
 			Result: nil,
@@ -735,6 +1138,8 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 		return
 	}
 
+	sentCallbacks(ctx, callbacks)
+
 	// nil value of afterTimeout means no timeout, it will not selected in
 	// select statement
 	var afterTimeout <-chan time.Time
@@ -742,21 +1147,38 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 		afterTimeout = time.After(timeout)
 	}
 
+	// nil value of done means the call is not bound to a context
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	sent := time.Now()
+
+	// The lock is not held while waiting, as it would keep the client
+	// from signaling the disconnect to the other waiters.
+	c.disconnectMu.Lock()
+	disconnect := c.disconnect
+	c.disconnectMu.Unlock()
+
 	// Waits until the response has came or the connection has disconnected.
 	go func() {
-		c.disconnectMu.Lock()
-		defer c.disconnectMu.Unlock()
-
 		select {
 		case resp := <-doneChan:
+			if c.adaptive != nil {
+				c.adaptive.Observe(method, time.Since(sent))
+			}
+
 			if e, ok := resp.Err.(*Error); ok {
+				c.throttle(e)
+
 				if e.Type == "authenticationError" && strings.Contains(e.Message, "token is expired") {
 					c.callOnTokenExpireHandlers()
 				}
 			}
 
 			responseChan <- resp
-		case <-c.disconnect:
+		case <-disconnect:
 			responseChan <- &response{
 				nil,
 				&Error{
@@ -775,6 +1197,10 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 				}
 			}
 		case <-afterTimeout:
+			if c.adaptive != nil {
+				c.adaptive.Observe(method, timeout)
+			}
+
 			responseChan <- &response{
 				nil,
 				&Error{
@@ -785,6 +1211,15 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 
 			// Remove the callback function from the map so we do not
 			// consume memory for unused callbacks.
+			if id, ok := <-removeCallback; ok {
+				c.scrubber.RemoveCallback(id)
+			}
+		case <-done:
+			responseChan <- &response{
+				nil,
+				contextError(ctx, method),
+			}
+
 			if id, ok := <-removeCallback; ok {
 				c.scrubber.RemoveCallback(id)
 			}
@@ -796,7 +1231,9 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 
 // marshalAndSend takes a method and arguments, scrubs the arguments to create
 // a dnode message, marshals the message to JSON and sends it over the wire.
-func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (callbacks map[string]dnode.Path, errC <-chan error, err error) {
+//
+// If lane is zero, it is selected by the method and the message size.
+func (c *Client) marshalAndSend(lane Lane, method interface{}, arguments []interface{}) (callbacks map[string]dnode.Path, errC <-chan error, err error) {
 	// scrub trough the arguments and save any callbacks.
 	callbacks = c.scrubber.Scrub(arguments)
 
@@ -811,22 +1248,38 @@ func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (ca
 		arguments = make([]interface{}, 0)
 	}
 
-	rawArgs, err := json.Marshal(arguments)
+	rawArgs, err := c.codec().Marshal(arguments)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Methods registered with HandleID are called by their numeric IDs.
+	if name, ok := method.(string); ok {
+		if id, ok := methodID(name); ok {
+			method = id
+		}
+	}
+
 	msg := dnode.Message{
 		Method:    method,
 		Arguments: &dnode.Partial{Raw: rawArgs},
 		Callbacks: callbacks,
 	}
 
-	p, err := json.Marshal(msg)
+	p, err := c.codec().Marshal(msg)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	p, err = c.serveFrame(Outgoing, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p == nil {
+		return nil, nil, errors.New("frame was dropped")
+	}
+
 	select {
 	case <-c.closeChan:
 		return nil, nil, errors.New("can't send, client is closed")
@@ -837,11 +1290,29 @@ func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (ca
 
 		errC := make(chan error, 1)
 
-		c.send <- &message{
-			p:    p,
-			errC: errC,
+		if _, ok := c.lanes[lane]; !ok {
+			lane = c.lane(method, len(p))
+		}
+
+		if max := c.maxMessageSize(lane); max > 0 && len(p) > max {
+			return nil, nil, fmt.Errorf("can't send, message of %d bytes exceeds the %d bytes limit of the %s lane", len(p), max, lane)
 		}
 
+		// Never block, as the remote kite may not grant the credit
+		// for queued messages in time, or at all.
+		select {
+		case c.lanes[lane] <- &message{
+			p:      p,
+			lane:   lane,
+			exempt: flowExempt(method),
+			errC:   errC,
+		}:
+		default:
+			return nil, nil, fmt.Errorf("can't send, %s lane queue is full", lane)
+		}
+
+		c.idle.message(method, callbacks, true)
+
 		return callbacks, errC, nil
 	}
 }
@@ -879,6 +1350,24 @@ func (c *Client) config() *config.Config {
 	return c.LocalKite.Config
 }
 
+// dialConfig gives the configuration the client dials with, the one of
+// the local kite has the runtime configuration applied, see dialConfig.
+func (c *Client) dialConfig() *config.Config {
+	if c.Config != nil {
+		return c.Config
+	}
+	return c.LocalKite.dialConfig()
+}
+
+// callTimeout gives the timeout of the configuration of the client, see
+// CallTimeout.
+func (c *Client) callTimeout() time.Duration {
+	if c.Config != nil {
+		return c.Config.Timeout
+	}
+	return c.LocalKite.CallTimeout()
+}
+
 // sendCallbackID send the callback number to be deleted after response is received.
 func sendCallbackID(callbacks map[string]dnode.Path, ch chan<- uint64) {
 	// TODO fix finding of responseCallback in dnode message when removing callback
@@ -911,16 +1400,20 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 	return dnode.Callback(func(arguments *dnode.Partial) {
 		// Single argument of response callback.
 		var resp struct {
-			Result *dnode.Partial `json:"result"`
-			Err    *Error         `json:"error"`
+			Result   *dnode.Partial    `json:"result"`
+			Err      *Error            `json:"error"`
+			Metadata *ResponseMetadata `json:"metadata"`
 		}
 
 		// Notify that the callback is finished.
 		defer func() {
 			if resp.Err != nil {
-				c.LocalKite.Log.Debug("Error received from kite: %q method: %q args: %#v err: %s", c.Kite.Name, method, args, resp.Err.Error())
+				c.logger().Debug("Error received from kite: %q method: %q args: %s err: %s", c.Kite.Name, method, redactedArgs{c.LocalKite, args}, resp.Err.Error())
 				doneChan <- &response{resp.Result, resp.Err}
 			} else {
+				if resp.Result != nil && resp.Metadata != nil {
+					resp.Result.Meta = resp.Metadata
+				}
 				doneChan <- &response{resp.Result, nil}
 			}
 		}()
@@ -960,38 +1453,6 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 	})
 }
 
-// onError is called when an error happened in a method handler.
-func onError(err error) {
-	// TODO do not marshal options again here
-	switch e := err.(type) {
-	case dnode.MethodNotFoundError: // Tell the requester "method is not found".
-		args, err2 := e.Args.Slice()
-		if err2 != nil {
-			return
-		}
-
-		if len(args) < 1 {
-			return
-		}
-
-		var options callOptions
-		if err := args[0].Unmarshal(&options); err != nil {
-			return
-		}
-
-		if options.ResponseCallback.Caller != nil {
-			response := Response{
-				Result: nil,
-				Error: &Error{
-					Type:    "methodNotFound",
-					Message: err.Error(),
-				},
-			}
-			options.ResponseCallback.Call(response)
-		}
-	}
-}
-
 type lockedBackoff struct {
 	mu sync.Mutex
 	b  backoff.BackOff
@@ -9,6 +9,7 @@ import (
 	"net/http/cookiejar"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/koding/kite/kitekey"
@@ -65,6 +66,31 @@ type Config struct {
 	// environment and name of the client.
 	VerifyAudienceFunc func(client *protocol.Kite, aud string) error
 
+	// VerifyRevokedFunc is used to check whether token or kite key
+	// with the given claims was revoked. If the function returns
+	// non-nil error, the request is rejected.
+	//
+	// If nil, the claims are checked against the kite's revocation
+	// list, which is kept in sync with Kontrol.
+	VerifyRevokedFunc func(claims *kitekey.KiteClaims) error
+
+	// ReceiveWindow is the number of messages the kite is willing to
+	// receive from a single connection before they are processed. It is
+	// advertised to the remote kite, which stops sending once the window
+	// is exhausted, until the kite processes the messages and grants it
+	// more credit. Heartbeats, pings and cancellations are not subject
+	// to flow control.
+	//
+	// If zero, flow control is not used.
+	ReceiveWindow int
+
+	// ReceiveWindowBytes additionally limits the receive window by
+	// the total size of the messages. It is used only when
+	// ReceiveWindow is set.
+	//
+	// If zero, the window is not limited by size.
+	ReceiveWindowBytes int
+
 	// SockJS server / client connection configuration details.
 
 	// XHR is a HTTP client used for polling on responses for a XHR transport.
@@ -110,6 +136,12 @@ type Config struct {
 	KontrolURL  string
 	KontrolKey  string
 	KontrolUser string
+
+	// KontrolMembers are URLs of other Kontrol instances of the cluster
+	// KontrolURL belongs to. When Kontrol is unreachable, the kite fails
+	// over to them. The list is extended with the members Kontrol reports
+	// once the kite connects to it.
+	KontrolMembers []string
 }
 
 // DefaultConfig contains the default settings.
@@ -212,6 +244,10 @@ func (c *Config) ReadEnvironmentVariables() error {
 		c.KontrolURL = kontrolURL
 	}
 
+	if members := os.Getenv("KITE_KONTROL_MEMBERS"); members != "" {
+		c.KontrolMembers = strings.Split(members, ",")
+	}
+
 	if transportName := os.Getenv("KITE_TRANSPORT"); transportName != "" {
 		transport, ok := Transports[transportName]
 		if !ok {
@@ -284,5 +320,9 @@ func (c *Config) Copy() *Config {
 		copy.Websocket = &ws
 	}
 
+	if c.KontrolMembers != nil {
+		copy.KontrolMembers = append([]string(nil), c.KontrolMembers...)
+	}
+
 	return &copy
 }
@@ -1,9 +1,13 @@
 package config_test
 
 import (
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/koding/kite/config"
 
@@ -30,3 +34,60 @@ func TestConfigCopy(t *testing.T) {
 		}
 	}
 }
+
+func TestReadRuntimeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		content string
+		want    *config.Runtime
+	}{
+		"full": {
+			`{"logLevel":"debug","timeout":"30s","handshakeTimeout":"5s","maxConcurrentRequests":10}`,
+			&config.Runtime{
+				LogLevel:              "debug",
+				Timeout:               config.Duration(30 * time.Second),
+				HandshakeTimeout:      config.Duration(5 * time.Second),
+				MaxConcurrentRequests: 10,
+			},
+		},
+		"bad level": {
+			`{"logLevel":"verbose"}`,
+			nil,
+		},
+		"bad timeout": {
+			`{"timeout":"-1s"}`,
+			nil,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, "runtime.json")
+
+			if err := ioutil.WriteFile(file, []byte(cas.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err := config.ReadRuntimeFile(file)
+			if cas.want == nil {
+				if err == nil {
+					t.Fatalf("want error, got %+v", rc)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ReadRuntimeFile()=%s", err)
+			}
+
+			if !reflect.DeepEqual(rc, cas.want) {
+				t.Fatalf("got %+v, want %+v", rc, cas.want)
+			}
+		})
+	}
+}
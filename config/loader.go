@@ -0,0 +1,620 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Loader loads settings into structs, like Settings, from layered sources.
+// Sources are applied in the following order, each one overriding values
+// set by the previous ones:
+//
+//  1. defaults: the values the struct holds before loading, for zero
+//     fields the values of their `default` tags
+//  2. configuration files, in the order given by Files and -config flags
+//  3. environment variables, if EnvPrefix is set
+//  4. command line flags, if Args is set
+//
+// Fields are named by their `config` tags or by their Go names. In files
+// names are matched ignoring case, dashes and underscores, so "kontrolURL",
+// "kontrol_url" and "kontrol-url" all name the KontrolURL field; nested
+// structs are tables of files. Unknown keys in files are reported as errors.
+//
+// Environment variables are named by the prefix followed by the upper-cased
+// snake case names, e.g. KITE_KONTROL_URL, and flags by the dashed lower-cased
+// names, e.g. -kontrol-url. Nested structs are joined with underscores and
+// dashes respectively, e.g. KONTROL_POSTGRES_HOST or -postgres-host. Lists
+// are given as comma-separated values.
+//
+// Durations are given as strings understood by time.ParseDuration,
+// like "15s".
+type Loader struct {
+	// Files are configuration files loaded in order. The format is given
+	// by the extension: ".yaml" or ".yml" for YAML, ".toml" for TOML
+	// and ".json" for JSON.
+	Files []string
+
+	// EnvPrefix is the prefix of environment variables, e.g. "KITE_".
+	//
+	// If empty, environment variables are not read.
+	EnvPrefix string
+
+	// Args are command line arguments parsed as flags, usually
+	// os.Args[1:]. Besides flags of the fields, repeatable -config
+	// flags name additional configuration files.
+	//
+	// If nil, flags are not parsed.
+	Args []string
+
+	// FlagSet is used to parse Args.
+	//
+	// If nil, a new flag set, which returns parsing errors, is used.
+	FlagSet *flag.FlagSet
+}
+
+var (
+	durationType       = reflect.TypeOf(time.Duration(0))
+	configDurationType = reflect.TypeOf(Duration(0))
+)
+
+// field is a leaf field of a loaded struct.
+type field struct {
+	path  []string // names of the field and the structs it is nested in
+	def   string   // value of the default tag
+	value reflect.Value
+}
+
+// Load loads settings into v, which must be a pointer to a struct.
+func (l *Loader) Load(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("config: loaded value must be a pointer to a struct")
+	}
+
+	rv = rv.Elem()
+
+	fields := leafFields(nil, rv)
+
+	for _, f := range fields {
+		if err := setDefault(f); err != nil {
+			return err
+		}
+	}
+
+	flags, files, err := l.parseFlags(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range append(l.Files, files...) {
+		if err := loadFile(file, rv); err != nil {
+			return err
+		}
+	}
+
+	if l.EnvPrefix != "" {
+		for _, f := range fields {
+			name := l.EnvPrefix + envName(f.path)
+
+			if s, ok := os.LookupEnv(name); ok {
+				if err := setString(f.value, s); err != nil {
+					return fmt.Errorf("config: %s: %s", name, err)
+				}
+			}
+		}
+	}
+
+	for _, f := range flags {
+		// Values were validated while parsing.
+		setString(f.value, f.arg)
+	}
+
+	return nil
+}
+
+// setFlag is a flag given in the command line.
+type setFlag struct {
+	field
+	arg string
+}
+
+// parseFlags parses Args. It gives the flags, which were set, and files
+// given with -config flags.
+func (l *Loader) parseFlags(fields []field) ([]setFlag, []string, error) {
+	if l.Args == nil {
+		return nil, nil, nil
+	}
+
+	fs := l.FlagSet
+	if fs == nil {
+		fs = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	}
+
+	values := make(map[string]*flagValue, len(fields))
+
+	for _, f := range fields {
+		name := flagName(f.path)
+		values[name] = &flagValue{field: f}
+
+		fs.Var(values[name], name, fmt.Sprintf("sets %s", strings.Join(f.path, ".")))
+	}
+
+	var files fileList
+	if fs.Lookup("config") == nil {
+		fs.Var(&files, "config", "loads the configuration `file`; may be repeated")
+	}
+
+	if err := fs.Parse(l.Args); err != nil {
+		return nil, nil, err
+	}
+
+	var flags []setFlag
+
+	fs.Visit(func(fl *flag.Flag) {
+		if v, ok := values[fl.Name]; ok {
+			flags = append(flags, setFlag{v.field, v.arg})
+		}
+	})
+
+	return flags, files, nil
+}
+
+// flagValue implements flag.Value for a field.
+type flagValue struct {
+	field
+	arg string
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.value.IsValid() {
+		return ""
+	}
+
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f *flagValue) Set(s string) error {
+	// Validate the value, it is set after files and environment
+	// variables are loaded.
+	if err := setString(reflect.New(f.value.Type()).Elem(), s); err != nil {
+		return err
+	}
+
+	f.arg = s
+
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f != nil && f.value.IsValid() && f.value.Kind() == reflect.Bool
+}
+
+// fileList implements flag.Value for repeated -config flags.
+type fileList []string
+
+func (f *fileList) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// loadFile loads the configuration file into the struct.
+func loadFile(file string, rv reflect.Value) error {
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+
+	var m map[string]interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err = yaml.Unmarshal(p, &v); err == nil {
+			m, err = yamlMap(v)
+		}
+	case ".toml":
+		m, err = parseTOML(p)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(p))
+		dec.UseNumber()
+		err = dec.Decode(&m)
+	default:
+		err = fmt.Errorf("unknown format %q", ext)
+	}
+
+	if err != nil {
+		return fmt.Errorf("config: %s: %s", file, err)
+	}
+
+	if err := assign(rv, m, ""); err != nil {
+		return fmt.Errorf("config: %s: %s", file, err)
+	}
+
+	return nil
+}
+
+// yamlMap converts maps decoded by the yaml package, which have keys of
+// any type, to maps with string keys.
+func yamlMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	m, ok := yamlValue(v).(map[string]interface{})
+	if !ok {
+		return nil, errors.New("document is not a mapping")
+	}
+
+	return m, nil
+}
+
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = yamlValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// assign sets the value decoded from a file to v.
+func assign(v reflect.Value, raw interface{}, key string) error {
+	if raw == nil {
+		return nil
+	}
+
+	if isNested(v) {
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want a table, got %s", keyName(key), describe(raw))
+		}
+
+		// Sort the keys, so errors are reported deterministically.
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			f, ok := fieldByName(v, k)
+			if !ok {
+				return fmt.Errorf("unknown key %q", joinKey(key, k))
+			}
+
+			if err := assign(f, m[k], joinKey(key, k)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	switch raw := raw.(type) {
+	case string:
+		if err := setString(v, raw); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		return nil
+	case bool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(raw)
+			return nil
+		}
+	case []interface{}:
+		if v.Kind() == reflect.Slice {
+			s := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+			for i, e := range raw {
+				if err := assign(s.Index(i), e, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	case map[string]interface{}:
+		if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMap(v.Type())
+			for k, e := range raw {
+				ev := reflect.New(v.Type().Elem()).Elem()
+				if err := assign(ev, e, joinKey(key, k)); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), ev)
+			}
+			v.Set(m)
+			return nil
+		}
+	default:
+		if n, ok := number(raw); ok {
+			if err := setNumber(v, n); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: cannot use %s as %s", key, describe(raw), v.Type())
+}
+
+// number gives the decimal representation of numbers decoded from files.
+func number(raw interface{}) (string, bool) {
+	switch n := raw.(type) {
+	case json.Number:
+		return n.String(), true
+	case int, int64, uint64:
+		return fmt.Sprint(n), true
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+func setNumber(v reflect.Value, n string) error {
+	if isDuration(v.Type()) {
+		return errors.New("durations must be strings, like \"15s\"")
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return setString(v, n)
+	default:
+		return fmt.Errorf("cannot use number as %s", v.Type())
+	}
+}
+
+// setString parses the string as the value of v.
+func setString(v reflect.Value, s string) error {
+	if isDuration(v.Type()) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var elems []string
+		if s = strings.TrimSpace(s); s != "" {
+			elems = strings.Split(s, ",")
+		}
+
+		sl := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, e := range elems {
+			if err := setString(sl.Index(i), strings.TrimSpace(e)); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// setDefault sets the field to the value of its default tag,
+// if it is zero.
+func setDefault(f field) error {
+	if f.def == "" || !reflect.DeepEqual(f.value.Interface(), reflect.Zero(f.value.Type()).Interface()) {
+		return nil
+	}
+
+	if err := setString(f.value, f.def); err != nil {
+		return fmt.Errorf("config: default of %s: %s", strings.Join(f.path, "."), err)
+	}
+
+	return nil
+}
+
+func isDuration(t reflect.Type) bool {
+	return t == durationType || t == configDurationType
+}
+
+// isNested tells whether the fields of v are loaded as a table.
+func isNested(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct
+}
+
+// leafFields gives the loaded fields of the struct and of the structs
+// nested in it.
+func leafFields(path []string, v reflect.Value) []field {
+	var fields []field
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name := sf.Tag.Get("config")
+		if sf.PkgPath != "" || name == "-" {
+			continue // unexported or ignored
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fpath := append(path[:len(path):len(path)], name)
+
+		if isNested(v.Field(i)) {
+			fields = append(fields, leafFields(fpath, v.Field(i))...)
+			continue
+		}
+
+		fields = append(fields, field{
+			path:  fpath,
+			def:   sf.Tag.Get("default"),
+			value: v.Field(i),
+		})
+	}
+
+	return fields
+}
+
+// fieldByName gives the field of the struct with the given name,
+// matched ignoring case, dashes and underscores.
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	name = normalizeKey(name)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		fname := sf.Tag.Get("config")
+		if sf.PkgPath != "" || fname == "-" {
+			continue
+		}
+
+		if fname == "" {
+			fname = sf.Name
+		}
+
+		if normalizeKey(fname) == name {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+func normalizeKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// snakeCase converts the Go name to lower-cased snake case, keeping
+// acronyms together, e.g. "KontrolURL" to "kontrol_url".
+func snakeCase(s string) string {
+	var buf bytes.Buffer
+
+	r := []rune(s)
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 && r[i-1] != '_' &&
+			(!unicode.IsUpper(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			buf.WriteByte('_')
+		}
+
+		buf.WriteRune(unicode.ToLower(c))
+	}
+
+	return buf.String()
+}
+
+func envName(path []string) string {
+	names := make([]string, len(path))
+	for i, p := range path {
+		names[i] = strings.ToUpper(snakeCase(p))
+	}
+
+	return strings.Join(names, "_")
+}
+
+func flagName(path []string) string {
+	names := make([]string, len(path))
+	for i, p := range path {
+		names[i] = strings.Replace(snakeCase(p), "_", "-", -1)
+	}
+
+	return strings.Join(names, "-")
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+
+	return key + "." + name
+}
+
+func keyName(key string) string {
+	if key == "" {
+		return "document"
+	}
+
+	return key
+}
+
+func describe(raw interface{}) string {
+	switch raw.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "table"
+	default:
+		if _, ok := number(raw); ok {
+			return "number"
+		}
+		return fmt.Sprintf("%T", raw)
+	}
+}
@@ -0,0 +1,243 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "kite-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestConfigLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"kite.yaml": `
+username: alice
+environment: staging
+port: 6000
+timeout: 30s
+kontrol_members:
+  - https://kontrol-1/kite
+  - https://kontrol-2/kite
+`,
+		"kite.toml": `
+# overrides kite.yaml
+environment = "production"
+region = 'eu'
+handshakeTimeout = "5s"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	os.Setenv("KITE_REGION", "us")
+	os.Setenv("KITE_KONTROL_URL", "https://kontrol/kite")
+	defer os.Unsetenv("KITE_REGION")
+	defer os.Unsetenv("KITE_KONTROL_URL")
+
+	c := config.New()
+
+	l := &config.Loader{
+		Files:     []string{filepath.Join(dir, "kite.yaml")},
+		EnvPrefix: "KITE_",
+		Args: []string{
+			"-config", filepath.Join(dir, "kite.toml"),
+			"-region", "ap",
+			"-disable-authentication",
+		},
+	}
+
+	if err := c.Load(l); err != nil {
+		t.Fatalf("Load()=%s", err)
+	}
+
+	got := map[string]interface{}{
+		"username":         c.Username,
+		"environment":      c.Environment,
+		"region":           c.Region,
+		"port":             c.Port,
+		"timeout":          c.Timeout,
+		"clientTimeout":    c.Client.Timeout,
+		"handshakeTimeout": c.Websocket.HandshakeTimeout,
+		"kontrolURL":       c.KontrolURL,
+		"kontrolMembers":   c.KontrolMembers,
+		"disableAuth":      c.DisableAuthentication,
+		"ip":               c.IP,
+	}
+
+	want := map[string]interface{}{
+		"username":         "alice",
+		"environment":      "production",
+		"region":           "ap",
+		"port":             6000,
+		"timeout":          30 * time.Second,
+		"clientTimeout":    30 * time.Second,
+		"handshakeTimeout": 5 * time.Second,
+		"kontrolURL":       "https://kontrol/kite",
+		"kontrolMembers":   []string{"https://kontrol-1/kite", "https://kontrol-2/kite"},
+		"disableAuth":      true,
+		"ip":               config.DefaultConfig.IP,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if config.DefaultConfig.Client.Timeout != 15*time.Second {
+		t.Fatalf("want default config to be left unchanged")
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"unknown.yaml":  "username: alice\nusrname: bob\n",
+		"nested.toml":   "[postgres]\nhost = \"db\"\nhostname = \"db\"\n",
+		"duration.json": `{"timeout": 30}`,
+		"type.toml":     `port = "high"`,
+		"format.ini":    "port=1",
+	})
+	defer os.RemoveAll(dir)
+
+	var s struct {
+		Username string
+		Port     int
+		Timeout  time.Duration
+		Postgres struct {
+			Host string
+		}
+	}
+
+	cases := map[string]string{
+		"unknown.yaml":  `unknown key "usrname"`,
+		"nested.toml":   `unknown key "postgres.hostname"`,
+		"duration.json": "durations must be strings",
+		"type.toml":     "port: strconv.ParseInt",
+		"format.ini":    `unknown format ".ini"`,
+	}
+
+	for file, want := range cases {
+		l := &config.Loader{Files: []string{filepath.Join(dir, file)}}
+
+		if err := l.Load(&s); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want error containing %q", file, err, want)
+		}
+	}
+
+	l := &config.Loader{Args: []string{"-port", "high"}}
+
+	if err := l.Load(&s); err == nil {
+		t.Error("expected invalid flag to be rejected")
+	}
+}
+
+func TestLoaderDefaults(t *testing.T) {
+	type Kontrol struct {
+		Port     int `default:"4000"`
+		Postgres struct {
+			Host string `default:"localhost"`
+			Port int    `default:"5432"`
+		}
+		Machines []string `default:"http://etcd-1,http://etcd-2"`
+		Secret   string   `config:"-"`
+	}
+
+	os.Setenv("KONTROL_POSTGRES_HOST", "db")
+	defer os.Unsetenv("KONTROL_POSTGRES_HOST")
+
+	var k Kontrol
+	k.Port = 8000
+
+	l := &config.Loader{
+		EnvPrefix: "KONTROL_",
+		Args:      []string{"-postgres-port", "6432"},
+	}
+
+	if err := l.Load(&k); err != nil {
+		t.Fatalf("Load()=%s", err)
+	}
+
+	var want Kontrol
+	want.Port = 8000
+	want.Postgres.Host = "db"
+	want.Postgres.Port = 6432
+	want.Machines = []string{"http://etcd-1", "http://etcd-2"}
+
+	if !reflect.DeepEqual(k, want) {
+		t.Fatalf("got %+v, want %+v", k, want)
+	}
+}
+
+func TestLoaderTOML(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"kontrol.toml": `
+title = "kontrol" # trailing comment
+ratio = 1.5
+count = 1_000
+mask = 0x1F
+tags = [
+  "a",
+  'b\c',
+]
+limits = { calls = 10, "bytes" = 2048 }
+
+[postgres]
+host = "db\tprimary"
+replica.host = "db-2"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	var s struct {
+		Title    string
+		Ratio    float64
+		Count    int
+		Mask     uint8
+		Tags     []string
+		Limits   map[string]int
+		Postgres struct {
+			Host    string
+			Replica struct {
+				Host string
+			}
+		}
+	}
+
+	l := &config.Loader{Files: []string{filepath.Join(dir, "kontrol.toml")}}
+
+	if err := l.Load(&s); err != nil {
+		t.Fatalf("Load()=%s", err)
+	}
+
+	if s.Title != "kontrol" || s.Ratio != 1.5 || s.Count != 1000 || s.Mask != 31 {
+		t.Fatalf("got %+v", s)
+	}
+
+	if !reflect.DeepEqual(s.Tags, []string{"a", `b\c`}) {
+		t.Fatalf("got tags %q", s.Tags)
+	}
+
+	if !reflect.DeepEqual(s.Limits, map[string]int{"calls": 10, "bytes": 2048}) {
+		t.Fatalf("got limits %v", s.Limits)
+	}
+
+	if s.Postgres.Host != "db\tprimary" || s.Postgres.Replica.Host != "db-2" {
+		t.Fatalf("got postgres %+v", s.Postgres)
+	}
+}
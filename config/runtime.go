@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded in JSON as a string
+// understood by time.ParseDuration, e.g. "15s".
+type Duration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// Runtime is the part of kite configuration that can be changed while
+// the kite is running. Values are swapped atomically as a whole, see
+// (*kite.Kite).SetRuntimeConfig.
+//
+// Zero value of a field means the value is left unchanged.
+type Runtime struct {
+	// LogLevel is one of "DEBUG", "INFO", "WARNING", "ERROR" or "FATAL".
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// Timeout overwrites Config.Timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// HandshakeTimeout overwrites Config.Websocket.HandshakeTimeout.
+	HandshakeTimeout Duration `json:"handshakeTimeout,omitempty"`
+
+	// MaxConcurrentRequests limits the number of requests handled
+	// concurrently by the kite. Requests above the limit are rejected
+	// with a requestLimitError. Negative value means no limit.
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+
+	// KiteKey overwrites Config.KiteKey. It is applied to the kite, but
+	// not kept in the runtime configuration of the kite.
+	KiteKey string `json:"kiteKey,omitempty"`
+
+	// KontrolKey overwrites Config.KontrolKey. It is applied to the kite,
+	// but not kept in the runtime configuration of the kite.
+	KontrolKey string `json:"kontrolKey,omitempty"`
+}
+
+var logLevels = map[string]struct{}{
+	"DEBUG":   {},
+	"INFO":    {},
+	"WARNING": {},
+	"ERROR":   {},
+	"FATAL":   {},
+}
+
+// Valid returns non-nil error if the runtime configuration is malformed.
+func (r *Runtime) Valid() error {
+	if r.LogLevel != "" {
+		if _, ok := logLevels[strings.ToUpper(r.LogLevel)]; !ok {
+			return fmt.Errorf("unknown log level: %q", r.LogLevel)
+		}
+	}
+
+	if r.Timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+
+	if r.HandshakeTimeout < 0 {
+		return errors.New("handshake timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// Merge returns a copy of r with non-zero fields of other applied.
+func (r *Runtime) Merge(other *Runtime) *Runtime {
+	merged := *r
+
+	if other.LogLevel != "" {
+		merged.LogLevel = other.LogLevel
+	}
+
+	if other.Timeout != 0 {
+		merged.Timeout = other.Timeout
+	}
+
+	if other.HandshakeTimeout != 0 {
+		merged.HandshakeTimeout = other.HandshakeTimeout
+	}
+
+	if other.MaxConcurrentRequests != 0 {
+		merged.MaxConcurrentRequests = other.MaxConcurrentRequests
+	}
+
+	if other.KiteKey != "" {
+		merged.KiteKey = other.KiteKey
+	}
+
+	if other.KontrolKey != "" {
+		merged.KontrolKey = other.KontrolKey
+	}
+
+	return &merged
+}
+
+// ReadRuntimeFile reads runtime configuration from the given JSON file.
+func ReadRuntimeFile(file string) (*Runtime, error) {
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Runtime
+	if err := json.Unmarshal(p, &r); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", file, err)
+	}
+
+	if err := r.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", file, err)
+	}
+
+	return &r, nil
+}
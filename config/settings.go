@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings are the settings of a kite, which are read from configuration
+// files, environment variables and flags, see Config.Load.
+//
+// An example YAML configuration file:
+//
+//	username: alice
+//	environment: production
+//	port: 6000
+//	timeout: 30s
+//	kontrol_url: https://kontrol.example.com/kite
+//	kontrol_members:
+//	  - https://kontrol-2.example.com/kite
+type Settings struct {
+	Username              string
+	Environment           string
+	Region                string
+	ID                    string
+	IP                    string
+	Port                  int
+	Transport             string // "WebSocket", "XHRPolling" or "auto"
+	DisableAuthentication bool
+
+	Timeout          Duration
+	HandshakeTimeout Duration
+	VerifyTTL        Duration
+
+	ReceiveWindow      int
+	ReceiveWindowBytes int
+
+	KontrolURL     string
+	KontrolUser    string
+	KontrolMembers []string
+}
+
+// Load overrides the config with settings loaded by the loader. Current
+// values of the config serve as defaults, the settings not given in any
+// of the sources keep them.
+//
+// Environment variables read by Get and ReadEnvironmentVariables have
+// the same names as the ones read with "KITE_" as the Loader.EnvPrefix.
+func (c *Config) Load(l *Loader) error {
+	s := c.settings()
+
+	if err := l.Load(s); err != nil {
+		return err
+	}
+
+	return s.apply(c)
+}
+
+func (c *Config) settings() *Settings {
+	s := &Settings{
+		Username:              c.Username,
+		Environment:           c.Environment,
+		Region:                c.Region,
+		ID:                    c.Id,
+		IP:                    c.IP,
+		Port:                  c.Port,
+		Transport:             c.Transport.String(),
+		DisableAuthentication: c.DisableAuthentication,
+		Timeout:               Duration(c.Timeout),
+		VerifyTTL:             Duration(c.VerifyTTL),
+		ReceiveWindow:         c.ReceiveWindow,
+		ReceiveWindowBytes:    c.ReceiveWindowBytes,
+		KontrolURL:            c.KontrolURL,
+		KontrolUser:           c.KontrolUser,
+		KontrolMembers:        c.KontrolMembers,
+	}
+
+	if c.Websocket != nil {
+		s.HandshakeTimeout = Duration(c.Websocket.HandshakeTimeout)
+	}
+
+	return s
+}
+
+func (s *Settings) apply(c *Config) error {
+	transport, ok := Transports[s.Transport]
+	if !ok {
+		return fmt.Errorf("config: transport %q doesn't exist", s.Transport)
+	}
+
+	if s.Timeout < 0 || s.HandshakeTimeout < 0 {
+		return fmt.Errorf("config: timeouts cannot be negative")
+	}
+
+	c.Username = s.Username
+	c.Environment = s.Environment
+	c.Region = s.Region
+	c.Id = s.ID
+	c.IP = s.IP
+	c.Port = s.Port
+	c.Transport = transport
+	c.DisableAuthentication = s.DisableAuthentication
+	c.VerifyTTL = time.Duration(s.VerifyTTL)
+	c.ReceiveWindow = s.ReceiveWindow
+	c.ReceiveWindowBytes = s.ReceiveWindowBytes
+	c.KontrolURL = s.KontrolURL
+	c.KontrolUser = s.KontrolUser
+	c.KontrolMembers = s.KontrolMembers
+
+	if timeout := time.Duration(s.Timeout); timeout != c.Timeout {
+		c.Timeout = timeout
+
+		// Copy the client, it may be shared with other configs.
+		if c.Client != nil {
+			client := *c.Client
+			client.Timeout = timeout
+			c.Client = &client
+		}
+	}
+
+	if c.Websocket != nil && time.Duration(s.HandshakeTimeout) != c.Websocket.HandshakeTimeout {
+		dialer := *c.Websocket
+		dialer.HandshakeTimeout = time.Duration(s.HandshakeTimeout)
+		c.Websocket = &dialer
+	}
+
+	return nil
+}
@@ -0,0 +1,397 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by configuration files: tables,
+// dotted keys, strings, integers, floats, booleans, arrays and inline
+// tables. Multi-line strings, dates and arrays of tables are not supported.
+func parseTOML(p []byte) (map[string]interface{}, error) {
+	t := &tomlParser{s: string(p), line: 1}
+
+	root := make(map[string]interface{})
+	current := root
+
+	for {
+		t.skip(true)
+
+		if t.eof() {
+			return root, nil
+		}
+
+		if t.peek() == '[' {
+			if strings.HasPrefix(t.s[t.pos:], "[[") {
+				return nil, t.errorf("arrays of tables are not supported")
+			}
+
+			t.pos++
+			t.skip(false)
+
+			keys, err := t.key()
+			if err != nil {
+				return nil, err
+			}
+
+			t.skip(false)
+
+			if !t.consume(']') {
+				return nil, t.errorf("expected ]")
+			}
+
+			if current, err = t.table(root, keys); err != nil {
+				return nil, err
+			}
+		} else if err := t.keyValue(current); err != nil {
+			return nil, err
+		}
+
+		t.skip(false)
+
+		if !t.eof() && !t.consume('\n') && !t.consume('\r') {
+			return nil, t.errorf("expected end of line")
+		}
+
+		if t.s[t.pos-1] == '\n' {
+			t.line++
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (t *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+func (t *tomlParser) eof() bool {
+	return t.pos >= len(t.s)
+}
+
+func (t *tomlParser) peek() byte {
+	return t.s[t.pos]
+}
+
+func (t *tomlParser) consume(c byte) bool {
+	if !t.eof() && t.peek() == c {
+		t.pos++
+		return true
+	}
+
+	return false
+}
+
+// skip skips whitespace and comments, and if newlines is true,
+// also line breaks.
+func (t *tomlParser) skip(newlines bool) {
+	for !t.eof() {
+		switch c := t.peek(); {
+		case c == ' ' || c == '\t':
+			t.pos++
+		case c == '#':
+			for !t.eof() && t.peek() != '\n' {
+				t.pos++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			if c == '\n' {
+				t.line++
+			}
+			t.pos++
+		default:
+			return
+		}
+	}
+}
+
+// key parses a dotted key.
+func (t *tomlParser) key() ([]string, error) {
+	var keys []string
+
+	for {
+		k, err := t.simpleKey()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+
+		t.skip(false)
+
+		if !t.consume('.') {
+			return keys, nil
+		}
+
+		t.skip(false)
+	}
+}
+
+func (t *tomlParser) simpleKey() (string, error) {
+	if t.eof() {
+		return "", t.errorf("expected key")
+	}
+
+	switch t.peek() {
+	case '"':
+		return t.basicString()
+	case '\'':
+		return t.literalString()
+	}
+
+	start := t.pos
+	for !t.eof() && isBareKeyChar(t.peek()) {
+		t.pos++
+	}
+
+	if t.pos == start {
+		return "", t.errorf("expected key, got %q", t.peek())
+	}
+
+	return t.s[start:t.pos], nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// keyValue parses a key/value pair into the table.
+func (t *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := t.key()
+	if err != nil {
+		return err
+	}
+
+	if !t.consume('=') {
+		return t.errorf("expected = after %s", strings.Join(keys, "."))
+	}
+
+	t.skip(false)
+
+	v, err := t.value()
+	if err != nil {
+		return err
+	}
+
+	table, err = t.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	last := keys[len(keys)-1]
+
+	if _, ok := table[last]; ok {
+		return t.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+
+	table[last] = v
+
+	return nil
+}
+
+// table gives the table nested in the given one by the keys,
+// creating missing tables.
+func (t *tomlParser) table(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for i, k := range keys {
+		v, ok := table[k]
+		if !ok {
+			nested := make(map[string]interface{})
+			table[k] = nested
+			table = nested
+			continue
+		}
+
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, t.errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+		}
+
+		table = nested
+	}
+
+	return table, nil
+}
+
+func (t *tomlParser) value() (interface{}, error) {
+	if t.eof() {
+		return nil, t.errorf("expected value")
+	}
+
+	switch t.peek() {
+	case '"':
+		if strings.HasPrefix(t.s[t.pos:], `"""`) {
+			return nil, t.errorf("multi-line strings are not supported")
+		}
+		return t.basicString()
+	case '\'':
+		if strings.HasPrefix(t.s[t.pos:], `'''`) {
+			return nil, t.errorf("multi-line strings are not supported")
+		}
+		return t.literalString()
+	case '[':
+		return t.array()
+	case '{':
+		return t.inlineTable()
+	}
+
+	start := t.pos
+	for !t.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(t.peek())) {
+		t.pos++
+	}
+
+	return t.scalar(t.s[start:t.pos])
+}
+
+func (t *tomlParser) basicString() (string, error) {
+	start := t.pos
+	t.pos++ // opening quote
+
+	for !t.eof() {
+		switch t.peek() {
+		case '\\':
+			t.pos += 2
+		case '"':
+			t.pos++
+
+			s, err := strconv.Unquote(t.s[start:t.pos])
+			if err != nil {
+				return "", t.errorf("invalid string %s", t.s[start:t.pos])
+			}
+
+			return s, nil
+		case '\n':
+			return "", t.errorf("unterminated string")
+		default:
+			t.pos++
+		}
+	}
+
+	return "", t.errorf("unterminated string")
+}
+
+func (t *tomlParser) literalString() (string, error) {
+	t.pos++ // opening quote
+
+	end := strings.IndexAny(t.s[t.pos:], "'\n")
+	if end == -1 || t.s[t.pos+end] != '\'' {
+		return "", t.errorf("unterminated string")
+	}
+
+	s := t.s[t.pos : t.pos+end]
+	t.pos += end + 1
+
+	return s, nil
+}
+
+func (t *tomlParser) array() ([]interface{}, error) {
+	t.pos++ // [
+
+	a := []interface{}{}
+
+	for {
+		t.skip(true)
+
+		if t.consume(']') {
+			return a, nil
+		}
+
+		v, err := t.value()
+		if err != nil {
+			return nil, err
+		}
+
+		a = append(a, v)
+
+		t.skip(true)
+
+		if t.consume(']') {
+			return a, nil
+		}
+
+		if !t.consume(',') {
+			return nil, t.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (t *tomlParser) inlineTable() (map[string]interface{}, error) {
+	t.pos++ // {
+
+	table := make(map[string]interface{})
+
+	t.skip(false)
+
+	if t.consume('}') {
+		return table, nil
+	}
+
+	for {
+		t.skip(false)
+
+		if err := t.keyValue(table); err != nil {
+			return nil, err
+		}
+
+		t.skip(false)
+
+		if t.consume('}') {
+			return table, nil
+		}
+
+		if !t.consume(',') {
+			return nil, t.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (t *tomlParser) scalar(s string) (interface{}, error) {
+	switch s {
+	case "":
+		return nil, t.errorf("expected value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		f, _ := strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+		return f, nil
+	}
+
+	digits := strings.Replace(s, "_", "", -1)
+
+	if n, err := parseTOMLInt(digits); err == nil {
+		return n, nil
+	}
+
+	if strings.ContainsAny(digits, ".eE") {
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	if len(s) >= 10 && s[4] == '-' && s[7] == '-' {
+		return nil, t.errorf("dates are not supported: %s", s)
+	}
+
+	return nil, t.errorf("invalid value %s", s)
+}
+
+func parseTOMLInt(s string) (int64, error) {
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(s, prefix) {
+			return strconv.ParseInt(s[2:], base, 64)
+		}
+	}
+
+	// Leading zeros are not allowed in decimal integers.
+	if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' {
+		return 0, errors.New("leading zero")
+	}
+
+	return strconv.ParseInt(s, 10, 64)
+}
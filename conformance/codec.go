@@ -0,0 +1,174 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Codec encodes and decodes messages exchanged between kites.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is the codec used by kite by default.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// codecMessage resembles a dnode message with typical argument values.
+type codecMessage struct {
+	Method    string              `json:"method"`
+	Seq       uint64              `json:"seq"`
+	Arguments []string            `json:"arguments"`
+	Callbacks map[string][]string `json:"callbacks"`
+	Payload   []byte              `json:"payload"`
+	Number    float64             `json:"number"`
+	Flag      bool                `json:"flag"`
+	Nested    *codecMessage       `json:"nested,omitempty"`
+}
+
+// TestCodec tests whether c behaves the way kite expects from its codec:
+//
+//   - decoded messages are equal to the encoded ones
+//   - large messages are encoded and decoded intact
+//   - the codec is safe for concurrent use
+//   - truncated or otherwise corrupted messages fail to decode
+func TestCodec(t *testing.T, c Codec) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, c) })
+	t.Run("LargeMessage", func(t *testing.T) { testCodecLargeMessage(t, c) })
+	t.Run("Concurrent", func(t *testing.T) { testCodecConcurrent(t, c) })
+	t.Run("Corrupted", func(t *testing.T) { testCorrupted(t, c) })
+}
+
+func codecMessages() []*codecMessage {
+	var messages []*codecMessage
+
+	for i, s := range framingMessages {
+		messages = append(messages, &codecMessage{
+			Method:    s,
+			Seq:       uint64(i),
+			Arguments: []string{s, s},
+			Callbacks: map[string][]string{"0": {"0", s}},
+			Payload:   []byte(s),
+			Number:    float64(i) / 3,
+			Flag:      i%2 == 0,
+		})
+	}
+
+	messages = append(messages,
+		&codecMessage{},
+		&codecMessage{
+			Method: "nested",
+			Seq:    1<<53 - 1, // the largest integer exactly representable in JSON numbers
+			Number: -1e300,
+			Nested: &codecMessage{
+				Method:    "inner",
+				Arguments: []string{},
+				Callbacks: map[string][]string{},
+				Payload:   []byte{0, 1, 2, 0xff},
+				Nested:    &codecMessage{Method: "innermost"},
+			},
+		},
+	)
+
+	return messages
+}
+
+func roundTrip(c Codec, msg *codecMessage) error {
+	p, err := c.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Marshal()=%s", err)
+	}
+
+	var got codecMessage
+	if err := c.Unmarshal(p, &got); err != nil {
+		return fmt.Errorf("Unmarshal()=%s", err)
+	}
+
+	if !reflect.DeepEqual(&got, msg) {
+		return fmt.Errorf("got %+v, want %+v", &got, msg)
+	}
+
+	return nil
+}
+
+func testRoundTrip(t *testing.T, c Codec) {
+	for i, msg := range codecMessages() {
+		if err := roundTrip(c, msg); err != nil {
+			t.Errorf("%d: %s", i, err)
+		}
+	}
+}
+
+func testCodecLargeMessage(t *testing.T, c Codec) {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 1<<20; i++ {
+		fmt.Fprintf(&buf, "%d,", i)
+	}
+
+	msg := &codecMessage{
+		Method:    "large",
+		Arguments: []string{buf.String()},
+		Payload:   buf.Bytes(),
+	}
+
+	if err := roundTrip(c, msg); err != nil {
+		t.Fatal(abbrev(err.Error()))
+	}
+}
+
+func testCodecConcurrent(t *testing.T, c Codec) {
+	messages := codecMessages()
+
+	var wg sync.WaitGroup
+	errc := make(chan error, len(messages)*4)
+
+	for n := 0; n < 4; n++ {
+		for i, msg := range messages {
+			wg.Add(1)
+
+			go func(i int, msg *codecMessage) {
+				defer wg.Done()
+
+				if err := roundTrip(c, msg); err != nil {
+					errc <- fmt.Errorf("%d: %s", i, err)
+				}
+			}(i, msg)
+		}
+	}
+
+	wg.Wait()
+	close(errc)
+
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+func testCorrupted(t *testing.T, c Codec) {
+	msg := &codecMessage{
+		Method:    "corrupted",
+		Arguments: []string{"first", "second"},
+		Callbacks: map[string][]string{"0": {"1"}},
+	}
+
+	p, err := c.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	for _, n := range []int{0, 1, len(p) / 2, len(p) - 1} {
+		var got codecMessage
+		if err := c.Unmarshal(p[:n], &got); err == nil {
+			t.Errorf("want Unmarshal to fail for message truncated to %d of %d bytes", n, len(p))
+		}
+	}
+}
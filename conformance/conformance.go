@@ -0,0 +1,39 @@
+// Package conformance provides tests, which custom transports and codecs
+// are expected to pass before they are used with kite.
+//
+// The tests are run from a regular test function of the implementing
+// package, similar to net/http/httptest:
+//
+//	func TestMyTransport(t *testing.T) {
+//		conformance.TestTransport(t, func() (c1, c2 sockjs.Session, stop func(), err error) {
+//			// Connect c1 to c2.
+//		})
+//	}
+package conformance
+
+import (
+	"errors"
+	"time"
+)
+
+// Timeout is the time after which a single operation of the tested
+// implementation is considered to hang.
+var Timeout = 10 * time.Second
+
+var errTimeout = errors.New("timed out")
+
+// after runs fn and waits for it for at most Timeout.
+func after(fn func() error) error {
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- fn()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(Timeout):
+		return errTimeout
+	}
+}
@@ -0,0 +1,42 @@
+package conformance_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/conformance"
+	"github.com/koding/kite/sockjsclient"
+)
+
+func TestWebsocketTransport(t *testing.T) {
+	conformance.TestTransport(t, func() (c1, c2 sockjs.Session, stop func(), err error) {
+		sessions := make(chan sockjs.Session, 1)
+		done := make(chan struct{})
+
+		ts := httptest.NewServer(sockjs.NewHandler("/conformance", sockjs.DefaultOptions, func(s sockjs.Session) {
+			sessions <- s
+			<-done
+		}))
+
+		client, err := sockjsclient.DialWebsocket(fmt.Sprintf("%s/conformance", ts.URL), config.New())
+		if err != nil {
+			ts.Close()
+			return nil, nil, nil, err
+		}
+
+		stop = func() {
+			client.Close(3000, "Go away!")
+			close(done)
+			ts.Close()
+		}
+
+		return client, <-sessions, stop, nil
+	})
+}
+
+func TestJSONCodec(t *testing.T) {
+	conformance.TestCodec(t, conformance.JSON)
+}
@@ -0,0 +1,243 @@
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// MakePipe creates a pair of connected sessions, where messages sent by
+// one of them are received by the other. The stop function closes both
+// sessions and releases their resources.
+type MakePipe func() (c1, c2 sockjs.Session, stop func(), err error)
+
+// TestTransport tests whether sessions created by mp behave the way kite
+// expects from its transport:
+//
+//   - messages are received in the order they were sent
+//   - message boundaries and content are preserved
+//   - large messages are delivered intact
+//   - Send is safe to call concurrently with Recv and other Send calls
+//   - closing a session fails further calls and disconnects the peer
+//
+// Sessions are expected to be ready to send and receive when mp returns.
+func TestTransport(t *testing.T, mp MakePipe) {
+	t.Run("Ordering", func(t *testing.T) { testPipe(t, mp, testOrdering) })
+	t.Run("Framing", func(t *testing.T) { testPipe(t, mp, testFraming) })
+	t.Run("LargeMessage", func(t *testing.T) { testPipe(t, mp, testLargeMessage) })
+	t.Run("Concurrent", func(t *testing.T) { testPipe(t, mp, testConcurrent) })
+	t.Run("Close", func(t *testing.T) { testPipe(t, mp, testClose) })
+	t.Run("ClosePeer", func(t *testing.T) { testPipe(t, mp, testClosePeer) })
+}
+
+func testPipe(t *testing.T, mp MakePipe, fn func(*testing.T, sockjs.Session, sockjs.Session)) {
+	c1, c2, stop, err := mp()
+	if err != nil {
+		t.Fatalf("unable to make pipe: %s", err)
+	}
+	defer stop()
+
+	fn(t, c1, c2)
+}
+
+func send(s sockjs.Session, msg string) error {
+	return after(func() error {
+		return s.Send(msg)
+	})
+}
+
+func recv(s sockjs.Session) (msg string, err error) {
+	err = after(func() (err error) {
+		msg, err = s.Recv()
+		return err
+	})
+
+	return msg, err
+}
+
+// expect sends messages from one session and checks they are
+// received by the other one in order.
+func expect(t *testing.T, from, to sockjs.Session, messages []string) {
+	errc := make(chan error, 1)
+
+	go func() {
+		for i, msg := range messages {
+			if err := send(from, msg); err != nil {
+				errc <- fmt.Errorf("%d: Send()=%s", i, err)
+				return
+			}
+		}
+		errc <- nil
+	}()
+
+	for i, want := range messages {
+		got, err := recv(to)
+		if err != nil {
+			t.Fatalf("%d: Recv()=%s", i, err)
+		}
+
+		if got != want {
+			t.Fatalf("%d: got %q, want %q", i, abbrev(got), abbrev(want))
+		}
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testOrdering(t *testing.T, c1, c2 sockjs.Session) {
+	messages := make([]string, 100)
+	for i := range messages {
+		messages[i] = fmt.Sprintf(`{"method":"seq","arguments":[%d]}`, i)
+	}
+
+	expect(t, c1, c2, messages)
+	expect(t, c2, c1, messages)
+}
+
+// framingMessages are payloads, which are easy to get wrong when
+// messages are framed, escaped or batched. Kite sends JSON-encoded
+// messages only, thus all of them are valid UTF-8.
+var framingMessages = []string{
+	"",
+	"a",
+	" leading and trailing whitespace ",
+	`"quoted"`,
+	`\"escaped\\`,
+	"line\nbreak\r\n",
+	"\x00\x01\x1f control",
+	"   separators",
+	"ünïcødé 日本語 🚀",
+	`["a","b"]`,
+	`{"method":"kite.ping","arguments":[],"callbacks":{}}`,
+	"o",
+	"h",
+	`a["injected"]`,
+	`c[3000,"Go away!"]`,
+}
+
+func testFraming(t *testing.T, c1, c2 sockjs.Session) {
+	expect(t, c1, c2, framingMessages)
+	expect(t, c2, c1, framingMessages)
+}
+
+func testLargeMessage(t *testing.T, c1, c2 sockjs.Session) {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 1<<20; i++ {
+		fmt.Fprintf(&buf, "%d,", i)
+	}
+	msg := buf.String()
+
+	expect(t, c1, c2, []string{msg, "after"})
+	expect(t, c2, c1, []string{msg, "after"})
+}
+
+func testConcurrent(t *testing.T, c1, c2 sockjs.Session) {
+	const senders, count = 4, 50
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 4*senders)
+
+	// Messages of each sender must arrive in order, while messages
+	// of different senders may interleave.
+	receive := func(s sockjs.Session) {
+		defer wg.Done()
+
+		next := make(map[int]int)
+
+		for i := 0; i < senders*count; i++ {
+			msg, err := recv(s)
+			if err != nil {
+				errc <- fmt.Errorf("%d: Recv()=%s", i, err)
+				return
+			}
+
+			var sender, seq int
+			if _, err := fmt.Sscanf(msg, "%d:%d", &sender, &seq); err != nil {
+				errc <- fmt.Errorf("%d: malformed message %q", i, abbrev(msg))
+				return
+			}
+
+			if seq != next[sender] {
+				errc <- fmt.Errorf("sender %d: got message %d, want %d", sender, seq, next[sender])
+				return
+			}
+
+			next[sender]++
+		}
+	}
+
+	sendAll := func(s sockjs.Session, sender int) {
+		defer wg.Done()
+
+		for seq := 0; seq < count; seq++ {
+			if err := send(s, fmt.Sprintf("%d:%d", sender, seq)); err != nil {
+				errc <- fmt.Errorf("sender %d: Send()=%s", sender, err)
+				return
+			}
+		}
+	}
+
+	wg.Add(2 + 2*senders)
+
+	go receive(c1)
+	go receive(c2)
+
+	for i := 0; i < senders; i++ {
+		go sendAll(c1, i)
+		go sendAll(c2, i)
+	}
+
+	wg.Wait()
+	close(errc)
+
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+func testClose(t *testing.T, c1, c2 sockjs.Session) {
+	closeAndCheck(t, c1, c2)
+}
+
+func testClosePeer(t *testing.T, c1, c2 sockjs.Session) {
+	closeAndCheck(t, c2, c1)
+}
+
+// closeAndCheck closes the session s and checks the peer gets disconnected.
+func closeAndCheck(t *testing.T, s, peer sockjs.Session) {
+	expect(t, s, peer, []string{"before close"})
+
+	if err := after(func() error { s.Close(3000, "Go away!"); return nil }); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	if err := send(s, "after close"); err == nil {
+		t.Error("want Send to fail on closed session")
+	}
+
+	if _, err := recv(s); err == nil {
+		t.Error("want Recv to fail on closed session")
+	}
+
+	if msg, err := recv(peer); err == nil {
+		t.Errorf("want Recv to fail on disconnected peer, got %q", abbrev(msg))
+	}
+
+	// Closing again may fail, but must not block or panic.
+	if err := after(func() error { s.Close(3000, "Go away!"); return nil }); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+}
+
+func abbrev(s string) string {
+	if len(s) > 64 {
+		return fmt.Sprintf("%s... (%d bytes)", s[:64], len(s))
+	}
+
+	return s
+}
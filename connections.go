@@ -0,0 +1,155 @@
+package kite
+
+import (
+	"sort"
+)
+
+// ConnectionQuery selects clients connected to the kite's server. Empty
+// fields match any connection.
+type ConnectionQuery struct {
+	// Connection is the ID of a single connection, as reported by
+	// Kite.Connections.
+	Connection string `json:"connection,omitempty"`
+
+	// Username is the user the remote kite authenticated as.
+	Username string `json:"username,omitempty"`
+
+	// Name and ID identify the remote kite.
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+
+	// Labels must all be set on the connection with the given values,
+	// see Client.SetLabel.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SetLabel tags the connection with the label, which may be used to find
+// it with Kite.Clients. An empty value removes the label.
+//
+// Handlers use it to tag the connection of the caller, for example with
+// a chat room joined:
+//
+//	r.Client.SetLabel("room", room)
+func (c *Client) SetLabel(key, value string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if value == "" {
+		delete(c.labels, key)
+		return
+	}
+
+	if c.labels == nil {
+		c.labels = make(map[string]string)
+	}
+
+	c.labels[key] = value
+}
+
+// Labels gives the labels of the connection.
+func (c *Client) Labels() map[string]string {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	labels := make(map[string]string, len(c.labels))
+	for key, value := range c.labels {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// match tells whether the connection is selected by the query.
+func (q *ConnectionQuery) match(c *Client) bool {
+	if q == nil {
+		return true
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if q.Username != "" && q.Username != c.Kite.Username {
+		return false
+	}
+
+	if q.Name != "" && q.Name != c.Kite.Name {
+		return false
+	}
+
+	if q.ID != "" && q.ID != c.Kite.ID {
+		return false
+	}
+
+	for key, value := range q.Labels {
+		if c.labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clients gives the clients connected to the kite's server, which are
+// selected by the query. A nil query selects all of them.
+//
+// Use it to call all connections of a user:
+//
+//	for _, c := range k.Clients(&kite.ConnectionQuery{Username: "alice"}) {
+//	    c.Go("notify", msg)
+//	}
+func (k *Kite) Clients(q *ConnectionQuery) []*Client {
+	var clients []*Client
+
+	for _, cc := range k.connectedClients(q) {
+		clients = append(clients, cc.client)
+	}
+
+	return clients
+}
+
+// QueryConnections describes the clients connected to the kite's server,
+// which are selected by the query, ordered by the time they connected.
+func (k *Kite) QueryConnections(q *ConnectionQuery) []*AdminConnection {
+	ccs := k.connectedClients(q)
+
+	conns := make([]*AdminConnection, 0, len(ccs))
+	for id, cc := range ccs {
+		cc.client.m.RLock()
+		kite := cc.client.Kite
+		cc.client.m.RUnlock()
+
+		conns = append(conns, &AdminConnection{
+			ID:         id,
+			Kite:       kite,
+			Labels:     cc.client.Labels(),
+			RemoteAddr: cc.client.RemoteAddr(),
+			Connected:  cc.connected,
+		})
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Connected.Before(conns[j].Connected)
+	})
+
+	return conns
+}
+
+// connectedClients gives the connected clients selected by the query,
+// by their session IDs.
+func (k *Kite) connectedClients(q *ConnectionQuery) map[string]*connectedClient {
+	k.clientsMu.Lock()
+	defer k.clientsMu.Unlock()
+
+	ccs := make(map[string]*connectedClient)
+	for id, cc := range k.clients {
+		if q != nil && q.Connection != "" && q.Connection != id {
+			continue
+		}
+
+		if q.match(cc.client) {
+			ccs[id] = cc
+		}
+	}
+
+	return ccs
+}
@@ -0,0 +1,221 @@
+package kite
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DeniedConnections counts connections refused by Kite.ConnectionFilter,
+// by reasons. It is published with the expvar package.
+var DeniedConnections = expvar.NewMap("kite.deniedConnections")
+
+// Reasons of denied connections, see DeniedConnection.
+const (
+	DenyReasonDenylist  = "denylist"     // the address is in ConnectionFilter.Deny
+	DenyReasonAllowlist = "allowlist"    // the address is not in ConnectionFilter.Allow
+	DenyReasonCountry   = "country"      // the country of the address is not allowed
+	DenyReasonAddress   = "invalidAddr"  // the address of the connection is invalid
+	DenyReasonGeoIP     = "geoipFailure" // the country of the address cannot be resolved
+)
+
+// GeoIP resolves countries of IP addresses, e.g. with a GeoIP database.
+type GeoIP interface {
+	// Country gives the ISO 3166-1 alpha-2 code of the country
+	// of the address, like "DE".
+	Country(ip net.IP) (string, error)
+}
+
+// ConnectionFilter decides which remote addresses may connect to the kite,
+// see Kite.ConnectionFilter. Connections are filtered before the SockJS
+// handshake, refused connections get 403 Forbidden HTTP responses.
+//
+// The deny list is checked first, then the allow list, then the country
+// rules.
+type ConnectionFilter struct {
+	// Allow, when non-empty, lists the only networks connections are
+	// accepted from.
+	Allow []*net.IPNet
+
+	// Deny lists networks connections are refused from.
+	Deny []*net.IPNet
+
+	// GeoIP resolves countries of addresses for the country rules.
+	// If nil, the country rules are ignored.
+	GeoIP GeoIP
+
+	// AllowCountries, when non-empty, lists the only countries
+	// connections are accepted from. Connections from addresses, whose
+	// country cannot be resolved, are refused.
+	AllowCountries []string
+
+	// DenyCountries lists countries connections are refused from.
+	DenyCountries []string
+
+	// TrustForwardedFor makes the filter check the address of the client
+	// from the X-Forwarded-For header, when the kite is behind a trusted
+	// reverse proxy.
+	TrustForwardedFor bool
+}
+
+// DeniedConnection describes a connection refused by ConnectionFilter.
+type DeniedConnection struct {
+	Time    time.Time
+	Addr    string // remote address of the connection
+	Country string // country of the address, if resolved
+	Reason  string // DenyReasonDenylist, DenyReasonAllowlist, ...
+}
+
+// ParseCIDRs parses the networks in CIDR notation, like "10.0.0.0/8",
+// for ConnectionFilter lists. Single addresses are accepted as well.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, s := range cidrs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// Check tells whether the connection from the address is accepted. It gives
+// the reason the connection is refused and the country, if it was resolved.
+func (f *ConnectionFilter) Check(ip net.IP) (reason, country string) {
+	if ip == nil {
+		return DenyReasonAddress, ""
+	}
+
+	if containsIP(f.Deny, ip) {
+		return DenyReasonDenylist, ""
+	}
+
+	if len(f.Allow) != 0 && !containsIP(f.Allow, ip) {
+		return DenyReasonAllowlist, ""
+	}
+
+	if f.GeoIP == nil || (len(f.AllowCountries) == 0 && len(f.DenyCountries) == 0) {
+		return "", ""
+	}
+
+	country, err := f.GeoIP.Country(ip)
+	if err != nil {
+		// Unresolved addresses can pass only deny rules.
+		if len(f.AllowCountries) != 0 {
+			return DenyReasonGeoIP, ""
+		}
+
+		return "", ""
+	}
+
+	if containsFold(f.DenyCountries, country) {
+		return DenyReasonCountry, country
+	}
+
+	if len(f.AllowCountries) != 0 && !containsFold(f.AllowCountries, country) {
+		return DenyReasonCountry, country
+	}
+
+	return "", country
+}
+
+// remoteIP gives the address of the client, which made the request.
+func (f *ConnectionFilter) remoteIP(req *http.Request) (net.IP, string) {
+	addr := req.RemoteAddr
+
+	if f.TrustForwardedFor {
+		if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+			addr = strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+
+	return net.ParseIP(host), addr
+}
+
+// filterConnections wraps the handler of connections, refusing those
+// denied by the connection filter of the kite.
+func (k *Kite) filterConnections(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		f := k.ConnectionFilter
+		if f == nil {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		ip, addr := f.remoteIP(req)
+
+		reason, country := f.Check(ip)
+		if reason == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		k.connectionDenied(&DeniedConnection{
+			Time:    time.Now(),
+			Addr:    addr,
+			Country: country,
+			Reason:  reason,
+		})
+
+		http.Error(w, "connection denied", http.StatusForbidden)
+	})
+}
+
+func (k *Kite) connectionDenied(d *DeniedConnection) {
+	DeniedConnections.Add(d.Reason, 1)
+
+	if k.OnConnectionDenied != nil {
+		defer nopRecover()
+		k.OnConnectionDenied(d)
+		return
+	}
+
+	k.Log.Info("audit: connection from %s denied (%s)", d.Addr, d.Reason)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
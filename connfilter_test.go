@@ -0,0 +1,114 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+type geoIPFunc func(net.IP) (string, error)
+
+func (f geoIPFunc) Country(ip net.IP) (string, error) { return f(ip) }
+
+func TestConnectionFilter(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	denied := make(chan *DeniedConnection, 10)
+
+	srv := NewWithConfig("filter-server", "0.0.1", cfg)
+	srv.OnConnectionDenied = func(d *DeniedConnection) {
+		denied <- d
+	}
+
+	deny, err := ParseCIDRs("127.0.0.1", "::1")
+	if err != nil {
+		t.Fatalf("ParseCIDRs()=%s", err)
+	}
+
+	srv.ConnectionFilter = &ConnectionFilter{Deny: deny}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("filter-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err == nil {
+		c.Close()
+		t.Fatal("want connection to be denied")
+	}
+
+	if d := <-denied; d.Reason != DenyReasonDenylist {
+		t.Fatalf("got reason %q, want %q", d.Reason, DenyReasonDenylist)
+	}
+
+	allow, err := ParseCIDRs("127.0.0.0/8", "::1/128")
+	if err != nil {
+		t.Fatalf("ParseCIDRs()=%s", err)
+	}
+
+	srv.ConnectionFilter = &ConnectionFilter{Allow: allow}
+
+	c = New("filter-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("kite.ping"); err != nil {
+		t.Fatalf("kite.ping=%s", err)
+	}
+}
+
+func TestConnectionFilterCheck(t *testing.T) {
+	allow, _ := ParseCIDRs("10.0.0.0/8")
+	deny, _ := ParseCIDRs("10.0.0.1")
+
+	geoIP := geoIPFunc(func(ip net.IP) (string, error) {
+		switch ip.String() {
+		case "10.0.0.2":
+			return "DE", nil
+		case "10.0.0.3":
+			return "KP", nil
+		default:
+			return "", errors.New("unknown address")
+		}
+	})
+
+	f := &ConnectionFilter{
+		Allow:         allow,
+		Deny:          deny,
+		GeoIP:         geoIP,
+		DenyCountries: []string{"kp"},
+	}
+
+	cases := []struct {
+		ip     string
+		reason string
+	}{
+		{"10.0.0.1", DenyReasonDenylist},
+		{"192.168.0.1", DenyReasonAllowlist},
+		{"10.0.0.2", ""},
+		{"10.0.0.3", DenyReasonCountry},
+		{"10.0.0.4", ""},
+	}
+
+	for _, c := range cases {
+		if reason, _ := f.Check(net.ParseIP(c.ip)); reason != c.reason {
+			t.Errorf("%s: got %q, want %q", c.ip, reason, c.reason)
+		}
+	}
+
+	f.AllowCountries = []string{"DE"}
+
+	if reason, _ := f.Check(net.ParseIP("10.0.0.4")); reason != DenyReasonGeoIP {
+		t.Errorf("got %q, want %q", reason, DenyReasonGeoIP)
+	}
+
+	if reason, country := f.Check(net.ParseIP("10.0.0.2")); reason != "" || country != "DE" {
+		t.Errorf("got %q, %q, want the address to be allowed", reason, country)
+	}
+}
@@ -0,0 +1,253 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultIdleTimeout is the time an unused shared connection is kept open
+// by the ConnPool before it is closed.
+var DefaultIdleTimeout = 30 * time.Second
+
+// ErrPoolClosed is returned by ConnPool.Get when the pool was closed.
+var ErrPoolClosed = errors.New("connection pool is closed")
+
+// ConnPool shares a single physical connection between multiple logical
+// clients talking to the same remote kite.
+//
+// Each connection is reference counted; when the last logical client
+// releases it, the connection is closed after IdleTimeout unless it is
+// requested again in the meantime.
+type ConnPool struct {
+	// Kite is the local kite which owns the connections.
+	//
+	// Required.
+	Kite *Kite
+
+	// IdleTimeout is the time an unused connection is kept open.
+	//
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// DialTimeout is the time to wait for a new connection
+	// to be established.
+	//
+	// If zero, Kite.Config.Timeout is used.
+	DialTimeout time.Duration
+
+	mu     sync.Mutex
+	conns  map[string]*pooledConn
+	closed bool
+}
+
+type pooledConn struct {
+	client *Client
+	refs   int
+	idle   *time.Timer
+	ready  chan struct{} // closed when dial is done
+	err    error         // dial error, valid after ready is closed
+}
+
+// PooledClient is a logical client backed by a shared connection.
+//
+// The Close method releases the connection back to the pool instead
+// of closing it.
+//
+// Once the remote kite rejects a call with a retry hint, see RetryAfter,
+// the Tell methods wait for the hinted time before sending further calls
+// over the shared connection.
+type PooledClient struct {
+	*Client
+
+	pool *ConnPool
+	key  string
+	once sync.Once
+}
+
+// NewConnPool gives new connection pool for the given kite.
+func NewConnPool(k *Kite) *ConnPool {
+	return &ConnPool{
+		Kite:  k,
+		conns: make(map[string]*pooledConn),
+	}
+}
+
+// Get gives a client connected to the given URL, authenticated with the
+// given auth, which may be nil. If the pool already holds a connection
+// for the URL and auth, it is reused, otherwise a new one is dialed.
+//
+// The returned client must be closed when it is no longer used.
+func (p *ConnPool) Get(url string, auth *Auth) (*PooledClient, error) {
+	key := url
+	if auth != nil {
+		key += "\x00" + auth.Type + "\x00" + auth.Key
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	pc, ok := p.conns[key]
+	if !ok {
+		pc = &pooledConn{
+			client: p.Kite.NewClient(url),
+			ready:  make(chan struct{}),
+		}
+
+		if auth != nil {
+			authCopy := *auth
+			pc.client.Auth = &authCopy
+		}
+
+		p.conns[key] = pc
+
+		go p.dial(key, pc)
+	}
+
+	pc.refs++
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+	p.mu.Unlock()
+
+	<-pc.ready
+
+	if pc.err != nil {
+		p.release(key, pc)
+		return nil, pc.err
+	}
+
+	return &PooledClient{
+		Client: pc.client,
+		pool:   p,
+		key:    key,
+	}, nil
+}
+
+// Len gives the number of connections held by the pool.
+func (p *ConnPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.conns)
+}
+
+// Close closes all connections held by the pool, regardless whether
+// they are still in use.
+func (p *ConnPool) Close() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*pooledConn)
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		<-pc.ready
+		pc.client.Close()
+	}
+}
+
+func (p *ConnPool) dial(key string, pc *pooledConn) {
+	timeout := p.DialTimeout
+	if timeout == 0 {
+		timeout = p.Kite.CallTimeout()
+	}
+
+	if pc.err = pc.client.DialTimeout(timeout); pc.err == nil {
+		// Shared connections are expected to outlive a single
+		// user, keep them connected.
+		pc.client.muReconnect.Lock()
+		pc.client.Reconnect = true
+		pc.client.muReconnect.Unlock()
+	} else {
+		p.mu.Lock()
+		if p.conns[key] == pc {
+			delete(p.conns, key)
+		}
+		p.mu.Unlock()
+	}
+
+	close(pc.ready)
+}
+
+func (p *ConnPool) release(key string, pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc.refs--; pc.refs > 0 || pc.err != nil {
+		return
+	}
+
+	timeout := p.IdleTimeout
+	if timeout == 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	pc.idle = time.AfterFunc(timeout, func() {
+		p.mu.Lock()
+		if pc.refs > 0 || p.conns[key] != pc {
+			p.mu.Unlock()
+			return
+		}
+		delete(p.conns, key)
+		p.mu.Unlock()
+
+		p.Kite.Log.Debug("closing idle connection to %s", pc.client.URL)
+
+		pc.client.Close()
+	})
+}
+
+// Close releases the shared connection. The connection itself is closed
+// by the pool once it is not used by any client for the idle timeout.
+func (c *PooledClient) Close() {
+	c.once.Do(func() {
+		c.pool.mu.Lock()
+		pc := c.pool.conns[c.key]
+		c.pool.mu.Unlock()
+
+		if pc != nil && pc.client == c.Client {
+			c.pool.release(c.key, pc)
+		}
+	})
+}
+
+// Tell calls the method of the remote kite, see Client.Tell.
+func (c *PooledClient) Tell(method string, args ...interface{}) (*dnode.Partial, error) {
+	return c.TellWithTimeout(method, 0, args...)
+}
+
+// TellWithTimeout calls the method of the remote kite, see
+// Client.TellWithTimeout. The time waited due to a retry hint
+// counts towards the timeout.
+func (c *PooledClient) TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (*dnode.Partial, error) {
+	if timeout <= 0 {
+		if err := c.waitRetryAfter(context.Background()); err != nil {
+			return nil, err
+		}
+
+		return c.Client.TellWithTimeout(method, timeout, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return c.TellWithContext(ctx, method, args...)
+}
+
+// TellWithContext calls the method of the remote kite, see
+// Client.TellWithContext.
+func (c *PooledClient) TellWithContext(ctx context.Context, method string, args ...interface{}) (*dnode.Partial, error) {
+	if err := c.waitRetryAfter(ctx); err != nil {
+		return nil, contextError(ctx, method)
+	}
+
+	return c.Client.TellWithContext(ctx, method, args...)
+}
@@ -0,0 +1,60 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestConnPool(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("pool-server", "0.0.1", cfg)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	p := NewConnPool(New("pool-client", "0.0.1"))
+	p.IdleTimeout = 100 * time.Millisecond
+	defer p.Close()
+
+	url := fmt.Sprintf("%s/kite", ts.URL)
+
+	c1, err := p.Get(url, nil)
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	c2, err := p.Get(url, nil)
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if c1.Client != c2.Client {
+		t.Fatal("want connection to be shared")
+	}
+
+	if _, err := c2.Tell("kite.ping"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	c1.Close()
+	c1.Close() // idempotent
+
+	time.Sleep(2 * p.IdleTimeout)
+
+	if n := p.Len(); n != 1 {
+		t.Fatalf("want connection in use to be kept, got %d connections", n)
+	}
+
+	c2.Close()
+
+	time.Sleep(2 * p.IdleTimeout)
+
+	if n := p.Len(); n != 0 {
+		t.Fatalf("want idle connection to be closed, got %d connections", n)
+	}
+}
@@ -0,0 +1,60 @@
+package kite
+
+import "strings"
+
+// Copy gives a new kite with the name, version and a copy of the
+// configuration of k, which shares the methods with k: methods registered
+// with either kite are served by both, including the built-in kite.* ones,
+// which serve k. It is the shared handlers mode of the server-per-connection
+// pattern, where the copies serve methods registered with k later on.
+//
+// The kite-wide handlers, the authenticators, the logger and the method
+// handling of k are copied as well, other fields are set as by New. The
+// copy has its own ID and it should be closed when no longer needed.
+func (k *Kite) Copy() *Kite {
+	c := k.copy()
+	c.methods = k.methods
+
+	return c
+}
+
+// CopyIsolated is like Copy, but the copy gets copies of the methods of k,
+// except the built-in kite.* ones, which serve the copy. Methods registered
+// or modified later with either kite are not seen by the other one.
+func (k *Kite) CopyIsolated() *Kite {
+	c := k.copy()
+
+	k.methods.mu.RLock()
+	defer k.methods.mu.RUnlock()
+
+	c.methods.mu.Lock()
+	defer c.methods.mu.Unlock()
+
+	for name, m := range k.methods.m {
+		if !strings.HasPrefix(name, "kite.") {
+			c.methods.m[name] = m.copy()
+		}
+	}
+
+	return c
+}
+
+func (k *Kite) copy() *Kite {
+	k.configMu.RLock()
+	cfg := k.Config.Copy()
+	k.configMu.RUnlock()
+
+	c := NewWithConfig(k.name, k.version, cfg)
+	c.Log = k.Log
+	c.SetLogLevel = k.SetLogLevel
+	c.MethodHandling = k.MethodHandling
+	c.preHandlers = append([]Handler(nil), k.preHandlers...)
+	c.postHandlers = append([]Handler(nil), k.postHandlers...)
+	c.finalFuncs = append([]FinalFunc(nil), k.finalFuncs...)
+
+	for typ, fn := range k.Authenticators {
+		c.Authenticators[typ] = fn
+	}
+
+	return c
+}
@@ -0,0 +1,91 @@
+package kite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCopy(t *testing.T) {
+	k := New("copy", "0.0.1")
+	k.HandleFunc("foo", func(r *Request) (interface{}, error) { return "foo", nil })
+
+	c := k.Copy()
+	defer c.Close()
+
+	if c.Id == k.Id {
+		t.Fatal("want the copy to have its own ID")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.HandleFunc(fmt.Sprintf("bar%d", i), func(r *Request) (interface{}, error) { return "bar", nil })
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		k.method(fmt.Sprintf("bar%d", i))
+	}
+
+	<-done
+
+	for _, name := range []string{"foo", "bar99", "kite.ping"} {
+		m, ok := k.method(name)
+		if !ok {
+			t.Fatalf("%s: not registered with the kite", name)
+		}
+
+		if cm, _ := c.method(name); cm != m {
+			t.Fatalf("%s: got %p, want the shared method %p", name, cm, m)
+		}
+	}
+}
+
+func TestCopyIsolated(t *testing.T) {
+	k := New("copy", "0.0.1")
+	k.PreHandleFunc(func(r *Request) (interface{}, error) { return nil, nil })
+	k.HandleFunc("foo", func(r *Request) (interface{}, error) { return "foo", nil }).Throttle(time.Second, 10)
+
+	c := k.CopyIsolated()
+	defer c.Close()
+
+	if len(c.preHandlers) != 1 {
+		t.Fatalf("got %d kite-wide pre handlers, want 1", len(c.preHandlers))
+	}
+
+	m, _ := k.method("foo")
+
+	cm, ok := c.method("foo")
+	if !ok || cm == m {
+		t.Fatalf("got %p, want a copy of %p", cm, m)
+	}
+
+	if cm.bucket == nil || cm.bucket == m.bucket {
+		t.Fatal("want the copy to have its own throttle bucket")
+	}
+
+	cm.PreHandleFunc(func(r *Request) (interface{}, error) { return nil, nil })
+	c.HandleFunc("bar", func(r *Request) (interface{}, error) { return "bar", nil })
+	k.HandleFunc("baz", func(r *Request) (interface{}, error) { return "baz", nil })
+
+	if len(m.preHandlers) != 0 {
+		t.Fatalf("got %d pre handlers of the original method, want 0", len(m.preHandlers))
+	}
+
+	if _, ok := k.method("bar"); ok {
+		t.Fatal("method registered with the copy is served by the kite")
+	}
+
+	if _, ok := c.method("baz"); ok {
+		t.Fatal("method registered with the kite is served by the copy")
+	}
+
+	// Built-in methods serve the kite they are registered with.
+	if p, _ := k.method("kite.ping"); p == nil {
+		t.Fatal("kite.ping is not registered")
+	} else if cp, _ := c.method("kite.ping"); cp == nil || cp == p {
+		t.Fatalf("got %p, want own kite.ping of the copy", cp)
+	}
+}
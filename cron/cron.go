@@ -0,0 +1,347 @@
+// Package cron implements a scheduler, which runs functions, local
+// handlers or methods of remote kites on cron expressions.
+//
+// Example:
+//
+//	k := kite.New("maintenance", "1.0.0")
+//	k.HandleFunc("compact", compact)
+//
+//	s := cron.New(k)
+//	s.Store = &cron.FileStore{Path: "/var/lib/maintenance/cron.json"}
+//
+//	err := s.Add(&cron.Job{
+//	    Name:   "compaction",
+//	    Spec:   "30 3 * * *",
+//	    Jitter: 5 * time.Minute,
+//	    Missed: cron.RunOnce,
+//	    Method: "compact",
+//	})
+//
+// Runs missed while the scheduler was not running are detected with the
+// state of the last run saved in the Store, and handled as given by
+// Job.Missed.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// DefaultMaxCatchUp is the maximum number of missed runs made with
+// the RunAll policy, if Scheduler.MaxCatchUp is zero.
+var DefaultMaxCatchUp = 10
+
+// MissedPolicy tells what to do with runs of a job, which were missed
+// while the scheduler was not running.
+type MissedPolicy int
+
+const (
+	// Skip skips the missed runs.
+	Skip MissedPolicy = iota
+
+	// RunOnce makes a single run, if any runs were missed.
+	RunOnce
+
+	// RunAll makes each missed run, up to Scheduler.MaxCatchUp
+	// most recent ones.
+	RunAll
+)
+
+// Job is a job run by a scheduler. One of Func and Method must be set.
+type Job struct {
+	// Name identifies the job in the scheduler and its Store.
+	Name string
+
+	// Spec is the schedule of the job, as accepted by Parse.
+	Spec string
+
+	// Jitter delays each run by a random duration up to Jitter, to not
+	// overload shared resources by many kites running the job at once.
+	Jitter time.Duration
+
+	// Missed tells what to do with runs missed while the scheduler
+	// was not running.
+	Missed MissedPolicy
+
+	// Timeout limits the time of a run.
+	//
+	// If zero, calls to remote kites are limited by the Config.Timeout
+	// of the scheduler's kite, other runs are not limited.
+	Timeout time.Duration
+
+	// Func is called on each run.
+	Func func(ctx context.Context) error
+
+	// Method is the method called with Args on each run. It is called
+	// on Client, or if it is nil, the handler of the method registered
+	// with the scheduler's kite is invoked.
+	Method string
+	Args   []interface{}
+	Client *kite.Client
+
+	schedule Schedule
+	stop     chan struct{}
+}
+
+// Scheduler runs jobs on their schedules. Runs of a job never overlap;
+// if a run takes longer than the interval to the next one, the runs
+// scheduled in the meantime are skipped.
+type Scheduler struct {
+	// Store persists states of jobs.
+	//
+	// If nil, states are kept in memory.
+	Store Store
+
+	// Location is the time zone of the schedules.
+	//
+	// If nil, time.Local is used.
+	Location *time.Location
+
+	// MaxCatchUp is the maximum number of missed runs made with
+	// the RunAll policy.
+	//
+	// If zero, DefaultMaxCatchUp is used.
+	MaxCatchUp int
+
+	k    *kite.Kite
+	once sync.Once
+	mu   sync.Mutex
+	jobs map[string]*Job
+	wg   sync.WaitGroup
+}
+
+// New gives new scheduler running jobs with the given kite.
+func New(k *kite.Kite) *Scheduler {
+	return &Scheduler{
+		k:    k,
+		jobs: make(map[string]*Job),
+	}
+}
+
+// Add adds the job to the scheduler and starts running it. Fields of
+// the job must not be changed afterwards.
+func (s *Scheduler) Add(job *Job) error {
+	if job.Name == "" {
+		return errors.New("cron: job name is empty")
+	}
+
+	if job.Func == nil && job.Method == "" {
+		return fmt.Errorf("cron: job %q has neither Func nor Method", job.Name)
+	}
+
+	schedule, err := Parse(job.Spec)
+	if err != nil {
+		return err
+	}
+
+	s.once.Do(s.init)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("cron: job %q already exists", job.Name)
+	}
+
+	job.schedule = schedule
+	job.stop = make(chan struct{})
+
+	s.jobs[job.Name] = job
+	s.wg.Add(1)
+
+	go s.run(job)
+
+	return nil
+}
+
+// Remove stops running the job with the given name. The current run,
+// if any, is canceled.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	delete(s.jobs, name)
+	s.mu.Unlock()
+
+	if ok {
+		close(job.stop)
+	}
+}
+
+// Close removes all jobs and waits for their current runs to return.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.jobs = make(map[string]*Job)
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		close(job.stop)
+	}
+
+	s.wg.Wait()
+
+	return nil
+}
+
+func (s *Scheduler) init() {
+	if s.Store == nil {
+		s.Store = NewMemoryStore()
+	}
+
+	if s.Location == nil {
+		s.Location = time.Local
+	}
+
+	if s.MaxCatchUp == 0 {
+		s.MaxCatchUp = DefaultMaxCatchUp
+	}
+}
+
+func (s *Scheduler) run(job *Job) {
+	defer s.wg.Done()
+
+	now := time.Now().In(s.Location)
+
+	for _, t := range s.missed(job, now) {
+		if !s.invoke(job, t) {
+			return
+		}
+	}
+
+	for next := job.schedule.Next(now); !next.IsZero(); {
+		wait := next.Sub(time.Now())
+		if job.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(job.Jitter)))
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-job.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !s.invoke(job, next) {
+			return
+		}
+
+		// skip runs scheduled while the job was running
+		now := time.Now().In(s.Location)
+		if next = job.schedule.Next(next); !next.IsZero() && next.Before(now) {
+			next = job.schedule.Next(now)
+		}
+	}
+}
+
+// missed gives the runs to make for the runs missed since the last one.
+func (s *Scheduler) missed(job *Job, now time.Time) []time.Time {
+	if job.Missed == Skip {
+		return nil
+	}
+
+	state, err := s.Store.Get(job.Name)
+	if err != nil {
+		s.k.Log.Warning("cron: unable to read state of %q job: %s", job.Name, err)
+		return nil
+	}
+
+	if state == nil || state.LastRun.IsZero() {
+		return nil
+	}
+
+	var runs []time.Time
+
+	for t := job.schedule.Next(state.LastRun.In(s.Location)); !t.IsZero() && !t.After(now); t = job.schedule.Next(t) {
+		runs = append(runs, t)
+
+		if len(runs) > s.MaxCatchUp {
+			runs = runs[1:]
+		}
+	}
+
+	if job.Missed == RunOnce && len(runs) > 1 {
+		runs = runs[len(runs)-1:]
+	}
+
+	return runs
+}
+
+// invoke makes the run of the job scheduled at the given time. It
+// returns false if the job was removed.
+func (s *Scheduler) invoke(job *Job, scheduled time.Time) bool {
+	select {
+	case <-job.stop:
+		return false
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-job.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	err := s.call(ctx, job)
+
+	state := &State{
+		LastRun:  scheduled,
+		Duration: time.Since(start),
+	}
+
+	if err != nil {
+		state.Error = err.Error()
+		s.k.Log.Error("cron: %q job failed: %s", job.Name, err)
+	} else {
+		s.k.Log.Debug("cron: %q job finished in %s", job.Name, state.Duration)
+	}
+
+	if err := s.Store.Set(job.Name, state); err != nil {
+		s.k.Log.Warning("cron: unable to save state of %q job: %s", job.Name, err)
+	}
+
+	return true
+}
+
+func (s *Scheduler) call(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+
+	timeout := job.Timeout
+	if timeout == 0 && job.Func == nil && job.Client != nil {
+		timeout = s.k.CallTimeout()
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	switch {
+	case job.Func != nil:
+		return job.Func(ctx)
+	case job.Client != nil:
+		_, err = job.Client.TellWithContext(ctx, job.Method, job.Args...)
+	default:
+		_, err = s.k.Invoke(ctx, job.Method, job.Args...)
+	}
+
+	return err
+}
@@ -0,0 +1,164 @@
+package cron_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/cron"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2017, time.March, 14, 10, 20, 30, 0, time.UTC)
+
+	cases := []struct {
+		spec string
+		want []string
+	}{{
+		"*/15 * * * *",
+		[]string{"2017-03-14 10:30", "2017-03-14 10:45", "2017-03-14 11:00"},
+	}, {
+		"0 9-17/4 * * mon-fri",
+		[]string{"2017-03-14 13:00", "2017-03-14 17:00", "2017-03-15 09:00"},
+	}, {
+		"30 3 1,15 * *",
+		[]string{"2017-03-15 03:30", "2017-04-01 03:30", "2017-04-15 03:30"},
+	}, {
+		"0 0 13 * 5", // Friday or 13th
+		[]string{"2017-03-17 00:00", "2017-03-24 00:00", "2017-03-31 00:00", "2017-04-07 00:00", "2017-04-13 00:00"},
+	}, {
+		"0 12 29 feb 7",
+		[]string{"2018-02-04 12:00"},
+	}, {
+		"@monthly",
+		[]string{"2017-04-01 00:00", "2017-05-01 00:00"},
+	}, {
+		"@every 90m",
+		[]string{"2017-03-14 11:50", "2017-03-14 13:20"},
+	}}
+
+	for _, c := range cases {
+		s, err := cron.Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q)=%s", c.spec, err)
+			continue
+		}
+
+		next := from
+		for _, want := range c.want {
+			next = s.Next(next)
+
+			if got := next.Format("2006-01-02 15:04"); got != want {
+				t.Errorf("%q: got %s, want %s", c.spec, got, want)
+				break
+			}
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every 1ms"} {
+		if _, err := cron.Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+
+	s, _ := cron.Parse("0 0 30 2 *")
+	if next := s.Next(from); !next.IsZero() {
+		t.Errorf("got %s for February 30th", next)
+	}
+}
+
+func TestMissedRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	k := kite.New("cron", "1.0.0")
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+
+	k.HandleFunc("compact", func(r *kite.Request) (interface{}, error) {
+		var job string
+
+		if err := r.Args.One().Unmarshal(&job); err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		runs[job]++
+		mu.Unlock()
+
+		return nil, nil
+	})
+
+	store := &cron.FileStore{Path: filepath.Join(dir, "cron.json")}
+	lastRun := time.Now().Add(-5 * time.Minute).Truncate(time.Minute).Add(30 * time.Second)
+
+	s := cron.New(k)
+	s.Store = store
+	s.MaxCatchUp = 3
+
+	cases := map[string]struct {
+		missed cron.MissedPolicy
+		want   int
+	}{
+		"skip":    {cron.Skip, 0},
+		"runOnce": {cron.RunOnce, 1},
+		"runAll":  {cron.RunAll, 3},
+	}
+
+	for name, c := range cases {
+		if err := store.Set(name, &cron.State{LastRun: lastRun}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := s.Add(&cron.Job{
+			Name:   name,
+			Spec:   "* * * * *",
+			Missed: c.missed,
+			Method: "compact",
+			Args:   []interface{}{name},
+		})
+		if err != nil {
+			t.Fatalf("Add(%q)=%s", name, err)
+		}
+	}
+
+	if err := s.Add(&cron.Job{Name: "skip", Spec: "@daily", Func: func(context.Context) error { return nil }}); err == nil {
+		t.Fatal("expected duplicated job to be rejected")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for name, c := range cases {
+		for {
+			state, err := store.Get(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			n := runs[name]
+			mu.Unlock()
+
+			if n == c.want && (c.want == 0 || state.LastRun.After(lastRun)) {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: got %d runs, want %d", name, n, c.want)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	s.Close()
+}
@@ -0,0 +1,241 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives times of runs of a job.
+type Schedule interface {
+	// Next gives the time of the first run after t.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a cron expression with five fields: minute, hour, day of
+// month, month and day of week. Each field is a "*", a number, a range
+// "a-b" or a comma separated list of them, optionally followed by a step
+// "/n". Months and days of week may be given with their three letter
+// names, Sunday is both 0 and 7. If both day of month and day of week
+// are restricted, a day matching either of them is a match.
+//
+// The following descriptors are accepted too:
+//
+//	@yearly, @annually  0 0 1 1 *
+//	@monthly            0 0 1 * *
+//	@weekly             0 0 * * 0
+//	@daily, @midnight   0 0 * * *
+//	@hourly             0 * * * *
+//	@every <duration>   every duration, e.g. "@every 1h30m"
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %s", err)
+		}
+
+		if d < time.Second {
+			return nil, fmt.Errorf("cron: interval %s is shorter than a second", d)
+		}
+
+		return every(d), nil
+	}
+
+	if s, ok := descriptors[spec]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields in %q, got %d", spec, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], daysOfMonth); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], daysOfWeek); err != nil {
+		return nil, err
+	}
+
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.anyDom = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	s.anyDow = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	return &s, nil
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type bounds struct {
+	name     string
+	min, max int
+	names    []string // names of values starting with min
+}
+
+var (
+	minutes     = bounds{name: "minute", min: 0, max: 59}
+	hours       = bounds{name: "hour", min: 0, max: 23}
+	daysOfMonth = bounds{name: "day of month", min: 1, max: 31}
+	months      = bounds{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	daysOfWeek = bounds{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// parseField parses the field into a set of values, with bit n set
+// for the value n.
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+
+		if i := strings.IndexByte(part, '/'); i != -1 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron: invalid step in %s %q", b.name, part)
+			}
+
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := b.min, b.max
+
+		if part != "*" {
+			var err error
+
+			bounds := strings.SplitN(part, "-", 2)
+
+			if lo, err = b.value(bounds[0]); err != nil {
+				return 0, err
+			}
+
+			hi = lo
+
+			if len(bounds) == 2 {
+				if hi, err = b.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step != 1 {
+				// "n/step" means from n to the maximum
+				hi = b.max
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("cron: invalid range in %s %q", b.name, part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func (b bounds) value(s string) (int, error) {
+	for i, name := range b.names {
+		if strings.EqualFold(s, name) {
+			return b.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < b.min || v > b.max {
+		return 0, fmt.Errorf("cron: invalid %s %q", b.name, s)
+	}
+
+	return v, nil
+}
+
+// cronSchedule is a schedule given by a cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	anyDom, anyDow bool // whether day of month or week is not restricted
+}
+
+// Next implements the Schedule interface. It gives zero time if there
+// is no matching time within five years, e.g. for February 30th.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// every is a schedule of runs in constant intervals.
+type every time.Duration
+
+// Next implements the Schedule interface.
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e)).Truncate(time.Second)
+}
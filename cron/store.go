@@ -0,0 +1,160 @@
+package cron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is the persisted state of a job.
+type State struct {
+	// LastRun is the scheduled time of the last run.
+	LastRun time.Time `json:"lastRun"`
+
+	// Duration is how long the last run took.
+	Duration time.Duration `json:"duration"`
+
+	// Error is the error of the last run, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Store persists states of jobs, so runs missed while the scheduler
+// was not running can be detected after a restart. A store should be
+// safe to concurrent access.
+type Store interface {
+	// Get gives the state of the job with the given name, or nil if
+	// the job has not run yet.
+	Get(job string) (*State, error)
+
+	// Set sets the state of the job with the given name.
+	Set(job string, state *State) error
+}
+
+// MemoryStore is a Store, which keeps states in memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore gives new memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]State),
+	}
+}
+
+// Get implements the Store interface.
+func (m *MemoryStore) Get(job string) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[job]
+	if !ok {
+		return nil, nil
+	}
+
+	return &state, nil
+}
+
+// Set implements the Store interface.
+func (m *MemoryStore) Set(job string, state *State) error {
+	m.mu.Lock()
+	m.states[job] = *state
+	m.mu.Unlock()
+
+	return nil
+}
+
+// FileStore is a Store, which keeps states of all jobs in a JSON file.
+type FileStore struct {
+	// Path is the path of the file.
+	Path string
+
+	mu sync.Mutex
+}
+
+var _ Store = (*FileStore)(nil)
+
+// Get implements the Store interface.
+func (f *FileStore) Get(job string) (*State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok := states[job]
+	if !ok {
+		return nil, nil
+	}
+
+	return state, nil
+}
+
+// Set implements the Store interface.
+func (f *FileStore) Set(job string, state *State) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	states[job] = state
+
+	p, err := json.MarshalIndent(states, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so the file is never left
+	// truncated.
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path))
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(p); err == nil {
+		err = tmp.Sync()
+	}
+
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+func (f *FileStore) read() (map[string]*State, error) {
+	states := make(map[string]*State)
+
+	p, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(p, &states); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
@@ -0,0 +1,187 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDedupTTL is the time a processed message ID is remembered,
+// if Kite.DedupTTL is zero. It should be longer than the time the caller
+// keeps retrying a message.
+var DefaultDedupTTL = 24 * time.Hour
+
+// ErrMessageNotFound is returned by DedupStore.Get when the message
+// was not processed yet.
+var ErrMessageNotFound = errors.New("message not found")
+
+// DedupStore records IDs of processed messages together with their
+// results, so retried messages are acknowledged without running
+// the handler again.
+type DedupStore interface {
+	// Get gives the JSON-encoded result of the processed message with
+	// the given ID. It returns ErrMessageNotFound if the message was not
+	// processed or the record has expired.
+	Get(id string) (json.RawMessage, error)
+
+	// Put records the message as processed, the record expires after ttl.
+	Put(id string, result json.RawMessage, ttl time.Duration) error
+}
+
+type messageIDKey struct{}
+
+// WithMessageID gives a context, which makes calls done with
+// Client.TellWithContext carry the given message ID.
+//
+// If the remote kite has Kite.DedupStore set, a method call with an ID
+// that was already successfully processed is not run again, instead the
+// caller gets the result of the first call. Use it to safely retry
+// calls, which must not be executed twice.
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+func messageIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// dedup runs the method unless the message of the request was already
+// processed. Concurrent duplicates wait for the first one to finish.
+//
+// Only successful results are recorded, so failed messages are run
+// again when retried.
+func (k *Kite) dedup(m *Method, r *Request) (interface{}, error) {
+	// Message IDs are chosen by callers, scope them to the caller
+	// so they cannot collide between different users.
+	id := r.Username + "/" + r.MessageID
+
+	for {
+		if result, err := k.DedupStore.Get(id); err == nil {
+			k.Log.Debug("message %q was already processed, skipping", r.MessageID)
+			return result, nil
+		} else if err != ErrMessageNotFound {
+			return nil, err
+		}
+
+		k.dedupMu.Lock()
+		wait, ok := k.dedupInflight[id]
+		if !ok {
+			k.dedupInflight[id] = make(chan struct{})
+		}
+		k.dedupMu.Unlock()
+
+		if !ok {
+			break
+		}
+
+		select {
+		case <-wait:
+		case <-r.Ctx().Done():
+			return nil, r.Ctx().Err()
+		}
+	}
+
+	defer func() {
+		k.dedupMu.Lock()
+		close(k.dedupInflight[id])
+		delete(k.dedupInflight, id)
+		k.dedupMu.Unlock()
+	}()
+
+	result, err := m.serve(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.DedupStore.Put(id, p, k.dedupTTL()); err != nil {
+		k.Log.Error("unable to record message %q: %s", r.MessageID, err)
+	}
+
+	return result, nil
+}
+
+func (k *Kite) dedupTTL() time.Duration {
+	if k.DedupTTL != 0 {
+		return k.DedupTTL
+	}
+
+	return DefaultDedupTTL
+}
+
+// MemoryDedupStore is an in-memory DedupStore. Records are lost
+// when the kite is restarted.
+type MemoryDedupStore struct {
+	mu        sync.Mutex
+	records   map[string]*dedupRecord
+	lastSweep time.Time
+}
+
+type dedupRecord struct {
+	result  json.RawMessage
+	expires time.Time
+}
+
+var _ DedupStore = (*MemoryDedupStore)(nil)
+
+// NewMemoryDedupStore gives new in-memory dedup store.
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		records: make(map[string]*dedupRecord),
+	}
+}
+
+// Get implements the DedupStore interface.
+func (m *MemoryDedupStore) Get(id string) (json.RawMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[id]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	if time.Now().After(rec.expires) {
+		delete(m.records, id)
+		return nil, ErrMessageNotFound
+	}
+
+	return rec.result, nil
+}
+
+// Put implements the DedupStore interface.
+func (m *MemoryDedupStore) Put(id string, result json.RawMessage, ttl time.Duration) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop expired records, which are not going to be requested again.
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, rec := range m.records {
+			if now.After(rec.expires) {
+				delete(m.records, id)
+			}
+		}
+
+		m.lastSweep = now
+	}
+
+	m.records[id] = &dedupRecord{
+		result:  append(json.RawMessage(nil), result...),
+		expires: now.Add(ttl),
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestDedup(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var calls int
+
+	srv := NewWithConfig("dedup-server", "0.0.1", cfg)
+	srv.DedupStore = NewMemoryDedupStore()
+	srv.HandleFunc("increment", func(r *Request) (interface{}, error) {
+		calls++
+		return calls, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("dedup-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	call := func(ctx context.Context) int {
+		res, err := c.TellWithContext(ctx, "increment")
+		if err != nil {
+			t.Fatalf("TellWithContext()=%s", err)
+		}
+
+		return int(res.MustFloat64())
+	}
+
+	ctx := WithMessageID(context.Background(), "msg1")
+
+	for i := 0; i < 3; i++ {
+		if n := call(ctx); n != 1 {
+			t.Fatalf("%d: got %d, want 1", i, n)
+		}
+	}
+
+	if n := call(WithMessageID(context.Background(), "msg2")); n != 2 {
+		t.Fatalf("got %d, want 2", n)
+	}
+
+	if n := call(context.Background()); n != 3 {
+		t.Fatalf("got %d, want 3", n)
+	}
+
+	if calls != 3 {
+		t.Fatalf("got %d handler calls, want 3", calls)
+	}
+}
@@ -0,0 +1,290 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPushSchedulerClosed is returned by PushScheduler.PushAt when the
+// scheduler was closed.
+var ErrPushSchedulerClosed = errors.New("push scheduler is closed")
+
+// WithDelayedStore sets the store persisting calls made with
+// Client.SendAt and Client.SendAfter, so they are made after restarts
+// of the kite too.
+//
+// By default the calls are kept in memory.
+func WithDelayedStore(store OutboxStore) ClientOption {
+	return func(c *Client) {
+		c.delayedStore = store
+	}
+}
+
+// SendAfter calls the method after the delay elapses. See SendAt.
+func (c *Client) SendAfter(d time.Duration, method string, args ...interface{}) (string, error) {
+	return c.SendAt(time.Now().Add(d), method, args...)
+}
+
+// SendAt calls the method at the given time, e.g. for reminders or
+// deferred commands. It returns the ID of the call, which may be used
+// to cancel it with CancelSend.
+//
+// The call is delivered at least once with an Outbox, which is started
+// on the first call of SendAt, see Outbox.SendAt for details.
+func (c *Client) SendAt(t time.Time, method string, args ...interface{}) (string, error) {
+	return c.delayedOutbox().SendAt(t, method, args...)
+}
+
+// CancelSend cancels the call made with SendAt or SendAfter, which was
+// not delivered yet.
+func (c *Client) CancelSend(id string) error {
+	return c.delayedOutbox().Cancel(id)
+}
+
+func (c *Client) delayedOutbox() *Outbox {
+	c.delayedMu.Lock()
+	defer c.delayedMu.Unlock()
+
+	if c.delayed == nil {
+		store := c.delayedStore
+		if store == nil {
+			store = NewMemoryOutboxStore()
+		}
+
+		c.delayed = NewOutbox(c, store)
+		c.delayed.Start()
+	}
+
+	return c.delayed
+}
+
+// PushScheduler pushes method calls to clients connected to the kite's
+// server at scheduled times, see Kite.Push.
+//
+// The calls are persisted to the Store until they are due, so they are
+// pushed after restarts of the kite too. A call is pushed once, to the
+// connections selected by its query at the time it is due.
+type PushScheduler struct {
+	// Kite pushes the calls.
+	//
+	// Required.
+	Kite *Kite
+
+	// Store persists scheduled calls.
+	//
+	// Required.
+	Store OutboxStore
+
+	// Timeout is the time to wait for the replies of the connections.
+	//
+	// If zero, Kite.Config.Timeout is used.
+	Timeout time.Duration
+
+	// OnPush, when non-nil, is called with the replies of the connections
+	// the call was pushed to.
+	OnPush func(msg *OutboxMessage, results []*PushResult)
+
+	once   sync.Once
+	mu     sync.Mutex
+	closed bool
+	notify chan struct{}
+	closeC chan struct{}
+}
+
+// NewPushScheduler gives new scheduler pushing calls with the given kite.
+func NewPushScheduler(k *Kite, store OutboxStore) *PushScheduler {
+	return &PushScheduler{
+		Kite:  k,
+		Store: store,
+	}
+}
+
+func (s *PushScheduler) init() {
+	s.once.Do(func() {
+		s.notify = make(chan struct{}, 1)
+		s.closeC = make(chan struct{})
+	})
+}
+
+// Start starts pushing scheduled calls, including the ones persisted
+// before the kite was restarted. Calls, which became due in the meantime,
+// are pushed right away.
+func (s *PushScheduler) Start() {
+	s.init()
+
+	go s.run()
+
+	s.wakeup()
+}
+
+// PushAfter pushes the call after the delay elapses. See PushAt.
+func (s *PushScheduler) PushAfter(d time.Duration, q *ConnectionQuery, method string, args ...interface{}) (string, error) {
+	return s.PushAt(time.Now().Add(d), q, method, args...)
+}
+
+// PushAt persists the call and pushes it at the given time to the
+// connections selected by the query. It returns the ID of the call,
+// which may be used to cancel it.
+//
+// The arguments are persisted JSON-encoded, thus they must not contain
+// callbacks.
+func (s *PushScheduler) PushAt(t time.Time, q *ConnectionQuery, method string, args ...interface{}) (string, error) {
+	s.init()
+
+	msg, err := newOutboxMessage(method, args)
+	if err != nil {
+		return "", err
+	}
+
+	if t.After(msg.Created) {
+		msg.NotBefore = t.UTC()
+	}
+
+	if q == nil {
+		q = &ConnectionQuery{}
+	}
+
+	msg.Query = q
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return "", ErrPushSchedulerClosed
+	}
+
+	if err := s.Store.Put(msg); err != nil {
+		return "", err
+	}
+
+	s.wakeup()
+
+	return msg.ID, nil
+}
+
+// Cancel removes the scheduled call with the given ID.
+func (s *PushScheduler) Cancel(id string) error {
+	return s.Store.Delete(id)
+}
+
+// Pending gives the calls, which were not pushed yet, ordered by the time
+// they are due at.
+func (s *PushScheduler) Pending() ([]*OutboxMessage, error) {
+	return pendingMessages(s.Store)
+}
+
+// Close stops pushing the calls. Scheduled calls are kept in the store
+// and are pushed after the scheduler is started again.
+func (s *PushScheduler) Close() {
+	s.init()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.closeC)
+	}
+}
+
+func (s *PushScheduler) wakeup() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *PushScheduler) run() {
+	var timer *time.Timer
+
+	for {
+		var scheduled <-chan time.Time
+		if timer != nil {
+			scheduled = timer.C
+		}
+
+		select {
+		case <-s.closeC:
+			return
+		case <-s.notify:
+		case <-scheduled:
+		}
+
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+
+		next, err := s.flush()
+		if err != nil {
+			s.Kite.Log.Error("push scheduler: %s", err)
+			next = time.Now().Add(DefaultRetryInterval)
+		}
+
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(time.Now()))
+		}
+	}
+}
+
+// flush pushes the calls, which are due. It gives the time the next
+// call is due at.
+func (s *PushScheduler) flush() (time.Time, error) {
+	msgs, err := s.Pending()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, msg := range msgs {
+		select {
+		case <-s.closeC:
+			return time.Time{}, nil
+		default:
+		}
+
+		if due := msg.due(); due.After(time.Now()) {
+			return due, nil
+		}
+
+		// Remove the call first, so it's not pushed twice if the kite
+		// crashes while pushing.
+		if err := s.Store.Delete(msg.ID); err != nil {
+			return time.Time{}, err
+		}
+
+		s.push(msg)
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *PushScheduler) push(msg *OutboxMessage) {
+	args := make([]interface{}, len(msg.Args))
+	for i, arg := range msg.Args {
+		args[i] = arg
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = s.Kite.CallTimeout()
+	}
+
+	ctx, cancel := context.WithTimeout(WithMessageID(context.Background(), msg.ID), timeout)
+	defer cancel()
+
+	q := msg.Query
+	if q == nil {
+		q = &ConnectionQuery{}
+	}
+
+	results := s.Kite.Push(ctx, q, msg.Method, args...)
+
+	if s.OnPush != nil {
+		func() {
+			defer nopRecover()
+			s.OnPush(msg, results)
+		}()
+	}
+}
@@ -0,0 +1,156 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestSendAt(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	delivered := make(chan string, 4)
+
+	srv := NewWithConfig("delayed-server", "0.0.1", cfg)
+	srv.HandleFunc("remind", func(r *Request) (interface{}, error) {
+		delivered <- r.Args.One().MustString()
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("delayed-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+
+	if _, err := c.SendAfter(300*time.Millisecond, "remind", "second"); err != nil {
+		t.Fatalf("SendAfter()=%s", err)
+	}
+
+	if _, err := c.SendAt(start.Add(100*time.Millisecond), "remind", "first"); err != nil {
+		t.Fatalf("SendAt()=%s", err)
+	}
+
+	id, err := c.SendAfter(200*time.Millisecond, "remind", "canceled")
+	if err != nil {
+		t.Fatalf("SendAfter()=%s", err)
+	}
+
+	if err := c.CancelSend(id); err != nil {
+		t.Fatalf("CancelSend()=%s", err)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("got calls delivered after %s, want after 300ms", d)
+	}
+
+	select {
+	case got := <-delivered:
+		t.Fatalf("got unexpected %q call", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestPushScheduler(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("push-scheduler", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("first", "0.0.1")
+	k.HandleFunc("notify", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	// The identity of a connected kite is known after its first call.
+	if _, err := c.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping: %s", err)
+	}
+
+	store := NewMemoryOutboxStore()
+	pushed := make(chan string, 4)
+
+	s := NewPushScheduler(srv, store)
+	s.OnPush = func(msg *OutboxMessage, results []*PushResult) {
+		for _, res := range results {
+			if res.Err != nil {
+				pushed <- res.Err.Error()
+				continue
+			}
+
+			pushed <- res.Result.MustString()
+		}
+	}
+
+	if _, err := s.PushAfter(200*time.Millisecond, &ConnectionQuery{Name: "first"}, "notify", "later"); err != nil {
+		t.Fatalf("PushAfter()=%s", err)
+	}
+
+	// A call persisted before a restart, which is overdue.
+	msg, err := newOutboxMessage("notify", []interface{}{"overdue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.NotBefore = time.Now().Add(-time.Minute)
+	msg.Query = &ConnectionQuery{Name: "first"}
+
+	if err := store.Put(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PushAfter(100*time.Millisecond, &ConnectionQuery{Name: "second"}, "notify", "nobody"); err != nil {
+		t.Fatalf("PushAfter()=%s", err)
+	}
+
+	s.Start()
+	defer s.Close()
+
+	for _, want := range []string{"overdue", "later"} {
+		select {
+		case got := <-pushed:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	pending, err := s.Pending()
+	if err != nil {
+		t.Fatalf("Pending()=%s", err)
+	}
+
+	if len(pending) != 0 {
+		t.Fatalf("got %d pending calls, want 0", len(pending))
+	}
+}
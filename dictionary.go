@@ -0,0 +1,389 @@
+package kite
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultDictionarySize is the size of dictionaries built by
+// TrainDictionary, if size is zero.
+var DefaultDictionarySize = 4 << 10
+
+// maxDictionarySize is the size of the DEFLATE window, the bytes of a
+// dictionary above it are never referenced.
+const maxDictionarySize = 32 << 10
+
+// maxInflatedArgs limits the size of decompressed arguments.
+const maxInflatedArgs = 64 << 20
+
+// ErrDictionaryUnsupported is returned by Client.UseDictionary when the
+// remote kite does not have the dictionary.
+var ErrDictionaryUnsupported = errors.New("remote kite does not have the dictionary")
+
+// Dictionary is a preset DEFLATE dictionary used to compress arguments of
+// calls. Kites exchanging many similar small messages, like metrics or
+// status reports, compress them well with a dictionary built from samples
+// of the messages, even if each message alone is too small to compress.
+type Dictionary struct {
+	// ID identifies the dictionary, it is derived from Data.
+	ID string
+
+	// Data is the content of the dictionary. The most common strings
+	// should come last.
+	Data []byte
+}
+
+// NewDictionary gives a dictionary with the given content.
+func NewDictionary(data []byte) *Dictionary {
+	if len(data) > maxDictionarySize {
+		data = data[len(data)-maxDictionarySize:]
+	}
+
+	sum := sha256.Sum256(data)
+
+	return &Dictionary{
+		ID:   hex.EncodeToString(sum[:8]),
+		Data: data,
+	}
+}
+
+// TrainDictionary builds a dictionary of the given size from samples of
+// messages, e.g. JSON-encoded arguments of calls. Strings common to many
+// of the samples are put in the dictionary, the most common ones last.
+// If size is zero, DefaultDictionarySize is used.
+func TrainDictionary(samples [][]byte, size int) *Dictionary {
+	const n = 8 // length of substrings counted
+
+	if size <= 0 {
+		size = DefaultDictionarySize
+	}
+
+	// Count the number of samples each substring occurs in.
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+n <= len(sample); i++ {
+			s := string(sample[i : i+n])
+			if !seen[s] {
+				seen[s] = true
+				counts[s]++
+			}
+		}
+	}
+
+	type segment struct {
+		s     string
+		count int
+	}
+
+	var segments []segment
+	for s, count := range counts {
+		if count > 1 {
+			segments = append(segments, segment{s, count})
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].count != segments[j].count {
+			return segments[i].count > segments[j].count
+		}
+		return segments[i].s < segments[j].s
+	})
+
+	// Join overlapping substrings back into longer strings, by extending
+	// each selected substring with the ones it overlaps with in samples.
+	var (
+		picked []string
+		total  int
+	)
+
+	for _, seg := range segments {
+		if total >= size {
+			break
+		}
+
+		if containsString(picked, seg.s) {
+			continue
+		}
+
+		s := extendSegment(seg.s, samples, counts, seg.count)
+		picked = append(picked, s)
+		total += len(s)
+	}
+
+	// The most common strings go last, closest to the data compressed.
+	var buf bytes.Buffer
+	for i := len(picked) - 1; i >= 0; i-- {
+		buf.WriteString(picked[i])
+	}
+
+	data := buf.Bytes()
+	if len(data) > size {
+		data = data[len(data)-size:]
+	}
+
+	return NewDictionary(data)
+}
+
+// extendSegment extends the substring to the right in the first sample
+// containing it, for as long as the following substrings are at least
+// as common.
+func extendSegment(s string, samples [][]byte, counts map[string]int, count int) string {
+	const n = 8
+
+	for _, sample := range samples {
+		i := bytes.Index(sample, []byte(s))
+		if i == -1 {
+			continue
+		}
+
+		end := i + len(s)
+		for end < len(sample) && counts[string(sample[end+1-n:end+1])] >= count {
+			end++
+		}
+
+		return string(sample[i:end])
+	}
+
+	return s
+}
+
+// containsString tells whether any of the strings contains s.
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if strings.Contains(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsCallbacks tells whether the encoded arguments have callbacks,
+// which are encoded as "[Function]" strings.
+func containsCallbacks(p []byte) bool {
+	return bytes.Contains(p, []byte(`"[Function]"`))
+}
+
+func (d *Dictionary) compress(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, d.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d *Dictionary) decompress(p []byte) ([]byte, error) {
+	r := flate.NewReaderDict(bytes.NewReader(p), d.Data)
+	defer r.Close()
+
+	inflated, err := ioutil.ReadAll(io.LimitReader(r, maxInflatedArgs+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inflated) > maxInflatedArgs {
+		return nil, errors.New("decompressed arguments are too large")
+	}
+
+	return inflated, nil
+}
+
+// AddDictionary makes the kite accept calls with arguments compressed
+// with the dictionary. The remote kites learn about it with kite.info,
+// see Client.UseDictionary.
+func (k *Kite) AddDictionary(d *Dictionary) {
+	k.dictionariesMu.Lock()
+	defer k.dictionariesMu.Unlock()
+
+	if k.dictionaries == nil {
+		k.dictionaries = make(map[string]*Dictionary)
+	}
+
+	k.dictionaries[d.ID] = d
+}
+
+func (k *Kite) dictionary(id string) *Dictionary {
+	k.dictionariesMu.RLock()
+	defer k.dictionariesMu.RUnlock()
+
+	return k.dictionaries[id]
+}
+
+// dictionaryIDs gives IDs of the dictionaries added with AddDictionary.
+func (k *Kite) dictionaryIDs() []string {
+	k.dictionariesMu.RLock()
+	defer k.dictionariesMu.RUnlock()
+
+	ids := make([]string, 0, len(k.dictionaries))
+	for id := range k.dictionaries {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// dictState is the dictionary used by the client.
+type dictState struct {
+	mu     sync.Mutex
+	want   *Dictionary // set with UseDictionary
+	active *Dictionary // the remote kite has, nil until negotiated
+	once   sync.Once
+}
+
+func (s *dictState) get() *Dictionary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+func (s *dictState) reset() {
+	s.mu.Lock()
+	s.active = nil
+	s.mu.Unlock()
+}
+
+// UseDictionary makes the client compress arguments of calls with the
+// dictionary, if the remote kite has it, see Kite.AddDictionary. It is
+// checked with kite.info after each connect to the remote kite, until
+// then the arguments are sent uncompressed.
+//
+// Arguments with callbacks are never compressed. Neither are the ones,
+// which do not get smaller.
+//
+// If the client is connected, it returns ErrDictionaryUnsupported when
+// the remote kite does not have the dictionary.
+func (c *Client) UseDictionary(d *Dictionary) error {
+	c.dict.mu.Lock()
+	c.dict.want = d
+	c.dict.active = nil
+	c.dict.mu.Unlock()
+
+	c.dict.once.Do(func() {
+		c.OnConnect(func() {
+			if err := c.negotiateDictionary(); err != nil {
+				c.logger().Debug("dictionary: %s", err)
+			}
+		})
+	})
+
+	if c.getSession() == nil {
+		return nil
+	}
+
+	return c.negotiateDictionary()
+}
+
+// negotiateDictionary checks whether the remote kite has the dictionary
+// the client wants to use.
+func (c *Client) negotiateDictionary() error {
+	c.dict.mu.Lock()
+	d := c.dict.want
+	c.dict.mu.Unlock()
+
+	if d == nil {
+		return nil
+	}
+
+	info, err := c.Info()
+	if err != nil {
+		return err
+	}
+
+	if !contains(info.Dictionaries, d.ID) {
+		return ErrDictionaryUnsupported
+	}
+
+	c.dict.mu.Lock()
+	if c.dict.want == d {
+		c.dict.active = d
+	}
+	c.dict.mu.Unlock()
+
+	return nil
+}
+
+// compressArgs replaces the arguments of the wrapped call with their
+// compressed encoding, if the client uses a dictionary.
+func (c *Client) compressArgs(wrapped []interface{}) {
+	d := c.dict.get()
+	if d == nil {
+		return
+	}
+
+	options := wrapped[0].(callOptionsOut)
+
+	p, err := json.Marshal(options.WithArgs)
+	if err != nil || containsCallbacks(p) {
+		return
+	}
+
+	z, err := d.compress(p)
+
+	// The compressed arguments are sent base64-encoded.
+	if err != nil || (len(z)+2)/3*4 >= len(p) {
+		return
+	}
+
+	options.WithArgs = []interface{}{z}
+	options.Dictionary = d.ID
+	wrapped[0] = options
+}
+
+// decompressArgs decompresses the arguments of the request, if they
+// were compressed with a dictionary.
+func (r *Request) decompressArgs() error {
+	id := r.options.Dictionary
+	if id == "" {
+		return nil
+	}
+
+	d := r.LocalKite.dictionary(id)
+	if d == nil {
+		return fmt.Errorf("unknown dictionary %q", id)
+	}
+
+	if r.Args == nil {
+		return errors.New("missing arguments")
+	}
+
+	var z []byte
+	if err := r.Args.One().Unmarshal(&z); err != nil {
+		return err
+	}
+
+	p, err := d.decompress(z)
+	if err != nil {
+		return err
+	}
+
+	r.Args = &dnode.Partial{Raw: p}
+
+	return nil
+}
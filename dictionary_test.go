@@ -0,0 +1,152 @@
+package kite
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+type statusReport struct {
+	Host    string  `json:"host"`
+	Status  string  `json:"status"`
+	CPU     float64 `json:"cpuUsage"`
+	Memory  int     `json:"memoryUsedBytes"`
+	Uptime  int     `json:"uptimeSeconds"`
+	Version string  `json:"agentVersion"`
+}
+
+func statusSamples(n int) [][]byte {
+	var samples [][]byte
+
+	for i := 0; i < n; i++ {
+		p, _ := json.Marshal([]interface{}{&statusReport{
+			Host:    fmt.Sprintf("worker-%d.example.com", i),
+			Status:  "healthy",
+			CPU:     float64(i%100) / 100,
+			Memory:  1000000 + i*4096,
+			Uptime:  3600 + i,
+			Version: "1.2.3",
+		}})
+		samples = append(samples, p)
+	}
+
+	return samples
+}
+
+func deflated(p, dict []byte) int {
+	var buf bytes.Buffer
+
+	w, _ := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+	w.Write(p)
+	w.Close()
+
+	return buf.Len()
+}
+
+func TestTrainDictionary(t *testing.T) {
+	samples := statusSamples(100)
+	d := TrainDictionary(samples, 0)
+
+	if len(d.Data) == 0 || len(d.Data) > DefaultDictionarySize {
+		t.Fatalf("got dictionary of %d bytes", len(d.Data))
+	}
+
+	if d.ID != NewDictionary(d.Data).ID {
+		t.Fatal("want ID derived from the data")
+	}
+
+	p := statusSamples(101)[100]
+
+	if with, without := deflated(p, d.Data), deflated(p, nil); with >= without*2/3 {
+		t.Fatalf("want dictionary to improve compression, got %d bytes with and %d without", with, without)
+	}
+}
+
+func TestUseDictionary(t *testing.T) {
+	d := TrainDictionary(statusSamples(50), 0)
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var (
+		mu         sync.Mutex
+		compressed int
+	)
+
+	srv := NewWithConfig("dict-server", "0.0.1", cfg)
+	srv.AddDictionary(d)
+	srv.UseFrameFunc(func(f *Frame) error {
+		if f.Direction == Incoming && bytes.Contains(f.Data, []byte(`"dictionary":"`+d.ID+`"`)) {
+			mu.Lock()
+			compressed++
+			mu.Unlock()
+		}
+		return nil
+	})
+	srv.HandleFunc("report", func(r *Request) (interface{}, error) {
+		var report statusReport
+		if err := r.Args.One().Unmarshal(&report); err != nil {
+			return nil, err
+		}
+		return report.Host, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("dict-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if err := c.UseDictionary(d); err != nil {
+		t.Fatalf("UseDictionary()=%s", err)
+	}
+
+	report := &statusReport{Host: "worker-7.example.com", Status: "healthy", Version: "1.2.3"}
+
+	result, err := c.TellWithTimeout("report", 4*time.Second, report)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != report.Host {
+		t.Fatalf("got %q, want %q", got, report.Host)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if compressed != 1 {
+		t.Fatalf("got %d compressed calls, want 1", compressed)
+	}
+}
+
+func TestUseDictionaryUnsupported(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("dict-server", "0.0.1", cfg)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("dict-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	err := c.UseDictionary(NewDictionary([]byte(strings.Repeat("status", 10))))
+	if err != ErrDictionaryUnsupported {
+		t.Fatalf("got %v, want %v", err, ErrDictionaryUnsupported)
+	}
+}
@@ -0,0 +1,139 @@
+package kite
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// discoveryCache keeps getKites results, see Kite.DiscoveryCacheTTL.
+type discoveryCache struct {
+	mu       sync.Mutex
+	entries  map[protocol.KontrolQuery]*discoveryEntry
+	watching bool // whether the kite watches Kontrol for changes
+}
+
+type discoveryEntry struct {
+	kites   []*protocol.KiteWithToken
+	expires time.Time
+}
+
+// registryEvent is a change of the registry Kontrol notifies watching
+// kites about.
+type registryEvent struct {
+	Type string        `json:"type"`
+	Kite protocol.Kite `json:"kite"`
+}
+
+// cachedKites gives the kites matching the query, cached for
+// DiscoveryCacheTTL.
+func (k *Kite) cachedKites(args protocol.GetKitesArgs) ([]*protocol.KiteWithToken, error) {
+	if k.DiscoveryCacheTTL <= 0 || args.Query == nil || args.WatchCallback.Caller != nil || len(args.Who) != 0 {
+		return k.queryKites(args)
+	}
+
+	cache := &k.kontrol.cache
+	query := *args.Query
+
+	cache.mu.Lock()
+	e, ok := cache.entries[query]
+	cache.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.kites, nil
+	}
+
+	kites, err := k.queryKites(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	if cache.entries == nil {
+		cache.entries = make(map[protocol.KontrolQuery]*discoveryEntry)
+	}
+	cache.entries[query] = &discoveryEntry{
+		kites:   kites,
+		expires: time.Now().Add(k.DiscoveryCacheTTL),
+	}
+	watching := cache.watching
+	cache.watching = true
+	cache.mu.Unlock()
+
+	if !watching {
+		go k.watchKites()
+	}
+
+	return kites, nil
+}
+
+// watchKites subscribes for changes of the registry, which invalidate
+// the cached results. The cache is flushed after each reconnect to
+// Kontrol, as changes might have been missed meanwhile.
+func (k *Kite) watchKites() {
+	k.kontrol.OnInvalidate(k.kontrol.cache.flush)
+
+	_, err := k.kontrol.Subscribe("watchKites", dnode.Callback(func(p *dnode.Partial) {
+		var ev registryEvent
+
+		if err := p.One().Unmarshal(&ev); err != nil {
+			k.Log.Debug("Invalid registry event: %s", err)
+			return
+		}
+
+		k.kontrol.cache.invalidate(&ev.Kite)
+	}))
+
+	if err != nil {
+		// Kontrol may not support watching, the results expire
+		// after DiscoveryCacheTTL only.
+		k.Log.Debug("Unable to watch Kontrol for changes: %s", err)
+	}
+}
+
+// invalidate removes the cached results of queries matching the kite.
+func (c *discoveryCache) invalidate(kite *protocol.Kite) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for query := range c.entries {
+		if queryMatches(&query, kite) {
+			delete(c.entries, query)
+		}
+	}
+}
+
+// flush removes all of the cached results.
+func (c *discoveryCache) flush() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// queryMatches tells whether the kite may be returned for the query.
+// Version constraints are assumed to match any version.
+func queryMatches(q *protocol.KontrolQuery, kite *protocol.Kite) bool {
+	fields := [][2]string{
+		{q.Username, kite.Username},
+		{q.Environment, kite.Environment},
+		{q.Name, kite.Name},
+		{q.Region, kite.Region},
+		{q.Hostname, kite.Hostname},
+		{q.ID, kite.ID},
+	}
+
+	if !strings.ContainsAny(q.Version, "<>=~!, ") {
+		fields = append(fields, [2]string{q.Version, kite.Version})
+	}
+
+	for _, f := range fields {
+		if f[0] != "" && f[0] != f[1] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,128 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+func TestQueryMatches(t *testing.T) {
+	kite := &protocol.Kite{
+		Username:    "alice",
+		Environment: "production",
+		Name:        "math",
+		Version:     "1.0.0",
+		Region:      "eu",
+	}
+
+	cases := map[protocol.KontrolQuery]bool{
+		{Username: "alice", Name: "math"}:                    true,
+		{Username: "alice", Name: "math", Version: "1.0.0"}:  true,
+		{Username: "alice", Name: "math", Version: ">= 2.0"}: true,
+		{Username: "alice", Name: "math", Version: "2.0.0"}:  false,
+		{Username: "alice", Name: "math", Region: "us"}:      false,
+		{Username: "bob", Name: "math"}:                      false,
+		{Username: "alice", Environment: "production"}:       true,
+	}
+
+	for q, want := range cases {
+		q := q
+		if got := queryMatches(&q, kite); got != want {
+			t.Errorf("%+v: got %t, want %t", q, got, want)
+		}
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var (
+		queries int32
+		mu      sync.Mutex
+		watcher dnode.Function
+		watched = make(chan struct{})
+	)
+
+	kontrol := NewWithConfig("kontrol", "0.0.1", cfg)
+	kontrol.HandleFunc("getKites", func(r *Request) (interface{}, error) {
+		atomic.AddInt32(&queries, 1)
+
+		return &protocol.GetKitesResult{
+			Kites: []*protocol.KiteWithToken{{
+				Kite: protocol.Kite{Username: "alice", Name: "math", ID: "1"},
+				URL:  "http://localhost:5000/kite",
+			}},
+		}, nil
+	})
+	kontrol.HandleFunc("watchKites", func(r *Request) (interface{}, error) {
+		mu.Lock()
+		watcher = r.Args.One().MustFunction()
+		mu.Unlock()
+
+		close(watched)
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(kontrol)
+	defer ts.Close()
+
+	k := New("discovery", "0.0.1")
+	k.Config.KontrolURL = fmt.Sprintf("%s/kite", ts.URL)
+	k.DiscoveryCacheTTL = time.Minute
+	defer k.Close()
+
+	query := &protocol.KontrolQuery{Username: "alice", Name: "math"}
+
+	getKites := func(want int32) {
+		clients, err := k.GetKites(query)
+		if err != nil {
+			t.Fatalf("GetKites()=%s", err)
+		}
+
+		Close(clients)
+
+		if n := atomic.LoadInt32(&queries); n != want {
+			t.Fatalf("got %d queries, want %d", n, want)
+		}
+	}
+
+	getKites(1)
+	getKites(1)
+
+	select {
+	case <-watched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watchKites")
+	}
+
+	mu.Lock()
+	fn := watcher
+	mu.Unlock()
+
+	// Events of kites not matching the query keep the results cached.
+	if err := fn.Call(&registryEvent{Type: "register", Kite: protocol.Kite{Username: "alice", Name: "chat"}}); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	if err := fn.Call(&registryEvent{Type: "register", Kite: protocol.Kite{Username: "alice", Name: "math", ID: "2"}}); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	// Wait for the event to be processed.
+	if _, err := k.kontrol.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping: %s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	getKites(2)
+	getKites(2)
+}
@@ -48,9 +48,16 @@ func Callback(f func(*Partial)) Function {
 
 type callback func(*Partial)
 
+// Call calls the function directly, with the arguments passed without
+// being encoded, see Partial.Value. It happens when the function is
+// passed to a handler of the same kite, e.g. by kite.Kite.CallLocal.
 func (f callback) Call(args ...interface{}) error {
-	// Callback is only for sending functions to the remote side
-	panic("you cannot call your own callback method")
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	f(&Partial{Value: args})
+	return nil
 }
 
 // functionReceived is a type implementing caller interface.
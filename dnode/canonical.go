@@ -0,0 +1,122 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Canonicalize gives a stable encoding of the message, which does not
+// depend on the formatting of the message on the wire: object keys are
+// sorted, insignificant whitespace is removed and numbers are normalized,
+// so 1, 1.0 and 1e0 are encoded the same. Numbers other than integers
+// fitting in int64 are normalized with float64 precision. Messages
+// without callbacks are encoded with an empty callbacks object.
+//
+// It is meant for comparing messages, e.g. when signing, deduplicating
+// or checking them against golden files, not for sending them.
+func Canonicalize(msg *Message) ([]byte, error) {
+	args := json.RawMessage("null")
+	if msg.Arguments != nil && len(msg.Arguments.Raw) != 0 {
+		args = msg.Arguments.Raw
+	}
+
+	callbacks := msg.Callbacks
+	if callbacks == nil {
+		callbacks = map[string]Path{}
+	}
+
+	p, err := json.Marshal(struct {
+		Method    interface{}     `json:"method"`
+		Arguments json.RawMessage `json:"arguments"`
+		Callbacks map[string]Path `json:"callbacks"`
+	}{msg.Method, args, callbacks})
+	if err != nil {
+		return nil, err
+	}
+
+	return CanonicalJSON(p)
+}
+
+// CanonicalJSON re-encodes the JSON value p the same way Canonicalize
+// encodes messages.
+func CanonicalJSON(p []byte) ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	v, err := normalizeNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// normalizeNumbers replaces numbers within v with their canonical
+// representation.
+func normalizeNumbers(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return normalizeNumber(v)
+	case []interface{}:
+		for i := range v {
+			n, err := normalizeNumbers(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+	case map[string]interface{}:
+		for k := range v {
+			n, err := normalizeNumbers(v[k])
+			if err != nil {
+				return nil, err
+			}
+			v[k] = n
+		}
+	}
+
+	return v, nil
+}
+
+// normalizeNumber formats the number like JavaScript does: integers
+// without a fraction or an exponent, other numbers in the shortest
+// form, with an exponent only if they are very small or very large.
+func normalizeNumber(n json.Number) (json.Number, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return "", err
+	}
+
+	if f == 0 {
+		return "0", nil // including -0
+	}
+
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	}
+
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+
+	// Go pads the exponent to two digits, JavaScript does not.
+	s = strings.Replace(s, "e-0", "e-", 1)
+	s = strings.Replace(s, "e+0", "e+", 1)
+
+	return json.Number(s), nil
+}
@@ -0,0 +1,39 @@
+package dnode
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	want := `{"arguments":[{"a":[1,0.5,1e+21,1e-7],"b":true}],"callbacks":{"0":["0","cb"]},"method":"square"}`
+
+	msgs := []*Message{{
+		Method:    "square",
+		Arguments: &Partial{Raw: []byte(`[{"b": true, "a": [1, 0.5, 1e21, 0.0000001]}]`)},
+		Callbacks: map[string]Path{"0": {"0", "cb"}},
+	}, {
+		Method:    "square",
+		Arguments: &Partial{Raw: []byte("[ {\n\"a\":[1.0,5e-1,1000000000000000000000,1E-7],\"b\":true} ]")},
+		Callbacks: map[string]Path{"0": {"0", "cb"}},
+	}}
+
+	for i, msg := range msgs {
+		p, err := Canonicalize(msg)
+		if err != nil {
+			t.Fatalf("%d: Canonicalize()=%s", i, err)
+		}
+
+		if string(p) != want {
+			t.Errorf("%d: got %s, want %s", i, p, want)
+		}
+	}
+}
+
+func TestCanonicalizeEmpty(t *testing.T) {
+	p, err := Canonicalize(&Message{Method: float64(2)})
+	if err != nil {
+		t.Fatalf("Canonicalize()=%s", err)
+	}
+
+	if want := `{"arguments":null,"callbacks":{},"method":2}`; string(p) != want {
+		t.Errorf("got %s, want %s", p, want)
+	}
+}
@@ -0,0 +1,128 @@
+package dnode
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ProtocolError describes how a message deviates from the dnode protocol,
+// see CheckMessage.
+type ProtocolError struct {
+	// Field is the path of the offending field, e.g. "callbacks.3".
+	Field string
+
+	// Reason describes the deviation.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ProtocolError) Error() string {
+	return "dnode: " + e.Field + ": " + e.Reason
+}
+
+// messageFields are the top-level fields of a dnode message. The "links"
+// field is defined by the protocol, though kites never send it.
+var messageFields = map[string]bool{
+	"method":    true,
+	"arguments": true,
+	"callbacks": true,
+	"links":     true,
+}
+
+// CheckMessage tells whether the decoded message conforms to the dnode
+// protocol. Unlike decoding it into Message, which ignores unknown and
+// missing fields, it requires:
+//
+//   - no top-level fields other than method, arguments, callbacks and links
+//   - method to be a non-empty string or a callback ID
+//   - arguments to be an array
+//   - callbacks to be an object mapping callback IDs to paths, which
+//     start with an index of the arguments
+//   - links, if present, to be an array
+func CheckMessage(msg map[string]interface{}) error {
+	for field := range msg {
+		if !messageFields[field] {
+			return &ProtocolError{Field: field, Reason: "unknown field"}
+		}
+	}
+
+	switch method := msg["method"].(type) {
+	case nil:
+		return &ProtocolError{Field: "method", Reason: "missing field"}
+	case string:
+		if method == "" {
+			return &ProtocolError{Field: "method", Reason: "empty method name"}
+		}
+	default:
+		if _, ok := (Path{method}).Index(0); !ok {
+			return &ProtocolError{Field: "method", Reason: typeReason("string or callback ID", method)}
+		}
+	}
+
+	args, ok := msg["arguments"].([]interface{})
+	if !ok {
+		return &ProtocolError{Field: "arguments", Reason: typeReason("array", msg["arguments"])}
+	}
+
+	callbacks, ok := msg["callbacks"].(map[string]interface{})
+	if !ok {
+		return &ProtocolError{Field: "callbacks", Reason: typeReason("object", msg["callbacks"])}
+	}
+
+	for id, v := range callbacks {
+		field := "callbacks." + id
+
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return &ProtocolError{Field: field, Reason: "callback ID expected"}
+		}
+
+		elems, ok := v.([]interface{})
+		if !ok || len(elems) == 0 {
+			return &ProtocolError{Field: field, Reason: typeReason("non-empty path", v)}
+		}
+
+		path := Path(elems)
+
+		if err := path.Validate(); err != nil {
+			return &ProtocolError{Field: field, Reason: err.Error()}
+		}
+
+		if i, ok := path.Index(0); !ok || i >= len(args) {
+			return &ProtocolError{Field: field, Reason: "path does not start with an index of the arguments"}
+		}
+	}
+
+	if links, ok := msg["links"]; ok {
+		if _, ok := links.([]interface{}); !ok {
+			return &ProtocolError{Field: "links", Reason: typeReason("array", links)}
+		}
+	}
+
+	return nil
+}
+
+func typeReason(want string, got interface{}) string {
+	if got == nil {
+		return "missing " + want
+	}
+
+	return fmt.Sprintf("%s expected, got %s", want, jsonType(got))
+}
+
+// jsonType gives the name of the JSON type of the decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case float64, int, int64, uint64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,45 @@
+package dnode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckMessage(t *testing.T) {
+	cases := map[string]string{
+		`{"method":"square","arguments":[2,{}],"callbacks":{"0":["1","cb"]}}`: "",
+		`{"method":3,"arguments":[],"callbacks":{},"links":[]}`:               "",
+		`{"method":"square","arguments":[],"callbacks":{},"extra":1}`:         "extra",
+		`{"arguments":[],"callbacks":{}}`:                                     "method",
+		`{"method":"","arguments":[],"callbacks":{}}`:                         "method",
+		`{"method":1.5,"arguments":[],"callbacks":{}}`:                        "method",
+		`{"method":"square","arguments":{},"callbacks":{}}`:                   "arguments",
+		`{"method":"square","arguments":[]}`:                                  "callbacks",
+		`{"method":"square","arguments":[],"callbacks":{"x":[0]}}`:            "callbacks.x",
+		`{"method":"square","arguments":[],"callbacks":{"0":[]}}`:             "callbacks.0",
+		`{"method":"square","arguments":[{}],"callbacks":{"0":[1]}}`:          "callbacks.0",
+		`{"method":"square","arguments":[{}],"callbacks":{"0":[0,true]}}`:     "callbacks.0",
+		`{"method":"square","arguments":[],"callbacks":{},"links":{}}`:        "links",
+	}
+
+	for data, field := range cases {
+		var msg map[string]interface{}
+
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("%s: Unmarshal()=%s", data, err)
+		}
+
+		err := CheckMessage(msg)
+
+		if field == "" {
+			if err != nil {
+				t.Errorf("%s: CheckMessage()=%s", data, err)
+			}
+			continue
+		}
+
+		if e, ok := err.(*ProtocolError); !ok || e.Field != field {
+			t.Errorf("%s: got %v, want error of %q field", data, err, field)
+		}
+	}
+}
@@ -11,10 +11,33 @@ import (
 type Partial struct {
 	Raw           []byte
 	CallbackSpecs []CallbackSpec
+
+	// Strict, when true, makes Unmarshal fail with a *FieldError when
+	// the data has fields, which v does not have, or values of other
+	// types than fields of v. Partials given by Slice, Map and their
+	// variants inherit it.
+	Strict bool
+
+	// Meta holds data attached to the Partial by the code producing it,
+	// e.g. metadata of the response a result was received with. It is
+	// neither marshaled nor inherited by Partials given by Slice, Map
+	// and their variants.
+	Meta interface{}
+
+	// Value holds the data as Go values, when it is passed without being
+	// encoded, e.g. by kite.Kite.CallLocal. It is used only if Raw is nil.
+	// Unmarshal assigns Value to v, if it is assignable, and decodes its
+	// encoding otherwise. Partials given by Slice and Map hold the values
+	// of the elements.
+	Value interface{}
 }
 
 // MarshalJSON returns the raw bytes of the Partial.
 func (p *Partial) MarshalJSON() ([]byte, error) {
+	if p.Raw == nil && p.Value != nil {
+		return json.Marshal(p.Value)
+	}
+
 	return p.Raw, nil
 }
 
@@ -36,6 +59,16 @@ func (p *Partial) Unmarshal(v interface{}) error {
 		return fmt.Errorf("Cannot unmarshal nil argument")
 	}
 
+	if p.Raw == nil && p.Value != nil {
+		return p.unmarshalValue(v)
+	}
+
+	if p.Strict {
+		if err := checkStrict(p.Raw, v); err != nil {
+			return err
+		}
+	}
+
 	if err := json.Unmarshal(p.Raw, &v); err != nil {
 		return fmt.Errorf("%s. Data: %s", err.Error(), string(p.Raw))
 	}
@@ -51,6 +84,36 @@ func (p *Partial) Unmarshal(v interface{}) error {
 	return nil
 }
 
+// unmarshalValue assigns p.Value to v, or decodes its encoding into v,
+// if the types do not match.
+func (p *Partial) unmarshalValue(v interface{}) error {
+	value := reflect.ValueOf(p.Value)
+	ptr := reflect.ValueOf(v)
+
+	if ptr.Kind() == reflect.Ptr && !ptr.IsNil() && value.Type().AssignableTo(ptr.Elem().Type()) {
+		ptr.Elem().Set(value)
+		return nil
+	}
+
+	raw, err := json.Marshal(p.Value)
+	if err != nil {
+		return err
+	}
+
+	return (&Partial{Raw: raw, Strict: p.Strict}).Unmarshal(v)
+}
+
+// elem gives a Partial holding the value of an element of p.Value.
+func (p *Partial) elem(v reflect.Value) *Partial {
+	e := &Partial{Value: v.Interface(), Strict: p.Strict}
+
+	if e.Value == nil {
+		e.Raw = []byte("null")
+	}
+
+	return e
+}
+
 func (p *Partial) MustUnmarshal(v interface{}) {
 	err := p.Unmarshal(v)
 	checkError(err)
@@ -62,13 +125,28 @@ func (p *Partial) MustUnmarshal(v interface{}) {
 
 // Slice is a helper method to unmarshal a JSON Array.
 func (p *Partial) Slice() (a []*Partial, err error) {
+	if p != nil && p.Raw == nil && p.Value != nil {
+		if v := reflect.ValueOf(p.Value); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			a = make([]*Partial, v.Len())
+			for i := range a {
+				a[i] = p.elem(v.Index(i))
+			}
+			return a, nil
+		}
+	}
+
 	err = p.Unmarshal(&a)
+	for _, e := range a {
+		if e != nil {
+			e.Strict = p.Strict
+		}
+	}
 	return
 }
 
 // SliceOfLength is a helper method to unmarshal a JSON Array with specified length.
 func (p *Partial) SliceOfLength(length int) (a []*Partial, err error) {
-	err = p.Unmarshal(&a)
+	a, err = p.Slice()
 	if err != nil {
 		return
 	}
@@ -82,7 +160,22 @@ func (p *Partial) SliceOfLength(length int) (a []*Partial, err error) {
 
 // Map is a helper method to unmarshal to a JSON Object.
 func (p *Partial) Map() (m map[string]*Partial, err error) {
+	if p != nil && p.Raw == nil && p.Value != nil {
+		if v := reflect.ValueOf(p.Value); v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+			m = make(map[string]*Partial, v.Len())
+			for _, key := range v.MapKeys() {
+				m[key.String()] = p.elem(v.MapIndex(key))
+			}
+			return m, nil
+		}
+	}
+
 	err = p.Unmarshal(&m)
+	for _, e := range m {
+		if e != nil {
+			e.Strict = p.Strict
+		}
+	}
 	return
 }
 
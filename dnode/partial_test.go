@@ -19,3 +19,103 @@ func TestUnmarshalArguments(t *testing.T) {
 		return
 	}
 }
+
+func TestUnmarshalStrict(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+
+	type user struct {
+		Name      string            `json:"name"`
+		Age       uint8             `json:"age"`
+		ID        int64             `json:"id,string"`
+		Addresses []address         `json:"addresses"`
+		Labels    map[string]string `json:"labels"`
+		Callback  Function          `json:"callback"`
+		Extra     *Partial          `json:"extra"`
+	}
+
+	tests := []struct {
+		raw  string
+		path string
+	}{
+		{`{"name":"bob","age":42,"id":"7","addresses":[{"city":"Oslo"}],"callback":"[Function]","extra":{"any":1}}`, ""},
+		{`{"Name":"bob"}`, ""},
+		{`{"nmae":"bob"}`, "nmae"},
+		{`{"age":"42"}`, "age"},
+		{`{"age":300}`, "age"},
+		{`{"age":-1}`, "age"},
+		{`{"addresses":[{"city":"Oslo"},{"town":"Bergen"}]}`, "addresses[1].town"},
+		{`{"labels":{"env":1}}`, "labels.env"},
+		{`["bob"]`, ""},
+	}
+
+	for _, test := range tests {
+		var u user
+
+		p := &Partial{Raw: []byte(test.raw), Strict: true}
+		err := p.Unmarshal(&u)
+
+		if test.path == "" && test.raw[0] == '{' {
+			if err != nil {
+				t.Errorf("%s: Unmarshal()=%s", test.raw, err)
+			}
+			continue
+		}
+
+		e, ok := err.(*FieldError)
+		if !ok {
+			t.Errorf("%s: got %v, want *FieldError", test.raw, err)
+			continue
+		}
+
+		if e.Path != test.path {
+			t.Errorf("%s: got %q path, want %q", test.raw, e.Path, test.path)
+		}
+	}
+
+	var s string
+
+	args := &Partial{Raw: []byte(`[{"name":"bob"}]`), Strict: true}
+	if err := args.One().Unmarshal(&s); err == nil {
+		t.Fatal("want error for object unmarshaled into string")
+	}
+
+	args.Strict = false
+	if err := args.One().Unmarshal(&struct{}{}); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+}
+
+func TestUnmarshalValue(t *testing.T) {
+	type point struct{ X, Y int }
+
+	p := &Partial{Value: []interface{}{&point{1, 2}, map[string]int{"n": 3}, nil}}
+
+	args := p.MustSliceOfLength(3)
+
+	var pt *point
+	args[0].MustUnmarshal(&pt)
+	if pt != p.Value.([]interface{})[0] {
+		t.Fatalf("got %v, want the value assigned", pt)
+	}
+
+	if n := args[1].MustMap()["n"].MustFloat64(); n != 3 {
+		t.Fatalf("got %v, want 3", n)
+	}
+
+	var v point
+	args[0].MustUnmarshal(&v)
+	if v != (point{1, 2}) {
+		t.Fatalf("got %+v, want the value decoded", v)
+	}
+
+	if err := args[2].Unmarshal(&pt); err != nil || pt != nil {
+		t.Fatalf("got %v, %v, want nil", pt, err)
+	}
+
+	raw, err := p.MarshalJSON()
+	if err != nil || string(raw) != `[{"X":1,"Y":2},{"n":3},null]` {
+		t.Fatalf("got %s, %v", raw, err)
+	}
+}
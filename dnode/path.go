@@ -0,0 +1,208 @@
+package dnode
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NewPath gives a path of the given elements. Elements must be strings,
+// for object keys, or non-negative integers, for array indexes.
+func NewPath(elems ...interface{}) (Path, error) {
+	p := Path(elems)
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ParsePath parses the path in the dot notation, as given by Path.String,
+// e.g. "0.options.onData". Elements consisting of digits only are array
+// indexes. Keys containing dots cannot be expressed in the dot notation.
+func ParsePath(s string) (Path, error) {
+	if s == "" {
+		return Path{}, nil
+	}
+
+	elems := strings.Split(s, ".")
+	p := make(Path, len(elems))
+
+	for i, elem := range elems {
+		if elem == "" {
+			return nil, fmt.Errorf("dnode: empty element in path %q", s)
+		}
+
+		p[i] = elem
+
+		if n, ok := p.Index(i); ok {
+			p[i] = n
+		}
+	}
+
+	return p, nil
+}
+
+// Validate checks that elements of the path are strings or non-negative
+// integers. Elements decoded from JSON messages are float64 values.
+func (p Path) Validate() error {
+	for i := range p {
+		if _, ok := p.Index(i); ok {
+			continue
+		}
+
+		if _, ok := p[i].(string); !ok {
+			return fmt.Errorf("dnode: invalid element %#v at %d in path", p[i], i)
+		}
+	}
+
+	return nil
+}
+
+// Index gives the i-th element of the path as an array index. It returns
+// false if the element is not a non-negative integer. Strings of digits,
+// as sent by some dnode implementations, are indexes as well.
+func (p Path) Index(i int) (int, bool) {
+	switch v := p[i].(type) {
+	case int:
+		return v, v >= 0
+	case int64:
+		return int(v), v >= 0 && v <= math.MaxInt32
+	case uint64:
+		return int(v), v <= math.MaxInt32
+	case float64:
+		if v >= 0 && v == math.Trunc(v) && v <= math.MaxInt32 {
+			return int(v), true
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && strconv.Itoa(n) == v {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+// Key gives the i-th element of the path as an object key. Indexes are
+// formatted in decimal.
+func (p Path) Key(i int) string {
+	if n, ok := p.Index(i); ok {
+		return strconv.Itoa(n)
+	}
+
+	return fmt.Sprint(p[i])
+}
+
+// String gives the path in the dot notation, see ParsePath.
+func (p Path) String() string {
+	keys := make([]string, len(p))
+
+	for i := range p {
+		keys[i] = p.Key(i)
+	}
+
+	return strings.Join(keys, ".")
+}
+
+// Append gives a copy of the path with the elements appended.
+func (p Path) Append(elems ...interface{}) Path {
+	q := make(Path, 0, len(p)+len(elems))
+	q = append(q, p...)
+	return append(q, elems...)
+}
+
+// Equal tells whether the paths point at the same value. Indexes are
+// equal regardless of their types, e.g. 1 and float64(1).
+func (p Path) Equal(q Path) bool {
+	return len(p) == len(q) && p.HasPrefix(q)
+}
+
+// HasPrefix tells whether the path starts with the prefix.
+func (p Path) HasPrefix(prefix Path) bool {
+	if len(prefix) > len(p) {
+		return false
+	}
+
+	for i := range prefix {
+		if p.Key(i) != prefix.Key(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get gives the value at the path within the Partial, e.g. to forward
+// a part of the arguments. Callbacks within the value are kept, with
+// their paths relative to the value.
+func (p *Partial) Get(path Path) (*Partial, error) {
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+
+	cur := p
+
+	for i := range path {
+		if cur == nil {
+			return nil, fmt.Errorf("dnode: no value at %s", path[:i])
+		}
+
+		var next *Partial
+
+		switch raw := bytes.TrimSpace(cur.Raw); {
+		case len(raw) != 0 && raw[0] == '[':
+			index, ok := path.Index(i)
+			if !ok {
+				return nil, fmt.Errorf("dnode: array index expected at %s", path[:i+1])
+			}
+
+			a, err := cur.Slice()
+			if err != nil {
+				return nil, err
+			}
+
+			if index >= len(a) {
+				return nil, fmt.Errorf("dnode: index out of range at %s", path[:i+1])
+			}
+
+			next = a[index]
+		case len(raw) != 0 && raw[0] == '{':
+			m, err := cur.Map()
+			if err != nil {
+				return nil, err
+			}
+
+			v, ok := m[path.Key(i)]
+			if !ok {
+				return nil, fmt.Errorf("dnode: no value at %s", path[:i+1])
+			}
+
+			next = v
+		default:
+			return nil, fmt.Errorf("dnode: cannot traverse %s at %s", raw, path[:i+1])
+		}
+
+		cur = next
+	}
+
+	if cur == nil {
+		return nil, fmt.Errorf("dnode: no value at %s", path)
+	}
+
+	return cur, nil
+}
+
+// Callback gives the callback received at the path within the Partial.
+// The returned Function is not valid, if there is no such callback.
+func (p *Partial) Callback(path Path) Function {
+	for _, spec := range p.CallbackSpecs {
+		if spec.Path.Equal(path) {
+			return spec.Function
+		}
+	}
+
+	return Function{}
+}
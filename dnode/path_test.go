@@ -0,0 +1,95 @@
+package dnode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	p, err := ParsePath("0.options.onData")
+	if err != nil {
+		t.Fatalf("ParsePath()=%s", err)
+	}
+
+	if want := (Path{0, "options", "onData"}); !p.Equal(want) {
+		t.Fatalf("got %v, want %v", p, want)
+	}
+
+	if !p.Equal(Path{float64(0), "options", "onData"}) {
+		t.Fatal("want indexes of different types to be equal")
+	}
+
+	if s := p.String(); s != "0.options.onData" {
+		t.Fatalf("got %q, want %q", s, "0.options.onData")
+	}
+
+	if !p.HasPrefix(Path{"0", "options"}) || p.HasPrefix(Path{1}) {
+		t.Fatal("unexpected HasPrefix result")
+	}
+
+	if _, err := ParsePath("0..onData"); err == nil {
+		t.Fatal("want error for empty element")
+	}
+
+	if _, err := NewPath(0, -1); err == nil {
+		t.Fatal("want error for negative index")
+	}
+
+	if _, err := NewPath(0, 1.5); err == nil {
+		t.Fatal("want error for fractional index")
+	}
+}
+
+func TestPartialGet(t *testing.T) {
+	var msg Message
+
+	data := `{
+		"method": "watch",
+		"arguments": [{"path": "/tmp", "options": {"recursive": true, "onData": "[Function]"}}],
+		"callbacks": {"7": ["0", "options", "onData"]}
+	}`
+
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	var called uint64
+	err := ParseCallbacks(&msg, func(id uint64, args []interface{}) error {
+		called = id
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ParseCallbacks()=%s", err)
+	}
+
+	if fn := msg.Arguments.Callback(Path{0, "options", "onData"}); !fn.IsValid() {
+		t.Fatal("want callback at 0.options.onData")
+	}
+
+	opts, err := msg.Arguments.Get(Path{"0", "options"})
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	var v struct {
+		Recursive bool `json:"recursive"`
+	}
+
+	if err := opts.Unmarshal(&v); err != nil || !v.Recursive {
+		t.Fatalf("got %+v (%v), want recursive options", v, err)
+	}
+
+	if err := opts.Callback(Path{"onData"}).Call("event"); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	if called != 7 {
+		t.Fatalf("got callback %d called, want 7", called)
+	}
+
+	for _, path := range []Path{{1}, {"x"}, {0, "missing"}, {0, "path", "x"}} {
+		if _, err := msg.Arguments.Get(path); err == nil {
+			t.Errorf("%s: want error", path)
+		}
+	}
+}
@@ -128,11 +128,17 @@ func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]P
 	// subtract one to start counting from zero. This is not absolutely
 	// necessary, just cosmetics.
 	next := atomic.AddUint64(&s.seq, 1) - 1
+	for s.Skip != nil && s.Skip(next) {
+		next = atomic.AddUint64(&s.seq, 1) - 1
+	}
 	seq := strconv.FormatUint(next, 10)
 
 	// save in scubber callbacks.
 	s.Lock()
 	s.callbacks[next] = cb
+	if s.traces != nil {
+		s.traces[next] = newCallbackTrace(next)
+	}
 	s.Unlock()
 
 	// Add to callback map to be sent to remote. Make a copy of path because it
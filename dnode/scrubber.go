@@ -10,6 +10,13 @@ type Scrubber struct {
 	// Reference to sent callbacks are saved in this map.
 	sync.Mutex // protects
 	callbacks  map[uint64]func(*Partial)
+
+	// traces of registered callbacks, if tracking is enabled
+	traces map[uint64]*CallbackTrace
+
+	// Skip, when non-nil, tells which IDs must not be given to callbacks,
+	// e.g. because they identify methods called with numeric IDs.
+	Skip func(id uint64) bool
 }
 
 // New returns a pointer to a new Scrubber.
@@ -24,12 +31,16 @@ func NewScrubber() *Scrubber {
 func (s *Scrubber) RemoveCallback(id uint64) {
 	s.Lock()
 	delete(s.callbacks, id)
+	delete(s.traces, id)
 	s.Unlock()
 }
 
 func (s *Scrubber) GetCallback(id uint64) func(*Partial) {
 	s.Lock()
 	fn := s.callbacks[id]
+	if t, ok := s.traces[id]; ok {
+		t.Called = true
+	}
 	s.Unlock()
 	return fn
 }
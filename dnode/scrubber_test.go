@@ -1,6 +1,10 @@
 package dnode
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestScrubUnscrub(t *testing.T) {
 	scrubber := NewScrubber()
@@ -48,3 +52,37 @@ func TestScrubUnscrub(t *testing.T) {
 		t.Error("callback is not called")
 	}
 }
+
+func TestScrubberStale(t *testing.T) {
+	scrubber := NewScrubber()
+
+	obj := []interface{}{Callback(func(*Partial) {})}
+
+	scrubber.Scrub(obj)
+
+	if stale := scrubber.Stale(time.Now().Add(time.Hour)); stale != nil {
+		t.Fatalf("got %d stale callbacks without tracking, want none", len(stale))
+	}
+
+	scrubber.Track()
+
+	scrubber.Scrub(obj) // id 1
+	scrubber.Scrub(obj) // id 2
+	scrubber.Scrub(obj) // id 3
+
+	scrubber.GetCallback(1)
+	scrubber.RemoveCallback(2)
+
+	stale := scrubber.Stale(time.Now().Add(time.Hour))
+	if len(stale) != 1 || stale[0].ID != 3 {
+		t.Fatalf("got %+v, want callback 3", stale)
+	}
+
+	if stack := stale[0].Stack(); !strings.Contains(stack, "TestScrubberStale") {
+		t.Fatalf("got stack %q, want the caller of Scrub", stack)
+	}
+
+	if stale := scrubber.Stale(time.Now().Add(-time.Hour)); len(stale) != 0 {
+		t.Fatalf("got %d callbacks, want none registered before", len(stale))
+	}
+}
@@ -0,0 +1,262 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError is returned by Partial.Unmarshal in strict mode, when the
+// data has a field, which the value does not have, or a value of other
+// type than the field.
+type FieldError struct {
+	// Path of the field, like "user.emails[1]". It is empty for the
+	// value itself.
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+
+	return e.Path + ": " + e.Message
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// checkStrict checks whether the JSON data matches the type of v.
+func checkStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return err
+	}
+
+	return checkValue(value, reflect.TypeOf(v), "")
+}
+
+func checkValue(value interface{}, t reflect.Type, path string) error {
+	if value == nil || t == nil {
+		return nil
+	}
+
+	for t.Kind() == reflect.Ptr {
+		if t.Implements(unmarshalerType) {
+			return nil
+		}
+		t = t.Elem()
+	}
+
+	// Types decoding themselves, like Partial, Function or time.Time,
+	// are not checked.
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	if _, ok := value.(string); ok && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(value, t, path)
+		}
+
+		fields := structFields(t)
+
+		for key, v := range m {
+			f, ok := fields.lookup(key)
+			if !ok {
+				return &FieldError{Path: join(path, key), Message: "unknown field"}
+			}
+
+			if f.quoted {
+				if _, ok := v.(string); ok {
+					continue
+				}
+			}
+
+			if err := checkValue(v, f.typ, join(path, key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(value, t, path)
+		}
+
+		for key, v := range m {
+			if err := checkValue(v, t.Elem(), join(path, key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Slice, reflect.Array:
+		if _, ok := value.(string); ok && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return nil // base64-encoded []byte
+		}
+
+		a, ok := value.([]interface{})
+		if !ok {
+			return mismatch(value, t, path)
+		}
+
+		for i, v := range a {
+			if err := checkValue(v, t.Elem(), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return mismatch(value, t, path)
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return mismatch(value, t, path)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(json.Number)
+		if !ok {
+			return mismatch(value, t, path)
+		}
+
+		if _, err := strconv.ParseInt(n.String(), 10, t.Bits()); err != nil {
+			return &FieldError{Path: path, Message: fmt.Sprintf("number %s does not fit %s", n, t)}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := value.(json.Number)
+		if !ok {
+			return mismatch(value, t, path)
+		}
+
+		if _, err := strconv.ParseUint(n.String(), 10, t.Bits()); err != nil {
+			return &FieldError{Path: path, Message: fmt.Sprintf("number %s does not fit %s", n, t)}
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			return mismatch(value, t, path)
+		}
+	}
+
+	return nil
+}
+
+func mismatch(value interface{}, t reflect.Type, path string) error {
+	var got string
+
+	switch value.(type) {
+	case map[string]interface{}:
+		got = "object"
+	case []interface{}:
+		got = "array"
+	case string:
+		got = "string"
+	case bool:
+		got = "boolean"
+	case json.Number:
+		got = "number"
+	}
+
+	return &FieldError{Path: path, Message: fmt.Sprintf("cannot use %s as %s", got, t)}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+type field struct {
+	typ    reflect.Type
+	quoted bool // has the ",string" option
+}
+
+type fields map[string]field
+
+// lookup finds the field of the key, preferring an exact match like
+// encoding/json does.
+func (fs fields) lookup(key string) (field, bool) {
+	if f, ok := fs[key]; ok {
+		return f, true
+	}
+
+	for name, f := range fs {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+// structFields gives the fields of the struct type by their JSON names,
+// including fields promoted from embedded structs.
+func structFields(t reflect.Type) fields {
+	fs := make(fields)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for name, f := range structFields(ft) {
+				if _, ok := fs[name]; !ok {
+					fs[name] = f
+				}
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fs[name] = field{
+			typ:    sf.Type,
+			quoted: strings.Contains(","+opts+",", ",string,"),
+		}
+	}
+
+	return fs
+}
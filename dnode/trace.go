@@ -0,0 +1,81 @@
+package dnode
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CallbackTrace describes where and when a callback was registered,
+// see Scrubber.Track.
+type CallbackTrace struct {
+	ID         uint64
+	Registered time.Time
+	Called     bool // whether the remote side called the callback
+
+	pc []uintptr
+}
+
+func newCallbackTrace(id uint64) *CallbackTrace {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+
+	return &CallbackTrace{
+		ID:         id,
+		Registered: time.Now(),
+		pc:         pc[:n],
+	}
+}
+
+// Stack gives the stack trace of the registration, without frames
+// of this package.
+func (t *CallbackTrace) Stack() string {
+	var buf bytes.Buffer
+
+	frames := runtime.CallersFrames(t.pc)
+	for {
+		f, more := frames.Next()
+
+		internal := strings.HasPrefix(f.Function, "github.com/koding/kite/dnode.") && !strings.HasSuffix(f.File, "_test.go")
+
+		if !internal {
+			fmt.Fprintf(&buf, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return buf.String()
+}
+
+// Track enables recording stack traces of registered callbacks, which
+// is useful for finding callbacks that are never called nor removed.
+func (s *Scrubber) Track() {
+	s.Lock()
+	if s.traces == nil {
+		s.traces = make(map[uint64]*CallbackTrace)
+	}
+	s.Unlock()
+}
+
+// Stale gives traces of callbacks registered earlier than the given
+// time, which were not called nor removed yet. It returns nil if
+// tracking is not enabled.
+func (s *Scrubber) Stale(before time.Time) []*CallbackTrace {
+	s.Lock()
+	defer s.Unlock()
+
+	var stale []*CallbackTrace
+	for _, t := range s.traces {
+		if !t.Called && t.Registered.Before(before) {
+			c := *t
+			stale = append(stale, &c)
+		}
+	}
+
+	return stale
+}
@@ -0,0 +1,198 @@
+package kite
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+// DefaultElectionTTL is the time a leader holds the lease of an
+// election without renewing it, if the ttl passed to Elect is zero.
+var DefaultElectionTTL = 15 * time.Second
+
+// Election elects a single leader among kites of the same username,
+// environment and name, e.g. to run singleton duties like cron jobs
+// or compactions on one instance of a service only.
+//
+// The leader holds a lease kept by Kontrol in its storage and renews it
+// every third of the TTL. If the lease cannot be renewed, e.g. because
+// Kontrol is not reachable, the kite steps down before the lease
+// expires, so other kite can take it over.
+type Election struct {
+	Name string
+	TTL  time.Duration
+
+	k *Kite
+
+	mu       sync.Mutex
+	leader   string    // ID of the kite holding the lease
+	expires  time.Time // time our lease expires, if we are the leader
+	handlers []func(leader bool)
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Elect starts campaigning in the election with the given name. The
+// kite must register to Kontrol to become the leader. Use OnChange
+// to get notified when the kite becomes or stops being the leader.
+//
+// If ttl is zero, DefaultElectionTTL is used.
+func (k *Kite) Elect(name string, ttl time.Duration) *Election {
+	if ttl == 0 {
+		ttl = DefaultElectionTTL
+	}
+
+	e := &Election{
+		Name:   name,
+		TTL:    ttl,
+		k:      k,
+		closeC: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+// IsLeader tells whether the kite is the leader of the election.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader == e.k.Id
+}
+
+// Leader gives ID of the kite, which is the leader of the election,
+// or empty string if the leader is not known.
+func (e *Election) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader
+}
+
+// OnChange registers a callback which is called when the kite becomes
+// or stops being the leader. If the kite is the leader already, the
+// callback is called right away.
+func (e *Election) OnChange(handler func(leader bool)) {
+	e.mu.Lock()
+	e.handlers = append(e.handlers, handler)
+	leader := e.leader == e.k.Id
+	e.mu.Unlock()
+
+	if leader {
+		e.callHandlers([]func(bool){handler}, true)
+	}
+}
+
+// Close stops campaigning in the election and releases the lease,
+// if the kite is the leader.
+func (e *Election) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.closeC)
+	})
+
+	<-e.done
+
+	return nil
+}
+
+func (e *Election) run() {
+	defer close(e.done)
+
+	interval := e.TTL / 3
+
+	for {
+		e.campaign()
+
+		select {
+		case <-e.closeC:
+			e.resign()
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// campaign acquires or renews the lease.
+func (e *Election) campaign() {
+	start := time.Now()
+
+	args := &protocol.LeaseArgs{
+		Name: e.Name,
+		TTL:  e.TTL,
+	}
+
+	result, err := e.k.TellKontrolWithTimeout("kontrol.acquireLease", e.k.CallTimeout(), args)
+	if err == nil {
+		var lease protocol.Lease
+
+		if err = result.Unmarshal(&lease); err == nil {
+			e.setLeader(lease.Holder, start.Add(e.TTL))
+			return
+		}
+	}
+
+	e.k.Log.Warning("unable to acquire lease of %q election: %s", e.Name, err)
+
+	e.mu.Lock()
+	leader, expires := e.leader, e.expires
+	e.mu.Unlock()
+
+	// step down if the lease would expire before the next renewal
+	if leader == e.k.Id && time.Now().Add(e.TTL/3).After(expires) {
+		e.setLeader("", time.Time{})
+	}
+}
+
+// resign releases the lease if the kite is the leader.
+func (e *Election) resign() {
+	if !e.IsLeader() {
+		return
+	}
+
+	args := &protocol.LeaseArgs{
+		Name: e.Name,
+	}
+
+	if _, err := e.k.TellKontrolWithTimeout("kontrol.releaseLease", e.k.CallTimeout(), args); err != nil {
+		e.k.Log.Warning("unable to release lease of %q election: %s", e.Name, err)
+	}
+
+	e.setLeader("", time.Time{})
+}
+
+func (e *Election) setLeader(id string, expires time.Time) {
+	e.mu.Lock()
+	was := e.leader == e.k.Id
+	e.leader = id
+	e.expires = expires
+	is := e.leader == e.k.Id
+	handlers := e.handlers
+	e.mu.Unlock()
+
+	if was == is {
+		return
+	}
+
+	if is {
+		e.k.Log.Info("Became the leader of %q election", e.Name)
+	} else {
+		e.k.Log.Info("Stopped being the leader of %q election", e.Name)
+	}
+
+	e.callHandlers(handlers, is)
+}
+
+func (e *Election) callHandlers(handlers []func(bool), leader bool) {
+	for _, handler := range handlers {
+		func() {
+			defer nopRecover()
+			handler(leader)
+		}()
+	}
+}
@@ -0,0 +1,140 @@
+package kite
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/koding/kite/dnode"
+)
+
+// Encryption describes how arguments of a call are encrypted end-to-end.
+// The arguments are sealed with AES-GCM, using the name of the method as
+// additional data, so they cannot be replayed to other methods.
+type Encryption struct {
+	// KeyID identifies the key shared by the kites, see AddEncryptionKey.
+	KeyID string `json:"keyId"`
+
+	// Nonce is the nonce the arguments were sealed with.
+	Nonce []byte `json:"nonce"`
+}
+
+// AddEncryptionKey adds the AES key shared with remote kites, which is
+// used to encrypt arguments of calls end-to-end, see PayloadPolicy.
+// The key must be 16, 24 or 32 bytes long.
+//
+// Calls are encrypted with the key identified by Kite.EncryptionKeyID,
+// received calls may be encrypted with any of the added keys.
+func (k *Kite) AddEncryptionKey(keyID string, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.policyMu.Lock()
+	defer k.policyMu.Unlock()
+
+	if k.encryptionKeys == nil {
+		k.encryptionKeys = make(map[string]cipher.AEAD)
+	}
+
+	k.encryptionKeys[keyID] = aead
+
+	return nil
+}
+
+// RemoveEncryptionKey removes the key added with AddEncryptionKey.
+func (k *Kite) RemoveEncryptionKey(keyID string) {
+	k.policyMu.Lock()
+	defer k.policyMu.Unlock()
+
+	delete(k.encryptionKeys, keyID)
+}
+
+func (k *Kite) encryptionKey(keyID string) cipher.AEAD {
+	k.policyMu.RLock()
+	defer k.policyMu.RUnlock()
+
+	return k.encryptionKeys[keyID]
+}
+
+// encryptArgs replaces the arguments of the wrapped call with their
+// encrypted encoding.
+func (c *Client) encryptArgs(method string, wrapped []interface{}) error {
+	keyID := c.LocalKite.EncryptionKeyID
+
+	aead := c.LocalKite.encryptionKey(keyID)
+	if aead == nil {
+		return fmt.Errorf("unknown encryption key %q", keyID)
+	}
+
+	options := wrapped[0].(callOptionsOut)
+
+	p, err := json.Marshal(options.WithArgs)
+	if err != nil {
+		return err
+	}
+
+	if containsCallbacks(p) {
+		return errors.New("arguments with callbacks cannot be encrypted")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	options.WithArgs = []interface{}{aead.Seal(nil, nonce, p, []byte(method))}
+	options.Encryption = &Encryption{
+		KeyID: keyID,
+		Nonce: nonce,
+	}
+	wrapped[0] = options
+
+	return nil
+}
+
+// decryptArgs decrypts the arguments of the request, if they were
+// encrypted.
+func (r *Request) decryptArgs() error {
+	enc := r.options.Encryption
+	if enc == nil {
+		return nil
+	}
+
+	aead := r.LocalKite.encryptionKey(enc.KeyID)
+	if aead == nil {
+		return fmt.Errorf("unknown encryption key %q", enc.KeyID)
+	}
+
+	if r.Args == nil {
+		return errors.New("missing arguments")
+	}
+
+	var sealed []byte
+	if err := r.Args.One().Unmarshal(&sealed); err != nil {
+		return err
+	}
+
+	if len(enc.Nonce) != aead.NonceSize() {
+		return errors.New("invalid nonce")
+	}
+
+	p, err := aead.Open(nil, enc.Nonce, sealed, []byte(r.Method))
+	if err != nil {
+		return err
+	}
+
+	r.Args = &dnode.Partial{Raw: p}
+	r.Encrypted = true
+
+	return nil
+}
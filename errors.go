@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kiteerr"
 )
 
 // ErrKeyNotTrusted is returned by verify functions when the key
@@ -13,16 +14,59 @@ var ErrKeyNotTrusted = errors.New("kontrol key is not trusted")
 
 // Error is the type of the kite related errors returned from kite package.
 type Error struct {
-	Type      string `json:"type"`
-	Message   string `json:"message"`
-	CodeVal   string `json:"code"`
-	RequestID string `json:"id"`
+	Type      string                 `json:"type"`
+	Message   string                 `json:"message"`
+	CodeVal   string                 `json:"code"`
+	RequestID string                 `json:"id"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+
+	// RetryAfter is the time in milliseconds the caller should wait
+	// before retrying the call, see RetryAfter. Zero means no hint.
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+
+	// RateLimit and RateLimitRemaining describe the request limit,
+	// which was exceeded: the number of requests allowed and the number
+	// of requests left.
+	RateLimit          int64 `json:"rateLimit,omitempty"`
+	RateLimitRemaining int64 `json:"rateLimitRemaining,omitempty"`
 }
 
 func (e Error) Code() string {
 	return e.CodeVal
 }
 
+// errorTypeCodes maps types of errors created by kites to canonical codes.
+var errorTypeCodes = map[string]kiteerr.Code{
+	"timeout":             kiteerr.Timeout,
+	"authenticationError": kiteerr.Unauthorized,
+	"policyError":         kiteerr.Unauthorized,
+	"methodNotFound":      kiteerr.NotFound,
+	"sendError":           kiteerr.Unavailable,
+	"requestLimitError":   kiteerr.Unavailable,
+	"quotaExceeded":       kiteerr.Unavailable,
+	"overloaded":          kiteerr.Unavailable,
+}
+
+// ErrorCode gives the canonical code of the error, see kiteerr package.
+func (e Error) ErrorCode() kiteerr.Code {
+	if e.CodeVal != "" {
+		return kiteerr.Code(e.CodeVal)
+	}
+
+	return errorTypeCodes[e.Type]
+}
+
+// ErrorDetails gives the details of the error, see kiteerr package.
+func (e Error) ErrorDetails() map[string]interface{} {
+	return e.Details
+}
+
+// Is tells whether the target is a kiteerr sentinel error with the
+// same code, so the error can be matched with errors.Is.
+func (e Error) Is(target error) bool {
+	return kiteerr.Matches(target, e.ErrorCode())
+}
+
 func (e Error) Error() string {
 	s := e.Message
 
@@ -52,6 +96,16 @@ func createError(req *Request, r interface{}) *Error {
 			Type:    "argumentError",
 			Message: err.Error(),
 		}
+	case error:
+		if e := kiteerr.Find(err); e != nil {
+			kiteErr = newCodeError(e)
+			break
+		}
+
+		kiteErr = &Error{
+			Type:    "genericError",
+			Message: err.Error(),
+		}
 	default:
 		kiteErr = &Error{
 			Type:    "genericError",
@@ -65,3 +119,19 @@ func createError(req *Request, r interface{}) *Error {
 
 	return kiteErr
 }
+
+// newCodeError gives the error sent over the wire for the kiteerr error.
+// The wrapped error is not sent.
+func newCodeError(err *kiteerr.Error) *Error {
+	msg := err.Message
+	if msg == "" {
+		msg = string(err.Code)
+	}
+
+	return &Error{
+		Type:    "genericError",
+		Message: msg,
+		CodeVal: string(err.Code),
+		Details: err.Details,
+	}
+}
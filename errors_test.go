@@ -0,0 +1,60 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kiteerr"
+)
+
+func TestKiteErr(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("errors-server", "0.0.1", cfg)
+	srv.HandleFunc("user.get", func(r *Request) (interface{}, error) {
+		cause := errors.New("sql: no rows in result set")
+		return nil, kiteerr.Wrap(cause, kiteerr.NotFound, "no such user").(*kiteerr.Error).WithDetail("user", "alice")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("errors-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	_, err := c.TellWithTimeout("user.get", 4*time.Second)
+	if err == nil {
+		t.Fatal("want user.get to fail")
+	}
+
+	if !kiteerr.Is(err, kiteerr.NotFound) {
+		t.Fatalf("got %#v, want notFound error", err)
+	}
+
+	kerr := err.(*Error)
+
+	if kerr.Message != "no such user" {
+		t.Fatalf("got %q, want the wrapped error not to be sent", kerr.Message)
+	}
+
+	if !kerr.Is(kiteerr.ErrNotFound) {
+		t.Fatal("want error to match kiteerr.ErrNotFound")
+	}
+
+	if d := kiteerr.DetailsOf(err); d["user"] != "alice" {
+		t.Fatalf("got %v, want user detail", d)
+	}
+
+	_, err = c.TellWithTimeout("user.delete", 4*time.Second)
+	if !kiteerr.Is(err, kiteerr.NotFound) {
+		t.Fatalf("got %#v, want notFound error for unknown method", err)
+	}
+}
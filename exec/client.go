@@ -0,0 +1,154 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Cmd is a command run on a remote kite.
+type Cmd struct {
+	// Args holds the command name and its arguments.
+	//
+	// Required.
+	Args []string
+
+	// Env holds variables added to the environment of the command.
+	Env map[string]string
+
+	// Dir is the working directory of the command.
+	//
+	// If empty, the default directory of the remote kite is used.
+	Dir string
+
+	// Timeout is the time after which the command is killed.
+	//
+	// If zero, the timeout of the remote kite is used.
+	Timeout time.Duration
+
+	// Stdin, when non-nil, is copied to the standard input of the command.
+	Stdin io.Reader
+
+	// Stdout and Stderr, when non-nil, receive the output of the command.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	c  *kite.Client
+	id string
+}
+
+// Run runs the command on the remote kite the client is connected to,
+// and waits for it to exit. The command is killed when the ctx is done.
+//
+// The returned error is non-nil if the command could not be started or
+// the ctx is done; a command exiting with non-zero code is described
+// by the Status.
+func (cmd *Cmd) Run(ctx context.Context, c *kite.Client) (*Status, error) {
+	exit := make(chan *Status, 1)
+
+	args := &startArgs{
+		Args:    cmd.Args,
+		Env:     cmd.Env,
+		Dir:     cmd.Dir,
+		Timeout: int64(cmd.Timeout / time.Millisecond),
+		Stdin:   cmd.Stdin != nil,
+		Stdout:  output(c, cmd.Stdout),
+		Stderr:  output(c, cmd.Stderr),
+		Exit: dnode.Callback(func(p *dnode.Partial) {
+			var status Status
+			if err := p.One().Unmarshal(&status); err != nil {
+				status = Status{ExitCode: -1, Error: err.Error()}
+			}
+			exit <- &status
+		}),
+	}
+
+	res, err := c.Tell("exec.start", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var r startResult
+	if err := res.Unmarshal(&r); err != nil {
+		return nil, err
+	}
+
+	cmd.c = c
+	cmd.id = r.ID
+
+	if cmd.Stdin != nil {
+		go cmd.copyStdin()
+	}
+
+	select {
+	case status := <-exit:
+		return status, nil
+	case <-ctx.Done():
+		if err := cmd.Kill(); err != nil {
+			c.LocalKite.Log.Debug("exec: unable to kill %q: %s", cmd.Args[0], err)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Kill kills the command started with Run.
+func (cmd *Cmd) Kill() error {
+	if cmd.c == nil {
+		return errors.New("exec: command is not started")
+	}
+
+	_, err := cmd.c.Tell("exec.kill", &killArgs{ID: cmd.id})
+	return err
+}
+
+// copyStdin forwards Stdin to the command, closing its standard input
+// once Stdin is exhausted.
+func (cmd *Cmd) copyStdin() {
+	p := make([]byte, 32*1024)
+
+	var seq int64
+
+	for {
+		n, err := cmd.Stdin.Read(p)
+		if n == 0 && err == nil {
+			continue
+		}
+
+		args := &inputArgs{
+			ID:    cmd.id,
+			Seq:   seq,
+			Data:  p[:n],
+			Close: err != nil,
+		}
+		seq++
+
+		if _, e := cmd.c.Tell("exec.input", args); e != nil {
+			cmd.c.LocalKite.Log.Debug("exec: unable to forward stdin: %s", e)
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func output(c *kite.Client, w io.Writer) dnode.Function {
+	if w == nil {
+		return dnode.Function{}
+	}
+
+	return dnode.Callback(func(p *dnode.Partial) {
+		var data []byte
+		if err := p.One().Unmarshal(&data); err != nil {
+			c.LocalKite.Log.Warning("exec: invalid output: %s", err)
+			return
+		}
+
+		w.Write(data)
+	})
+}
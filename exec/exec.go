@@ -0,0 +1,97 @@
+// Package exec runs commands on remote kites.
+//
+// Output of the command is streamed to the caller as it is produced,
+// separately for stdout and stderr, and its input may be forwarded
+// from the caller. Only commands listed in the allowlist of the server
+// may be run.
+//
+// Server:
+//
+//	k := kite.New("exec", "1.0.0")
+//	s := exec.NewServer(k)
+//	s.Commands = []string{"git", "make"}
+//	k.Run()
+//
+// Client:
+//
+//	cmd := &exec.Cmd{
+//	    Args:    []string{"make", "test"},
+//	    Dir:     "/src/project",
+//	    Timeout: 10 * time.Minute,
+//	    Stdout:  os.Stdout,
+//	    Stderr:  os.Stderr,
+//	}
+//
+//	status, err := cmd.Run(ctx, c)
+package exec
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultTimeout is the time after which a command is killed, if neither
+// the caller nor Server.Timeout limit it.
+var DefaultTimeout = time.Minute
+
+var (
+	// ErrNotAllowed is returned for commands, which are not in the
+	// allowlist of the server.
+	ErrNotAllowed = errors.New("command is not allowed")
+
+	// ErrProcessNotFound is returned for calls to a process, which
+	// does not exist or was started by other user.
+	ErrProcessNotFound = errors.New("process not found")
+)
+
+// Status describes how a command exited.
+type Status struct {
+	// ExitCode is the exit code of the command, or -1 if it was
+	// terminated by a signal or did not start.
+	ExitCode int `json:"exitCode"`
+
+	// Signal is the name of the signal, which terminated the command.
+	Signal string `json:"signal,omitempty"`
+
+	// TimedOut is true when the command was killed after its timeout.
+	TimedOut bool `json:"timedOut,omitempty"`
+
+	// Error describes why the command failed to run, if it did.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the time the command was running.
+	Duration time.Duration `json:"duration"`
+}
+
+// Success tells whether the command exited with zero exit code.
+func (s *Status) Success() bool {
+	return s.ExitCode == 0 && s.Error == ""
+}
+
+type startArgs struct {
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+	Timeout int64             `json:"timeout,omitempty"` // in milliseconds
+	Stdin   bool              `json:"stdin,omitempty"`
+	Stdout  dnode.Function    `json:"stdout"`
+	Stderr  dnode.Function    `json:"stderr"`
+	Exit    dnode.Function    `json:"exit"`
+}
+
+type startResult struct {
+	ID string `json:"id"`
+}
+
+type inputArgs struct {
+	ID    string `json:"id"`
+	Seq   int64  `json:"seq"`
+	Data  []byte `json:"data,omitempty"`
+	Close bool   `json:"close,omitempty"`
+}
+
+type killArgs struct {
+	ID string `json:"id"`
+}
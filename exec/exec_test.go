@@ -0,0 +1,109 @@
+package exec_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/exec"
+)
+
+func TestExec(t *testing.T) {
+	k := kite.New("exec", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv := exec.NewServer(k)
+	srv.Commands = []string{"sh", "cat", "sleep"}
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := kite.New("exec-client", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	dir, err := ioutil.TempDir("", "kite-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		cmd    *exec.Cmd
+		stdout string
+		stderr string
+		status exec.Status
+	}{
+		"exit code": {
+			cmd:    &exec.Cmd{Args: []string{"sh", "-c", "echo out; echo err >&2; exit 3"}},
+			stdout: "out\n",
+			stderr: "err\n",
+			status: exec.Status{ExitCode: 3},
+		},
+		"env and dir": {
+			cmd: &exec.Cmd{
+				Args: []string{"sh", "-c", "echo $FOO; pwd"},
+				Env:  map[string]string{"FOO": "bar"},
+				Dir:  dir,
+			},
+			stdout: "bar\n" + dir + "\n",
+		},
+		"stdin": {
+			cmd:    &exec.Cmd{Args: []string{"cat"}, Stdin: strings.NewReader("hello")},
+			stdout: "hello",
+		},
+		"timeout": {
+			cmd:    &exec.Cmd{Args: []string{"sleep", "5"}, Timeout: 200 * time.Millisecond},
+			status: exec.Status{ExitCode: -1, Signal: "killed", TimedOut: true},
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cas.cmd.Stdout = &stdout
+			cas.cmd.Stderr = &stderr
+
+			status, err := cas.cmd.Run(context.Background(), c)
+			if err != nil {
+				t.Fatalf("Run()=%s", err)
+			}
+
+			status.Duration = 0
+
+			if *status != cas.status {
+				t.Fatalf("got %+v, want %+v", status, cas.status)
+			}
+
+			if stdout.String() != cas.stdout {
+				t.Fatalf("got stdout %q, want %q", stdout.String(), cas.stdout)
+			}
+
+			if stderr.String() != cas.stderr {
+				t.Fatalf("got stderr %q, want %q", stderr.String(), cas.stderr)
+			}
+		})
+	}
+
+	cmd := &exec.Cmd{Args: []string{"rm", "-rf", dir}}
+
+	_, err = cmd.Run(context.Background(), c)
+	if e, ok := err.(*kite.Error); !ok || e.Message != exec.ErrNotAllowed.Error() {
+		t.Fatalf("got %v, want %v", err, exec.ErrNotAllowed)
+	}
+}
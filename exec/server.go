@@ -0,0 +1,333 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	osexec "os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// Server runs commands for remote kites. It serves the following
+// methods of the kite:
+//
+//	exec.start - starts a command, streaming its output to callbacks
+//	exec.input - writes to stdin of a command, or closes it
+//	exec.kill  - kills a command
+type Server struct {
+	// Commands is the allowlist of commands, which may be run. A command
+	// is allowed if it resolves to the same executable as one of the
+	// listed names or paths.
+	//
+	// If empty, no command may be run.
+	Commands []string
+
+	// Env is the environment commands are run with. Variables passed by
+	// the caller are added to it.
+	//
+	// If nil, the environment of the kite is used.
+	Env []string
+
+	// Dir is the working directory of commands, for which the caller
+	// did not set one.
+	//
+	// If empty, the working directory of the kite is used.
+	Dir string
+
+	// Timeout is the maximum time a command may run. Callers may set
+	// shorter timeouts.
+	//
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	k     *kite.Kite
+	mu    sync.Mutex
+	procs map[string]*process
+}
+
+type process struct {
+	id     string
+	owner  string
+	cmd    *osexec.Cmd
+	cancel context.CancelFunc
+
+	mu      sync.Mutex           // protects stdin state
+	stdin   io.WriteCloser       // nil if not requested or closed
+	nextSeq int64                // sequence number of the next input
+	pending map[int64]*inputArgs // input received out of order
+}
+
+// NewServer gives new server running commands with the given kite.
+func NewServer(k *kite.Kite) *Server {
+	s := &Server{
+		k:     k,
+		procs: make(map[string]*process),
+	}
+
+	k.HandleFunc("exec.start", s.handleStart)
+	k.HandleFunc("exec.input", s.handleInput)
+	k.HandleFunc("exec.kill", s.handleKill)
+
+	return s
+}
+
+func (s *Server) handleStart(r *kite.Request) (interface{}, error) {
+	var args startArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if len(args.Args) == 0 {
+		return nil, errors.New("command is empty")
+	}
+
+	if !s.allowed(args.Args[0]) {
+		return nil, ErrNotAllowed
+	}
+
+	timeout := s.timeout()
+	if t := time.Duration(args.Timeout) * time.Millisecond; t > 0 && t < timeout {
+		timeout = t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	cmd := osexec.CommandContext(ctx, args.Args[0], args.Args[1:]...)
+	cmd.Env = s.env(args.Env)
+	cmd.Dir = args.Dir
+	cmd.Stdout = &callbackWriter{args.Stdout}
+	cmd.Stderr = &callbackWriter{args.Stderr}
+
+	if cmd.Dir == "" {
+		cmd.Dir = s.Dir
+	}
+
+	p := &process{
+		id:      utils.RandomString(16),
+		owner:   r.Username,
+		cmd:     cmd,
+		cancel:  cancel,
+		pending: make(map[int64]*inputArgs),
+	}
+
+	if args.Stdin {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		p.stdin = stdin
+	}
+
+	start := time.Now()
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.procs[p.id] = p
+	s.mu.Unlock()
+
+	r.Client.OnDisconnect(cancel)
+
+	go func() {
+		err := cmd.Wait()
+		cancel()
+
+		s.mu.Lock()
+		delete(s.procs, p.id)
+		s.mu.Unlock()
+
+		status := exitStatus(err)
+		status.Duration = time.Since(start)
+		status.TimedOut = ctx.Err() == context.DeadlineExceeded
+
+		if !args.Exit.IsValid() {
+			return
+		}
+
+		if err := args.Exit.Call(status); err != nil {
+			s.k.Log.Debug("exec: unable to send exit status of %q: %s", args.Args[0], err)
+		}
+	}()
+
+	return &startResult{ID: p.id}, nil
+}
+
+func (s *Server) handleInput(r *kite.Request) (interface{}, error) {
+	var args inputArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.process(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, p.input(&args)
+}
+
+func (s *Server) handleKill(r *kite.Request) (interface{}, error) {
+	var args killArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p, err := s.process(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cancel()
+
+	return nil, nil
+}
+
+// process gives the process with the given ID started by the caller.
+func (s *Server) process(r *kite.Request, id string) (*process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.procs[id]
+	if !ok || p.owner != r.Username {
+		return nil, ErrProcessNotFound
+	}
+
+	return p, nil
+}
+
+// allowed tells whether the command is in the allowlist.
+func (s *Server) allowed(name string) bool {
+	path, err := osexec.LookPath(name)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range s.Commands {
+		if allowed == name {
+			return true
+		}
+
+		if p, err := osexec.LookPath(allowed); err == nil && p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) env(vars map[string]string) []string {
+	env := s.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	env = append([]string(nil), env...)
+
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+
+	return env
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout != 0 {
+		return s.Timeout
+	}
+
+	return DefaultTimeout
+}
+
+// input writes to stdin in the order of sequence numbers, buffering
+// the input received out of order.
+func (p *process) input(args *inputArgs) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if args.Seq < p.nextSeq {
+		return nil // duplicate
+	}
+
+	p.pending[args.Seq] = args
+
+	for {
+		args, ok := p.pending[p.nextSeq]
+		if !ok {
+			return nil
+		}
+
+		delete(p.pending, p.nextSeq)
+		p.nextSeq++
+
+		if p.stdin == nil {
+			return errors.New("stdin is not open")
+		}
+
+		if len(args.Data) != 0 {
+			if _, err := p.stdin.Write(args.Data); err != nil {
+				return err
+			}
+		}
+
+		if args.Close {
+			err := p.stdin.Close()
+			p.stdin = nil
+			return err
+		}
+	}
+}
+
+// callbackWriter sends written data to a callback of the caller.
+type callbackWriter struct {
+	fn dnode.Function
+}
+
+func (w *callbackWriter) Write(p []byte) (int, error) {
+	if w.fn.IsValid() {
+		if err := w.fn.Call(p); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func exitStatus(err error) *Status {
+	if err == nil {
+		return &Status{}
+	}
+
+	status := &Status{
+		ExitCode: -1,
+		Error:    err.Error(),
+	}
+
+	if e, ok := err.(*osexec.ExitError); ok {
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok {
+			switch {
+			case ws.Exited():
+				status.ExitCode = ws.ExitStatus()
+				status.Error = ""
+			case ws.Signaled():
+				status.Signal = ws.Signal().String()
+				status.Error = ""
+			}
+		}
+	}
+
+	return status
+}
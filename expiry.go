@@ -0,0 +1,51 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+)
+
+// ErrMessageExpired is reported by Outbox.OnFailure for messages, which
+// were not delivered before they expired.
+var ErrMessageExpired = errors.New("message expired")
+
+// ExpiredMessages counts calls, which arrived after their expiry and were
+// not run, by method names.
+var ExpiredMessages = expvar.NewMap("kite.expiredMessages")
+
+type expiryKey struct{}
+
+// WithExpiry gives a context, which makes calls done with
+// Client.TellWithContext carry the given expiry time.
+//
+// The remote kite does not run a call arriving after its expiry; it drops
+// the call or, if it has Kite.NackExpired set, responds with an error of
+// "expired" type. Use it for calls, which may be queued or relayed and
+// are harmful when run late, like a restart command.
+func WithExpiry(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, expiryKey{}, t)
+}
+
+func expiryFromContext(ctx context.Context) time.Time {
+	if ctx == nil {
+		return time.Time{}
+	}
+
+	t, _ := ctx.Value(expiryKey{}).(time.Time)
+	return t
+}
+
+// expired tells whether the request arrived after its expiry. The
+// expiry is converted to the local clock, if the clock difference to
+// the caller was measured with SyncTime, see Client.clockOffset.
+func (r *Request) expired() bool {
+	if r.options.ExpiresAt == 0 {
+		return false
+	}
+
+	expires := time.Unix(0, r.options.ExpiresAt*int64(time.Millisecond))
+
+	return time.Now().After(expires.Add(-r.Client.clockOffset()))
+}
@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func newExpiryServer(t *testing.T, nack bool) (*Client, *int32, func()) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var calls int32
+
+	srv := NewWithConfig("expiry-server", "0.0.1", cfg)
+	srv.NackExpired = nack
+	srv.HandleFunc("restart", func(r *Request) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+
+	c := New("expiry-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		ts.Close()
+		t.Fatalf("Dial()=%s", err)
+	}
+
+	return c, &calls, func() {
+		c.Close()
+		ts.Close()
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c, calls, stop := newExpiryServer(t, false)
+	defer stop()
+
+	ctx := WithExpiry(context.Background(), time.Now().Add(time.Minute))
+
+	if _, err := c.TellWithContext(ctx, "restart"); err != nil {
+		t.Fatalf("TellWithContext()=%s", err)
+	}
+
+	// Expired calls are dropped, so the caller times out.
+	ctx, cancel := context.WithTimeout(WithExpiry(context.Background(), time.Now().Add(-time.Second)), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := c.TellWithContext(ctx, "restart")
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("got %v, want timeout error", err)
+	}
+
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Fatalf("got %d calls, want 1", n)
+	}
+}
+
+func TestExpiry_Nack(t *testing.T) {
+	c, calls, stop := newExpiryServer(t, true)
+	defer stop()
+
+	ctx := WithExpiry(context.Background(), time.Now().Add(-time.Second))
+
+	_, err := c.TellWithContext(ctx, "restart")
+	if e, ok := err.(*Error); !ok || e.Type != "expired" {
+		t.Fatalf("got %v, want expired error", err)
+	}
+
+	failed := make(chan error, 1)
+
+	o := NewOutbox(c, NewMemoryOutboxStore())
+	o.TTL = time.Nanosecond
+	o.OnFailure = func(msg *OutboxMessage, err error) {
+		failed <- err
+	}
+
+	if _, err := o.Send("restart"); err != nil {
+		t.Fatalf("Send()=%s", err)
+	}
+
+	o.Start()
+	defer o.Close()
+
+	select {
+	case err := <-failed:
+		if err != ErrMessageExpired {
+			t.Fatalf("got %v, want %v", err, ErrMessageExpired)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the failure")
+	}
+
+	if n := atomic.LoadInt32(calls); n != 0 {
+		t.Fatalf("got %d calls, want 0", n)
+	}
+}
@@ -0,0 +1,270 @@
+package kite
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var (
+	// DefaultFailoverThreshold is the number of consecutive failed calls
+	// after which Failover switches to the backup, if Threshold is zero.
+	DefaultFailoverThreshold = 3
+
+	// DefaultProbeInterval is the time between health checks of the
+	// primary while the backup is active, if ProbeInterval is zero.
+	DefaultProbeInterval = 10 * time.Second
+)
+
+// ErrFailoverClosed is returned by Failover calls after it was closed.
+var ErrFailoverClosed = errors.New("failover is closed")
+
+// Failover sends calls to a primary kite and switches them to a warm standby
+// backup kite when the primary fails. While the backup is active, the
+// primary is probed periodically and promoted back once it is healthy.
+type Failover struct {
+	// Primary is the client connected to the preferred kite.
+	//
+	// Required.
+	Primary *Client
+
+	// Backup is the client connected to the standby kite.
+	//
+	// Required.
+	Backup *Client
+
+	// Threshold is the number of consecutive calls to the primary, which
+	// must fail before calls are switched to the backup. Only failures
+	// of the connection, like timeouts or disconnects, are counted.
+	//
+	// If zero, DefaultFailoverThreshold is used.
+	Threshold int
+
+	// ProbeInterval is the time between health checks of the primary
+	// while the backup is active.
+	//
+	// If zero, DefaultProbeInterval is used.
+	ProbeInterval time.Duration
+
+	// HealthCheck tells whether the kite behind the client is healthy.
+	//
+	// If nil, the kite is healthy when it responds to kite.ping.
+	HealthCheck func(*Client) error
+
+	// OnSwitch, when non-nil, is called each time calls are switched
+	// to the other kite.
+	OnSwitch func(active *Client)
+
+	once     sync.Once
+	mu       sync.Mutex
+	backup   bool // whether backup is active
+	failures int  // consecutive failures of the primary
+	closed   bool
+	closeC   chan struct{}
+}
+
+// NewFailover gives new failover between the given primary and backup.
+func NewFailover(primary, backup *Client) *Failover {
+	return &Failover{
+		Primary: primary,
+		Backup:  backup,
+	}
+}
+
+func (f *Failover) init() {
+	f.once.Do(func() {
+		f.closeC = make(chan struct{})
+	})
+}
+
+// Dial connects to both kites, so the backup is ready to take over calls.
+// If the primary is not reachable, calls start on the backup.
+//
+// Both clients are kept reconnecting, so the primary can be promoted
+// back after it recovers.
+func (f *Failover) Dial() error {
+	f.init()
+
+	errPrimary := f.Primary.Dial()
+	errBackup := f.Backup.Dial()
+
+	if errPrimary != nil && errBackup != nil {
+		return errPrimary
+	}
+
+	for _, c := range []*Client{f.Primary, f.Backup} {
+		c.muReconnect.Lock()
+		c.Reconnect = true
+		c.muReconnect.Unlock()
+	}
+
+	if errBackup != nil {
+		f.Backup.LocalKite.Log.Warning("failover: backup %s is not reachable: %s", f.Backup.URL, errBackup)
+		f.Backup.DialForever()
+	}
+
+	if errPrimary != nil {
+		f.Primary.LocalKite.Log.Warning("failover: primary %s is not reachable: %s", f.Primary.URL, errPrimary)
+		f.Primary.DialForever()
+		f.switchTo(true)
+	}
+
+	return nil
+}
+
+// Active gives the client, which currently receives calls.
+func (f *Failover) Active() *Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.backup {
+		return f.Backup
+	}
+
+	return f.Primary
+}
+
+// Tell calls the method of the active kite, see Client.Tell.
+func (f *Failover) Tell(method string, args ...interface{}) (*dnode.Partial, error) {
+	return f.TellWithTimeout(method, 0, args...)
+}
+
+// TellWithTimeout calls the method of the active kite,
+// see Client.TellWithTimeout.
+func (f *Failover) TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (*dnode.Partial, error) {
+	f.init()
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil, ErrFailoverClosed
+	}
+	onBackup := f.backup
+	f.mu.Unlock()
+
+	if onBackup {
+		return f.Backup.TellWithTimeout(method, timeout, args...)
+	}
+
+	result, err := f.Primary.TellWithTimeout(method, timeout, args...)
+
+	f.mu.Lock()
+	if err != nil && isConnectionError(err) {
+		f.failures++
+	} else {
+		f.failures = 0
+	}
+	failover := !f.backup && f.failures >= f.threshold()
+	f.mu.Unlock()
+
+	if failover {
+		f.Primary.LocalKite.Log.Warning("failover: switching from %s to %s: %s", f.Primary.URL, f.Backup.URL, err)
+		f.switchTo(true)
+	}
+
+	return result, err
+}
+
+// Close stops probing the primary. It does not close the clients.
+func (f *Failover) Close() {
+	f.init()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.closed {
+		f.closed = true
+		close(f.closeC)
+	}
+}
+
+// switchTo switches calls to the backup or back to the primary.
+func (f *Failover) switchTo(backup bool) {
+	f.mu.Lock()
+	if f.backup == backup || f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.backup = backup
+	f.failures = 0
+	f.mu.Unlock()
+
+	if backup {
+		go f.probe()
+	}
+
+	if f.OnSwitch != nil {
+		func() {
+			defer nopRecover()
+			f.OnSwitch(f.Active())
+		}()
+	}
+}
+
+// probe checks health of the primary until it is promoted back.
+func (f *Failover) probe() {
+	ticker := time.NewTicker(f.probeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.closeC:
+			return
+		case <-ticker.C:
+		}
+
+		if err := f.healthCheck(f.Primary); err != nil {
+			f.Primary.LocalKite.Log.Debug("failover: primary %s is not healthy: %s", f.Primary.URL, err)
+			continue
+		}
+
+		f.Primary.LocalKite.Log.Info("failover: primary %s is healthy, switching back", f.Primary.URL)
+		f.switchTo(false)
+
+		return
+	}
+}
+
+func (f *Failover) healthCheck(c *Client) error {
+	if f.HealthCheck != nil {
+		return f.HealthCheck(c)
+	}
+
+	_, err := c.TellWithTimeout("kite.ping", c.LocalKite.CallTimeout())
+	return err
+}
+
+func (f *Failover) threshold() int {
+	if f.Threshold != 0 {
+		return f.Threshold
+	}
+
+	return DefaultFailoverThreshold
+}
+
+func (f *Failover) probeInterval() time.Duration {
+	if f.ProbeInterval != 0 {
+		return f.ProbeInterval
+	}
+
+	return DefaultProbeInterval
+}
+
+// isConnectionError tells whether the call failed because the remote
+// kite could not be reached, as opposed to an error returned by
+// its handler.
+func isConnectionError(err error) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return true
+	}
+
+	switch e.Type {
+	case "sendError", "disconnect", "timeout":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestFailover(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var down int32
+
+	primary := NewWithConfig("primary", "0.0.1", cfg)
+	primary.HandleFunc("name", func(r *Request) (interface{}, error) {
+		if atomic.LoadInt32(&down) == 1 {
+			time.Sleep(200 * time.Millisecond) // do not respond in time
+		}
+		return "primary", nil
+	})
+
+	backup := NewWithConfig("backup", "0.0.1", cfg)
+	backup.HandleFunc("name", func(r *Request) (interface{}, error) {
+		return "backup", nil
+	})
+
+	tsPrimary := httptest.NewServer(primary)
+	defer tsPrimary.Close()
+
+	tsBackup := httptest.NewServer(backup)
+	defer tsBackup.Close()
+
+	k := New("failover", "0.0.1")
+
+	switched := make(chan *Client, 2)
+
+	f := NewFailover(
+		k.NewClient(fmt.Sprintf("%s/kite", tsPrimary.URL)),
+		k.NewClient(fmt.Sprintf("%s/kite", tsBackup.URL)),
+	)
+	f.Threshold = 2
+	f.ProbeInterval = 50 * time.Millisecond
+	f.HealthCheck = func(c *Client) error {
+		if atomic.LoadInt32(&down) == 1 {
+			return errors.New("primary is down")
+		}
+		return nil
+	}
+	f.OnSwitch = func(active *Client) {
+		switched <- active
+	}
+
+	if err := f.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer f.Close()
+	defer f.Primary.Close()
+	defer f.Backup.Close()
+
+	name := func() (string, error) {
+		result, err := f.TellWithTimeout("name", 100*time.Millisecond)
+		if err != nil {
+			return "", err
+		}
+		return result.MustString(), nil
+	}
+
+	if got, err := name(); err != nil || got != "primary" {
+		t.Fatalf("got %q, %v; want \"primary\"", got, err)
+	}
+
+	atomic.StoreInt32(&down, 1)
+
+	for i := 0; i < f.Threshold; i++ {
+		if _, err := name(); err == nil {
+			t.Fatalf("%d: want call to the primary to fail", i)
+		}
+	}
+
+	select {
+	case c := <-switched:
+		if c != f.Backup {
+			t.Fatalf("got switched to %s, want backup", c.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the failover")
+	}
+
+	if got, err := name(); err != nil || got != "backup" {
+		t.Fatalf("got %q, %v; want \"backup\"", got, err)
+	}
+
+	atomic.StoreInt32(&down, 0)
+
+	select {
+	case c := <-switched:
+		if c != f.Primary {
+			t.Fatalf("got switched to %s, want primary", c.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the primary to be promoted back")
+	}
+
+	if got, err := name(); err != nil || got != "primary" {
+		t.Fatalf("got %q, %v; want \"primary\"", got, err)
+	}
+}
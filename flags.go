@@ -0,0 +1,141 @@
+package kite
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Flags gives a copy of the feature flags set on Kontrol. The flags
+// are fetched after registering to Kontrol and updated whenever they
+// change there.
+//
+// Values are decoded from JSON, so numbers are float64.
+func (k *Kite) Flags() map[string]interface{} {
+	k.flagsMu.RLock()
+	defer k.flagsMu.RUnlock()
+
+	flags := make(map[string]interface{}, len(k.flags))
+	for name, value := range k.flags {
+		flags[name] = value
+	}
+
+	return flags
+}
+
+// Flag gives the value of the feature flag with the given name and
+// whether the flag is set.
+func (k *Kite) Flag(name string) (interface{}, bool) {
+	k.flagsMu.RLock()
+	value, ok := k.flags[name]
+	k.flagsMu.RUnlock()
+
+	return value, ok
+}
+
+// FlagEnabled tells whether the feature flag with the given name is
+// set to true.
+func (k *Kite) FlagEnabled(name string) bool {
+	value, _ := k.Flag(name)
+	enabled, _ := value.(bool)
+
+	return enabled
+}
+
+// OnFlagChange registers a callback which is called when a feature flag
+// is set, changed or removed. The value is nil for removed flags.
+func (k *Kite) OnFlagChange(handler func(name string, value interface{})) {
+	k.flagsMu.Lock()
+	k.flagHandlers = append(k.flagHandlers, handler)
+	k.flagsMu.Unlock()
+}
+
+// setFlags updates the feature flags, removing flags with nil values.
+// If replace is true, flags missing in the given ones are removed too.
+func (k *Kite) setFlags(flags map[string]interface{}, replace bool) {
+	changed := make(map[string]interface{})
+
+	k.flagsMu.Lock()
+
+	if replace {
+		for name := range k.flags {
+			if _, ok := flags[name]; !ok {
+				flags[name] = nil
+			}
+		}
+	}
+
+	for name, value := range flags {
+		old, ok := k.flags[name]
+
+		switch {
+		case value == nil && !ok:
+			continue
+		case value == nil:
+			delete(k.flags, name)
+		case ok && reflect.DeepEqual(old, value):
+			continue
+		default:
+			k.flags[name] = value
+		}
+
+		changed[name] = value
+	}
+
+	handlers := k.flagHandlers
+
+	k.flagsMu.Unlock()
+
+	for name, value := range changed {
+		k.Log.Info("Feature flag %q set to %v", name, value)
+
+		for _, handler := range handlers {
+			func() {
+				defer nopRecover()
+				handler(name, value)
+			}()
+		}
+	}
+}
+
+// handleSetFlags updates the feature flags with ones pushed by Kontrol.
+func (k *Kite) handleSetFlags(r *Request) (interface{}, error) {
+	k.kontrol.Lock()
+	fromKontrol := k.kontrol.Client != nil && r.Client == k.kontrol.Client
+	k.kontrol.Unlock()
+
+	if !fromKontrol {
+		return nil, errors.New("feature flags are accepted only from kontrol")
+	}
+
+	var flags map[string]interface{}
+
+	if err := r.Args.One().Unmarshal(&flags); err != nil {
+		return nil, err
+	}
+
+	k.setFlags(flags, false)
+
+	return nil, nil
+}
+
+// syncFlags fetches the current feature flags from Kontrol.
+func (k *Kite) syncFlags() {
+	result, err := k.kontrol.TellWithTimeout("getFlags", k.CallTimeout())
+	if err != nil {
+		k.Log.Warning("unable to fetch feature flags: %s", err)
+		return
+	}
+
+	var flags map[string]interface{}
+
+	if err := result.Unmarshal(&flags); err != nil {
+		k.Log.Warning("unable to read feature flags: %s", err)
+		return
+	}
+
+	if flags == nil {
+		flags = make(map[string]interface{})
+	}
+
+	k.setFlags(flags, true)
+}
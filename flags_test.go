@@ -0,0 +1,46 @@
+package kite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	k := New("flags", "0.0.1")
+
+	changes := make(map[string]interface{})
+	k.OnFlagChange(func(name string, value interface{}) {
+		changes[name] = value
+	})
+
+	k.setFlags(map[string]interface{}{"dark": true, "limit": 10.0}, false)
+	k.setFlags(map[string]interface{}{"limit": 10.0, "beta": "on"}, false)
+
+	want := map[string]interface{}{"dark": true, "limit": 10.0, "beta": "on"}
+
+	if got := k.Flags(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+
+	changes = make(map[string]interface{})
+
+	k.setFlags(map[string]interface{}{"dark": true, "limit": 20.0}, true)
+
+	want = map[string]interface{}{"limit": 20.0, "beta": nil}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+
+	if !k.FlagEnabled("dark") || k.FlagEnabled("limit") || k.FlagEnabled("beta") {
+		t.Fatalf("got %v", k.Flags())
+	}
+
+	if _, ok := k.Flag("beta"); ok {
+		t.Fatal("want beta flag to be removed")
+	}
+}
@@ -0,0 +1,158 @@
+package kite
+
+import (
+	"sync"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// flowControl holds the credit-based flow control state of a client.
+//
+// The sending side keeps the credit granted by the remote kite and
+// stops sending once it is exhausted. The receiving side counts
+// processed messages and grants the credit back.
+type flowControl struct {
+	mu sync.Mutex
+
+	// Sending side.
+	enabled  bool          // the remote kite advertised its window
+	messages int           // messages left to send
+	bytes    int           // bytes left to send, if limit is set
+	limit    bool          // the remote window is limited by size
+	notify   chan struct{} // signals a credit grant
+
+	// Receiving side.
+	window        int // advertised window in messages
+	windowBytes   int // advertised window in bytes
+	consumed      int // processed messages not granted yet
+	consumedBytes int // processed bytes not granted yet
+}
+
+// flowExempt tells whether messages of the given method are not subject
+// to flow control. Both sides must agree on it, thus it depends only on
+// the method and not on the lane, which may be overridden by the caller.
+func flowExempt(method interface{}) bool {
+	name, ok := method.(string)
+	return ok && controlMethods[name]
+}
+
+// startFlow resets the flow control state for a new session and
+// advertises the receive window to the remote kite.
+func (c *Client) startFlow() {
+	cfg := c.config()
+
+	c.flow.mu.Lock()
+	c.flow.enabled = false
+	c.flow.window = cfg.ReceiveWindow
+	c.flow.windowBytes = cfg.ReceiveWindowBytes
+	c.flow.consumed = 0
+	c.flow.consumedBytes = 0
+	c.flow.mu.Unlock()
+
+	c.signalFlow()
+
+	if cfg.ReceiveWindow > 0 {
+		go c.grant(&protocol.WindowArgs{
+			Messages: cfg.ReceiveWindow,
+			Bytes:    cfg.ReceiveWindowBytes,
+			Reset:    true,
+		})
+	}
+}
+
+// grant sends the credit to the remote kite. The call has no response
+// callback, so the response does not consume the remote kite's credit.
+func (c *Client) grant(args *protocol.WindowArgs) {
+	wrapped := c.wrapMethodArgs(nil, []interface{}{args}, 0, dnode.Function{})
+
+	if _, _, err := c.marshalAndSend(LaneControl, "kite.window", wrapped); err != nil {
+		c.logger().Debug("unable to grant credit to %s: %s", c.URL, err)
+	}
+}
+
+// consumed is called when a received message was processed, it grants
+// the credit back once half of the window is processed.
+func (c *Client) consumed(size int) {
+	c.flow.mu.Lock()
+
+	if c.flow.window <= 0 {
+		c.flow.mu.Unlock()
+		return
+	}
+
+	c.flow.consumed++
+	c.flow.consumedBytes += size
+
+	if c.flow.consumed*2 < c.flow.window && (c.flow.windowBytes <= 0 || c.flow.consumedBytes*2 < c.flow.windowBytes) {
+		c.flow.mu.Unlock()
+		return
+	}
+
+	args := &protocol.WindowArgs{
+		Messages: c.flow.consumed,
+	}
+
+	if c.flow.windowBytes > 0 {
+		args.Bytes = c.flow.consumedBytes
+	}
+
+	c.flow.consumed = 0
+	c.flow.consumedBytes = 0
+	c.flow.mu.Unlock()
+
+	go c.grant(args)
+}
+
+// hasCredit tells whether a message can be sent to the remote kite.
+func (c *Client) hasCredit() bool {
+	c.flow.mu.Lock()
+	defer c.flow.mu.Unlock()
+
+	return !c.flow.enabled || (c.flow.messages > 0 && (!c.flow.limit || c.flow.bytes > 0))
+}
+
+// spendCredit is called when a message of the given size is sent.
+// The byte credit may go negative when a single message exceeds it.
+func (c *Client) spendCredit(size int) {
+	c.flow.mu.Lock()
+	if c.flow.enabled {
+		c.flow.messages--
+		c.flow.bytes -= size
+	}
+	c.flow.mu.Unlock()
+}
+
+// addCredit is called when the remote kite grants credit.
+func (c *Client) addCredit(args *protocol.WindowArgs) {
+	c.flow.mu.Lock()
+	if args.Reset {
+		c.flow.enabled = true
+		c.flow.messages = args.Messages
+		c.flow.bytes = args.Bytes
+		c.flow.limit = args.Bytes > 0
+	} else if c.flow.enabled {
+		c.flow.messages += args.Messages
+		c.flow.bytes += args.Bytes
+	}
+	c.flow.mu.Unlock()
+
+	c.signalFlow()
+}
+
+func (c *Client) signalFlow() {
+	select {
+	case c.flow.notify <- struct{}{}:
+	default:
+	}
+}
+
+// handleWindow adds credit granted by the remote kite.
+func handleWindow(r *Request) (interface{}, error) {
+	var args protocol.WindowArgs
+	r.Args.One().MustUnmarshal(&args)
+
+	r.Client.addCredit(&args)
+
+	return nil, nil
+}
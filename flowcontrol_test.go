@@ -0,0 +1,149 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestFlowControl(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+	cfg.ReceiveWindow = 2
+
+	var started int32
+	release := make(chan struct{})
+
+	srv := NewWithConfig("flow-server", "0.0.1", cfg)
+	srv.HandleFunc("slow", func(r *Request) (interface{}, error) {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return nil, nil
+	})
+
+	pinged := make(chan struct{}, 1)
+	srv.PreHandleFunc(func(r *Request) (interface{}, error) {
+		if r.Method == "kite.ping" {
+			pinged <- struct{}{}
+		}
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("flow-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	time.Sleep(100 * time.Millisecond) // wait for the window advertisement
+
+	const n = 5
+
+	// Messages are queued once the credit is exhausted.
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := c.Tell("slow")
+			errs <- err
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&started); got != 2 {
+		t.Fatalf("got %d calls received, want 2", got)
+	}
+
+	// Control messages are not subject to flow control.
+	c.Go("kite.ping")
+
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the ping")
+	}
+
+	close(release)
+
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("%d: Tell()=%s", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d: timed out waiting for the response", i)
+		}
+	}
+
+	if got := atomic.LoadInt32(&started); got != n {
+		t.Fatalf("got %d calls received, want %d", got, n)
+	}
+}
+
+func TestFlowControl_QueueFull(t *testing.T) {
+	defer func(size int) { LaneQueueSize = size }(LaneQueueSize)
+	LaneQueueSize = 2
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+	cfg.ReceiveWindow = 1
+
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := NewWithConfig("flow-server", "0.0.1", cfg)
+	srv.HandleFunc("slow", func(r *Request) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("flow-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond) // wait for the window advertisement
+
+	// The first call spends the credit, the next ones fill the queue.
+	var queued []chan *response
+	for i := 0; i < 3; i++ {
+		queued = append(queued, c.Go("slow"))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	start := time.Now()
+
+	_, err := c.TellWithTimeout("slow", time.Second)
+	if e, ok := err.(*Error); !ok || e.Type != "sendError" {
+		t.Fatalf("got %v, want sendError", err)
+	}
+
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("sending to a full queue took %s", d)
+	}
+
+	c.Close()
+
+	// Closing the client must not leave the callers stuck.
+	for i, resp := range queued {
+		select {
+		case r := <-resp:
+			if r.Err == nil {
+				t.Fatalf("%d: expected the call to fail", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d: timed out waiting for the response", i)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package fs exposes file system operations on a directory tree to remote
+// kites.
+//
+// All paths are resolved relative to the root directory of the server;
+// paths leading outside of it, including via symbolic links, are rejected.
+// Paths given to and returned by the methods are slash-separated and
+// start with "/", which denotes the root.
+//
+//	k := kite.New("fs", "1.0.0")
+//	fs.NewServer(k, "/srv/data")
+//	k.Run()
+//
+// Remote kites are notified about changes with fs.watch:
+//
+//	c.Tell("fs.watch", map[string]interface{}{
+//	    "path":      "/",
+//	    "recursive": true,
+//	    "onChange": dnode.Callback(func(p *dnode.Partial) {
+//	        var change fs.Change
+//	        p.One().MustUnmarshal(&change)
+//	        ...
+//	    }),
+//	})
+package fs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMaxFileSize is the maximum size of a file read or written,
+// if Server.MaxFileSize is zero.
+var DefaultMaxFileSize int64 = 32 * 1024 * 1024
+
+var (
+	// ErrOutsideRoot is returned for paths leading outside of the root.
+	ErrOutsideRoot = errors.New("path is outside of the root directory")
+
+	// ErrReadOnly is returned for writes to a read-only server.
+	ErrReadOnly = errors.New("file system is read-only")
+
+	// ErrTooLarge is returned for files exceeding the maximum size.
+	ErrTooLarge = errors.New("file is too large")
+)
+
+// FileInfo describes a file.
+type FileInfo struct {
+	Name    string      `json:"name"`
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	IsDir   bool        `json:"isDir"`
+}
+
+// Op describes a change of a file.
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpWrite  Op = "write"
+	OpRemove Op = "remove"
+	OpRename Op = "rename"
+	OpChmod  Op = "chmod"
+)
+
+// Change is sent to the watchers of a path.
+type Change struct {
+	Path string `json:"path"`
+	Op   Op     `json:"op"`
+}
+
+// sandbox resolves client paths within the root directory.
+type sandbox struct {
+	root string // absolute, with symbolic links evaluated
+}
+
+func newSandbox(root string) (*sandbox, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sandbox{root: root}, nil
+}
+
+// resolve gives the local path of the client path. The path, or its
+// deepest existing parent for files to be created, must not lead
+// outside of the root after evaluating symbolic links.
+func (s *sandbox) resolve(p string) (string, error) {
+	local := s.join(p)
+
+	existing := local
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !s.contains(real) {
+				return "", ErrOutsideRoot
+			}
+			return local, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", err
+		}
+		existing = parent
+	}
+}
+
+// join gives the local path of the client path, without evaluating
+// symbolic links. The cleaned path cannot contain "..".
+func (s *sandbox) join(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// rel gives the client path of the local path.
+func (s *sandbox) rel(local string) string {
+	rel, err := filepath.Rel(s.root, local)
+	if err != nil || rel == "." {
+		return "/"
+	}
+
+	return "/" + filepath.ToSlash(rel)
+}
+
+func (s *sandbox) contains(local string) bool {
+	return local == s.root || strings.HasPrefix(local, s.root+string(filepath.Separator))
+}
+
+func (s *sandbox) info(local string, fi os.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:    fi.Name(),
+		Path:    s.rel(local),
+		Size:    fi.Size(),
+		Mode:    fi.Mode(),
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+	}
+}
@@ -0,0 +1,228 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/fs"
+)
+
+func TestFS(t *testing.T) {
+	root, err := ioutil.TempDir("", "kite-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	outside, err := ioutil.TempDir("", "kite-fs-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	k := kite.New("fs", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv, err := fs.NewServer(k, root)
+	if err != nil {
+		t.Fatalf("NewServer()=%s", err)
+	}
+	srv.MaxFileSize = 16
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := kite.New("fs-client", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("fs.writeFile", map[string]interface{}{"path": "/a.txt", "content": []byte("hello")}); err != nil {
+		t.Fatalf("writeFile()=%s", err)
+	}
+
+	if _, err := c.Tell("fs.writeFile", map[string]interface{}{"path": "/a.txt", "content": []byte(" world"), "append": true}); err != nil {
+		t.Fatalf("writeFile()=%s", err)
+	}
+
+	res, err := c.Tell("fs.readFile", map[string]string{"path": "/a.txt"})
+	if err != nil {
+		t.Fatalf("readFile()=%s", err)
+	}
+
+	var file struct {
+		Content []byte `json:"content"`
+	}
+	res.MustUnmarshal(&file)
+
+	if string(file.Content) != "hello world" {
+		t.Fatalf("got %q, want %q", file.Content, "hello world")
+	}
+
+	res, err = c.Tell("fs.getInfo", map[string]string{"path": "a.txt"})
+	if err != nil {
+		t.Fatalf("getInfo()=%s", err)
+	}
+
+	var info fs.FileInfo
+	res.MustUnmarshal(&info)
+
+	if info.Path != "/a.txt" || info.Size != 11 || info.IsDir {
+		t.Fatalf("got %+v", info)
+	}
+
+	res, err = c.Tell("fs.glob", map[string]string{"pattern": "/*.txt"})
+	if err != nil {
+		t.Fatalf("glob()=%s", err)
+	}
+
+	var paths []string
+	res.MustUnmarshal(&paths)
+
+	if want := []string{"/a.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+
+	res, err = c.Tell("fs.readDirectory", map[string]string{"path": "/"})
+	if err != nil {
+		t.Fatalf("readDirectory()=%s", err)
+	}
+
+	var files []fs.FileInfo
+	res.MustUnmarshal(&files)
+
+	if len(files) != 2 || files[0].Name != "a.txt" || files[1].Name != "escape" {
+		t.Fatalf("got %+v", files)
+	}
+
+	// Paths are sandboxed.
+	errs := map[string]map[string]interface{}{
+		"fs.readFile":  {"path": "/escape/secret"},
+		"fs.writeFile": {"path": "/escape/new", "content": []byte("x")},
+		"fs.getInfo":   {"path": "/escape"},
+	}
+
+	for method, args := range errs {
+		_, err := c.Tell(method, args)
+		if e, ok := err.(*kite.Error); !ok || e.Message != fs.ErrOutsideRoot.Error() {
+			t.Fatalf("%s: got %v, want %v", method, err, fs.ErrOutsideRoot)
+		}
+	}
+
+	// Parent references do not leave the root.
+	if _, err := c.Tell("fs.readFile", map[string]string{"path": "../../../" + filepath.Join(outside, "secret")}); err == nil {
+		t.Fatal("want error reading outside of the root")
+	}
+
+	res, err = c.Tell("fs.glob", map[string]string{"pattern": "/escape/*"})
+	if err != nil {
+		t.Fatalf("glob()=%s", err)
+	}
+
+	res.MustUnmarshal(&paths)
+	if len(paths) != 0 {
+		t.Fatalf("got %v, want no paths", paths)
+	}
+
+	_, err = c.Tell("fs.writeFile", map[string]interface{}{"path": "/big", "content": make([]byte, 17)})
+	if e, ok := err.(*kite.Error); !ok || e.Message != fs.ErrTooLarge.Error() {
+		t.Fatalf("got %v, want %v", err, fs.ErrTooLarge)
+	}
+}
+
+func TestFSWatch(t *testing.T) {
+	root, err := ioutil.TempDir("", "kite-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	k := kite.New("fs", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	if _, err := fs.NewServer(k, root); err != nil {
+		t.Fatalf("NewServer()=%s", err)
+	}
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := kite.New("fs-client", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	changes := make(chan fs.Change, 16)
+
+	res, err := c.Tell("fs.watch", map[string]interface{}{
+		"path":      "/",
+		"recursive": true,
+		"onChange": dnode.Callback(func(p *dnode.Partial) {
+			var change fs.Change
+			p.One().MustUnmarshal(&change)
+			changes <- change
+		}),
+	})
+	if err != nil {
+		t.Fatalf("watch()=%s", err)
+	}
+
+	var watch struct {
+		ID string `json:"id"`
+	}
+	res.MustUnmarshal(&watch)
+
+	expect := func(want fs.Change) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case change := <-changes:
+				if change == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %+v", want)
+			}
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(fs.Change{Path: "/sub", Op: fs.OpCreate})
+
+	// Wait for the new directory to be watched.
+	time.Sleep(200 * time.Millisecond)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "sub", "file"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(fs.Change{Path: "/sub/file", Op: fs.OpCreate})
+
+	if _, err := c.Tell("fs.unwatch", map[string]string{"id": watch.ID}); err != nil {
+		t.Fatalf("unwatch()=%s", err)
+	}
+
+	if _, err := c.Tell("fs.unwatch", map[string]string{"id": watch.ID}); err == nil {
+		t.Fatal("want error unwatching twice")
+	}
+}
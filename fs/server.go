@@ -0,0 +1,354 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Server serves file system operations on a directory tree. It serves
+// the following methods of the kite:
+//
+//	fs.readFile      - gives content of a file
+//	fs.writeFile     - replaces content of a file or appends to it
+//	fs.readDirectory - lists a directory
+//	fs.getInfo       - describes a file
+//	fs.glob          - gives paths matching a pattern
+//	fs.watch         - notifies about changes of a path
+//	fs.unwatch       - stops notifying about changes
+type Server struct {
+	// ReadOnly disables fs.writeFile.
+	ReadOnly bool
+
+	// MaxFileSize is the maximum size of a file read or written.
+	//
+	// If zero, DefaultMaxFileSize is used.
+	MaxFileSize int64
+
+	k       *kite.Kite
+	sb      *sandbox
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+type pathArgs struct {
+	Path string `json:"path"`
+}
+
+// NewServer gives new server serving the root directory with the
+// given kite.
+func NewServer(k *kite.Kite, root string) (*Server, error) {
+	sb, err := newSandbox(root)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		k:       k,
+		sb:      sb,
+		watches: make(map[string]*watch),
+	}
+
+	k.HandleFunc("fs.readFile", s.handleReadFile)
+	k.HandleFunc("fs.writeFile", s.handleWriteFile)
+	k.HandleFunc("fs.readDirectory", s.handleReadDirectory)
+	k.HandleFunc("fs.getInfo", s.handleGetInfo)
+	k.HandleFunc("fs.glob", s.handleGlob)
+	k.HandleFunc("fs.watch", s.handleWatch)
+	k.HandleFunc("fs.unwatch", s.handleUnwatch)
+
+	return s, nil
+}
+
+func (s *Server) handleReadFile(r *kite.Request) (interface{}, error) {
+	var args pathArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	local, err := s.sb.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return nil, errors.New("path is a directory")
+	}
+
+	max := s.maxFileSize()
+
+	if fi.Size() > max {
+		return nil, ErrTooLarge
+	}
+
+	p, err := ioutil.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(p)) > max {
+		return nil, ErrTooLarge
+	}
+
+	return map[string]interface{}{"content": p}, nil
+}
+
+func (s *Server) handleWriteFile(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Content []byte `json:"content"`
+		Append  bool   `json:"append"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if s.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	local, err := s.sb.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Append {
+		err = s.appendFile(local, args.Content)
+	} else {
+		err = s.writeFile(local, args.Content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sb.info(local, fi), nil
+}
+
+// writeFile replaces the file atomically, so readers never see
+// partially written content.
+func (s *Server) writeFile(local string, p []byte) error {
+	if int64(len(p)) > s.maxFileSize() {
+		return ErrTooLarge
+	}
+
+	mode := os.FileMode(0644)
+
+	if fi, err := os.Stat(local); err == nil {
+		if fi.IsDir() {
+			return errors.New("path is a directory")
+		}
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(local), "."+filepath.Base(local)+".")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(p); err == nil {
+		err = tmp.Chmod(mode)
+	}
+
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+func (s *Server) appendFile(local string, p []byte) error {
+	f, err := os.OpenFile(local, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err == nil && fi.Size()+int64(len(p)) > s.maxFileSize() {
+		err = ErrTooLarge
+	}
+
+	if err == nil {
+		_, err = f.Write(p)
+	}
+
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func (s *Server) handleReadDirectory(r *kite.Request) (interface{}, error) {
+	var args pathArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	local, err := s.sb.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+
+	files := make([]*FileInfo, len(fis))
+	for i, fi := range fis {
+		files[i] = s.sb.info(filepath.Join(local, fi.Name()), fi)
+	}
+
+	return files, nil
+}
+
+func (s *Server) handleGetInfo(r *kite.Request) (interface{}, error) {
+	var args pathArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	local, err := s.sb.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sb.info(local, fi), nil
+}
+
+func (s *Server) handleGlob(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Pattern string `json:"pattern"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(s.sb.join(args.Pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(matches))
+	for _, match := range matches {
+		// Skip symbolic links leading outside of the root.
+		if _, err := s.sb.resolve(s.sb.rel(match)); err != nil {
+			continue
+		}
+
+		paths = append(paths, s.sb.rel(match))
+	}
+
+	return paths, nil
+}
+
+func (s *Server) handleWatch(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Path      string         `json:"path"`
+		Recursive bool           `json:"recursive"`
+		OnChange  dnode.Function `json:"onChange"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if !args.OnChange.IsValid() {
+		return nil, errors.New("onChange callback is missing")
+	}
+
+	local, err := s.sb.resolve(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := s.watch(r.Client, local, args.Recursive, args.OnChange)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Client.OnDisconnect(func() {
+		s.unwatch(w.id)
+	})
+
+	return map[string]interface{}{"id": w.id}, nil
+}
+
+func (s *Server) handleUnwatch(r *kite.Request) (interface{}, error) {
+	var args struct {
+		ID string `json:"id"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	w, ok := s.watches[args.ID]
+	s.mu.Unlock()
+
+	if !ok || w.client != r.Client {
+		return nil, errors.New("watch not found")
+	}
+
+	s.unwatch(args.ID)
+
+	return nil, nil
+}
+
+func (s *Server) maxFileSize() int64 {
+	if s.MaxFileSize != 0 {
+		return s.MaxFileSize
+	}
+
+	return DefaultMaxFileSize
+}
@@ -0,0 +1,143 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// watch notifies a remote kite about changes of a path.
+type watch struct {
+	id        string
+	client    *kite.Client
+	w         *fsnotify.Watcher
+	recursive bool
+	onChange  dnode.Function
+}
+
+// watch starts watching the local path. Directories are watched for
+// changes of their entries; recursive watches add subdirectories,
+// including the ones created later.
+func (s *Server) watch(c *kite.Client, local string, recursive bool, onChange dnode.Function) (*watch, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watch{
+		id:        utils.RandomString(16),
+		client:    c,
+		w:         fw,
+		recursive: recursive,
+		onChange:  onChange,
+	}
+
+	if err := w.add(local); err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.watches[w.id] = w
+	s.mu.Unlock()
+
+	go s.loop(w)
+
+	return w, nil
+}
+
+func (s *Server) unwatch(id string) {
+	s.mu.Lock()
+	w, ok := s.watches[id]
+	delete(s.watches, id)
+	s.mu.Unlock()
+
+	if ok {
+		w.w.Close()
+	}
+}
+
+// add watches the local path and, for recursive watches,
+// its subdirectories.
+func (w *watch) add(local string) error {
+	if !w.recursive {
+		return w.w.Add(local)
+	}
+
+	// Walk does not follow symbolic links, so the watched
+	// directories stay within the root.
+	return filepath.Walk(local, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p != local {
+				return nil // removed in the meantime
+			}
+			return err
+		}
+
+		if p == local || fi.IsDir() {
+			return w.w.Add(p)
+		}
+
+		return nil
+	})
+}
+
+// loop sends changes to the remote kite until the watch is stopped.
+func (s *Server) loop(w *watch) {
+	for {
+		select {
+		case e, ok := <-w.w.Events:
+			if !ok {
+				return
+			}
+
+			if !s.sb.contains(e.Name) {
+				continue
+			}
+
+			if w.recursive && e.Op&fsnotify.Create != 0 {
+				if fi, err := os.Lstat(e.Name); err == nil && fi.IsDir() {
+					if err := w.add(e.Name); err != nil {
+						s.k.Log.Warning("fs: unable to watch %s: %s", e.Name, err)
+					}
+				}
+			}
+
+			change := &Change{
+				Path: s.sb.rel(e.Name),
+				Op:   op(e.Op),
+			}
+
+			if err := w.onChange.Call(change); err != nil {
+				s.k.Log.Debug("fs: unable to notify about %s: %s", change.Path, err)
+				s.unwatch(w.id)
+				return
+			}
+		case err, ok := <-w.w.Errors:
+			if !ok {
+				return
+			}
+
+			s.k.Log.Warning("fs: watch %s: %s", w.id, err)
+		}
+	}
+}
+
+func op(o fsnotify.Op) Op {
+	switch {
+	case o&fsnotify.Create != 0:
+		return OpCreate
+	case o&fsnotify.Remove != 0:
+		return OpRemove
+	case o&fsnotify.Rename != 0:
+		return OpRename
+	case o&fsnotify.Write != 0:
+		return OpWrite
+	default:
+		return OpChmod
+	}
+}
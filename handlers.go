@@ -19,11 +19,30 @@ func (k *Kite) addDefaultHandlers() {
 	k.HandleFunc("kite.systemInfo", handleSystemInfo)
 	k.HandleFunc("kite.heartbeat", k.handleHeartbeat)
 	k.HandleFunc("kite.ping", handlePing).DisableAuthentication()
+	k.HandleFunc("kite.window", handleWindow).DisableAuthentication()
+	k.HandleFunc("kite.time", handleTime).DisableAuthentication()
+	k.HandleFunc("kite.health", k.handleHealth)
+	k.HandleFunc("kite.info", k.handleInfo).DisableAuthentication()
+	k.HandleFunc("kite.nextPage", k.handleNextPage)
+	k.HandleFunc("kite.resume", k.handleResume)
 	k.HandleFunc("kite.tunnel", handleTunnel)
 	k.HandleFunc("kite.log", k.handleLog)
 	k.HandleFunc("kite.print", handlePrint)
 	k.HandleFunc("kite.prompt", handlePrompt)
 	k.HandleFunc("kite.getPass", handleGetPass)
+	k.HandleFunc("kite.operationStatus", k.handleOperationStatus)
+	k.HandleFunc("kite.operationCancel", k.handleOperationCancel)
+	k.HandleFunc("kite.operationAttach", k.handleOperationAttach)
+	k.HandleFunc("kite.revokeTokens", k.handleRevokeTokens)
+	k.HandleFunc("kite.setFlags", k.handleSetFlags)
+	k.HandleFunc("kite.admin.setLogLevel", k.AdminOnly(k.handleAdminSetLogLevel))
+	k.HandleFunc("kite.admin.setConfig", k.AdminOnly(k.handleAdminSetConfig))
+	k.HandleFunc("kite.admin.goroutines", k.AdminOnly(k.handleAdminGoroutines))
+	k.HandleFunc("kite.admin.connections", k.AdminOnly(k.handleAdminConnections))
+	k.HandleFunc("kite.admin.disconnect", k.AdminOnly(k.handleAdminDisconnect))
+	k.HandleFunc("kite.admin.drain", k.AdminOnly(k.handleAdminDrain))
+	k.HandleFunc("kite.admin.lockouts", k.AdminOnly(k.handleAdminLockouts))
+	k.HandleFunc("kite.admin.unlock", k.AdminOnly(k.handleAdminUnlock))
 	if runtime.GOOS == "darwin" {
 		k.HandleFunc("kite.notify", handleNotifyDarwin)
 	}
@@ -0,0 +1,173 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrHandoffUnsupported is returned by ServeHandoff and TakeOver on
+// platforms, which cannot pass file descriptors between processes.
+var ErrHandoffUnsupported = errors.New("handoff is not supported on this platform")
+
+// HandoffOptions configures ServeHandoff.
+type HandoffOptions struct {
+	// State, when non-nil, gives the state of the application, which is
+	// passed to the new process in HandoffState.State.
+	State func() (interface{}, error)
+
+	// DrainTimeout is the maximum time to wait for calls in flight to
+	// finish, after the listeners were handed over.
+	//
+	// If zero, DefaultDrainTimeout is used.
+	DrainTimeout time.Duration
+}
+
+// HandoffState is passed by the old process of the kite to the new one,
+// see TakeOver. Pending callbacks and the dispatch table of the method
+// calls are not part of it, see ServeHandoff.
+type HandoffState struct {
+	// Listeners describe the listeners handed over.
+	Listeners []HandoffListener `json:"listeners"`
+
+	// Calls are the calls, which were in flight at the time of the
+	// handoff. The old process keeps serving them until they finish
+	// or the drain timeout elapses, the new process cannot resume them.
+	Calls []HandoffCall `json:"calls,omitempty"`
+
+	// Connections is the number of connections held by the old process
+	// at the time of the handoff. The connections are closed once the
+	// old process is drained and their clients reconnect to the new one.
+	Connections int `json:"connections"`
+
+	// State is the state of the application, see HandoffOptions.State.
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// HandoffListener describes a listener handed over to the new process.
+type HandoffListener struct {
+	// Network and Address are the ones the listener was requested with,
+	// by Run or Listen.
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+// HandoffCall describes a call in flight at the time of the handoff.
+type HandoffCall struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	Username  string    `json:"username"`
+	MessageID string    `json:"messageId,omitempty"`
+	Kite      string    `json:"kite,omitempty"` // name of the calling kite
+	Started   time.Time `json:"started"`
+}
+
+// inheritedListener is a listener handed over by the previous process.
+type inheritedListener struct {
+	HandoffListener
+	l net.Listener
+}
+
+// handoffMessage is sent over the handoff socket, the descriptors of the
+// listeners are passed alongside.
+type handoffMessage struct {
+	State *HandoffState `json:"state"`
+}
+
+// inheritedListener gives the listener handed over for the network and
+// address, or nil if there is none. Each listener is given once.
+func (k *Kite) inheritedListener(network, address string) net.Listener {
+	k.inheritOnce.Do(k.inheritListeners)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for i, il := range k.inherited {
+		if il.Network == network && il.Address == address {
+			k.inherited = append(k.inherited[:i], k.inherited[i+1:]...)
+			return il.l
+		}
+	}
+
+	return nil
+}
+
+// trackCall records the request as being handled until the returned
+// function is called.
+func (k *Kite) trackCall(r *Request) func() {
+	k.callsMu.Lock()
+	if k.calls == nil {
+		k.calls = make(map[*Request]time.Time)
+	}
+	k.calls[r] = time.Now()
+	k.callsMu.Unlock()
+
+	return func() {
+		k.callsMu.Lock()
+		delete(k.calls, r)
+		k.callsMu.Unlock()
+	}
+}
+
+// handoffState gives the state of the kite passed to the new process.
+func (k *Kite) handoffState(listeners []*gracefulListener, opts *HandoffOptions) (*HandoffState, error) {
+	state := &HandoffState{}
+
+	for _, l := range listeners {
+		state.Listeners = append(state.Listeners, HandoffListener{
+			Network: l.network,
+			Address: l.address,
+		})
+	}
+
+	k.callsMu.Lock()
+	for r, started := range k.calls {
+		call := HandoffCall{
+			ID:        r.ID,
+			Method:    r.Method,
+			Username:  r.Username,
+			MessageID: r.MessageID,
+			Started:   started,
+		}
+
+		if r.Client != nil {
+			call.Kite = r.Client.Kite.Name
+		}
+
+		state.Calls = append(state.Calls, call)
+	}
+	k.callsMu.Unlock()
+
+	k.clientsMu.Lock()
+	state.Connections = len(k.clients)
+	k.clientsMu.Unlock()
+
+	if opts.State != nil {
+		v, err := opts.State()
+		if err != nil {
+			return nil, err
+		}
+
+		if state.State, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// servedListeners gives the listeners the kite serves on.
+func (k *Kite) servedListeners() []*gracefulListener {
+	var listeners []*gracefulListener
+
+	if k.listener != nil {
+		listeners = append(listeners, k.listener)
+	}
+
+	k.mu.Lock()
+	listeners = append(listeners, k.listeners...)
+	k.mu.Unlock()
+
+	return listeners
+}
@@ -0,0 +1,138 @@
+// +build !windows
+
+package kite
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestHandoff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-handoff")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "kite.sock")
+	handoff := filepath.Join(dir, "handoff.sock")
+
+	newKite := func(version string) *Kite {
+		cfg := config.New()
+		cfg.DisableAuthentication = true
+
+		k := NewWithConfig("gateway", "0.0.1", cfg)
+		k.HandleFunc("version", func(r *Request) (interface{}, error) {
+			return version, nil
+		})
+
+		return k
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	old := newKite("old")
+	old.HandleFunc("slow", func(r *Request) (interface{}, error) {
+		close(started)
+		<-release
+		return "done", nil
+	})
+	defer old.Close()
+
+	if _, err := old.Listen("unix", socket, nil); err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	c := New("client", "0.0.1").NewClient("http://localhost/kite", WithUnixSocket(socket))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	slow := c.Go("slow")
+	<-started
+
+	served := make(chan error, 1)
+	go func() {
+		served <- old.ServeHandoff(handoff, &HandoffOptions{
+			State: func() (interface{}, error) {
+				return map[string]int{"generation": 1}, nil
+			},
+		})
+	}()
+
+	k := newKite("new")
+	defer k.Close()
+
+	var state *HandoffState
+	for i := 0; ; i++ {
+		if state, err = k.TakeOver(handoff); err == nil {
+			break
+		}
+
+		if i == 50 {
+			t.Fatalf("TakeOver()=%s", err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if len(state.Listeners) != 1 || state.Listeners[0] != (HandoffListener{"unix", socket}) {
+		t.Fatalf("got listeners %+v", state.Listeners)
+	}
+
+	if len(state.Calls) != 1 || state.Calls[0].Method != "slow" || state.Calls[0].Kite != "client" {
+		t.Fatalf("got calls %+v", state.Calls)
+	}
+
+	var appState map[string]int
+	if err := json.Unmarshal(state.State, &appState); err != nil || appState["generation"] != 1 {
+		t.Fatalf("got state %s (%v)", state.State, err)
+	}
+
+	if _, err := k.Listen("unix", socket, nil); err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	c2 := New("client", "0.0.1").NewClient("http://localhost/kite", WithUnixSocket(socket))
+	if err := c2.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c2.Close()
+
+	result, err := c2.Tell("version")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != "new" {
+		t.Fatalf("got version %q, want %q", got, "new")
+	}
+
+	close(release)
+
+	select {
+	case resp := <-slow:
+		if resp.Err != nil {
+			t.Fatalf("slow: %s", resp.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the call in flight")
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("ServeHandoff()=%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ServeHandoff")
+	}
+}
@@ -0,0 +1,257 @@
+// +build !windows
+
+package kite
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// maxHandoffState is the maximum size of the state received by TakeOver.
+const maxHandoffState = 64 << 20
+
+// ServeHandoff hands the listeners of the kite over to its new process,
+// enabling binary upgrades without downtime. It listens on the unix socket
+// at path and waits for the new process to call TakeOver.
+//
+// The descriptors of the listeners are passed to the new process together
+// with a HandoffState. Once the new process acknowledges them, the kite
+// stops accepting connections, drains the calls in flight and closes.
+// Connections are accepted by the new process meanwhile, so no connection
+// attempt is refused during the upgrade.
+//
+// Pending callbacks and the dispatch table are not handed over: callbacks
+// are closures bound to the connections of the old process, which cannot
+// be serialized, and the responses to calls in flight can be sent only
+// over the connections they were received on. Instead, calls in flight
+// are finished by the old process during the drain, and clients
+// reconnecting after the old process closes replay their subscriptions
+// to the new one, see Client.Subscribe. The in-flight calls passed in
+// HandoffState.Calls are for bookkeeping only.
+func (k *Kite) ServeHandoff(path string, opts *HandoffOptions) error {
+	if opts == nil {
+		opts = &HandoffOptions{}
+	}
+
+	removeStaleSocket(path)
+
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+
+	conn, err := ul.AcceptUnix()
+	ul.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	listeners := k.servedListeners()
+
+	state, err := k.handoffState(listeners, opts)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	fds := make([]int, 0, len(listeners))
+
+	for _, l := range listeners {
+		f, err := listenerFile(l)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		fds = append(fds, int(f.Fd()))
+	}
+
+	p, err := json.Marshal(&handoffMessage{State: state})
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(p)))
+
+	if _, _, err := conn.WriteMsgUnix(header, syscall.UnixRights(fds...), nil); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(p); err != nil {
+		return err
+	}
+
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return fmt.Errorf("handoff was not acknowledged: %s", err)
+	}
+
+	k.Log.Info("Handed %d listeners over, draining %d calls in flight", len(listeners), len(state.Calls))
+
+	k.handOver(listeners, opts.DrainTimeout)
+
+	return nil
+}
+
+// TakeOver receives the listeners of the previous process of the kite,
+// which serves the handoff on the unix socket at path, see ServeHandoff.
+//
+// TakeOver must be called before Run and Listen, which use the received
+// listeners, if they are requested with the same network and address as
+// in the previous process, instead of listening anew. It returns the state
+// passed by the previous process.
+func (k *Kite) TakeOver(path string) (*HandoffState, error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	header := make([]byte, 4)
+	oob := make([]byte, syscall.CmsgSpace(64*4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(header, oob)
+	if err != nil {
+		return nil, err
+	}
+
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(fds))
+	defer func() {
+		for _, l := range listeners {
+			if l != nil {
+				l.Close()
+			}
+		}
+	}()
+
+	for _, fd := range fds {
+		f := os.NewFile(uintptr(fd), "handoff")
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	if _, err := io.ReadFull(conn, header[n:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxHandoffState {
+		return nil, fmt.Errorf("handoff state too large: %d bytes", size)
+	}
+
+	p := make([]byte, size)
+	if _, err := io.ReadFull(conn, p); err != nil {
+		return nil, err
+	}
+
+	var msg handoffMessage
+	if err := json.Unmarshal(p, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.State == nil || len(msg.State.Listeners) != len(listeners) {
+		return nil, errors.New("handoff state does not match the listeners received")
+	}
+
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	for i, l := range listeners {
+		k.inherited = append(k.inherited, &inheritedListener{
+			HandoffListener: msg.State.Listeners[i],
+			l:               l,
+		})
+	}
+	k.mu.Unlock()
+
+	listeners = nil
+
+	return msg.State, nil
+}
+
+// handOver stops accepting connections on the listeners handed over to
+// the new process, drains the calls in flight and closes the kite. The
+// sockets of unix listeners are kept, as they are used by the new process.
+func (k *Kite) handOver(listeners []*gracefulListener, drainTimeout time.Duration) {
+	for _, l := range listeners {
+		l.connsMu.Lock()
+		l.handedOver = true
+		l.connsMu.Unlock()
+
+		if ul, ok := l.raw.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+
+		l.Close()
+	}
+
+	k.drain(drainTimeout, nil)
+
+	for _, l := range listeners {
+		l.connsMu.Lock()
+		l.closeConns()
+		l.connsMu.Unlock()
+	}
+
+	k.Close()
+}
+
+// listenerFile gives a duplicate of the descriptor of the listener.
+func listenerFile(l *gracefulListener) (*os.File, error) {
+	f, ok := l.raw.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("cannot hand %s %s listener over", l.network, l.address)
+	}
+
+	return f.File()
+}
+
+// parseRights gives the descriptors passed in the control messages.
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+
+	var fds []int
+
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		fds = append(fds, rights...)
+	}
+
+	return fds, nil
+}
@@ -0,0 +1,18 @@
+package kite
+
+import "os"
+
+// ServeHandoff is not supported on Windows, it returns ErrHandoffUnsupported.
+func (k *Kite) ServeHandoff(path string, opts *HandoffOptions) error {
+	return ErrHandoffUnsupported
+}
+
+// TakeOver is not supported on Windows, it returns ErrHandoffUnsupported.
+func (k *Kite) TakeOver(path string) (*HandoffState, error) {
+	return nil, ErrHandoffUnsupported
+}
+
+// Upgrade is not supported on Windows, it returns ErrHandoffUnsupported.
+func (k *Kite) Upgrade(opts *UpgradeOptions) (*os.Process, error) {
+	return nil, ErrHandoffUnsupported
+}
@@ -0,0 +1,191 @@
+package kite
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the number of points each member occupies
+// on a HashRing, if not specified otherwise.
+const DefaultReplicas = 128
+
+// HashRing maps routing keys to members using consistent hashing.
+//
+// When a member is added or removed, only keys that were mapped to
+// that member (or are going to be) are moved, other keys keep being
+// mapped to the same members.
+type HashRing struct {
+	replicas int
+
+	mu      sync.RWMutex
+	points  []uint32          // sorted hashes of member replicas
+	owners  map[uint32]string // point -> member
+	members map[string]struct{}
+	weights map[string]float64 // member -> weight, see SetWeights
+}
+
+// NewHashRing gives new hash ring, where each member occupies the given
+// number of points. If replicas is <= 0, DefaultReplicas is used.
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	return &HashRing{
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+		members:  make(map[string]struct{}),
+	}
+}
+
+// Add adds the given members to the ring.
+func (r *HashRing) Add(members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range members {
+		r.members[m] = struct{}{}
+	}
+
+	r.build()
+}
+
+// Remove removes the given members from the ring.
+func (r *HashRing) Remove(members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range members {
+		delete(r.members, m)
+	}
+
+	r.build()
+}
+
+// Set replaces the members of the ring with the given ones.
+func (r *HashRing) Set(members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.members = make(map[string]struct{}, len(members))
+	for _, m := range members {
+		r.members[m] = struct{}{}
+	}
+
+	r.build()
+}
+
+// SetWeights sets weights of the members, which scale the number of points
+// they occupy, thus the fraction of keys mapped to them. Members without
+// a weight have the weight of 1, members with a weight <= 0 occupy no
+// points and get no keys.
+//
+// Keys move between members only when their weights change.
+func (r *HashRing) SetWeights(weights map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.weights = make(map[string]float64, len(weights))
+	for m, w := range weights {
+		r.weights[m] = w
+	}
+
+	r.build()
+}
+
+// Members gives sorted members of the ring.
+func (r *HashRing) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]string, 0, len(r.members))
+	for m := range r.members {
+		members = append(members, m)
+	}
+
+	sort.Strings(members)
+
+	return members
+}
+
+// Get gives the member the given key is mapped to, or empty string
+// if the ring has no members.
+func (r *HashRing) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// GetN gives up to n distinct members for the given key: the one the key
+// is mapped to, followed by the next ones clockwise on the ring. Keys keep
+// being mapped to the same members, as with Get.
+func (r *HashRing) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+
+	members := make([]string, 0, n)
+	for j := 0; j < len(r.points) && len(members) < n; j++ {
+		m := r.owners[r.points[(i+j)%len(r.points)]]
+		if !contains(members, m) {
+			members = append(members, m)
+		}
+	}
+
+	return members
+}
+
+func (r *HashRing) build() {
+	r.points = r.points[:0]
+	r.owners = make(map[uint32]string, len(r.members)*r.replicas)
+
+	for m := range r.members {
+		replicas := r.replicas
+		if w, ok := r.weights[m]; ok {
+			replicas = int(w*float64(r.replicas) + 0.5)
+		}
+
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + m))
+
+			// On collision keep the smaller member, so the ring
+			// does not depend on the map iteration order.
+			if owner, ok := r.owners[h]; ok {
+				if m < owner {
+					r.owners[h] = m
+				}
+				continue
+			}
+
+			r.owners[h] = m
+			r.points = append(r.points, h)
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
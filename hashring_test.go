@@ -0,0 +1,65 @@
+package kite
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	r := NewHashRing(0)
+
+	if m := r.Get("key"); m != "" {
+		t.Fatalf("got %q, want empty member", m)
+	}
+
+	r.Add("a", "b", "c", "d")
+
+	const n = 10000
+
+	before := make(map[string]string, n)
+	counts := make(map[string]int)
+
+	for i := 0; i < n; i++ {
+		key := "user" + strconv.Itoa(i)
+		m := r.Get(key)
+
+		if m != r.Get(key) {
+			t.Fatalf("key %q is not mapped to the same member", key)
+		}
+
+		before[key] = m
+		counts[m]++
+	}
+
+	for _, m := range r.Members() {
+		if counts[m] < n/8 {
+			t.Errorf("member %q got %d keys, want at least %d", m, counts[m], n/8)
+		}
+	}
+
+	r.Remove("b")
+
+	for key, m := range before {
+		if got := r.Get(key); m != "b" && got != m {
+			t.Fatalf("key %q moved from %q to %q", key, m, got)
+		}
+	}
+
+	r.Add("b", "e")
+
+	moved := 0
+	for key, m := range before {
+		got := r.Get(key)
+
+		if got != m {
+			if got != "e" {
+				t.Fatalf("key %q moved from %q to %q", key, m, got)
+			}
+			moved++
+		}
+	}
+
+	if moved > n/3 {
+		t.Errorf("got %d keys moved, want at most %d", moved, n/3)
+	}
+}
@@ -0,0 +1,194 @@
+package kite
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout is the time a single health check may take,
+// if Kite.HealthCheckTimeout is zero.
+var DefaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheck checks a subsystem of the kite, like a database connection,
+// for the kite.health method.
+type HealthCheck interface {
+	// Check gives non-nil error if the subsystem is not healthy. It
+	// must return when the ctx is done.
+	Check(ctx context.Context) error
+}
+
+// HealthCheckFunc is an adapter to use ordinary functions as health checks.
+type HealthCheckFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Health describes the health of a kite, as returned by the kite.health
+// method.
+type Health struct {
+	// Live is true when the kite is able to serve calls. It is false
+	// only if the kite could not be reached.
+	Live bool `json:"live"`
+
+	// Ready is true when the kite should receive new calls: it is not
+	// draining and all its health checks passed.
+	Ready bool `json:"ready"`
+
+	// Draining is true when the kite is in drain mode.
+	Draining bool `json:"draining,omitempty"`
+
+	// Uptime is the time since the kite was created.
+	Uptime time.Duration `json:"uptime"`
+
+	// Build describes the kite binary.
+	Build BuildInfo `json:"build"`
+
+	// Checks holds results of the health checks, by their names.
+	Checks map[string]*HealthCheckResult `json:"checks,omitempty"`
+}
+
+// BuildInfo describes the kite binary.
+type BuildInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// HealthCheckResult is the result of a single health check.
+type HealthCheckResult struct {
+	// Healthy is true when the check passed.
+	Healthy bool `json:"healthy"`
+
+	// Error describes why the check failed.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the time the check took.
+	Duration time.Duration `json:"duration"`
+}
+
+// AddHealthCheck adds the health check reported by kite.health under
+// the given name, replacing the check added with the same name before.
+// A nil check removes it.
+func (k *Kite) AddHealthCheck(name string, check HealthCheck) {
+	k.healthMu.Lock()
+	defer k.healthMu.Unlock()
+
+	if check == nil {
+		delete(k.healthChecks, name)
+		return
+	}
+
+	k.healthChecks[name] = check
+}
+
+// Health runs the health checks concurrently and reports the health
+// of the kite.
+func (k *Kite) Health(ctx context.Context) *Health {
+	k.healthMu.Lock()
+	names := make([]string, 0, len(k.healthChecks))
+	checks := make([]HealthCheck, 0, len(k.healthChecks))
+	for name, check := range k.healthChecks {
+		names = append(names, name)
+		checks = append(checks, check)
+	}
+	k.healthMu.Unlock()
+
+	h := &Health{
+		Live:     true,
+		Draining: k.Draining(),
+		Uptime:   time.Since(k.started),
+		Build: BuildInfo{
+			Name:      k.name,
+			Version:   k.version,
+			GoVersion: runtime.Version(),
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+		},
+	}
+
+	results := make([]*HealthCheckResult, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			results[i] = k.runHealthCheck(ctx, check)
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	h.Ready = !h.Draining
+
+	if len(results) != 0 {
+		h.Checks = make(map[string]*HealthCheckResult, len(results))
+	}
+
+	for i, res := range results {
+		h.Checks[names[i]] = res
+		h.Ready = h.Ready && res.Healthy
+	}
+
+	return h
+}
+
+func (k *Kite) runHealthCheck(ctx context.Context, check HealthCheck) (res *HealthCheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, k.healthCheckTimeout())
+	defer cancel()
+
+	start := time.Now()
+
+	defer func() {
+		if v := recover(); v != nil {
+			res = &HealthCheckResult{Error: "health check panicked"}
+			k.Log.Error("health check panicked: %v", v)
+		}
+
+		res.Duration = time.Since(start)
+	}()
+
+	if err := check.Check(ctx); err != nil {
+		return &HealthCheckResult{Error: err.Error()}
+	}
+
+	return &HealthCheckResult{Healthy: true}
+}
+
+func (k *Kite) healthCheckTimeout() time.Duration {
+	if k.HealthCheckTimeout != 0 {
+		return k.HealthCheckTimeout
+	}
+
+	return DefaultHealthCheckTimeout
+}
+
+// handleHealth reports the health of the kite.
+func (k *Kite) handleHealth(r *Request) (interface{}, error) {
+	return k.Health(r.Ctx()), nil
+}
+
+// Health asks the remote kite for its health with a kite.health call.
+// Kites, which do not serve kite.health yet, fail it with an *Error of
+// "methodNotFound" type.
+func (c *Client) Health() (*Health, error) {
+	result, err := c.TellWithTimeout("kite.health", c.callTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	var h Health
+	if err := result.Unmarshal(&h); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
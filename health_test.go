@@ -0,0 +1,97 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestHealth(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("health-server", "0.0.1", cfg)
+	srv.HealthCheckTimeout = 50 * time.Millisecond
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("health-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	db := errors.New("connection refused")
+
+	srv.AddHealthCheck("db", HealthCheckFunc(func(context.Context) error { return db }))
+	srv.AddHealthCheck("cache", HealthCheckFunc(func(context.Context) error { return nil }))
+	srv.AddHealthCheck("slow", HealthCheckFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	h, err := c.Health()
+	if err != nil {
+		t.Fatalf("Health()=%s", err)
+	}
+
+	if !h.Live || h.Ready {
+		t.Fatalf("got live=%t ready=%t, want live and not ready", h.Live, h.Ready)
+	}
+
+	if h.Build.Name != "health-server" || h.Build.Version != "0.0.1" {
+		t.Fatalf("got build %+v", h.Build)
+	}
+
+	if h.Uptime <= 0 {
+		t.Fatalf("got uptime %s, want positive", h.Uptime)
+	}
+
+	want := map[string]string{
+		"db":    db.Error(),
+		"cache": "",
+		"slow":  context.DeadlineExceeded.Error(),
+	}
+
+	if len(h.Checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(h.Checks), len(want))
+	}
+
+	for name, e := range want {
+		res, ok := h.Checks[name]
+		if !ok {
+			t.Fatalf("check %q is missing", name)
+		}
+
+		if res.Healthy != (e == "") || res.Error != e {
+			t.Fatalf("%s: got %+v, want error %q", name, res, e)
+		}
+	}
+
+	srv.AddHealthCheck("db", nil)
+	srv.AddHealthCheck("slow", nil)
+
+	if h, err = c.Health(); err != nil {
+		t.Fatalf("Health()=%s", err)
+	}
+
+	if !h.Ready {
+		t.Fatalf("got %+v, want ready", h)
+	}
+
+	srv.SetDraining(true)
+
+	if h, err = c.Health(); err != nil {
+		t.Fatalf("Health()=%s", err)
+	}
+
+	if h.Ready || !h.Draining {
+		t.Fatalf("got ready=%t draining=%t, want draining", h.Ready, h.Draining)
+	}
+}
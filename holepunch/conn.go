@@ -0,0 +1,434 @@
+package holepunch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Dialer connects to peers through a coordinating kite.
+type Dialer struct {
+	// Timeout is the time to wait for a direct path, after which
+	// datagrams are relayed.
+	//
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// ProbeInterval is the time between probes sent to each candidate
+	// of the peer.
+	//
+	// If zero, DefaultProbeInterval is used.
+	ProbeInterval time.Duration
+
+	// RelayOnly, when true, disables direct paths.
+	RelayOnly bool
+}
+
+// Connect connects to the peer of the session with the default dialer.
+func Connect(ctx context.Context, c *kite.Client, session string) (*Conn, error) {
+	return (&Dialer{}).Connect(ctx, c, session)
+}
+
+// Connect joins the session on the coordinating kite the client is
+// connected to, and connects to the other peer of the session. It
+// returns once a direct path is found or the timeout of the dialer
+// elapses; in the latter case the connection uses the relay.
+func (d *Dialer) Connect(ctx context.Context, c *kite.Client, session string) (*Conn, error) {
+	conn := &Conn{
+		c:        c,
+		session:  session,
+		recv:     make(chan []byte, 64),
+		offered:  make(chan struct{}),
+		direct:   make(chan struct{}),
+		closed:   make(chan struct{}),
+		verified: make(map[string]bool),
+	}
+
+	args := &joinArgs{
+		Session: session,
+		Offer:   dnode.Callback(conn.onOffer),
+		Data:    dnode.Callback(conn.onRelay),
+	}
+
+	res, err := c.Tell("holepunch.join", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var r joinResult
+	if err := res.Unmarshal(&r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var candidates []string
+
+	if !d.RelayOnly {
+		if candidates, err = conn.listen(ctx, r.Reflector); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if _, err := c.Tell("holepunch.offer", &offerArgs{Session: session, Candidates: candidates}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !d.RelayOnly {
+		if err := conn.punch(ctx, d.timeout(), d.probeInterval()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (d *Dialer) timeout() time.Duration {
+	if d.Timeout != 0 {
+		return d.Timeout
+	}
+
+	return DefaultTimeout
+}
+
+func (d *Dialer) probeInterval() time.Duration {
+	if d.ProbeInterval != 0 {
+		return d.ProbeInterval
+	}
+
+	return DefaultProbeInterval
+}
+
+// Conn is a datagram connection to the peer of a session. Each Write
+// sends one datagram and each Read receives one; like over UDP,
+// datagrams may be lost or reordered.
+type Conn struct {
+	c       *kite.Client
+	session string
+	udp     *net.UDPConn // nil when relay only
+
+	recv      chan []byte
+	offered   chan struct{} // closed once candidates of the peer arrive
+	direct    chan struct{} // closed once the direct path is found
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	candidates []string        // of the peer
+	remote     *net.UDPAddr    // direct path to the peer
+	verified   map[string]bool // addresses, which answered probes
+}
+
+// Direct tells whether datagrams are sent over the direct path.
+func (c *Conn) Direct() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.remote != nil
+}
+
+// RemoteAddr gives the address of the peer on the direct path, or nil
+// if datagrams are relayed.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.remote == nil {
+		return nil
+	}
+
+	return c.remote
+}
+
+// Read reads the next datagram, discarding the bytes, which do not fit
+// into p.
+func (c *Conn) Read(p []byte) (int, error) {
+	select {
+	case data := <-c.recv:
+		return copy(p, data), nil
+	case <-c.closed:
+		return 0, ErrClosed
+	}
+}
+
+// Write sends p as one datagram.
+func (c *Conn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, ErrClosed
+	default:
+	}
+
+	c.mu.Lock()
+	remote := c.remote
+	c.mu.Unlock()
+
+	if remote != nil {
+		if _, err := c.udp.WriteToUDP(append([]byte{packetData}, p...), remote); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if _, err := c.c.Tell("holepunch.relay", &relayArgs{Session: c.session, Data: p}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection and leaves the session.
+func (c *Conn) Close() error {
+	err := ErrClosed
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+
+		if c.udp != nil {
+			c.udp.Close()
+		}
+
+		_, err = c.c.Tell("holepunch.leave", &leaveArgs{Session: c.session})
+	})
+
+	return err
+}
+
+// listen opens the UDP socket and gives the candidates it can be
+// reached at.
+func (c *Conn) listen(ctx context.Context, reflector string) ([]string, error) {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.udp = udp
+
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	candidates := hostCandidates(port)
+
+	if reflector != "" {
+		addr, err := c.reflect(ctx, reflector)
+		if err != nil {
+			c.c.LocalKite.Log.Debug("holepunch: unable to get reflexive address from %s: %s", reflector, err)
+		} else {
+			candidates = append(candidates, addr)
+		}
+	}
+
+	go c.readLoop()
+
+	return candidates, nil
+}
+
+// reflect asks the reflector for the address it sees the UDP socket
+// from.
+func (c *Conn) reflect(ctx context.Context, reflector string) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp", reflector)
+	if err != nil {
+		return "", err
+	}
+
+	defer c.udp.SetReadDeadline(time.Time{})
+
+	p := make([]byte, maxPacket)
+
+	for i := 0; i < 3; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if _, err := c.udp.WriteToUDP([]byte{packetReflect}, addr); err != nil {
+			return "", err
+		}
+
+		c.udp.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+		for {
+			n, from, err := c.udp.ReadFromUDP(p)
+			if err != nil {
+				break // timed out, retry
+			}
+
+			if n > 0 && p[0] == packetReflection && from.String() == addr.String() {
+				return string(p[1:n]), nil
+			}
+		}
+	}
+
+	return "", errors.New("reflector did not answer")
+}
+
+// punch sends probes to candidates of the peer, until one of them
+// answers or the timeout elapses.
+func (c *Conn) punch(ctx context.Context, timeout, interval time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-c.offered:
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	candidates := c.candidates
+	c.mu.Unlock()
+
+	var addrs []*net.UDPAddr
+
+	for _, candidate := range candidates {
+		addr, err := net.ResolveUDPAddr("udp", candidate)
+		if err != nil {
+			continue
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	probe := append([]byte{packetProbe}, c.session...)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		for _, addr := range addrs {
+			c.udp.WriteToUDP(probe, addr)
+		}
+
+		select {
+		case <-c.direct:
+			return nil
+		case <-tick.C:
+		case <-t.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// readLoop handles the packets received over the UDP socket.
+func (c *Conn) readLoop() {
+	p := make([]byte, maxPacket)
+
+	for {
+		n, from, err := c.udp.ReadFromUDP(p)
+		if err != nil {
+			return
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		switch p[0] {
+		case packetProbe:
+			if !bytes.Equal(p[1:n], []byte(c.session)) {
+				continue
+			}
+
+			c.mu.Lock()
+			c.verified[from.String()] = true
+			c.mu.Unlock()
+
+			ack := append([]byte{packetProbeAck}, c.session...)
+			c.udp.WriteToUDP(ack, from)
+		case packetProbeAck:
+			if !bytes.Equal(p[1:n], []byte(c.session)) {
+				continue
+			}
+
+			c.mu.Lock()
+			c.verified[from.String()] = true
+			if c.remote == nil {
+				c.remote = from
+				close(c.direct)
+			}
+			c.mu.Unlock()
+		case packetData:
+			c.mu.Lock()
+			ok := c.verified[from.String()]
+			c.mu.Unlock()
+
+			if ok {
+				c.deliver(append([]byte(nil), p[1:n]...))
+			}
+		}
+	}
+}
+
+func (c *Conn) onOffer(p *dnode.Partial) {
+	var candidates []string
+	if err := p.One().Unmarshal(&candidates); err != nil {
+		c.c.LocalKite.Log.Warning("holepunch: invalid offer: %s", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.offered:
+		return // offered already
+	default:
+	}
+
+	c.candidates = candidates
+	close(c.offered)
+}
+
+func (c *Conn) onRelay(p *dnode.Partial) {
+	var data []byte
+	if err := p.One().Unmarshal(&data); err != nil {
+		c.c.LocalKite.Log.Warning("holepunch: invalid datagram: %s", err)
+		return
+	}
+
+	c.deliver(data)
+}
+
+// deliver queues the datagram for Read, dropping it when the queue
+// is full.
+func (c *Conn) deliver(data []byte) {
+	select {
+	case c.recv <- data:
+	default:
+	}
+}
+
+// hostCandidates gives addresses of the interfaces with the given port.
+func hostCandidates(port int) []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		candidates = append(candidates, (&net.UDPAddr{IP: ipnet.IP, Port: port}).String())
+	}
+
+	return candidates
+}
@@ -0,0 +1,103 @@
+// Package holepunch connects two kites directly over UDP, when both are
+// behind NAT.
+//
+// Both kites connect to a coordinating kite, which they can reach, for
+// example the registry or the relay they already use. Each of them
+// gathers candidate addresses: addresses of its interfaces and the
+// address it is seen from by the UDP reflector of the coordinating kite.
+// The candidates are exchanged through the coordinating kite, after which
+// both kites send probes to all candidates of the other one, until one
+// of them is answered (ICE-lite).
+//
+// When no direct path is found, datagrams are relayed by the coordinating
+// kite, so callers do not have to handle the fallback.
+//
+// Coordinating kite:
+//
+//	k := kite.New("coordinator", "1.0.0")
+//	s := holepunch.NewServer(k)
+//	s.Reflector = "203.0.113.10:3478"
+//
+//	conn, err := net.ListenPacket("udp", ":3478")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	go s.ServeReflector(conn)
+//
+//	k.Run()
+//
+// Both peers, with the same unguessable session name:
+//
+//	conn, err := holepunch.Connect(ctx, c, session)
+//	if err != nil {
+//	    return err
+//	}
+//	defer conn.Close()
+//
+//	conn.Write([]byte("hello"))
+package holepunch
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var (
+	// DefaultTimeout is the time to wait for a direct path before falling
+	// back to the relay, if Dialer.Timeout is zero.
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultProbeInterval is the time between probes sent to each
+	// candidate, if Dialer.ProbeInterval is zero.
+	DefaultProbeInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrSessionFull is returned when a third kite joins a session.
+	ErrSessionFull = errors.New("session already has two peers")
+
+	// ErrNotJoined is returned for calls to a session, which the caller
+	// did not join.
+	ErrNotJoined = errors.New("session not joined")
+
+	// ErrClosed is returned when using a closed connection.
+	ErrClosed = errors.New("connection is closed")
+)
+
+// Packets sent over UDP start with one of the following bytes.
+const (
+	packetReflect    = 'r' // request for the reflexive address
+	packetReflection = 'R' // reflexive address
+	packetProbe      = 'p' // probe carrying the session name
+	packetProbeAck   = 'a' // answer to the probe
+	packetData       = 'd' // datagram
+)
+
+// maxPacket is the maximum size of a UDP packet.
+const maxPacket = 64 * 1024
+
+type joinArgs struct {
+	Session string         `json:"session"`
+	Offer   dnode.Function `json:"offer"` // called with candidates of the peer
+	Data    dnode.Function `json:"data"`  // called with relayed datagrams
+}
+
+type joinResult struct {
+	Reflector string `json:"reflector,omitempty"`
+}
+
+type offerArgs struct {
+	Session    string   `json:"session"`
+	Candidates []string `json:"candidates"`
+}
+
+type relayArgs struct {
+	Session string `json:"session"`
+	Data    []byte `json:"data"`
+}
+
+type leaveArgs struct {
+	Session string `json:"session"`
+}
@@ -0,0 +1,96 @@
+package holepunch_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/holepunch"
+)
+
+func TestConnect(t *testing.T) {
+	k := kite.New("coordinator", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv := holepunch.NewServer(k)
+
+	reflector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reflector.Close()
+
+	go srv.ServeReflector(reflector)
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	cases := map[string]struct {
+		dialers [2]*holepunch.Dialer
+		direct  bool
+	}{
+		"direct": {
+			dialers: [2]*holepunch.Dialer{{}, {}},
+			direct:  true,
+		},
+		"relay": {
+			dialers: [2]*holepunch.Dialer{{RelayOnly: true}, {Timeout: 300 * time.Millisecond}},
+			direct:  false,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			var conns [2]*holepunch.Conn
+			errs := make(chan error, 2)
+
+			for i, d := range cas.dialers {
+				c := kite.New("peer", "0.0.1").NewClient(ts.URL + "/kite")
+				if err := c.Dial(); err != nil {
+					t.Fatalf("Dial()=%s", err)
+				}
+				defer c.Close()
+
+				go func(i int, d *holepunch.Dialer) {
+					var err error
+					conns[i], err = d.Connect(context.Background(), c, name)
+					errs <- err
+				}(i, d)
+			}
+
+			for range conns {
+				if err := <-errs; err != nil {
+					t.Fatalf("Connect()=%s", err)
+				}
+			}
+
+			for i, conn := range conns {
+				defer conn.Close()
+
+				if conn.Direct() != cas.direct {
+					t.Fatalf("%d: got direct=%t, want %t", i, conn.Direct(), cas.direct)
+				}
+			}
+
+			for i, msg := range []string{"ping", "pong"} {
+				if _, err := conns[i].Write([]byte(msg)); err != nil {
+					t.Fatalf("Write()=%s", err)
+				}
+
+				p := make([]byte, 16)
+
+				n, err := conns[1-i].Read(p)
+				if err != nil {
+					t.Fatalf("Read()=%s", err)
+				}
+
+				if string(p[:n]) != msg {
+					t.Fatalf("got %q, want %q", p[:n], msg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package holepunch
+
+import (
+	"net"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Server coordinates sessions of kites connecting to each other. It
+// serves the following methods of the kite:
+//
+//	holepunch.join  - joins a session
+//	holepunch.offer - sends candidate addresses to the peer
+//	holepunch.relay - sends a datagram to the peer through the server
+//	holepunch.leave - leaves a session
+type Server struct {
+	// Reflector is the UDP address of ServeReflector, which is reachable
+	// by the peers.
+	//
+	// If empty, the local address of the connection passed to
+	// ServeReflector is used.
+	Reflector string
+
+	k        *kite.Kite
+	mu       sync.Mutex
+	sessions map[string]*session
+	conn     net.PacketConn // passed to ServeReflector
+}
+
+type session struct {
+	peers []*peer // at most two
+}
+
+type peer struct {
+	client *kite.Client
+	offer  dnode.Function
+	data   dnode.Function
+
+	candidates []string // nil until offered
+}
+
+// NewServer gives new server coordinating sessions with the given kite.
+func NewServer(k *kite.Kite) *Server {
+	s := &Server{
+		k:        k,
+		sessions: make(map[string]*session),
+	}
+
+	k.HandleFunc("holepunch.join", s.handleJoin)
+	k.HandleFunc("holepunch.offer", s.handleOffer)
+	k.HandleFunc("holepunch.relay", s.handleRelay)
+	k.HandleFunc("holepunch.leave", s.handleLeave)
+
+	return s
+}
+
+// ServeReflector answers the requests of peers for their reflexive
+// address, which is the address the server sees their packets from.
+// It returns when reading from the conn fails.
+func (s *Server) ServeReflector(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	p := make([]byte, maxPacket)
+
+	for {
+		n, addr, err := conn.ReadFrom(p)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 || p[0] != packetReflect {
+			continue
+		}
+
+		reply := append([]byte{packetReflection}, addr.String()...)
+
+		if _, err := conn.WriteTo(reply, addr); err != nil {
+			s.k.Log.Debug("holepunch: unable to reflect %s: %s", addr, err)
+		}
+	}
+}
+
+func (s *Server) handleJoin(r *kite.Request) (interface{}, error) {
+	var args joinArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[args.Session]
+	if !ok {
+		sess = &session{}
+		s.sessions[args.Session] = sess
+	}
+
+	if len(sess.peers) == 2 || sess.peer(r.Client) != nil {
+		return nil, ErrSessionFull
+	}
+
+	p := &peer{
+		client: r.Client,
+		offer:  args.Offer,
+		data:   args.Data,
+	}
+
+	sess.peers = append(sess.peers, p)
+
+	if other := sess.other(r.Client); other != nil && other.candidates != nil {
+		s.sendOffer(p, other.candidates)
+	}
+
+	r.Client.OnDisconnect(func() {
+		s.leave(args.Session, r.Client)
+	})
+
+	return &joinResult{Reflector: s.reflector()}, nil
+}
+
+func (s *Server) handleOffer(r *kite.Request) (interface{}, error) {
+	var args offerArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[args.Session]
+	if !ok || sess.peer(r.Client) == nil {
+		return nil, ErrNotJoined
+	}
+
+	candidates := args.Candidates
+	if candidates == nil {
+		candidates = []string{}
+	}
+
+	sess.peer(r.Client).candidates = candidates
+
+	if other := sess.other(r.Client); other != nil {
+		s.sendOffer(other, candidates)
+	}
+
+	return nil, nil
+}
+
+func (s *Server) handleRelay(r *kite.Request) (interface{}, error) {
+	var args relayArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessions[args.Session]
+	if !ok || sess.peer(r.Client) == nil {
+		s.mu.Unlock()
+		return nil, ErrNotJoined
+	}
+	other := sess.other(r.Client)
+	s.mu.Unlock()
+
+	// Datagrams may be lost, as they would be over UDP.
+	if other == nil || !other.data.IsValid() {
+		return nil, nil
+	}
+
+	return nil, other.data.Call(args.Data)
+}
+
+func (s *Server) handleLeave(r *kite.Request) (interface{}, error) {
+	var args leaveArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	s.leave(args.Session, r.Client)
+
+	return nil, nil
+}
+
+func (s *Server) leave(name string, c *kite.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[name]
+	if !ok {
+		return
+	}
+
+	for i, p := range sess.peers {
+		if p.client == c {
+			sess.peers = append(sess.peers[:i], sess.peers[i+1:]...)
+			break
+		}
+	}
+
+	if len(sess.peers) == 0 {
+		delete(s.sessions, name)
+	}
+}
+
+func (s *Server) sendOffer(p *peer, candidates []string) {
+	if !p.offer.IsValid() {
+		return
+	}
+
+	if err := p.offer.Call(candidates); err != nil {
+		s.k.Log.Debug("holepunch: unable to send offer: %s", err)
+	}
+}
+
+func (s *Server) reflector() string {
+	if s.Reflector != "" {
+		return s.Reflector
+	}
+
+	if s.conn != nil {
+		return s.conn.LocalAddr().String()
+	}
+
+	return ""
+}
+
+func (sess *session) peer(c *kite.Client) *peer {
+	for _, p := range sess.peers {
+		if p.client == c {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (sess *session) other(c *kite.Client) *peer {
+	for _, p := range sess.peers {
+		if p.client != c {
+			return p
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package kite
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite/dnode"
+)
+
+// IdleConnectionsReaped counts connections closed by the kite's server,
+// because they were idle for longer than Kite.IdleTimeout.
+var IdleConnectionsReaped = expvar.NewInt("kite.idleConnectionsReaped")
+
+// heartbeatMethods are not counted as traffic of a connection, neither
+// are callbacks passed with their calls.
+var heartbeatMethods = map[string]bool{
+	"kite.ping":      true,
+	"kite.heartbeat": true,
+	"kite.time":      true,
+	"kite.window":    true,
+}
+
+// idleState tracks the traffic of a connection.
+type idleState struct {
+	mu     sync.Mutex
+	last   time.Time       // of the last message, which was not a heartbeat
+	local  map[uint64]bool // callbacks sent with heartbeats, true if called repeatedly
+	remote map[uint64]bool // callbacks received with heartbeats, true if called repeatedly
+}
+
+// active records a message sent or received at the given time.
+func (s *idleState) active(t time.Time) {
+	s.mu.Lock()
+	s.last = t
+	s.mu.Unlock()
+}
+
+// lastActive gives the time of the last message, which was not
+// a heartbeat.
+func (s *idleState) lastActive() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// message records a message of the given method, which carries the
+// callbacks, sent to the remote kite if out is true, received otherwise.
+func (s *idleState) message(method interface{}, callbacks map[string]dnode.Path, out bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent, received := s.local, s.remote
+	if !out {
+		sent, received = received, sent
+	}
+
+	switch m := method.(type) {
+	case string:
+		if !heartbeatMethods[m] {
+			break
+		}
+
+		if sent == nil {
+			sent = make(map[uint64]bool)
+			if out {
+				s.local = sent
+			} else {
+				s.remote = sent
+			}
+		}
+
+		// The pinger of kite.heartbeat is called repeatedly, the other
+		// callbacks are response callbacks, called once.
+		for id := range callbacks {
+			if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+				sent[n] = m == "kite.heartbeat"
+			}
+		}
+
+		return
+	case float64:
+		if repeated, ok := received[uint64(m)]; ok {
+			if !repeated {
+				delete(received, uint64(m))
+			}
+			return
+		}
+	case uint64:
+		if repeated, ok := received[m]; ok {
+			if !repeated {
+				delete(received, m)
+			}
+			return
+		}
+	}
+
+	s.last = time.Now()
+}
+
+// watchIdle closes the session of the client connected to the kite's
+// server, once it has no traffic for IdleTimeout. The peer is notified
+// with the reason of the close. It returns a func stopping the watch.
+func (k *Kite) watchIdle(c *Client, session sockjs.Session) func() {
+	timeout := k.IdleTimeout
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	c.idle.active(time.Now())
+
+	var (
+		mu      sync.Mutex
+		stopped bool
+		t       *time.Timer
+	)
+
+	check := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		idle := time.Since(c.idle.lastActive())
+		if idle < timeout {
+			t.Reset(timeout - idle)
+			return
+		}
+
+		IdleConnectionsReaped.Add(1)
+		k.Log.Debug("closing connection %s idle for %s", session.ID(), idle)
+
+		if err := session.Close(3000, "Idle timeout"); err != nil {
+			k.Log.Debug("unable to close idle connection %s: %s", session.ID(), err)
+		}
+	}
+
+	mu.Lock()
+	t = time.AfterFunc(timeout, check)
+	mu.Unlock()
+
+	return func() {
+		mu.Lock()
+		stopped = true
+		t.Stop()
+		mu.Unlock()
+	}
+}
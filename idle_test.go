@@ -0,0 +1,81 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("idle-server", "0.0.1", cfg)
+	srv.IdleTimeout = 200 * time.Millisecond
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dial := func() (*Client, chan struct{}) {
+		c := New("idle-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+
+		disconnected := make(chan struct{})
+		c.OnDisconnect(func() {
+			close(disconnected)
+		})
+
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+
+		return c, disconnected
+	}
+
+	pinging, pingingDisconnected := dial()
+	defer pinging.Close()
+
+	working, workingDisconnected := dial()
+	defer working.Close()
+
+	reaped := IdleConnectionsReaped.Value()
+
+	deadline := time.Now().Add(600 * time.Millisecond)
+
+	for time.Now().Before(deadline) {
+		pinging.Go("kite.ping")
+
+		if _, err := working.Tell("echo", "hello"); err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	select {
+	case <-pingingDisconnected:
+	default:
+		t.Fatal("want connection with heartbeats only to be closed")
+	}
+
+	select {
+	case <-workingDisconnected:
+		t.Fatal("want connection with traffic to stay open")
+	default:
+	}
+
+	if n := IdleConnectionsReaped.Value() - reaped; n != 1 {
+		t.Fatalf("got %d reaped connections, want 1", n)
+	}
+
+	select {
+	case <-workingDisconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the idle connection to be closed")
+	}
+}
@@ -0,0 +1,184 @@
+package kite
+
+import (
+	"runtime"
+	"sort"
+)
+
+// Build metadata reported by kite.info. They are meant to be set at link
+// time, for example:
+//
+//	go build -ldflags "-X github.com/koding/kite.Commit=$(git rev-parse HEAD)"
+var (
+	// Commit is the revision the kite was built from.
+	Commit string
+
+	// BuildDate is the time the kite was built at.
+	BuildDate string
+)
+
+// Protocol features reported by kite.info, which remote kites may check
+// with Client.Supports before relying on them.
+const (
+	FeatureFlowControl = "flowControl" // credit-based flow control, kite.window
+	FeatureRequestID   = "requestId"   // request IDs echoed in responses
+	FeatureDedup       = "dedup"       // deduplication of retried calls
+	FeatureOperations  = "operations"  // long-running operations, kite.operation*
+	FeatureSigning     = "signing"     // signed calls
+	FeatureTimeSync    = "timeSync"    // kite.time
+	FeatureHealth      = "health"      // kite.health
+	FeatureDictionary  = "dictionary"  // arguments compressed with a dictionary
+	FeatureEncryption  = "encryption"  // arguments encrypted end-to-end
+)
+
+// features lists protocol features supported by the kite.
+var features = []string{
+	FeatureFlowControl,
+	FeatureRequestID,
+	FeatureDedup,
+	FeatureOperations,
+	FeatureSigning,
+	FeatureTimeSync,
+	FeatureHealth,
+	FeatureDictionary,
+	FeatureEncryption,
+}
+
+// Info describes a kite, as returned by the kite.info method.
+type Info struct {
+	// Name and Version are the name and the semantic version of the kite.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// Commit and BuildDate describe the build of the kite, if known.
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+
+	// GoVersion is the version of Go the kite was built with.
+	GoVersion string `json:"goVersion"`
+
+	// Features lists the supported protocol features.
+	Features []string `json:"features"`
+
+	// Capabilities lists the capabilities declared by the kite with
+	// DeclareCapabilities.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Dictionaries lists IDs of the dictionaries added with
+	// AddDictionary.
+	Dictionaries []string `json:"dictionaries,omitempty"`
+}
+
+// Supports tells whether the kite supports the protocol feature.
+func (i *Info) Supports(feature string) bool {
+	return contains(i.Features, feature)
+}
+
+// HasCapability tells whether the kite declared the capability.
+func (i *Info) HasCapability(name string) bool {
+	return contains(i.Capabilities, name)
+}
+
+// DeclareCapabilities adds application-defined capabilities reported by
+// kite.info, like "compression" or "search.v2", so remote kites can
+// check them with Client.HasCapability.
+func (k *Kite) DeclareCapabilities(names ...string) {
+	k.capabilitiesMu.Lock()
+	defer k.capabilitiesMu.Unlock()
+
+	for _, name := range names {
+		if !contains(k.capabilities, name) {
+			k.capabilities = append(k.capabilities, name)
+		}
+	}
+
+	sort.Strings(k.capabilities)
+}
+
+// Info describes the kite.
+func (k *Kite) Info() *Info {
+	k.capabilitiesMu.Lock()
+	capabilities := append([]string(nil), k.capabilities...)
+	k.capabilitiesMu.Unlock()
+
+	return &Info{
+		Name:         k.name,
+		Version:      k.version,
+		Commit:       Commit,
+		BuildDate:    BuildDate,
+		GoVersion:    runtime.Version(),
+		Features:     append([]string(nil), features...),
+		Capabilities: capabilities,
+		Dictionaries: k.dictionaryIDs(),
+	}
+}
+
+// handleInfo describes the kite.
+func (k *Kite) handleInfo(r *Request) (interface{}, error) {
+	return k.Info(), nil
+}
+
+// Info gives the info of the remote kite. It is asked for with a kite.info
+// call once per connection, and cached until the client disconnects.
+func (c *Client) Info() (*Info, error) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	if c.info != nil || c.infoErr != nil {
+		return c.info, c.infoErr
+	}
+
+	result, err := c.TellWithTimeout("kite.info", c.callTimeout())
+	if e, ok := err.(*Error); ok && e.Type == "methodNotFound" {
+		// The remote kite predates kite.info, there is no point in
+		// asking again until it reconnects.
+		c.infoErr = err
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var info Info
+	if err := result.Unmarshal(&info); err != nil {
+		return nil, err
+	}
+
+	c.info = &info
+
+	return c.info, nil
+}
+
+// Supports tells whether the remote kite supports the protocol feature.
+// It is false if the info of the remote kite could not be fetched.
+func (c *Client) Supports(feature string) bool {
+	info, err := c.Info()
+	return err == nil && info.Supports(feature)
+}
+
+// HasCapability tells whether the remote kite declared the capability.
+// It is false if the info of the remote kite could not be fetched.
+func (c *Client) HasCapability(name string) bool {
+	info, err := c.Info()
+	return err == nil && info.HasCapability(name)
+}
+
+// resetInfo drops the cached info, as the remote kite may be a different
+// build after reconnecting.
+func (c *Client) resetInfo() {
+	c.infoMu.Lock()
+	c.info = nil
+	c.infoErr = nil
+	c.infoMu.Unlock()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
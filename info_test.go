@@ -0,0 +1,57 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestInfo(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("info-server", "1.2.3", cfg)
+	srv.DeclareCapabilities("search.v2", "compression", "search.v2")
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("info-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	info, err := c.Info()
+	if err != nil {
+		t.Fatalf("Info()=%s", err)
+	}
+
+	if info.Name != "info-server" || info.Version != "1.2.3" {
+		t.Fatalf("got %s %s, want info-server 1.2.3", info.Name, info.Version)
+	}
+
+	if want := []string{"compression", "search.v2"}; !reflect.DeepEqual(info.Capabilities, want) {
+		t.Fatalf("got capabilities %v, want %v", info.Capabilities, want)
+	}
+
+	if !c.Supports(FeatureHealth) || c.Supports("teleport") {
+		t.Fatalf("got features %v", info.Features)
+	}
+
+	// The info is cached until the client disconnects.
+	srv.DeclareCapabilities("streaming")
+
+	if !c.HasCapability("compression") || c.HasCapability("streaming") {
+		t.Fatalf("got capabilities %v, want cached ones", info.Capabilities)
+	}
+
+	c.resetInfo()
+
+	if !c.HasCapability("streaming") {
+		t.Fatal("want streaming capability after reset")
+	}
+}
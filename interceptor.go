@@ -0,0 +1,115 @@
+package kite
+
+import (
+	"context"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// Call is an outgoing method call passed through interceptors of
+// a client.
+type Call struct {
+	// Client makes the call.
+	Client *Client
+
+	// Method is the name of the method called.
+	Method string
+
+	// Args are the arguments of the call.
+	Args []interface{}
+
+	// Timeout is the time to wait for the response. If zero, the
+	// deadline of the context, if any, or the default timeout of
+	// the client is used.
+	Timeout time.Duration
+}
+
+// Invoker makes the call, see Interceptor.
+type Invoker func(ctx context.Context, call *Call) (*dnode.Partial, error)
+
+// Interceptor wraps outgoing calls of a client, like PreHandle and
+// PostHandle wrap incoming calls of a kite, e.g. to inject credentials,
+// retry failed calls, collect metrics or trace calls.
+//
+// The interceptor makes the call with next, possibly with a modified
+// context or call, or more than once. The Call passed to next may be
+// a modified copy of the one the interceptor got. An interceptor
+// retrying calls should not retry calls with callbacks, as the remote
+// kite may have called them already.
+//
+// Example of an interceptor injecting a header-like argument:
+//
+//	func tenant(ctx context.Context, call *kite.Call, next kite.Invoker) (*dnode.Partial, error) {
+//		callCopy := *call
+//		callCopy.Args = append([]interface{}{tenantID}, call.Args...)
+//		return next(ctx, &callCopy)
+//	}
+type Interceptor func(ctx context.Context, call *Call, next Invoker) (*dnode.Partial, error)
+
+// WithInterceptors adds the interceptors to the outgoing calls of the
+// client. The interceptors are chained in the given order, the first
+// one is the outermost one. Calls of kite.* methods made internally,
+// e.g. heartbeats, are intercepted as well.
+func WithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// intercept makes the call through the chain of interceptors.
+//
+// The ctx may be nil.
+func (c *Client) intercept(ctx context.Context, method string, args []interface{}, timeout time.Duration) (*dnode.Partial, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	call := &Call{
+		Client:  c,
+		Method:  method,
+		Args:    args,
+		Timeout: timeout,
+	}
+
+	invoke := c.invoke
+
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		invoke = chainInterceptor(c.interceptors[i], invoke)
+	}
+
+	return invoke(ctx, call)
+}
+
+func chainInterceptor(interceptor Interceptor, next Invoker) Invoker {
+	return func(ctx context.Context, call *Call) (*dnode.Partial, error) {
+		return interceptor(ctx, call, next)
+	}
+}
+
+// invoke is the innermost Invoker, which sends the call.
+func (c *Client) invoke(ctx context.Context, call *Call) (*dnode.Partial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, call.Method)
+	}
+
+	timeout := call.Timeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := deadline.Sub(time.Now()); timeout == 0 || left < timeout {
+			timeout = left
+		}
+
+		if timeout <= 0 {
+			return nil, contextError(ctx, call.Method)
+		}
+	}
+
+	responseChan := make(chan *response, 1)
+
+	c.send(ctx, call.Method, call.Args, timeout, responseChan)
+
+	resp := <-responseChan
+
+	return resp.Result, resp.Err
+}
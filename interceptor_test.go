@@ -0,0 +1,96 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestInterceptors(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var calls int32
+
+	srv := NewWithConfig("interceptor-server", "0.0.1", cfg)
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("try again")
+		}
+
+		return r.Args.MustSliceOfLength(2)[0].MustString() + ":" + r.Args.MustSliceOfLength(2)[1].MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var trace []string
+
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, call *Call, next Invoker) (*dnode.Partial, error) {
+			mu.Lock()
+			trace = append(trace, name+" "+call.Method)
+			mu.Unlock()
+
+			return next(ctx, call)
+		}
+	}
+
+	retry := func(ctx context.Context, call *Call, next Invoker) (*dnode.Partial, error) {
+		result, err := next(ctx, call)
+		if err != nil {
+			return next(ctx, call)
+		}
+
+		return result, nil
+	}
+
+	tenant := func(ctx context.Context, call *Call, next Invoker) (*dnode.Partial, error) {
+		callCopy := *call
+		callCopy.Args = append([]interface{}{"tenant"}, call.Args...)
+
+		return next(ctx, &callCopy)
+	}
+
+	c := New("interceptor-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL),
+		WithInterceptors(record("outer"), retry),
+		WithInterceptors(record("inner"), tenant),
+	)
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	result, err := c.TellWithContext(ctx, "echo", "hello")
+	if err != nil {
+		t.Fatalf("TellWithContext()=%s", err)
+	}
+
+	if got := result.MustString(); got != "tenant:hello" {
+		t.Fatalf("got %q, want %q", got, "tenant:hello")
+	}
+
+	want := []string{"outer echo", "inner echo", "inner echo"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("got %v, want %v", trace, want)
+	}
+
+	cancel()
+
+	if _, err := c.TellWithContext(ctx, "echo", "hello"); err == nil {
+		t.Fatal("expected canceled call to fail")
+	}
+}
@@ -0,0 +1,146 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/koding/kite/dnode"
+)
+
+// InvalidMessage describes a received message, which could not be
+// dispatched to a method or a callback.
+type InvalidMessage struct {
+	// Client is the connection the message was received over.
+	Client *Client
+
+	// RemoteAddr is the address of the remote kite, if known.
+	RemoteAddr string
+
+	// Frame is the raw message.
+	Frame []byte
+
+	// Err tells why the message was not dispatched.
+	Err error
+
+	args *dnode.Partial // arguments with parsed callbacks, if decoded
+}
+
+// Reply sends the error back to the caller. It returns false when the
+// message does not carry a response callback, thus it is not possible
+// to reply.
+func (m *InvalidMessage) Reply(err *Error) bool {
+	if m.args == nil {
+		return false
+	}
+
+	args, e := m.args.Slice()
+	if e != nil || len(args) < 1 {
+		return false
+	}
+
+	var options callOptions
+	if e := args[0].Unmarshal(&options); e != nil {
+		return false
+	}
+
+	if options.ResponseCallback.Caller == nil {
+		return false
+	}
+
+	if e := options.ResponseCallback.Call(Response{Error: err, RequestID: options.RequestID}); e != nil {
+		m.Client.logger().Debug("unable to reply to %s: %s", m.RemoteAddr, e)
+	}
+
+	return true
+}
+
+func (c *Client) newInvalidMessage(data []byte, args *dnode.Partial, err error) *InvalidMessage {
+	return &InvalidMessage{
+		Client:     c,
+		RemoteAddr: c.RemoteAddr(),
+		Frame:      data,
+		Err:        err,
+		args:       args,
+	}
+}
+
+// recoverArgs decodes only the parts of a message, which could not be
+// decoded, needed to reply to it: the response callback and the request
+// ID. It returns nil, if the response callback cannot be found.
+func (c *Client) recoverArgs(data []byte) *dnode.Partial {
+	var fields map[string]*dnode.Partial
+	if err := c.codec().Unmarshal(data, &fields); err != nil || fields["callbacks"] == nil {
+		return nil
+	}
+
+	var callbacks map[string]*dnode.Partial
+	if err := fields["callbacks"].Unmarshal(&callbacks); err != nil {
+		return nil
+	}
+
+	for id, p := range callbacks {
+		var path dnode.Path
+		if p == nil || p.Unmarshal(&path) != nil || len(path) != 2 || path[0] != float64(0) || path[1] != "responseCallback" {
+			continue
+		}
+
+		type replyOptions struct {
+			RequestID string `json:"requestId,omitempty"`
+		}
+
+		// The request ID is sent back only if the options are decodable.
+		var options []replyOptions
+		if fields["arguments"] == nil || fields["arguments"].Unmarshal(&options) != nil || len(options) == 0 {
+			options = []replyOptions{{}}
+		}
+
+		raw, err := json.Marshal(options[:1])
+		if err != nil {
+			return nil
+		}
+
+		msg := &dnode.Message{
+			Arguments: &dnode.Partial{Raw: raw},
+			Callbacks: map[string]dnode.Path{id: path},
+		}
+
+		if err := dnode.ParseCallbacks(msg, c.callRemote); err != nil {
+			return nil
+		}
+
+		return msg.Arguments
+	}
+
+	return nil
+}
+
+// unknownMethod is called when a message calls a method, which is not
+// registered with the kite.
+func (c *Client) unknownMethod(data []byte, args *dnode.Partial, err error) {
+	m := c.newInvalidMessage(data, args, err)
+
+	if fn := c.LocalKite.OnUnknownMethod; fn != nil {
+		fn(m)
+		return
+	}
+
+	m.Reply(&Error{
+		Type:    "methodNotFound",
+		Message: err.Error(),
+	})
+}
+
+// decodeError is called when a message could not be decoded.
+func (c *Client) decodeError(data []byte, args *dnode.Partial, err error) {
+	m := c.newInvalidMessage(data, args, err)
+
+	if fn := c.LocalKite.OnDecodeError; fn != nil {
+		fn(m)
+		return
+	}
+
+	m.Reply(&Error{
+		Type:    "decodeError",
+		Message: fmt.Sprintf("unable to decode message: %s", err),
+	})
+}
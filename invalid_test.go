@@ -0,0 +1,84 @@
+package kite
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvalidMessage(t *testing.T) {
+	srv := New("invalid-server", "0.0.1")
+	srv.Config.DisableAuthentication = true
+	srv.HandleFunc("foo", func(r *Request) (interface{}, error) {
+		return "foo", nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("invalid-client", "0.0.1")
+
+	k.UseFrameFunc(func(f *Frame) error {
+		if f.Direction != Outgoing {
+			return nil
+		}
+
+		switch {
+		case bytes.Contains(f.Data, []byte(`"method":"broken"`)):
+			// Replace the method name with a value of invalid type.
+			f.Data = bytes.Replace(f.Data, []byte(`"method":"broken"`), []byte(`"method":true`), 1)
+		case bytes.Contains(f.Data, []byte(`"method":"malformed"`)):
+			// Add a callback with a path of invalid type.
+			f.Data = bytes.Replace(f.Data, []byte(`"callbacks":{`), []byte(`"callbacks":{"1000":"path",`), 1)
+		case bytes.Contains(f.Data, []byte(`"method":"badCallback"`)):
+			// Add a callback with an invalid ID.
+			f.Data = bytes.Replace(f.Data, []byte(`"callbacks":{`), []byte(`"callbacks":{"id":[0,"kite"],`), 1)
+		}
+
+		return nil
+	})
+
+	c := k.NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	cases := map[string]string{
+		"unknown":     "methodNotFound",
+		"broken":      "decodeError",
+		"malformed":   "decodeError",
+		"badCallback": "decodeError",
+	}
+
+	for method, typ := range cases {
+		_, err := c.Tell(method)
+		if e, ok := err.(*Error); !ok || e.Type != typ {
+			t.Fatalf("%s: got %v, want %s", method, err, typ)
+		}
+	}
+
+	msgs := make(chan *InvalidMessage, len(cases))
+
+	srv.OnUnknownMethod = func(m *InvalidMessage) {
+		msgs <- m
+		m.Reply(&Error{Type: "custom", Message: "unknown"})
+	}
+
+	srv.OnDecodeError = func(m *InvalidMessage) {
+		msgs <- m
+		m.Reply(&Error{Type: "custom", Message: "decode"})
+	}
+
+	for method := range cases {
+		_, err := c.Tell(method)
+		if e, ok := err.(*Error); !ok || e.Type != "custom" {
+			t.Fatalf("%s: got %v, want custom error", method, err)
+		}
+
+		m := <-msgs
+		if m.Err == nil || len(m.Frame) == 0 {
+			t.Fatalf("%s: got %+v, want error and frame", method, m)
+		}
+	}
+}
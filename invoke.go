@@ -0,0 +1,117 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/koding/cache"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// Invoke calls the handler of the method registered with the kite, as if
+// the kite called it itself, e.g. from a scheduler. Authentication is
+// skipped and the request is made on behalf of the kite's username.
+// The request's Client describes the kite itself, calls made with it
+// are dispatched to the kite with Invoke.
+//
+// The result is encoded as it would be sent to a remote caller.
+func (k *Kite) Invoke(ctx context.Context, method string, args ...interface{}) (*dnode.Partial, error) {
+	result, err := k.CallLocal(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnode.Partial{Raw: p}, nil
+}
+
+// CallLocal calls the handler of the method like Invoke does, but it
+// gives the result as returned by the handler, without encoding it.
+// It is a shortcut for reusing handler logic within the kite.
+//
+// The arguments are encoded, as they would be by a remote caller, unless
+// the ctx is given by WithPassByValue.
+func (k *Kite) CallLocal(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	m, ok := k.method(method)
+	if !ok {
+		return nil, dnode.MethodNotFoundError{Method: method}
+	}
+
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	partial := &dnode.Partial{Value: args}
+	serve := m.serve
+
+	if byValue, _ := ctx.Value(passByValueKey{}).(bool); byValue {
+		// The results are not cached, as they are cached by the
+		// encoded arguments.
+		serve = m.ServeKite
+	} else {
+		p, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+
+		partial = &dnode.Partial{Raw: p}
+	}
+
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	r := &Request{
+		ID:        utils.RandomString(16),
+		Method:    method,
+		Username:  k.Config.Username,
+		Args:      partial,
+		LocalKite: k,
+		Client:    k.loopbackClient(),
+		Context:   cache.NewMemory(),
+		ctx:       ctx,
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		r.Deadline = deadline
+	}
+
+	return serve(r)
+}
+
+type passByValueKey struct{}
+
+// WithPassByValue gives a context, which makes CallLocal pass the
+// arguments to the handler as they are, without encoding them. Handlers
+// read them from Request.Args as usual, see dnode.Partial.Value, and
+// can call callbacks created with dnode.Callback directly.
+func WithPassByValue(ctx context.Context) context.Context {
+	return context.WithValue(ctx, passByValueKey{}, true)
+}
+
+// loopbackClient gives a client describing the kite itself, which
+// dispatches the calls made with it to the kite, see Invoke.
+func (k *Kite) loopbackClient() *Client {
+	c := k.newClient("")
+	c.Kite = *k.Kite()
+	c.interceptors = []Interceptor{
+		func(ctx context.Context, call *Call, _ Invoker) (*dnode.Partial, error) {
+			if call.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, call.Timeout)
+				defer cancel()
+			}
+
+			return k.Invoke(ctx, call.Method, call.Args...)
+		},
+	}
+
+	return c
+}
@@ -0,0 +1,137 @@
+package kite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestCallLocal(t *testing.T) {
+	k := New("local", "0.0.1")
+
+	k.HandleFunc("double", func(r *Request) (interface{}, error) {
+		var p point
+		r.Args.One().MustUnmarshal(&p)
+		return &point{X: 2 * p.X, Y: 2 * p.Y}, nil
+	})
+
+	result, err := k.CallLocal(context.Background(), "double", point{X: 1, Y: 2})
+	if err != nil {
+		t.Fatalf("CallLocal()=%s", err)
+	}
+
+	if p, ok := result.(*point); !ok || *p != (point{X: 2, Y: 4}) {
+		t.Fatalf("got %#v, want &point{X: 2, Y: 4}", result)
+	}
+
+	partial, err := k.Invoke(context.Background(), "double", point{X: 1, Y: 2})
+	if err != nil {
+		t.Fatalf("Invoke()=%s", err)
+	}
+
+	var p point
+	if err := partial.Unmarshal(&p); err != nil || p != (point{X: 2, Y: 4}) {
+		t.Fatalf("got %+v (%v), want {X: 2, Y: 4}", p, err)
+	}
+
+	if _, err := k.CallLocal(context.Background(), "missing"); err == nil {
+		t.Fatal("want error calling missing method")
+	} else if _, ok := err.(dnode.MethodNotFoundError); !ok {
+		t.Fatalf("got %T, want dnode.MethodNotFoundError", err)
+	}
+}
+
+func TestCallLocal_Loopback(t *testing.T) {
+	k := New("local", "0.0.1")
+
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+
+	k.HandleFunc("squareTwice", func(r *Request) (interface{}, error) {
+		result, err := r.Client.TellWithTimeout("square", time.Second, r.Args.One().MustFloat64())
+		if err != nil {
+			return nil, err
+		}
+
+		return r.Client.Tell("square", result.MustFloat64())
+	})
+
+	k.HandleFunc("notify", func(r *Request) (interface{}, error) {
+		// Callbacks do not survive the encoding.
+		return nil, r.Args.One().MustFunction().Call("done")
+	})
+
+	result, err := k.Invoke(context.Background(), "squareTwice", 3)
+	if err != nil {
+		t.Fatalf("Invoke()=%s", err)
+	}
+
+	if n := result.MustFloat64(); n != 81 {
+		t.Fatalf("got %v, want 81", n)
+	}
+
+	if _, err := k.CallLocal(context.Background(), "notify", dnode.Callback(func(*dnode.Partial) {})); err == nil {
+		t.Fatal("want error calling an encoded callback")
+	}
+}
+
+func TestCallLocal_PassByValue(t *testing.T) {
+	k := New("local", "0.0.1")
+
+	type state struct {
+		calls int
+	}
+
+	k.HandleFunc("touch", func(r *Request) (interface{}, error) {
+		args := r.Args.MustSliceOfLength(2)
+
+		var s *state
+		args[0].MustUnmarshal(&s)
+		s.calls++
+
+		return s, args[1].MustFunction().Call("done", s.calls)
+	})
+
+	s := &state{}
+
+	var done []interface{}
+	callback := dnode.Callback(func(p *dnode.Partial) {
+		p.MustUnmarshal(&done)
+	})
+
+	ctx := WithPassByValue(context.Background())
+
+	result, err := k.CallLocal(ctx, "touch", s, callback)
+	if err != nil {
+		t.Fatalf("CallLocal()=%s", err)
+	}
+
+	if result != s || s.calls != 1 {
+		t.Fatalf("got %#v, want the argument passed by reference", result)
+	}
+
+	if len(done) != 2 || done[0] != "done" || done[1] != 1 {
+		t.Fatalf("got %v callback arguments, want [done 1]", done)
+	}
+
+	// Arguments not matching the types read by the handler are decoded.
+	k.HandleFunc("sum", func(r *Request) (interface{}, error) {
+		var sum float64
+		for _, arg := range r.Args.MustSlice() {
+			sum += arg.MustFloat64()
+		}
+		return sum, nil
+	})
+
+	if result, err := k.CallLocal(ctx, "sum", 1, 2.5, uint8(3)); err != nil || result != 6.5 {
+		t.Fatalf("got %v, %v, want 6.5", result, err)
+	}
+}
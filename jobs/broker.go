@@ -0,0 +1,479 @@
+package jobs
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+var (
+	// DefaultLeaseTimeout is the time a worker has to finish a job or
+	// report its progress, before the job is given to another worker,
+	// if Broker.LeaseTimeout is zero.
+	DefaultLeaseTimeout = 30 * time.Second
+
+	// DefaultMaxAttempts is the number of times a job is run before
+	// it is failed, if Broker.MaxAttempts is zero.
+	DefaultMaxAttempts = 3
+)
+
+// Broker distributes jobs to the registered workers. It serves the
+// following methods of the kite:
+//
+//	jobs.enqueue  - called by submitters to add a job
+//	jobs.register - called by workers to receive jobs of a queue
+//	jobs.progress - called by workers to report progress and renew a lease
+//	jobs.complete - called by workers to report the outcome of a job
+//
+// Jobs are kept in memory, thus they are lost when the broker exits.
+type Broker struct {
+	// LeaseTimeout is the time a worker has to finish a job or report
+	// its progress. Each progress report renews the lease.
+	//
+	// If zero, DefaultLeaseTimeout is used.
+	LeaseTimeout time.Duration
+
+	// MaxAttempts is the number of times a job is run before it is
+	// failed. Failed, expired and interrupted attempts are counted.
+	//
+	// If zero, DefaultMaxAttempts is used.
+	MaxAttempts int
+
+	k      *kite.Kite
+	mu     sync.Mutex
+	queues map[string]*queue
+	jobs   map[string]*job
+}
+
+type queue struct {
+	pending []*job
+	workers []*worker
+	next    int // worker to try first, for round-robin
+}
+
+type worker struct {
+	client *kite.Client
+	queue  string
+	run    dnode.Function
+	slots  int // number of jobs run at once
+	active map[string]*job
+}
+
+type job struct {
+	Job
+	events dnode.Function
+	worker *worker
+	timer  *time.Timer
+}
+
+// assignment is a job delivered to a worker outside of the broker lock.
+type assignment struct {
+	w   *worker
+	job Job
+}
+
+// NewBroker gives new broker serving jobs with the given kite.
+func NewBroker(k *kite.Kite) *Broker {
+	b := &Broker{
+		k:      k,
+		queues: make(map[string]*queue),
+		jobs:   make(map[string]*job),
+	}
+
+	k.HandleFunc("jobs.enqueue", b.handleEnqueue)
+	k.HandleFunc("jobs.register", b.handleRegister)
+	k.HandleFunc("jobs.progress", b.handleProgress)
+	k.HandleFunc("jobs.complete", b.handleComplete)
+
+	return b
+}
+
+// Pending gives the number of jobs of the queue waiting for a worker.
+func (b *Broker) Pending(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[queue]; ok {
+		return len(q.pending)
+	}
+
+	return 0
+}
+
+func (b *Broker) handleEnqueue(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Queue   string         `json:"queue"`
+		Payload *dnode.Partial `json:"payload"`
+		Events  dnode.Function `json:"events"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Queue == "" {
+		return nil, errors.New("queue is empty")
+	}
+
+	j := &job{
+		Job: Job{
+			ID:      utils.RandomString(16),
+			Queue:   args.Queue,
+			Payload: args.Payload,
+		},
+		events: args.Events,
+	}
+
+	b.mu.Lock()
+	b.jobs[j.ID] = j
+	q := b.queue(j.Queue)
+	q.pending = append(q.pending, j)
+	as := b.dispatch(q)
+	b.mu.Unlock()
+
+	b.deliver(as)
+
+	return &enqueueResult{ID: j.ID}, nil
+}
+
+func (b *Broker) handleRegister(r *kite.Request) (interface{}, error) {
+	var args registerArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Queue == "" {
+		return nil, errors.New("queue is empty")
+	}
+
+	if !args.Run.IsValid() {
+		return nil, errors.New("run callback is missing")
+	}
+
+	if args.Concurrency <= 0 {
+		args.Concurrency = 1
+	}
+
+	b.mu.Lock()
+	q := b.queue(args.Queue)
+
+	w := q.worker(r.Client)
+	if w == nil {
+		w = &worker{
+			client: r.Client,
+			queue:  args.Queue,
+			active: make(map[string]*job),
+		}
+
+		q.workers = append(q.workers, w)
+
+		r.Client.OnDisconnect(func() {
+			b.removeWorker(w)
+		})
+	}
+
+	w.run = args.Run
+	w.slots = args.Concurrency
+
+	as := b.dispatch(q)
+	b.mu.Unlock()
+
+	b.deliver(as)
+
+	return nil, nil
+}
+
+func (b *Broker) handleProgress(r *kite.Request) (interface{}, error) {
+	var args struct {
+		ID       string         `json:"id"`
+		Lease    string         `json:"lease"`
+		Progress *dnode.Partial `json:"progress"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	j, err := b.leased(args.ID, args.Lease)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	j.timer.Reset(b.leaseTimeout())
+
+	e := &Event{
+		JobID:    j.ID,
+		Type:     EventProgress,
+		Attempt:  j.Attempt,
+		Progress: args.Progress,
+	}
+	b.mu.Unlock()
+
+	b.notify(j, e)
+
+	return nil, nil
+}
+
+func (b *Broker) handleComplete(r *kite.Request) (interface{}, error) {
+	var args struct {
+		ID     string         `json:"id"`
+		Lease  string         `json:"lease"`
+		Result *dnode.Partial `json:"result"`
+		Error  *kite.Error    `json:"error"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Error != nil {
+		return nil, b.fail(args.ID, args.Lease, args.Error)
+	}
+
+	b.mu.Lock()
+	j, err := b.leased(args.ID, args.Lease)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	b.release(j)
+	delete(b.jobs, j.ID)
+
+	e := &Event{
+		JobID:   j.ID,
+		Type:    EventDone,
+		Attempt: j.Attempt,
+		Result:  args.Result,
+	}
+
+	as := b.dispatch(b.queue(j.Queue))
+	b.mu.Unlock()
+
+	b.notify(j, e)
+	b.deliver(as)
+
+	return nil, nil
+}
+
+// fail ends the current attempt of the job. The job is requeued, unless
+// it was its last attempt.
+func (b *Broker) fail(id, lease string, reason *kite.Error) error {
+	b.mu.Lock()
+	j, err := b.leased(id, lease)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	e := b.failLocked(j, reason)
+
+	as := b.dispatch(b.queue(j.Queue))
+	b.mu.Unlock()
+
+	b.notify(j, e)
+	b.deliver(as)
+
+	return nil
+}
+
+// failLocked is called with b.mu held. It gives the event to notify
+// the submitter with, once the lock is released.
+func (b *Broker) failLocked(j *job, reason *kite.Error) *Event {
+	b.release(j)
+
+	e := &Event{
+		JobID:   j.ID,
+		Type:    EventRetry,
+		Attempt: j.Attempt,
+		Error:   reason,
+	}
+
+	if j.Attempt >= b.maxAttempts() {
+		e.Type = EventFailed
+		delete(b.jobs, j.ID)
+	} else {
+		q := b.queue(j.Queue)
+		q.pending = append(q.pending, j)
+	}
+
+	return e
+}
+
+// expire is called when the lease of the job is not renewed in time.
+func (b *Broker) expire(id, lease string) {
+	err := b.fail(id, lease, &kite.Error{
+		Type:    "timeout",
+		Message: ErrLeaseExpired.Error(),
+	})
+
+	if err == nil {
+		b.k.Log.Warning("jobs: lease of job %s has expired", id)
+	}
+}
+
+// removeWorker requeues jobs of the disconnected worker.
+func (b *Broker) removeWorker(w *worker) {
+	b.mu.Lock()
+	q := b.queue(w.queue)
+
+	for i, other := range q.workers {
+		if other == w {
+			q.workers = append(q.workers[:i], q.workers[i+1:]...)
+			break
+		}
+	}
+
+	var (
+		failed []*job
+		events []*Event
+	)
+
+	for _, j := range w.active {
+		failed = append(failed, j)
+		events = append(events, b.failLocked(j, &kite.Error{
+			Type:    "disconnect",
+			Message: "worker has disconnected",
+		}))
+	}
+
+	as := b.dispatch(q)
+	b.mu.Unlock()
+
+	for i, j := range failed {
+		b.notify(j, events[i])
+	}
+
+	b.deliver(as)
+}
+
+// leased gives the job, if it is leased with the given lease.
+// It is called with b.mu held.
+func (b *Broker) leased(id, lease string) (*job, error) {
+	j, ok := b.jobs[id]
+	if !ok || j.worker == nil || j.Lease != lease {
+		return nil, ErrLeaseExpired
+	}
+
+	return j, nil
+}
+
+// release takes the job back from its worker. It is called with b.mu held.
+func (b *Broker) release(j *job) {
+	j.timer.Stop()
+	delete(j.worker.active, j.ID)
+	j.worker = nil
+	j.Lease = ""
+}
+
+// dispatch leases pending jobs of the queue to the workers with free
+// slots. It is called with b.mu held; the returned jobs must be
+// delivered after it is released.
+func (b *Broker) dispatch(q *queue) []assignment {
+	var as []assignment
+
+	for len(q.pending) != 0 {
+		w := q.free()
+		if w == nil {
+			break
+		}
+
+		j := q.pending[0]
+		q.pending = q.pending[1:]
+
+		id, lease := j.ID, utils.RandomString(16)
+
+		j.worker = w
+		j.Lease = lease
+		j.Attempt++
+		j.timer = time.AfterFunc(b.leaseTimeout(), func() { b.expire(id, lease) })
+		w.active[j.ID] = j
+
+		as = append(as, assignment{w: w, job: j.Job})
+	}
+
+	return as
+}
+
+func (b *Broker) deliver(as []assignment) {
+	for _, a := range as {
+		if err := a.w.run.Call(&a.job); err != nil {
+			b.k.Log.Warning("jobs: unable to deliver job %s: %s", a.job.ID, err)
+
+			b.fail(a.job.ID, a.job.Lease, &kite.Error{
+				Type:    "sendError",
+				Message: err.Error(),
+			})
+		}
+	}
+}
+
+func (b *Broker) notify(j *job, e *Event) {
+	if !j.events.IsValid() {
+		return
+	}
+
+	if err := j.events.Call(e); err != nil {
+		b.k.Log.Debug("jobs: unable to notify about job %s: %s", j.ID, err)
+	}
+}
+
+// queue gives the queue with the given name, creating it if needed.
+// It is called with b.mu held.
+func (b *Broker) queue(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{}
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+func (b *Broker) leaseTimeout() time.Duration {
+	if b.LeaseTimeout != 0 {
+		return b.LeaseTimeout
+	}
+
+	return DefaultLeaseTimeout
+}
+
+func (b *Broker) maxAttempts() int {
+	if b.MaxAttempts != 0 {
+		return b.MaxAttempts
+	}
+
+	return DefaultMaxAttempts
+}
+
+// worker gives the worker registered over the given connection.
+func (q *queue) worker(c *kite.Client) *worker {
+	for _, w := range q.workers {
+		if w.client == c {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// free gives the next worker with a free slot, if any.
+func (q *queue) free() *worker {
+	for i := range q.workers {
+		w := q.workers[(q.next+i)%len(q.workers)]
+
+		if len(w.active) < w.slots {
+			q.next = (q.next + i + 1) % len(q.workers)
+			return w
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+// Package jobs implements a job queue on top of kite RPC.
+//
+// A broker kite accepts jobs from submitters and distributes them to
+// worker kites, which register themselves for a queue. Each job is leased
+// to a single worker at a time; a job whose lease expires, or whose worker
+// fails or disconnects, is retried on another worker. Progress and the
+// outcome of the job are streamed back to the submitter.
+//
+// Broker:
+//
+//	k := kite.New("broker", "1.0.0")
+//	jobs.NewBroker(k)
+//	k.Run()
+//
+// Worker:
+//
+//	w := &jobs.Worker{
+//	    Queue: "thumbnails",
+//	    Handler: func(t *jobs.Task) (interface{}, error) {
+//	        t.Progress("resizing")
+//	        return resize(t.Payload)
+//	    },
+//	}
+//
+//	err := w.Register(brokerClient)
+//
+// Submitter:
+//
+//	result, err := jobs.Run(ctx, brokerClient, "thumbnails", image, func(e *jobs.Event) {
+//	    fmt.Println("progress:", e.Progress)
+//	})
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// ErrLeaseExpired is returned to a worker reporting on a job, which is no
+// longer leased to it.
+var ErrLeaseExpired = errors.New("job lease has expired")
+
+// Job is a unit of work delivered to a worker.
+type Job struct {
+	// ID uniquely identifies the job.
+	ID string `json:"id"`
+
+	// Queue the job was enqueued to.
+	Queue string `json:"queue"`
+
+	// Payload is the value passed by the submitter.
+	Payload *dnode.Partial `json:"payload"`
+
+	// Attempt is the number of the current attempt, starting with 1.
+	Attempt int `json:"attempt"`
+
+	// Lease identifies the current attempt. Reports of the worker
+	// are rejected once the lease expires.
+	Lease string `json:"lease"`
+}
+
+// EventType describes what happened to a job.
+type EventType string
+
+const (
+	EventProgress EventType = "progress" // the worker reported progress
+	EventRetry    EventType = "retry"    // the attempt failed, job is requeued
+	EventDone     EventType = "done"     // the job finished successfully
+	EventFailed   EventType = "failed"   // the last attempt failed
+)
+
+// Event is sent to the submitter of a job.
+type Event struct {
+	JobID    string         `json:"jobId"`
+	Type     EventType      `json:"type"`
+	Attempt  int            `json:"attempt"`
+	Progress *dnode.Partial `json:"progress,omitempty"`
+	Result   *dnode.Partial `json:"result,omitempty"`
+	Error    *kite.Error    `json:"error,omitempty"`
+}
+
+// Finished returns true for the last event of the job.
+func (e *Event) Finished() bool {
+	return e.Type == EventDone || e.Type == EventFailed
+}
+
+type enqueueArgs struct {
+	Queue   string         `json:"queue"`
+	Payload interface{}    `json:"payload"`
+	Events  dnode.Function `json:"events"`
+}
+
+type enqueueResult struct {
+	ID string `json:"id"`
+}
+
+type registerArgs struct {
+	Queue       string         `json:"queue"`
+	Concurrency int            `json:"concurrency"`
+	Run         dnode.Function `json:"run"`
+}
+
+type progressArgs struct {
+	ID       string      `json:"id"`
+	Lease    string      `json:"lease"`
+	Progress interface{} `json:"progress"`
+}
+
+type completeArgs struct {
+	ID     string      `json:"id"`
+	Lease  string      `json:"lease"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *kite.Error `json:"error,omitempty"`
+}
+
+// Enqueue submits a job with the given payload to the queue of the broker
+// kite the client is connected to. It returns the ID of the job.
+//
+// The events function, when non-nil, is called with progress reports and
+// the outcome of the job, for as long as the client stays connected.
+func Enqueue(c *kite.Client, queue string, payload interface{}, events func(*Event)) (string, error) {
+	args := &enqueueArgs{
+		Queue:   queue,
+		Payload: payload,
+	}
+
+	if events != nil {
+		args.Events = dnode.Callback(func(p *dnode.Partial) {
+			var e Event
+			if err := p.One().Unmarshal(&e); err != nil {
+				c.LocalKite.Log.Warning("jobs: invalid event: %s", err)
+				return
+			}
+
+			events(&e)
+		})
+	}
+
+	res, err := c.Tell("jobs.enqueue", args)
+	if err != nil {
+		return "", err
+	}
+
+	var r enqueueResult
+	if err := res.Unmarshal(&r); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
+
+// Run submits a job like Enqueue does and waits until it is finished
+// or the ctx is done. It returns the result of the job, or the error
+// of its last attempt.
+func Run(ctx context.Context, c *kite.Client, queue string, payload interface{}, events func(*Event)) (*dnode.Partial, error) {
+	done := make(chan *Event, 1)
+
+	_, err := Enqueue(c, queue, payload, func(e *Event) {
+		if events != nil {
+			events(e)
+		}
+
+		if e.Finished() {
+			done <- e
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case e := <-done:
+		if e.Error != nil {
+			return nil, e.Error
+		}
+
+		return e.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
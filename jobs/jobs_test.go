@@ -0,0 +1,138 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/jobs"
+)
+
+func dial(t *testing.T, name, url string) *kite.Client {
+	c := kite.New(name, "0.0.1").NewClient(url + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	return c
+}
+
+func TestJobs(t *testing.T) {
+	k := kite.New("broker", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	b := jobs.NewBroker(k)
+	b.LeaseTimeout = 500 * time.Millisecond
+	b.MaxAttempts = 2
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	expired := make(chan error, 1)
+
+	w := &jobs.Worker{
+		Queue:       "test",
+		Concurrency: 2,
+		Handler: func(t *jobs.Task) (interface{}, error) {
+			var payload string
+			if err := t.Payload.Unmarshal(&payload); err != nil {
+				return nil, err
+			}
+
+			switch payload {
+			case "fail":
+				return nil, errors.New("failed")
+			case "retry":
+				if t.Attempt == 1 {
+					return nil, errors.New("failed")
+				}
+			case "expire":
+				if t.Attempt == 1 {
+					time.Sleep(2 * b.LeaseTimeout)
+
+					expired <- t.Progress("late")
+
+					return nil, nil
+				}
+			}
+
+			if err := t.Progress("half"); err != nil {
+				return nil, err
+			}
+
+			return payload + " done", nil
+		},
+	}
+
+	worker := dial(t, "worker", ts.URL)
+	defer worker.Close()
+
+	if err := w.Register(worker); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	submitter := dial(t, "submitter", ts.URL)
+	defer submitter.Close()
+
+	cases := map[string]struct {
+		events []jobs.EventType
+		err    bool
+	}{
+		"ok":     {events: []jobs.EventType{jobs.EventProgress, jobs.EventDone}},
+		"retry":  {events: []jobs.EventType{jobs.EventRetry, jobs.EventProgress, jobs.EventDone}},
+		"expire": {events: []jobs.EventType{jobs.EventRetry, jobs.EventProgress, jobs.EventDone}},
+		"fail":   {events: []jobs.EventType{jobs.EventRetry, jobs.EventFailed}, err: true},
+	}
+
+	for payload, cas := range cases {
+		t.Run(payload, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var events []jobs.EventType
+
+			result, err := jobs.Run(ctx, submitter, "test", payload, func(e *jobs.Event) {
+				events = append(events, e.Type)
+			})
+
+			if cas.err {
+				if err == nil {
+					t.Fatal("want error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Run()=%s", err)
+				}
+
+				if s := result.MustString(); s != payload+" done" {
+					t.Fatalf("got %q, want %q", s, payload+" done")
+				}
+			}
+
+			if len(events) != len(cas.events) {
+				t.Fatalf("got %v events, want %v", events, cas.events)
+			}
+
+			for i := range events {
+				if events[i] != cas.events[i] {
+					t.Fatalf("got %v events, want %v", events, cas.events)
+				}
+			}
+		})
+	}
+
+	select {
+	case err := <-expired:
+		if err != jobs.ErrLeaseExpired {
+			t.Fatalf("got %v, want %v", err, jobs.ErrLeaseExpired)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the expired attempt")
+	}
+
+	if n := b.Pending("test"); n != 0 {
+		t.Fatalf("got %d pending jobs, want 0", n)
+	}
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Handler runs a job. The returned result or error is reported to
+// the broker as the outcome of the job.
+type Handler func(*Task) (result interface{}, err error)
+
+// Task is a job being run by a worker.
+type Task struct {
+	Job
+
+	c *kite.Client
+}
+
+// Progress reports the progress of the job to its submitter. It also
+// renews the lease, so long-running jobs should report their progress
+// more often than the lease timeout of the broker.
+//
+// It returns ErrLeaseExpired if the job was given to another worker;
+// the handler should stop running the job then.
+func (t *Task) Progress(v interface{}) error {
+	_, err := t.c.Tell("jobs.progress", &progressArgs{
+		ID:       t.ID,
+		Lease:    t.Lease,
+		Progress: v,
+	})
+
+	return leaseError(err)
+}
+
+// Worker runs jobs of a queue, which are distributed by a broker.
+type Worker struct {
+	// Queue is the name of the queue to run jobs of.
+	//
+	// Required.
+	Queue string
+
+	// Concurrency is the number of jobs run at once.
+	//
+	// If zero, 1 is used.
+	Concurrency int
+
+	// Handler runs the jobs.
+	//
+	// Required.
+	Handler Handler
+}
+
+// Register registers the worker with the broker kite the client is
+// connected to. The registration is renewed each time the client
+// reconnects, thus the client should be dialed with reconnection
+// enabled.
+func (w *Worker) Register(c *kite.Client) error {
+	if w.Queue == "" {
+		return errors.New("jobs: queue is empty")
+	}
+
+	if w.Handler == nil {
+		return errors.New("jobs: handler is nil")
+	}
+
+	if err := w.register(c); err != nil {
+		return err
+	}
+
+	c.OnConnect(func() {
+		if err := w.register(c); err != nil {
+			c.LocalKite.Log.Error("jobs: unable to register worker for %q queue: %s", w.Queue, err)
+		}
+	})
+
+	return nil
+}
+
+func (w *Worker) register(c *kite.Client) error {
+	_, err := c.Tell("jobs.register", &registerArgs{
+		Queue:       w.Queue,
+		Concurrency: w.Concurrency,
+		Run: dnode.Callback(func(p *dnode.Partial) {
+			var job Job
+			if err := p.One().Unmarshal(&job); err != nil {
+				c.LocalKite.Log.Warning("jobs: invalid job: %s", err)
+				return
+			}
+
+			go w.run(c, &job)
+		}),
+	})
+
+	return err
+}
+
+func (w *Worker) run(c *kite.Client, job *Job) {
+	t := &Task{
+		Job: *job,
+		c:   c,
+	}
+
+	result, err := w.call(t)
+
+	args := &completeArgs{
+		ID:     job.ID,
+		Lease:  job.Lease,
+		Result: result,
+	}
+
+	if err != nil {
+		args.Error = toError(err)
+	}
+
+	if _, err := c.Tell("jobs.complete", args); err != nil {
+		c.LocalKite.Log.Warning("jobs: unable to complete job %s: %s", job.ID, leaseError(err))
+	}
+}
+
+// call runs the handler, recovering from its panics.
+func (w *Worker) call(t *Task) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("handler panicked: %v", v)
+		}
+	}()
+
+	return w.Handler(t)
+}
+
+// leaseError gives ErrLeaseExpired for the error of the broker, which
+// rejected a report of the worker.
+func leaseError(err error) error {
+	if e, ok := err.(*kite.Error); ok && e.Message == ErrLeaseExpired.Error() {
+		return ErrLeaseExpired
+	}
+
+	return err
+}
+
+func toError(err error) *kite.Error {
+	if e, ok := err.(*kite.Error); ok {
+		return e
+	}
+
+	return &kite.Error{
+		Type:    "genericError",
+		Message: err.Error(),
+	}
+}
@@ -5,6 +5,8 @@ package kite
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/cipher"
 	"crypto/rsa"
 	"crypto/tls"
 	"errors"
@@ -15,6 +17,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/koding/kite/config"
@@ -27,6 +30,7 @@ import (
 	"github.com/koding/cache"
 	"github.com/koding/kite/sockjsclient"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/ed25519"
 )
 
 var hostname string
@@ -71,15 +75,279 @@ type Kite struct {
 	ClientFunc func(*sockjsclient.DialOptions) *http.Client
 
 	// Handlers added with Kite.HandleFunc().
-	handlers     map[string]*Method // method map for exported methods
-	preHandlers  []Handler          // a list of handlers that are executed before any handler
-	postHandlers []Handler          // a list of handlers that are executed after any handler
-	finalFuncs   []FinalFunc        // a list of funcs executed after any handler regardless of the error
+	methods      *methodTable // method map for exported methods, shared by copies
+	preHandlers  []Handler    // a list of handlers that are executed before any handler
+	postHandlers []Handler    // a list of handlers that are executed after any handler
+	finalFuncs   []FinalFunc  // a list of funcs executed after any handler regardless of the error
 
 	// MethodHandling defines how the kite is returning the response for
 	// multiple handlers
 	MethodHandling MethodHandling
 
+	// OperationStore is used to persist statuses of long-running operations
+	// started with methods registered by HandleOperation.
+	//
+	// If nil, an in-memory store is used.
+	OperationStore OperationStore
+
+	defaultOperationStore OperationStore
+	operations            map[string]*Operation // running operations
+	operationsMu          sync.Mutex            // protects operations
+
+	// SessionStore is used to persist sessions of callers, see
+	// Request.Session.
+	//
+	// If nil, an in-memory store is used.
+	SessionStore SessionStore
+
+	// SessionTTL is the time a session is kept after it was last
+	// modified.
+	//
+	// If zero, DefaultSessionTTL is used.
+	SessionTTL time.Duration
+
+	defaultSessionStore SessionStore
+
+	// DedupStore records processed messages, so calls retried with the
+	// same message ID are not run twice, see WithMessageID.
+	//
+	// If nil, calls are not deduplicated.
+	DedupStore DedupStore
+
+	// DedupTTL is the time a processed message is remembered.
+	//
+	// If zero, DefaultDedupTTL is used.
+	DedupTTL time.Duration
+
+	dedupInflight map[string]chan struct{} // messages being processed
+	dedupMu       sync.Mutex               // protects dedupInflight
+
+	// Quota, when non-nil, limits usage of the kite by each caller,
+	// see SetCallerQuota for overriding it for selected callers.
+	Quota *Quota
+
+	// QuotaStore keeps usage of quotas, see Quota.
+	//
+	// If nil, an in-memory store is used.
+	QuotaStore QuotaStore
+
+	defaultQuotaStore QuotaStore
+	quotas            map[string]*Quota // username -> quota, see SetCallerQuota
+	quotasMu          sync.RWMutex      // protects quotas
+
+	// Redact, when non-nil, is used to mask secrets in JSON-encoded
+	// messages before they are logged.
+	//
+	// If nil, values of keys listed in DefaultRedactKeys, added with
+	// RedactKeys or tagged in types registered with RedactType are
+	// replaced with RedactedValue.
+	Redact func(p []byte) []byte
+
+	redactKeys map[string]bool // lower-cased keys added with RedactKeys
+	redactMu   sync.RWMutex    // protects redactKeys
+
+	// SigningKey, when non-nil, is used to sign method calls made by the
+	// kite, so the receiving kites can attribute them to the key owner.
+	SigningKey ed25519.PrivateKey
+
+	// Signer, when non-nil, is used to sign method calls instead of
+	// SigningKey, e.g. with a key held in an HSM, a PKCS#11 module or
+	// a cloud KMS. Ed25519, ECDSA P-256 and RSA keys are supported.
+	Signer crypto.Signer
+
+	// SigningKeyID identifies SigningKey to the receiving kites,
+	// see TrustSigningKey.
+	SigningKeyID string
+
+	// SigningEncoding is the encoding of the envelopes of calls, which
+	// are signed, SigningJSON or SigningCBOR. The deterministic CBOR
+	// encoding does not depend on how JSON numbers or strings are
+	// formatted, but it requires the receiving kites to support it.
+	//
+	// If empty, SigningJSON is used.
+	SigningEncoding string
+
+	// MaxSignatureAge is the maximum difference between the time a call
+	// was signed and the time it is received, so captured calls cannot
+	// be replayed later. The signing time is converted to the local clock,
+	// if the clock difference to the caller was measured with
+	// Client.SyncTime.
+	//
+	// If zero, the signing time is not checked.
+	MaxSignatureAge time.Duration
+
+	// Audit, when non-nil, is called for each received call with
+	// a verified signature.
+	//
+	// If nil, the calls are logged with Log.Info.
+	Audit func(*AuditRecord)
+
+	// ConnectionFilter, when non-nil, refuses connections from addresses
+	// it does not accept.
+	ConnectionFilter *ConnectionFilter
+
+	// Lockout, when non-nil, locks out callers after repeated failed
+	// authentication attempts.
+	Lockout *Lockout
+
+	// OnConnectionDenied, when non-nil, is called for each connection
+	// refused by ConnectionFilter.
+	//
+	// If nil, the connections are logged with Log.Info.
+	OnConnectionDenied func(*DeniedConnection)
+
+	signingKeys map[string]crypto.PublicKey // keys added with TrustSigningKey
+	signingMu   sync.RWMutex                // protects signingKeys
+
+	// PayloadPolicy tells how calls of methods must be protected, both
+	// sent and received by the kite. It is overridden for single methods
+	// with SetMethodPolicy.
+	//
+	// If zero, calls may be neither signed nor encrypted.
+	PayloadPolicy PayloadPolicy
+
+	// EncryptionKeyID identifies the key added with AddEncryptionKey,
+	// which encrypts calls required to be encrypted by the policy.
+	EncryptionKeyID string
+
+	encryptionKeys map[string]cipher.AEAD   // added with AddEncryptionKey
+	methodPolicies map[string]PayloadPolicy // set with SetMethodPolicy
+	policyMu       sync.RWMutex             // protects the fields above
+
+	// OnUnknownMethod, when non-nil, is called from the receiving goroutine
+	// for each received call of a method, which is not registered.
+	//
+	// If nil, a "methodNotFound" error is sent back to the caller.
+	OnUnknownMethod func(*InvalidMessage)
+
+	// OnDecodeError, when non-nil, is called from the receiving goroutine
+	// for each received message, which could not be decoded.
+	//
+	// If nil, a "decodeError" error is sent back to the caller, if the
+	// message carries a response callback.
+	OnDecodeError func(*InvalidMessage)
+
+	// StrictProtocol makes the kite close connections, over which messages
+	// deviating from the dnode protocol are received, e.g. with missing
+	// fields, fields of wrong types or unknown top-level fields, see
+	// dnode.CheckMessage. The connection is closed with the
+	// CloseProtocolError code and a reason describing the deviation.
+	// It is useful for validating third-party client implementations.
+	//
+	// If false, such messages are decoded leniently.
+	StrictProtocol bool
+
+	// MaxClockSkew is the clock difference to a remote kite, above which
+	// a warning is logged when measured with Client.SyncTime, and the
+	// difference is not tolerated.
+	//
+	// If zero, DefaultMaxClockSkew is used.
+	MaxClockSkew time.Duration
+
+	// CallbackLeakThreshold is the age, above which callbacks sent to
+	// remote kites, which were never called nor removed, are reported
+	// as leaked. It must be set before clients are created.
+	//
+	// If zero, DefaultCallbackLeakThreshold is used.
+	CallbackLeakThreshold time.Duration
+
+	frameMiddlewares []FrameMiddleware // added with UseFrame
+	framesMu         sync.RWMutex      // protects frameMiddlewares
+
+	// URLs are additional URLs the kite registers with, next to the one
+	// passed to Register, e.g. an internal IP for kites in the same
+	// network and an IPv6 address. They must be set before registering.
+	URLs []protocol.AdvertisedURL
+
+	// URLPreference selects the URL used to connect to kites found with
+	// GetKites, which registered with additional URLs. The first URL
+	// having all labels of the earliest matching element is used, e.g.
+	// []map[string]string{{"network": "internal"}}.
+	//
+	// If no element matches, URLs with hosts in a network of a local
+	// interface are preferred, otherwise the URL passed to Register
+	// is used.
+	URLPreference []map[string]string
+
+	// STUNServers are asked for the public IP of the kite, see PublicIP.
+	//
+	// If nil, DefaultSTUNServers is used.
+	STUNServers []string
+
+	// Admins lists usernames allowed to call kite.admin.* methods.
+	//
+	// If empty, only the owner of the kite (Config.Username) is allowed.
+	Admins []string
+
+	// IdleTimeout is the time after which connections to the kite's
+	// server, which had no traffic other than heartbeats, are closed.
+	// Use it to bound the number of open connections of kites serving
+	// many clients.
+	//
+	// If zero, idle connections are not closed.
+	IdleTimeout time.Duration
+
+	clients   map[string]*connectedClient // clients connected to the server, by session ID
+	clientsMu sync.Mutex                  // protects clients
+	draining  int32                       // 1 if in drain mode, see SetDraining
+	profiling int32                       // 1 if profiling is enabled, see EnableProfiling
+
+	// HealthCheckTimeout is the time a single health check added with
+	// AddHealthCheck may take, after which it fails.
+	//
+	// If zero, DefaultHealthCheckTimeout is used.
+	HealthCheckTimeout time.Duration
+
+	healthChecks map[string]HealthCheck // checks added with AddHealthCheck
+	healthMu     sync.Mutex             // protects healthChecks
+	started      time.Time              // when the kite was created
+
+	capabilities   []string   // added with DeclareCapabilities
+	capabilitiesMu sync.Mutex // protects capabilities
+
+	dictionaries   map[string]*Dictionary // added with AddDictionary
+	dictionariesMu sync.RWMutex           // protects dictionaries
+
+	// PageSize is the size in bytes of JSON-encoded items, above which
+	// a page of an iterator result is cut, see Iterator.
+	//
+	// If zero, DefaultPageSize is used.
+	PageSize int
+
+	// PageTTL is the time the remaining items of an iterator result are
+	// kept for the caller to fetch the next page.
+	//
+	// If zero, DefaultPageTTL is used.
+	PageTTL time.Duration
+
+	pagers   map[string]*pager // iterator results by continuation token
+	pagersMu sync.Mutex        // protects pagers
+
+	argsTransformers []ArgsTransformer            // added with TransformArgs
+	methodArgs       map[string][]ArgsTransformer // added with TransformMethodArgs
+	argsMu           sync.RWMutex                 // protects argsTransformers and methodArgs
+
+	// ResumeTTL is the time the session of a disconnected resumable
+	// client is kept, see Client.Resumable.
+	//
+	// If zero, DefaultResumeTTL is used.
+	ResumeTTL time.Duration
+
+	resumeSessions map[string]*resumeSession // by caller and session ID
+	resumeMu       sync.Mutex                // protects resumeSessions
+
+	// NackExpired, when true, makes the kite respond to calls arriving
+	// after their expiry with an error of "expired" type. Otherwise such
+	// calls are dropped silently, see WithExpiry.
+	NackExpired bool
+
+	// DiscoveryCacheTTL is the time GetKites results are cached for. The
+	// cached results are invalidated earlier, once Kontrol notifies the
+	// kite about kites matching the query registering or going away.
+	//
+	// If zero, GetKites queries Kontrol each time.
+	DiscoveryCacheTTL time.Duration
+
 	// HTTP muxer
 	muxer *mux.Router
 
@@ -93,6 +361,18 @@ type Kite struct {
 	// configMu protects access to Config.{Kite,Kontrol}Key fields.
 	configMu sync.RWMutex
 
+	// runtimeConfig holds current *config.Runtime value,
+	// see SetRuntimeConfig.
+	runtimeConfig atomic.Value
+	runtimeMu     sync.Mutex // serializes SetRuntimeConfig calls
+
+	// activeRequests is the number of requests being currently handled.
+	activeRequests int64
+
+	// shedding is 1 while new calls are rejected due to memory
+	// pressure, see StartWatchdog.
+	shedding int32
+
 	// verifyCache is used as a cache for verify method.
 	//
 	// The field is set by verifyInit method.
@@ -113,12 +393,42 @@ type Kite struct {
 	// The field is set by verifyInit method.
 	verifyAudienceFunc func(*protocol.Kite, string) error
 
+	// verifyRevokedFunc is used to check whether a token was revoked.
+	//
+	// For more details see (config.Config).VerifyRevokedFunc.
+	//
+	// The field is set by verifyInit method.
+	verifyRevokedFunc func(*kitekey.KiteClaims) error
+
+	// revoked is the revocation list, it maps token IDs to their
+	// expiration times.
+	revoked   map[string]int64
+	revokedMu sync.RWMutex // protects revoked
+
+	// flags are the feature flags distributed by Kontrol.
+	flags        map[string]interface{}
+	flagHandlers []func(name string, value interface{})
+	flagsMu      sync.RWMutex // protects flags and flagHandlers
+
 	// verifyOnce ensures all verify* fields are set up only once.
 	verifyOnce sync.Once
 
-	// mu protects assigment to verifyCache
+	// dialed are the reconnecting clients dialed by the kite, which
+	// are redialed after a network change, see WatchNetwork.
+	dialed map[*Client]struct{}
+
+	// inherited are the listeners handed over by the previous process
+	// of the kite, which are not used yet, see TakeOver and Upgrade.
+	inherited   []*inheritedListener
+	inheritOnce sync.Once
+
+	// mu protects assigment to verifyCache, listeners, dialed and inherited
 	mu sync.Mutex
 
+	// calls are the requests being currently handled, see ServeHandoff.
+	calls   map[*Request]time.Time // request -> start of handling
+	callsMu sync.Mutex
+
 	// Handlers to call when a new connection is received.
 	onConnectHandlers []func(*Client)
 
@@ -132,6 +442,14 @@ type Kite struct {
 	// registers successfully to Kontrol
 	onRegisterHandlers []func(*protocol.RegisterResult)
 
+	// onNetworkChangeHandlers field holds callbacks invoked when
+	// the addresses of the local interfaces change
+	onNetworkChangeHandlers []func(*NetworkChange)
+
+	// onPressureHandlers field holds callbacks invoked when the
+	// watchdog detects the kite comes under or recovers from pressure
+	onPressureHandlers []func(*Pressure)
+
 	// handlersMu protects access to on*Handlers fields.
 	handlersMu sync.RWMutex
 
@@ -143,6 +461,7 @@ type Kite struct {
 	// server fields, are initialized and used when
 	// TODO: move them to their own struct, just like KontrolClient
 	listener  *gracefulListener
+	listeners []*gracefulListener // additional listeners, see Listen
 	TLSConfig *tls.Config
 	readyC    chan bool // To signal when kite is ready to accept connections
 	closeC    chan bool // To signal when kite is closed with Close()
@@ -186,7 +505,7 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 		Log:            l,
 		SetLogLevel:    setlevel,
 		Authenticators: make(map[string]func(*Request) error),
-		handlers:       make(map[string]*Method),
+		methods:        newMethodTable(),
 		kontrol:        kClient,
 		name:           name,
 		version:        version,
@@ -195,10 +514,24 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 		closeC:         make(chan bool),
 		heartbeatC:     make(chan *heartbeatReq, 1),
 		muxer:          mux.NewRouter(),
+
+		defaultOperationStore: NewMemoryOperationStore(),
+		defaultSessionStore:   NewMemorySessionStore(),
+		defaultQuotaStore:     NewMemoryQuotaStore(),
+		operations:            make(map[string]*Operation),
+		dedupInflight:         make(map[string]chan struct{}),
+		clients:               make(map[string]*connectedClient),
+		revoked:               make(map[string]int64),
+		flags:                 make(map[string]interface{}),
+		healthChecks:          make(map[string]HealthCheck),
+		pagers:                make(map[string]*pager),
+		methodArgs:            make(map[string][]ArgsTransformer),
+		resumeSessions:        make(map[string]*resumeSession),
+		started:               time.Now(),
 	}
 
 	// All sockjs communication is done through this endpoint..
-	k.muxer.PathPrefix("/kite").Handler(sockjs.NewHandler("/kite", *cfg.SockJS, k.sockjsHandler))
+	k.muxer.PathPrefix("/kite").Handler(k.filterConnections(sockjs.NewHandler("/kite", *cfg.SockJS, k.sockjsHandler)))
 
 	// Add useful debug logs
 	k.OnConnect(func(c *Client) { k.Log.Debug("New session: %s", c.session.ID()) })
@@ -273,15 +606,26 @@ func (k *Kite) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 func (k *Kite) sockjsHandler(session sockjs.Session) {
 	defer session.Close(3000, "Go away!")
 
+	if k.Draining() {
+		k.Log.Debug("Draining, refusing session: %s", session.ID())
+		return
+	}
+
 	// This Client also handles the connected client.
 	// Since both sides can send/receive messages the client code is reused here.
 	c := k.NewClient("")
 	defer c.Close()
 
 	c.setSession(session)
+	c.startFlow()
 	c.wg.Add(1)
 	go c.sendHub()
 
+	k.addClient(session.ID(), c)
+	defer k.removeClient(session.ID())
+
+	defer k.watchIdle(c, session)()
+
 	k.callOnConnectHandlers(c)
 
 	// Run after methods are registered and delegate is set
@@ -289,6 +633,10 @@ func (k *Kite) sockjsHandler(session sockjs.Session) {
 
 	c.callOnDisconnectHandlers()
 	k.callOnDisconnectHandlers(c)
+
+	if !c.resumable() {
+		c.callOnInvalidateHandlers()
+	}
 }
 
 // OnConnect registers a callbacks which is called when a Kite connects
@@ -322,6 +670,22 @@ func (k *Kite) OnRegister(handler func(*protocol.RegisterResult)) {
 	k.handlersMu.Unlock()
 }
 
+// OnNetworkChange registers a callback which is called when the addresses
+// of the host change or the host resumes from sleep, see WatchNetwork.
+func (k *Kite) OnNetworkChange(handler func(*NetworkChange)) {
+	k.handlersMu.Lock()
+	k.onNetworkChangeHandlers = append(k.onNetworkChangeHandlers, handler)
+	k.handlersMu.Unlock()
+}
+
+// OnPressure registers a callback which is called when the kite comes
+// under or recovers from memory pressure, see StartWatchdog.
+func (k *Kite) OnPressure(handler func(*Pressure)) {
+	k.handlersMu.Lock()
+	k.onPressureHandlers = append(k.onPressureHandlers, handler)
+	k.handlersMu.Unlock()
+}
+
 func (k *Kite) callOnConnectHandlers(c *Client) {
 	k.handlersMu.RLock()
 	defer k.handlersMu.RUnlock()
@@ -370,6 +734,30 @@ func (k *Kite) callOnRegisterHandlers(r *protocol.RegisterResult) {
 	}
 }
 
+func (k *Kite) callOnNetworkChangeHandlers(change *NetworkChange) {
+	k.handlersMu.RLock()
+	defer k.handlersMu.RUnlock()
+
+	for _, handler := range k.onNetworkChangeHandlers {
+		func() {
+			defer nopRecover()
+			handler(change)
+		}()
+	}
+}
+
+func (k *Kite) callOnPressureHandlers(p *Pressure) {
+	k.handlersMu.RLock()
+	defer k.handlersMu.RUnlock()
+
+	for _, handler := range k.onPressureHandlers {
+		func() {
+			defer nopRecover()
+			handler(p)
+		}()
+	}
+}
+
 func (k *Kite) updateAuth(reg *protocol.RegisterResult) {
 	k.configMu.Lock()
 	defer k.configMu.Unlock()
@@ -0,0 +1,183 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+	"github.com/mitchellh/cli"
+)
+
+type Registry struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewRegistry() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Registry{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Registry) Synopsis() string {
+	return "Manages kites registered to kontrol"
+}
+
+func (c *Registry) Help() string {
+	helpText := `
+Usage: kitectl registry <subcommand> [options]
+
+  Manages kites registered to Kontrol. Requires admin privileges.
+
+Subcommands:
+
+  list [query options]       Lists registered kites.
+  versions [query options]   Shows number of instances per kite version.
+  heartbeats <id>            Shows recent heartbeats of the kite.
+  deregister <id>            Forcibly removes the kite from kontrol.
+
+Query options:
+
+  -username=koding      Username of the kite.
+  -environment=staging  Environment of the kite.
+  -name=naber           Name of the kite.
+  -version=0.0.1        Version of the kite.
+  -region=Asia          Region of the kite.
+  -hostname=caprica     Hostname of the kite.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Registry) Run(args []string) int {
+	if len(args) == 0 {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	c.KiteClient.Config = config.MustGet()
+	c.KiteClient.Config.Transport = config.XHRPolling
+
+	var err error
+
+	switch args[0] {
+	case "list":
+		err = c.list(args[1:])
+	case "versions":
+		err = c.versions(args[1:])
+	case "heartbeats":
+		err = c.heartbeats(args[1:])
+	case "deregister":
+		err = c.deregister(args[1:])
+	default:
+		err = fmt.Errorf("unknown subcommand: %s", args[0])
+	}
+
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func (c *Registry) query(name string, args []string) *protocol.KontrolQuery {
+	var query protocol.KontrolQuery
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&query.Username, "username", c.KiteClient.Kite().Username, "")
+	flags.StringVar(&query.Environment, "environment", "", "")
+	flags.StringVar(&query.Name, "name", "", "")
+	flags.StringVar(&query.Version, "version", "", "")
+	flags.StringVar(&query.Region, "region", "", "")
+	flags.StringVar(&query.Hostname, "hostname", "", "")
+	flags.Parse(args)
+
+	return &query
+}
+
+func (c *Registry) list(args []string) error {
+	result, err := c.KiteClient.TellKontrolWithTimeout("kontrol.admin.kites", c.KiteClient.CallTimeout(), c.query("list", args))
+	if err != nil {
+		return err
+	}
+
+	var kites []*protocol.KiteWithToken
+	if err := result.Unmarshal(&kites); err != nil {
+		return err
+	}
+
+	for i, kt := range kites {
+		c.Ui.Output(fmt.Sprintf("%d\t%s\t%s", i+1, &kt.Kite, kt.URL))
+	}
+
+	return nil
+}
+
+func (c *Registry) versions(args []string) error {
+	result, err := c.KiteClient.TellKontrolWithTimeout("kontrol.admin.versions", c.KiteClient.CallTimeout(), c.query("versions", args))
+	if err != nil {
+		return err
+	}
+
+	var counts []*kontrolprotocol.VersionCount
+	if err := result.Unmarshal(&counts); err != nil {
+		return err
+	}
+
+	for _, vc := range counts {
+		c.Ui.Output(fmt.Sprintf("%s\t%s\t%d", vc.Name, vc.Version, vc.Count))
+	}
+
+	return nil
+}
+
+func (c *Registry) heartbeats(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: kitectl registry heartbeats <id>")
+	}
+
+	result, err := c.KiteClient.TellKontrolWithTimeout("kontrol.admin.heartbeats", c.KiteClient.CallTimeout(), args[0])
+	if err != nil {
+		return err
+	}
+
+	var res kontrolprotocol.HeartbeatsResult
+	if err := result.Unmarshal(&res); err != nil {
+		return err
+	}
+
+	if len(res.Heartbeats) == 0 {
+		c.Ui.Output("no heartbeats received")
+		return nil
+	}
+
+	prev := res.Heartbeats[0]
+	for _, t := range res.Heartbeats {
+		c.Ui.Output(fmt.Sprintf("%s\t+%s", t.Local().Format(time.RFC3339), t.Sub(prev)))
+		prev = t
+	}
+
+	return nil
+}
+
+func (c *Registry) deregister(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: kitectl registry deregister <id>")
+	}
+
+	if _, err := c.KiteClient.TellKontrolWithTimeout("kontrol.admin.deregister", c.KiteClient.CallTimeout(), args[0]); err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("%s deregistered", args[0]))
+
+	return nil
+}
@@ -22,6 +22,7 @@ func main() {
 		"uninstall": command.NewUninstall(),
 		"list":      command.NewList(),
 		"install":   command.NewInstall(),
+		"registry":  command.NewRegistry(),
 	}
 
 	_, err := c.Run()
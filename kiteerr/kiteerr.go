@@ -0,0 +1,204 @@
+// Package kiteerr defines canonical errors of kites. The code, message and
+// details of an error returned by a kite's handler are sent over the wire,
+// so the caller can tell what went wrong:
+//
+//	// handler
+//	return nil, kiteerr.New(kiteerr.NotFound, "no such user").WithDetail("user", id)
+//
+//	// caller
+//	_, err := client.Tell("user.get", id)
+//	if kiteerr.Is(err, kiteerr.NotFound) {
+//	    ...
+//	}
+//
+// With Go 1.13 or later the errors may also be matched with errors.Is
+// against ErrNotFound and the other sentinel values.
+package kiteerr
+
+import (
+	"fmt"
+)
+
+// Code identifies a kind of error.
+type Code string
+
+// Canonical error codes.
+const (
+	NotFound     Code = "notFound"     // the requested entity does not exist
+	Unauthorized Code = "unauthorized" // the caller is not allowed to do it
+	Timeout      Code = "timeout"      // the operation did not finish in time
+	Unavailable  Code = "unavailable"  // the kite is temporarily unable to do it
+	Internal     Code = "internal"     // the kite failed unexpectedly
+)
+
+// Sentinel errors matching any error with the same code, when used as the
+// target of errors.Is.
+var (
+	ErrNotFound     = &Error{Code: NotFound}
+	ErrUnauthorized = &Error{Code: Unauthorized}
+	ErrTimeout      = &Error{Code: Timeout}
+	ErrUnavailable  = &Error{Code: Unavailable}
+	ErrInternal     = &Error{Code: Internal}
+)
+
+// Error is an error with a code. Its code, message and details are sent
+// over the wire when it is returned by a kite's handler. The wrapped
+// error is not.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+
+	// Err is the wrapped error, which caused this one.
+	Err error
+}
+
+// New gives an error with the code and message.
+func New(code Code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Errorf gives an error with the code and message formatted
+// according to a format specifier.
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Wrap gives an error with the code and message, which wraps err.
+// It returns nil if err is nil.
+func Wrap(err error, code Code, message string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// WithDetail sets the detail of the error and returns it.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+
+	e.Details[key] = value
+
+	return e
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	s := e.Message
+	if s == "" {
+		s = string(e.Code)
+	}
+
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+
+	return s
+}
+
+// ErrorCode gives the code of the error.
+func (e *Error) ErrorCode() Code {
+	return e.Code
+}
+
+// ErrorDetails gives the details of the error.
+func (e *Error) ErrorDetails() map[string]interface{} {
+	return e.Details
+}
+
+// Unwrap gives the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Cause gives the wrapped error, for compatibility with pkg/errors.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Is tells whether the target is a sentinel error with the same code.
+func (e *Error) Is(target error) bool {
+	return Matches(target, e.Code)
+}
+
+// Matches tells whether the target is a sentinel error with the given
+// code. Error types carrying codes implement their Is method with it,
+// so errors.Is works with them.
+func Matches(target error, code Code) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Err == nil && t.Code == code
+}
+
+type coder interface {
+	ErrorCode() Code
+}
+
+type detailer interface {
+	ErrorDetails() map[string]interface{}
+}
+
+// CodeOf gives the code of the first error with a code in the chain of
+// wrapped errors. Errors without a code are Internal ones. It returns
+// an empty code if err is nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	for e := err; e != nil; e = unwrap(e) {
+		if c, ok := e.(coder); ok && c.ErrorCode() != "" {
+			return c.ErrorCode()
+		}
+	}
+
+	return Internal
+}
+
+// DetailsOf gives the details of the first error with details in the
+// chain of wrapped errors.
+func DetailsOf(err error) map[string]interface{} {
+	for e := err; e != nil; e = unwrap(e) {
+		if d, ok := e.(detailer); ok && d.ErrorDetails() != nil {
+			return d.ErrorDetails()
+		}
+	}
+
+	return nil
+}
+
+// Is tells whether the error has the given code.
+func Is(err error, code Code) bool {
+	return err != nil && CodeOf(err) == code
+}
+
+// Find gives the first *Error in the chain of wrapped errors, or nil.
+func Find(err error) *Error {
+	for e := err; e != nil; e = unwrap(e) {
+		if ke, ok := e.(*Error); ok {
+			return ke
+		}
+	}
+
+	return nil
+}
+
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package kiteerr
+
+import (
+	"errors"
+	"testing"
+)
+
+type causer struct {
+	err error
+}
+
+func (c *causer) Error() string { return "causer: " + c.err.Error() }
+func (c *causer) Cause() error  { return c.err }
+
+func TestCodeOf(t *testing.T) {
+	notFound := New(NotFound, "no such user").WithDetail("user", "alice")
+
+	cases := []struct {
+		err  error
+		code Code
+	}{
+		{nil, ""},
+		{errors.New("boom"), Internal},
+		{notFound, NotFound},
+		{Wrap(errors.New("dial tcp: refused"), Unavailable, "database is down"), Unavailable},
+		{&causer{notFound}, NotFound},
+	}
+
+	for _, c := range cases {
+		if got := CodeOf(c.err); got != c.code {
+			t.Errorf("CodeOf(%v)=%q, want %q", c.err, got, c.code)
+		}
+	}
+
+	if d := DetailsOf(&causer{notFound}); d["user"] != "alice" {
+		t.Fatalf("got %v, want user detail", d)
+	}
+
+	if Wrap(nil, Internal, "nothing") != nil {
+		t.Fatal("want Wrap(nil) to be nil")
+	}
+}
+
+func TestError(t *testing.T) {
+	err := Wrap(errors.New("dial tcp: refused"), Unavailable, "database is down")
+
+	if s := err.Error(); s != "database is down: dial tcp: refused" {
+		t.Fatalf("got %q", s)
+	}
+
+	if !err.(*Error).Is(ErrUnavailable) {
+		t.Fatal("want error to match ErrUnavailable")
+	}
+
+	if err.(*Error).Is(ErrTimeout) || err.(*Error).Is(New(Unavailable, "other")) {
+		t.Fatal("want error to match sentinels with the same code only")
+	}
+
+	if Find(&causer{err}) != err {
+		t.Fatal("want Find to give the wrapped *Error")
+	}
+}
@@ -24,6 +24,19 @@ type KiteClaims struct {
 	jwt.StandardClaims
 	KontrolKey string `json:"kontrolKey,omitempty"`
 	KontrolURL string `json:"kontrolURL,omitempty"`
+
+	// Delegate is the username of the kite that acts on behalf of
+	// the subject, set for delegation tokens only.
+	Delegate string `json:"delegate,omitempty"`
+
+	// Scopes restricts what the token can be used for. No scopes
+	// means no restrictions.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Environment and Region bind the key to the location of the kite,
+	// which limits kites Kontrol returns to it, see kontrol.VisibilityRule.
+	Environment string `json:"environment,omitempty"`
+	Region      string `json:"region,omitempty"`
 }
 
 // KiteHome returns the home path of Kite directory.
@@ -0,0 +1,110 @@
+package kiteproto
+
+import (
+	"bytes"
+	"go/format"
+	"io"
+	"text/template"
+)
+
+// File describes services of a .proto file, which kite bindings are
+// generated for. A protoc plugin fills it from the file descriptor.
+type File struct {
+	// Package is the Go package of the generated code, the same as
+	// the one of messages generated by protoc-gen-go.
+	Package string
+
+	Services []*Service
+}
+
+// Service describes a service defined in a .proto file.
+type Service struct {
+	Name    string
+	Methods []*Method
+}
+
+// Method describes a method of a service. Input and Output are the Go
+// types of the messages, e.g. "HelloRequest".
+type Method struct {
+	Name   string
+	Input  string
+	Output string
+}
+
+// KiteMethod gives the name of the kite method the method is served as.
+func (s *Service) KiteMethod(m *Method) string {
+	return s.Name + "." + m.Name
+}
+
+var genTmpl = template.Must(template.New("kiteproto").Parse(`// Code generated by protoc-gen-kite. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/kiteproto"
+)
+{{range $s := .Services}}
+// {{$s.Name}}Server is the server API of the {{$s.Name}} service.
+type {{$s.Name}}Server interface {
+{{- range .Methods}}
+	{{.Name}}(*kite.Request, *{{.Input}}) (*{{.Output}}, error)
+{{- end}}
+}
+
+// Register{{$s.Name}}Server registers handlers of the {{$s.Name}} service
+// methods with the kite.
+func Register{{$s.Name}}Server(k *kite.Kite, srv {{$s.Name}}Server) {
+{{- range .Methods}}
+	kiteproto.HandleFunc(k, "{{$s.KiteMethod .}}",
+		func() kiteproto.Message { return new({{.Input}}) },
+		func(r *kite.Request, req kiteproto.Message) (kiteproto.Message, error) {
+			resp, err := srv.{{.Name}}(r, req.(*{{.Input}}))
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		})
+{{- end}}
+}
+
+// {{$s.Name}}Client is the client API of the {{$s.Name}} service.
+type {{$s.Name}}Client struct {
+	Client *kite.Client
+}
+
+// New{{$s.Name}}Client gives a client of the {{$s.Name}} service served
+// by the remote kite.
+func New{{$s.Name}}Client(c *kite.Client) *{{$s.Name}}Client {
+	return &{{$s.Name}}Client{Client: c}
+}
+{{range .Methods}}
+// {{.Name}} calls the {{.Name}} method of the {{$s.Name}} service.
+func (c *{{$s.Name}}Client) {{.Name}}(ctx context.Context, req *{{.Input}}) (*{{.Output}}, error) {
+	resp := new({{.Output}})
+	if err := kiteproto.Call(ctx, c.Client, "{{$s.KiteMethod .}}", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+{{end}}{{end}}`))
+
+// Generate writes Go source of kite client and server bindings for the
+// services of the file.
+func Generate(w io.Writer, f *File) error {
+	var buf bytes.Buffer
+
+	if err := genTmpl.Execute(&buf, f); err != nil {
+		return err
+	}
+
+	p, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(p)
+	return err
+}
@@ -0,0 +1,192 @@
+// Package kiteproto lets kites exchange protobuf messages as method
+// arguments and results, for teams defining their APIs with .proto files.
+//
+// A message is sent as a single dnode argument, which is an object with
+// the message encoded in protobuf wire format:
+//
+//	{"type": "hello.HelloRequest", "data": "<base64 of the message>"}
+//
+// The type is optional, it is checked by the receiver when both sides know
+// the name of the message. Callbacks cannot be sent within messages.
+//
+// Bindings of services defined in .proto files are generated with the
+// Generate function, see Service.
+package kiteproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/koding/kite"
+)
+
+// Message is a protobuf message, as generated by protoc-gen-go.
+type Message interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+// Codec encodes and decodes messages in protobuf wire format.
+type Codec interface {
+	Marshal(Message) ([]byte, error)
+	Unmarshal([]byte, Message) error
+}
+
+// CodecFuncs is an adapter to use ordinary functions as a codec, e.g.
+// the ones of the github.com/golang/protobuf/proto package:
+//
+//	kiteproto.DefaultCodec = kiteproto.CodecFuncs{
+//	    MarshalFunc:   proto.Marshal,
+//	    UnmarshalFunc: proto.Unmarshal,
+//	}
+type CodecFuncs struct {
+	MarshalFunc   func(Message) ([]byte, error)
+	UnmarshalFunc func([]byte, Message) error
+}
+
+var _ Codec = CodecFuncs{}
+
+// Marshal calls f.MarshalFunc(m).
+func (f CodecFuncs) Marshal(m Message) ([]byte, error) {
+	return f.MarshalFunc(m)
+}
+
+// Unmarshal calls f.UnmarshalFunc(p, m).
+func (f CodecFuncs) Unmarshal(p []byte, m Message) error {
+	return f.UnmarshalFunc(p, m)
+}
+
+// DefaultCodec is used to encode and decode messages.
+//
+// By default it uses Marshal and Unmarshal methods of messages, which are
+// generated by gogo/protobuf. Set it to a codec using the proto package
+// for messages generated by golang/protobuf.
+var DefaultCodec Codec = methodCodec{}
+
+// ErrTypeMismatch is returned when a message of other type is received
+// than the expected one.
+var ErrTypeMismatch = errors.New("kiteproto: message type mismatch")
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type unmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+// methodCodec uses Marshal and Unmarshal methods of messages.
+type methodCodec struct{}
+
+func (methodCodec) Marshal(m Message) ([]byte, error) {
+	if mm, ok := m.(marshaler); ok {
+		return mm.Marshal()
+	}
+
+	return nil, fmt.Errorf("kiteproto: %T does not implement Marshal, set DefaultCodec", m)
+}
+
+func (methodCodec) Unmarshal(p []byte, m Message) error {
+	if mu, ok := m.(unmarshaler); ok {
+		return mu.Unmarshal(p)
+	}
+
+	return fmt.Errorf("kiteproto: %T does not implement Unmarshal, set DefaultCodec", m)
+}
+
+// Payload is a message sent as a dnode argument.
+type Payload struct {
+	Type string `json:"type,omitempty"`
+	Data []byte `json:"data"`
+}
+
+type namer interface {
+	XXX_MessageName() string
+}
+
+// messageName gives the full name of the message, if the message knows it.
+func messageName(m Message) string {
+	if n, ok := m.(namer); ok {
+		return n.XXX_MessageName()
+	}
+
+	return ""
+}
+
+// Encode gives the payload of the message.
+func Encode(m Message) (*Payload, error) {
+	p, err := DefaultCodec.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Payload{
+		Type: messageName(m),
+		Data: p,
+	}, nil
+}
+
+// Decode decodes the payload into the message.
+func Decode(p *Payload, m Message) error {
+	if name := messageName(m); p.Type != "" && name != "" && p.Type != name {
+		return fmt.Errorf("%s: got %q, want %q", ErrTypeMismatch, p.Type, name)
+	}
+
+	m.Reset()
+
+	return DefaultCodec.Unmarshal(p.Data, m)
+}
+
+// HandlerFunc handles a call with the request message, giving the
+// response message.
+type HandlerFunc func(r *kite.Request, req Message) (Message, error)
+
+// HandleFunc registers the handler of the method of the kite, taking and
+// returning protobuf messages. The newReq gives an empty request message,
+// which the argument of a call is decoded into.
+func HandleFunc(k *kite.Kite, method string, newReq func() Message, fn HandlerFunc) *kite.Method {
+	return k.HandleFunc(method, func(r *kite.Request) (interface{}, error) {
+		var p Payload
+		if err := r.Args.One().Unmarshal(&p); err != nil {
+			return nil, err
+		}
+
+		req := newReq()
+		if err := Decode(&p, req); err != nil {
+			return nil, &kite.Error{
+				Type:    "argumentError",
+				Message: err.Error(),
+			}
+		}
+
+		resp, err := fn(r, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return Encode(resp)
+	})
+}
+
+// Call calls the method of the remote kite with the request message,
+// decoding the result into the response message.
+func Call(ctx context.Context, c *kite.Client, method string, req, resp Message) error {
+	p, err := Encode(req)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.TellWithContext(ctx, method, p)
+	if err != nil {
+		return err
+	}
+
+	var out Payload
+	if err := result.Unmarshal(&out); err != nil {
+		return err
+	}
+
+	return Decode(&out, resp)
+}
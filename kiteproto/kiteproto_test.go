@@ -0,0 +1,93 @@
+package kiteproto
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+)
+
+// text is a message encoded as its plain text.
+type text struct {
+	name  string
+	value string
+}
+
+func (t *text) Reset()                   { t.value = "" }
+func (t *text) String() string           { return t.value }
+func (t *text) ProtoMessage()            {}
+func (t *text) XXX_MessageName() string  { return t.name }
+func (t *text) Marshal() ([]byte, error) { return []byte(t.value), nil }
+func (t *text) Unmarshal(p []byte) error { t.value = string(p); return nil }
+
+func TestCall(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := kite.NewWithConfig("proto-server", "0.0.1", cfg)
+
+	newReq := func() Message { return &text{name: "hello.Request"} }
+	HandleFunc(srv, "Greeter.SayHello", newReq, func(r *kite.Request, req Message) (Message, error) {
+		return &text{name: "hello.Reply", value: "hello " + req.String()}, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := kite.New("proto-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	resp := &text{name: "hello.Reply"}
+	if err := Call(ctx, c, "Greeter.SayHello", &text{name: "hello.Request", value: "alice"}, resp); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	if resp.value != "hello alice" {
+		t.Fatalf("got %q, want %q", resp.value, "hello alice")
+	}
+
+	err := Call(ctx, c, "Greeter.SayHello", &text{name: "other.Request"}, resp)
+	if e, ok := err.(*kite.Error); !ok || e.Type != "argumentError" {
+		t.Fatalf("want argumentError for mismatched message, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	f := &File{
+		Package: "hello",
+		Services: []*Service{{
+			Name: "Greeter",
+			Methods: []*Method{
+				{Name: "SayHello", Input: "HelloRequest", Output: "HelloReply"},
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := Generate(&buf, f); err != nil {
+		t.Fatalf("Generate()=%s", err)
+	}
+
+	for _, want := range []string{
+		"package hello",
+		"SayHello(*kite.Request, *HelloRequest) (*HelloReply, error)",
+		`kiteproto.HandleFunc(k, "Greeter.SayHello",`,
+		"func (c *GreeterClient) SayHello(ctx context.Context, req *HelloRequest) (*HelloReply, error) {",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("want generated code to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
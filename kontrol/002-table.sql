@@ -38,6 +38,7 @@ CREATE UNLOGGED TABLE "kite"."kite" (
     created_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'), -- you may set a global timezone
     updated_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
     key_id UUID NOT NULL,
+    urls JSONB, -- additional URLs the kite is reachable at, with their labels
 
     CONSTRAINT "kite_key_id_fkey" FOREIGN KEY ("key_id") REFERENCES kite.key (id) ON UPDATE NO ACTION ON DELETE NO ACTION NOT DEFERRABLE INITIALLY IMMEDIATE
 );
@@ -50,3 +51,15 @@ DROP INDEX IF EXISTS kite_updated_at_btree_idx;
 
 CREATE INDEX kite_updated_at_btree_idx ON "kite"."kite" USING BTREE (updated_at DESC);
 
+--
+-- create lease table for storing leases of elections and semaphores
+--
+CREATE UNLOGGED TABLE "kite"."lease" (
+    name TEXT NOT NULL COLLATE "default", -- name of the election or semaphore slot
+    holder TEXT NOT NULL COLLATE "default", -- holder is the ID of the kite holding the lease
+    expires_at timestamptz NOT NULL,
+
+    PRIMARY KEY ("name") NOT DEFERRABLE INITIALLY IMMEDIATE
+) WITH (OIDS = FALSE);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON "kite"."lease" TO "kontrol";
@@ -0,0 +1,12 @@
+--
+-- create lease table for storing leases of elections and semaphores
+--
+CREATE UNLOGGED TABLE IF NOT EXISTS "kite"."lease" (
+    name TEXT NOT NULL COLLATE "default", -- name of the election or semaphore slot
+    holder TEXT NOT NULL COLLATE "default", -- holder is the ID of the kite holding the lease
+    expires_at timestamptz NOT NULL,
+
+    PRIMARY KEY ("name") NOT DEFERRABLE INITIALLY IMMEDIATE
+) WITH (OIDS = FALSE);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON "kite"."lease" TO "kontrol";
@@ -0,0 +1,9 @@
+DO $$
+  BEGIN
+    BEGIN
+      ALTER TABLE "kite"."kite" ADD COLUMN urls JSONB; -- additional URLs the kite is reachable at, with their labels
+    EXCEPTION WHEN duplicate_column THEN
+      RAISE NOTICE 'urls column already exists in kite.kite';
+    END;
+  END;
+$$;
@@ -0,0 +1,54 @@
+package kontrol
+
+import (
+	"sort"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// Kontrol runs in cluster mode by sharing a replicated storage, like an
+// etcd cluster, between multiple instances. Each instance registers itself
+// in the storage, so registrations made with any of them are visible to all
+// members, and the members know each other without extra configuration.
+//
+// There is no leader among the members: kites registered with a member,
+// which goes down, reconnect to another one listed by Members and register
+// again, see kite.Config.KontrolMembers.
+
+// Members gives the URLs of Kontrol instances sharing the storage with k,
+// including k itself.
+func (k *Kontrol) Members() ([]string, error) {
+	self := k.Kite.Kite()
+
+	kites, err := k.storage.Get(&protocol.KontrolQuery{
+		Username:    self.Username,
+		Environment: self.Environment,
+		Name:        self.Name,
+	})
+	if err != nil && err != kite.ErrNoKitesAvailable {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(kites))
+	members := make([]string, 0, len(kites))
+
+	for _, kite := range kites {
+		if kite.URL == "" || seen[kite.URL] {
+			continue
+		}
+
+		seen[kite.URL] = true
+		members = append(members, kite.URL)
+	}
+
+	sort.Strings(members)
+
+	return members, nil
+}
+
+// HandleMembers returns the URLs of Kontrol instances of the cluster, so
+// kites may fail over to them.
+func (k *Kontrol) HandleMembers(r *kite.Request) (interface{}, error) {
+	return k.Members()
+}
@@ -0,0 +1,187 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+)
+
+// HandleGetDelegationToken issues a short-lived token for calling the
+// queried kite on behalf of the original caller of the requesting kite.
+//
+// The caller is identified by the credential it used to authenticate
+// with the requesting kite, which must be either a kite key or a token
+// issued for the requesting kite. The new token is restricted to the
+// requested scopes, which cannot exceed the scopes of the caller, and
+// at least one scope is required.
+func (k *Kontrol) HandleGetDelegationToken(r *kite.Request) (interface{}, error) {
+	var args protocol.GetDelegationTokenArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	if args.Auth == nil {
+		return nil, errors.New("no caller credential provided")
+	}
+
+	caller, err := k.delegationCaller(args.Auth, &r.Client.Kite)
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify caller: %s", err)
+	}
+
+	scopes := args.Scopes
+	if len(caller.Scopes) != 0 {
+		if len(scopes) == 0 {
+			scopes = caller.Scopes
+		}
+
+		for _, scope := range scopes {
+			if !hasScope(caller.Scopes, scope) {
+				return nil, fmt.Errorf("caller is not allowed to delegate %q scope", scope)
+			}
+		}
+	}
+
+	// A token without scopes is unrestricted, see kite.Request.HasScope.
+	if len(scopes) == 0 {
+		return nil, errors.New("delegation token must be restricted to at least one scope")
+	}
+
+	expires := time.Now().Add(DelegationTokenTTL)
+	if caller.ExpiresAt != 0 {
+		if exp := time.Unix(caller.ExpiresAt, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+
+	kites, err := k.storage.Get(&args.KontrolQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kites) > 1 {
+		return nil, errors.New("query matches more than one kite")
+	}
+
+	if len(kites) == 0 {
+		return nil, errors.New("no kites found")
+	}
+
+	keyPair, err := k.getOrUpdateKeyID(kites[0].KeyID, r)
+	if err != nil {
+		return nil, err
+	}
+
+	k.log.Info("Delegation token for %q issued to %q", caller.Subject, r.Username)
+
+	return k.generateToken(&token{
+		audience: getAudience(&args.KontrolQuery),
+		username: caller.Subject,
+		issuer:   k.Kite.Kite().Username,
+		keyPair:  keyPair,
+		delegate: r.Username,
+		scopes:   scopes,
+		expires:  expires,
+	})
+}
+
+// delegationCaller verifies the credential the caller used to authenticate
+// with the delegate kite and returns its claims.
+func (k *Kontrol) delegationCaller(auth *protocol.Auth, delegate *protocol.Kite) (*kitekey.KiteClaims, error) {
+	switch auth.Type {
+	case "kiteKey":
+		username, err := k.Kite.AuthenticateSimpleKiteKey(auth.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{
+				Subject: username,
+			},
+		}, nil
+	case "token":
+		// A token is issued for a single kite, so it is verified with
+		// the key pair that kite is registered with.
+		kites, err := k.storage.Get(&protocol.KontrolQuery{ID: delegate.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(kites) != 1 {
+			return nil, errors.New("delegate kite is not registered")
+		}
+
+		keyPair, err := k.keyPair.GetKeyFromID(kites[0].KeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		claims := &kitekey.KiteClaims{}
+
+		keyFn := func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errors.New("invalid signing method")
+			}
+
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(keyPair.Public))
+		}
+
+		if _, err := jwt.ParseWithClaims(auth.Key, claims, keyFn); err != nil {
+			return nil, err
+		}
+
+		if claims.Issuer != k.Kite.Kite().Username {
+			return nil, fmt.Errorf("issuer is not trusted: %s", claims.Issuer)
+		}
+
+		if claims.Subject == "" {
+			return nil, errors.New("token has no username")
+		}
+
+		if claims.Delegate != "" {
+			return nil, errors.New("delegation tokens cannot be delegated further")
+		}
+
+		if !audienceMatches(claims.Audience, delegate) {
+			return nil, fmt.Errorf("token was not issued for %s", delegate)
+		}
+
+		if k.Kite.TokenRevoked(claims.Id) {
+			return nil, kite.ErrTokenRevoked
+		}
+
+		return claims, nil
+	default:
+		return nil, fmt.Errorf("unsupported authentication type: %s", auth.Type)
+	}
+}
+
+// audienceMatches tells whether a token with the given audience
+// can be used to call the kite.
+func audienceMatches(aud string, k *protocol.Kite) bool {
+	if aud == "/" {
+		return true
+	}
+
+	path := "/" + k.Username + "/" + k.Environment + "/" + k.Name
+
+	return aud == path || strings.HasPrefix(path, aud+"/")
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,202 @@
+package kontrol
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+)
+
+// delegationStorage serves the single kite both the delegate and the
+// queried kites are looked up from.
+type delegationStorage struct {
+	Storage
+	kite *protocol.KiteWithToken
+}
+
+func (s *delegationStorage) Get(*protocol.KontrolQuery) (Kites, error) {
+	return Kites{s.kite}, nil
+}
+
+func newDelegationKontrol(t *testing.T) *Kontrol {
+	cfg := config.New()
+	cfg.Username = "testuser"
+
+	k := &Kontrol{
+		Kite:        kite.NewWithConfig("kontrol", "0.0.1", cfg),
+		keyPair:     NewMemKeyPairStorage(),
+		tokenCache:  make(map[string]cachedToken),
+		revocations: newRevocations(),
+		storage: &delegationStorage{
+			kite: &protocol.KiteWithToken{KeyID: "test"},
+		},
+	}
+	k.log = k.Kite.Log
+
+	if err := k.keyPair.AddKey(&KeyPair{ID: "test", Public: testkeys.Public, Private: testkeys.Private}); err != nil {
+		t.Fatalf("AddKey()=%s", err)
+	}
+
+	return k
+}
+
+// callerToken gives a token of the original caller issued for the delegate kite.
+func callerToken(t *testing.T, scopes []string, expires time.Time) string {
+	claims := &kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "testuser",
+			Subject:   "alice",
+			Audience:  "/testuser/production/gateway",
+			ExpiresAt: expires.Unix(),
+			Id:        "caller",
+		},
+		Scopes: scopes,
+	}
+
+	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsaPrivate)
+	if err != nil {
+		t.Fatalf("SignedString()=%s", err)
+	}
+
+	return signed
+}
+
+func getDelegationToken(k *Kontrol, auth string, scopes []string) (*kitekey.KiteClaims, error) {
+	args, err := json.Marshal([]*protocol.GetDelegationTokenArgs{{
+		KontrolQuery: protocol.KontrolQuery{Username: "testuser", Name: "backend"},
+		Auth:         &protocol.Auth{Type: "token", Key: auth},
+		Scopes:       scopes,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &kite.Request{
+		Username: "testuser",
+		Args:     &dnode.Partial{Raw: args},
+		Client: &kite.Client{
+			Kite: protocol.Kite{Username: "testuser", Environment: "production", Name: "gateway", ID: "gateway"},
+		},
+	}
+
+	res, err := k.HandleGetDelegationToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &kitekey.KiteClaims{}
+	_, err = jwt.ParseWithClaims(res.(string), claims, func(*jwt.Token) (interface{}, error) {
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(testkeys.Public))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func TestHandleGetDelegationToken_Scopes(t *testing.T) {
+	k := newDelegationKontrol(t)
+	expires := time.Now().Add(time.Hour)
+
+	cases := []struct {
+		caller    []string
+		requested []string
+		want      []string // nil if the token must be refused
+	}{
+		{[]string{"read", "write"}, []string{"read"}, []string{"read"}}, // narrowed
+		{[]string{"read", "write"}, nil, []string{"read", "write"}},     // inherited
+		{[]string{"read"}, []string{"read", "write"}, nil},              // widened
+		{[]string{"read"}, []string{"admin"}, nil},                      // widened
+		{nil, []string{"write"}, []string{"write"}},                     // restricted
+		{nil, nil, nil}, // unrestricted
+	}
+
+	for i, c := range cases {
+		claims, err := getDelegationToken(k, callerToken(t, c.caller, expires), c.requested)
+
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("%d: got token with %v scopes, want error", i, claims.Scopes)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%d: HandleGetDelegationToken()=%s", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(claims.Scopes, c.want) {
+			t.Errorf("%d: got %v scopes, want %v", i, claims.Scopes, c.want)
+		}
+
+		if claims.Subject != "alice" || claims.Delegate != "testuser" {
+			t.Errorf("%d: got subject %q and delegate %q", i, claims.Subject, claims.Delegate)
+		}
+	}
+}
+
+func TestHandleGetDelegationToken_Expiry(t *testing.T) {
+	k := newDelegationKontrol(t)
+	now := time.Now()
+
+	cases := []struct {
+		caller time.Time
+		want   time.Time
+	}{
+		{now.Add(time.Hour), now.Add(DelegationTokenTTL)}, // capped by the TTL
+		{now.Add(time.Minute), now.Add(time.Minute)},      // capped by the caller
+	}
+
+	for i, c := range cases {
+		claims, err := getDelegationToken(k, callerToken(t, []string{"read"}, c.caller), nil)
+		if err != nil {
+			t.Fatalf("%d: HandleGetDelegationToken()=%s", i, err)
+		}
+
+		got := time.Unix(claims.ExpiresAt, 0)
+
+		if d := got.Sub(c.want); d < -time.Second || d > time.Second {
+			t.Errorf("%d: got expiry %s, want %s", i, got, c.want)
+		}
+	}
+}
+
+func TestAudienceMatches(t *testing.T) {
+	k := &protocol.Kite{
+		Username:    "user",
+		Environment: "production",
+		Name:        "gateway",
+	}
+
+	cases := map[string]bool{
+		"/":                           true,
+		"/user":                       true,
+		"/user/production":            true,
+		"/user/production/gateway":    true,
+		"/user/production/gatewayx":   false,
+		"/user/prod":                  false,
+		"/other":                      false,
+		"/user/production/gateway/id": false,
+	}
+
+	for aud, want := range cases {
+		if got := audienceMatches(aud, k); got != want {
+			t.Errorf("audienceMatches(%q)=%t, want %t", aud, got, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package kontrol
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// LeaseStorage is a storage of leases used to elect leaders among
+// kites of the same service and to hold distributed semaphores, see
+// (*kite.Kite).Elect and (*kite.Kite).NewSemaphore. A storage should
+// be safe to concurrent access.
+//
+// The Etcd and Postgres storages implement LeaseStorage, so they are
+// used for leases when set with SetStorage.
+type LeaseStorage interface {
+	// AcquireLease acquires the lease for its holder if it is not held
+	// by other one or it has expired, or renews it if it is already held
+	// by the holder. It returns the current lease, which holder differs
+	// from the given one if the lease is held by other holder.
+	AcquireLease(lease *protocol.Lease) (*protocol.Lease, error)
+
+	// ReleaseLease releases the lease if it is held by the holder.
+	ReleaseLease(name, holder string) error
+}
+
+// MemLeaseStorage is a LeaseStorage which keeps the leases in memory.
+type MemLeaseStorage struct {
+	mu     sync.Mutex
+	leases map[string]*protocol.Lease
+}
+
+var _ LeaseStorage = (*MemLeaseStorage)(nil)
+
+// NewMemLeaseStorage creates a new in memory lease storage.
+func NewMemLeaseStorage() *MemLeaseStorage {
+	return &MemLeaseStorage{
+		leases: make(map[string]*protocol.Lease),
+	}
+}
+
+// AcquireLease implements the LeaseStorage interface.
+func (m *MemLeaseStorage) AcquireLease(lease *protocol.Lease) (*protocol.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.leases[lease.Name]
+	if ok && cur.Holder != lease.Holder && cur.ExpiresAt.After(time.Now()) {
+		leaseCopy := *cur
+		return &leaseCopy, nil
+	}
+
+	leaseCopy := *lease
+	m.leases[lease.Name] = &leaseCopy
+
+	return lease, nil
+}
+
+// ReleaseLease implements the LeaseStorage interface.
+func (m *MemLeaseStorage) ReleaseLease(name, holder string) error {
+	m.mu.Lock()
+	if cur, ok := m.leases[name]; ok && cur.Holder == holder {
+		delete(m.leases, name)
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// SetLeaseStorage sets the backend storage that kontrol is going to use
+// to store leases of elections and semaphores.
+//
+// If not set, the kite storage is used if it implements LeaseStorage,
+// otherwise leases are kept in memory.
+func (k *Kontrol) SetLeaseStorage(storage LeaseStorage) {
+	k.leases = storage
+}
+
+func (k *Kontrol) leaseStorage() LeaseStorage {
+	k.leasesOnce.Do(func() {
+		if k.leases != nil {
+			return
+		}
+
+		if storage, ok := k.storage.(LeaseStorage); ok {
+			k.leases = storage
+			return
+		}
+
+		k.log.Warning("Lease storage is not set. Using in memory leases")
+		k.leases = NewMemLeaseStorage()
+	})
+
+	return k.leases
+}
+
+// electionLease gives the name of the lease for the election, which is
+// scoped to the username, environment and name of the calling kite.
+func electionLease(r *kite.Request, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty election name")
+	}
+
+	return strings.Join([]string{
+		"election",
+		r.Client.Kite.Username,
+		r.Client.Kite.Environment,
+		r.Client.Kite.Name,
+		name,
+	}, "/"), nil
+}
+
+// HandleAcquireLease acquires or renews the lease of the election
+// for the calling kite. It returns the current lease, which is held
+// by other kite if the calling one is not the leader.
+func (k *Kontrol) HandleAcquireLease(r *kite.Request) (interface{}, error) {
+	var args protocol.LeaseArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.TTL <= 0 {
+		return nil, errors.New("lease TTL must be positive")
+	}
+
+	name, err := electionLease(r, args.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := k.leaseStorage().AcquireLease(&protocol.Lease{
+		Name:      name,
+		Holder:    r.Client.Kite.ID,
+		ExpiresAt: time.Now().Add(args.TTL).UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lease.Name = args.Name
+
+	return lease, nil
+}
+
+// HandleReleaseLease releases the lease of the election if it is held
+// by the calling kite.
+func (k *Kontrol) HandleReleaseLease(r *kite.Request) (interface{}, error) {
+	var args protocol.LeaseArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	name, err := electionLease(r, args.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, k.leaseStorage().ReleaseLease(name, r.Client.Kite.ID)
+}
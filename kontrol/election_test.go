@@ -0,0 +1,59 @@
+package kontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+func TestMemLeaseStorage(t *testing.T) {
+	s := NewMemLeaseStorage()
+
+	acquire := func(holder string, ttl time.Duration) string {
+		lease, err := s.AcquireLease(&protocol.Lease{
+			Name:      "testuser/production/cron/compaction",
+			Holder:    holder,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+		if err != nil {
+			t.Fatalf("AcquireLease()=%s", err)
+		}
+
+		return lease.Holder
+	}
+
+	cases := []struct {
+		holder string
+		ttl    time.Duration
+		want   string
+	}{
+		{"kite-1", time.Minute, "kite-1"},  // acquire
+		{"kite-2", time.Minute, "kite-1"},  // held by other kite
+		{"kite-1", -time.Minute, "kite-1"}, // renew, expired
+		{"kite-2", time.Minute, "kite-2"},  // take over expired lease
+		{"kite-1", time.Minute, "kite-2"},  // held by other kite
+	}
+
+	for i, c := range cases {
+		if got := acquire(c.holder, c.ttl); got != c.want {
+			t.Fatalf("%d: got holder %q, want %q", i, got, c.want)
+		}
+	}
+
+	if err := s.ReleaseLease("testuser/production/cron/compaction", "kite-1"); err != nil {
+		t.Fatalf("ReleaseLease()=%s", err)
+	}
+
+	if got := acquire("kite-1", time.Minute); got != "kite-2" {
+		t.Fatalf("want lease to be released only by its holder, got holder %q", got)
+	}
+
+	if err := s.ReleaseLease("testuser/production/cron/compaction", "kite-2"); err != nil {
+		t.Fatalf("ReleaseLease()=%s", err)
+	}
+
+	if got := acquire("kite-1", time.Minute); got != "kite-1" {
+		t.Fatalf("got holder %q, want kite-1", got)
+	}
+}
@@ -392,3 +392,86 @@ func getAudience(q *protocol.KontrolQuery) string {
 		return "/" + q.Username
 	}
 }
+
+// AcquireLease implements the LeaseStorage interface.
+func (e *Etcd) AcquireLease(lease *protocol.Lease) (*protocol.Lease, error) {
+	etcdKey := LeasesPrefix + "/" + lease.Name
+
+	// etcd expires keys with a second precision
+	ttl := lease.ExpiresAt.Sub(time.Now())
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	opts := &etcd.SetOptions{
+		TTL:       ttl,
+		PrevExist: etcd.PrevNoExist,
+	}
+
+	for {
+		_, err := e.client.Set(context.TODO(), etcdKey, lease.Holder, opts)
+		if err == nil {
+			return lease, nil
+		}
+
+		if !isEtcdError(err, etcd.ErrorCodeNodeExist, etcd.ErrorCodeTestFailed, etcd.ErrorCodeKeyNotFound) {
+			return nil, err
+		}
+
+		resp, err := e.client.Get(context.TODO(), etcdKey, nil)
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			// the lease expired in the meantime, try to acquire it again
+			opts.PrevExist = etcd.PrevNoExist
+			opts.PrevValue = ""
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Node.Value != lease.Holder {
+			cur := &protocol.Lease{
+				Name:   lease.Name,
+				Holder: resp.Node.Value,
+			}
+
+			if resp.Node.Expiration != nil {
+				cur.ExpiresAt = *resp.Node.Expiration
+			}
+
+			return cur, nil
+		}
+
+		// renew the lease, unless it was taken in the meantime
+		opts.PrevExist = etcd.PrevExist
+		opts.PrevValue = lease.Holder
+	}
+}
+
+// ReleaseLease implements the LeaseStorage interface.
+func (e *Etcd) ReleaseLease(name, holder string) error {
+	_, err := e.client.Delete(context.TODO(), LeasesPrefix+"/"+name, &etcd.DeleteOptions{
+		PrevValue: holder,
+	})
+
+	if isEtcdError(err, etcd.ErrorCodeKeyNotFound, etcd.ErrorCodeTestFailed) {
+		return nil
+	}
+
+	return err
+}
+
+func isEtcdError(err error, codes ...int) bool {
+	etcdErr, ok := err.(etcd.Error)
+	if !ok {
+		return false
+	}
+
+	for _, code := range codes {
+		if etcdErr.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
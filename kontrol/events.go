@@ -0,0 +1,191 @@
+package kontrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+// Types of registry events.
+const (
+	EventRegister   = "register"   // kite registered
+	EventDeregister = "deregister" // kite was removed with Deregister
+	EventExpired    = "expired"    // kite stopped sending heartbeats
+)
+
+// EventQueueSize is the number of registry events kept for publishing,
+// new events are dropped while the queue is full.
+var EventQueueSize = 1024
+
+// RegistryEvent describes a change of the registry.
+type RegistryEvent struct {
+	Type string        `json:"type"`
+	Kite protocol.Kite `json:"kite"`
+	URL  string        `json:"url,omitempty"`
+	Time time.Time     `json:"time"`
+}
+
+// EventPublisher publishes registry events to external systems.
+type EventPublisher interface {
+	Publish(*RegistryEvent) error
+}
+
+// EventPublisherFunc is an adapter to allow the use of ordinary functions
+// as event publishers.
+type EventPublisherFunc func(*RegistryEvent) error
+
+// Publish calls fn(ev).
+func (fn EventPublisherFunc) Publish(ev *RegistryEvent) error {
+	return fn(ev)
+}
+
+// Webhook publishes registry events by POSTing them JSON-encoded
+// to the URL.
+type Webhook struct {
+	// URL of the webhook.
+	//
+	// Required.
+	URL string
+
+	// Header is added to each request, for example to authenticate it.
+	Header http.Header
+
+	// Client is used to send requests.
+	//
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Publish implements the EventPublisher interface.
+func (w *Webhook) Publish(ev *RegistryEvent) error {
+	p, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range w.Header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+	}
+
+	return nil
+}
+
+// NATSConn is the part of a NATS connection used to publish registry
+// events, like *nats.Conn.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATS publishes registry events JSON-encoded to a NATS subject,
+// suffixed with the event type, e.g. "kontrol.events.register".
+type NATS struct {
+	Conn    NATSConn
+	Subject string
+}
+
+// Publish implements the EventPublisher interface.
+func (n *NATS) Publish(ev *RegistryEvent) error {
+	p, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return n.Conn.Publish(n.Subject+"."+ev.Type, p)
+}
+
+// eventBus publishes registry events in order they happened.
+type eventBus struct {
+	mu         sync.RWMutex
+	queue      chan *RegistryEvent // nil until a publisher is added
+	publishers []EventPublisher
+}
+
+// AddEventPublisher makes kontrol publish events of the registry with p,
+// so external systems may follow kites registering and going away.
+//
+// Events are published asynchronously, one at a time.
+func (k *Kontrol) AddEventPublisher(p EventPublisher) {
+	k.events.mu.Lock()
+	defer k.events.mu.Unlock()
+
+	k.events.publishers = append(k.events.publishers, p)
+
+	if k.events.queue == nil {
+		k.events.queue = make(chan *RegistryEvent, EventQueueSize)
+		go k.publishEvents(k.events.queue)
+	}
+}
+
+// publish queues the event for publishing, if there are any publishers.
+func (k *Kontrol) publish(typ string, kite *protocol.Kite, url string) {
+	k.events.mu.RLock()
+	queue := k.events.queue
+	k.events.mu.RUnlock()
+
+	if queue == nil {
+		return
+	}
+
+	ev := &RegistryEvent{
+		Type: typ,
+		Kite: *kite,
+		URL:  url,
+		Time: time.Now().UTC(),
+	}
+
+	select {
+	case queue <- ev:
+	default:
+		k.log.Warning("event queue is full, dropping %s event of %s", typ, kite)
+	}
+}
+
+func (k *Kontrol) publishEvents(queue <-chan *RegistryEvent) {
+	for {
+		select {
+		case <-k.closed:
+			return
+		case ev := <-queue:
+			k.events.mu.RLock()
+			publishers := k.events.publishers
+			k.events.mu.RUnlock()
+
+			for _, p := range publishers {
+				if err := p.Publish(ev); err != nil {
+					k.log.Error("publishing %s event of %s: %s", ev.Type, &ev.Kite, err)
+				}
+			}
+		}
+	}
+}
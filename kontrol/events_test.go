@@ -0,0 +1,84 @@
+package kontrol
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+type natsConn chan string
+
+func (c natsConn) Publish(subject string, data []byte) error {
+	c <- subject
+	return nil
+}
+
+func TestEventPublishers(t *testing.T) {
+	received := make(chan *RegistryEvent, 4)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var ev RegistryEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		received <- &ev
+	}))
+	defer ts.Close()
+
+	k := &Kontrol{
+		closed: make(chan struct{}),
+		log:    kite.New("kontrol", "0.0.1").Log,
+	}
+	defer close(k.closed)
+
+	// No publishers, the event is dropped.
+	k.publish(EventRegister, &protocol.Kite{ID: "dropped"}, "")
+
+	k.AddEventPublisher(&Webhook{
+		URL:    ts.URL,
+		Header: http.Header{"X-Token": {"secret"}},
+	})
+
+	subjects := make(natsConn, 4)
+	k.AddEventPublisher(&NATS{Conn: subjects, Subject: "kontrol.events"})
+
+	k.publish(EventRegister, &protocol.Kite{ID: "1"}, "http://localhost:5000/kite")
+	k.publish(EventExpired, &protocol.Kite{ID: "1"}, "http://localhost:5000/kite")
+
+	for _, typ := range []string{EventRegister, EventExpired} {
+		select {
+		case ev := <-received:
+			if ev.Type != typ || ev.Kite.ID != "1" || ev.URL != "http://localhost:5000/kite" {
+				t.Fatalf("got %+v, want %s event of kite 1", ev, typ)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s webhook", typ)
+		}
+
+		select {
+		case subject := <-subjects:
+			if want := "kontrol.events." + typ; subject != want {
+				t.Fatalf("got %q, want %q", subject, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s NATS message", typ)
+		}
+	}
+
+	err := (&Webhook{URL: ts.URL}).Publish(&RegistryEvent{Type: EventDeregister})
+	if err == nil {
+		t.Fatal("want unauthorized webhook to fail")
+	}
+}
@@ -0,0 +1,67 @@
+package kontrol
+
+import (
+	"errors"
+
+	"github.com/koding/kite"
+)
+
+// SetFlag sets the feature flag to the given value and pushes it to
+// all kites connected to kontrol, which expose it with
+// (*kite.Kite).Flags. Kites registering later fetch the flags with
+// the "getFlags" method. A nil value removes the flag.
+//
+// The value must be encodable as JSON. The flags are kept in memory
+// only.
+func (k *Kontrol) SetFlag(name string, value interface{}) error {
+	if name == "" {
+		return errors.New("empty flag name")
+	}
+
+	k.flagsMu.Lock()
+	if value == nil {
+		delete(k.flags, name)
+	} else {
+		k.flags[name] = value
+	}
+	k.flagsMu.Unlock()
+
+	k.log.Info("Feature flag %q set to %v", name, value)
+
+	k.push("kite.setFlags", map[string]interface{}{name: value})
+
+	return nil
+}
+
+// Flags gives a copy of the feature flags.
+func (k *Kontrol) Flags() map[string]interface{} {
+	k.flagsMu.Lock()
+	defer k.flagsMu.Unlock()
+
+	flags := make(map[string]interface{}, len(k.flags))
+	for name, value := range k.flags {
+		flags[name] = value
+	}
+
+	return flags
+}
+
+// HandleSetFlag sets the feature flag given as the argument, which
+// is an object with "name" and "value" fields.
+func (k *Kontrol) HandleSetFlag(r *kite.Request) (interface{}, error) {
+	var args struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	return nil, k.SetFlag(args.Name, args.Value)
+}
+
+// HandleGetFlags returns the current feature flags.
+func (k *Kontrol) HandleGetFlags(r *kite.Request) (interface{}, error) {
+	return k.Flags(), nil
+}
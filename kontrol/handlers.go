@@ -3,6 +3,7 @@ package kontrol
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"sync/atomic"
 	"time"
@@ -16,6 +17,21 @@ import (
 	"github.com/koding/kite/protocol"
 )
 
+// validateURLs checks the additional URLs a kite registers with.
+func validateURLs(urls []protocol.AdvertisedURL) error {
+	for _, u := range urls {
+		if u.URL == "" {
+			return errors.New("empty advertised url")
+		}
+
+		if _, err := url.Parse(u.URL); err != nil {
+			return fmt.Errorf("invalid advertised URL: %s", err)
+		}
+	}
+
+	return nil
+}
+
 func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	k.log.Info("Register request from: %s", r.Client.Kite)
 
@@ -26,7 +42,8 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	}
 
 	var args struct {
-		URL string `json:"url"`
+		URL  string                   `json:"url"`
+		URLs []protocol.AdvertisedURL `json:"urls"`
 	}
 
 	if err := r.Args.One().Unmarshal(&args); err != nil {
@@ -41,6 +58,10 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 		return nil, fmt.Errorf("invalid register URL: %s", err)
 	}
 
+	if err := validateURLs(args.URLs); err != nil {
+		return nil, err
+	}
+
 	res := &protocol.RegisterResult{
 		URL: args.URL,
 	}
@@ -77,6 +98,7 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	value := &kontrolprotocol.RegisterValue{
 		URL:   args.URL,
 		KeyID: keyPair.ID,
+		URLs:  args.URLs,
 	}
 
 	// Register first by adding the value to the storage. Return if there is
@@ -110,6 +132,7 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 			case <-time.After(HeartbeatInterval + HeartbeatDelay):
 				k.log.Debug("Kite didn't sent any heartbeat %s.", &kiteCopy)
 				atomic.StoreInt32(&closed, 1)
+				k.publish(EventExpired, &kiteCopy, value.URL)
 				return
 			}
 		}
@@ -121,6 +144,7 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 		HeartbeatInterval / time.Second,
 		dnode.Callback(func(args *dnode.Partial) {
 			k.log.Debug("Kite send us an heartbeat. %s", &kiteCopy)
+			k.history.add(kiteCopy.ID)
 
 			k.clientLocks.Get(kiteCopy.ID).Lock()
 			defer k.clientLocks.Get(kiteCopy.ID).Unlock()
@@ -138,6 +162,7 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 				// before us, so try to add it again, the updater will than
 				// continue to update it afterwards.
 				k.storage.Upsert(&kiteCopy, value)
+				k.publish(EventRegister, &kiteCopy, value.URL)
 				go updaterFunc()
 			}
 		}),
@@ -153,11 +178,22 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	}()
 
 	k.log.Info("Kite registered: %s", &r.Client.Kite)
+	k.publish(EventRegister, &kiteCopy, value.URL)
 
 	clientKite := r.Client.Kite.String()
 
+	k.revocations.addKite(kiteCopy.ID, r.Client)
+
+	stopHealth := make(chan struct{})
+
+	if k.HealthCheckInterval > 0 {
+		go k.checkHealth(kiteCopy.ID, r.Client, stopHealth)
+	}
+
 	r.Client.OnDisconnect(func() {
 		k.log.Info("Kite disconnected: %s", clientKite)
+		k.revocations.removeKite(kiteCopy.ID, r.Client)
+		close(stopHealth)
 	})
 
 	return res, nil
@@ -176,6 +212,9 @@ func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	k.removeUnready(&kites)
+	k.removeInvisible(&kites, requestLocation(r))
+
 	for _, kite := range kites {
 		keyPair, err := k.getOrUpdateKeyID(kite.KeyID, r)
 		if err != nil {
@@ -217,6 +256,8 @@ func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	k.removeInvisible(&kites, requestLocation(r))
+
 	if len(kites) > 1 {
 		return nil, errors.New("query matches more than one kite")
 	}
@@ -351,14 +392,7 @@ func (k *Kontrol) updateKeyWithKeyPair(t *jwt.Token, keyPair *KeyPair) string {
 		claims.KontrolKey = keyPair.Public
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyPair.Private))
-	if err != nil {
-		k.log.Error("key update error for %q: %s", claims.Subject, err)
-
-		return ""
-	}
-
-	kiteKey, err := t.SignedString(rsaPrivate)
+	kiteKey, err := k.signToken(t, keyPair.Private)
 	if err != nil {
 		k.log.Error("key update error for %q: %s", claims.Subject, err)
 
@@ -406,3 +440,19 @@ func (k *Kontrol) getOrUpdateKeyID(id string, r *kite.Request) (*KeyPair, error)
 
 	return kp, nil
 }
+
+// HandleEchoAddress returns the IP address the caller connected from, as
+// seen by Kontrol, so kites behind NAT can detect the address they are
+// reachable at.
+func (k *Kontrol) HandleEchoAddress(r *kite.Request) (interface{}, error) {
+	addr := r.Client.RemoteAddr()
+	if addr == "" {
+		return nil, errors.New("remote address is unknown")
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,74 @@
+package kontrol
+
+import (
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// checkHealth asks the registered kite for its health every
+// HealthCheckInterval, until stop is closed.
+func (k *Kontrol) checkHealth(id string, c *kite.Client, stop <-chan struct{}) {
+	ticker := time.NewTicker(k.HealthCheckInterval)
+	defer ticker.Stop()
+
+	defer k.setReady(id, true)
+
+	for {
+		k.setReady(id, k.healthy(id, c))
+
+		select {
+		case <-stop:
+			return
+		case <-k.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthy tells whether the kite is ready. Kites, which do not serve
+// kite.health, are considered ready.
+func (k *Kontrol) healthy(id string, c *kite.Client) bool {
+	h, err := c.Health()
+	if e, ok := err.(*kite.Error); ok && e.Type == "methodNotFound" {
+		return true
+	}
+
+	if err != nil {
+		k.log.Debug("health check of %s failed: %s", id, err)
+		return false
+	}
+
+	return h.Ready
+}
+
+func (k *Kontrol) setReady(id string, ready bool) {
+	k.unreadyMu.Lock()
+	defer k.unreadyMu.Unlock()
+
+	if ready {
+		delete(k.unready, id)
+	} else {
+		k.unready[id] = true
+	}
+}
+
+// removeUnready removes the kites, which reported they are not ready.
+func (k *Kontrol) removeUnready(kites *Kites) {
+	k.unreadyMu.Lock()
+	defer k.unreadyMu.Unlock()
+
+	if len(k.unready) == 0 {
+		return
+	}
+
+	ready := make(Kites, 0, len(*kites))
+	for _, kite := range *kites {
+		if !k.unready[kite.Kite.ID] {
+			ready = append(ready, kite)
+		}
+	}
+
+	*kites = ready
+}
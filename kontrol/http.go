@@ -33,6 +33,7 @@ func (k *Kontrol) HandleHeartbeat(rw http.ResponseWriter, req *http.Request) {
 		// heartbeat, the timer func is being called, which stops the updater
 		// so the key is being deleted automatically via the TTL mechanism.
 		h.timer.Reset(HeartbeatInterval + HeartbeatDelay)
+		k.history.add(id)
 
 		k.log.Debug("Sending pong '%s'", id)
 		rw.Write([]byte("pong"))
@@ -75,6 +76,11 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if err := validateURLs(args.URLs); err != nil {
+		http.Error(rw, jsonError(err), http.StatusBadRequest)
+		return
+	}
+
 	// decode and authenticated the token key. We'll get the authenticated
 	// username
 	username, err := k.Kite.AuthenticateSimpleKiteKey(args.Auth.Key)
@@ -135,6 +141,7 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 	value := &kontrolprotocol.RegisterValue{
 		URL:   args.URL,
 		KeyID: keyPair.ID,
+		URLs:  args.URLs,
 	}
 
 	// Register first by adding the value to the storage. Return if there is
@@ -165,12 +172,13 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 		// the storage so it's always up to date. Instead of updating the key
 		// periodically according to the HeartBeatInterval below, we are buffering
 		// the write speed here with the UpdateInterval.
+		updater := time.NewTicker(UpdateInterval)
+
 		h = &heartbeat{
 			updateC: make(chan func() error),
+			updater: updater,
 		}
 
-		updater := time.NewTicker(UpdateInterval)
-
 		go func() {
 			update := func() error {
 				return k.storage.Update(remoteKite, value)
@@ -216,12 +224,15 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 			}
 
 			delete(k.heartbeats, remoteKite.ID)
+
+			k.publish(EventExpired, remoteKite, value.URL)
 		})
 
 		k.heartbeats[remoteKite.ID] = h
 	}
 
 	k.log.Info("Kite registered (via HTTP): %s", remoteKite)
+	k.publish(EventRegister, remoteKite, value.URL)
 
 	// send the response back to the requester
 	if err := json.NewEncoder(rw).Encode(resp); err != nil {
@@ -3,6 +3,7 @@
 package kontrol
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -21,6 +22,7 @@ import (
 const (
 	KontrolVersion = "0.0.4"
 	KitesPrefix    = "/kites"
+	LeasesPrefix   = "/leases"
 )
 
 var (
@@ -28,6 +30,10 @@ var (
 	// accepted for processing.
 	TokenTTL = 48 * time.Hour
 
+	// DelegationTokenTTL is the maximum lifetime of delegation tokens
+	// issued for forwarded calls.
+	DelegationTokenTTL = 5 * time.Minute
+
 	// TokenLeeway - implementers MAY provide for some small leeway, usually
 	// no more than a few minutes, to account for clock skew.
 	TokenLeeway = 5 * time.Minute
@@ -84,11 +90,49 @@ type Kontrol struct {
 	// TokenNoNBF when true does not set nbf field for generated JWT tokens.
 	TokenNoNBF bool
 
+	// HealthCheckInterval is the interval in which registered kites are
+	// asked for their health with kite.health. Kites, which report they
+	// are not ready, are not returned by getKites until they recover.
+	//
+	// If zero, health of kites is not checked.
+	HealthCheckInterval time.Duration
+
+	// VisibilityRules restrict which callers are returned the registered
+	// kites by getKites and getToken, e.g. to never return kites of the
+	// "staging" environment to "production" ones.
+	//
+	// If empty, all kites are visible to all callers.
+	VisibilityRules []*VisibilityRule
+
 	clientLocks *IdLock
 
 	heartbeats   map[string]*heartbeat
 	heartbeatsMu sync.Mutex // protects each clients heartbeat timer
 
+	// history keeps recent heartbeats of each kite
+	history *heartbeatHistory
+
+	// revocations keeps revoked tokens and kites they are pushed to
+	revocations *revocations
+
+	// flags are the feature flags pushed to the registered kites
+	flags   map[string]interface{}
+	flagsMu sync.Mutex
+
+	// leases keeps leases of elections
+	leases     LeaseStorage
+	leasesOnce sync.Once
+
+	// events publishes changes of the registry
+	events eventBus
+
+	// watchers are kites notified about changes of the registry
+	watchers watchers
+
+	// unready keeps IDs of registered kites, which are not ready
+	unready   map[string]bool
+	unreadyMu sync.Mutex
+
 	tokenCache   map[string]cachedToken
 	tokenCacheMu sync.Mutex
 
@@ -110,6 +154,11 @@ type Kontrol struct {
 	// selfKeyPair is a key pair used to sign Kontrol's kite key.
 	selfKeyPair *KeyPair
 
+	// signers hold private keys of key pairs added with AddSigner,
+	// by their refs.
+	signers   map[string]crypto.Signer
+	signersMu sync.RWMutex // protects signers
+
 	// RegisterURL defines the URL that is used to self register when adding
 	// itself to the storage backend
 	RegisterURL string
@@ -120,6 +169,7 @@ type Kontrol struct {
 type heartbeat struct {
 	updateC chan func() error
 	timer   *time.Timer
+	updater *time.Ticker
 }
 
 // New creates a new kontrol instance with the given version and config
@@ -145,9 +195,29 @@ func New(conf *config.Config, version string) *Kontrol {
 	kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 	kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
 	kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
+	kontrol.Kite.HandleFunc("getRevokedTokens", kontrol.HandleGetRevokedTokens)
+	kontrol.Kite.HandleFunc("getDelegationToken", kontrol.HandleGetDelegationToken)
+	kontrol.Kite.HandleFunc("kontrol.members", kontrol.HandleMembers)
+	kontrol.Kite.HandleFunc("kontrol.echoAddress", kontrol.HandleEchoAddress)
+	kontrol.Kite.HandleFunc("deregister", kontrol.HandleDeregisterSelf)
+	kontrol.Kite.HandleFunc("watchKites", kontrol.HandleWatchKites)
+	kontrol.Kite.HandleFunc("revokeToken", kontrol.Kite.AdminOnly(kontrol.HandleRevokeToken))
+	kontrol.Kite.HandleFunc("getFlags", kontrol.HandleGetFlags)
+	kontrol.Kite.HandleFunc("setFlag", kontrol.Kite.AdminOnly(kontrol.HandleSetFlag))
+	kontrol.Kite.HandleFunc("kontrol.acquireLease", kontrol.HandleAcquireLease)
+	kontrol.Kite.HandleFunc("kontrol.releaseLease", kontrol.HandleReleaseLease)
+	kontrol.Kite.HandleFunc("kontrol.acquireSemaphore", kontrol.HandleAcquireSemaphore)
+	kontrol.Kite.HandleFunc("kontrol.releaseSemaphore", kontrol.HandleReleaseSemaphore)
+
+	kontrol.Kite.HandleFunc("kontrol.admin.kites", kontrol.Kite.AdminOnly(kontrol.HandleListKites))
+	kontrol.Kite.HandleFunc("kontrol.admin.deregister", kontrol.Kite.AdminOnly(kontrol.HandleDeregister))
+	kontrol.Kite.HandleFunc("kontrol.admin.heartbeats", kontrol.Kite.AdminOnly(kontrol.HandleHeartbeats))
+	kontrol.Kite.HandleFunc("kontrol.admin.versions", kontrol.Kite.AdminOnly(kontrol.HandleVersions))
 
 	kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
 	kontrol.Kite.HandleHTTPFunc("/heartbeat", kontrol.HandleHeartbeat)
+	kontrol.Kite.HandleHTTPFunc("/dashboard", kontrol.HandleDashboard)
+	kontrol.Kite.HandleHTTPFunc("/api/kites", kontrol.HandleKitesHTTP)
 
 	return kontrol
 }
@@ -164,13 +234,26 @@ func New(conf *config.Config, version string) *Kontrol {
 //     kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 //     kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
 //     kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
+//     kontrol.Kite.HandleFunc("getRevokedTokens", kontrol.HandleGetRevokedTokens)
+//     kontrol.Kite.HandleFunc("getFlags", kontrol.HandleGetFlags)
+//     kontrol.Kite.HandleFunc("getDelegationToken", kontrol.HandleGetDelegationToken)
+//     kontrol.Kite.HandleFunc("kontrol.members", kontrol.HandleMembers)
+//     kontrol.Kite.HandleFunc("kontrol.echoAddress", kontrol.HandleEchoAddress)
+//     kontrol.Kite.HandleFunc("deregister", kontrol.HandleDeregisterSelf)
+//     kontrol.Kite.HandleFunc("watchKites", kontrol.HandleWatchKites)
 //     kontrol.Kite.HandleHTTPFunc("/heartbeat", kontrol.HandleHeartbeat)
 //     kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
+//     kontrol.Kite.HandleHTTPFunc("/dashboard", kontrol.HandleDashboard)
+//     kontrol.Kite.HandleHTTPFunc("/api/kites", kontrol.HandleKitesHTTP)
 //
 func NewWithoutHandlers(conf *config.Config, version string) *Kontrol {
 	k := &Kontrol{
 		clientLocks: NewIdlock(),
 		heartbeats:  make(map[string]*heartbeat),
+		history:     newHeartbeatHistory(),
+		revocations: newRevocations(),
+		flags:       make(map[string]interface{}),
+		unready:     make(map[string]bool),
 		closed:      make(chan struct{}),
 		tokenCache:  make(map[string]cachedToken),
 	}
@@ -369,14 +452,14 @@ func (k *Kontrol) registerUser(username, publicKey, privateKey string) (kiteKey
 		KontrolKey: strings.TrimSpace(publicKey),
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	kiteKey, err = k.signToken(jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims), privateKey)
 	if err != nil {
 		return "", err
 	}
 
 	k.Kite.Log.Info("Registered machine on user: %s", username)
 
-	return jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	return kiteKey, nil
 }
 
 // registerSelf adds Kontrol itself to the storage as a kite.
@@ -511,9 +594,15 @@ type token struct {
 	issuer   string
 	keyPair  *KeyPair
 	force    bool
+
+	// delegation tokens only, they are never cached
+	delegate string
+	scopes   []string
+	expires  time.Time
 }
 
 type cachedToken struct {
+	id     string // jti of the token, see evictToken
 	signed string
 	timer  *time.Timer
 }
@@ -528,12 +617,13 @@ func (t *token) String() string {
 //
 // If the token was already exists in the cache, it will be
 // overwritten with a new value.
-func (k *Kontrol) cacheToken(key, signed string) {
+func (k *Kontrol) cacheToken(key, id, signed string) {
 	if ct, ok := k.tokenCache[key]; ok {
 		ct.timer.Stop()
 	}
 
 	k.tokenCache[key] = cachedToken{
+		id:     id,
 		signed: signed,
 		timer: time.AfterFunc(k.tokenTTL()-k.tokenLeeway(), func() {
 			k.tokenCacheMu.Lock()
@@ -543,6 +633,20 @@ func (k *Kontrol) cacheToken(key, signed string) {
 	}
 }
 
+// evictToken removes the token with the given jti from the cache, so
+// a new token is generated instead of handing out the revoked one.
+func (k *Kontrol) evictToken(id string) {
+	k.tokenCacheMu.Lock()
+	defer k.tokenCacheMu.Unlock()
+
+	for key, ct := range k.tokenCache {
+		if ct.id == id {
+			ct.timer.Stop()
+			delete(k.tokenCache, key)
+		}
+	}
+}
+
 // generateToken returns a JWT token string. Please see the URL for details:
 // http://tools.ietf.org/html/draft-ietf-oauth-json-web-token-13#section-4.1
 func (k *Kontrol) generateToken(tok *token) (string, error) {
@@ -551,17 +655,12 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 	k.tokenCacheMu.Lock()
 	defer k.tokenCacheMu.Unlock()
 
-	if !tok.force {
+	if !tok.force && tok.delegate == "" {
 		if ct, ok := k.tokenCache[uniqKey]; ok {
 			return ct.signed, nil
 		}
 	}
 
-	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(tok.keyPair.Private))
-	if err != nil {
-		return "", err
-	}
-
 	now := time.Now().UTC()
 
 	claims := &kitekey.KiteClaims{
@@ -579,12 +678,20 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 		claims.NotBefore = now.Add(-k.tokenLeeway()).Unix()
 	}
 
-	signed, err := jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	if tok.delegate != "" {
+		claims.Delegate = tok.delegate
+		claims.Scopes = tok.scopes
+		claims.ExpiresAt = tok.expires.UTC().Unix()
+	}
+
+	signed, err := k.signToken(jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims), tok.keyPair.Private)
 	if err != nil {
 		return "", errors.New("Server error: Cannot generate a token")
 	}
 
-	k.cacheToken(uniqKey, signed)
+	if tok.delegate == "" {
+		k.cacheToken(uniqKey, claims.Id, signed)
+	}
 
 	return signed, nil
 }
@@ -31,6 +31,10 @@ type Kontrol struct {
 	Machines []string
 	Version  string `default:"0.0.1"`
 
+	// Admins lists users allowed to call kontrol.admin.* methods
+	// and to view the dashboard.
+	Admins []string
+
 	Postgres struct {
 		Host           string `default:"localhost"`
 		Port           int    `default:"5432"`
@@ -66,6 +70,7 @@ func main() {
 	kiteConf.Port = conf.Port
 
 	k := kontrol.New(kiteConf, conf.Version)
+	k.Kite.Admins = conf.Admins
 
 	if conf.TLSCertFile != "" || conf.TLSKeyFile != "" {
 		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
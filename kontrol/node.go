@@ -61,6 +61,7 @@ func (n *Node) Kite() (*protocol.KiteWithToken, error) {
 		Kite:  *kite,
 		URL:   val.URL,
 		KeyID: val.KeyID,
+		URLs:  val.URLs,
 	}, nil
 }
 
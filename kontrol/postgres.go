@@ -2,6 +2,7 @@ package kontrol
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
@@ -41,6 +42,7 @@ type Postgres struct {
 var (
 	_ Storage        = (*Postgres)(nil)
 	_ KeyPairStorage = (*Postgres)(nil)
+	_ LeaseStorage   = (*Postgres)(nil)
 )
 
 func NewPostgres(conf *PostgresConfig, log kite.Logger) *Postgres {
@@ -182,6 +184,7 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 		updated_at  time.Time
 		created_at  time.Time
 		keyId       string
+		urls        []byte
 	)
 
 	kites := make(Kites, 0)
@@ -199,11 +202,20 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 			&updated_at,
 			&created_at,
 			&keyId,
+			&urls,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		var advertised []protocol.AdvertisedURL
+
+		if len(urls) != 0 {
+			if err := json.Unmarshal(urls, &advertised); err != nil {
+				return nil, err
+			}
+		}
+
 		kites = append(kites, &protocol.KiteWithToken{
 			Kite: protocol.Kite{
 				Username:    username,
@@ -216,6 +228,7 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 			},
 			URL:   url,
 			KeyID: keyId,
+			URLs:  advertised,
 		})
 	}
 
@@ -251,6 +264,11 @@ func (p *Postgres) Upsert(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		return errors.New("postgres: keyId is empty. Aborting upsert")
 	}
 
+	urls, err := urlsValue(value.URLs)
+	if err != nil {
+		return err
+	}
+
 	// we are going to try an UPDATE, if it's not successful we are going to
 	// INSERT the document, all ine one single transaction
 	tx, err := p.DB.Begin()
@@ -267,8 +285,8 @@ func (p *Postgres) Upsert(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		}
 	}()
 
-	res, err := tx.Exec(`UPDATE kite.kite SET url = $1, key_id = $3, updated_at = (now() at time zone 'utc') WHERE id = $2`,
-		value.URL, kiteProt.ID, value.KeyID)
+	res, err := tx.Exec(`UPDATE kite.kite SET url = $1, key_id = $3, urls = $4, updated_at = (now() at time zone 'utc') WHERE id = $2`,
+		value.URL, kiteProt.ID, value.KeyID, urls)
 	if err != nil {
 		return err
 	}
@@ -283,7 +301,7 @@ func (p *Postgres) Upsert(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		return nil
 	}
 
-	insertSQL, args, err := insertKiteQuery(kiteProt, value.URL, value.KeyID)
+	insertSQL, args, err := insertKiteQuery(kiteProt, value)
 	if err != nil {
 		return err
 	}
@@ -299,7 +317,7 @@ func (p *Postgres) Add(kiteProt *protocol.Kite, value *kontrolprotocol.RegisterV
 		return err
 	}
 
-	sqlQuery, args, err := insertKiteQuery(kiteProt, value.URL, value.KeyID)
+	sqlQuery, args, err := insertKiteQuery(kiteProt, value)
 	if err != nil {
 		return err
 	}
@@ -315,11 +333,16 @@ func (p *Postgres) Update(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		return err
 	}
 
+	urls, err := urlsValue(value.URLs)
+	if err != nil {
+		return err
+	}
+
 	// TODO: also consider just using WHERE id = kiteProt.ID, see how it's
 	// performs out
-	_, err = p.DB.Exec(`UPDATE kite.kite SET url = $1, updated_at = (now() at time zone 'utc') 
+	_, err = p.DB.Exec(`UPDATE kite.kite SET url = $1, urls = $3, updated_at = (now() at time zone 'utc') 
 	WHERE id = $2`,
-		value.URL, kiteProt.ID)
+		value.URL, kiteProt.ID, urls)
 
 	return err
 }
@@ -360,10 +383,15 @@ func selectQuery(query *protocol.KontrolQuery) (string, []interface{}, error) {
 	return kites.Where(andQuery).ToSql()
 }
 
-// inseryKiteQuery inserts the given kite, url and key to the kite.kite table
-func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []interface{}, error) {
+// insertKiteQuery inserts the given kite with its value to the kite.kite table
+func insertKiteQuery(kiteProt *protocol.Kite, value *kontrolprotocol.RegisterValue) (string, []interface{}, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
+	urls, err := urlsValue(value.URLs)
+	if err != nil {
+		return "", nil, err
+	}
+
 	kiteValues := kiteProt.Values()
 	values := make([]interface{}, len(kiteValues))
 
@@ -371,8 +399,9 @@ func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []inte
 		values[i] = kiteVal
 	}
 
-	values = append(values, url)
-	values = append(values, keyId)
+	values = append(values, value.URL)
+	values = append(values, value.KeyID)
+	values = append(values, urls)
 
 	return psql.Insert("kite.kite").Columns(
 		"username",
@@ -384,9 +413,25 @@ func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []inte
 		"id",
 		"url",
 		"key_id",
+		"urls",
 	).Values(values...).ToSql()
 }
 
+// urlsValue gives the value of the urls column, which is NULL
+// if the kite has no additional URLs.
+func urlsValue(urls []protocol.AdvertisedURL) (interface{}, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	p, err := json.Marshal(urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(p), nil
+}
+
 /*
 
 --- Key Pair -----------------
@@ -470,3 +515,57 @@ func (p *Postgres) GetKeyFromID(id string) (*KeyPair, error) {
 func (p *Postgres) GetKeyFromPublic(public string) (*KeyPair, error) {
 	return p.getKey(sq.Eq{"public": public})
 }
+
+// AcquireLease implements the LeaseStorage interface. The expiration
+// time of the lease is computed by the database, so it does not depend
+// on clocks of kontrol instances.
+func (p *Postgres) AcquireLease(lease *protocol.Lease) (*protocol.Lease, error) {
+	ttl := lease.ExpiresAt.Sub(time.Now()).Seconds()
+
+	// take the lease over if it's already ours or it has expired
+	res, err := p.DB.Exec(`UPDATE kite.lease SET holder = $2, expires_at = now() + $3 * interval '1 second'
+	WHERE name = $1 AND (holder = $2 OR expires_at < now())`,
+		lease.Name, lease.Holder, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	rowAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowAffected == 0 {
+		_, err = p.DB.Exec(`INSERT INTO kite.lease (name, holder, expires_at)
+		SELECT $1, $2, now() + $3 * interval '1 second'
+		WHERE NOT EXISTS (SELECT 1 FROM kite.lease WHERE name = $1)`,
+			lease.Name, lease.Holder, ttl)
+
+		// other kite inserted the lease in the meantime
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			err = nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cur := &protocol.Lease{
+		Name: lease.Name,
+	}
+
+	err = p.DB.QueryRow(`SELECT holder, expires_at FROM kite.lease WHERE name = $1`, lease.Name).
+		Scan(&cur.Holder, &cur.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return cur, nil
+}
+
+// ReleaseLease implements the LeaseStorage interface.
+func (p *Postgres) ReleaseLease(name, holder string) error {
+	_, err := p.DB.Exec(`DELETE FROM kite.lease WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
@@ -1,5 +1,11 @@
 package protocol
 
+import (
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
 // RegisterValue is the type of the value that is saved to the storage
 type RegisterValue struct {
 	// URL is the Kite's URL that can be accessed
@@ -9,4 +15,26 @@ type RegisterValue struct {
 	// This is currently only used by Kontrol itself internally, however it
 	// might be changed in the future.
 	KeyID string `json:"key_id"`
+
+	// URLs are additional URLs the kite is reachable at.
+	URLs []protocol.AdvertisedURL `json:"urls,omitempty"`
+}
+
+// HeartbeatsResult is a response value for the "kontrol.admin.heartbeats"
+// method.
+type HeartbeatsResult struct {
+	// ID is the ID of the kite.
+	ID string `json:"id"`
+
+	// Heartbeats holds times of the most recent heartbeats received
+	// from the kite, oldest first.
+	Heartbeats []time.Time `json:"heartbeats"`
+}
+
+// VersionCount is the number of registered instances of a single
+// version of a kite.
+type VersionCount struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Count   int    `json:"count"`
 }
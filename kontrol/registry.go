@@ -0,0 +1,285 @@
+package kontrol
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+// HeartbeatHistorySize is the number of most recent heartbeats
+// kept for each kite.
+var HeartbeatHistorySize = 32
+
+// heartbeatHistory records times of heartbeats received from kites.
+type heartbeatHistory struct {
+	mu    sync.Mutex
+	times map[string][]time.Time // kite ID -> heartbeats, oldest first
+}
+
+func newHeartbeatHistory() *heartbeatHistory {
+	return &heartbeatHistory{
+		times: make(map[string][]time.Time),
+	}
+}
+
+func (h *heartbeatHistory) add(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	times := append(h.times[id], time.Now().UTC())
+	if n := len(times) - HeartbeatHistorySize; n > 0 {
+		times = append([]time.Time(nil), times[n:]...)
+	}
+
+	h.times[id] = times
+}
+
+func (h *heartbeatHistory) get(id string) []time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]time.Time(nil), h.times[id]...)
+}
+
+func (h *heartbeatHistory) delete(id string) {
+	h.mu.Lock()
+	delete(h.times, id)
+	h.mu.Unlock()
+}
+
+// HandleListKites returns registered kites matching the query, without
+// generating tokens for them. If query has no username, the caller's
+// one is used.
+func (k *Kontrol) HandleListKites(r *kite.Request) (interface{}, error) {
+	var query protocol.KontrolQuery
+
+	if err := r.Args.One().Unmarshal(&query); err != nil {
+		return nil, err
+	}
+
+	return k.listKites(&query, r.Username)
+}
+
+// HandleDeregister forcibly removes the kite with the given ID
+// from the storage and drops its connection, if any.
+func (k *Kontrol) HandleDeregister(r *kite.Request) (interface{}, error) {
+	id, err := r.Args.One().String()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, k.Deregister(id)
+}
+
+// HandleHeartbeats returns heartbeat history of the kite with the given ID.
+func (k *Kontrol) HandleHeartbeats(r *kite.Request) (interface{}, error) {
+	id, err := r.Args.One().String()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kontrolprotocol.HeartbeatsResult{
+		ID:         id,
+		Heartbeats: k.history.get(id),
+	}, nil
+}
+
+// HandleVersions returns the number of registered instances per
+// kite version, for kites matching the query.
+func (k *Kontrol) HandleVersions(r *kite.Request) (interface{}, error) {
+	var query protocol.KontrolQuery
+
+	if err := r.Args.One().Unmarshal(&query); err != nil {
+		return nil, err
+	}
+
+	kites, err := k.listKites(&query, r.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return versionCounts(kites), nil
+}
+
+// Deregister removes the kite with the given ID from the storage, stops
+// tracking its heartbeats and closes its connection to kontrol.
+//
+// A kite that is still running is going to register again once it
+// reconnects.
+func (k *Kontrol) Deregister(id string) error {
+	return k.deregister(id, "", true)
+}
+
+// HandleDeregisterSelf removes the calling kite from the storage, so it is
+// no longer returned by getKites. Kites call it before shutting down.
+func (k *Kontrol) HandleDeregisterSelf(r *kite.Request) (interface{}, error) {
+	return nil, k.deregister(r.Client.Kite.ID, r.Username, false)
+}
+
+// deregister removes the kite with the given ID, which belongs to the
+// user, if username is not empty.
+func (k *Kontrol) deregister(id, username string, disconnect bool) error {
+	if id == "" {
+		return errors.New("no kite ID given")
+	}
+
+	kites, err := k.storage.Get(&protocol.KontrolQuery{ID: id})
+	if err != nil {
+		return err
+	}
+
+	var found bool
+
+	for _, kt := range kites {
+		if username != "" && kt.Kite.Username != username {
+			continue
+		}
+
+		if err := k.storage.Delete(&kt.Kite); err != nil {
+			return err
+		}
+
+		found = true
+		k.publish(EventDeregister, &kt.Kite, kt.URL)
+	}
+
+	if !found {
+		return errors.New("no kites found")
+	}
+
+	k.heartbeatsMu.Lock()
+	if h, ok := k.heartbeats[id]; ok {
+		h.timer.Stop()
+		h.updater.Stop()
+
+		select {
+		case <-h.updateC:
+		default:
+			close(h.updateC)
+		}
+
+		delete(k.heartbeats, id)
+	}
+	k.heartbeatsMu.Unlock()
+
+	if disconnect {
+		for _, conn := range k.Kite.Connections() {
+			if conn.Kite.ID == id {
+				k.Kite.Disconnect(conn.ID)
+			}
+		}
+	}
+
+	k.history.delete(id)
+
+	k.log.Info("Kite deregistered: %s", id)
+
+	return nil
+}
+
+func (k *Kontrol) listKites(query *protocol.KontrolQuery, username string) (Kites, error) {
+	if query.Username == "" && query.ID == "" {
+		query.Username = username
+	}
+
+	return k.storage.Get(query)
+}
+
+func versionCounts(kites Kites) []*kontrolprotocol.VersionCount {
+	counts := make(map[[2]string]int)
+
+	for _, kt := range kites {
+		counts[[2]string{kt.Kite.Name, kt.Kite.Version}]++
+	}
+
+	result := make([]*kontrolprotocol.VersionCount, 0, len(counts))
+	for key, n := range counts {
+		result = append(result, &kontrolprotocol.VersionCount{
+			Name:    key[0],
+			Version: key[1],
+			Count:   n,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version < result[j].Version
+	})
+
+	return result
+}
+
+// HandleDashboard serves a read-only HTML overview of the registry.
+//
+// Requests must be authenticated with an admin's kite key passed
+// in the "Authorization: Bearer <kite key>" header. The kites are
+// filtered with the query parameters named after KontrolQuery fields.
+func (k *Kontrol) HandleDashboard(rw http.ResponseWriter, req *http.Request) {
+	key := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	username, err := k.Kite.AuthenticateSimpleKiteKey(key)
+	if err != nil {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !k.Kite.IsAdmin(username) {
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := queryFromValues(req.URL.Query())
+
+	kites, err := k.listKites(query, username)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := &dashboardData{
+		Query:    query,
+		Kites:    kites,
+		Versions: versionCounts(kites),
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := dashboardTmpl.Execute(rw, data); err != nil {
+		k.log.Error("dashboard: %s", err)
+	}
+}
+
+type dashboardData struct {
+	Query    *protocol.KontrolQuery
+	Kites    Kites
+	Versions []*kontrolprotocol.VersionCount
+}
+
+var dashboardTmpl = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head><title>kontrol</title></head>
+<body>
+<h1>Kites of {{.Query.Username}}</h1>
+<h2>Versions</h2>
+<table>
+<tr><th>Name</th><th>Version</th><th>Instances</th></tr>
+{{range .Versions}}<tr><td>{{.Name}}</td><td>{{.Version}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Instances</h2>
+<table>
+<tr><th>Environment</th><th>Name</th><th>Version</th><th>Region</th><th>Hostname</th><th>ID</th><th>URL</th></tr>
+{{range .Kites}}<tr><td>{{.Kite.Environment}}</td><td>{{.Kite.Name}}</td><td>{{.Kite.Version}}</td><td>{{.Kite.Region}}</td><td>{{.Kite.Hostname}}</td><td>{{.Kite.ID}}</td><td>{{.URL}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,74 @@
+package kontrol
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+func TestVersionCounts(t *testing.T) {
+	kites := Kites{
+		{Kite: protocol.Kite{Name: "b", Version: "0.0.1"}},
+		{Kite: protocol.Kite{Name: "a", Version: "0.0.2"}},
+		{Kite: protocol.Kite{Name: "a", Version: "0.0.1"}},
+		{Kite: protocol.Kite{Name: "a", Version: "0.0.2"}},
+	}
+
+	want := []*kontrolprotocol.VersionCount{
+		{Name: "a", Version: "0.0.1", Count: 1},
+		{Name: "a", Version: "0.0.2", Count: 2},
+		{Name: "b", Version: "0.0.1", Count: 1},
+	}
+
+	if got := versionCounts(kites); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHeartbeatHistory(t *testing.T) {
+	h := newHeartbeatHistory()
+
+	for i := 0; i < HeartbeatHistorySize+5; i++ {
+		h.add("id")
+	}
+
+	times := h.get("id")
+
+	if len(times) != HeartbeatHistorySize {
+		t.Fatalf("got %d heartbeats, want %d", len(times), HeartbeatHistorySize)
+	}
+
+	for i := 1; i < len(times); i++ {
+		if times[i].Before(times[i-1]) {
+			t.Fatalf("heartbeats are not ordered: %v", times)
+		}
+	}
+
+	h.delete("id")
+
+	if times := h.get("id"); len(times) != 0 {
+		t.Fatalf("got %d heartbeats, want 0", len(times))
+	}
+}
+
+func TestQueryFromValues(t *testing.T) {
+	v, err := url.ParseQuery("username=alice&name=math&version=>%3D1.0&region=eu&id=abc")
+	if err != nil {
+		t.Fatalf("ParseQuery()=%s", err)
+	}
+
+	want := &protocol.KontrolQuery{
+		Username: "alice",
+		Name:     "math",
+		Version:  ">=1.0",
+		Region:   "eu",
+		ID:       "abc",
+	}
+
+	if got := queryFromValues(v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
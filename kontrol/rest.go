@@ -0,0 +1,102 @@
+package kontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// HandleKitesHTTP serves the getKites query over plain HTTP, so tools
+// without a kite client can query the registry. It responds with
+// a JSON-encoded protocol.GetKitesResult.
+//
+// Requests must be authenticated with a kite key, or a token issued by
+// Kontrol, passed in the "Authorization: Bearer <key>" header. The kites
+// are filtered with the query parameters named after KontrolQuery fields;
+// if there is no username nor id parameter, kites of the caller are
+// returned. Kites not visible to the caller, see Kontrol.VisibilityRules,
+// are left out. Unlike getKites, no tokens for the kites are generated.
+//
+//	curl -H "Authorization: Bearer $KITE_KEY" \
+//	    "https://kontrol.example.com/api/kites?name=math&version=>=1.0"
+func (k *Kontrol) HandleKitesHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		rw.Header().Set("Allow", "GET")
+		http.Error(rw, jsonError(errors.New("method not allowed")), http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, err := k.authenticateHTTP(req)
+	if err != nil {
+		http.Error(rw, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	kites, err := k.listKites(queryFromValues(req.URL.Query()), username)
+	if err != nil {
+		http.Error(rw, jsonError(err), http.StatusBadRequest)
+		return
+	}
+
+	loc := keyLocation(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+
+	k.removeUnready(&kites)
+	k.removeInvisible(&kites, &loc)
+
+	if kites == nil {
+		kites = make(Kites, 0)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(rw).Encode(&protocol.GetKitesResult{Kites: kites}); err != nil {
+		k.log.Error("kites: %s", err)
+	}
+}
+
+// authenticateHTTP gives the username of the caller authenticated with
+// the kite key or token passed in the Authorization header.
+func (k *Kontrol) authenticateHTTP(req *http.Request) (string, error) {
+	key := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if key == "" {
+		return "", errors.New("no authorization key given")
+	}
+
+	username, err := k.Kite.AuthenticateSimpleKiteKey(key)
+	if err == nil {
+		return username, nil
+	}
+
+	r := &kite.Request{
+		LocalKite: k.Kite,
+		Auth: &kite.Auth{
+			Type: "token",
+			Key:  key,
+		},
+	}
+
+	if e := k.Kite.AuthenticateFromToken(r); e != nil {
+		return "", err
+	}
+
+	return r.Username, nil
+}
+
+// queryFromValues builds a query from the URL parameters named after
+// KontrolQuery fields.
+func queryFromValues(v url.Values) *protocol.KontrolQuery {
+	return &protocol.KontrolQuery{
+		Username:    v.Get("username"),
+		Environment: v.Get("environment"),
+		Name:        v.Get("name"),
+		Version:     v.Get("version"),
+		Region:      v.Get("region"),
+		Hostname:    v.Get("hostname"),
+		ID:          v.Get("id"),
+	}
+}
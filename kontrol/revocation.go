@@ -0,0 +1,134 @@
+package kontrol
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// revocations is a list of revoked tokens distributed by kontrol
+// to the registered kites.
+type revocations struct {
+	mu     sync.Mutex
+	tokens map[string]int64        // token ID -> expiration time
+	kites  map[string]*kite.Client // kite ID -> connected registered kite
+}
+
+func newRevocations() *revocations {
+	return &revocations{
+		tokens: make(map[string]int64),
+		kites:  make(map[string]*kite.Client),
+	}
+}
+
+// list gives all revoked tokens that are not expired yet.
+func (r *revocations) list() []*protocol.RevokedToken {
+	now := time.Now().UTC().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens := make([]*protocol.RevokedToken, 0, len(r.tokens))
+	for id, exp := range r.tokens {
+		if exp < now {
+			delete(r.tokens, id)
+			continue
+		}
+
+		tokens = append(tokens, &protocol.RevokedToken{
+			ID:        id,
+			ExpiresAt: exp,
+		})
+	}
+
+	return tokens
+}
+
+func (r *revocations) addKite(id string, c *kite.Client) {
+	r.mu.Lock()
+	r.kites[id] = c
+	r.mu.Unlock()
+}
+
+func (r *revocations) removeKite(id string, c *kite.Client) {
+	r.mu.Lock()
+	if r.kites[id] == c {
+		delete(r.kites, id)
+	}
+	r.mu.Unlock()
+}
+
+// connected gives a copy of the connected kites.
+func (r *revocations) connected() map[string]*kite.Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := make(map[string]*kite.Client, len(r.kites))
+	for id, c := range r.kites {
+		clients[id] = c
+	}
+
+	return clients
+}
+
+// RevokeToken adds the token to the revocation list and pushes it to
+// all kites connected to kontrol. Kites registering later fetch the
+// list with the "getRevokedTokens" method.
+//
+// If tok.ExpiresAt is zero, the token is kept on the list for the
+// maximum lifetime of tokens issued by kontrol.
+//
+// The token is evicted from the token cache, so kites asking for a token
+// again are given a new one. The list is kept in memory only.
+func (k *Kontrol) RevokeToken(tok *protocol.RevokedToken) error {
+	if tok.ID == "" {
+		return errors.New("empty token ID")
+	}
+
+	if tok.ExpiresAt == 0 {
+		tok.ExpiresAt = time.Now().Add(k.tokenTTL()).Add(k.tokenLeeway()).UTC().Unix()
+	}
+
+	k.revocations.mu.Lock()
+	k.revocations.tokens[tok.ID] = tok.ExpiresAt
+	k.revocations.mu.Unlock()
+
+	k.evictToken(tok.ID)
+
+	k.log.Info("Token revoked: %s", tok.ID)
+
+	k.push("kite.revokeTokens", []*protocol.RevokedToken{tok})
+
+	return nil
+}
+
+// push calls the method on all kites connected to kontrol.
+func (k *Kontrol) push(method string, args ...interface{}) {
+	for id, c := range k.revocations.connected() {
+		go func(id string, c *kite.Client) {
+			_, err := c.TellWithTimeout(method, k.Kite.CallTimeout(), args...)
+			if err != nil {
+				k.log.Warning("unable to push %s to %s: %s", method, id, err)
+			}
+		}(id, c)
+	}
+}
+
+// HandleRevokeToken revokes the token given as the argument.
+func (k *Kontrol) HandleRevokeToken(r *kite.Request) (interface{}, error) {
+	var tok protocol.RevokedToken
+
+	if err := r.Args.One().Unmarshal(&tok); err != nil {
+		return nil, err
+	}
+
+	return nil, k.RevokeToken(&tok)
+}
+
+// HandleGetRevokedTokens returns the current revocation list.
+func (k *Kontrol) HandleGetRevokedTokens(r *kite.Request) (interface{}, error) {
+	return k.revocations.list(), nil
+}
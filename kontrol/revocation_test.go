@@ -0,0 +1,56 @@
+package kontrol
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestRevokeTokenEvictsCache(t *testing.T) {
+	k := &Kontrol{
+		tokenCache:  make(map[string]cachedToken),
+		revocations: newRevocations(),
+		log:         kite.New("kontrol", "0.0.1").Log,
+	}
+
+	// getToken issues the token the same way as HandleGetToken.
+	getToken := func() string {
+		signed, err := k.generateToken(&token{
+			audience: "/testuser/mathworker",
+			username: "testuser",
+			issuer:   "testuser",
+			keyPair:  &KeyPair{ID: "test", Public: testkeys.Public, Private: testkeys.Private},
+		})
+		if err != nil {
+			t.Fatalf("generateToken()=%s", err)
+		}
+
+		claims := &kitekey.KiteClaims{}
+		_, err = jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) {
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(testkeys.Public))
+		})
+		if err != nil {
+			t.Fatalf("ParseWithClaims()=%s", err)
+		}
+
+		return claims.Id
+	}
+
+	id := getToken()
+
+	if again := getToken(); again != id {
+		t.Fatalf("got jti %q, want the cached %q", again, id)
+	}
+
+	if err := k.RevokeToken(&protocol.RevokedToken{ID: id}); err != nil {
+		t.Fatalf("RevokeToken()=%s", err)
+	}
+
+	if renewed := getToken(); renewed == id {
+		t.Fatalf("got the revoked token %q again", id)
+	}
+}
@@ -0,0 +1,111 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// MaxSemaphoreLimit is the maximum number of holders of a semaphore.
+// Each slot of a semaphore is kept as a separate lease in the lease
+// storage.
+var MaxSemaphoreLimit = 64
+
+// semaphoreLease gives the name of the lease for the slot of the
+// semaphore, which is scoped to the username and environment of
+// the calling kite.
+func semaphoreLease(r *kite.Request, name string, slot int) string {
+	return strings.Join([]string{
+		"semaphore",
+		r.Client.Kite.Username,
+		r.Client.Kite.Environment,
+		name,
+		strconv.Itoa(slot),
+	}, "/")
+}
+
+func semaphoreArgs(r *kite.Request) (*protocol.SemaphoreArgs, error) {
+	var args protocol.SemaphoreArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case args.Name == "":
+		return nil, errors.New("empty semaphore name")
+	case args.Token == "":
+		return nil, errors.New("empty semaphore token")
+	case args.Limit <= 0 || args.Limit > MaxSemaphoreLimit:
+		return nil, fmt.Errorf("semaphore limit must be between 1 and %d", MaxSemaphoreLimit)
+	case args.Slot >= args.Limit:
+		return nil, fmt.Errorf("semaphore slot %d exceeds the limit", args.Slot)
+	}
+
+	return &args, nil
+}
+
+// HandleAcquireSemaphore acquires a free slot of the semaphore for the
+// calling kite, or renews the slot given in the arguments. Semaphores are
+// shared by all kites of the same username and environment.
+func (k *Kontrol) HandleAcquireSemaphore(r *kite.Request) (interface{}, error) {
+	args, err := semaphoreArgs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.TTL <= 0 {
+		return nil, errors.New("semaphore TTL must be positive")
+	}
+
+	slots := []int{args.Slot}
+
+	if args.Slot < 0 {
+		slots = make([]int, args.Limit)
+		for i := range slots {
+			slots[i] = i
+		}
+	}
+
+	holder := r.Client.Kite.ID + "/" + args.Token
+	expiresAt := time.Now().Add(args.TTL).UTC()
+
+	for _, slot := range slots {
+		lease, err := k.leaseStorage().AcquireLease(&protocol.Lease{
+			Name:      semaphoreLease(r, args.Name, slot),
+			Holder:    holder,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if lease.Holder == holder {
+			return &protocol.SemaphoreResult{Acquired: true, Slot: slot}, nil
+		}
+	}
+
+	return &protocol.SemaphoreResult{Slot: -1}, nil
+}
+
+// HandleReleaseSemaphore releases the slot of the semaphore if it is
+// held by the calling kite.
+func (k *Kontrol) HandleReleaseSemaphore(r *kite.Request) (interface{}, error) {
+	args, err := semaphoreArgs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Slot < 0 {
+		return nil, errors.New("semaphore slot is not given")
+	}
+
+	holder := r.Client.Kite.ID + "/" + args.Token
+
+	return nil, k.leaseStorage().ReleaseLease(semaphoreLease(r, args.Name, args.Slot), holder)
+}
@@ -0,0 +1,73 @@
+package kontrol
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+func TestSemaphore(t *testing.T) {
+	k := &Kontrol{leases: NewMemLeaseStorage()}
+	k.leasesOnce.Do(func() {})
+
+	call := func(method kite.HandlerFunc, id, args string) (*protocol.SemaphoreResult, error) {
+		r := &kite.Request{
+			Args: &dnode.Partial{Raw: []byte("[" + args + "]")},
+			Client: &kite.Client{
+				Kite: protocol.Kite{Username: "testuser", Environment: "production", ID: id},
+			},
+		}
+
+		res, err := method(r)
+		if err != nil || res == nil {
+			return nil, err
+		}
+
+		return res.(*protocol.SemaphoreResult), nil
+	}
+
+	const args = `{"name":"db","limit":2,"token":"t","slot":%d,"ttl":60000000000}`
+
+	cases := []struct {
+		id   string
+		slot int
+		want int
+	}{
+		{"kite-1", -1, 0},  // acquire first slot
+		{"kite-2", -1, 1},  // acquire second slot
+		{"kite-3", -1, -1}, // all slots taken
+		{"kite-1", 0, 0},   // renew
+		{"kite-3", 1, -1},  // slot held by other kite
+	}
+
+	for i, c := range cases {
+		res, err := call(k.HandleAcquireSemaphore, c.id, fmt.Sprintf(args, c.slot))
+		if err != nil {
+			t.Fatalf("%d: HandleAcquireSemaphore()=%s", i, err)
+		}
+
+		if res.Acquired != (c.want >= 0) || res.Slot != c.want {
+			t.Fatalf("%d: got %+v, want slot %d", i, res, c.want)
+		}
+	}
+
+	if _, err := call(k.HandleReleaseSemaphore, "kite-2", fmt.Sprintf(args, 1)); err != nil {
+		t.Fatalf("HandleReleaseSemaphore()=%s", err)
+	}
+
+	res, err := call(k.HandleAcquireSemaphore, "kite-3", fmt.Sprintf(args, -1))
+	if err != nil {
+		t.Fatalf("HandleAcquireSemaphore()=%s", err)
+	}
+
+	if !res.Acquired || res.Slot != 1 {
+		t.Fatalf("got %+v, want released slot to be acquired", res)
+	}
+
+	if _, err := call(k.HandleAcquireSemaphore, "kite-1", fmt.Sprintf(args, 2)); err == nil {
+		t.Fatal("want slot exceeding the limit to be rejected")
+	}
+}
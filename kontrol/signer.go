@@ -0,0 +1,100 @@
+package kontrol
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// AddSigner adds the key pair, whose private key is held in an HSM,
+// a PKCS#11 module or a cloud KMS and is used through the given signer,
+// so kontrol does not need the private key on disk. The key must be an
+// RSA key.
+//
+// The ref identifies the private key, e.g. a PKCS#11 URI or an ARN
+// of a KMS key. It is stored in place of the private key, so other
+// kontrol instances sharing the key pair storage must add the signer
+// with the same ref.
+func (k *Kontrol) AddSigner(id, public, ref string, signer crypto.Signer) error {
+	if ref == "" {
+		return errors.New("signer reference is empty")
+	}
+
+	pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(strings.TrimSpace(public)))
+	if err != nil {
+		return err
+	}
+
+	signerPub, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signer does not hold an RSA key")
+	}
+
+	if pub.N.Cmp(signerPub.N) != 0 || pub.E != signerPub.E {
+		return errors.New("public key does not match the signer")
+	}
+
+	k.signersMu.Lock()
+	if k.signers == nil {
+		k.signers = make(map[string]crypto.Signer)
+	}
+	k.signers[ref] = signer
+	k.signersMu.Unlock()
+
+	return k.AddKeyPair(id, public, ref)
+}
+
+func (k *Kontrol) signer(ref string) crypto.Signer {
+	k.signersMu.RLock()
+	defer k.signersMu.RUnlock()
+
+	return k.signers[ref]
+}
+
+// signToken signs the token with the given private key of a key pair,
+// or with the signer added for it with AddSigner.
+func (k *Kontrol) signToken(t *jwt.Token, private string) (string, error) {
+	if signer := k.signer(private); signer != nil {
+		t.Method = signingMethodSigner{signer}
+		return t.SignedString(nil)
+	}
+
+	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(private))
+	if err != nil {
+		return "", err
+	}
+
+	return t.SignedString(rsaPrivate)
+}
+
+// signingMethodSigner signs tokens with RS256 using a crypto.Signer.
+// Tokens are verified with jwt.SigningMethodRS256 as usual.
+type signingMethodSigner struct {
+	signer crypto.Signer
+}
+
+var _ jwt.SigningMethod = signingMethodSigner{}
+
+func (m signingMethodSigner) Alg() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func (m signingMethodSigner) Verify(signingString, signature string, key interface{}) error {
+	return jwt.SigningMethodRS256.Verify(signingString, signature, key)
+}
+
+func (m signingMethodSigner) Sign(signingString string, _ interface{}) (string, error) {
+	sum := sha256.Sum256([]byte(signingString))
+
+	sig, err := m.signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.EncodeSegment(sig), nil
+}
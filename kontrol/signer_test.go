@@ -0,0 +1,71 @@
+package kontrol
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestAddSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	k := &Kontrol{keyPair: NewMemKeyPairStorage()}
+
+	if err := k.AddSigner("hsm", public, "pkcs11:object=kontrol", other); err == nil {
+		t.Fatal("expected a signer of another key to be rejected")
+	}
+
+	if err := k.AddSigner("hsm", public, "pkcs11:object=kontrol", key); err != nil {
+		t.Fatalf("AddSigner()=%s", err)
+	}
+
+	kp, err := k.keyPair.GetKeyFromID("hsm")
+	if err != nil {
+		t.Fatalf("GetKeyFromID()=%s", err)
+	}
+
+	if kp.Private != "pkcs11:object=kontrol" {
+		t.Fatalf("got private %q, want the ref", kp.Private)
+	}
+
+	claims := &jwt.StandardClaims{Subject: "alice"}
+
+	signed, err := k.signToken(jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims), kp.Private)
+	if err != nil {
+		t.Fatalf("signToken()=%s", err)
+	}
+
+	tok, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, func(tok *jwt.Token) (interface{}, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodRSA); !ok {
+			t.Fatalf("got signing method %T", tok.Method)
+		}
+
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("ParseWithClaims()=%s", err)
+	}
+
+	if got := tok.Claims.(*jwt.StandardClaims).Subject; got != "alice" {
+		t.Fatalf("got subject %q, want %q", got, "alice")
+	}
+}
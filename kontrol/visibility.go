@@ -0,0 +1,134 @@
+package kontrol
+
+import (
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+)
+
+// VisibilityRule restricts which callers are returned the registered
+// kites, based on the environment and region of both. For example the
+// following rule makes kites registered in "staging" visible to callers
+// in "staging" only:
+//
+//	&VisibilityRule{
+//	    Environment:  "staging",
+//	    Environments: []string{"staging"},
+//	}
+//
+// The environment and region of a caller are taken from the claims of its
+// kite key or token, see kitekey.KiteClaims. If the claims have none,
+// the ones the caller kite declares are used.
+type VisibilityRule struct {
+	// Environment and Region select registered kites the rule applies
+	// to. Empty values match any.
+	Environment string
+	Region      string
+
+	// Environments and Regions list locations of callers, which are
+	// allowed to see the kites. An empty list allows any.
+	Environments []string
+	Regions      []string
+}
+
+// callerLocation describes where a caller of kontrol runs.
+type callerLocation struct {
+	Environment string
+	Region      string
+}
+
+func (rule *VisibilityRule) matches(kite *protocol.Kite) bool {
+	if rule.Environment != "" && rule.Environment != kite.Environment {
+		return false
+	}
+
+	if rule.Region != "" && rule.Region != kite.Region {
+		return false
+	}
+
+	return true
+}
+
+func (rule *VisibilityRule) allows(caller *callerLocation) bool {
+	return contains(rule.Environments, caller.Environment) && contains(rule.Regions, caller.Region)
+}
+
+// contains tells whether the list is empty or has the value.
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// visible tells whether the kite is visible to the caller: when all of the
+// rules matching the kite allow the caller.
+func (k *Kontrol) visible(kite *protocol.Kite, caller *callerLocation) bool {
+	for _, rule := range k.VisibilityRules {
+		if rule.matches(kite) && !rule.allows(caller) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeInvisible removes the kites, which are not visible to the caller.
+func (k *Kontrol) removeInvisible(kites *Kites, caller *callerLocation) {
+	if len(k.VisibilityRules) == 0 {
+		return
+	}
+
+	visible := make(Kites, 0, len(*kites))
+	for _, kt := range *kites {
+		if k.visible(&kt.Kite, caller) {
+			visible = append(visible, kt)
+		}
+	}
+
+	*kites = visible
+}
+
+// requestLocation gives the location of the caller of the request.
+func requestLocation(r *kite.Request) *callerLocation {
+	var loc callerLocation
+
+	if r.Auth != nil {
+		loc = keyLocation(r.Auth.Key)
+	}
+
+	if loc.Environment == "" {
+		loc.Environment = r.Client.Kite.Environment
+	}
+
+	if loc.Region == "" {
+		loc.Region = r.Client.Kite.Region
+	}
+
+	return &loc
+}
+
+// keyLocation gives the location bound to the kite key or token, which
+// is already verified by the authenticator.
+func keyLocation(key string) callerLocation {
+	ex := &kitekey.Extractor{
+		Claims: &kitekey.KiteClaims{},
+	}
+
+	// The claims are decoded before the signature is checked, a token
+	// signed with a key other than the one it carries is fine here.
+	jwt.ParseWithClaims(key, ex.Claims, ex.Extract)
+
+	return callerLocation{
+		Environment: ex.Claims.Environment,
+		Region:      ex.Claims.Region,
+	}
+}
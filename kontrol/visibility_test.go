@@ -0,0 +1,89 @@
+package kontrol
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestVisibilityRules(t *testing.T) {
+	k := &Kontrol{
+		VisibilityRules: []*VisibilityRule{{
+			Environment:  "staging",
+			Environments: []string{"staging"},
+		}, {
+			Region:  "eu",
+			Regions: []string{"eu"},
+		}},
+	}
+
+	newKites := func() Kites {
+		return Kites{
+			{Kite: protocol.Kite{ID: "staging-us", Environment: "staging", Region: "us"}},
+			{Kite: protocol.Kite{ID: "staging-eu", Environment: "staging", Region: "eu"}},
+			{Kite: protocol.Kite{ID: "production-us", Environment: "production", Region: "us"}},
+			{Kite: protocol.Kite{ID: "production-eu", Environment: "production", Region: "eu"}},
+		}
+	}
+
+	cases := map[callerLocation][]string{
+		{"staging", "us"}:    {"staging-us", "production-us"},
+		{"staging", "eu"}:    {"staging-us", "staging-eu", "production-us", "production-eu"},
+		{"production", "us"}: {"production-us"},
+		{"production", "eu"}: {"production-us", "production-eu"},
+	}
+
+	for caller, want := range cases {
+		caller := caller
+		kites := newKites()
+
+		k.removeInvisible(&kites, &caller)
+
+		var got []string
+		for _, kt := range kites {
+			got = append(got, kt.Kite.ID)
+		}
+
+		if len(got) != len(want) {
+			t.Errorf("%+v: got %v, want %v", caller, got, want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%+v: got %v, want %v", caller, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestKeyLocation(t *testing.T) {
+	claims := &kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: "alice",
+		},
+		KontrolKey:  testkeys.Public,
+		Environment: "production",
+		Region:      "eu",
+	}
+
+	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	key, err := jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	if err != nil {
+		t.Fatalf("SignedString()=%s", err)
+	}
+
+	want := callerLocation{Environment: "production", Region: "eu"}
+
+	if got := keyLocation(key); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package kontrol
+
+import (
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// watcher is a kite notified about registry events with a callback.
+type watcher struct {
+	fn  dnode.Function
+	loc *callerLocation
+}
+
+// watchers forwards registry events to watching kites.
+type watchers struct {
+	once sync.Once
+	mu   sync.Mutex
+	m    map[*kite.Client]*watcher
+}
+
+// HandleWatchKites calls the callback given by the caller with each
+// RegistryEvent of kites visible to it, until it disconnects. Kites use
+// it to invalidate cached getKites results.
+//
+// Only events of kites registered with this instance are sent, when
+// running in cluster mode.
+func (k *Kontrol) HandleWatchKites(r *kite.Request) (interface{}, error) {
+	fn, err := r.Args.One().Function()
+	if err != nil {
+		return nil, err
+	}
+
+	k.watchers.once.Do(func() {
+		k.watchers.m = make(map[*kite.Client]*watcher)
+		k.AddEventPublisher(EventPublisherFunc(k.notifyWatchers))
+	})
+
+	c := r.Client
+
+	k.watchers.mu.Lock()
+	_, ok := k.watchers.m[c]
+	k.watchers.m[c] = &watcher{
+		fn:  fn,
+		loc: requestLocation(r),
+	}
+	k.watchers.mu.Unlock()
+
+	if !ok {
+		c.OnDisconnect(func() {
+			k.watchers.mu.Lock()
+			delete(k.watchers.m, c)
+			k.watchers.mu.Unlock()
+		})
+	}
+
+	return nil, nil
+}
+
+func (k *Kontrol) notifyWatchers(ev *RegistryEvent) error {
+	k.watchers.mu.Lock()
+	var fns []dnode.Function
+	for _, w := range k.watchers.m {
+		if k.visible(&ev.Kite, w.loc) {
+			fns = append(fns, w.fn)
+		}
+	}
+	k.watchers.mu.Unlock()
+
+	for _, fn := range fns {
+		if err := fn.Call(ev); err != nil {
+			k.log.Debug("notifying watcher about %s event of %s: %s", ev.Type, &ev.Kite, err)
+		}
+	}
+
+	return nil
+}
@@ -40,6 +40,12 @@ type kontrolClient struct {
 
 	// registerChan registers the url's it receives from the channel to Kontrol
 	registerChan chan *url.URL
+
+	// members of the Kontrol cluster to fail over to
+	members kontrolMembers
+
+	// cache of getKites results, see Kite.DiscoveryCacheTTL
+	cache discoveryCache
 }
 
 type registerResult struct {
@@ -59,8 +65,12 @@ func (k *Kite) SetupKontrolClient() error {
 		return errors.New("no kontrol URL given in config")
 	}
 
+	k.kontrol.members.add(k.Config.KontrolURL)
+	k.kontrol.members.add(k.Config.KontrolMembers...)
+
 	client := k.NewClient(k.Config.KontrolURL)
 	client.Kite = protocol.Kite{Name: "kontrol"} // for logging purposes
+	client.nextURL = k.kontrol.members.next
 	client.Auth = &Auth{
 		Type: "kiteKey",
 		Key:  k.KiteKey(),
@@ -87,6 +97,16 @@ func (k *Kite) SetupKontrolClient() error {
 		// signal all other methods that are listening on this channel, that we
 		// are connected to kontrol.
 		k.kontrol.onceConnected.Do(func() { close(k.kontrol.readyConnected) })
+
+		// measure clock skew, so tokens issued by kontrol are
+		// validated and renewed at its time
+		go func() {
+			if _, err := client.SyncTime(); err != nil {
+				k.Log.Debug("Unable to measure clock skew to Kontrol: %s", err)
+			}
+		}()
+
+		go k.updateKontrolMembers(client)
 	})
 
 	k.kontrol.OnDisconnect(func() {
@@ -140,9 +160,19 @@ func (k *Kite) GetKites(query *protocol.KontrolQuery) ([]*Client, error) {
 
 // used internally for GetKites() and WatchKites()
 func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
+	kites, err := k.cachedKites(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.kiteClients(kites), nil
+}
+
+// queryKites calls getKites of Kontrol.
+func (k *Kite) queryKites(args protocol.GetKitesArgs) ([]*protocol.KiteWithToken, error) {
 	<-k.kontrol.readyConnected
 
-	response, err := k.kontrol.TellWithTimeout("getKites", k.Config.Timeout, args)
+	response, err := k.kontrol.TellWithTimeout("getKites", k.CallTimeout(), args)
 	if err != nil {
 		return nil, err
 	}
@@ -153,14 +183,21 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 		return nil, err
 	}
 
-	clients := make([]*Client, len(result.Kites))
-	for i, currentKite := range result.Kites {
+	return result.Kites, nil
+}
+
+// kiteClients gives clients of the kites, which renew their tokens.
+func (k *Kite) kiteClients(kites []*protocol.KiteWithToken) []*Client {
+	nets := localNetworks()
+
+	clients := make([]*Client, len(kites))
+	for i, currentKite := range kites {
 		auth := &Auth{
 			Type: "token",
 			Key:  currentKite.Token,
 		}
 
-		clients[i] = k.NewClient(currentKite.URL)
+		clients[i] = k.NewClient(k.selectURL(currentKite, nets))
 		clients[i].Kite = currentKite.Kite
 		clients[i].Auth = auth
 	}
@@ -177,7 +214,7 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 		c.closeRenewer = token.disconnect
 	}
 
-	return clients, nil
+	return clients
 }
 
 // GetToken is used to get a token for a single Kite.
@@ -191,7 +228,7 @@ func (k *Kite) GetToken(kite *protocol.Kite) (string, error) {
 
 	<-k.kontrol.readyConnected
 
-	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, kite)
+	result, err := k.kontrol.TellWithTimeout("getToken", k.CallTimeout(), kite)
 	if err != nil {
 		return "", err
 	}
@@ -221,7 +258,47 @@ func (k *Kite) GetTokenForce(kite *protocol.Kite) (string, error) {
 		Force:        true,
 	}
 
-	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, args)
+	result, err := k.kontrol.TellWithTimeout("getToken", k.CallTimeout(), args)
+	if err != nil {
+		return "", err
+	}
+
+	var tkn string
+	err = result.Unmarshal(&tkn)
+	if err != nil {
+		return "", err
+	}
+
+	return tkn, nil
+}
+
+// GetDelegationToken is used to get a short-lived token for calling
+// the given kite on behalf of the caller of the request r.
+//
+// The token identifies the original caller, is restricted to the given
+// scopes and carries the username of this kite as the delegate, so the
+// kite does not have to use its own credentials for forwarded calls.
+func (k *Kite) GetDelegationToken(r *Request, kite *protocol.Kite, scopes ...string) (string, error) {
+	if r.Auth == nil {
+		return "", errors.New("request is not authenticated")
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return "", err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.GetDelegationTokenArgs{
+		KontrolQuery: *kite.Query(),
+		Auth: &protocol.Auth{
+			Type: r.Auth.Type,
+			Key:  r.Auth.Key,
+		},
+		Scopes: scopes,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getDelegationToken", k.CallTimeout(), args)
 	if err != nil {
 		return "", err
 	}
@@ -246,7 +323,7 @@ func (k *Kite) GetKey() (string, error) {
 
 	<-k.kontrol.readyConnected
 
-	result, err := k.kontrol.TellWithTimeout("getKey", k.Config.Timeout)
+	result, err := k.kontrol.TellWithTimeout("getKey", k.CallTimeout())
 	if err != nil {
 		return "", err
 	}
@@ -349,12 +426,13 @@ func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
 	<-k.kontrol.readyConnected
 
 	args := protocol.RegisterArgs{
-		URL: kiteURL.String(),
+		URL:  kiteURL.String(),
+		URLs: k.URLs,
 	}
 
 	k.Log.Info("Registering to kontrol with URL: %s", kiteURL.String())
 
-	response, err := k.kontrol.TellWithTimeout("register", k.Config.Timeout, args)
+	response, err := k.kontrol.TellWithTimeout("register", k.CallTimeout(), args)
 	if err != nil {
 		return nil, err
 	}
@@ -375,6 +453,9 @@ func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
 
 	k.callOnRegisterHandlers(&rr)
 
+	go k.syncRevokedTokens()
+	go k.syncFlags()
+
 	return &registerResult{parsed}, nil
 }
 
@@ -473,7 +554,7 @@ func (k *Kite) registerToProxyKite(c *Client, kiteURL *url.URL) (*url.URL, error
 
 	// this could be tunnelproxy or reverseproxy. Tunnelproxy doesn't need an
 	// URL however Reverseproxy needs one.
-	result, err := c.TellWithTimeout("register", k.Config.Timeout, kiteURL.String())
+	result, err := c.TellWithTimeout("register", k.CallTimeout(), kiteURL.String())
 	if err != nil {
 		k.Log.Error("Proxy register error: %s", err.Error())
 		return nil, err
@@ -504,12 +585,12 @@ func (k *Kite) TellKontrolWithTimeout(method string, timeout time.Duration, args
 
 	// Wait for readyConnect, or timeout
 	select {
-	case <-time.After(k.Config.Timeout):
+	case <-time.After(k.CallTimeout()):
 		return nil, &Error{
 			Type: "timeout",
 			Message: fmt.Sprintf(
 				"Timed out registering to kontrol for %s method after %s",
-				method, k.Config.Timeout,
+				method, k.CallTimeout(),
 			),
 		}
 	case <-k.kontrol.readyConnected:
@@ -0,0 +1,80 @@
+package kite
+
+import (
+	"sync"
+)
+
+// kontrolMembers keeps URLs of the Kontrol cluster members, which the
+// kontrol client fails over to.
+type kontrolMembers struct {
+	mu   sync.Mutex
+	urls []string // known members, in the order they are tried
+}
+
+// add appends the members, which are not known yet.
+func (m *kontrolMembers) add(urls ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range urls {
+		if u == "" || m.index(u) != -1 {
+			continue
+		}
+
+		m.urls = append(m.urls, u)
+	}
+}
+
+func (m *kontrolMembers) index(u string) int {
+	for i, member := range m.urls {
+		if member == u {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// next gives the member tried after the one with the given URL.
+func (m *kontrolMembers) next(u string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.urls) == 0 {
+		return u
+	}
+
+	return m.urls[(m.index(u)+1)%len(m.urls)]
+}
+
+func (m *kontrolMembers) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.urls...)
+}
+
+// KontrolMembers gives URLs of the Kontrol cluster members the kite fails
+// over to, when the one it is connected to goes down. They are the ones
+// given in Config.KontrolMembers and the ones reported by Kontrol.
+func (k *Kite) KontrolMembers() []string {
+	return k.kontrol.members.list()
+}
+
+// updateKontrolMembers asks Kontrol for members of its cluster.
+func (k *Kite) updateKontrolMembers(c *Client) {
+	result, err := c.TellWithTimeout("kontrol.members", k.CallTimeout())
+	if err != nil {
+		// Kontrol may not run in cluster mode.
+		k.Log.Debug("Unable to get Kontrol members: %s", err)
+		return
+	}
+
+	var urls []string
+	if err := result.Unmarshal(&urls); err != nil {
+		k.Log.Debug("Unable to get Kontrol members: %s", err)
+		return
+	}
+
+	k.kontrol.members.add(urls...)
+}
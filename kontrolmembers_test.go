@@ -0,0 +1,71 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestKontrolMembers(t *testing.T) {
+	var m kontrolMembers
+
+	m.add("http://a/kite", "", "http://b/kite")
+	m.add("http://b/kite", "http://c/kite")
+
+	want := []string{"http://a/kite", "http://b/kite", "http://c/kite"}
+	if got := m.list(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	cases := map[string]string{
+		"http://a/kite":     "http://b/kite",
+		"http://c/kite":     "http://a/kite",
+		"http://other/kite": "http://a/kite",
+	}
+
+	for u, want := range cases {
+		if got := m.next(u); got != want {
+			t.Errorf("next(%q)=%q, want %q", u, got, want)
+		}
+	}
+}
+
+func TestKontrolMembers_Failover(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("member", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	down := httptest.NewServer(nil)
+	downURL := fmt.Sprintf("%s/kite", down.URL)
+	down.Close()
+
+	var m kontrolMembers
+	m.add(downURL, fmt.Sprintf("%s/kite", ts.URL))
+
+	c := New("client", "0.0.1").NewClient(downURL)
+	c.nextURL = m.next
+
+	connected, err := c.DialForever()
+	if err != nil {
+		t.Fatalf("DialForever()=%s", err)
+	}
+	defer c.Close()
+
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting to fail over")
+	}
+
+	if _, err := c.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping: %s", err)
+	}
+}
@@ -0,0 +1,227 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lane is a priority class of outgoing messages. Each client queues
+// messages per lane, so small latency-sensitive messages are not stuck
+// behind large ones sent over the same connection.
+//
+// Messages are not fragmented, each one is sent as a single frame, so
+// the size of messages is limited per lane: interactive messages must not
+// exceed Client.BulkThreshold and the others Client.MaxBulkSize. A control
+// message waits at most for a single frame of the bulk lane to be written.
+type Lane int
+
+const (
+	// LaneControl carries heartbeats, pings and cancellations. It is
+	// always served first.
+	LaneControl Lane = iota + 1
+
+	// LaneInteractive carries regular calls and responses.
+	LaneInteractive
+
+	// LaneBulk carries large calls and responses, see Client.BulkThreshold.
+	LaneBulk
+)
+
+var (
+	// DefaultBulkThreshold is the size in bytes, above which messages
+	// are sent on the bulk lane, if Client.BulkThreshold is zero.
+	DefaultBulkThreshold = 64 * 1024
+
+	// DefaultInteractiveWeight is the number of interactive messages sent
+	// for each bulk message when both lanes are busy, if
+	// Client.InteractiveWeight is zero.
+	DefaultInteractiveWeight = 8
+
+	// DefaultMaxBulkSize is the maximum size in bytes of messages sent
+	// on the bulk and control lanes, if Client.MaxBulkSize is zero.
+	DefaultMaxBulkSize = 4 * 1024 * 1024
+
+	// LaneQueueSize is the number of outgoing messages queued per lane of
+	// a client, while the connection is busy or the credit granted by the
+	// remote kite is exhausted, see Config.ReceiveWindow. Sending fails
+	// once the queue of the lane is full, so callers never block on a
+	// slow or unresponsive remote kite. It applies to clients created
+	// afterwards.
+	LaneQueueSize = 256
+)
+
+// controlMethods lists methods always sent on the control lane.
+var controlMethods = map[string]bool{
+	"kite.ping":            true,
+	"kite.heartbeat":       true,
+	"kite.operationCancel": true,
+	"kite.revokeTokens":    true,
+	"kite.setFlags":        true,
+	"kite.window":          true,
+	"kite.time":            true,
+}
+
+// String implements the fmt.Stringer interface.
+func (l Lane) String() string {
+	switch l {
+	case LaneControl:
+		return "control"
+	case LaneInteractive:
+		return "interactive"
+	case LaneBulk:
+		return "bulk"
+	default:
+		return fmt.Sprintf("Lane(%d)", int(l))
+	}
+}
+
+type laneKey struct{}
+
+// WithLane gives a context, which makes calls done with
+// Client.TellWithContext use the given lane instead of the one
+// selected by the method name and the message size.
+func WithLane(ctx context.Context, lane Lane) context.Context {
+	return context.WithValue(ctx, laneKey{}, lane)
+}
+
+func laneFromContext(ctx context.Context) Lane {
+	if ctx == nil {
+		return 0
+	}
+
+	lane, _ := ctx.Value(laneKey{}).(Lane)
+	return lane
+}
+
+// lane selects the lane of a message with the given method, which is
+// either a method name or a callback ID, and size.
+func (c *Client) lane(method interface{}, size int) Lane {
+	if name, ok := method.(string); ok && controlMethods[name] {
+		return LaneControl
+	}
+
+	threshold := c.BulkThreshold
+	if threshold == 0 {
+		threshold = DefaultBulkThreshold
+	}
+
+	if size > threshold {
+		return LaneBulk
+	}
+
+	return LaneInteractive
+}
+
+// maxMessageSize gives the maximum size of messages sent on the lane,
+// or zero if the size is not limited.
+func (c *Client) maxMessageSize(lane Lane) int {
+	if lane == LaneInteractive {
+		if c.BulkThreshold != 0 {
+			return c.BulkThreshold
+		}
+		return DefaultBulkThreshold
+	}
+
+	switch {
+	case c.MaxBulkSize < 0:
+		return 0
+	case c.MaxBulkSize == 0:
+		return DefaultMaxBulkSize
+	default:
+		return c.MaxBulkSize
+	}
+}
+
+// nextMessage blocks until there is a message to be sent. Control messages
+// are served first, while interactive and bulk messages are interleaved
+// according to InteractiveWeight. The sent counter tracks the number of
+// interactive messages sent since the last bulk one.
+//
+// When the remote kite uses flow control and the credit is exhausted,
+// only control messages are sent until more credit is granted.
+//
+// It returns nil when the client is closed.
+func (c *Client) nextMessage(sent *int) *message {
+	weight := c.InteractiveWeight
+	if weight == 0 {
+		weight = DefaultInteractiveWeight
+	}
+
+	control := c.lanes[LaneControl]
+	interactive := c.lanes[LaneInteractive]
+	bulk := c.lanes[LaneBulk]
+
+	for !c.hasCredit() {
+		select {
+		case msg := <-control:
+			return c.dequeued(msg, sent)
+		case <-c.flow.notify:
+		case <-c.closeChan:
+			return nil
+		}
+	}
+
+	first, second := interactive, bulk
+	if *sent >= weight {
+		first, second = bulk, interactive
+	}
+
+	var msg *message
+
+	select {
+	case msg = <-control:
+	default:
+		select {
+		case msg = <-first:
+		default:
+			select {
+			case msg = <-second:
+			default:
+				select {
+				case msg = <-control:
+				case msg = <-interactive:
+				case msg = <-bulk:
+				case <-c.closeChan:
+					return nil
+				}
+			}
+		}
+	}
+
+	return c.dequeued(msg, sent)
+}
+
+// dequeued updates the scheduling and flow control state
+// for the message, which is about to be sent.
+func (c *Client) dequeued(msg *message, sent *int) *message {
+	switch msg.lane {
+	case LaneInteractive:
+		*sent++
+	case LaneBulk:
+		*sent = 0
+	}
+
+	if !msg.exempt {
+		c.spendCredit(len(msg.p))
+	}
+
+	return msg
+}
+
+// dropQueued fails the messages queued on all lanes with the given error,
+// so they are not sent over the next session, once the client reconnects.
+func (c *Client) dropQueued(err error) {
+	for _, lane := range c.lanes {
+	drain:
+		for {
+			select {
+			case msg := <-lane:
+				if msg.errC != nil {
+					msg.errC <- err
+				}
+			default:
+				break drain
+			}
+		}
+	}
+}
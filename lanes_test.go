@@ -0,0 +1,122 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestLanes(t *testing.T) {
+	c := New("lanes", "0.0.1").NewClient("")
+	c.InteractiveWeight = 2
+
+	cases := map[string]struct {
+		method interface{}
+		size   int
+		want   Lane
+	}{
+		"ping":             {"kite.ping", 10, LaneControl},
+		"large heartbeat":  {"kite.heartbeat", 1 << 20, LaneControl},
+		"call":             {"square", 10, LaneInteractive},
+		"large call":       {"square", 1 << 20, LaneBulk},
+		"callback":         {float64(1), 10, LaneInteractive},
+		"large callback":   {float64(1), 1 << 20, LaneBulk},
+		"at the threshold": {"square", DefaultBulkThreshold, LaneInteractive},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := c.lane(cas.method, cas.size); got != cas.want {
+				t.Fatalf("got %s, want %s", got, cas.want)
+			}
+		})
+	}
+
+	enqueue := func(lane Lane, n int) {
+		for i := 0; i < n; i++ {
+			go func() { c.lanes[lane] <- &message{lane: lane} }()
+		}
+	}
+
+	enqueue(LaneBulk, 3)
+	enqueue(LaneInteractive, 6)
+	enqueue(LaneControl, 1)
+
+	time.Sleep(100 * time.Millisecond) // wait for all messages to be queued
+
+	var sent int
+	var order []string
+
+	for i := 0; i < 10; i++ {
+		order = append(order, c.nextMessage(&sent).lane.String()[:1])
+	}
+
+	if got, want := strings.Join(order, ""), "ciibiibiib"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLanes_MessageSize(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("lanes-server", "0.0.1", cfg)
+	srv.HandleFunc("len", func(r *Request) (interface{}, error) {
+		return len(r.Args.One().MustString()), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("lanes-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	c.MaxBulkSize = 512 * 1024
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	cases := map[string]struct {
+		lane Lane
+		size int
+		ok   bool
+	}{
+		"interactive":       {0, 1024, true},
+		"bulk":              {0, 256 * 1024, true},
+		"above bulk limit":  {0, 1024 * 1024, false},
+		"large interactive": {LaneInteractive, 256 * 1024, false},
+		"large control":     {LaneControl, 1024 * 1024, false},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			if cas.lane != 0 {
+				ctx = WithLane(ctx, cas.lane)
+			}
+
+			result, err := c.TellWithContext(ctx, "len", strings.Repeat("x", cas.size))
+
+			if !cas.ok {
+				if e, ok := err.(*Error); !ok || e.Type != "sendError" {
+					t.Fatalf("got %v, want sendError", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("TellWithContext()=%s", err)
+			}
+
+			if n := int(result.MustFloat64()); n != cas.size {
+				t.Fatalf("got %d, want %d", n, cas.size)
+			}
+		})
+	}
+}
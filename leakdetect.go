@@ -0,0 +1,48 @@
+package kite
+
+import "time"
+
+// DefaultCallbackLeakThreshold is the age, above which callbacks never
+// called nor removed are reported as leaked, if Kite.CallbackLeakThreshold
+// is zero.
+//
+// It is zero, which disables leak detection, unless kite is built with
+// the kitedebug build tag.
+var DefaultCallbackLeakThreshold time.Duration
+
+func (k *Kite) callbackLeakThreshold() time.Duration {
+	if k.CallbackLeakThreshold != 0 {
+		return k.CallbackLeakThreshold
+	}
+
+	return DefaultCallbackLeakThreshold
+}
+
+// detectLeaks periodically reports callbacks older than the threshold,
+// which were never called nor removed, with the stack traces of their
+// registration. Each callback is reported once.
+func (c *Client) detectLeaks(threshold time.Duration) {
+	ticker := time.NewTicker(threshold / 2)
+	defer ticker.Stop()
+
+	reported := make(map[uint64]bool)
+
+	for {
+		select {
+		case <-c.closeChan:
+			return
+		case <-ticker.C:
+		}
+
+		for _, t := range c.scrubber.Stale(time.Now().Add(-threshold)) {
+			if reported[t.ID] {
+				continue
+			}
+
+			reported[t.ID] = true
+
+			c.logger().Warning("callback %d sent to %s %s ago was never called nor removed, registered at:\n%s",
+				t.ID, c.URL, time.Since(t.Registered), t.Stack())
+		}
+	}
+}
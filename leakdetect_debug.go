@@ -0,0 +1,9 @@
+// +build kitedebug
+
+package kite
+
+import "time"
+
+func init() {
+	DefaultCallbackLeakThreshold = 5 * time.Minute
+}
@@ -0,0 +1,65 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+type warningLogger struct {
+	Logger
+	warnings chan string
+}
+
+func (l *warningLogger) Warning(format string, args ...interface{}) {
+	l.warnings <- fmt.Sprintf(format, args...)
+}
+
+func TestCallbackLeakDetection(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("leak-server", "0.0.1", cfg)
+	srv.HandleFunc("subscribe", func(r *Request) (interface{}, error) {
+		return nil, nil // never calls the callback back
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("leak-client", "0.0.1")
+	k.CallbackLeakThreshold = 100 * time.Millisecond
+
+	log := &warningLogger{Logger: k.Log, warnings: make(chan string, 10)}
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL), WithLogger(log))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("subscribe", dnode.Callback(func(*dnode.Partial) {})); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	select {
+	case msg := <-log.warnings:
+		if !strings.Contains(msg, "never called nor removed") || !strings.Contains(msg, "TestCallbackLeakDetection") {
+			t.Fatalf("got %q, want leak report with the registration stack", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the leak report")
+	}
+
+	// The response callback was called, so only one leak is reported.
+	select {
+	case msg := <-log.warnings:
+		t.Fatalf("got unexpected report: %q", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,116 @@
+package kite
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Listen serves the kite on an additional listener, next to the one of
+// Run, e.g. so local clients connect over a unix socket while remote ones
+// use TLS websockets:
+//
+//	k.UseTLSFile(certFile, keyFile)
+//
+//	if _, err := k.Listen("unix", "/run/mykite.sock", nil); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	k.Run()
+//
+// The network is one of "tcp", "tcp4", "tcp6" or "unix". Connections are
+// served with the same handlers, authentication and connection filters as
+// the ones accepted by Run. If tlsConfig is non-nil, connections use TLS.
+//
+// A unix socket left by a process, which is not running anymore, is
+// removed. The listener is closed by Close. It returns the address the
+// kite listens on.
+//
+// Clients connect to unix sockets with WithUnixSocket.
+func (k *Kite) Listen(network, address string, tlsConfig *tls.Config) (net.Addr, error) {
+	l, err := k.listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := l
+
+	if tlsConfig != nil {
+		if tlsConfig.NextProtos == nil {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	gl := newGracefulListener(l)
+	gl.network, gl.address, gl.raw = network, address, raw
+
+	k.mu.Lock()
+	k.listeners = append(k.listeners, gl)
+	k.mu.Unlock()
+
+	k.Log.Info("New listening: %s %s", network, l.Addr())
+
+	go func() {
+		if err := k.serve(gl, k); err != nil && !isClosing(err) {
+			k.Log.Error("serving on %s %s: %s", network, l.Addr(), err)
+		}
+	}()
+
+	return l.Addr(), nil
+}
+
+// listen gives the listener handed over by the previous process of the
+// kite, see TakeOver, or a new one.
+func (k *Kite) listen(network, address string) (net.Listener, error) {
+	if l := k.inheritedListener(network, address); l != nil {
+		return l, nil
+	}
+
+	if network == "unix" {
+		removeStaleSocket(address)
+	}
+
+	return net.Listen(network, address)
+}
+
+// removeStaleSocket removes the unix socket at the path, if no process
+// listens on it.
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+
+	os.Remove(path)
+}
+
+// WithUnixSocket makes the client connect to the kite listening on the
+// unix socket at the given path, see Kite.Listen. The host of the
+// client's URL is ignored, only its path is used, e.g.
+// "http://localhost/kite".
+func WithUnixSocket(path string) ClientOption {
+	return func(c *Client) {
+		cfg := c.config().Copy()
+
+		dial := func(string, string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		}
+
+		if cfg.Websocket != nil {
+			cfg.Websocket.NetDial = dial
+		}
+
+		if cfg.XHR != nil {
+			cfg.XHR.Transport = &http.Transport{Dial: dial}
+		}
+
+		c.Config = cfg
+	}
+}
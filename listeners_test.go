@@ -0,0 +1,60 @@
+package kite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-listen")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	k := NewWithConfig("listener", "0.0.1", cfg)
+	k.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+	defer k.Close()
+
+	socket := filepath.Join(dir, "kite.sock")
+
+	if _, err := k.Listen("unix", socket, nil); err != nil {
+		t.Fatalf("Listen(unix)=%s", err)
+	}
+
+	addr, err := k.Listen("tcp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("Listen(tcp)=%s", err)
+	}
+
+	clients := map[string]*Client{
+		"unix": New("unix-client", "0.0.1").NewClient("http://localhost/kite", WithUnixSocket(socket)),
+		"tcp":  New("tcp-client", "0.0.1").NewClient(fmt.Sprintf("http://%s/kite", addr)),
+	}
+
+	for name, c := range clients {
+		if err := c.Dial(); err != nil {
+			t.Fatalf("%s: Dial()=%s", name, err)
+		}
+		defer c.Close()
+
+		result, err := c.Tell("echo", name)
+		if err != nil {
+			t.Fatalf("%s: Tell()=%s", name, err)
+		}
+
+		if got := result.MustString(); got != name {
+			t.Fatalf("%s: got %q, want %q", name, got, name)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package kite
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLockoutThreshold is the number of failed authentication
+	// attempts, after which the caller is locked out, if
+	// Lockout.Threshold is zero.
+	DefaultLockoutThreshold = 5
+
+	// DefaultLockoutDuration is the time of the first lockout, if
+	// Lockout.Duration is zero.
+	DefaultLockoutDuration = time.Minute
+
+	// DefaultMaxLockoutDuration is the maximum time of a lockout, if
+	// Lockout.MaxDuration is zero.
+	DefaultMaxLockoutDuration = time.Hour
+
+	// DefaultLockoutWindow is the time failed attempts are remembered,
+	// if Lockout.Window is zero.
+	DefaultLockoutWindow = 15 * time.Minute
+
+	// DefaultMaxLockoutDelay is the maximum time the caller has to wait
+	// after a failed attempt, if Lockout.MaxDelay is zero.
+	DefaultMaxLockoutDelay = 5 * time.Second
+)
+
+// ErrLockoutNotFound is returned by Lockout.Unlock and kite.admin.unlock,
+// when the key is not tracked.
+var ErrLockoutNotFound = errors.New("lockout not found")
+
+// Lockout protects the kite against brute-force attacks on authentication,
+// see Kite.Lockout. It tracks failed authentication attempts by addresses
+// of the callers and by the usernames they claim.
+//
+// A failed attempt is answered at once with an error carrying a delay,
+// which doubles with each attempt, as its RetryAfter hint; calls of the
+// address or the username made before the delay elapses are rejected.
+// Once Threshold attempts fail, further calls are rejected for Duration,
+// which doubles with each lockout.
+//
+// The state is exposed by kite.admin.lockouts and locked out callers are
+// unblocked with kite.admin.unlock.
+type Lockout struct {
+	// Threshold is the number of failed attempts, after which the caller
+	// is locked out.
+	//
+	// If zero, DefaultLockoutThreshold is used.
+	Threshold int
+
+	// Duration is the time of the first lockout.
+	//
+	// If zero, DefaultLockoutDuration is used.
+	Duration time.Duration
+
+	// MaxDuration is the maximum time of a lockout.
+	//
+	// If zero, DefaultMaxLockoutDuration is used.
+	MaxDuration time.Duration
+
+	// Window is the time after the last failed attempt, after which
+	// the attempts and lockouts are forgotten.
+	//
+	// If zero, DefaultLockoutWindow is used.
+	Window time.Duration
+
+	// Delay is the time the caller has to wait after the first failed
+	// attempt. Zero means attempts are not delayed.
+	Delay time.Duration
+
+	// MaxDelay is the maximum time the caller has to wait after a failed
+	// attempt.
+	//
+	// If zero, DefaultMaxLockoutDelay is used.
+	MaxDelay time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*LockoutState // key -> state
+}
+
+// LockoutState describes failed attempts of an address or a username,
+// as returned by kite.admin.lockouts.
+type LockoutState struct {
+	// Key is "addr:" followed by the address, or "user:" followed
+	// by the username.
+	Key string `json:"key"`
+
+	Failures     int       `json:"failures"`     // since the last lockout
+	Lockouts     int       `json:"lockouts"`     // within the window
+	LastFailure  time.Time `json:"lastFailure"`  // time of the last failed attempt
+	DelayedUntil time.Time `json:"delayedUntil"` // end of the delay after the last failed attempt
+	LockedUntil  time.Time `json:"lockedUntil"`  // zero if not locked out
+}
+
+// Locked gives the time the key is locked out or delayed for, or zero
+// if it is not.
+func (l *Lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := l.entry(key, time.Now(), false)
+	if e == nil {
+		return 0
+	}
+
+	until := e.LockedUntil
+	if e.DelayedUntil.After(until) {
+		until = e.DelayedUntil
+	}
+
+	if d := until.Sub(time.Now()); d > 0 {
+		return d
+	}
+
+	return 0
+}
+
+// Fail records a failed attempt of the key, locking it out once the
+// threshold is reached. It gives the time the caller has to wait before
+// the next attempt.
+func (l *Lockout) Fail(key string) time.Duration {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := l.entry(key, now, true)
+
+	e.Failures++
+	e.LastFailure = now
+
+	delay := l.Delay << shift(e.Failures-1)
+	if max := l.maxDelay(); delay > max || delay < 0 {
+		delay = max
+	}
+
+	e.DelayedUntil = now.Add(delay)
+
+	if e.Failures >= l.threshold() {
+		d := l.duration() << shift(e.Lockouts)
+		if max := l.maxDuration(); d > max || d <= 0 {
+			d = max
+		}
+
+		e.Failures = 0
+		e.Lockouts++
+		e.LockedUntil = now.Add(d)
+	}
+
+	return delay
+}
+
+// Succeed forgets failed attempts of the key.
+func (l *Lockout) Succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// Unlock lifts the lockout of the key and forgets its failed attempts.
+func (l *Lockout) Unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.entries[key]; !ok {
+		return ErrLockoutNotFound
+	}
+
+	delete(l.entries, key)
+
+	return nil
+}
+
+// States gives the tracked keys sorted by key.
+func (l *Lockout) States() []*LockoutState {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	states := make([]*LockoutState, 0, len(l.entries))
+	for key := range l.entries {
+		if e := l.entry(key, now, false); e != nil {
+			state := *e
+			states = append(states, &state)
+		}
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+
+	return states
+}
+
+// entry gives the state of the key, dropping it if it is outdated.
+// If create is true, a missing state is created.
+//
+// It must be called with l.mu held.
+func (l *Lockout) entry(key string, now time.Time, create bool) *LockoutState {
+	e, ok := l.entries[key]
+
+	if ok && now.After(e.LockedUntil) && now.Sub(e.LastFailure) > l.window() {
+		delete(l.entries, key)
+		ok = false
+	}
+
+	if !ok && create {
+		if l.entries == nil {
+			l.entries = make(map[string]*LockoutState)
+		}
+
+		e = &LockoutState{Key: key}
+		l.entries[key] = e
+		ok = true
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return e
+}
+
+func (l *Lockout) threshold() int {
+	if l.Threshold != 0 {
+		return l.Threshold
+	}
+
+	return DefaultLockoutThreshold
+}
+
+func (l *Lockout) duration() time.Duration {
+	if l.Duration != 0 {
+		return l.Duration
+	}
+
+	return DefaultLockoutDuration
+}
+
+func (l *Lockout) maxDuration() time.Duration {
+	if l.MaxDuration != 0 {
+		return l.MaxDuration
+	}
+
+	return DefaultMaxLockoutDuration
+}
+
+func (l *Lockout) window() time.Duration {
+	if l.Window != 0 {
+		return l.Window
+	}
+
+	return DefaultLockoutWindow
+}
+
+func (l *Lockout) maxDelay() time.Duration {
+	if l.MaxDelay != 0 {
+		return l.MaxDelay
+	}
+
+	return DefaultMaxLockoutDelay
+}
+
+// shift gives the exponent of escalating delays, bounded so the
+// delays do not overflow.
+func shift(n int) uint {
+	if n > 30 {
+		return 30
+	}
+
+	return uint(n)
+}
+
+// lockoutKeys gives the keys failed authentication attempts of the
+// request are tracked by: the address of the caller, if known,
+// and the username it claims.
+func (r *Request) lockoutKeys() []string {
+	var keys []string
+
+	if addr := r.Client.RemoteAddr(); addr != "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+
+		keys = append(keys, "addr:"+addr)
+	}
+
+	return append(keys, "user:"+r.Client.Kite.Username)
+}
+
+// handleAdminLockouts returns the state of the lockout of the kite.
+func (k *Kite) handleAdminLockouts(r *Request) (interface{}, error) {
+	if k.Lockout == nil {
+		return []*LockoutState{}, nil
+	}
+
+	return k.Lockout.States(), nil
+}
+
+// handleAdminUnlock lifts the lockout of the given key.
+func (k *Kite) handleAdminUnlock(r *Request) (interface{}, error) {
+	if k.Lockout == nil {
+		return nil, ErrLockoutNotFound
+	}
+
+	return nil, k.Lockout.Unlock(r.Args.One().MustString())
+}
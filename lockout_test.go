@@ -0,0 +1,126 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestLockout(t *testing.T) {
+	srv := NewWithConfig("lockout-server", "0.0.1", config.New())
+	srv.Lockout = &Lockout{
+		Threshold: 2,
+		Delay:     200 * time.Millisecond,
+	}
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("lockout-client", "0.0.1")
+	k.Config.Username = "mallory"
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL), WithAuth(&Auth{Type: "token", Key: "guess"}))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+
+		_, err := c.TellWithTimeout("echo", 4*time.Second, "hi")
+		if e, ok := err.(*Error); !ok || e.Type != "authenticationError" || !strings.HasPrefix(e.Message, "token:") {
+			t.Fatalf("%d: got %v, want token error", i, err)
+		}
+
+		if time.Since(start) >= srv.Lockout.Delay {
+			t.Fatalf("%d: failed attempt was delayed", i)
+		}
+
+		d := RetryAfter(err)
+		if want := srv.Lockout.Delay << uint(i); d < want || d > want+time.Millisecond {
+			t.Fatalf("%d: got retry after %s, want %s", i, d, want)
+		}
+
+		if i == 0 {
+			_, err := c.TellWithTimeout("echo", 4*time.Second, "hi")
+			if e, ok := err.(*Error); !ok || !strings.Contains(e.Message, "Too many failed") {
+				t.Fatalf("got %v, want delayed attempt rejected", err)
+			}
+
+			time.Sleep(RetryAfter(err))
+		}
+	}
+
+	_, err := c.TellWithTimeout("echo", 4*time.Second, "hi")
+	if e, ok := err.(*Error); !ok || !strings.Contains(e.Message, "Too many failed") {
+		t.Fatalf("got %v, want lockout error", err)
+	}
+
+	if d := RetryAfter(err); d <= 0 || d > DefaultLockoutDuration {
+		t.Fatalf("got retry after %s", d)
+	}
+
+	states := srv.Lockout.States()
+	if len(states) != 2 || states[0].Key != "addr:127.0.0.1" || states[1].Key != "user:mallory" {
+		t.Fatalf("got %+v, want address and user locked out", states)
+	}
+
+	for _, s := range states {
+		if s.Lockouts != 1 || s.LockedUntil.IsZero() {
+			t.Fatalf("got %+v, want locked out once", s)
+		}
+
+		if err := srv.Lockout.Unlock(s.Key); err != nil {
+			t.Fatalf("Unlock()=%s", err)
+		}
+	}
+
+	_, err = c.TellWithTimeout("echo", 4*time.Second, "hi")
+	if e, ok := err.(*Error); !ok || !strings.HasPrefix(e.Message, "token:") {
+		t.Fatalf("got %v, want token error after unlock", err)
+	}
+}
+
+func TestLockoutEscalation(t *testing.T) {
+	l := &Lockout{
+		Threshold:   2,
+		Duration:    time.Minute,
+		MaxDuration: 3 * time.Minute,
+		Delay:       time.Second,
+		MaxDelay:    3 * time.Second,
+	}
+
+	delays := []time.Duration{time.Second, 2 * time.Second, time.Second, 2 * time.Second, time.Second, 2 * time.Second}
+	durations := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}
+
+	for i, want := range delays {
+		if got := l.Fail("key"); got != want {
+			t.Fatalf("%d: got delay %s, want %s", i, got, want)
+		}
+
+		if i%2 == 0 {
+			continue
+		}
+
+		got := l.Locked("key")
+		if want := durations[i/2]; got <= want-time.Second || got > want {
+			t.Fatalf("%d: got locked for %s, want %s", i, got, want)
+		}
+	}
+
+	if err := l.Unlock("key"); err != nil {
+		t.Fatalf("Unlock()=%s", err)
+	}
+
+	if err := l.Unlock("key"); err != ErrLockoutNotFound {
+		t.Fatalf("got %v, want %v", err, ErrLockoutNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Tail streams log entries from the remote kite the client is connected
+// to, calling fn with each batch. Batches are acknowledged once fn
+// returns, so a slow fn makes the remote kite queue, and eventually drop,
+// entries instead of overwhelming the client.
+//
+// Tail returns when the ctx is done or the stream ends; the returned
+// error is nil if the source of a stream has no more entries.
+func Tail(ctx context.Context, c *kite.Client, opts *Options, fn func(*Batch)) error {
+	var (
+		mu     sync.Mutex
+		events []interface{} // *Batch or *endEvent
+		notify = make(chan struct{}, 1)
+	)
+
+	push := func(event interface{}) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+
+	args := &tailArgs{
+		File:      opts.File,
+		FromStart: opts.FromStart,
+		Journal:   opts.Journal,
+		Unit:      opts.Unit,
+		Level:     opts.Level,
+		Pattern:   opts.Pattern,
+		Batch: dnode.Callback(func(p *dnode.Partial) {
+			var b Batch
+			if err := p.One().Unmarshal(&b); err != nil {
+				c.LocalKite.Log.Warning("logs: invalid batch: %s", err)
+				return
+			}
+			push(&b)
+		}),
+		End: dnode.Callback(func(p *dnode.Partial) {
+			var e endEvent
+			if err := p.One().Unmarshal(&e); err != nil {
+				e.Error = err.Error()
+			}
+			push(&e)
+		}),
+	}
+
+	res, err := c.Tell("logs.tail", args)
+	if err != nil {
+		return err
+	}
+
+	var r tailResult
+	if err := res.Unmarshal(&r); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if _, err := c.Tell("logs.stop", &stopArgs{ID: r.ID}); err != nil {
+				c.LocalKite.Log.Debug("logs: unable to stop stream %s: %s", r.ID, err)
+			}
+			return ctx.Err()
+		case <-notify:
+		}
+
+		mu.Lock()
+		pending := events
+		events = nil
+		mu.Unlock()
+
+		for _, event := range pending {
+			switch event := event.(type) {
+			case *Batch:
+				fn(event)
+
+				if _, err := c.Tell("logs.ack", &ackArgs{ID: r.ID, Seq: event.Seq}); err != nil {
+					return err
+				}
+			case *endEvent:
+				if event.Error != "" {
+					return errors.New(event.Error)
+				}
+				return nil
+			}
+		}
+	}
+}
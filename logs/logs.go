@@ -0,0 +1,205 @@
+// Package logs streams log entries of files and the systemd journal from
+// remote kites.
+//
+// Entries are filtered by the serving kite, by their level and by a
+// regular expression, and sent in batches. The client acknowledges each
+// batch; while too many batches are not acknowledged, entries are queued,
+// and once the queue is full the oldest ones are dropped. Entries above
+// the rate limit are dropped as well. Every batch tells how many entries
+// were dropped before it, so the client knows about the gaps.
+//
+// Server:
+//
+//	k := kite.New("logs", "1.0.0")
+//	s := logs.NewServer(k)
+//	s.Files = []string{"/var/log/*.log"}
+//	s.Journal = true
+//	k.Run()
+//
+// Client:
+//
+//	opts := &logs.Options{
+//	    File:    "/var/log/app.log",
+//	    Level:   "WARNING",
+//	    Pattern: "timeout|refused",
+//	}
+//
+//	err := logs.Tail(ctx, c, opts, func(b *logs.Batch) {
+//	    for _, e := range b.Entries {
+//	        fmt.Println(e.Time, e.Level, e.Message)
+//	    }
+//	})
+package logs
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var (
+	// DefaultBatchSize is the maximum number of entries in a batch, if
+	// Server.BatchSize is zero.
+	DefaultBatchSize = 100
+
+	// DefaultBatchInterval is the time entries are collected before
+	// a batch is sent, if Server.BatchInterval is zero.
+	DefaultBatchInterval = 200 * time.Millisecond
+
+	// DefaultWindow is the number of batches, which were not acknowledged
+	// yet, above which entries are queued, if Server.Window is zero.
+	DefaultWindow = 4
+
+	// DefaultBufferSize is the number of queued entries above which the
+	// oldest ones are dropped, if Server.BufferSize is zero.
+	DefaultBufferSize = 1000
+
+	// DefaultRate is the number of entries per second above which entries
+	// are dropped, if Server.Rate is zero.
+	DefaultRate = 1000
+
+	// DefaultPollInterval is the time between checks of a file for new
+	// entries, if Server.PollInterval is zero.
+	DefaultPollInterval = 250 * time.Millisecond
+)
+
+var (
+	// ErrNotAllowed is returned for sources, which are not allowed by
+	// the server.
+	ErrNotAllowed = errors.New("log source is not allowed")
+
+	// ErrStreamNotFound is returned for calls to a stream, which does not
+	// exist or was started by other user.
+	ErrStreamNotFound = errors.New("log stream not found")
+)
+
+// Entry is a single log entry.
+type Entry struct {
+	// Time is the time the entry was read, or logged if the source
+	// records it.
+	Time time.Time `json:"time"`
+
+	// Level is one of "FATAL", "ERROR", "WARNING", "INFO" and "DEBUG",
+	// or empty if it is not known.
+	Level string `json:"level,omitempty"`
+
+	// Message is the entry without the trailing newline.
+	Message string `json:"message"`
+
+	// Source is the file or the journal unit of the entry.
+	Source string `json:"source,omitempty"`
+}
+
+// Batch is a batch of entries sent to the client.
+type Batch struct {
+	// Seq is the sequence number of the batch in the stream.
+	Seq int64 `json:"seq"`
+
+	// Entries holds the entries in the order they were read.
+	Entries []*Entry `json:"entries"`
+
+	// Dropped is the number of entries dropped after the previous batch.
+	Dropped int64 `json:"dropped,omitempty"`
+
+	// TotalDropped is the number of entries dropped since the stream
+	// started.
+	TotalDropped int64 `json:"totalDropped,omitempty"`
+}
+
+// Options describe the stream of entries.
+type Options struct {
+	// File is the path of the tailed file.
+	File string
+
+	// FromStart, when true, streams the file from its beginning instead
+	// of only the entries appended to it.
+	FromStart bool
+
+	// Journal, when true, streams the systemd journal instead of a file.
+	Journal bool
+
+	// Unit limits the journal to entries of the systemd unit.
+	Unit string
+
+	// Level is the least severe level of streamed entries. Entries of
+	// unknown level are treated as "INFO".
+	//
+	// If empty, entries of all levels are streamed.
+	Level string
+
+	// Pattern is a regular expression the message of streamed entries
+	// must match.
+	//
+	// If empty, all messages are streamed.
+	Pattern string
+}
+
+// levels maps level names to their severity, the lower the more severe.
+var levels = map[string]int{
+	"FATAL":   0,
+	"ERROR":   1,
+	"WARNING": 2,
+	"INFO":    3,
+	"DEBUG":   4,
+}
+
+var levelRe = regexp.MustCompile(`(?i)\b(FATAL|CRITICAL|CRIT|ERROR|ERR|WARNING|WARN|INFO|DEBUG)\b`)
+
+// parseLevel gives the level named in the message of a file entry.
+func parseLevel(message string) string {
+	m := levelRe.FindStringSubmatch(message)
+	if m == nil {
+		return ""
+	}
+
+	switch level := strings.ToUpper(m[1]); level {
+	case "CRITICAL", "CRIT":
+		return "FATAL"
+	case "ERR":
+		return "ERROR"
+	case "WARN":
+		return "WARNING"
+	default:
+		return level
+	}
+}
+
+// severity gives the severity of the level.
+func severity(level string) int {
+	if s, ok := levels[level]; ok {
+		return s
+	}
+
+	return levels["INFO"]
+}
+
+type tailArgs struct {
+	File      string         `json:"file,omitempty"`
+	FromStart bool           `json:"fromStart,omitempty"`
+	Journal   bool           `json:"journal,omitempty"`
+	Unit      string         `json:"unit,omitempty"`
+	Level     string         `json:"level,omitempty"`
+	Pattern   string         `json:"pattern,omitempty"`
+	Batch     dnode.Function `json:"batch"`
+	End       dnode.Function `json:"end"`
+}
+
+type tailResult struct {
+	ID string `json:"id"`
+}
+
+type ackArgs struct {
+	ID  string `json:"id"`
+	Seq int64  `json:"seq"`
+}
+
+type stopArgs struct {
+	ID string `json:"id"`
+}
+
+type endEvent struct {
+	Error string `json:"error,omitempty"`
+}
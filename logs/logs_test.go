@@ -0,0 +1,175 @@
+package logs_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/logs"
+)
+
+func newServer(t *testing.T, dir string) (*logs.Server, *kite.Client, func()) {
+	k := kite.New("logs", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv := logs.NewServer(k)
+	srv.Files = []string{filepath.Join(dir, "*.log")}
+	srv.BatchInterval = 20 * time.Millisecond
+	srv.PollInterval = 20 * time.Millisecond
+
+	ts := httptest.NewServer(k)
+
+	c := kite.New("logs-client", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		ts.Close()
+		t.Fatalf("Dial()=%s", err)
+	}
+
+	return srv, c, func() {
+		c.Close()
+		ts.Close()
+	}
+}
+
+func appendLines(t *testing.T, file string, lines ...string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, c, stop := newServer(t, dir)
+	defer stop()
+
+	file := filepath.Join(dir, "app.log")
+
+	appendLines(t, file,
+		"INFO disk usage 40%",
+		"ERROR disk is full",
+		"WARN connection refused",
+	)
+
+	opts := &logs.Options{
+		File:      file,
+		FromStart: true,
+		Level:     "WARNING",
+		Pattern:   "disk",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var got []string
+
+	err = logs.Tail(ctx, c, opts, func(b *logs.Batch) {
+		for _, e := range b.Entries {
+			got = append(got, e.Level+" "+e.Message)
+		}
+
+		switch len(got) {
+		case 1:
+			appendLines(t, file, "DEBUG disk check", "warning: disk almost full")
+		case 2:
+			cancel()
+		}
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	want := []string{
+		"ERROR ERROR disk is full",
+		"WARNING warning: disk almost full",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	err = logs.Tail(ctx, c, &logs.Options{File: "/etc/passwd"}, func(*logs.Batch) {})
+	if e, ok := err.(*kite.Error); !ok || e.Message != logs.ErrNotAllowed.Error() {
+		t.Fatalf("got %v, want %v", err, logs.ErrNotAllowed)
+	}
+}
+
+func TestTail_Drop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv, c, stop := newServer(t, dir)
+	defer stop()
+
+	srv.Rate = 10
+
+	file := filepath.Join(dir, "app.log")
+
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+
+	appendLines(t, file, lines...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		entries int
+		dropped int64
+	)
+
+	err = logs.Tail(ctx, c, &logs.Options{File: file, FromStart: true}, func(b *logs.Batch) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		entries += len(b.Entries)
+		dropped += b.Dropped
+
+		if b.TotalDropped != dropped {
+			t.Errorf("got total %d dropped, want %d", b.TotalDropped, dropped)
+		}
+
+		if int64(entries)+dropped >= int64(len(lines)) {
+			cancel()
+		}
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	if entries == 0 || entries >= len(lines) {
+		t.Fatalf("got %d entries, want some of %d dropped", entries, len(lines))
+	}
+
+	if int64(entries)+dropped != int64(len(lines)) {
+		t.Fatalf("got %d entries and %d dropped, want %d", entries, dropped, len(lines))
+	}
+}
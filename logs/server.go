@@ -0,0 +1,462 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// Server streams log entries to remote kites. It serves the following
+// methods of the kite:
+//
+//	logs.tail - starts a stream, sending batches of entries to a callback
+//	logs.ack  - acknowledges a batch
+//	logs.stop - stops a stream
+type Server struct {
+	// Files is the allowlist of files, which may be tailed. Entries may
+	// contain patterns of filepath.Match, for example "/var/log/*.log".
+	//
+	// If empty, no file may be tailed.
+	Files []string
+
+	// Journal, when true, allows streaming the systemd journal.
+	Journal bool
+
+	// BatchSize is the maximum number of entries in a batch.
+	//
+	// If zero, DefaultBatchSize is used.
+	BatchSize int
+
+	// BatchInterval is the time entries are collected before a batch
+	// is sent, unless the batch is full earlier.
+	//
+	// If zero, DefaultBatchInterval is used.
+	BatchInterval time.Duration
+
+	// Window is the number of batches, which were not acknowledged yet,
+	// above which entries are queued.
+	//
+	// If zero, DefaultWindow is used.
+	Window int
+
+	// BufferSize is the number of queued entries above which the oldest
+	// ones are dropped.
+	//
+	// If zero, DefaultBufferSize is used.
+	BufferSize int
+
+	// Rate is the number of entries per second of a stream above which
+	// entries are dropped. Bursts of up to Rate entries are allowed.
+	//
+	// If zero, DefaultRate is used.
+	Rate int
+
+	// PollInterval is the time between checks of a file for new entries.
+	//
+	// If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	k       *kite.Kite
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+type stream struct {
+	id     string
+	owner  string
+	srv    *Server
+	cancel context.CancelFunc
+	level  int
+	re     *regexp.Regexp // nil if not filtered
+	notify chan struct{}  // signals a full batch or an acknowledgement
+
+	mu      sync.Mutex
+	queue   []*Entry
+	dropped int64 // since the previous batch
+	total   int64 // dropped since the start
+	nextSeq int64 // of the next batch
+	acked   int64 // sequence number of the next batch to acknowledge
+	tokens  float64
+	last    time.Time // of the last refill of tokens
+	ended   bool      // the source has no more entries
+	err     error     // of the source
+}
+
+// NewServer gives new server streaming log entries with the given kite.
+func NewServer(k *kite.Kite) *Server {
+	s := &Server{
+		k:       k,
+		streams: make(map[string]*stream),
+	}
+
+	k.HandleFunc("logs.tail", s.handleTail)
+	k.HandleFunc("logs.ack", s.handleAck)
+	k.HandleFunc("logs.stop", s.handleStop)
+
+	return s
+}
+
+func (s *Server) handleTail(r *kite.Request) (interface{}, error) {
+	var args tailArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if !args.Batch.IsValid() {
+		return nil, errors.New("batch callback is missing")
+	}
+
+	st := &stream{
+		id:     utils.RandomString(16),
+		owner:  r.Username,
+		srv:    s,
+		level:  severity("DEBUG"),
+		notify: make(chan struct{}, 1),
+		tokens: float64(s.rate()),
+		last:   time.Now(),
+	}
+
+	if args.Level != "" {
+		level, ok := levels[args.Level]
+		if !ok {
+			return nil, errors.New("unknown level: " + args.Level)
+		}
+		st.level = level
+	}
+
+	if args.Pattern != "" {
+		re, err := regexp.Compile(args.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		st.re = re
+	}
+
+	src, err := s.source(&args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st.cancel = cancel
+
+	s.mu.Lock()
+	s.streams[st.id] = st
+	s.mu.Unlock()
+
+	r.Client.OnDisconnect(cancel)
+
+	go st.send(ctx, args.Batch, args.End)
+
+	go func() {
+		st.end(src.run(ctx, st.emit))
+	}()
+
+	return &tailResult{ID: st.id}, nil
+}
+
+func (s *Server) handleAck(r *kite.Request) (interface{}, error) {
+	var args ackArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	st, err := s.stream(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	if args.Seq >= st.acked && args.Seq < st.nextSeq {
+		st.acked = args.Seq + 1
+	}
+	st.mu.Unlock()
+
+	st.signal()
+
+	return nil, nil
+}
+
+func (s *Server) handleStop(r *kite.Request) (interface{}, error) {
+	var args stopArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	st, err := s.stream(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	st.cancel()
+
+	return nil, nil
+}
+
+// stream gives the stream with the given ID started by the caller.
+func (s *Server) stream(r *kite.Request, id string) (*stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.streams[id]
+	if !ok || st.owner != r.Username {
+		return nil, ErrStreamNotFound
+	}
+
+	return st, nil
+}
+
+// source opens the source requested by the caller, if it is allowed.
+func (s *Server) source(args *tailArgs) (source, error) {
+	if args.Journal {
+		if !s.Journal {
+			return nil, ErrNotAllowed
+		}
+
+		return &journalSource{unit: args.Unit}, nil
+	}
+
+	path := filepath.Clean(args.File)
+
+	if !filepath.IsAbs(path) || !s.allowed(path) {
+		return nil, ErrNotAllowed
+	}
+
+	return openFile(path, args.FromStart, s.pollInterval())
+}
+
+// allowed tells whether the file is in the allowlist.
+func (s *Server) allowed(path string) bool {
+	for _, pattern := range s.Files {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) batchSize() int {
+	if s.BatchSize != 0 {
+		return s.BatchSize
+	}
+
+	return DefaultBatchSize
+}
+
+func (s *Server) batchInterval() time.Duration {
+	if s.BatchInterval != 0 {
+		return s.BatchInterval
+	}
+
+	return DefaultBatchInterval
+}
+
+func (s *Server) window() int {
+	if s.Window != 0 {
+		return s.Window
+	}
+
+	return DefaultWindow
+}
+
+func (s *Server) bufferSize() int {
+	if s.BufferSize != 0 {
+		return s.BufferSize
+	}
+
+	return DefaultBufferSize
+}
+
+func (s *Server) rate() int {
+	if s.Rate != 0 {
+		return s.Rate
+	}
+
+	return DefaultRate
+}
+
+func (s *Server) pollInterval() time.Duration {
+	if s.PollInterval != 0 {
+		return s.PollInterval
+	}
+
+	return DefaultPollInterval
+}
+
+// emit queues the entry if it passes the filters and the rate limit.
+func (st *stream) emit(e *Entry) {
+	if severity(e.Level) > st.level {
+		return
+	}
+
+	if st.re != nil && !st.re.MatchString(e.Message) {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !st.take() {
+		st.drop(1)
+		return
+	}
+
+	if n := len(st.queue) - st.srv.bufferSize() + 1; n > 0 {
+		st.queue = st.queue[n:]
+		st.drop(int64(n))
+	}
+
+	st.queue = append(st.queue, e)
+
+	if len(st.queue) >= st.srv.batchSize() {
+		st.signal()
+	}
+}
+
+// take takes a token of the rate limit, telling whether there was one.
+func (st *stream) take() bool {
+	rate := float64(st.srv.rate())
+	now := time.Now()
+
+	st.tokens += now.Sub(st.last).Seconds() * rate
+	st.last = now
+
+	if st.tokens > rate {
+		st.tokens = rate
+	}
+
+	if st.tokens < 1 {
+		return false
+	}
+
+	st.tokens--
+
+	return true
+}
+
+func (st *stream) drop(n int64) {
+	st.dropped += n
+	st.total += n
+}
+
+func (st *stream) signal() {
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+// end marks the end of the source, which failed if err is non-nil.
+func (st *stream) end(err error) {
+	st.mu.Lock()
+	st.ended = true
+	st.err = err
+	st.mu.Unlock()
+
+	st.signal()
+}
+
+// send sends batches of queued entries, until the ctx is done or all
+// entries of the source are sent.
+func (st *stream) send(ctx context.Context, batch, end dnode.Function) {
+	defer func() {
+		st.cancel()
+
+		st.srv.mu.Lock()
+		delete(st.srv.streams, st.id)
+		st.srv.mu.Unlock()
+	}()
+
+	t := time.NewTicker(st.srv.batchInterval())
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-st.notify:
+		}
+
+		for {
+			b := st.next()
+			if b == nil {
+				break
+			}
+
+			if err := batch.Call(b); err != nil {
+				st.srv.k.Log.Debug("logs: unable to send batch of %s: %s", st.id, err)
+				return
+			}
+		}
+
+		if ended, err := st.done(); ended {
+			if !end.IsValid() {
+				return
+			}
+
+			event := &endEvent{}
+			if err != nil {
+				event.Error = err.Error()
+			}
+
+			if err := end.Call(event); err != nil {
+				st.srv.k.Log.Debug("logs: unable to end stream %s: %s", st.id, err)
+			}
+
+			return
+		}
+	}
+}
+
+// done tells whether the source ended and all its entries were sent.
+func (st *stream) done() (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.ended && len(st.queue) == 0 && st.dropped == 0, st.err
+}
+
+// next takes the next batch off the queue, or gives nil if there is
+// nothing to send or the window is full.
+func (st *stream) next() *Batch {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.queue) == 0 && st.dropped == 0 {
+		return nil
+	}
+
+	if st.nextSeq-st.acked >= int64(st.srv.window()) {
+		return nil
+	}
+
+	n := len(st.queue)
+	if size := st.srv.batchSize(); n > size {
+		n = size
+	}
+
+	b := &Batch{
+		Seq:          st.nextSeq,
+		Entries:      append([]*Entry(nil), st.queue[:n]...),
+		Dropped:      st.dropped,
+		TotalDropped: st.total,
+	}
+
+	st.queue = st.queue[n:]
+	st.dropped = 0
+	st.nextSeq++
+
+	return b
+}
@@ -0,0 +1,231 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strconv"
+	"time"
+)
+
+// source reads entries, passing them to emit until the ctx is done.
+type source interface {
+	run(ctx context.Context, emit func(*Entry)) error
+}
+
+// fileSource tails a file, following its rotation and truncation.
+type fileSource struct {
+	path string
+	poll time.Duration
+
+	f      *os.File
+	offset int64 // of the next byte read from f
+}
+
+// openFile opens the file, positioning it at its end unless fromStart
+// is true.
+func openFile(path string, fromStart bool, poll time.Duration) (*fileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileSource{
+		path: path,
+		poll: poll,
+		f:    f,
+	}
+
+	if !fromStart {
+		if s.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *fileSource) run(ctx context.Context, emit func(*Entry)) error {
+	defer func() { s.f.Close() }()
+
+	r := bufio.NewReader(s.f)
+
+	var partial []byte // line without newline yet
+
+	for {
+		line, err := r.ReadBytes('\n')
+		s.offset += int64(len(line))
+
+		if err == nil {
+			line = bytes.TrimRight(append(partial, line...), "\r\n")
+			partial = nil
+
+			emit(&Entry{
+				Time:    time.Now(),
+				Level:   parseLevel(string(line)),
+				Message: string(line),
+				Source:  s.path,
+			})
+
+			continue
+		}
+
+		if err != io.EOF {
+			return err
+		}
+
+		partial = append(partial, line...)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.poll):
+		}
+
+		if s.reopen() {
+			r.Reset(s.f)
+			partial = nil
+		}
+	}
+}
+
+// reopen reopens the file if it was rotated, or rewinds it if it was
+// truncated. It tells whether reading starts over.
+func (s *fileSource) reopen() bool {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return false // rotated and not created yet
+	}
+
+	cur, err := s.f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if !os.SameFile(fi, cur) {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return false
+		}
+
+		s.f.Close()
+		s.f = f
+		s.offset = 0
+
+		return true
+	}
+
+	if fi.Size() < s.offset {
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+
+		s.offset = 0
+
+		return true
+	}
+
+	return false
+}
+
+// journalSource follows the systemd journal with journalctl.
+type journalSource struct {
+	unit string
+}
+
+// journalEntry is an entry printed by journalctl in the JSON format.
+type journalEntry struct {
+	Message   interface{} `json:"MESSAGE"` // string or array of bytes
+	Priority  string      `json:"PRIORITY"`
+	Timestamp string      `json:"__REALTIME_TIMESTAMP"` // in microseconds
+	Unit      string      `json:"_SYSTEMD_UNIT"`
+}
+
+// priorities maps syslog priorities to levels.
+var priorities = map[string]string{
+	"0": "FATAL",
+	"1": "FATAL",
+	"2": "FATAL",
+	"3": "ERROR",
+	"4": "WARNING",
+	"5": "INFO",
+	"6": "INFO",
+	"7": "DEBUG",
+}
+
+func (s *journalSource) run(ctx context.Context, emit func(*Entry)) error {
+	args := []string{"--follow", "--output=json", "--lines=0", "--no-pager"}
+	if s.unit != "" {
+		args = append(args, "--unit="+s.unit)
+	}
+
+	cmd := osexec.CommandContext(ctx, "journalctl", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var je journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &je); err != nil {
+			continue
+		}
+
+		e := &Entry{
+			Time:    time.Now(),
+			Level:   priorities[je.Priority],
+			Message: journalMessage(je.Message),
+			Source:  je.Unit,
+		}
+
+		if us, err := strconv.ParseInt(je.Timestamp, 10, 64); err == nil {
+			e.Time = time.Unix(0, us*int64(time.Microsecond))
+		}
+
+		emit(e)
+	}
+
+	err = cmd.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err == nil {
+		err = scanner.Err()
+	}
+
+	return err
+}
+
+// journalMessage converts the message, which journalctl prints as an
+// array of bytes if it is not valid UTF-8.
+func journalMessage(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []interface{}:
+		p := make([]byte, 0, len(v))
+		for _, b := range v {
+			if f, ok := b.(float64); ok {
+				p = append(p, byte(f))
+			}
+		}
+		return string(p)
+	default:
+		return ""
+	}
+}
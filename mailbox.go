@@ -0,0 +1,198 @@
+package kite
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultMailboxSize is the maximum number of messages queued
+	// for a single remote kite, if Mailbox.Size is zero.
+	DefaultMailboxSize = 100
+
+	// DefaultMailboxTTL is the time a queued message is kept,
+	// if Mailbox.TTL is zero.
+	DefaultMailboxTTL = 5 * time.Minute
+)
+
+// Mailbox queues fire-and-forget messages for remote kites, which are
+// temporarily disconnected from the kite, and delivers them when the
+// remote kite reconnects and makes its first request.
+//
+// Queues are bounded; when a queue is full, the oldest message is
+// dropped. Messages older than TTL are dropped too.
+type Mailbox struct {
+	// Kite is the local kite, which remote kites connect to.
+	//
+	// Required.
+	Kite *Kite
+
+	// Size is the maximum number of messages queued for a single
+	// remote kite.
+	//
+	// If zero, DefaultMailboxSize is used.
+	Size int
+
+	// TTL is the time a queued message is kept.
+	//
+	// If zero, DefaultMailboxTTL is used.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	boxes     map[string][]*mailboxMessage // remote kite ID -> messages
+	lastSweep time.Time
+}
+
+type mailboxMessage struct {
+	method  string
+	args    []interface{}
+	expires time.Time
+}
+
+// NewMailbox gives new mailbox for remote kites connecting to k.
+func NewMailbox(k *Kite) *Mailbox {
+	m := &Mailbox{
+		Kite:  k,
+		boxes: make(map[string][]*mailboxMessage),
+	}
+
+	k.OnFirstRequest(func(c *Client) {
+		go m.deliver(c)
+	})
+
+	return m
+}
+
+// Send calls the method of the remote kite with the given ID without
+// waiting for the result. If the remote kite is not connected or the
+// call cannot be sent, the message is queued until it reconnects.
+func (m *Mailbox) Send(kiteID, method string, args ...interface{}) {
+	msg := &mailboxMessage{
+		method:  method,
+		args:    args,
+		expires: time.Now().Add(m.ttl()),
+	}
+
+	if c := m.Kite.connectedKite(kiteID); c != nil {
+		go m.send(kiteID, c, msg)
+		return
+	}
+
+	m.enqueue(kiteID, msg)
+}
+
+// Len gives the number of messages queued for the remote kite
+// with the given ID.
+func (m *Mailbox) Len(kiteID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(kiteID, time.Now())
+
+	return len(m.boxes[kiteID])
+}
+
+func (m *Mailbox) send(kiteID string, c *Client, msg *mailboxMessage) {
+	ctx := WithExpiry(context.Background(), msg.expires)
+
+	resp := <-c.GoWithContext(ctx, msg.method, msg.args...)
+
+	if e, ok := resp.Err.(*Error); ok && (e.Type == "sendError" || e.Type == "disconnect") {
+		m.enqueue(kiteID, msg)
+	}
+}
+
+func (m *Mailbox) enqueue(kiteID string, msg *mailboxMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired messages of kites, which are not going
+	// to reconnect again.
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id := range m.boxes {
+			m.expire(id, now)
+		}
+
+		m.lastSweep = now
+	}
+
+	box := append(m.boxes[kiteID], msg)
+	if n := len(box) - m.size(); n > 0 {
+		m.Kite.Log.Debug("mailbox of %q is full, dropping %d message(s)", kiteID, n)
+		box = box[n:]
+	}
+
+	m.boxes[kiteID] = box
+}
+
+// deliver sends the messages queued for the remote kite of c.
+func (m *Mailbox) deliver(c *Client) {
+	c.m.RLock()
+	kiteID := c.Kite.ID
+	c.m.RUnlock()
+
+	m.mu.Lock()
+	m.expire(kiteID, time.Now())
+	box := m.boxes[kiteID]
+	delete(m.boxes, kiteID)
+	m.mu.Unlock()
+
+	for _, msg := range box {
+		m.send(kiteID, c, msg)
+	}
+}
+
+// expire drops expired messages of the given kite, it is
+// called with m.mu held.
+func (m *Mailbox) expire(kiteID string, now time.Time) {
+	box := m.boxes[kiteID]
+
+	i := 0
+	for i < len(box) && now.After(box[i].expires) {
+		i++
+	}
+
+	if i == len(box) {
+		delete(m.boxes, kiteID)
+	} else {
+		m.boxes[kiteID] = box[i:]
+	}
+}
+
+func (m *Mailbox) size() int {
+	if m.Size != 0 {
+		return m.Size
+	}
+
+	return DefaultMailboxSize
+}
+
+func (m *Mailbox) ttl() time.Duration {
+	if m.TTL != 0 {
+		return m.TTL
+	}
+
+	return DefaultMailboxTTL
+}
+
+// connectedKite gives a client connected to the kite's server, which
+// belongs to the remote kite with the given ID, or nil if there is none.
+func (k *Kite) connectedKite(kiteID string) *Client {
+	k.clientsMu.Lock()
+	defer k.clientsMu.Unlock()
+
+	for _, cc := range k.clients {
+		cc.client.m.RLock()
+		id := cc.client.Kite.ID
+		cc.client.m.RUnlock()
+
+		if id == kiteID {
+			return cc.client
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestMailbox(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("mailbox-server", "0.0.1", cfg)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	m := NewMailbox(srv)
+	m.Size = 2
+
+	notified := make(chan string, 4)
+
+	peer := NewWithConfig("mailbox-peer", "0.0.1", cfg.Copy())
+	peer.HandleFunc("notify", func(r *Request) (interface{}, error) {
+		notified <- r.Args.One().MustString()
+		return nil, nil
+	})
+
+	// The peer is not connected, the oldest message is dropped.
+	m.Send(peer.Id, "notify", "first")
+	m.Send(peer.Id, "notify", "second")
+	m.Send(peer.Id, "notify", "third")
+
+	if n := m.Len(peer.Id); n != 2 {
+		t.Fatalf("got %d queued messages, want 2", n)
+	}
+
+	c := peer.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("kite.ping"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	for _, want := range []string{"second", "third"} {
+		select {
+		case got := <-notified:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	if n := m.Len(peer.Id); n != 0 {
+		t.Fatalf("got %d queued messages, want 0", n)
+	}
+
+	// The peer is connected, the message is sent right away.
+	m.Send(peer.Id, "notify", "fourth")
+
+	select {
+	case got := <-notified:
+		if got != "fourth" {
+			t.Fatalf("got %q, want %q", got, "fourth")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for fourth")
+	}
+}
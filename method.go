@@ -1,12 +1,23 @@
 package kite
 
 import (
+	"context"
+	"expvar"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/juju/ratelimit"
 )
 
+// HandlerTimeouts counts handlers, which did not finish within the method
+// timeout, by method name. It is published with the expvar package.
+var HandlerTimeouts = expvar.NewMap("kite.handlerTimeouts")
+
 // MethodHandling defines how to handle chaining of kite.Handler middlewares.
 // An error breaks the chain regardless of what handling is used. Note that all
 // Pre and Post handlers are executed regardless the handling logic, only the
@@ -71,6 +82,27 @@ type Method struct {
 	// bucket is used for throttling the method by certain rule
 	bucket *ratelimit.Bucket
 
+	// cache is used for caching results of idempotent methods
+	cache *methodCache
+
+	// scopes required from callers with restricted tokens
+	scopes []string
+
+	// timeout is the maximum execution time of the method
+	timeout time.Duration
+
+	// signed requires calls to be signed with a trusted key
+	signed bool
+
+	// strictArgs rejects arguments not matching the types they are
+	// unmarshaled into
+	strictArgs bool
+
+	// doc, args and result describe the method in API documentation
+	doc    string
+	args   []reflect.Type
+	result reflect.Type
+
 	mu sync.Mutex // protects handler slices
 }
 
@@ -88,16 +120,105 @@ func (k *Kite) addHandle(method string, handler Handler) *Method {
 		handling:     k.MethodHandling,
 	}
 
-	k.handlers[method] = m
+	k.methods.mu.Lock()
+	k.methods.m[method] = m
+	k.methods.mu.Unlock()
+
 	return m
 }
 
+// method gives the method registered with the given name. Methods may be
+// registered while the kite is serving requests.
+func (k *Kite) method(name string) (*Method, bool) {
+	k.methods.mu.RLock()
+	defer k.methods.mu.RUnlock()
+
+	m, ok := k.methods.m[name]
+	return m, ok
+}
+
+// methodTable holds the methods registered with a kite. It is shared
+// by the kite and its copies made with Copy.
+type methodTable struct {
+	mu sync.RWMutex // protects m
+	m  map[string]*Method
+}
+
+func newMethodTable() *methodTable {
+	return &methodTable{
+		m: make(map[string]*Method),
+	}
+}
+
+// copy gives a copy of the method, which can be changed without
+// affecting the original one. The copy starts with a full throttle
+// bucket and an empty cache.
+func (m *Method) copy() *Method {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mc := &Method{
+		name:         m.name,
+		handler:      m.handler,
+		preHandlers:  append([]Handler(nil), m.preHandlers...),
+		postHandlers: append([]Handler(nil), m.postHandlers...),
+		finalFuncs:   append([]FinalFunc(nil), m.finalFuncs...),
+		authenticate: m.authenticate,
+		handling:     m.handling,
+		initialized:  m.initialized,
+		scopes:       append([]string(nil), m.scopes...),
+		timeout:      m.timeout,
+		signed:       m.signed,
+		strictArgs:   m.strictArgs,
+		doc:          m.doc,
+		args:         append([]reflect.Type(nil), m.args...),
+		result:       m.result,
+	}
+
+	if m.bucket != nil {
+		mc.bucket = ratelimit.NewBucketWithRate(m.bucket.Rate(), m.bucket.Capacity())
+	}
+
+	if m.cache != nil {
+		mc.cache = newMethodCache(m.cache.ttl, m.cache.maxEntries)
+	}
+
+	return mc
+}
+
 // DisableAuthentication disables authentication check for this method.
 func (m *Method) DisableAuthentication() *Method {
 	m.authenticate = false
 	return m
 }
 
+// StrictArgs makes the method unmarshal its arguments in strict mode:
+// fields unknown to the types they are unmarshaled into and values of
+// mismatched types fail the unmarshaling with a *dnode.FieldError, so
+// typos of callers do not silently become zero values.
+func (m *Method) StrictArgs() *Method {
+	m.strictArgs = true
+	return m
+}
+
+// RequireScope makes the method reject requests whose token is restricted
+// to scopes not including all of the given ones. Requests with
+// unrestricted credentials are not affected.
+func (m *Method) RequireScope(scopes ...string) *Method {
+	m.scopes = append(m.scopes, scopes...)
+	return m
+}
+
+// Timeout limits the execution time of the method. When the handler does
+// not return in time, its request context is canceled and the caller gets
+// a "timeout" error right away, without waiting for the handler.
+//
+// Handlers should watch Request.Ctx() to stop the abandoned work.
+func (m *Method) Timeout(d time.Duration) *Method {
+	m.timeout = d
+	return m
+}
+
 // Throttle throttles the method for each incoming request. The throttle
 // algorithm is based on token bucket implementation:
 // http://en.wikipedia.org/wiki/Token_bucket. Rate determines the number of
@@ -122,6 +243,32 @@ func (m *Method) Throttle(fillInterval time.Duration, capacity int64) *Method {
 	return m
 }
 
+// Cache enables caching of the method's results. Results are cached per
+// caller and arguments for the given ttl; at most maxEntries results are
+// kept, the least recently used ones are evicted first. Zero maxEntries
+// means no limit. Errors are never cached.
+//
+// Cache should only be used for read-only methods, whose result depends
+// solely on the caller and the arguments, like system info or directory
+// listings.
+func (m *Method) Cache(ttl time.Duration, maxEntries int) *Method {
+	// don't do anything if the cache is initialized already
+	if m.cache != nil {
+		return m
+	}
+
+	m.cache = newMethodCache(ttl, maxEntries)
+
+	return m
+}
+
+// PurgeCache drops all results cached for the method.
+func (m *Method) PurgeCache() {
+	if m.cache != nil {
+		m.cache.purge()
+	}
+}
+
 // PreHandler adds a new kite handler which is executed before the method.
 func (m *Method) PreHandle(handler Handler) *Method {
 	m.preHandlers = append(m.preHandlers, handler)
@@ -169,6 +316,48 @@ func (k *Kite) HandleFunc(method string, handler HandlerFunc) *Method {
 	return k.addHandle(method, handler)
 }
 
+// HandleID registers the handler for the method with the numeric ID,
+// which is called like dnode callbacks are, with an integer instead of
+// a method name. The method is named MethodID(id), which is the name
+// handlers see in Request.Method. IDs of such methods are never given
+// to callbacks sent by the kite, so the methods should be registered
+// before the kite starts serving.
+func (k *Kite) HandleID(id uint64, handler Handler) *Method {
+	return k.addHandle(MethodID(id), handler)
+}
+
+// HandleFuncID is the same as HandleID. It accepts a HandlerFunc.
+func (k *Kite) HandleFuncID(id uint64, handler HandlerFunc) *Method {
+	return k.addHandle(MethodID(id), handler)
+}
+
+// MethodID gives the name of the method with the numeric ID, see HandleID.
+// Calls of the name, e.g. Tell(MethodID(id)), are sent with the numeric
+// ID, so they round-trip through kites proxying calls by name.
+func MethodID(id uint64) string {
+	return "#" + strconv.FormatUint(id, 10)
+}
+
+// methodID gives the numeric ID of the method named by MethodID.
+func methodID(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, "#") {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(name[1:], 10, 64)
+	if err != nil || MethodID(id) != name {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// hasMethodID tells whether a method with the numeric ID is registered.
+func (k *Kite) hasMethodID(id uint64) bool {
+	_, ok := k.method(MethodID(id))
+	return ok
+}
+
 // PreHandle registers an handler which is executed before a kite.Handler
 // method is executed. Calling PreHandle multiple times registers multiple
 // handlers. A non-error return triggers the execution of the next handler. The
@@ -276,6 +465,65 @@ func (m *Method) ServeKite(r *Request) (interface{}, error) {
 	return m.final(r, resp, nil)
 }
 
+// serve calls the method, hitting the result cache first if enabled.
+func (m *Method) serve(r *Request) (interface{}, error) {
+	if m.cache != nil {
+		return m.cache.serve(m, r)
+	}
+
+	return m.ServeKite(r)
+}
+
+// serveWithTimeout calls serve and waits for the result until the request
+// context is done. The handler keeps running in the background after that,
+// its result is discarded.
+func (m *Method) serveWithTimeout(r *Request, serve func(*Request) (interface{}, error)) (interface{}, error) {
+	type result struct {
+		resp interface{}
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		// The handler runs in a separate goroutine, so panics are not
+		// recovered by runMethod.
+		defer func() {
+			if v := recover(); v != nil {
+				debug.PrintStack()
+				done <- result{err: createError(r, v)}
+			}
+		}()
+
+		resp, err := serve(r)
+		done <- result{resp, err}
+	}()
+
+	ctx := r.Ctx()
+
+	select {
+	case res := <-done:
+		return res.resp, res.err
+	case <-ctx.Done():
+	}
+
+	// The context is done also when the caller's deadline is exceeded
+	// or the caller disconnects.
+	deadline, _ := ctx.Deadline()
+	if ctx.Err() != context.DeadlineExceeded || (!r.Deadline.IsZero() && !deadline.Before(r.Deadline)) {
+		return nil, contextError(ctx, m.name)
+	}
+
+	HandlerTimeouts.Add(m.name, 1)
+	r.LocalKite.Log.Warning("%s handler did not finish in %s (%s)", m.name, m.timeout, r.ID)
+
+	return nil, &Error{
+		Type:      "timeout",
+		Message:   fmt.Sprintf("%s handler did not finish in %s", m.name, m.timeout),
+		RequestID: r.ID,
+	}
+}
+
 func (m *Method) final(r *Request, resp interface{}, err error) (interface{}, error) {
 	for _, f := range m.finalFuncs {
 		resp, err = f(r, resp, err)
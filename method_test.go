@@ -1,8 +1,13 @@
 package kite
 
 import (
+	"context"
 	"errors"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -245,3 +250,299 @@ func TestMethod_Base(t *testing.T) {
 	}
 
 }
+
+func TestMethod_Cache(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 10001
+
+	var calls int32
+
+	k.HandleFunc("foo", func(r *Request) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}).Cache(time.Minute, 1)
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient("http://127.0.0.1:10001/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		arg  string
+		want float64
+	}{
+		{"a", 1},
+		{"a", 1}, // cached
+		{"b", 2}, // evicts "a"
+		{"b", 2}, // cached
+		{"a", 3},
+	}
+
+	for i, cas := range cases {
+		result, err := c.TellWithTimeout("foo", 4*time.Second, cas.arg)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+
+		if got := result.MustFloat64(); got != cas.want {
+			t.Errorf("%d: got %v, want %v", i, got, cas.want)
+		}
+	}
+}
+
+func TestMethod_Deadline(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 10002
+
+	k.HandleFunc("slow", func(r *Request) (interface{}, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	})
+
+	k.HandleFunc("deadline", func(r *Request) (interface{}, error) {
+		if r.Deadline.IsZero() {
+			return nil, errors.New("no deadline")
+		}
+		return time.Until(r.Deadline).Seconds(), nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient("http://127.0.0.1:10002/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.TellWithTimeout("deadline", 4*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if left := result.MustFloat64(); left <= 0 || left > 4 {
+		t.Errorf("remaining deadline should be within (0, 4], got %v", left)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = c.TellWithContext(ctx, "slow")
+	if kErr, ok := err.(*Error); !ok || kErr.Type != "timeout" {
+		t.Fatalf("want timeout error, got %v", err)
+	}
+}
+
+func TestMethod_Timeout(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 10003
+
+	canceled := make(chan struct{})
+
+	k.HandleFunc("hung", func(r *Request) (interface{}, error) {
+		<-r.Ctx().Done()
+		close(canceled)
+		time.Sleep(time.Second) // ignores the cancellation
+		return "late", nil
+	}).Timeout(100 * time.Millisecond)
+
+	k.HandleFunc("fast", func(r *Request) (interface{}, error) {
+		return "ok", nil
+	}).Timeout(time.Second)
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient("http://127.0.0.1:10003/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := HandlerTimeouts.Get("hung").(*expvar.Int)
+
+	start := time.Now()
+
+	_, err := c.TellWithTimeout("hung", 4*time.Second)
+	if kErr, ok := err.(*Error); !ok || kErr.Type != "timeout" || kErr.RequestID == "" {
+		t.Fatalf("want timeout error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("want the error before the handler returns, got it after %s", elapsed)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("want the handler context to be canceled")
+	}
+
+	var n int64
+	if before != nil {
+		n = before.Value()
+	}
+
+	if after, _ := HandlerTimeouts.Get("hung").(*expvar.Int); after == nil || after.Value() != n+1 {
+		t.Fatalf("want timeout to be counted, got %v", after)
+	}
+
+	result, err := c.TellWithTimeout("fast", 4*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := result.MustString(); s != "ok" {
+		t.Fatalf("got %q, want %q", s, "ok")
+	}
+}
+
+func TestMethod_RegisterWhileServing(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	k.HandleFunc("foo", func(r *Request) (interface{}, error) {
+		return "foo", nil
+	})
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := New("exp", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			k.HandleFunc(fmt.Sprintf("bar%d", i), func(r *Request) (interface{}, error) {
+				return "bar", nil
+			})
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if _, err := c.Tell("foo"); err != nil {
+			t.Fatalf("%d: Tell()=%s", i, err)
+		}
+	}
+
+	<-done
+
+	if _, err := c.Tell("bar99"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+}
+
+func TestMethod_StrictArgs(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	handler := func(r *Request) (interface{}, error) {
+		var args struct {
+			Name string `json:"name"`
+		}
+
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return args.Name, nil
+	}
+
+	k.HandleFunc("strict", handler).StrictArgs()
+	k.HandleFunc("lax", handler)
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := New("exp", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	args := map[string]string{"nmae": "bob"}
+
+	if _, err := c.Tell("lax", args); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	_, err := c.Tell("strict", args)
+	if err == nil || !strings.Contains(err.Error(), "nmae: unknown field") {
+		t.Fatalf("got %v, want unknown field error", err)
+	}
+
+	result, err := c.Tell("strict", map[string]string{"name": "bob"})
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if name := result.MustString(); name != "bob" {
+		t.Fatalf("got %q, want %q", name, "bob")
+	}
+}
+
+func TestMethod_NumericID(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	k.HandleFuncID(0, func(r *Request) (interface{}, error) {
+		return r.Method + ":" + r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	// The client has the method with the same ID, so its callbacks,
+	// including the response one, must not be given the ID.
+	local := New("exp", "0.0.1")
+	local.HandleFuncID(0, func(r *Request) (interface{}, error) {
+		return nil, errors.New("unexpected call")
+	})
+
+	methods := make(chan interface{}, 1)
+	local.UseFrameFunc(func(f *Frame) error {
+		if f.Direction != Outgoing {
+			return nil
+		}
+
+		if m := frameMethod(f.Data); m == float64(0) || m == MethodID(0) {
+			methods <- m
+		}
+
+		return nil
+	})
+
+	c := local.NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.TellWithTimeout(MethodID(0), 4*time.Second, "hello")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if s := result.MustString(); s != "#0:hello" {
+		t.Fatalf("got %q, want %q", s, "#0:hello")
+	}
+
+	if m := <-methods; m != float64(0) {
+		t.Fatalf("got %#v method on the wire, want 0", m)
+	}
+
+	if _, ok := methodID("#01"); ok {
+		t.Fatal("want non-canonical ID rejected")
+	}
+}
@@ -0,0 +1,120 @@
+package kite
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// methodCache caches results of a method keyed by the caller identity and
+// the hash of the call arguments. The oldest entries are evicted when the
+// cache grows beyond its capacity.
+type methodCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List // front is most recently used
+}
+
+type methodCacheEntry struct {
+	key     string
+	result  interface{}
+	expires time.Time
+}
+
+func newMethodCache(ttl time.Duration, maxEntries int) *methodCache {
+	return &methodCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// key builds a cache key for the given request.
+func (mc *methodCache) key(r *Request) string {
+	h := sha1.New()
+	h.Write([]byte(r.Username))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	if r.Args != nil {
+		h.Write(r.Args.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (mc *methodCache) get(key string) (interface{}, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	e, ok := mc.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*methodCacheEntry)
+	if time.Now().After(entry.expires) {
+		mc.remove(e)
+		return nil, false
+	}
+
+	mc.lru.MoveToFront(e)
+
+	return entry.result, true
+}
+
+func (mc *methodCache) set(key string, result interface{}) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if e, ok := mc.items[key]; ok {
+		mc.remove(e)
+	}
+
+	mc.items[key] = mc.lru.PushFront(&methodCacheEntry{
+		key:     key,
+		result:  result,
+		expires: time.Now().Add(mc.ttl),
+	})
+
+	for mc.maxEntries > 0 && mc.lru.Len() > mc.maxEntries {
+		mc.remove(mc.lru.Back())
+	}
+}
+
+// purge drops all cached results.
+func (mc *methodCache) purge() {
+	mc.mu.Lock()
+	mc.items = make(map[string]*list.Element)
+	mc.lru.Init()
+	mc.mu.Unlock()
+}
+
+func (mc *methodCache) remove(e *list.Element) {
+	mc.lru.Remove(e)
+	delete(mc.items, e.Value.(*methodCacheEntry).key)
+}
+
+// serve returns a cached result for the request or calls the method and
+// caches its result on success. Errors are never cached.
+func (mc *methodCache) serve(m *Method, r *Request) (interface{}, error) {
+	key := mc.key(r)
+
+	if result, ok := mc.get(key); ok {
+		return result, nil
+	}
+
+	result, err := m.ServeKite(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mc.set(key, result)
+
+	return result, nil
+}
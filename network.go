@@ -0,0 +1,177 @@
+package kite
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultNetworkPollInterval is the time between checks of the addresses
+// of the local interfaces, if zero interval is passed to WatchNetwork.
+var DefaultNetworkPollInterval = 5 * time.Second
+
+var errNetworkChanged = errors.New("network changed")
+
+// NetworkChange describes a change of the network the kite runs in,
+// see OnNetworkChange.
+type NetworkChange struct {
+	// Added and Removed are the addresses of the local interfaces, which
+	// were assigned and unassigned since the last check.
+	Added   []net.IP
+	Removed []net.IP
+
+	// Resumed is true, when the host resumed from sleep. It is detected
+	// by the wall clock jumping ahead of the poll interval.
+	Resumed bool
+}
+
+// WatchNetwork checks the addresses of the local interfaces each interval,
+// until the returned function is called.
+//
+// After the addresses changed, e.g. on DHCP renewal, or the host resumed
+// from sleep, the reconnecting clients dialed by the kite, including the
+// Kontrol one, are redialed, as their connections may be stale, and the
+// OnNetworkChange callbacks are called. A kite registered with
+// RegisterToRegistry registers again with the updated URL.
+//
+// If interval is zero, DefaultNetworkPollInterval is used.
+func (k *Kite) WatchNetwork(interval time.Duration) (stop func()) {
+	if interval == 0 {
+		interval = DefaultNetworkPollInterval
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+
+	go k.watchNetwork(interval, done)
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (k *Kite) watchNetwork(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	addrs := localAddrs()
+	last := time.Now().Round(0) // strips monotonic clock reading
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		now := time.Now().Round(0)
+		cur := localAddrs()
+
+		change := &NetworkChange{
+			Resumed: now.Sub(last) > 2*interval+time.Second,
+		}
+		change.Added, change.Removed = diffAddrs(addrs, cur)
+
+		addrs, last = cur, now
+
+		if !change.Resumed && len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+
+		k.Log.Info("Network changed: added=%v removed=%v resumed=%t", change.Added, change.Removed, change.Resumed)
+
+		k.networkChanged(change)
+	}
+}
+
+// networkChanged redials the dialed clients and calls the OnNetworkChange
+// callbacks.
+func (k *Kite) networkChanged(change *NetworkChange) {
+	// Connections bound to a removed address are dead, the ones
+	// left behind during sleep are most likely dead too. Adding an
+	// address does not affect established connections.
+	if change.Resumed || len(change.Removed) != 0 {
+		k.mu.Lock()
+		clients := make([]*Client, 0, len(k.dialed))
+		for c := range k.dialed {
+			clients = append(clients, c)
+		}
+		k.mu.Unlock()
+
+		for _, c := range clients {
+			c.redial()
+		}
+	}
+
+	k.callOnNetworkChangeHandlers(change)
+}
+
+func (k *Kite) trackDialed(c *Client) {
+	k.mu.Lock()
+	if k.dialed == nil {
+		k.dialed = make(map[*Client]struct{})
+	}
+	k.dialed[c] = struct{}{}
+	k.mu.Unlock()
+}
+
+func (k *Kite) untrackDialed(c *Client) {
+	k.mu.Lock()
+	delete(k.dialed, c)
+	k.mu.Unlock()
+}
+
+// redial drops the session, so the client reconnects.
+func (c *Client) redial() {
+	session := c.getSession()
+	if session == nil {
+		return
+	}
+
+	c.logger().Info("Redialing %s after network change", c.URL)
+
+	// The readloop may already be interrupted, thus the non-blocking send.
+	select {
+	case c.interrupt <- errNetworkChanged:
+	default:
+	}
+
+	session.Close(3000, "network changed")
+}
+
+// localAddrs gives the sorted addresses of the local interfaces.
+func localAddrs() []string {
+	var addrs []string
+
+	for _, n := range localNetworks() {
+		addrs = append(addrs, n.IP.String())
+	}
+
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+// diffAddrs gives the addresses added to and removed from the sorted
+// old ones.
+func diffAddrs(old, cur []string) (added, removed []net.IP) {
+	i, j := 0, 0
+
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && old[i] < cur[j]):
+			removed = append(removed, net.ParseIP(old[i]))
+			i++
+		case i == len(old) || cur[j] < old[i]:
+			added = append(added, net.ParseIP(cur[j]))
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,85 @@
+package kite
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestDiffAddrs(t *testing.T) {
+	old := []string{"10.0.0.2", "192.168.1.5", "fe80::1"}
+	cur := []string{"10.0.0.2", "10.0.0.3", "fe80::1"}
+
+	added, removed := diffAddrs(old, cur)
+
+	if want := []net.IP{net.ParseIP("10.0.0.3")}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added: got %v, want %v", added, want)
+	}
+
+	if want := []net.IP{net.ParseIP("192.168.1.5")}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed: got %v, want %v", removed, want)
+	}
+}
+
+func TestNetworkChanged(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	server := NewWithConfig("server", "0.0.1", cfg)
+	server.HandleFunc("ping", func(r *Request) (interface{}, error) {
+		return "pong", nil
+	})
+	defer server.Close()
+
+	addr, err := server.Listen("tcp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	k := New("client", "0.0.1")
+
+	changes := make(chan *NetworkChange, 1)
+	k.OnNetworkChange(func(change *NetworkChange) {
+		changes <- change
+	})
+
+	c := k.NewClient(fmt.Sprintf("http://%s/kite", addr))
+	c.Reconnect = true
+
+	connected := make(chan struct{}, 2)
+	c.OnConnect(func() {
+		connected <- struct{}{}
+	})
+
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	<-connected
+
+	k.networkChanged(&NetworkChange{Resumed: true})
+
+	select {
+	case change := <-changes:
+		if !change.Resumed {
+			t.Fatalf("got %+v, want resumed change", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for network change callback")
+	}
+
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the client to reconnect")
+	}
+
+	if _, err := c.TellWithTimeout("ping", 5*time.Second); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+}
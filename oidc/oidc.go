@@ -0,0 +1,313 @@
+// Package oidc implements a kite authenticator, which validates OpenID
+// Connect ID tokens issued by third-party identity providers.
+//
+// It allows browsers authenticated against providers like Google or
+// Keycloak to call kites directly:
+//
+//	a := &oidc.Authenticator{
+//	    Issuers: []*oidc.Issuer{{
+//	        URL:       "https://accounts.google.com",
+//	        Audiences: []string{"my-client-id.apps.googleusercontent.com"},
+//	    }},
+//	}
+//
+//	k.Authenticators["oidc"] = a.Authenticate
+//
+// Clients send the ID token as the key of "oidc" authentication.
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+)
+
+// DefaultKeysTTL is the time fetched signing keys of an issuer are
+// used before they are fetched again.
+var DefaultKeysTTL = time.Hour
+
+// minRefresh is the minimum interval between fetching keys of a single
+// issuer, to not flood the provider with tokens signed with unknown keys.
+const minRefresh = 10 * time.Second
+
+// Issuer describes a trusted identity provider.
+type Issuer struct {
+	// URL is the issuer identifier, the value of the iss claim.
+	// The discovery document is fetched from
+	// URL + "/.well-known/openid-configuration".
+	//
+	// Required.
+	URL string
+
+	// Audiences lists client IDs the tokens must be issued for.
+	//
+	// Required.
+	Audiences []string
+
+	// UsernameClaim is the claim used as a kite username.
+	//
+	// If empty, "sub" is used.
+	UsernameClaim string
+
+	// UsernamePrefix is prepended to the username, e.g. "google:",
+	// to not clash with usernames of other issuers or kite users.
+	UsernamePrefix string
+
+	// ScopesClaim is the claim mapped to kite.Request.Scopes. The claim
+	// may be either a list of strings or a space-separated string.
+	//
+	// If empty, scopes are not mapped.
+	ScopesClaim string
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey // kid -> key
+	fetched time.Time
+}
+
+// Authenticator validates ID tokens issued by the configured issuers.
+type Authenticator struct {
+	// Issuers lists trusted identity providers.
+	Issuers []*Issuer
+
+	// Client is used to fetch discovery documents and signing keys.
+	//
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// KeysTTL is the time fetched signing keys are cached.
+	//
+	// If zero, DefaultKeysTTL is used.
+	KeysTTL time.Duration
+}
+
+// Authenticate is a kite authenticator, which validates the ID token given
+// as the authentication key and maps its claims to the request.
+func (a *Authenticator) Authenticate(r *kite.Request) error {
+	claims, iss, err := a.Verify(r.Auth.Key)
+	if err != nil {
+		return err
+	}
+
+	username, ok := claims[iss.usernameClaim()].(string)
+	if !ok || username == "" {
+		return fmt.Errorf("token has no %q claim", iss.usernameClaim())
+	}
+
+	r.Username = iss.UsernamePrefix + username
+
+	if iss.ScopesClaim != "" {
+		r.Scopes = stringList(claims[iss.ScopesClaim])
+	}
+
+	return nil
+}
+
+// Verify validates the given ID token and returns its claims together
+// with the issuer that signed it.
+func (a *Authenticator) Verify(idToken string) (jwt.MapClaims, *Issuer, error) {
+	var iss *Issuer
+
+	keyFn := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+
+		url, _ := claims["iss"].(string)
+		if iss = a.issuer(url); iss == nil {
+			return nil, fmt.Errorf("issuer is not trusted: %s", url)
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		return a.key(iss, kid)
+	}
+
+	token, err := jwt.Parse(idToken, keyFn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if !iss.audienceMatches(stringList(claims["aud"])) {
+		return nil, nil, errors.New("token was not issued for this audience")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, nil, errors.New("token has no expiration time")
+	}
+
+	return claims, iss, nil
+}
+
+func (a *Authenticator) issuer(url string) *Issuer {
+	for _, iss := range a.Issuers {
+		if iss.URL == url {
+			return iss
+		}
+	}
+
+	return nil
+}
+
+// key gives the signing key of the issuer with the given ID, fetching
+// keys if they are stale or the ID is not known.
+func (a *Authenticator) key(iss *Issuer, kid string) (*rsa.PublicKey, error) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	ttl := a.KeysTTL
+	if ttl == 0 {
+		ttl = DefaultKeysTTL
+	}
+
+	key, ok := iss.keys[kid]
+	stale := time.Since(iss.fetched) > ttl
+
+	if (!ok || stale) && time.Since(iss.fetched) > minRefresh {
+		keys, err := a.fetchKeys(iss.URL)
+		if err != nil {
+			if ok {
+				return key, nil // keep using known keys
+			}
+			return nil, err
+		}
+
+		iss.keys = keys
+		iss.fetched = time.Now()
+
+		key, ok = keys[kid]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	return key, nil
+}
+
+func (a *Authenticator) fetchKeys(issuer string) (map[string]*rsa.PublicKey, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	if err := a.get(url, &discovery); err != nil {
+		return nil, err
+	}
+
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document issuer mismatch: %q", discovery.Issuer)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := a.get(discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %s", k.Kid, err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %s", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func (a *Authenticator) get(url string, v interface{}) error {
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (iss *Issuer) usernameClaim() string {
+	if iss.UsernameClaim != "" {
+		return iss.UsernameClaim
+	}
+
+	return "sub"
+}
+
+func (iss *Issuer) audienceMatches(aud []string) bool {
+	for _, a := range aud {
+		for _, b := range iss.Audiences {
+			if a == b {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// stringList converts a claim, which is either a string or a list
+// of strings, to a slice. Space-separated strings are split.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,133 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/oidc"
+)
+
+func TestAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issuer string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer,
+			"jwks_uri": issuer + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	issuer = ts.URL
+
+	a := &oidc.Authenticator{
+		Issuers: []*oidc.Issuer{{
+			URL:            issuer,
+			Audiences:      []string{"client"},
+			UsernameClaim:  "email",
+			UsernamePrefix: "oidc:",
+			ScopesClaim:    "scope",
+		}},
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "key1"
+
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	cases := map[string]struct {
+		claims jwt.MapClaims
+		ok     bool
+	}{
+		"valid": {
+			jwt.MapClaims{"iss": issuer, "aud": "client", "exp": exp, "email": "john@example.com", "scope": "read write"},
+			true,
+		},
+		"audience list": {
+			jwt.MapClaims{"iss": issuer, "aud": []string{"other", "client"}, "exp": exp, "email": "john@example.com", "scope": "read write"},
+			true,
+		},
+		"wrong audience": {
+			jwt.MapClaims{"iss": issuer, "aud": "other", "exp": exp, "email": "john@example.com"},
+			false,
+		},
+		"untrusted issuer": {
+			jwt.MapClaims{"iss": "https://example.com", "aud": "client", "exp": exp, "email": "john@example.com"},
+			false,
+		},
+		"expired": {
+			jwt.MapClaims{"iss": issuer, "aud": "client", "exp": time.Now().Add(-time.Hour).Unix(), "email": "john@example.com"},
+			false,
+		},
+		"no username": {
+			jwt.MapClaims{"iss": issuer, "aud": "client", "exp": exp},
+			false,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &kite.Request{
+				Auth: &kite.Auth{Type: "oidc", Key: sign(cas.claims)},
+			}
+
+			err := a.Authenticate(r)
+			if !cas.ok {
+				if err == nil {
+					t.Fatal("expected Authenticate to fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate()=%s", err)
+			}
+
+			if r.Username != "oidc:john@example.com" {
+				t.Fatalf("got %q, want %q", r.Username, "oidc:john@example.com")
+			}
+
+			if want := []string{"read", "write"}; !reflect.DeepEqual(r.Scopes, want) {
+				t.Fatalf("got %v, want %v", r.Scopes, want)
+			}
+		})
+	}
+}
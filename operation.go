@@ -0,0 +1,645 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// OperationState describes a lifecycle stage of a long-running operation.
+type OperationState string
+
+const (
+	OperationRunning  OperationState = "running"
+	OperationDone     OperationState = "done"
+	OperationFailed   OperationState = "failed"
+	OperationCanceled OperationState = "canceled"
+)
+
+// operationRetention is the time a finished operation status is kept
+// in the store before it is deleted.
+const operationRetention = time.Hour
+
+// ErrOperationNotFound is returned by OperationStore when no operation
+// exists for the given ID.
+var ErrOperationNotFound = errors.New("operation not found")
+
+// OperationStatus is a snapshot of an operation, it is what is sent over
+// the wire in response to "kite.operationStatus" and to attached watchers.
+type OperationStatus struct {
+	ID       string         `json:"id"`
+	Method   string         `json:"method"`
+	Username string         `json:"username"`
+	State    OperationState `json:"state"`
+	Progress interface{}    `json:"progress,omitempty"`
+	Result   interface{}    `json:"result,omitempty"`
+	Error    *Error         `json:"error,omitempty"`
+	Started  time.Time      `json:"started"`
+	Updated  time.Time      `json:"updated"`
+}
+
+// Finished returns true when the operation is no longer running.
+func (s *OperationStatus) Finished() bool {
+	return s.State != OperationRunning
+}
+
+// OperationStore persists operation statuses, so they can be looked up
+// after the client that started them reconnects.
+//
+// A store must be safe for concurrent use.
+type OperationStore interface {
+	// Get retrieves the status of the operation with the given ID.
+	Get(id string) (*OperationStatus, error)
+
+	// Put inserts or updates the given operation status.
+	Put(status *OperationStatus) error
+
+	// Delete removes the operation with the given ID.
+	Delete(id string) error
+}
+
+// MemoryOperationStore is an in-memory OperationStore. It is used by
+// default when Kite.OperationStore is nil.
+type MemoryOperationStore struct {
+	mu  sync.Mutex
+	ops map[string]*OperationStatus
+}
+
+var _ OperationStore = (*MemoryOperationStore)(nil)
+
+// NewMemoryOperationStore gives new, empty in-memory operation store.
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{
+		ops: make(map[string]*OperationStatus),
+	}
+}
+
+// Get implements the OperationStore interface.
+func (m *MemoryOperationStore) Get(id string) (*OperationStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, ok := m.ops[id]
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+
+	statusCopy := *status
+	return &statusCopy, nil
+}
+
+// Put implements the OperationStore interface.
+func (m *MemoryOperationStore) Put(status *OperationStatus) error {
+	statusCopy := *status
+
+	m.mu.Lock()
+	m.ops[status.ID] = &statusCopy
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Delete implements the OperationStore interface.
+func (m *MemoryOperationStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.ops, id)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Operation is a handle of a running operation passed to an OperationFunc.
+type Operation struct {
+	// ID uniquely identifies the operation; it is returned to the caller
+	// of the method that started it.
+	ID string
+
+	// Request is the request that started the operation. The Client
+	// it references may get disconnected while the operation is running.
+	// Its context is the one of the operation, see Context.
+	Request *Request
+
+	k         *Kite
+	mu        sync.Mutex // protects status and watchers, serializes updates
+	status    OperationStatus
+	watchers  []dnode.Function
+	cancel    chan struct{}
+	once      sync.Once // for cancel
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+}
+
+// OperationFunc is a function that executes a long-running operation.
+// The returned result and error are stored as the final operation status.
+type OperationFunc func(*Operation) (result interface{}, err error)
+
+// Progress reports a progress of the operation. The value is stored in
+// the operation status and sent to all attached watchers. It is ignored
+// once the operation has finished.
+func (op *Operation) Progress(v interface{}) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.status.Finished() {
+		return
+	}
+
+	op.status.Progress = v
+	op.status.Updated = time.Now().UTC()
+
+	op.save()
+	op.notify()
+}
+
+// Canceled returns a channel that is closed when the operation was
+// canceled by the caller.
+func (op *Operation) Canceled() <-chan struct{} {
+	return op.cancel
+}
+
+// Context gives the context of the operation, which is canceled when the
+// operation is canceled by the caller or finishes. Unlike the context of
+// the request that started it, it is not canceled when the method starting
+// the operation returns.
+func (op *Operation) Context() context.Context {
+	return op.ctx
+}
+
+// abort cancels the operation.
+func (op *Operation) abort() {
+	op.once.Do(func() { close(op.cancel) })
+	op.cancelCtx()
+}
+
+// Status gives a snapshot of the current operation status.
+func (op *Operation) Status() *OperationStatus {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	statusCopy := op.status
+	return &statusCopy
+}
+
+// attach registers fn to be called with status updates. If the operation
+// has already finished, its final status was sent to the watchers, so fn
+// is not registered and the final status is returned instead.
+func (op *Operation) attach(fn dnode.Function) *OperationStatus {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.status.Finished() {
+		statusCopy := op.status
+		return &statusCopy
+	}
+
+	op.watchers = append(op.watchers, fn)
+	return nil
+}
+
+func (op *Operation) finish(result interface{}, err error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	switch {
+	case err != nil:
+		op.status.State = OperationFailed
+		op.status.Error = createError(op.Request, err)
+	default:
+		op.status.State = OperationDone
+		op.status.Result = result
+	}
+
+	select {
+	case <-op.cancel:
+		op.status.State = OperationCanceled
+	default:
+	}
+
+	op.status.Updated = time.Now().UTC()
+
+	op.save()
+	op.notify()
+}
+
+// save stores the current status.
+//
+// It must be called with op.mu held.
+func (op *Operation) save() {
+	status := op.status
+
+	if err := op.k.operationStore().Put(&status); err != nil {
+		op.k.Log.Error("operation %s: unable to store status: %s", op.ID, err)
+	}
+}
+
+// notify sends current status to all watchers; watchers that failed to
+// receive it (e.g. their connection went away) are detached, and all of
+// them once the operation has finished.
+//
+// It must be called with op.mu held, so watchers receive the updates
+// in order and none of them misses the final status.
+func (op *Operation) notify() {
+	status := op.status
+
+	alive := op.watchers[:0]
+	for _, fn := range op.watchers {
+		if err := fn.Call(&status); err != nil {
+			op.k.Log.Debug("operation %s: detaching watcher: %s", op.ID, err)
+			continue
+		}
+
+		alive = append(alive, fn)
+	}
+
+	if status.Finished() {
+		alive = nil
+	}
+
+	op.watchers = alive
+}
+
+// HandleOperation registers a method that starts a long-running operation.
+// A call to the method returns immediately with the operation ID, while
+// fn is executed in the background. The caller can poll the operation
+// status, cancel it or attach to it in order to receive progress updates,
+// also after a reconnect.
+func (k *Kite) HandleOperation(method string, fn OperationFunc) *Method {
+	return k.HandleFunc(method, func(r *Request) (interface{}, error) {
+		op := k.startOperation(r, fn)
+		return op.ID, nil
+	})
+}
+
+func (k *Kite) startOperation(r *Request, fn OperationFunc) *Operation {
+	now := time.Now().UTC()
+
+	// The context of the request is canceled once the method starting
+	// the operation returns, so the operation gets its own one.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req := *r
+	req.ctx = ctx
+
+	op := &Operation{
+		ID:        utils.RandomString(32),
+		Request:   &req,
+		k:         k,
+		cancel:    make(chan struct{}),
+		ctx:       ctx,
+		cancelCtx: cancel,
+		status: OperationStatus{
+			Method:   r.Method,
+			Username: r.Username,
+			State:    OperationRunning,
+			Started:  now,
+			Updated:  now,
+		},
+	}
+	op.status.ID = op.ID
+
+	// Saved before the operation is looked up by others, so op.mu is not needed.
+	op.save()
+
+	k.operationsMu.Lock()
+	k.operations[op.ID] = op
+	k.operationsMu.Unlock()
+
+	go func() {
+		defer func() {
+			k.operationsMu.Lock()
+			delete(k.operations, op.ID)
+			k.operationsMu.Unlock()
+		}()
+
+		result, err := func() (result interface{}, err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = fmt.Errorf("operation panicked: %v", v)
+				}
+			}()
+
+			return fn(op)
+		}()
+
+		op.finish(result, err)
+		op.cancelCtx()
+
+		time.AfterFunc(operationRetention, func() {
+			if err := k.operationStore().Delete(op.ID); err != nil {
+				k.Log.Error("operation %s: unable to delete status: %s", op.ID, err)
+			}
+		})
+	}()
+
+	return op
+}
+
+func (k *Kite) operationStore() OperationStore {
+	if k.OperationStore != nil {
+		return k.OperationStore
+	}
+
+	return k.defaultOperationStore
+}
+
+func (k *Kite) runningOperation(id string) *Operation {
+	k.operationsMu.Lock()
+	defer k.operationsMu.Unlock()
+
+	return k.operations[id]
+}
+
+// operationStatus looks up the operation status and ensures it belongs
+// to the requester.
+func (k *Kite) operationStatus(r *Request, id string) (*OperationStatus, error) {
+	status, err := k.operationStore().Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Username != r.Username {
+		return nil, ErrOperationNotFound
+	}
+
+	return status, nil
+}
+
+type operationArgs struct {
+	ID       string         `json:"id"`
+	Progress dnode.Function `json:"progress"`
+}
+
+func newOperationArgs(r *Request) (*operationArgs, error) {
+	var args operationArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ID == "" {
+		return nil, errors.New("empty operation id")
+	}
+
+	return &args, nil
+}
+
+// handleOperationStatus returns the current status of an operation.
+func (k *Kite) handleOperationStatus(r *Request) (interface{}, error) {
+	args, err := newOperationArgs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.operationStatus(r, args.ID)
+}
+
+// handleOperationCancel requests cancellation of a running operation.
+func (k *Kite) handleOperationCancel(r *Request) (interface{}, error) {
+	args, err := newOperationArgs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := k.operationStatus(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if op := k.runningOperation(args.ID); op != nil {
+		op.abort()
+	}
+
+	return status, nil
+}
+
+// handleOperationAttach registers progress callback for the operation,
+// which is called with the status on every update until the operation
+// finishes.
+func (k *Kite) handleOperationAttach(r *Request) (interface{}, error) {
+	args, err := newOperationArgs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !args.Progress.IsValid() {
+		return nil, errors.New("progress callback is missing")
+	}
+
+	status, err := k.operationStatus(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if op := k.runningOperation(args.ID); op != nil && !status.Finished() {
+		// The operation may have finished since its status was looked up.
+		if final := op.attach(args.Progress); final != nil {
+			return final, nil
+		}
+	}
+
+	return status, nil
+}
+
+// OperationHandle is a client-side reference to a long-running operation
+// started on a remote kite.
+//
+// The handle stays valid across reconnects of the Client - the operation
+// is identified solely by its ID.
+type OperationHandle struct {
+	ID     string
+	Client *Client
+}
+
+// StartOperation calls a method registered with HandleOperation on the
+// remote kite and returns a handle to the started operation.
+func (c *Client) StartOperation(method string, args ...interface{}) (*OperationHandle, error) {
+	result, err := c.TellWithTimeout(method, c.LocalKite.CallTimeout(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.String()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Operation(id), nil
+}
+
+// Operation gives a handle to a remote operation with the given ID. It
+// can be used to re-attach to an operation after a disconnect.
+func (c *Client) Operation(id string) *OperationHandle {
+	return &OperationHandle{
+		ID:     id,
+		Client: c,
+	}
+}
+
+// Status gets the current status of the operation.
+func (h *OperationHandle) Status() (*OperationStatus, error) {
+	return h.tell(context.Background(), "kite.operationStatus", dnode.Function{})
+}
+
+// Cancel requests cancellation of the operation.
+func (h *OperationHandle) Cancel() error {
+	_, err := h.tell(context.Background(), "kite.operationCancel", dnode.Function{})
+	return err
+}
+
+// Attach registers fn to be called with every status update of the
+// operation. The returned status is the one at the time of attaching;
+// if it is already finished, fn is never called.
+//
+// The callback is removed from the Client once the operation finishes.
+// Attach needs to be called again after the Client reconnects.
+func (h *OperationHandle) Attach(fn func(*OperationStatus)) (*OperationStatus, error) {
+	status, _, err := h.attach(fn)
+	return status, err
+}
+
+// attach registers fn like Attach does; the returned func removes
+// the callback from the Client before the operation finishes.
+func (h *OperationHandle) attach(fn func(*OperationStatus)) (*OperationStatus, func(), error) {
+	var (
+		mu        sync.Mutex
+		callbacks map[string]dnode.Path
+		released  bool
+	)
+
+	release := func() {
+		mu.Lock()
+		cbs := callbacks
+		callbacks, released = nil, true
+		mu.Unlock()
+
+		h.Client.removeCallbacks(cbs)
+	}
+
+	// The final status may be received before the call returns, then
+	// the callback is removed as soon as it is known.
+	ctx := withCallbacks(context.Background(), func(cbs map[string]dnode.Path) {
+		cbs = progressCallbacks(cbs)
+
+		mu.Lock()
+		if !released {
+			callbacks, cbs = cbs, nil
+		}
+		mu.Unlock()
+
+		h.Client.removeCallbacks(cbs)
+	})
+
+	progress := dnode.Callback(func(arg *dnode.Partial) {
+		var status OperationStatus
+
+		if err := arg.One().Unmarshal(&status); err != nil {
+			h.Client.LocalKite.Log.Error("operation %s: invalid status: %s", h.ID, err)
+			return
+		}
+
+		if status.Finished() {
+			release()
+		}
+
+		fn(&status)
+	})
+
+	status, err := h.tell(ctx, "kite.operationAttach", progress)
+	if err != nil || status.Finished() {
+		release()
+	}
+
+	return status, release, err
+}
+
+// progressCallbacks gives the progress callback of operationArgs among
+// the callbacks sent by a call; the response callback is removed by
+// the Client itself.
+func progressCallbacks(callbacks map[string]dnode.Path) map[string]dnode.Path {
+	progress := make(map[string]dnode.Path)
+
+	for id, path := range callbacks {
+		if len(path) != 0 && path[len(path)-1] == "progress" {
+			progress[id] = path
+		}
+	}
+
+	return progress
+}
+
+// Wait blocks until the operation finishes, the timeout is reached or
+// the Client disconnects. Zero timeout means no timeout.
+func (h *OperationHandle) Wait(timeout time.Duration) (*OperationStatus, error) {
+	done := make(chan *OperationStatus, 1)
+
+	h.Client.disconnectMu.Lock()
+	disconnect := h.Client.disconnect
+	h.Client.disconnectMu.Unlock()
+
+	status, release, err := h.attach(func(s *OperationStatus) {
+		if s.Finished() {
+			select {
+			case done <- s:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if status.Finished() {
+		return status, nil
+	}
+
+	var afterTimeout <-chan time.Time
+	if timeout > 0 {
+		afterTimeout = time.After(timeout)
+	}
+
+	select {
+	case status := <-done:
+		return status, nil
+	case <-disconnect:
+		return nil, &Error{
+			Type:    "disconnect",
+			Message: fmt.Sprintf("remote kite has disconnected while waiting for operation %s", h.ID),
+		}
+	case <-afterTimeout:
+		return nil, &Error{
+			Type:    "timeout",
+			Message: fmt.Sprintf("operation %s did not finish in %s", h.ID, timeout),
+		}
+	}
+}
+
+func (h *OperationHandle) tell(ctx context.Context, method string, progress dnode.Function) (*OperationStatus, error) {
+	args := &operationArgs{
+		ID:       h.ID,
+		Progress: progress,
+	}
+
+	if timeout := h.Client.LocalKite.CallTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := h.Client.TellWithContext(ctx, method, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var status OperationStatus
+	if err := result.Unmarshal(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
@@ -0,0 +1,340 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestOperation(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("operation-server", "0.0.1", cfg)
+
+	proceed := make(chan struct{})
+
+	srv.HandleOperation("count", func(op *Operation) (interface{}, error) {
+		var n int
+
+		if err := op.Request.Args.One().Unmarshal(&n); err != nil {
+			return nil, err
+		}
+
+		<-proceed
+
+		for i := 0; i < n; i++ {
+			op.Progress(i)
+		}
+
+		return n, nil
+	})
+
+	srv.HandleOperation("block", func(op *Operation) (interface{}, error) {
+		<-op.Canceled()
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("operation-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	h, err := c.StartOperation("count", 3)
+	if err != nil {
+		t.Fatalf("StartOperation()=%s", err)
+	}
+
+	status, err := h.Status()
+	if err != nil {
+		t.Fatalf("Status()=%s", err)
+	}
+
+	if status.State != OperationRunning {
+		t.Fatalf("got %q, want %q", status.State, OperationRunning)
+	}
+
+	progress := make(chan *OperationStatus, 10)
+
+	if _, err := h.Attach(func(s *OperationStatus) { progress <- s }); err != nil {
+		t.Fatalf("Attach()=%s", err)
+	}
+
+	close(proceed)
+
+	status, err = c.Operation(h.ID).Wait(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Wait()=%s", err)
+	}
+
+	if status.State != OperationDone {
+		t.Fatalf("got %q, want %q", status.State, OperationDone)
+	}
+
+	if n, ok := status.Result.(float64); !ok || n != 3 {
+		t.Fatalf("got %v, want 3", status.Result)
+	}
+
+	if len(progress) == 0 {
+		t.Fatal("no progress updates received")
+	}
+
+	h, err = c.StartOperation("block")
+	if err != nil {
+		t.Fatalf("StartOperation()=%s", err)
+	}
+
+	if err := h.Cancel(); err != nil {
+		t.Fatalf("Cancel()=%s", err)
+	}
+
+	status, err = h.Wait(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Wait()=%s", err)
+	}
+
+	if status.State != OperationCanceled {
+		t.Fatalf("got %q, want %q", status.State, OperationCanceled)
+	}
+}
+
+func TestOperation_AttachFinished(t *testing.T) {
+	op := &Operation{
+		ID: "op",
+		status: OperationStatus{
+			ID:    "op",
+			State: OperationRunning,
+		},
+	}
+
+	if final := op.attach(dnode.Function{}); final != nil {
+		t.Fatalf("got final status %+v for a running operation", final)
+	}
+
+	// The operation finishes between the status lookup and attaching.
+	op.status.State = OperationDone
+	op.status.Result = 3
+
+	final := op.attach(dnode.Function{})
+	if final == nil || final.State != OperationDone || final.Result != 3 {
+		t.Fatalf("got %+v, want the final status", final)
+	}
+
+	if len(op.watchers) != 1 {
+		t.Fatalf("got %d watchers, want 1", len(op.watchers))
+	}
+}
+
+func TestOperation_Context(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("operation-server", "0.0.1", cfg)
+
+	started := make(chan error, 1)
+
+	srv.HandleOperation("wait", func(op *Operation) (interface{}, error) {
+		// Give the method starting the operation time to return.
+		time.Sleep(100 * time.Millisecond)
+
+		started <- op.Request.Ctx().Err()
+
+		<-op.Context().Done()
+		return nil, op.Context().Err()
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("operation-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	h, err := c.StartOperation("wait")
+	if err != nil {
+		t.Fatalf("StartOperation()=%s", err)
+	}
+
+	if err := <-started; err != nil {
+		t.Fatalf("context canceled after the operation started: %s", err)
+	}
+
+	if err := h.Cancel(); err != nil {
+		t.Fatalf("Cancel()=%s", err)
+	}
+
+	status, err := h.Wait(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Wait()=%s", err)
+	}
+
+	if status.State != OperationCanceled {
+		t.Fatalf("got %q, want %q", status.State, OperationCanceled)
+	}
+}
+
+func TestOperation_FinishDuringProgress(t *testing.T) {
+	op := &Operation{
+		ID: "op",
+		k:  New("operation-server", "0.0.1"),
+		status: OperationStatus{
+			ID:    "op",
+			State: OperationRunning,
+		},
+		cancel: make(chan struct{}),
+	}
+
+	final := make(chan *OperationStatus, 1)
+	finished := make(chan struct{})
+
+	op.attach(dnode.Callback(func(arg *dnode.Partial) {
+		var status OperationStatus
+
+		if err := arg.One().Unmarshal(&status); err != nil {
+			t.Errorf("Unmarshal()=%s", err)
+			return
+		}
+
+		if status.Finished() {
+			final <- &status
+			return
+		}
+
+		// The operation finishes while the progress is being sent.
+		go func() {
+			op.finish(3, nil)
+			close(finished)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+	}))
+
+	op.Progress(1)
+	<-finished
+
+	select {
+	case status := <-final:
+		if status.State != OperationDone {
+			t.Fatalf("got %q, want %q", status.State, OperationDone)
+		}
+	default:
+		t.Fatal("watcher missed the final status")
+	}
+
+	if len(op.watchers) != 0 {
+		t.Fatalf("got %d watchers, want none after finish", len(op.watchers))
+	}
+}
+
+func TestOperation_WaitDisconnect(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("operation-server", "0.0.1", cfg)
+
+	srv.HandleOperation("block", func(op *Operation) (interface{}, error) {
+		<-op.Canceled()
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("operation-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	h, err := c.StartOperation("block")
+	if err != nil {
+		t.Fatalf("StartOperation()=%s", err)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := h.Wait(0)
+		done <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	for _, conn := range srv.Connections() {
+		if err := srv.Disconnect(conn.ID); err != nil {
+			t.Fatalf("Disconnect()=%s", err)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if e, ok := err.(*Error); !ok || e.Type != "disconnect" {
+			t.Fatalf("got %v, want disconnect error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not return after disconnect")
+	}
+}
+
+func TestOperation_AttachRemovesCallback(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("operation-server", "0.0.1", cfg)
+
+	proceed := make(chan struct{})
+
+	srv.HandleOperation("wait", func(op *Operation) (interface{}, error) {
+		<-proceed
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("operation-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	h, err := c.StartOperation("wait")
+	if err != nil {
+		t.Fatalf("StartOperation()=%s", err)
+	}
+
+	final := make(chan *OperationStatus, 1)
+
+	if _, err := h.Attach(func(s *OperationStatus) {
+		if s.Finished() {
+			final <- s
+		}
+	}); err != nil {
+		t.Fatalf("Attach()=%s", err)
+	}
+
+	close(proceed)
+
+	select {
+	case <-final:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no final status received")
+	}
+
+	// Callback IDs are given sequentially: 0 to the response callback of
+	// the "wait" call, 1 to the one of kite.operationAttach and 2 to the
+	// progress callback.
+	if c.scrubber.GetCallback(2) != nil {
+		t.Fatal("progress callback was not removed")
+	}
+}
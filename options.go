@@ -0,0 +1,141 @@
+package kite
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+// Codec encodes and decodes messages exchanged with a remote kite.
+//
+// Arguments of the messages are always decoded as JSON, thus the codec
+// must produce JSON. It is meant for plugging in alternative JSON
+// implementations, see the conformance package for testing them.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// jsonCodec is the default codec using the encoding/json package.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// ClientOption configures a Client, see Kite.NewClient and Dial.
+type ClientOption func(*Client)
+
+// WithTimeout sets the default timeout of the client. It is used when
+// dialing and for calls made without a timeout, e.g. with Tell or with
+// TellWithContext and a context without a deadline.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithAuth sets the credential used to authenticate with the remote kite.
+func WithAuth(auth *Auth) ClientOption {
+	return func(c *Client) {
+		c.Auth = auth
+	}
+}
+
+// WithCodec sets the codec used to encode and decode messages.
+//
+// By default the encoding/json package is used.
+func WithCodec(codec Codec) ClientOption {
+	return func(c *Client) {
+		c.enc = codec
+	}
+}
+
+// WithReconnect makes the client redial the remote kite, when the
+// connection is lost.
+func WithReconnect(reconnect bool) ClientOption {
+	return func(c *Client) {
+		c.Reconnect = reconnect
+	}
+}
+
+// WithLogger sets the logger used by the client.
+//
+// By default the logger of the local kite is used.
+func WithLogger(log Logger) ClientOption {
+	return func(c *Client) {
+		c.log = log
+	}
+}
+
+// WithConfig sets the configuration used when connecting to
+// the remote kite.
+//
+// By default the configuration of the local kite is used.
+func WithConfig(cfg *config.Config) ClientOption {
+	return func(c *Client) {
+		c.Config = cfg
+	}
+}
+
+// Dial connects to the kite at the given URL with a client owned by an
+// anonymous local kite, so no setup is needed for making calls:
+//
+//	c, err := kite.Dial("http://localhost:3636", kite.WithTimeout(10*time.Second))
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	result, err := c.Tell("square", 4)
+//
+// The URL path defaults to "/kite". The client authenticates with the
+// kite.key of the user, if there is one and WithAuth is not used.
+func Dial(remoteURL string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/kite"
+	}
+
+	cfg, err := config.Get()
+	if err != nil {
+		// No kite.key, connect without authentication.
+		cfg = config.New()
+	}
+
+	k := NewWithConfig("client", "0.0.1", cfg)
+
+	if key := k.KiteKey(); key != "" {
+		opts = append([]ClientOption{WithAuth(&Auth{Type: "kiteKey", Key: key})}, opts...)
+	}
+
+	c := k.NewClient(u.String(), opts...)
+
+	if err := c.Dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) codec() Codec {
+	if c.enc != nil {
+		return c.enc
+	}
+
+	return jsonCodec{}
+}
+
+func (c *Client) logger() Logger {
+	if c.log != nil {
+		return c.log
+	}
+
+	return c.LocalKite.Log
+}
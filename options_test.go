@@ -0,0 +1,72 @@
+package kite
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+type countingCodec struct {
+	jsonCodec
+	marshaled int32
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&c.marshaled, 1)
+	return c.jsonCodec.Marshal(v)
+}
+
+func TestDial(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("options-server", "0.0.1", cfg)
+	srv.HandleFunc("square", func(r *Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+	srv.HandleFunc("slow", func(r *Request) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	codec := &countingCodec{}
+
+	c, err := Dial(ts.URL, WithTimeout(200*time.Millisecond), WithCodec(codec), WithReconnect(true))
+	if err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if c.URL != ts.URL+"/kite" {
+		t.Fatalf("got %q, want %q", c.URL, ts.URL+"/kite")
+	}
+
+	if !c.Reconnect {
+		t.Fatal("want client to reconnect")
+	}
+
+	result, err := c.Tell("square", 4)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustFloat64(); got != 16 {
+		t.Fatalf("got %v, want 16", got)
+	}
+
+	if atomic.LoadInt32(&codec.marshaled) == 0 {
+		t.Fatal("want messages to be encoded with the codec")
+	}
+
+	_, err = c.Tell("slow")
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("got %v, want timeout error", err)
+	}
+}
@@ -0,0 +1,458 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultRetryInterval is the time the Outbox waits before re-sending
+// pending messages after a failed attempt.
+var DefaultRetryInterval = 5 * time.Second
+
+// ErrOutboxClosed is returned by Outbox.Send when the outbox was closed.
+var ErrOutboxClosed = errors.New("outbox is closed")
+
+// OutboxMessage is a method call persisted by the Outbox until
+// it is acknowledged by the remote kite.
+type OutboxMessage struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	Args      []json.RawMessage `json:"args"`
+	Created   time.Time         `json:"created"`
+	NotBefore time.Time         `json:"notBefore,omitempty"` // see Outbox.SendAt
+	Expires   time.Time         `json:"expires,omitempty"`
+	Attempts  int               `json:"attempts"`
+
+	// Query selects connections the message is pushed to,
+	// see PushScheduler.
+	Query *ConnectionQuery `json:"query,omitempty"`
+}
+
+// due gives the time the message should be delivered at.
+func (msg *OutboxMessage) due() time.Time {
+	if msg.NotBefore.After(msg.Created) {
+		return msg.NotBefore
+	}
+
+	return msg.Created
+}
+
+// newOutboxMessage gives new message with JSON-encoded args.
+func newOutboxMessage(method string, args []interface{}) (*OutboxMessage, error) {
+	msg := &OutboxMessage{
+		ID:      uuid.NewV4().String(),
+		Method:  method,
+		Args:    make([]json.RawMessage, len(args)),
+		Created: time.Now().UTC(),
+	}
+
+	for i, arg := range args {
+		p, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Args[i] = p
+	}
+
+	return msg, nil
+}
+
+// OutboxStore persists messages of an Outbox. Using a store backed by
+// local disk lets pending messages survive crashes of the kite.
+type OutboxStore interface {
+	// Put stores the message, replacing the one with the same ID.
+	Put(msg *OutboxMessage) error
+
+	// Delete removes the message with the given ID.
+	Delete(id string) error
+
+	// List gives all stored messages.
+	List() ([]*OutboxMessage, error)
+}
+
+// Outbox delivers method calls to a remote kite at least once.
+//
+// Each call is persisted to the Store before it is sent and re-sent after
+// reconnects, failures or restarts until the remote kite acknowledges it
+// by responding. Calls are sent one at a time, in the order they were
+// made, or scheduled for with SendAt.
+//
+// Since a message may be delivered more than once, handlers of the remote
+// kite should be idempotent. Each call carries the message ID, so the remote
+// kite can skip duplicates by setting Kite.DedupStore.
+type Outbox struct {
+	// Client is connected to the remote kite the messages are sent to.
+	//
+	// Required.
+	Client *Client
+
+	// Store persists pending messages.
+	//
+	// Required.
+	Store OutboxStore
+
+	// RetryInterval is the time to wait before re-sending messages
+	// after a failed attempt. A longer time is waited, if the remote
+	// kite asks for it, see RetryAfter.
+	//
+	// If zero, DefaultRetryInterval is used.
+	RetryInterval time.Duration
+
+	// Timeout is the time to wait for the remote kite to acknowledge
+	// a single message.
+	//
+	// If zero, Client.LocalKite.Config.Timeout is used.
+	Timeout time.Duration
+
+	// TTL is the time a message may be delivered after it was sent.
+	// The expiry is sent along with the message, so the remote kite does
+	// not run it when it arrives late, see WithExpiry. Messages, which
+	// were not delivered in time, are removed from the store and passed
+	// to OnFailure with ErrMessageExpired.
+	//
+	// If zero, messages do not expire.
+	TTL time.Duration
+
+	// OnFailure, when non-nil, is called when the remote kite rejects
+	// a message with a non-retryable error, e.g. the method is not found
+	// or its handler returned an error. Such message is removed from
+	// the store.
+	OnFailure func(msg *OutboxMessage, err error)
+
+	once   sync.Once
+	mu     sync.Mutex
+	closed bool
+	notify chan struct{}
+	closeC chan struct{}
+}
+
+// NewOutbox gives new outbox delivering messages to the given client.
+func NewOutbox(c *Client, store OutboxStore) *Outbox {
+	return &Outbox{
+		Client: c,
+		Store:  store,
+	}
+}
+
+func (o *Outbox) init() {
+	o.once.Do(func() {
+		o.notify = make(chan struct{}, 1)
+		o.closeC = make(chan struct{})
+	})
+}
+
+// Start starts delivering pending messages, including the ones persisted
+// before the kite was restarted. The delivery is retried each time the
+// client connects to the remote kite.
+func (o *Outbox) Start() {
+	o.init()
+
+	o.Client.OnConnect(o.wakeup)
+
+	go o.run()
+
+	o.wakeup()
+}
+
+// Send persists the method call and schedules it for delivery. It returns
+// the ID of the message once it is stored.
+//
+// The arguments are persisted JSON-encoded, thus they must not contain
+// callbacks.
+func (o *Outbox) Send(method string, args ...interface{}) (string, error) {
+	return o.SendAt(time.Time{}, method, args...)
+}
+
+// SendAfter is like Send, but the call is not sent before the delay
+// elapses.
+func (o *Outbox) SendAfter(d time.Duration, method string, args ...interface{}) (string, error) {
+	return o.SendAt(time.Now().Add(d), method, args...)
+}
+
+// SendAt is like Send, but the call is not sent before the given time,
+// e.g. for reminders or deferred commands. The time is persisted along
+// with the message, so the call is sent on time after restarts too.
+//
+// The TTL of the message counts from the given time.
+func (o *Outbox) SendAt(t time.Time, method string, args ...interface{}) (string, error) {
+	o.init()
+
+	msg, err := newOutboxMessage(method, args)
+	if err != nil {
+		return "", err
+	}
+
+	if t.After(msg.Created) {
+		msg.NotBefore = t.UTC()
+	}
+
+	if o.TTL != 0 {
+		msg.Expires = msg.due().Add(o.TTL)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return "", ErrOutboxClosed
+	}
+
+	if err := o.Store.Put(msg); err != nil {
+		return "", err
+	}
+
+	o.wakeup()
+
+	return msg.ID, nil
+}
+
+// Cancel removes the pending message with the given ID, e.g. a call
+// scheduled with SendAt, which is no longer needed.
+func (o *Outbox) Cancel(id string) error {
+	return o.Store.Delete(id)
+}
+
+// Pending gives messages which were not acknowledged yet, ordered
+// by the time they are to be sent.
+func (o *Outbox) Pending() ([]*OutboxMessage, error) {
+	return pendingMessages(o.Store)
+}
+
+func pendingMessages(store OutboxStore) ([]*OutboxMessage, error) {
+	msgs, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].due().Before(msgs[j].due())
+	})
+
+	return msgs, nil
+}
+
+// Close stops the delivery. Pending messages are kept in the store
+// and are delivered after the outbox is started again.
+func (o *Outbox) Close() {
+	o.init()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.closed {
+		o.closed = true
+		close(o.closeC)
+	}
+}
+
+func (o *Outbox) wakeup() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run() {
+	var retry <-chan time.Time
+	var timer *time.Timer
+
+	for {
+		var scheduled <-chan time.Time
+		if timer != nil {
+			scheduled = timer.C
+		}
+
+		select {
+		case <-o.closeC:
+			return
+		case <-o.notify:
+		case <-retry:
+		case <-scheduled:
+		}
+
+		retry = nil
+
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+
+		next, err := o.flush()
+		if err != nil {
+			o.Client.LocalKite.Log.Debug("outbox: delivery to %s failed: %s", o.Client.URL, err)
+
+			retry = time.After(o.retryDelay(err))
+		} else if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(time.Now()))
+		}
+	}
+}
+
+// flush sends pending messages until all of them, which are due, are
+// acknowledged or a retryable error occurs. It gives the time the next
+// scheduled message is due at.
+func (o *Outbox) flush() (time.Time, error) {
+	msgs, err := o.Pending()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, msg := range msgs {
+		select {
+		case <-o.closeC:
+			return time.Time{}, nil
+		default:
+		}
+
+		if due := msg.due(); due.After(time.Now()) {
+			return due, nil
+		}
+
+		err := ErrMessageExpired
+
+		if msg.Expires.IsZero() || time.Now().Before(msg.Expires) {
+			if err = o.send(msg); err != nil && isRetryable(err) {
+				return time.Time{}, err
+			}
+		}
+
+		if err := o.Store.Delete(msg.ID); err != nil {
+			return time.Time{}, err
+		}
+
+		if err != nil && o.OnFailure != nil {
+			func() {
+				defer nopRecover()
+				o.OnFailure(msg, err)
+			}()
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// send makes an attempt to deliver the message.
+func (o *Outbox) send(msg *OutboxMessage) error {
+	msg.Attempts++
+
+	if err := o.Store.Put(msg); err != nil {
+		return err
+	}
+
+	args := make([]interface{}, len(msg.Args))
+	for i, arg := range msg.Args {
+		args[i] = arg
+	}
+
+	ctx := WithMessageID(context.Background(), msg.ID)
+	if !msg.Expires.IsZero() {
+		ctx = WithExpiry(ctx, msg.Expires)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeout())
+	defer cancel()
+
+	_, err := o.Client.TellWithContext(ctx, msg.Method, args...)
+	return err
+}
+
+func (o *Outbox) retryInterval() time.Duration {
+	if o.RetryInterval != 0 {
+		return o.RetryInterval
+	}
+
+	return DefaultRetryInterval
+}
+
+// retryDelay gives the time to wait before retrying the delivery failed
+// with err, respecting the retry hint sent by the remote kite.
+func (o *Outbox) retryDelay(err error) time.Duration {
+	d := o.retryInterval()
+
+	if hint := RetryAfter(err); hint > d {
+		return hint
+	}
+
+	return d
+}
+
+func (o *Outbox) timeout() time.Duration {
+	if o.Timeout != 0 {
+		return o.Timeout
+	}
+
+	return o.Client.LocalKite.CallTimeout()
+}
+
+// isRetryable tells whether the call failed before the remote kite
+// could process it.
+func isRetryable(err error) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return true
+	}
+
+	switch e.Type {
+	case "sendError", "disconnect", "timeout", "requestLimitError", "overloaded", "authenticationError":
+		return true
+	default:
+		return false
+	}
+}
+
+// MemoryOutboxStore is an in-memory OutboxStore. Pending messages are lost
+// when the kite is restarted.
+type MemoryOutboxStore struct {
+	mu   sync.Mutex
+	msgs map[string]*OutboxMessage
+}
+
+var _ OutboxStore = (*MemoryOutboxStore)(nil)
+
+// NewMemoryOutboxStore gives new in-memory outbox store.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{
+		msgs: make(map[string]*OutboxMessage),
+	}
+}
+
+// Put implements the OutboxStore interface.
+func (m *MemoryOutboxStore) Put(msg *OutboxMessage) error {
+	msgCopy := *msg
+
+	m.mu.Lock()
+	m.msgs[msg.ID] = &msgCopy
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Delete implements the OutboxStore interface.
+func (m *MemoryOutboxStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.msgs, id)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// List implements the OutboxStore interface.
+func (m *MemoryOutboxStore) List() ([]*OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msgs := make([]*OutboxMessage, 0, len(m.msgs))
+	for _, msg := range m.msgs {
+		msgCopy := *msg
+		msgs = append(msgs, &msgCopy)
+	}
+
+	return msgs, nil
+}
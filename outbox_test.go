@@ -0,0 +1,85 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestOutbox(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var calls int32
+	delivered := make(chan string, 4)
+
+	srv := NewWithConfig("outbox-server", "0.0.1", cfg)
+	srv.HandleFunc("command", func(r *Request) (interface{}, error) {
+		// Do not respond in time to the first attempt, so it is retried.
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+
+		delivered <- r.Args.One().MustString()
+		return nil, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("outbox-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	failed := make(chan string, 1)
+
+	o := NewOutbox(c, NewMemoryOutboxStore())
+	o.Timeout = 100 * time.Millisecond
+	o.RetryInterval = 50 * time.Millisecond
+	o.OnFailure = func(msg *OutboxMessage, err error) {
+		failed <- msg.Method
+	}
+
+	if _, err := o.Send("command", "first"); err != nil {
+		t.Fatalf("Send()=%s", err)
+	}
+
+	if _, err := o.Send("nonexistent"); err != nil {
+		t.Fatalf("Send()=%s", err)
+	}
+
+	o.Start()
+	defer o.Close()
+
+	select {
+	case method := <-failed:
+		if method != "nonexistent" {
+			t.Fatalf("got %q, want %q", method, "nonexistent")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the failure")
+	}
+
+	if n := atomic.LoadInt32(&calls); n < 2 {
+		t.Fatalf("got %d calls, want message to be re-sent", n)
+	}
+
+	pending, err := o.Pending()
+	if err != nil {
+		t.Fatalf("Pending()=%s", err)
+	}
+
+	if len(pending) != 0 {
+		t.Fatalf("got %d pending messages, want 0", len(pending))
+	}
+
+	if arg := <-delivered; arg != "first" {
+		t.Fatalf("got %q, want %q", arg, "first")
+	}
+}
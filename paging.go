@@ -0,0 +1,397 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+var (
+	// DefaultPageSize is the size in bytes of JSON-encoded items, above
+	// which a page of an iterator result is cut, if Kite.PageSize is zero.
+	DefaultPageSize = 256 * 1024
+
+	// DefaultPageTTL is the time the remaining items of an iterator result
+	// are kept, if Kite.PageTTL is zero.
+	DefaultPageTTL = time.Minute
+)
+
+// ErrPageNotFound is returned by kite.nextPage for continuation tokens,
+// which expired or were issued for other connection.
+var ErrPageNotFound = errors.New("page not found")
+
+// Iterator is returned by handlers, whose results may be too large to be
+// sent in a single message. The items are sent in pages, each of them cut
+// once its JSON-encoded items exceed Kite.PageSize; the caller fetches
+// the next pages with the continuation token, see Client.ReadPages.
+//
+// If the iterator implements io.Closer, it is closed once all items were
+// sent, or the caller stopped reading them.
+//
+// Results of methods returning iterators must not be cached nor
+// deduplicated.
+type Iterator interface {
+	// Next gives the next item. It returns io.EOF when there are no
+	// more items.
+	Next() (interface{}, error)
+}
+
+// SliceIterator gives an iterator over the elements of the slice.
+func SliceIterator(slice interface{}) Iterator {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice {
+		panic("kite: SliceIterator called with non-slice value")
+	}
+
+	return &sliceIterator{v: v}
+}
+
+type sliceIterator struct {
+	v reflect.Value
+	i int
+}
+
+func (it *sliceIterator) Next() (interface{}, error) {
+	if it.i == it.v.Len() {
+		return nil, io.EOF
+	}
+
+	it.i++
+
+	return it.v.Index(it.i - 1).Interface(), nil
+}
+
+// Page is a part of an iterator result.
+type Page struct {
+	// Items holds the JSON-encoded items of the page.
+	Items []json.RawMessage `json:"items"`
+
+	// Next is the continuation token of the next page, it is empty
+	// for the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// pager holds an iterator result of a connection between pages.
+type pager struct {
+	it     Iterator
+	client *Client
+	next   json.RawMessage // item, which did not fit into the last page
+	timer  *time.Timer     // removes the pager after PageTTL
+}
+
+type nextPageArgs struct {
+	Token string `json:"token"`
+	Close bool   `json:"close,omitempty"`
+}
+
+// firstPage gives the first page of the iterator result, keeping the
+// iterator for the next pages if there are any.
+func (k *Kite) firstPage(c *Client, it Iterator) (*Page, error) {
+	p := &pager{
+		it:     it,
+		client: c,
+	}
+
+	return k.page(p)
+}
+
+// page cuts the next page of the pager.
+func (k *Kite) page(p *pager) (*Page, error) {
+	page := &Page{
+		Items: []json.RawMessage{},
+	}
+
+	size := 0
+
+	if p.next != nil {
+		page.Items = append(page.Items, p.next)
+		size += len(p.next)
+		p.next = nil
+	}
+
+	for {
+		item, err := p.it.Next()
+		if err == io.EOF {
+			closeIterator(p.it)
+			return page, nil
+		}
+
+		if err != nil {
+			closeIterator(p.it)
+			return nil, err
+		}
+
+		data, err := json.Marshal(item)
+		if err != nil {
+			closeIterator(p.it)
+			return nil, err
+		}
+
+		if len(page.Items) != 0 && size+len(data) > k.pageSize() {
+			p.next = data
+			break
+		}
+
+		page.Items = append(page.Items, data)
+		size += len(data)
+	}
+
+	page.Next = utils.RandomString(16)
+
+	k.pagersMu.Lock()
+	k.pagers[page.Next] = p
+	k.pagersMu.Unlock()
+
+	p.timer = time.AfterFunc(k.pageTTL(), func() {
+		if k.takePager(page.Next, nil) != nil {
+			closeIterator(p.it)
+		}
+	})
+
+	return page, nil
+}
+
+// takePager removes the pager of the token, giving it if it belongs
+// to the client. A nil client matches any.
+func (k *Kite) takePager(token string, c *Client) *pager {
+	k.pagersMu.Lock()
+	defer k.pagersMu.Unlock()
+
+	p, ok := k.pagers[token]
+	if !ok || (c != nil && p.client != c) {
+		return nil
+	}
+
+	delete(k.pagers, token)
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+
+	return p
+}
+
+// handleNextPage gives the next page of an iterator result.
+func (k *Kite) handleNextPage(r *Request) (interface{}, error) {
+	var args nextPageArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	p := k.takePager(args.Token, r.Client)
+	if p == nil {
+		return nil, ErrPageNotFound
+	}
+
+	if args.Close {
+		closeIterator(p.it)
+		return nil, nil
+	}
+
+	return k.page(p)
+}
+
+func (k *Kite) pageSize() int {
+	if k.PageSize != 0 {
+		return k.PageSize
+	}
+
+	return DefaultPageSize
+}
+
+func (k *Kite) pageTTL() time.Duration {
+	if k.PageTTL != 0 {
+		return k.PageTTL
+	}
+
+	return DefaultPageTTL
+}
+
+func closeIterator(it Iterator) {
+	if c, ok := it.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// PageReader reads items of an iterator result, fetching its pages from
+// the remote kite as needed.
+type PageReader struct {
+	c     *Client
+	ctx   context.Context // of calls fetching pages, if non-nil
+	page  Page
+	i     int
+	err   error
+	mu    sync.Mutex
+	token string // of the next page
+}
+
+// ReadPages gives a reader of the items of an iterator result, returned
+// by a call to a method with the client.
+func (c *Client) ReadPages(result *dnode.Partial) *PageReader {
+	r := &PageReader{c: c}
+
+	if err := result.Unmarshal(&r.page); err != nil {
+		r.err = err
+	}
+
+	r.token = r.page.Next
+
+	return r
+}
+
+// Next unmarshals the next item into v. It returns io.EOF when there are
+// no more items.
+func (r *PageReader) Next(v interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.err == nil && r.i == len(r.page.Items) {
+		if r.token == "" {
+			r.err = io.EOF
+			break
+		}
+
+		result, err := r.tell(&nextPageArgs{Token: r.token})
+		if err != nil {
+			r.err = err
+			break
+		}
+
+		r.page = Page{}
+		r.i = 0
+
+		if err := result.Unmarshal(&r.page); err != nil {
+			r.err = err
+			break
+		}
+
+		r.token = r.page.Next
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.i++
+
+	return json.Unmarshal(r.page.Items[r.i-1], v)
+}
+
+// Close stops reading the items, releasing the remaining ones on the
+// remote kite.
+func (r *PageReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = io.EOF
+	}
+
+	if r.token == "" {
+		return nil
+	}
+
+	token := r.token
+	r.token = ""
+
+	// The ctx may be done already, release the iterator regardless.
+	_, err := r.c.Tell("kite.nextPage", &nextPageArgs{Token: token, Close: true})
+	return err
+}
+
+func (r *PageReader) tell(args *nextPageArgs) (*dnode.Partial, error) {
+	if r.ctx != nil {
+		return r.c.TellWithContext(r.ctx, "kite.nextPage", args)
+	}
+
+	return r.c.Tell("kite.nextPage", args)
+}
+
+// ReceiveStream calls the method, which returns an Iterator, and sends
+// its items to ch, which must be a channel of values or pointers of the
+// items' type. The pages are fetched as ch is drained. When the items
+// end, or reading them fails, ch is closed and the returned channel
+// receives the error, which is nil if all items were received.
+//
+// When the ctx is done, reading stops and the remaining items are
+// released on the remote kite.
+//
+//	users := make(chan *User)
+//	errc := c.ReceiveStream(ctx, users, "users.list", query)
+//
+//	for u := range users {
+//	    ...
+//	}
+//
+//	if err := <-errc; err != nil {
+//	    ...
+//	}
+func (c *Client) ReceiveStream(ctx context.Context, ch interface{}, method string, args ...interface{}) <-chan error {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || v.Type().ChanDir()&reflect.SendDir == 0 {
+		panic("kite: ReceiveStream called with non-channel value")
+	}
+
+	errc := make(chan error, 1)
+
+	go func() {
+		defer v.Close()
+		errc <- c.receiveStream(ctx, v, method, args)
+	}()
+
+	return errc
+}
+
+func (c *Client) receiveStream(ctx context.Context, ch reflect.Value, method string, args []interface{}) error {
+	result, err := c.TellWithContext(ctx, method, args...)
+	if err != nil {
+		return err
+	}
+
+	r := c.ReadPages(result)
+	r.ctx = ctx
+
+	elem := ch.Type().Elem()
+	ptr := elem.Kind() == reflect.Ptr
+	if ptr {
+		elem = elem.Elem()
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+
+	for {
+		item := reflect.New(elem)
+
+		if err := r.Next(item.Interface()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			r.Close()
+			return err
+		}
+
+		if ptr {
+			cases[0].Send = item
+		} else {
+			cases[0].Send = item.Elem()
+		}
+
+		if i, _, _ := reflect.Select(cases); i == 1 {
+			if err := r.Close(); err != nil {
+				c.LocalKite.Log.Debug("unable to release stream of %s: %s", method, err)
+			}
+
+			return ctx.Err()
+		}
+	}
+}
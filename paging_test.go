@@ -0,0 +1,194 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+type closeCounter struct {
+	Iterator
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestPaging(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("paging-server", "0.0.1", cfg)
+	srv.PageSize = 100
+
+	items := make([]string, 50)
+	for i := range items {
+		items[i] = fmt.Sprintf("%02d-%s", i, strings.Repeat("x", 20))
+	}
+
+	var it *closeCounter
+
+	srv.HandleFunc("list", func(r *Request) (interface{}, error) {
+		it = &closeCounter{Iterator: SliceIterator(items)}
+		return it, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("paging-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	res, err := c.Tell("list")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	var first Page
+	if err := res.Unmarshal(&first); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if n := len(first.Items); n == 0 || n == len(items) || first.Next == "" {
+		t.Fatalf("got first page of %d items, next %q; want partial page", n, first.Next)
+	}
+
+	r := c.ReadPages(res)
+
+	var got []string
+
+	for {
+		var item string
+
+		err := r.Next(&item)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Next()=%s", err)
+		}
+
+		got = append(got, item)
+	}
+
+	if strings.Join(got, ",") != strings.Join(items, ",") {
+		t.Fatalf("got %v, want %v", got, items)
+	}
+
+	if it.closed != 1 {
+		t.Fatalf("got iterator closed %d times, want 1", it.closed)
+	}
+
+	// Readers closed early release the iterator.
+	if res, err = c.Tell("list"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	r = c.ReadPages(res)
+
+	var item string
+	if err := r.Next(&item); err != nil {
+		t.Fatalf("Next()=%s", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	if it.closed != 1 {
+		t.Fatalf("got iterator closed %d times, want 1", it.closed)
+	}
+
+	if _, err := c.Tell("kite.nextPage", &nextPageArgs{Token: first.Next}); err == nil {
+		t.Fatal("want error for used token")
+	}
+}
+
+func TestReceiveStream(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("stream-server", "0.0.1", cfg)
+	srv.PageSize = 64
+
+	type item struct {
+		N int `json:"n"`
+	}
+
+	items := make([]item, 100)
+	for i := range items {
+		items[i].N = i
+	}
+
+	srv.HandleFunc("list", func(r *Request) (interface{}, error) {
+		return SliceIterator(items), nil
+	})
+
+	srv.HandleFunc("fail", func(r *Request) (interface{}, error) {
+		return nil, errors.New("no items")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("stream-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	ch := make(chan *item)
+	errc := c.ReceiveStream(context.Background(), ch, "list")
+
+	n := 0
+	for it := range ch {
+		if it.N != n {
+			t.Fatalf("got item %d, want %d", it.N, n)
+		}
+		n++
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("ReceiveStream()=%s", err)
+	}
+
+	if n != len(items) {
+		t.Fatalf("got %d items, want %d", n, len(items))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	values := make(chan item)
+	errc = c.ReceiveStream(ctx, values, "list")
+
+	if it := <-values; it.N != 0 {
+		t.Fatalf("got item %d, want 0", it.N)
+	}
+
+	cancel()
+
+	for range values {
+	}
+
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	errc = c.ReceiveStream(context.Background(), make(chan item), "fail")
+
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), "no items") {
+		t.Fatalf("got %v, want no items error", err)
+	}
+}
@@ -0,0 +1,284 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram
+// buckets of PeerMetrics, if Buckets is nil.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// OtherPeers is the name metrics of remote kites not listed in
+// PeerMetrics.Peers are aggregated under.
+const OtherPeers = "other"
+
+// peerMetricsStartKey holds the time the call was dispatched at in the
+// request context.
+const peerMetricsStartKey = "kite.peerMetricsStart"
+
+// PeerMetrics collects metrics of the calls and frames exchanged with
+// remote kites, broken down by the names of the remote kites, so it can
+// be told which peer contributes latency, errors or bandwidth.
+//
+// It implements the expvar.Var interface:
+//
+//	m := kite.NewPeerMetrics("kontrol", "storage")
+//	m.Use(k)
+//	expvar.Publish("kite.peers", m)
+//
+//	c := k.NewClient(url, kite.WithInterceptors(m.Intercept))
+type PeerMetrics struct {
+	// Peers are the names of remote kites, whose metrics are collected
+	// separately. Metrics of other kites are aggregated under OtherPeers,
+	// which bounds the number of collected series.
+	Peers []string
+
+	// Buckets are the upper bounds of the latency histogram buckets,
+	// in ascending order.
+	//
+	// If nil, DefaultLatencyBuckets is used.
+	Buckets []time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*PeerStats // peer name -> stats
+}
+
+// PeerStats are metrics of a remote kite, see PeerMetrics.
+type PeerStats struct {
+	// Served are the calls made by the remote kite, served by the kite.
+	Served CallStats `json:"served"`
+
+	// Called are the calls made by the kite to the remote kite.
+	Called CallStats `json:"called"`
+
+	// BytesIn and BytesOut are the sizes of the frames received from and
+	// sent to the remote kite.
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+// CallStats are metrics of calls, see PeerStats.
+type CallStats struct {
+	Calls   int64            `json:"calls"`
+	Errors  int64            `json:"errors"`
+	Latency LatencyHistogram `json:"latency"`
+}
+
+// LatencyHistogram counts latencies of calls.
+type LatencyHistogram struct {
+	// Buckets are the upper bounds of the buckets in milliseconds.
+	Buckets []float64 `json:"buckets"`
+
+	// Counts are the numbers of latencies within each bucket, the last
+	// one counts the latencies exceeding the last bucket. Counts are not
+	// cumulative.
+	Counts []int64 `json:"counts"`
+
+	// Sum is the sum of all latencies in milliseconds.
+	Sum float64 `json:"sum"`
+}
+
+// NewPeerMetrics gives new metrics, which collect metrics of the given
+// peers separately.
+func NewPeerMetrics(peers ...string) *PeerMetrics {
+	return &PeerMetrics{
+		Peers: peers,
+	}
+}
+
+// Use registers the metrics with the kite, so they collect metrics of
+// calls served by the kite and frames exchanged by the kite. Calls made
+// by the kite are collected by clients using Intercept.
+func (m *PeerMetrics) Use(k *Kite) {
+	k.PreHandleFunc(m.start)
+	k.FinalFunc(m.served)
+	k.UseFrameFunc(m.frame)
+}
+
+// Intercept is an Interceptor, which collects metrics of calls made by
+// the client, see WithInterceptors.
+func (m *PeerMetrics) Intercept(ctx context.Context, call *Call, next Invoker) (*dnode.Partial, error) {
+	start := time.Now()
+
+	p, err := next(ctx, call)
+
+	m.observe(call.Client.Kite.Name, func(s *PeerStats) {
+		m.record(&s.Called, time.Since(start), err)
+	})
+
+	return p, err
+}
+
+// Get gives a copy of metrics of the peer, or nil if none were collected.
+func (m *PeerMetrics) Get(peer string) *PeerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[peer]
+	if !ok {
+		return nil
+	}
+
+	return s.copy()
+}
+
+// Snapshot gives a copy of metrics of all peers.
+func (m *PeerMetrics) Snapshot() map[string]*PeerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]*PeerStats, len(m.stats))
+
+	for peer, s := range m.stats {
+		stats[peer] = s.copy()
+	}
+
+	return stats
+}
+
+// String implements the expvar.Var interface.
+func (m *PeerMetrics) String() string {
+	p, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+
+	return string(p)
+}
+
+func (m *PeerMetrics) start(r *Request) (interface{}, error) {
+	r.Context.Set(peerMetricsStartKey, time.Now())
+	return nil, nil
+}
+
+func (m *PeerMetrics) served(r *Request, resp interface{}, err error) (interface{}, error) {
+	var latency time.Duration
+
+	if v, e := r.Context.Get(peerMetricsStartKey); e == nil {
+		if start, ok := v.(time.Time); ok {
+			latency = time.Since(start)
+		}
+	}
+
+	var peer string
+	if r.Client != nil {
+		peer = r.Client.Kite.Name
+	}
+
+	m.observe(peer, func(s *PeerStats) {
+		m.record(&s.Served, latency, err)
+	})
+
+	return resp, err
+}
+
+func (m *PeerMetrics) frame(f *Frame) error {
+	n := int64(len(f.Data))
+
+	m.observe(f.Client.Kite.Name, func(s *PeerStats) {
+		if f.Direction == Outgoing {
+			s.BytesOut += n
+		} else {
+			s.BytesIn += n
+		}
+	})
+
+	return nil
+}
+
+// observe updates the metrics of the peer with fn.
+func (m *PeerMetrics) observe(peer string, fn func(*PeerStats)) {
+	peer = m.label(peer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats == nil {
+		m.stats = make(map[string]*PeerStats)
+	}
+
+	s, ok := m.stats[peer]
+	if !ok {
+		s = m.newStats()
+		m.stats[peer] = s
+	}
+
+	fn(s)
+}
+
+// label gives the name the metrics of the peer are collected under.
+func (m *PeerMetrics) label(peer string) string {
+	for _, p := range m.Peers {
+		if p == peer {
+			return peer
+		}
+	}
+
+	return OtherPeers
+}
+
+func (m *PeerMetrics) buckets() []time.Duration {
+	if m.Buckets != nil {
+		return m.Buckets
+	}
+
+	return DefaultLatencyBuckets
+}
+
+func (m *PeerMetrics) newStats() *PeerStats {
+	buckets := m.buckets()
+	ms := make([]float64, len(buckets))
+
+	for i, b := range buckets {
+		ms[i] = millis(b)
+	}
+
+	return &PeerStats{
+		Served: CallStats{Latency: LatencyHistogram{Buckets: ms, Counts: make([]int64, len(ms)+1)}},
+		Called: CallStats{Latency: LatencyHistogram{Buckets: ms, Counts: make([]int64, len(ms)+1)}},
+	}
+}
+
+func (m *PeerMetrics) record(s *CallStats, latency time.Duration, err error) {
+	s.Calls++
+
+	if err != nil {
+		s.Errors++
+	}
+
+	i := 0
+	for _, b := range m.buckets() {
+		if latency <= b {
+			break
+		}
+		i++
+	}
+
+	s.Latency.Counts[i]++
+	s.Latency.Sum += millis(latency)
+}
+
+func (s *PeerStats) copy() *PeerStats {
+	sCopy := *s
+	sCopy.Served.Latency.Counts = append([]int64(nil), s.Served.Latency.Counts...)
+	sCopy.Called.Latency.Counts = append([]int64(nil), s.Called.Latency.Counts...)
+	return &sCopy
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
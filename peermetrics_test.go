@@ -0,0 +1,98 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestPeerMetrics(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("metrics-server", "0.0.1", cfg)
+	srvMetrics := NewPeerMetrics("metrics-client")
+	srvMetrics.Use(srv)
+
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+	srv.HandleFunc("fail", func(r *Request) (interface{}, error) {
+		return nil, errors.New("fail")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	url := fmt.Sprintf("%s/kite", ts.URL)
+	clientMetrics := NewPeerMetrics("metrics-server")
+
+	c := NewWithConfig("metrics-client", "0.0.1", cfg).NewClient(url, WithInterceptors(clientMetrics.Intercept))
+	c.Kite.Name = "metrics-server"
+
+	other := NewWithConfig("stranger", "0.0.1", cfg).NewClient(url)
+
+	for _, c := range []*Client{c, other} {
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		defer c.Close()
+	}
+
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+	c.TellWithTimeout("fail", 4*time.Second)
+
+	if _, err := other.TellWithTimeout("echo", 4*time.Second, "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	s := srvMetrics.Get("metrics-client")
+	if s == nil {
+		t.Fatal("no metrics of metrics-client")
+	}
+
+	if s.Served.Calls != 2 || s.Served.Errors != 1 {
+		t.Errorf("got %d calls and %d errors, want 2 and 1", s.Served.Calls, s.Served.Errors)
+	}
+
+	if s.BytesIn == 0 || s.BytesOut == 0 {
+		t.Errorf("got %d bytes in and %d bytes out, want non-zero", s.BytesIn, s.BytesOut)
+	}
+
+	var n int64
+	for _, count := range s.Served.Latency.Counts {
+		n += count
+	}
+
+	if n != 2 {
+		t.Errorf("got %d latencies, want 2", n)
+	}
+
+	if s := srvMetrics.Get(OtherPeers); s == nil || s.Served.Calls != 1 {
+		t.Errorf("got %+v, want 1 call of other peers", s)
+	}
+
+	if s := srvMetrics.Get("stranger"); s != nil {
+		t.Errorf("got %+v, want metrics of stranger aggregated", s)
+	}
+
+	if s := clientMetrics.Get("metrics-server"); s == nil || s.Called.Calls != 2 || s.Called.Errors != 1 {
+		t.Errorf("got %+v, want 2 calls and 1 error", s)
+	}
+
+	var v map[string]*PeerStats
+	if err := json.Unmarshal([]byte(srvMetrics.String()), &v); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if len(v) != 2 {
+		t.Fatalf("got %d peers, want 2", len(v))
+	}
+}
@@ -0,0 +1,102 @@
+package kite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PayloadPolicy tells how calls of a method must be protected. The policy
+// is enforced both when calls are sent and when they are received, calls
+// violating it are rejected before they are dispatched to handlers.
+type PayloadPolicy int
+
+// Payload policies, which may be combined.
+const (
+	// PolicyPlaintext allows calls, which are neither signed nor
+	// encrypted.
+	PolicyPlaintext PayloadPolicy = 0
+
+	// PolicySigned requires calls to be signed, see Kite.SigningKey.
+	PolicySigned PayloadPolicy = 1
+
+	// PolicyEncrypted requires arguments of calls to be encrypted
+	// end-to-end, see Kite.AddEncryptionKey.
+	PolicyEncrypted PayloadPolicy = 2
+)
+
+func (p PayloadPolicy) String() string {
+	if p == PolicyPlaintext {
+		return "plaintext"
+	}
+
+	var s []string
+	if p&PolicySigned != 0 {
+		s = append(s, "signed")
+	}
+	if p&PolicyEncrypted != 0 {
+		s = append(s, "encrypted")
+	}
+
+	return strings.Join(s, "+")
+}
+
+// SetMethodPolicy sets the payload policy of the method, overriding
+// Kite.PayloadPolicy. Use it to require encryption for sensitive methods,
+// or to allow plaintext calls of selected methods, like kite.ping, when
+// the default policy is stricter:
+//
+//	k.PayloadPolicy = kite.PolicySigned | kite.PolicyEncrypted
+//	k.SetMethodPolicy("kite.ping", kite.PolicyPlaintext)
+//
+// The policy applies to calls of the method sent by clients of the kite
+// and to calls of the method received by the kite.
+func (k *Kite) SetMethodPolicy(method string, p PayloadPolicy) {
+	k.policyMu.Lock()
+	defer k.policyMu.Unlock()
+
+	if k.methodPolicies == nil {
+		k.methodPolicies = make(map[string]PayloadPolicy)
+	}
+
+	k.methodPolicies[method] = p
+}
+
+// MethodPolicy gives the payload policy of the method.
+func (k *Kite) MethodPolicy(method string) PayloadPolicy {
+	k.policyMu.RLock()
+	defer k.policyMu.RUnlock()
+
+	if p, ok := k.methodPolicies[method]; ok {
+		return p
+	}
+
+	return k.PayloadPolicy
+}
+
+// checkSendPolicy tells whether the call of the method can be sent in
+// a way, which satisfies its policy.
+func (c *Client) checkSendPolicy(method string) error {
+	p := c.LocalKite.MethodPolicy(method)
+
+	if p&PolicySigned != 0 && !c.LocalKite.signs() {
+		return fmt.Errorf("payload policy of %q requires signing, but the kite has no signing key", method)
+	}
+
+	return nil
+}
+
+// checkPolicy rejects the request, if it violates the policy of the method.
+// It must be called after the signature of the request is verified.
+func (r *Request) checkPolicy() error {
+	p := r.LocalKite.MethodPolicy(r.Method)
+
+	if p&PolicyEncrypted != 0 && !r.Encrypted {
+		return fmt.Errorf("payload policy of %q requires encryption", r.Method)
+	}
+
+	if p&PolicySigned != 0 && r.Signature == nil {
+		return fmt.Errorf("payload policy of %q requires signing", r.Method)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package kite
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestPayloadPolicy(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("policy-server", "0.0.1", cfg)
+	srv.PayloadPolicy = PolicyEncrypted
+	srv.SetMethodPolicy("public", PolicyPlaintext)
+
+	if err := srv.AddEncryptionKey("shared", key); err != nil {
+		t.Fatalf("AddEncryptionKey()=%s", err)
+	}
+
+	handler := func(r *Request) (interface{}, error) {
+		return fmt.Sprintf("%s:%t", r.Args.One().MustString(), r.Encrypted), nil
+	}
+
+	srv.HandleFunc("secret", handler)
+	srv.HandleFunc("public", handler)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dial := func(k *Kite) *Client {
+		c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		return c
+	}
+
+	plain := dial(New("policy-client", "0.0.1"))
+	defer plain.Close()
+
+	if result, err := plain.TellWithTimeout("public", 4*time.Second, "hi"); err != nil || result.MustString() != "hi:false" {
+		t.Fatalf("got %v, %v, want plaintext call to be allowed", result, err)
+	}
+
+	_, err := plain.TellWithTimeout("secret", 4*time.Second, "hi")
+	if e, ok := err.(*Error); !ok || e.Type != "policyError" || !strings.Contains(e.Message, "requires encryption") {
+		t.Fatalf("got %v, want policyError", err)
+	}
+
+	k := New("policy-client", "0.0.1")
+	k.SetMethodPolicy("secret", PolicyEncrypted)
+	k.EncryptionKeyID = "shared"
+
+	if err := k.AddEncryptionKey("shared", key); err != nil {
+		t.Fatalf("AddEncryptionKey()=%s", err)
+	}
+
+	encrypted := dial(k)
+	defer encrypted.Close()
+
+	result, err := encrypted.TellWithTimeout("secret", 4*time.Second, "hi")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != "hi:true" {
+		t.Fatalf("got %q, want %q", got, "hi:true")
+	}
+
+	k.SetMethodPolicy("public", PolicySigned)
+
+	_, err = encrypted.TellWithTimeout("public", 4*time.Second, "hi")
+	if e, ok := err.(*Error); !ok || e.Type != "policyError" {
+		t.Fatalf("got %v, want policyError on send", err)
+	}
+}
+
+func TestPayloadPolicyString(t *testing.T) {
+	cases := map[PayloadPolicy]string{
+		PolicyPlaintext:                "plaintext",
+		PolicySigned:                   "signed",
+		PolicySigned | PolicyEncrypted: "signed+encrypted",
+	}
+
+	for p, want := range cases {
+		if got := p.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
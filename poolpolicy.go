@@ -0,0 +1,388 @@
+package kite
+
+import (
+	"context"
+	"hash/crc32"
+	"sort"
+	"time"
+)
+
+var (
+	// DefaultEjectionInterval is the time between evaluations of pool
+	// members, if OutlierDetection.Interval is zero.
+	DefaultEjectionInterval = 10 * time.Second
+
+	// DefaultEjectionTime is the time an outlier is ejected for before
+	// it is probed, if OutlierDetection.EjectionTime is zero.
+	DefaultEjectionTime = 30 * time.Second
+
+	// DefaultEjectionErrorRate is the excess of the error rate over the
+	// median, which makes a member an outlier, if OutlierDetection.ErrorRate
+	// is zero.
+	DefaultEjectionErrorRate = 0.3
+
+	// DefaultEjectionLatencyFactor is the multiple of the median latency,
+	// which makes a member an outlier, if OutlierDetection.LatencyFactor
+	// is zero.
+	DefaultEjectionLatencyFactor = 3.0
+
+	// DefaultEjectionMinRequests is the number of calls a member must
+	// serve within an interval to be evaluated, if
+	// OutlierDetection.MinRequests is zero.
+	DefaultEjectionMinRequests = 10
+
+	// DefaultMaxEjected is the maximum fraction of pool members, which
+	// may be ejected at once, if OutlierDetection.MaxEjected is zero.
+	DefaultMaxEjected = 0.5
+)
+
+// OutlierDetection configures temporary ejection of StickyPool members,
+// whose error rate or latency deviates significantly from the median
+// of the other members.
+//
+// Members are evaluated each Interval, based on calls made with
+// StickyPool.Tell and StickyPool.HedgedTell. Only failures of the
+// connection, like timeouts or disconnects, are counted as errors.
+// Keys of ejected members are routed to the next members on the ring.
+// Once EjectionTime passes, an ejected member is probed and re-admitted
+// if the probe succeeds, otherwise it stays ejected for another
+// EjectionTime.
+type OutlierDetection struct {
+	// Interval is the time between evaluations of members.
+	//
+	// If zero, DefaultEjectionInterval is used.
+	Interval time.Duration
+
+	// EjectionTime is the time after which an ejected member is probed.
+	//
+	// If zero, DefaultEjectionTime is used.
+	EjectionTime time.Duration
+
+	// ErrorRate is the excess of the error rate of a member over the
+	// median error rate of the other members, above which the member
+	// is ejected.
+	//
+	// If zero, DefaultEjectionErrorRate is used.
+	ErrorRate float64
+
+	// LatencyFactor is the multiple of the median mean latency of the
+	// other members, above which the member is ejected.
+	//
+	// If zero, DefaultEjectionLatencyFactor is used.
+	LatencyFactor float64
+
+	// MinRequests is the number of calls a member must serve within
+	// an interval to be evaluated.
+	//
+	// If zero, DefaultEjectionMinRequests is used.
+	MinRequests int
+
+	// MaxEjected is the maximum fraction of members, which may be ejected
+	// at once.
+	//
+	// If zero, DefaultMaxEjected is used.
+	MaxEjected float64
+
+	// Probe tells whether an ejected member can be re-admitted.
+	//
+	// If nil, the member is re-admitted when it responds to kite.ping.
+	Probe func(*PooledClient) error
+}
+
+// memberState holds the state of a StickyPool member used by its
+// policies.
+type memberState struct {
+	added time.Time // zero for members the pool started with
+
+	// Calls within the current interval.
+	requests int
+	errors   int
+	latency  time.Duration // total
+
+	ejected bool
+	probeAt time.Time // when the ejected member is probed
+	probing bool
+}
+
+func (m *memberState) reset() {
+	m.requests = 0
+	m.errors = 0
+	m.latency = 0
+}
+
+// route gives up to n members for the given key in the order calls should
+// be tried. Members ramping up due to SlowStart, which do not take the key
+// yet, come after the other members, followed by members of versions the
+// key is not split to, see SetVersionSplit. Ejected members come last.
+//
+// It must be called with s.mu held.
+func (s *StickyPool) route(key string, n int) []string {
+	if s.SlowStart == 0 && s.Outliers == nil && len(s.split) == 0 {
+		return s.ring.GetN(key, n)
+	}
+
+	now := time.Now()
+
+	if s.Outliers != nil {
+		s.evaluate(now)
+	}
+
+	version := s.splitVersion(key)
+
+	routed := s.ring.GetN(key, len(s.auths))
+	rank := make(map[string]int, len(routed))
+
+	for _, url := range routed {
+		m := s.state[url]
+
+		switch {
+		case m != nil && m.ejected:
+			rank[url] = 3
+		case !s.inSplit(url, version):
+			rank[url] = 2
+		case m != nil && !s.takesKey(m, key, url, now):
+			rank[url] = 1
+		}
+	}
+
+	sort.SliceStable(routed, func(i, j int) bool { return rank[routed[i]] < rank[routed[j]] })
+
+	if len(routed) > n {
+		routed = routed[:n]
+	}
+
+	return routed
+}
+
+// takesKey tells whether the member, which may be ramping up, takes calls
+// of the key. The fraction of keys a new member takes grows linearly over
+// SlowStart, each key is moved to it once and stays there.
+func (s *StickyPool) takesKey(m *memberState, key, url string, now time.Time) bool {
+	if s.SlowStart == 0 || m.added.IsZero() {
+		return true
+	}
+
+	weight := float64(now.Sub(m.added)) / float64(s.SlowStart)
+	if weight >= 1 {
+		return true
+	}
+
+	h := crc32.ChecksumIEEE([]byte(url + "#" + key))
+
+	return float64(h)/(1<<32) < weight
+}
+
+// observe records the outcome of a call made to the member.
+func (s *StickyPool) observe(url string, latency time.Duration, err error) {
+	if s.Outliers == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.state[url]
+	if m == nil || m.ejected {
+		return
+	}
+
+	m.requests++
+	m.latency += latency
+
+	if err != nil && isConnectionError(err) {
+		m.errors++
+	}
+}
+
+// evaluate ejects outliers, once per interval, and starts probes of
+// ejected members.
+//
+// It must be called with s.mu held.
+func (s *StickyPool) evaluate(now time.Time) {
+	o := s.Outliers
+
+	for url, m := range s.state {
+		if m.ejected && !m.probing && !now.Before(m.probeAt) {
+			m.probing = true
+			go s.probe(url, s.auths[url])
+		}
+	}
+
+	if s.evaluated.IsZero() {
+		s.evaluated = now
+	}
+
+	if now.Sub(s.evaluated) < o.interval() {
+		return
+	}
+
+	s.evaluated = now
+
+	var (
+		urls      []string
+		rates     = make(map[string]float64)
+		latencies = make(map[string]float64)
+		ejected   int
+	)
+
+	for url, m := range s.state {
+		if m.ejected {
+			ejected++
+			continue
+		}
+
+		if m.requests >= o.minRequests() {
+			urls = append(urls, url)
+			rates[url] = float64(m.errors) / float64(m.requests)
+			latencies[url] = float64(m.latency) / float64(m.requests)
+		}
+	}
+
+	// Ensures the same members are ejected, when the limit is reached.
+	sort.Strings(urls)
+
+	limit := int(o.maxEjected() * float64(len(s.state)))
+
+	for _, url := range urls {
+		if ejected >= limit || len(urls) < 2 {
+			break
+		}
+
+		rate := median(rates, url)
+		latency := median(latencies, url)
+
+		switch {
+		case rates[url]-rate > o.errorRate():
+			s.Pool.Kite.Log.Info("sticky pool: ejecting %s, error rate %.2f exceeds median %.2f", url, rates[url], rate)
+		case latency > 0 && latencies[url] > latency*o.latencyFactor():
+			s.Pool.Kite.Log.Info("sticky pool: ejecting %s, latency %s exceeds median %s", url,
+				time.Duration(latencies[url]), time.Duration(latency))
+		default:
+			continue
+		}
+
+		s.state[url].ejected = true
+		s.state[url].probeAt = now.Add(o.ejectionTime())
+		ejected++
+	}
+
+	for _, m := range s.state {
+		m.reset()
+	}
+}
+
+// probe checks whether the ejected member can be re-admitted.
+func (s *StickyPool) probe(url string, auth *Auth) {
+	err := s.probeMember(url, auth)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.state[url]
+	if m == nil {
+		return
+	}
+
+	m.probing = false
+
+	if err != nil {
+		s.Pool.Kite.Log.Debug("sticky pool: probe of %s failed: %s", url, err)
+		m.probeAt = time.Now().Add(s.Outliers.ejectionTime())
+		return
+	}
+
+	s.Pool.Kite.Log.Info("sticky pool: re-admitting %s", url)
+
+	m.ejected = false
+	m.reset()
+}
+
+func (s *StickyPool) probeMember(url string, auth *Auth) error {
+	c, err := s.Pool.Get(url, auth)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if s.Outliers.Probe != nil {
+		return s.Outliers.Probe(c)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Pool.Kite.CallTimeout())
+	defer cancel()
+
+	_, err = c.TellWithContext(ctx, "kite.ping")
+	return err
+}
+
+// median gives the median of the values, excluding the one of the
+// given key.
+func median(values map[string]float64, exclude string) float64 {
+	other := make([]float64, 0, len(values))
+	for k, v := range values {
+		if k != exclude {
+			other = append(other, v)
+		}
+	}
+
+	if len(other) == 0 {
+		return 0
+	}
+
+	sort.Float64s(other)
+
+	i := len(other) / 2
+	if len(other)%2 == 0 {
+		return (other[i-1] + other[i]) / 2
+	}
+
+	return other[i]
+}
+
+func (o *OutlierDetection) interval() time.Duration {
+	if o.Interval != 0 {
+		return o.Interval
+	}
+
+	return DefaultEjectionInterval
+}
+
+func (o *OutlierDetection) ejectionTime() time.Duration {
+	if o.EjectionTime != 0 {
+		return o.EjectionTime
+	}
+
+	return DefaultEjectionTime
+}
+
+func (o *OutlierDetection) errorRate() float64 {
+	if o.ErrorRate != 0 {
+		return o.ErrorRate
+	}
+
+	return DefaultEjectionErrorRate
+}
+
+func (o *OutlierDetection) latencyFactor() float64 {
+	if o.LatencyFactor != 0 {
+		return o.LatencyFactor
+	}
+
+	return DefaultEjectionLatencyFactor
+}
+
+func (o *OutlierDetection) minRequests() int {
+	if o.MinRequests != 0 {
+		return o.MinRequests
+	}
+
+	return DefaultEjectionMinRequests
+}
+
+func (o *OutlierDetection) maxEjected() float64 {
+	if o.MaxEjected != 0 {
+		return o.MaxEjected
+	}
+
+	return DefaultMaxEjected
+}
@@ -0,0 +1,207 @@
+package kite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AdminScope is the scope required from callers with restricted tokens
+// to call the profiling methods, see EnableProfiling.
+const AdminScope = "admin"
+
+var (
+	// DefaultProfileDuration is the duration of a CPU profile, if
+	// ProfileArgs.Seconds is zero.
+	DefaultProfileDuration = 10 * time.Second
+
+	// MaxProfileDuration bounds the duration of a CPU profile.
+	MaxProfileDuration = time.Minute
+)
+
+// ProfileArgs is the argument of the kite.debug.pprof method.
+type ProfileArgs struct {
+	// Profile is the name of the profile, "cpu" or one of the profiles
+	// of the runtime/pprof package, like "heap" or "goroutine".
+	Profile string `json:"profile"`
+
+	// Seconds is the duration of the CPU profile.
+	//
+	// If zero, DefaultProfileDuration is used.
+	Seconds int `json:"seconds,omitempty"`
+
+	// Debug is the format of the profile, see pprof.Profile.WriteTo.
+	// If zero, the profile is in the binary format read by go tool pprof.
+	Debug int `json:"debug,omitempty"`
+}
+
+// RuntimeStats describes the Go runtime of the kite, as returned by
+// the kite.debug.runtimeStats method.
+type RuntimeStats struct {
+	GoVersion    string        `json:"goVersion"`
+	NumCPU       int           `json:"numCPU"`
+	GOMAXPROCS   int           `json:"gomaxprocs"`
+	Goroutines   int           `json:"goroutines"`
+	Uptime       time.Duration `json:"uptime"`
+	HeapAlloc    uint64        `json:"heapAlloc"`
+	HeapInuse    uint64        `json:"heapInuse"`
+	HeapObjects  uint64        `json:"heapObjects"`
+	Sys          uint64        `json:"sys"`
+	NumGC        uint32        `json:"numGC"`
+	PauseTotalNs uint64        `json:"pauseTotalNs"`
+	LastGC       time.Time     `json:"lastGC"`
+}
+
+// EnableProfiling registers methods giving profiles and runtime stats
+// of the kite, so they can be pulled from a misbehaving kite in
+// production:
+//
+//   - kite.debug.pprof gives the profile requested with ProfileArgs
+//   - kite.debug.runtimeStats gives RuntimeStats
+//
+// The methods are allowed only to admins, see AdminOnly, and callers
+// with restricted tokens must be granted AdminScope. The /debug/pprof/
+// and /debug/runtime endpoints of AdminHandler are enabled as well, and
+// are guarded the same way.
+func (k *Kite) EnableProfiling() {
+	if !atomic.CompareAndSwapInt32(&k.profiling, 0, 1) {
+		return
+	}
+
+	k.HandleFunc("kite.debug.pprof", k.AdminOnly(k.handleDebugPprof)).RequireScope(AdminScope)
+	k.HandleFunc("kite.debug.runtimeStats", k.AdminOnly(k.handleDebugRuntimeStats)).RequireScope(AdminScope)
+}
+
+// RuntimeStats gives stats of the Go runtime of the kite.
+func (k *Kite) RuntimeStats() *RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return &RuntimeStats{
+		GoVersion:    runtime.Version(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		Uptime:       time.Since(k.started),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapObjects:  m.HeapObjects,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+		LastGC:       time.Unix(0, int64(m.LastGC)),
+	}
+}
+
+// Profile gives the profile requested with args. A CPU profile blocks
+// for the duration of the profile.
+func (k *Kite) Profile(args *ProfileArgs) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if args.Profile == "cpu" {
+		d := time.Duration(args.Seconds) * time.Second
+		if d == 0 {
+			d = DefaultProfileDuration
+		}
+
+		if d > MaxProfileDuration {
+			d = MaxProfileDuration
+		}
+
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return nil, err
+		}
+
+		time.Sleep(d)
+		pprof.StopCPUProfile()
+
+		return buf.Bytes(), nil
+	}
+
+	p := pprof.Lookup(args.Profile)
+	if p == nil {
+		return nil, fmt.Errorf("unknown profile %q", args.Profile)
+	}
+
+	if err := p.WriteTo(&buf, args.Debug); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// handleDebugPprof returns the profile requested with ProfileArgs.
+func (k *Kite) handleDebugPprof(r *Request) (interface{}, error) {
+	var args ProfileArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Profile == "" {
+		return nil, errors.New("profile is required")
+	}
+
+	return k.Profile(&args)
+}
+
+// handleDebugRuntimeStats returns stats of the Go runtime.
+func (k *Kite) handleDebugRuntimeStats(r *Request) (interface{}, error) {
+	return k.RuntimeStats(), nil
+}
+
+// profilingHandler serves profiles and runtime stats, once profiling
+// is enabled. The net/http/pprof package is not used, as it registers
+// its handlers with http.DefaultServeMux.
+func (k *Kite) profilingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&k.profiling) == 0 {
+			http.NotFound(w, req)
+			return
+		}
+
+		if req.URL.Path == "/debug/runtime" {
+			k.writeAdminJSON(w, http.StatusOK, k.RuntimeStats())
+			return
+		}
+
+		args := &ProfileArgs{
+			Profile: strings.TrimPrefix(req.URL.Path, "/debug/pprof/"),
+		}
+
+		if args.Profile == "" {
+			var names []string
+			for _, p := range pprof.Profiles() {
+				names = append(names, p.Name())
+			}
+
+			k.writeAdminJSON(w, http.StatusOK, append(names, "cpu"))
+			return
+		}
+
+		args.Seconds, _ = strconv.Atoi(req.FormValue("seconds"))
+		args.Debug, _ = strconv.Atoi(req.FormValue("debug"))
+
+		p, err := k.Profile(args)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if args.Debug == 0 {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", args.Profile))
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+
+		w.Write(p)
+	})
+}
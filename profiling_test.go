@@ -0,0 +1,131 @@
+package kite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/testkeys"
+	"github.com/koding/kite/testutil"
+)
+
+func TestProfiling(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+	cfg.KontrolKey = testkeys.Public
+
+	srv := NewWithConfig("profiling-server", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	admin := httptest.NewServer(srv.AdminHandler())
+	defer admin.Close()
+
+	get := func(path, user string) (*http.Response, error) {
+		req, err := http.NewRequest("GET", admin.URL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if user != "" {
+			req.Header.Set("Authorization", "kiteKey "+testutil.NewKiteKeyUsername(user).Raw)
+		}
+
+		return http.DefaultClient.Do(req)
+	}
+
+	for user, want := range map[string]int{"": http.StatusUnauthorized, "intruder": http.StatusForbidden} {
+		resp, err := get("/debug/runtime", user)
+		if err != nil {
+			t.Fatalf("Get()=%s", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Fatalf("got %d, want %d for %q user", resp.StatusCode, want, user)
+		}
+	}
+
+	resp, err := get("/debug/runtime", cfg.Username)
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %d, want %d before profiling is enabled", resp.StatusCode, http.StatusNotFound)
+	}
+
+	srv.EnableProfiling()
+
+	c := New("profiling-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.TellWithTimeout("kite.debug.pprof", 4*time.Second, &ProfileArgs{Profile: "heap", Debug: 1})
+	if err != nil {
+		t.Fatalf("kite.debug.pprof: %s", err)
+	}
+
+	var p []byte
+	if err := result.Unmarshal(&p); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if !strings.Contains(string(p), "heap profile") {
+		t.Fatalf("unexpected heap profile: %q", p)
+	}
+
+	if _, err := c.TellWithTimeout("kite.debug.pprof", 4*time.Second, &ProfileArgs{Profile: "nonexisting"}); err == nil {
+		t.Fatal("expected kite.debug.pprof to fail for unknown profile")
+	}
+
+	result, err = c.TellWithTimeout("kite.debug.runtimeStats", 4*time.Second)
+	if err != nil {
+		t.Fatalf("kite.debug.runtimeStats: %s", err)
+	}
+
+	var stats RuntimeStats
+	if err := result.Unmarshal(&stats); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if stats.Goroutines == 0 || stats.GoVersion == "" {
+		t.Fatalf("unexpected runtime stats: %+v", stats)
+	}
+
+	for user, want := range map[string]int{"": http.StatusUnauthorized, "intruder": http.StatusForbidden} {
+		resp, err := get("/debug/pprof/goroutine?debug=1", user)
+		if err != nil {
+			t.Fatalf("Get()=%s", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Fatalf("got %d, want %d for %q user", resp.StatusCode, want, user)
+		}
+	}
+
+	resp, err = get("/debug/pprof/goroutine?debug=1", cfg.Username)
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll()=%s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine profile") {
+		t.Fatalf("unexpected response %d: %q", resp.StatusCode, body)
+	}
+}
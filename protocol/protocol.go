@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/koding/kite/dnode"
 )
@@ -117,6 +118,30 @@ type RegisterArgs struct {
 	URL  string `json:"url"`
 	Kite *Kite  `json:"kite,omitempty"`
 	Auth *Auth  `json:"auth,omitempty"`
+
+	// URLs are additional URLs the kite is reachable at.
+	URLs []AdvertisedURL `json:"urls,omitempty"`
+}
+
+// AdvertisedURL is one of multiple URLs a kite is reachable at,
+// e.g. an internal IP, an external DNS name or an IPv6 address.
+type AdvertisedURL struct {
+	URL string `json:"url"`
+
+	// Labels describe the URL, e.g. {"network": "internal"}, so
+	// clients select the one reachable from their network.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Matches tells whether the URL has all the given labels.
+func (u *AdvertisedURL) Matches(labels map[string]string) bool {
+	for k, v := range labels {
+		if u.Labels[k] != v {
+			return false
+		}
+	}
+
+	return true
 }
 
 type Auth struct {
@@ -156,6 +181,20 @@ type GetTokenArgs struct {
 	Force bool `json:"force"` // force creation of a new token
 }
 
+// GetDelegationTokenArgs is a request value for the "getDelegationToken"
+// kontrol method.
+type GetDelegationTokenArgs struct {
+	KontrolQuery // kite to generate a token for
+
+	// Auth is the credential the original caller used to authenticate
+	// with the kite requesting the delegation token.
+	Auth *Auth `json:"auth"`
+
+	// Scopes the token is restricted to. They must be a subset
+	// of the caller's scopes, if the caller's token has any.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
 type WhoResult struct {
 	Query *KontrolQuery `json:"query"`
 }
@@ -169,6 +208,9 @@ type KiteWithToken struct {
 	URL   string `json:"url"`
 	KeyID string `json:"keyId,omitempty"`
 	Token string `json:"token"`
+
+	// URLs are additional URLs the kite is reachable at.
+	URLs []AdvertisedURL `json:"urls,omitempty"`
 }
 
 // KiteEvent is the struct that is sent as an argument in watchCallback of
@@ -215,3 +257,83 @@ func (k KontrolQuery) Fields() map[string]string {
 		"id":          k.ID,
 	}
 }
+
+// Lease is a leadership of an election held by a single kite
+// until it expires, unless renewed.
+type Lease struct {
+	// Name is the name of the election.
+	Name string `json:"name"`
+
+	// Holder is the ID of the kite holding the lease.
+	Holder string `json:"holder"`
+
+	// ExpiresAt is the time the lease expires at.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LeaseArgs are the arguments of the "kontrol.acquireLease" and
+// "kontrol.releaseLease" methods.
+type LeaseArgs struct {
+	// Name is the name of the election.
+	Name string `json:"name"`
+
+	// TTL is the time the lease is acquired or renewed for.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// SemaphoreArgs are the arguments of the "kontrol.acquireSemaphore" and
+// "kontrol.releaseSemaphore" methods.
+type SemaphoreArgs struct {
+	// Name is the name of the semaphore.
+	Name string `json:"name"`
+
+	// Limit is the number of holders the semaphore allows at once,
+	// 1 for locks. All holders of the semaphore must use the same limit.
+	Limit int `json:"limit"`
+
+	// Token identifies the holder among the ones of the calling kite.
+	Token string `json:"token"`
+
+	// Slot is the slot of the semaphore to renew or release. If negative,
+	// any free slot is acquired.
+	Slot int `json:"slot"`
+
+	// TTL is the time the slot is acquired or renewed for.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// SemaphoreResult is the result of the "kontrol.acquireSemaphore" method.
+type SemaphoreResult struct {
+	// Acquired tells whether the slot was acquired or renewed.
+	Acquired bool `json:"acquired"`
+
+	// Slot is the acquired slot.
+	Slot int `json:"slot"`
+}
+
+// RevokedToken describes a token that must no longer be accepted,
+// even though it has not expired yet.
+type RevokedToken struct {
+	// ID is the value of the token's jti claim.
+	ID string `json:"id"`
+
+	// ExpiresAt is the value of the token's exp claim. The revocation
+	// is dropped after that time, as the token is no longer valid anyway.
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// WindowArgs is the argument of the kite.window method, which grants
+// the remote kite credit to send more messages, see flow control in
+// Config.ReceiveWindow.
+type WindowArgs struct {
+	// Messages is the number of messages the remote kite may send.
+	Messages int `json:"messages"`
+
+	// Bytes is the number of bytes the remote kite may send. Zero means
+	// the window is not limited by size.
+	Bytes int `json:"bytes,omitempty"`
+
+	// Reset is true for the initial advertisement, which replaces the
+	// credit left from the previous session instead of adding to it.
+	Reset bool `json:"reset,omitempty"`
+}
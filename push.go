@@ -0,0 +1,66 @@
+package kite
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// PushResult is the reply of a single connection to Kite.Push.
+type PushResult struct {
+	// ID and Kite identify the connection, as in AdminConnection.
+	ID   string
+	Kite protocol.Kite
+
+	Result *dnode.Partial
+	Err    error
+}
+
+// Push calls the method with args on the clients connected to the kite's
+// server, which are selected by the query, so the server notifies them
+// without them polling. A single connection is selected by its ID with
+// ConnectionQuery.Connection.
+//
+// The calls are made concurrently, Push waits for their replies, or for
+// the ctx to be done. The results are ordered by the connection ID.
+func (k *Kite) Push(ctx context.Context, q *ConnectionQuery, method string, args ...interface{}) []*PushResult {
+	ccs := k.connectedClients(q)
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]*PushResult, 0, len(ccs))
+	)
+
+	for id, cc := range ccs {
+		cc.client.m.RLock()
+		res := &PushResult{
+			ID:   id,
+			Kite: cc.client.Kite,
+		}
+		cc.client.m.RUnlock()
+
+		results = append(results, res)
+
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+
+			res.Result, res.Err = c.TellWithContext(ctx, method, args...)
+		}(cc.client)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	if len(results) == 0 {
+		k.Log.Debug("push %s: no connections selected", method)
+	}
+
+	return results
+}
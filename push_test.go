@@ -0,0 +1,79 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestPush(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("push-server", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dial := func(name string) *Client {
+		k := New(name, "0.0.1")
+		k.HandleFunc("notify", func(r *Request) (interface{}, error) {
+			return name + ":" + r.Args.One().MustString(), nil
+		})
+
+		c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+
+		// The identity of a connected kite is known after its first call.
+		if _, err := c.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+			t.Fatalf("kite.ping: %s", err)
+		}
+
+		return c
+	}
+
+	for _, name := range []string{"first", "second", "first"} {
+		c := dial(name)
+		defer c.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	results := srv.Push(ctx, &ConnectionQuery{Name: "first"}, "notify", "hello")
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("%s: %s", res.ID, res.Err)
+		}
+
+		if got := res.Result.MustString(); got != "first:hello" {
+			t.Fatalf("got %q, want %q", got, "first:hello")
+		}
+	}
+
+	id := results[0].ID
+
+	results = srv.Push(ctx, &ConnectionQuery{Connection: id}, "notify", "you")
+	if len(results) != 1 || results[0].ID != id {
+		t.Fatalf("got %+v, want single result of %s", results, id)
+	}
+
+	if got := results[0].Result.MustString(); got != "first:you" {
+		t.Fatalf("got %q, want %q", got, "first:you")
+	}
+
+	results = srv.Push(ctx, &ConnectionQuery{Name: "third"}, "notify", "nobody")
+	if len(results) != 0 {
+		t.Fatalf("got %d results, want 0", len(results))
+	}
+}
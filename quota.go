@@ -0,0 +1,269 @@
+package kite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota limits usage of a kite by a single caller, identified by the
+// authenticated username, see Kite.Quota.
+//
+// Usage is accounted in sliding windows, estimated from counters of the
+// current and previous fixed windows, so bursts at window boundaries
+// cannot exceed the limits twice.
+type Quota struct {
+	// CallsPerMinute is the number of calls the caller may make within
+	// a minute. Zero means no limit.
+	CallsPerMinute int64
+
+	// BytesPerHour is the size of encoded arguments the caller may send
+	// within an hour. Zero means no limit.
+	BytesPerHour int64
+}
+
+// QuotaStore keeps counters used to account usage of quotas. Using
+// an external store lets multiple instances of a kite share quotas.
+type QuotaStore interface {
+	// Add adds n to the counter with the given key and gives its new
+	// value. Counters, which do not exist, start at zero. The counter
+	// expires after ttl.
+	Add(key string, n int64, ttl time.Duration) (int64, error)
+
+	// Get gives the value of the counter with the given key, or zero
+	// if it does not exist.
+	Get(key string) (int64, error)
+}
+
+// SetCallerQuota sets the quota of the caller with the given username,
+// overriding Kite.Quota. A nil quota removes the override.
+func (k *Kite) SetCallerQuota(username string, q *Quota) {
+	k.quotasMu.Lock()
+	defer k.quotasMu.Unlock()
+
+	if q == nil {
+		delete(k.quotas, username)
+		return
+	}
+
+	if k.quotas == nil {
+		k.quotas = make(map[string]*Quota)
+	}
+
+	k.quotas[username] = q
+}
+
+func (k *Kite) callerQuota(username string) *Quota {
+	k.quotasMu.RLock()
+	defer k.quotasMu.RUnlock()
+
+	if q, ok := k.quotas[username]; ok {
+		return q
+	}
+
+	return k.Quota
+}
+
+func (k *Kite) quotaStore() QuotaStore {
+	if k.QuotaStore != nil {
+		return k.QuotaStore
+	}
+
+	return k.defaultQuotaStore
+}
+
+// checkQuota accounts the request in the quota of the caller and gives
+// a quotaExceeded error, if it exceeds the quota. Calls of kite.* methods
+// are not accounted.
+//
+// Failures of the store are logged and the request is let through.
+func (r *Request) checkQuota() *Error {
+	k := r.LocalKite
+
+	q := k.callerQuota(r.Username)
+	if q == nil || strings.HasPrefix(r.Method, "kite.") {
+		return nil
+	}
+
+	var size int64
+	if r.Args != nil {
+		size = int64(len(r.Args.Raw))
+	}
+
+	limits := []struct {
+		name   string
+		limit  int64
+		window time.Duration
+		n      int64
+	}{
+		{"callsPerMinute", q.CallsPerMinute, time.Minute, 1},
+		{"bytesPerHour", q.BytesPerHour, time.Hour, size},
+	}
+
+	// Undoes accounting of the limits passed before one is exceeded.
+	var undo []func()
+
+	now := time.Now()
+
+	for _, l := range limits {
+		if l.limit == 0 || l.n == 0 {
+			continue
+		}
+
+		w := slidingWindow{
+			store:  k.quotaStore(),
+			key:    "quota:" + l.name + ":" + r.Username,
+			window: l.window,
+		}
+
+		retryAfter, ok, err := w.add(now, l.n, l.limit)
+		if err != nil {
+			k.Log.Warning("quota of %q: %s", r.Username, err)
+			return nil
+		}
+
+		if !ok {
+			for _, f := range undo {
+				f()
+			}
+
+			return &Error{
+				Type:       "quotaExceeded",
+				Message:    fmt.Sprintf("The quota of %s is exceeded.", l.name),
+				RequestID:  r.ID,
+				RetryAfter: milliseconds(retryAfter),
+				RateLimit:  l.limit,
+				Details: map[string]interface{}{
+					"quota": l.name,
+					"limit": l.limit,
+				},
+			}
+		}
+
+		n := l.n
+		undo = append(undo, func() { w.undo(now, n) })
+	}
+
+	return nil
+}
+
+// slidingWindow estimates the usage within the sliding window from
+// counters of the current and the previous fixed windows, weighting
+// the previous one by its overlap with the sliding window.
+type slidingWindow struct {
+	store  QuotaStore
+	key    string
+	window time.Duration
+}
+
+// add adds n to the usage, unless it would exceed the limit. If it does,
+// it gives the estimated time after which the usage fits into the limit.
+func (w *slidingWindow) add(now time.Time, n, limit int64) (time.Duration, bool, error) {
+	index := now.UnixNano() / int64(w.window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(w.window))
+
+	current, err := w.store.Add(w.counter(index), n, 2*w.window)
+	if err != nil {
+		return 0, false, err
+	}
+
+	previous, err := w.store.Get(w.counter(index - 1))
+	if err != nil {
+		return 0, false, err
+	}
+
+	weight := 1 - float64(elapsed)/float64(w.window)
+	if float64(previous)*weight+float64(current) <= float64(limit) {
+		return 0, true, nil
+	}
+
+	if _, err := w.store.Add(w.counter(index), -n, 2*w.window); err != nil {
+		return 0, false, err
+	}
+
+	// Until the end of the window, only the weight of the previous
+	// window decreases.
+	retryAfter := w.window - elapsed
+	if previous > 0 && current <= limit {
+		overlap := float64(limit-current) / float64(previous)
+		retryAfter = time.Duration((1-overlap)*float64(w.window)) - elapsed
+	}
+
+	return retryAfter, false, nil
+}
+
+func (w *slidingWindow) undo(now time.Time, n int64) {
+	index := now.UnixNano() / int64(w.window)
+	w.store.Add(w.counter(index), -n, 2*w.window)
+}
+
+func (w *slidingWindow) counter(index int64) string {
+	return w.key + ":" + strconv.FormatInt(index, 10)
+}
+
+// MemoryQuotaStore is an in-memory QuotaStore. Quotas are not shared
+// between instances of a kite and are reset when the kite is restarted.
+type MemoryQuotaStore struct {
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	lastSweep time.Time
+}
+
+type memoryCounter struct {
+	value   int64
+	expires time.Time
+}
+
+var _ QuotaStore = (*MemoryQuotaStore)(nil)
+
+// NewMemoryQuotaStore gives new in-memory quota store.
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{
+		counters: make(map[string]*memoryCounter),
+	}
+}
+
+// Add implements the QuotaStore interface.
+func (m *MemoryQuotaStore) Add(key string, n int64, ttl time.Duration) (int64, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop expired counters, which are not going to be requested again.
+	if now.Sub(m.lastSweep) > time.Minute {
+		for key, c := range m.counters {
+			if now.After(c.expires) {
+				delete(m.counters, key)
+			}
+		}
+
+		m.lastSweep = now
+	}
+
+	c, ok := m.counters[key]
+	if !ok || now.After(c.expires) {
+		c = &memoryCounter{}
+		m.counters[key] = c
+	}
+
+	c.value += n
+	c.expires = now.Add(ttl)
+
+	return c.value, nil
+}
+
+// Get implements the QuotaStore interface.
+func (m *MemoryQuotaStore) Get(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.counters[key]
+	if !ok || time.Now().After(c.expires) {
+		return 0, nil
+	}
+
+	return c.value, nil
+}
@@ -0,0 +1,112 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kiteerr"
+)
+
+func TestQuota(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("quota-server", "0.0.1", cfg)
+	srv.Quota = &Quota{CallsPerMinute: 3, BytesPerHour: 1000}
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("quota-client", "0.0.1")
+	k.Config.Username = "alice"
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.TellWithTimeout("echo", 4*time.Second, "hi"); err != nil {
+			t.Fatalf("%d: Tell()=%s", i, err)
+		}
+	}
+
+	// Internal methods are not accounted.
+	if _, err := c.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping=%s", err)
+	}
+
+	_, err := c.TellWithTimeout("echo", 4*time.Second, "hi")
+
+	e, ok := err.(*Error)
+	if !ok || e.Type != "quotaExceeded" || e.Details["quota"] != "callsPerMinute" {
+		t.Fatalf("got %v, want quotaExceeded error", err)
+	}
+
+	if e.RateLimit != 3 || RetryAfter(err) <= 0 || RetryAfter(err) > time.Minute {
+		t.Fatalf("got limit %d, retry after %s", e.RateLimit, RetryAfter(err))
+	}
+
+	if e.ErrorCode() != kiteerr.Unavailable {
+		t.Fatalf("got code %q, want %q", e.ErrorCode(), kiteerr.Unavailable)
+	}
+
+	srv.SetCallerQuota("alice", &Quota{BytesPerHour: 100})
+
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "hi"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	_, err = c.TellWithTimeout("echo", 4*time.Second, strings.Repeat("x", 100))
+	if e, ok := err.(*Error); !ok || e.Type != "quotaExceeded" || e.Details["quota"] != "bytesPerHour" {
+		t.Fatalf("got %v, want quotaExceeded error", err)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := &slidingWindow{
+		store:  NewMemoryQuotaStore(),
+		key:    "test",
+		window: time.Minute,
+	}
+
+	start := time.Unix(0, 0).Add(time.Hour)
+
+	for i := 0; i < 10; i++ {
+		if _, ok, err := w.add(start, 1, 10); !ok || err != nil {
+			t.Fatalf("%d: add()=%t, %v", i, ok, err)
+		}
+	}
+
+	if _, ok, _ := w.add(start.Add(59*time.Second), 1, 10); ok {
+		t.Fatal("want the limit to be exceeded within the window")
+	}
+
+	// A quarter into the next window, the previous one still weights 3/4.
+	next := start.Add(75 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		if _, ok, err := w.add(next, 1, 10); !ok || err != nil {
+			t.Fatalf("%d: add()=%t, %v", i, ok, err)
+		}
+	}
+
+	retryAfter, ok, _ := w.add(next, 1, 10)
+	if ok {
+		t.Fatal("want the limit to be exceeded in the sliding window")
+	}
+
+	// 7.5 + 2 calls fit, the third one fits, once the previous
+	// window weights 7/10, in 3 seconds.
+	if retryAfter != 3*time.Second {
+		t.Fatalf("got retry after %s, want 3s", retryAfter)
+	}
+}
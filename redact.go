@@ -0,0 +1,302 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// RedactedValue replaces redacted values in logs.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactKeys lists JSON object keys, which values are always
+// redacted in logs, regardless of the kite configuration.
+var DefaultRedactKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"key",
+	"kiteKey",
+	"accessToken",
+	"refreshToken",
+}
+
+// RedactKeys adds JSON object keys, which values are going to be redacted
+// in logged messages. Keys are matched case-insensitively.
+func (k *Kite) RedactKeys(keys ...string) {
+	k.redactMu.Lock()
+	defer k.redactMu.Unlock()
+
+	if k.redactKeys == nil {
+		k.redactKeys = make(map[string]bool)
+	}
+
+	for _, key := range keys {
+		k.redactKeys[strings.ToLower(key)] = true
+	}
+}
+
+// RedactType registers the type of v, so values of its fields tagged with
+// `kite:"redact"` are redacted in logged messages. Nested types are
+// registered as well.
+//
+// It is needed for logging raw messages, which do not carry Go types; values
+// passed to Redact are redacted according to their tags without registration.
+func (k *Kite) RedactType(v interface{}) {
+	var keys []string
+	collectRedacted(reflect.TypeOf(v), make(map[reflect.Type]bool), &keys)
+	k.RedactKeys(keys...)
+}
+
+func collectRedacted(t reflect.Type, seen map[reflect.Type]bool, keys *[]string) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if name, ok := jsonName(f); ok && isRedacted(f) {
+			*keys = append(*keys, name)
+			continue
+		}
+
+		collectRedacted(f.Type, seen, keys)
+	}
+}
+
+// Redact gives a copy of v suitable for logging and auditing, where values
+// of struct fields tagged with `kite:"redact"` are replaced with
+// RedactedValue. The original value, which is sent over the wire,
+// is not modified.
+//
+// Structs are converted to maps keyed by their JSON field names.
+func Redact(v interface{}) interface{} {
+	return redactValue(reflect.ValueOf(v))
+}
+
+func redactValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Struct:
+		// Keep types with custom encoding as they are, e.g. time.Time.
+		if _, ok := v.Interface().(json.Marshaler); ok {
+			return v.Interface()
+		}
+
+		m := make(map[string]interface{})
+		redactStruct(v, m)
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // []byte
+		}
+
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = redactValue(v.Index(i))
+		}
+		return s
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+
+		m := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			m[key.String()] = redactValue(v.MapIndex(key))
+		}
+		return m
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil // not encodable
+	default:
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+}
+
+func redactStruct(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+
+			if fv.Kind() == reflect.Struct {
+				redactStruct(fv, m)
+				continue
+			}
+		}
+
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+
+		if isRedacted(f) {
+			m[name] = RedactedValue
+		} else {
+			m[name] = redactValue(v.Field(i))
+		}
+	}
+}
+
+// jsonName gives the name of the field in JSON encoding.
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+
+	return f.Name, true
+}
+
+func isRedacted(f reflect.StructField) bool {
+	for _, opt := range strings.Split(f.Tag.Get("kite"), ",") {
+		if opt == "redact" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redact masks secrets in the JSON-encoded message p.
+func (k *Kite) redact(p []byte) []byte {
+	if k.Redact != nil {
+		return k.Redact(p)
+	}
+
+	if len(p) == 0 {
+		return p
+	}
+
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		return []byte(RedactedValue)
+	}
+
+	k.redactMu.RLock()
+	v = k.redactKnown(v)
+	k.redactMu.RUnlock()
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return []byte(RedactedValue)
+	}
+
+	return out
+}
+
+// redactKnown replaces values of known secret keys in the decoded JSON
+// value. It is called with k.redactMu held.
+func (k *Kite) redactKnown(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if k.isRedactKey(key) {
+				v[key] = RedactedValue
+			} else {
+				v[key] = k.redactKnown(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = k.redactKnown(val)
+		}
+	}
+
+	return v
+}
+
+func (k *Kite) isRedactKey(key string) bool {
+	key = strings.ToLower(key)
+
+	if k.redactKeys[key] {
+		return true
+	}
+
+	for _, s := range DefaultRedactKeys {
+		if strings.ToLower(s) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redacted formats a JSON-encoded message with secrets masked. It is
+// passed to loggers, so the message is redacted only when it is logged.
+type redacted struct {
+	k *Kite
+	p []byte
+}
+
+// String implements the fmt.Stringer interface.
+func (r redacted) String() string {
+	return string(r.k.redact(r.p))
+}
+
+// redactedArgs formats call arguments with secrets masked.
+type redactedArgs struct {
+	k    *Kite
+	args []interface{}
+}
+
+// String implements the fmt.Stringer interface.
+func (r redactedArgs) String() string {
+	p, err := json.Marshal(Redact(r.args))
+	if err != nil {
+		return RedactedValue
+	}
+
+	return string(r.k.redact(p))
+}
+
+// RedactedArgs gives JSON-encoded arguments of the request with secrets
+// masked, suitable for audit records and traces.
+func (r *Request) RedactedArgs() string {
+	if r.Args == nil {
+		return "null"
+	}
+
+	return string(r.LocalKite.redact(r.Args.Raw))
+}
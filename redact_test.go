@@ -0,0 +1,95 @@
+package kite
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type redactCredentials struct {
+	User     string `json:"user"`
+	Password string `json:"password" kite:"redact"`
+	PIN      int    `json:"pin" kite:"redact"`
+}
+
+type redactLogin struct {
+	redactCredentials
+	Server  string             `json:"server"`
+	Backup  *redactCredentials `json:"backup,omitempty"`
+	Ignored string             `json:"-"`
+}
+
+func TestRedact(t *testing.T) {
+	v := &redactLogin{
+		redactCredentials: redactCredentials{User: "john", Password: "secret", PIN: 1234},
+		Server:            "example.com",
+		Backup:            &redactCredentials{User: "jane", Password: "secret"},
+		Ignored:           "ignored",
+	}
+
+	want := map[string]interface{}{
+		"user":     "john",
+		"password": RedactedValue,
+		"pin":      RedactedValue,
+		"server":   "example.com",
+		"backup": map[string]interface{}{
+			"user":     "jane",
+			"password": RedactedValue,
+			"pin":      RedactedValue,
+		},
+	}
+
+	if got := Redact(v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+
+	if v.Password != "secret" {
+		t.Fatal("want the original value to be left unmodified")
+	}
+
+	k := New("redact", "0.0.1")
+	k.RedactType(redactLogin{})
+	k.RedactKeys("creditCard")
+
+	p, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"authentication": &Auth{Type: "kiteKey", Key: "secret"},
+			"withArgs": []interface{}{
+				v,
+				map[string]string{"CreditCard": "4111", "note": "hi"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got interface{}
+	if err := json.Unmarshal(k.redact(p), &got); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	wantMsg := []interface{}{
+		map[string]interface{}{
+			"authentication": map[string]interface{}{"type": "kiteKey", "key": RedactedValue},
+			"withArgs": []interface{}{
+				map[string]interface{}{
+					"user":     "john",
+					"password": RedactedValue,
+					"pin":      RedactedValue,
+					"server":   "example.com",
+					"backup": map[string]interface{}{
+						"user":     "jane",
+						"password": RedactedValue,
+						"pin":      RedactedValue,
+					},
+				},
+				map[string]interface{}{"CreditCard": RedactedValue, "note": "hi"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, wantMsg) {
+		t.Fatalf("got %#v, want %#v", got, wantMsg)
+	}
+}
@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/koding/kite"
+)
+
+// DefaultQuotaPrefix is prepended to quota counter keys to build Redis keys.
+const DefaultQuotaPrefix = "kite:"
+
+// QuotaStore is a kite.QuotaStore, which keeps each counter as a Redis
+// integer, so quotas are shared between kite instances.
+type QuotaStore struct {
+	// Pool is used to get Redis connections.
+	//
+	// Required.
+	Pool *redis.Pool
+
+	// Prefix is prepended to counter keys to build Redis keys.
+	//
+	// If empty, DefaultQuotaPrefix is used.
+	Prefix string
+}
+
+var _ kite.QuotaStore = (*QuotaStore)(nil)
+
+// NewQuotaStore gives new quota store using the given pool.
+func NewQuotaStore(pool *redis.Pool) *QuotaStore {
+	return &QuotaStore{
+		Pool: pool,
+	}
+}
+
+// Add implements the kite.QuotaStore interface.
+func (s *QuotaStore) Add(key string, n int64, ttl time.Duration) (int64, error) {
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("INCRBY", s.key(key), n)
+	conn.Send("PEXPIRE", s.key(key), int64(ttl/time.Millisecond))
+
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+
+	return redis.Int64(values[0], nil)
+}
+
+// Get implements the kite.QuotaStore interface.
+func (s *QuotaStore) Get(key string) (int64, error) {
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("GET", s.key(key)))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+
+	return n, err
+}
+
+func (s *QuotaStore) key(key string) string {
+	if s.Prefix != "" {
+		return s.Prefix + key
+	}
+
+	return DefaultQuotaPrefix + key
+}
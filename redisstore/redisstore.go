@@ -0,0 +1,90 @@
+// Package redisstore implements kite.SessionStore and kite.QuotaStore
+// backed by Redis, so sessions and quotas are shared between kite
+// instances behind a load balancer.
+package redisstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/koding/kite"
+)
+
+// DefaultPrefix is prepended to session IDs to build Redis keys.
+const DefaultPrefix = "kite:session:"
+
+// SessionStore is a kite.SessionStore, which keeps each session as
+// a single JSON-encoded Redis value expiring together with the session.
+type SessionStore struct {
+	// Pool is used to get Redis connections.
+	//
+	// Required.
+	Pool *redis.Pool
+
+	// Prefix is prepended to session IDs to build Redis keys.
+	//
+	// If empty, DefaultPrefix is used.
+	Prefix string
+}
+
+var _ kite.SessionStore = (*SessionStore)(nil)
+
+// NewSessionStore gives new session store using the given pool.
+func NewSessionStore(pool *redis.Pool) *SessionStore {
+	return &SessionStore{
+		Pool: pool,
+	}
+}
+
+// Get implements the kite.SessionStore interface.
+func (s *SessionStore) Get(id string) (map[string]json.RawMessage, error) {
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	p, err := redis.Bytes(conn.Do("GET", s.key(id)))
+	if err == redis.ErrNil {
+		return nil, kite.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(p, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Put implements the kite.SessionStore interface.
+func (s *SessionStore) Put(id string, values map[string]json.RawMessage, ttl time.Duration) error {
+	p, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("SET", s.key(id), p, "PX", int64(ttl/time.Millisecond))
+	return err
+}
+
+// Delete implements the kite.SessionStore interface.
+func (s *SessionStore) Delete(id string) error {
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", s.key(id))
+	return err
+}
+
+func (s *SessionStore) key(id string) string {
+	if s.Prefix != "" {
+		return s.Prefix + id
+	}
+
+	return DefaultPrefix + id
+}
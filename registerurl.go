@@ -18,7 +18,7 @@ const publicEcho = "http://echoip.com"
 // method to get a Registration URL that can be passed to Kontrol (via the
 // methods Register(), RegisterToProxy(), etc.) It needs to be called after all
 // configurations are done (like TLS, Port,etc.). If local is true a local IP
-// is used, otherwise a public IP is being used.
+// is used, otherwise a public IP is being used, see PublicIP.
 func (k *Kite) RegisterURL(local bool) *url.URL {
 	var ip net.IP
 	var err error
@@ -29,7 +29,7 @@ func (k *Kite) RegisterURL(local bool) *url.URL {
 			return nil
 		}
 	} else {
-		ip, err = publicIP()
+		ip, err = k.PublicIP()
 		if err != nil {
 			return nil
 		}
@@ -76,6 +76,96 @@ func localIP() (net.IP, error) {
 	return nil, errors.New("cannot find local IP address")
 }
 
+// PublicIP detects the IP the kite is reachable at from the internet,
+// e.g. the address of the NAT the host is behind. The following are
+// asked in order, until one of them answers:
+//
+//   - Kontrol, for the address the kite connected from, if
+//     Config.KontrolURL is set
+//   - the STUN servers given by STUNServers
+//   - an HTTP echo service
+//
+// A private address echoed by Kontrol is used only if none of the others
+// answered, as Kontrol may be reached over a private network.
+func (k *Kite) PublicIP() (net.IP, error) {
+	var private net.IP
+
+	if k.Config.KontrolURL != "" {
+		ip, err := k.kontrolEchoIP()
+		switch {
+		case err != nil:
+			k.Log.Debug("unable to get address echoed by kontrol: %s", err)
+		case isPrivateIP(ip):
+			private = ip
+		default:
+			return ip, nil
+		}
+	}
+
+	servers := k.STUNServers
+	if servers == nil {
+		servers = DefaultSTUNServers
+	}
+
+	for _, server := range servers {
+		ip, err := stunIP(server, DefaultSTUNTimeout)
+		if err == nil {
+			return ip, nil
+		}
+
+		k.Log.Debug("unable to get address from STUN server %s: %s", server, err)
+	}
+
+	ip, err := publicIP()
+	if err != nil && private != nil {
+		return private, nil
+	}
+
+	return ip, err
+}
+
+func (k *Kite) kontrolEchoIP() (net.IP, error) {
+	result, err := k.TellKontrolWithTimeout("kontrol.echoAddress", k.CallTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	var addr string
+
+	if err := result.Unmarshal(&addr); err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("cannot parse ip %s", addr)
+	}
+
+	return ip, nil
+}
+
+var privateNets = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// isPrivateIP tells whether the IP is not reachable from the internet.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || containsIP(privateNets, ip)
+}
+
 // publicIP returns an IP that is supposed to be Public.
 func publicIP() (net.IP, error) {
 	resp, err := http.Get(publicEcho)
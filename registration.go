@@ -0,0 +1,266 @@
+package kite
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultRegistryCheckInterval is the time between checks of the URL
+	// the kite is registered with, if RegistryOptions.CheckInterval is zero.
+	DefaultRegistryCheckInterval = time.Minute
+
+	// DefaultRegistryJitter is the fraction by which intervals between
+	// registration attempts are randomized, if RegistryOptions.Jitter
+	// is zero.
+	DefaultRegistryJitter = 0.2
+)
+
+var errNoRegisterURL = errors.New("unable to determine register URL")
+
+// RegistryOptions configures RegisterToRegistry.
+type RegistryOptions struct {
+	// URL gives the URL the kite is registered with. It is called again
+	// every CheckInterval and the kite registers again, once the URL
+	// changes, e.g. after the IP of the host changed.
+	//
+	// If nil, RegisterURL(Local) is used.
+	URL func() *url.URL
+
+	// Local makes the default URL use a local IP instead of the public one.
+	Local bool
+
+	// CheckInterval is the time between checks of the URL.
+	//
+	// If zero, DefaultRegistryCheckInterval is used.
+	CheckInterval time.Duration
+
+	// RetryInterval is the time between failed registration attempts.
+	//
+	// If zero, it is 10s.
+	RetryInterval time.Duration
+
+	// Jitter is the fraction by which the intervals are randomized, so
+	// a fleet of kites does not hit Kontrol at once.
+	//
+	// If zero, DefaultRegistryJitter is used.
+	Jitter float64
+
+	// NetworkPollInterval is the time between checks of the addresses
+	// of the host, see WatchNetwork. The kite registers again after
+	// the network changed.
+	//
+	// If zero, DefaultNetworkPollInterval is used. If negative, the
+	// network is not watched.
+	NetworkPollInterval time.Duration
+}
+
+// Registration keeps the kite registered to Kontrol, see RegisterToRegistry.
+type Registration struct {
+	k    *Kite
+	opts RegistryOptions
+
+	mu  sync.Mutex
+	url *url.URL // the kite is registered with, nil if not registered
+
+	again        chan struct{} // forces registration, e.g. after reconnect
+	stopWatching func()        // stops watching the network, if non-nil
+	stop         chan struct{}
+	done         chan struct{}
+	once         sync.Once
+}
+
+// RegisterToRegistry registers the kite to Kontrol and keeps it registered
+// until the returned registration is closed:
+//
+//   - the kite registers again after reconnecting to Kontrol
+//   - the kite registers again with a new URL, once the URL changes
+//   - the kite reconnects and registers again after the network changed
+//   - failed registration attempts are retried
+//
+// Heartbeats are sent by the kite to Kontrol each interval requested by
+// Kontrol during registration. Close the registration before closing
+// the kite on shutdown, so the kite is deregistered from Kontrol:
+//
+//	reg, err := k.RegisterToRegistry(nil)
+//	if err != nil {
+//	    k.Log.Warning("registration failed, retrying: %s", err)
+//	}
+//	defer reg.Close()
+//
+// It blocks until the first registration attempt is done and returns its
+// error. The registration is retried in the background nevertheless.
+// If opts is nil, default options are used.
+func (k *Kite) RegisterToRegistry(opts *RegistryOptions) (*Registration, error) {
+	if err := k.SetupKontrolClient(); err != nil {
+		return nil, err
+	}
+
+	reg := &Registration{
+		k:     k,
+		again: make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if opts != nil {
+		reg.opts = *opts
+	}
+
+	if reg.opts.URL == nil {
+		local := reg.opts.Local
+		reg.opts.URL = func() *url.URL {
+			return k.RegisterURL(local)
+		}
+	}
+
+	k.kontrol.OnConnect(reg.registerAgain)
+
+	if reg.opts.NetworkPollInterval >= 0 {
+		k.OnNetworkChange(func(*NetworkChange) { reg.registerAgain() })
+		reg.stopWatching = k.WatchNetwork(reg.opts.NetworkPollInterval)
+	}
+
+	err := reg.register()
+
+	// The kite was registered after connecting to Kontrol already.
+	select {
+	case <-reg.again:
+	default:
+	}
+
+	go reg.run(err == nil)
+
+	return reg, err
+}
+
+// URL gives the URL the kite is registered with, or nil if it is not
+// registered.
+func (reg *Registration) URL() *url.URL {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	return reg.url
+}
+
+// Close stops keeping the kite registered and deregisters it from Kontrol.
+func (reg *Registration) Close() error {
+	reg.once.Do(func() {
+		close(reg.stop)
+	})
+
+	<-reg.done
+
+	if reg.stopWatching != nil {
+		reg.stopWatching()
+	}
+
+	reg.mu.Lock()
+	registered := reg.url != nil
+	reg.url = nil
+	reg.mu.Unlock()
+
+	if !registered {
+		return nil
+	}
+
+	// Stop sending heartbeats to Kontrol.
+	select {
+	case reg.k.heartbeatC <- nil:
+	default:
+	}
+
+	_, err := reg.k.kontrol.TellWithTimeout("deregister", reg.k.CallTimeout())
+	return err
+}
+
+// registerAgain makes the kite register again.
+func (reg *Registration) registerAgain() {
+	select {
+	case reg.again <- struct{}{}:
+	default:
+	}
+}
+
+// register registers the kite with the current URL.
+func (reg *Registration) register() error {
+	u := reg.opts.URL()
+	if u == nil {
+		return errNoRegisterURL
+	}
+
+	if _, err := reg.k.Register(u); err != nil {
+		reg.k.Log.Error("Cannot register to Kontrol: %s", err)
+		return err
+	}
+
+	reg.mu.Lock()
+	reg.url = u
+	reg.mu.Unlock()
+
+	reg.k.signalReady()
+
+	return nil
+}
+
+func (reg *Registration) run(registered bool) {
+	defer close(reg.done)
+
+	for {
+		interval := reg.opts.CheckInterval
+		if interval == 0 {
+			interval = DefaultRegistryCheckInterval
+		}
+
+		if !registered {
+			interval = reg.opts.RetryInterval
+			if interval == 0 {
+				interval = kontrolRetryDuration
+			}
+		}
+
+		select {
+		case <-reg.stop:
+			return
+		case <-reg.again:
+		case <-time.After(reg.jitter(interval)):
+			if registered && !reg.changed() {
+				continue
+			}
+		}
+
+		registered = reg.register() == nil
+	}
+}
+
+// changed tells whether the URL changed since the kite registered.
+func (reg *Registration) changed() bool {
+	u := reg.opts.URL()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if u == nil || reg.url == nil {
+		return u != reg.url
+	}
+
+	if u.String() != reg.url.String() {
+		reg.k.Log.Info("Register URL changed from %s to %s", reg.url, u)
+		return true
+	}
+
+	return false
+}
+
+func (reg *Registration) jitter(d time.Duration) time.Duration {
+	j := reg.opts.Jitter
+	if j == 0 {
+		j = DefaultRegistryJitter
+	}
+
+	// Randomize d within [d - j*d, d + j*d].
+	return d + time.Duration((2*rand.Float64()-1)*j*float64(d))
+}
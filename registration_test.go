@@ -0,0 +1,43 @@
+package kite
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRegistration_Jitter(t *testing.T) {
+	reg := &Registration{
+		opts: RegistryOptions{Jitter: 0.5},
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := reg.jitter(time.Second); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("got %s, want within [500ms, 1.5s]", d)
+		}
+	}
+}
+
+func TestRegistration_Changed(t *testing.T) {
+	u := &url.URL{Scheme: "http", Host: "10.0.0.1:3000", Path: "/kite"}
+
+	reg := &Registration{
+		k: New("registration", "0.0.1"),
+		opts: RegistryOptions{
+			URL: func() *url.URL {
+				return u
+			},
+		},
+		url: &url.URL{Scheme: "http", Host: "10.0.0.1:3000", Path: "/kite"},
+	}
+
+	if reg.changed() {
+		t.Fatal("want the URL to be unchanged")
+	}
+
+	u = &url.URL{Scheme: "http", Host: "10.0.0.2:3000", Path: "/kite"}
+
+	if !reg.changed() {
+		t.Fatal("want the URL to be changed")
+	}
+}
@@ -0,0 +1,174 @@
+package kite
+
+import (
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+)
+
+// RuntimeConfig gives the runtime configuration currently in use.
+//
+// The returned value must not be modified, use SetRuntimeConfig
+// to change it instead. It never contains the kite and Kontrol keys.
+func (k *Kite) RuntimeConfig() *config.Runtime {
+	if rc, ok := k.runtimeConfig.Load().(*config.Runtime); ok {
+		return rc
+	}
+
+	return &config.Runtime{}
+}
+
+// SetRuntimeConfig atomically swaps the runtime configuration of the kite.
+// Zero fields of rc leave the current values unchanged.
+//
+// Log level, request limits and auth keys take effect immediately, also
+// for already connected clients. Timeouts are used by calls and
+// connections made after the change. Config is not modified, timeouts
+// are read with CallTimeout and the configuration connections are dialed
+// with instead.
+func (k *Kite) SetRuntimeConfig(rc *config.Runtime) error {
+	if err := rc.Valid(); err != nil {
+		return err
+	}
+
+	k.runtimeMu.Lock()
+	defer k.runtimeMu.Unlock()
+
+	merged := k.RuntimeConfig().Merge(rc)
+
+	if rc.LogLevel != "" && k.SetLogLevel != nil {
+		k.SetLogLevel(parseLevel(rc.LogLevel))
+	}
+
+	if rc.KiteKey != "" || rc.KontrolKey != "" {
+		k.updateAuth(&protocol.RegisterResult{
+			KiteKey:   rc.KiteKey,
+			PublicKey: rc.KontrolKey,
+		})
+	}
+
+	// Keys are applied to the kite only, so they are not exposed by
+	// RuntimeConfig.
+	merged.KiteKey, merged.KontrolKey = "", ""
+
+	k.runtimeConfig.Store(merged)
+
+	k.Log.Info("runtime configuration updated")
+
+	return nil
+}
+
+// CallTimeout gives the timeout of calls made by the kite, which is
+// Config.Timeout, unless overwritten by the runtime configuration.
+func (k *Kite) CallTimeout() time.Duration {
+	if t := k.RuntimeConfig().Timeout; t != 0 {
+		return time.Duration(t)
+	}
+
+	return k.Config.Timeout
+}
+
+// httpClient gives Config.Client with the timeout of the runtime
+// configuration applied.
+func (k *Kite) httpClient() *http.Client {
+	client := k.Config.Client
+
+	if t := k.RuntimeConfig().Timeout; t != 0 && client != nil {
+		clientCopy := *client
+		clientCopy.Timeout = time.Duration(t)
+		client = &clientCopy
+	}
+
+	return client
+}
+
+// dialConfig gives Config with the timeouts of the runtime configuration
+// applied, for dialing connections.
+func (k *Kite) dialConfig() *config.Config {
+	rc := k.RuntimeConfig()
+
+	if rc.Timeout == 0 && rc.HandshakeTimeout == 0 {
+		return k.Config
+	}
+
+	cfg := k.Config.Copy()
+
+	if rc.Timeout != 0 {
+		cfg.Timeout = time.Duration(rc.Timeout)
+
+		if cfg.Client != nil {
+			cfg.Client.Timeout = time.Duration(rc.Timeout)
+		}
+	}
+
+	if rc.HandshakeTimeout != 0 && cfg.Websocket != nil {
+		cfg.Websocket.HandshakeTimeout = time.Duration(rc.HandshakeTimeout)
+	}
+
+	return cfg
+}
+
+// WatchConfigFile polls the given file for changes every interval and
+// applies its content with SetRuntimeConfig. The file is applied once
+// right away if it exists.
+//
+// The watch is stopped when the kite is closed.
+func (k *Kite) WatchConfigFile(file string, interval time.Duration) {
+	var modTime time.Time
+
+	reload := func() {
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().After(modTime) {
+			return
+		}
+
+		modTime = fi.ModTime()
+
+		rc, err := config.ReadRuntimeFile(file)
+		if err != nil {
+			k.Log.Error("config reload: %s", err)
+			return
+		}
+
+		if err := k.SetRuntimeConfig(rc); err != nil {
+			k.Log.Error("config reload: %s", err)
+		}
+	}
+
+	reload()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-k.closeC:
+				return
+			case <-t.C:
+				reload()
+			}
+		}
+	}()
+}
+
+// acquireRequest reserves a slot for a request being handled. It returns
+// false if the MaxConcurrentRequests limit is reached.
+func (k *Kite) acquireRequest() bool {
+	n := atomic.AddInt64(&k.activeRequests, 1)
+
+	if max := k.RuntimeConfig().MaxConcurrentRequests; max > 0 && n > int64(max) {
+		atomic.AddInt64(&k.activeRequests, -1)
+		return false
+	}
+
+	return true
+}
+
+func (k *Kite) releaseRequest() {
+	atomic.AddInt64(&k.activeRequests, -1)
+}
@@ -0,0 +1,66 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestSetRuntimeConfig_Timeouts(t *testing.T) {
+	cfg := config.New()
+	cfg.Timeout = time.Second
+
+	k := NewWithConfig("reload", "0.0.1", cfg)
+	defer k.Close()
+
+	handshake := k.Config.Websocket.HandshakeTimeout
+
+	err := k.SetRuntimeConfig(&config.Runtime{
+		Timeout:          config.Duration(3 * time.Second),
+		HandshakeTimeout: config.Duration(5 * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("SetRuntimeConfig()=%s", err)
+	}
+
+	if got := k.CallTimeout(); got != 3*time.Second {
+		t.Fatalf("got call timeout %s, want %s", got, 3*time.Second)
+	}
+
+	// Config is read without locking, so it must be left intact.
+	if k.Config.Timeout != time.Second || k.Config.Websocket.HandshakeTimeout != handshake {
+		t.Fatalf("Config was modified: %s, %s", k.Config.Timeout, k.Config.Websocket.HandshakeTimeout)
+	}
+
+	dial := k.dialConfig()
+
+	if dial.Timeout != 3*time.Second {
+		t.Fatalf("got dial timeout %s, want %s", dial.Timeout, 3*time.Second)
+	}
+
+	if dial.Websocket.HandshakeTimeout != 5*time.Second {
+		t.Fatalf("got handshake timeout %s, want %s", dial.Websocket.HandshakeTimeout, 5*time.Second)
+	}
+
+	if dial.Client != nil && dial.Client.Timeout != 3*time.Second {
+		t.Fatalf("got HTTP client timeout %s, want %s", dial.Client.Timeout, 3*time.Second)
+	}
+}
+
+func TestSetRuntimeConfig_Keys(t *testing.T) {
+	k := New("reload", "0.0.1")
+	defer k.Close()
+
+	if err := k.SetRuntimeConfig(&config.Runtime{KiteKey: "kite-key"}); err != nil {
+		t.Fatalf("SetRuntimeConfig()=%s", err)
+	}
+
+	if k.KiteKey() != "kite-key" {
+		t.Fatalf("got kite key %q, want %q", k.KiteKey(), "kite-key")
+	}
+
+	if rc := k.RuntimeConfig(); rc.KiteKey != "" || rc.KontrolKey != "" {
+		t.Fatalf("RuntimeConfig() exposes keys: %+v", rc)
+	}
+}
@@ -1,12 +1,14 @@
 package kite
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime/debug"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/juju/ratelimit"
 	"github.com/koding/cache"
 	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/kitekey"
@@ -18,6 +20,8 @@ import (
 // Request contains information about the incoming request.
 type Request struct {
 	// ID is an unique string, which may be used for tracing the request.
+	// It is generated by the caller and sent back in the Response, so
+	// proxies can match them, see Frame.RequestID.
 	ID string
 
 	// Method defines the method name which is invoked by the incoming request.
@@ -45,6 +49,85 @@ type Request struct {
 	// chain. This is useful with PreHandle and PostHandle handlers to pass
 	// data between handlers.
 	Context cache.Cache
+
+	// Deadline is the time the caller stops waiting for the response.
+	// It is zero if the caller does not use a timeout.
+	Deadline time.Time
+
+	// Delegate is the username of the kite which made the call on
+	// behalf of Username, when authenticated with a delegation token.
+	Delegate string
+
+	// Scopes the request is restricted to, as granted by the token.
+	// Empty means the request is not restricted.
+	Scopes []string
+
+	// MessageID identifies the call across retries made by the caller.
+	// It is empty if the caller did not set it with WithMessageID.
+	MessageID string
+
+	// Signature is the verified signature of the call. It is nil
+	// if the call was not signed, see Kite.SigningKey.
+	Signature *Signature
+
+	// Encrypted tells whether the arguments of the call were encrypted
+	// end-to-end, see PayloadPolicy.
+	Encrypted bool
+
+	// Headers are the headers of the call set by the caller,
+	// see WithHeader.
+	Headers map[string]string
+
+	options *callOptions
+	ctx     context.Context
+	bucket  *ratelimit.Bucket // request limit of the method, if any
+}
+
+// Ctx returns a context of the request. The context is canceled when
+// the caller's deadline is exceeded, the caller disconnects or the
+// method handler returns.
+//
+// Pass it to Client.TellWithContext when making nested calls to other
+// kites, so the whole call tree respects the original timeout.
+func (r *Request) Ctx() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+// withContext sets up the request context and returns a func that
+// releases its resources. The context is also canceled after the
+// given timeout, if it is non-zero.
+func (r *Request) withContext(timeout time.Duration) context.CancelFunc {
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	deadline := r.Deadline
+	if timeout > 0 {
+		if d := time.Now().Add(timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+
+	go func() {
+		select {
+		case <-r.Client.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	r.ctx = ctx
+
+	return cancel
 }
 
 // Response is the type of the object that is returned from request handlers
@@ -52,6 +135,13 @@ type Request struct {
 type Response struct {
 	Error  *Error      `json:"error" dnode:"-"`
 	Result interface{} `json:"result"`
+
+	// RequestID is the ID of the request the response is for,
+	// see Request.ID.
+	RequestID string `json:"requestId,omitempty"`
+
+	// Metadata describes the response, see ResponseMetadataOf.
+	Metadata *ResponseMetadata `json:"metadata,omitempty"`
 }
 
 // runMethod is called when a method is received from remote Kite.
@@ -74,17 +164,95 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 
 	// The request that will be constructed from incoming dnode message.
 	request, callFunc = c.newRequest(method.name, args)
+	request.bucket = method.bucket
+
+	cancel := request.withContext(method.timeout)
+	defer cancel()
+
+	if err := request.decryptArgs(); err != nil {
+		callFunc(nil, &Error{
+			Type:      "policyError",
+			Message:   fmt.Sprintf("unable to decrypt arguments: %s", err),
+			RequestID: request.ID,
+		})
+		return
+	}
+
+	if err := request.decompressArgs(); err != nil {
+		callFunc(nil, &Error{
+			Type:      "argumentError",
+			Message:   fmt.Sprintf("unable to decompress arguments: %s", err),
+			RequestID: request.ID,
+		})
+		return
+	}
+
 	if method.authenticate {
 		if err := request.authenticate(); err != nil {
 			callFunc(nil, createError(request, err))
 			return
 		}
+
+		if scope := request.missingScope(method.scopes); scope != "" {
+			callFunc(nil, &Error{
+				Type:      "authenticationError",
+				Message:   fmt.Sprintf("token is missing %q scope", scope),
+				RequestID: request.ID,
+			})
+			return
+		}
 	} else {
 		// if not validated accept any username it sends, also useful for test
 		// cases.
 		request.Username = request.Client.Kite.Username
 	}
 
+	if err := request.verifySignature(method.signed); err != nil {
+		callFunc(nil, &Error{
+			Type:      "authenticationError",
+			Message:   fmt.Sprintf("signature: %s", err),
+			RequestID: request.ID,
+		})
+		return
+	}
+
+	if err := request.checkPolicy(); err != nil {
+		callFunc(nil, &Error{
+			Type:      "policyError",
+			Message:   err.Error(),
+			RequestID: request.ID,
+		})
+		return
+	}
+
+	if request.expired() {
+		ExpiredMessages.Add(method.name, 1)
+		c.LocalKite.Log.Debug("dropping expired %s call (%s)", method.name, request.ID)
+
+		if c.LocalKite.NackExpired {
+			callFunc(nil, &Error{
+				Type:      "expired",
+				Message:   fmt.Sprintf("Call to %q method arrived after its expiry", method.name),
+				RequestID: request.ID,
+			})
+		}
+		return
+	}
+
+	if args, err := c.LocalKite.transformArgsIn(method.name, request.Args); err == nil {
+		request.Args = args
+		if args != nil {
+			args.Strict = method.strictArgs
+		}
+	} else {
+		callFunc(nil, &Error{
+			Type:      "argumentError",
+			Message:   fmt.Sprintf("unable to transform arguments: %s", err),
+			RequestID: request.ID,
+		})
+		return
+	}
+
 	method.mu.Lock()
 	if !method.initialized {
 		method.preHandlers = append(method.preHandlers, c.LocalKite.preHandlers...)
@@ -100,16 +268,47 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 	// span time larger than the bucket's frequency), there will be no token's
 	// available more so it will return a zero.
 	if method.bucket != nil && method.bucket.TakeAvailable(1) == 0 {
-		callFunc(nil, &Error{
-			Type:      "requestLimitError",
-			Message:   "The maximum request rate is exceeded.",
-			RequestID: request.ID,
-		})
+		callFunc(nil, rateLimitError(method.bucket, request.ID))
+		return
+	}
+
+	if err := request.checkQuota(); err != nil {
+		callFunc(nil, err)
+		return
+	}
+
+	if c.LocalKite.shed(method.name) {
+		callFunc(nil, overloadedError(request.ID))
 		return
 	}
 
-	// Call the handler functions.
-	result, err := method.ServeKite(request)
+	if !c.LocalKite.acquireRequest() {
+		callFunc(nil, concurrencyLimitError(c.LocalKite.RuntimeConfig().MaxConcurrentRequests, request.ID))
+		return
+	}
+	defer c.LocalKite.releaseRequest()
+	defer c.LocalKite.trackCall(request)()
+
+	// Call the handler functions, skipping already processed messages
+	// and hitting the result cache first if enabled.
+	serve := method.serve
+	if request.MessageID != "" && c.LocalKite.DedupStore != nil {
+		serve = func(r *Request) (interface{}, error) {
+			return c.LocalKite.dedup(method, r)
+		}
+	}
+
+	var result interface{}
+	var err error
+	if method.timeout > 0 {
+		result, err = method.serveWithTimeout(request, serve)
+	} else {
+		result, err = serve(request)
+	}
+
+	if it, ok := result.(Iterator); ok && err == nil {
+		result, err = c.LocalKite.firstPage(c, it)
+	}
 
 	callFunc(result, createError(request, err))
 }
@@ -143,14 +342,27 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 		})
 	}
 
+	if options.RequestID == "" {
+		options.RequestID = utils.RandomString(16)
+	}
+
 	request := &Request{
-		ID:        utils.RandomString(16),
+		ID:        options.RequestID,
 		Method:    method,
 		Args:      options.WithArgs,
 		LocalKite: c.LocalKite,
 		Client:    c,
 		Auth:      options.Auth,
 		Context:   cache.NewMemory(),
+		MessageID: options.MessageID,
+		Headers:   options.Headers,
+		options:   &options,
+	}
+
+	start := time.Now()
+
+	if options.Timeout > 0 {
+		request.Deadline = time.Now().Add(time.Duration(options.Timeout) * time.Millisecond)
 	}
 
 	// Call response callback function, send back our response
@@ -161,8 +373,10 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 
 		// Only argument to the callback.
 		response := Response{
-			Result: result,
-			Error:  err,
+			Result:    result,
+			Error:     err,
+			RequestID: request.ID,
+			Metadata:  request.responseMetadata(start),
 		}
 
 		if err := options.ResponseCallback.Call(response); err != nil {
@@ -186,6 +400,50 @@ func (r *Request) authenticate() *Error {
 		return nil
 	}
 
+	l := r.LocalKite.Lockout
+	if l == nil {
+		return r.authenticateWith()
+	}
+
+	keys := r.lockoutKeys()
+
+	for _, key := range keys {
+		if d := l.Locked(key); d > 0 {
+			return &Error{
+				Type:       "authenticationError",
+				Message:    "Too many failed authentication attempts",
+				RetryAfter: milliseconds(d),
+			}
+		}
+	}
+
+	if err := r.authenticateWith(); err != nil {
+		var delay time.Duration
+		for _, key := range keys {
+			if d := l.Fail(key); d > delay {
+				delay = d
+			}
+		}
+
+		// The delay is not slept on, not to hold the dispatch of the
+		// connection, but enforced by Locked.
+		if delay > 0 {
+			err.RetryAfter = milliseconds(delay)
+		}
+
+		return err
+	}
+
+	// Addresses are not forgiven, so attempts on many usernames
+	// interleaved with valid ones are still counted.
+	l.Succeed(keys[len(keys)-1])
+
+	return nil
+}
+
+// authenticateWith authenticates the user with the authenticator
+// function of the auth type.
+func (r *Request) authenticateWith() *Error {
 	if r.Auth == nil {
 		return &Error{
 			Type:    "authenticationError",
@@ -230,6 +488,12 @@ func (k *Kite) AuthenticateFromToken(r *Request) error {
 		if (e.Errors & jwt.ValidationErrorSignatureInvalid) != 0 {
 			return errors.New("token is expired")
 		}
+
+		// Tolerate our clock being off the clock of Kontrol.
+		if e.Errors&^timeErrors == 0 && k.validAtKontrolTime(token.Claims.(*kitekey.KiteClaims)) {
+			err = nil
+			token.Valid = true
+		}
 	}
 
 	if err != nil {
@@ -258,11 +522,17 @@ func (k *Kite) AuthenticateFromToken(r *Request) error {
 		return err
 	}
 
+	if err := k.verifyRevokedFunc(claims); err != nil {
+		return err
+	}
+
 	// We don't check for exp and nbf claims here because jwt-go package
 	// already checks them.
 
 	// replace the requester username so we reflect the validated
 	r.Username = claims.Subject
+	r.Delegate = claims.Delegate
+	r.Scopes = claims.Scopes
 
 	return nil
 }
@@ -284,6 +554,10 @@ func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 		return errors.New("token has no username")
 	}
 
+	if err := k.verifyRevokedFunc(claims); err != nil {
+		return err
+	}
+
 	r.Username = claims.Subject
 
 	return nil
@@ -308,6 +582,10 @@ func (k *Kite) AuthenticateSimpleKiteKey(key string) (string, error) {
 		return "", errors.New("token has no username")
 	}
 
+	if err := k.verifyRevokedFunc(claims); err != nil {
+		return "", err
+	}
+
 	return claims.Subject, nil
 }
 
@@ -327,6 +605,12 @@ func (k *Kite) verifyInit() {
 		k.verifyAudienceFunc = k.verifyAudience
 	}
 
+	k.verifyRevokedFunc = k.Config.VerifyRevokedFunc
+
+	if k.verifyRevokedFunc == nil {
+		k.verifyRevokedFunc = k.verifyRevoked
+	}
+
 	ttl := k.Config.VerifyTTL
 
 	if ttl == 0 {
@@ -436,3 +720,32 @@ func (k *Kite) verifyAudience(kite *protocol.Kite, audience string) error {
 
 	return nil
 }
+
+// HasScope tells whether the request is allowed to be used for the given
+// scope. Requests that are not restricted to any scopes are allowed
+// for all of them.
+func (r *Request) HasScope(scope string) bool {
+	if len(r.Scopes) == 0 {
+		return true
+	}
+
+	for _, s := range r.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// missingScope gives the first of the scopes the request is not allowed
+// to be used for, or empty string if it is allowed for all of them.
+func (r *Request) missingScope(scopes []string) string {
+	for _, scope := range scopes {
+		if !r.HasScope(scope) {
+			return scope
+		}
+	}
+
+	return ""
+}
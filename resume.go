@@ -0,0 +1,345 @@
+package kite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// DefaultResumeTTL is the time the session of a disconnected resumable
+// client is kept, if Kite.ResumeTTL is zero.
+var DefaultResumeTTL = time.Minute
+
+// Subscription is a call registering callbacks with the remote kite, like
+// a watch or a stream. It is replayed after reconnects, unless callbacks
+// of the client were restored with its session, see Client.Resumable.
+type Subscription struct {
+	// Method and Args are the call replayed after reconnects.
+	Method string
+	Args   []interface{}
+
+	c         *Client
+	mu        sync.Mutex
+	callbacks map[string]dnode.Path // sent by the last call
+	result    *dnode.Partial
+	err       error
+	closed    bool
+}
+
+type resumeArgs struct {
+	ID string `json:"id"`
+}
+
+type resumeResult struct {
+	// Restored is true when the remote kite kept the session, so the
+	// callbacks exchanged before the reconnect stay valid.
+	Restored bool `json:"restored"`
+}
+
+// resumeSession is kept by the server for each resumable client.
+type resumeSession struct {
+	client *Client     // of the last connection
+	timer  *time.Timer // expires the session of a disconnected client
+}
+
+type callbacksKey struct{}
+
+// withCallbacks gives a context, which makes fn receive callbacks sent
+// by the call made with it.
+func withCallbacks(ctx context.Context, fn func(map[string]dnode.Path)) context.Context {
+	return context.WithValue(ctx, callbacksKey{}, fn)
+}
+
+func sentCallbacks(ctx context.Context, callbacks map[string]dnode.Path) {
+	if ctx == nil {
+		return
+	}
+
+	if fn, ok := ctx.Value(callbacksKey{}).(func(map[string]dnode.Path)); ok {
+		fn(callbacks)
+	}
+}
+
+// Subscribe calls the method, which registers callbacks passed in the
+// args with the remote kite, and replays the call each time the client
+// reconnects, unless the remote kite restored the callbacks with the
+// session of a resumable client.
+//
+// The callbacks are invalidated before the call is replayed, so they may
+// be called by the remote kite for the replayed call only.
+func (c *Client) Subscribe(method string, args ...interface{}) (*Subscription, error) {
+	s := &Subscription{
+		Method: method,
+		Args:   args,
+		c:      c,
+	}
+
+	if err := s.call(); err != nil {
+		s.remove()
+		return nil, err
+	}
+
+	c.resumeMu.Lock()
+	c.subscriptions = append(c.subscriptions, s)
+	c.resumeMu.Unlock()
+
+	return s, nil
+}
+
+// Result gives the result of the last call of the subscription.
+func (s *Subscription) Result() (*dnode.Partial, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.result, s.err
+}
+
+// Close stops replaying the subscription and releases its callbacks. It
+// does not unsubscribe from the remote kite, that is up to the caller.
+func (s *Subscription) Close() {
+	c := s.c
+
+	c.resumeMu.Lock()
+	for i, sub := range c.subscriptions {
+		if sub == s {
+			c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+			break
+		}
+	}
+	c.resumeMu.Unlock()
+
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.remove()
+}
+
+func (s *Subscription) call() error {
+	ctx := withCallbacks(context.Background(), func(callbacks map[string]dnode.Path) {
+		s.mu.Lock()
+		s.callbacks = callbacks
+		s.mu.Unlock()
+	})
+
+	result, err := s.c.TellWithContext(ctx, s.Method, s.Args...)
+
+	s.mu.Lock()
+	s.result, s.err = result, err
+	s.mu.Unlock()
+
+	return err
+}
+
+// remove releases callbacks sent by the last call.
+func (s *Subscription) remove() {
+	s.mu.Lock()
+	callbacks := s.callbacks
+	s.callbacks = nil
+	s.mu.Unlock()
+
+	s.c.removeCallbacks(callbacks)
+}
+
+// OnInvalidate adds a callback, which is called when callbacks exchanged
+// with the remote kite become permanently invalid: the ones received can
+// no longer be called and the ones sent are not going to be called.
+//
+// It happens on disconnect, unless the connection has a resumable session,
+// see Client.Resumable. Then it happens when the session expires on the
+// kite serving it, or when the client learns, after reconnecting, that
+// the session was lost.
+func (c *Client) OnInvalidate(handler func()) {
+	c.m.Lock()
+	c.onInvalidateHandlers = append(c.onInvalidateHandlers, handler)
+	c.m.Unlock()
+}
+
+// callOnInvalidateHandlers runs the registered invalidate handlers.
+func (c *Client) callOnInvalidateHandlers() {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	for _, handler := range c.onInvalidateHandlers {
+		func() {
+			defer nopRecover()
+			handler()
+		}()
+	}
+}
+
+// reconnected is called after each connection of the client, it resumes
+// the session or replays the subscriptions.
+func (c *Client) reconnected() {
+	c.resumeMu.Lock()
+	first := c.connects == 0
+	c.connects++
+	if c.Resumable && c.resumeID == "" {
+		c.resumeID = utils.RandomString(16)
+	}
+	id := c.resumeID
+	c.resumeMu.Unlock()
+
+	if !c.Resumable {
+		if !first {
+			c.resubscribe()
+		}
+		return
+	}
+
+	var res resumeResult
+
+	result, err := c.TellWithTimeout("kite.resume", c.callTimeout(), &resumeArgs{ID: id})
+	if err == nil {
+		err = result.Unmarshal(&res)
+	}
+
+	if err != nil {
+		c.logger().Warning("unable to resume session with %s: %s", c.URL, err)
+	}
+
+	if first || res.Restored {
+		return
+	}
+
+	c.callOnInvalidateHandlers()
+	c.resubscribe()
+}
+
+// resubscribe replays the subscriptions of the client.
+func (c *Client) resubscribe() {
+	c.resumeMu.Lock()
+	subs := append([]*Subscription(nil), c.subscriptions...)
+	c.resumeMu.Unlock()
+
+	for _, s := range subs {
+		s.remove()
+
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+
+		if closed {
+			continue
+		}
+
+		if err := s.call(); err != nil {
+			c.logger().Warning("unable to replay %s subscription: %s", s.Method, err)
+		}
+	}
+}
+
+// callbackClient gives the client, which callbacks received by c are
+// sent with: the client of the last connection, which resumed the
+// session of c.
+func (c *Client) callbackClient() *Client {
+	for {
+		c.resumeMu.Lock()
+		next := c.resumedBy
+		c.resumeMu.Unlock()
+
+		if next == nil {
+			return c
+		}
+
+		c = next
+	}
+}
+
+// resumable tells whether the connection has a resumable session.
+func (c *Client) resumable() bool {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+
+	return c.Resumable || c.resumeID != ""
+}
+
+// handleResume starts or restores the session of the caller. Callbacks
+// received with the connection of the restored session are sent with the
+// caller's connection from now on.
+func (k *Kite) handleResume(r *Request) (interface{}, error) {
+	var args resumeArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	key := r.Username + "/" + args.ID
+	c := r.Client
+
+	k.resumeMu.Lock()
+	defer k.resumeMu.Unlock()
+
+	c.resumeMu.Lock()
+	c.resumeID = args.ID
+	c.resumeMu.Unlock()
+
+	s, restored := k.resumeSessions[key]
+	if !restored {
+		s = &resumeSession{}
+		k.resumeSessions[key] = s
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	if old := s.client; old != nil && old != c {
+		old.resumeMu.Lock()
+		old.resumedBy = c
+		old.resumeMu.Unlock()
+
+		old.m.RLock()
+		handlers := old.onInvalidateHandlers
+		old.m.RUnlock()
+
+		c.m.Lock()
+		c.onInvalidateHandlers = append(append([]func(){}, handlers...), c.onInvalidateHandlers...)
+		c.m.Unlock()
+	}
+
+	s.client = c
+
+	c.OnDisconnect(func() {
+		k.suspendSession(key, c)
+	})
+
+	return &resumeResult{Restored: restored}, nil
+}
+
+// suspendSession expires the session after ResumeTTL, unless it is
+// resumed by another connection meanwhile.
+func (k *Kite) suspendSession(key string, c *Client) {
+	k.resumeMu.Lock()
+	defer k.resumeMu.Unlock()
+
+	s, ok := k.resumeSessions[key]
+	if !ok || s.client != c {
+		return
+	}
+
+	s.timer = time.AfterFunc(k.resumeTTL(), func() {
+		k.resumeMu.Lock()
+		expired := k.resumeSessions[key] == s && s.client == c
+		if expired {
+			delete(k.resumeSessions, key)
+		}
+		k.resumeMu.Unlock()
+
+		if expired {
+			c.callOnInvalidateHandlers()
+		}
+	})
+}
+
+func (k *Kite) resumeTTL() time.Duration {
+	if k.ResumeTTL != 0 {
+		return k.ResumeTTL
+	}
+
+	return DefaultResumeTTL
+}
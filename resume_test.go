@@ -0,0 +1,190 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+type watchServer struct {
+	*Kite
+	calls int32
+
+	mu      sync.Mutex
+	watcher dnode.Function
+}
+
+func newWatchServer() *watchServer {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := &watchServer{
+		Kite: NewWithConfig("watch-server", "0.0.1", cfg),
+	}
+
+	srv.HandleFunc("watch", func(r *Request) (interface{}, error) {
+		atomic.AddInt32(&srv.calls, 1)
+
+		srv.mu.Lock()
+		srv.watcher = r.Args.One().MustFunction()
+		srv.mu.Unlock()
+
+		return nil, nil
+	})
+
+	return srv
+}
+
+func (srv *watchServer) notify(t *testing.T, events chan string, want string) {
+	srv.mu.Lock()
+	watcher := srv.watcher
+	srv.mu.Unlock()
+
+	if err := watcher.Call(want); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	select {
+	case got := <-events:
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+// reconnect closes connections of the server, waiting for the client
+// to connect and to resume the session or replay subscriptions.
+func (srv *watchServer) reconnect(t *testing.T, c *Client) {
+	connected := make(chan struct{}, 1)
+	c.OnConnect(func() {
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	})
+
+	for _, conn := range srv.Connections() {
+		if err := srv.Disconnect(conn.ID); err != nil {
+			t.Fatalf("Disconnect()=%s", err)
+		}
+	}
+
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+
+	// Wait for the session to be resumed or subscriptions replayed.
+	if _, err := c.Tell("kite.ping"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+}
+
+func dialWatchServer(t *testing.T, url string, resumable bool) (*Client, chan string, *int32) {
+	c := New("watch-client", "0.0.1").NewClient(url)
+	c.Resumable = resumable
+
+	var invalidated int32
+	c.OnInvalidate(func() {
+		atomic.AddInt32(&invalidated, 1)
+	})
+
+	connected, err := c.DialForever()
+	if err != nil {
+		t.Fatalf("DialForever()=%s", err)
+	}
+
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+
+	events := make(chan string, 1)
+
+	_, err = c.Subscribe("watch", dnode.Callback(func(p *dnode.Partial) {
+		events <- p.One().MustString()
+	}))
+	if err != nil {
+		t.Fatalf("Subscribe()=%s", err)
+	}
+
+	return c, events, &invalidated
+}
+
+func TestResume(t *testing.T) {
+	srv := newWatchServer()
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c, events, invalidated := dialWatchServer(t, fmt.Sprintf("%s/kite", ts.URL), true)
+	defer c.Close()
+
+	srv.notify(t, events, "first")
+
+	// The callback received with the previous connection is restored.
+	srv.reconnect(t, c)
+	srv.notify(t, events, "restored")
+
+	if n := atomic.LoadInt32(&srv.calls); n != 1 {
+		t.Fatalf("got %d watch calls, want 1", n)
+	}
+
+	if n := atomic.LoadInt32(invalidated); n != 0 {
+		t.Fatalf("got %d invalidations, want 0", n)
+	}
+
+	// The session is lost, so the subscription is replayed.
+	srv.resumeMu.Lock()
+	for key, s := range srv.resumeSessions {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		delete(srv.resumeSessions, key)
+	}
+	srv.resumeMu.Unlock()
+
+	srv.reconnect(t, c)
+	srv.notify(t, events, "replayed")
+
+	if n := atomic.LoadInt32(&srv.calls); n != 2 {
+		t.Fatalf("got %d watch calls, want 2", n)
+	}
+
+	if n := atomic.LoadInt32(invalidated); n != 1 {
+		t.Fatalf("got %d invalidations, want 1", n)
+	}
+}
+
+func TestResume_NotResumable(t *testing.T) {
+	srv := newWatchServer()
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c, events, invalidated := dialWatchServer(t, fmt.Sprintf("%s/kite", ts.URL), false)
+	defer c.Close()
+
+	srv.reconnect(t, c)
+	srv.notify(t, events, "replayed")
+
+	if n := atomic.LoadInt32(&srv.calls); n != 2 {
+		t.Fatalf("got %d watch calls, want 2", n)
+	}
+
+	if n := atomic.LoadInt32(invalidated); n != 1 {
+		t.Fatalf("got %d invalidations, want 1", n)
+	}
+}
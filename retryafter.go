@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// DefaultConcurrencyRetryAfter is the time callers are asked to wait
+// before retrying calls rejected due to the MaxConcurrentRequests limit.
+var DefaultConcurrencyRetryAfter = 100 * time.Millisecond
+
+// RetryAfter gives the time the remote kite asked to wait before the failed
+// call is retried, or zero if the error carries no such hint.
+//
+// Kites set the hint on requestLimitError errors, when the method is
+// throttled or the concurrent requests limit is reached.
+func RetryAfter(err error) time.Duration {
+	var ms int64
+
+	switch e := err.(type) {
+	case *Error:
+		ms = e.RetryAfter
+	case Error:
+		ms = e.RetryAfter
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// rateLimitError gives the error sent when the bucket of a throttled
+// method has no tokens left.
+func rateLimitError(bucket *ratelimit.Bucket, requestID string) *Error {
+	// The next token is added to the bucket within the time it takes
+	// to fill the bucket with a single token.
+	next := time.Duration(float64(time.Second) / bucket.Rate())
+
+	return &Error{
+		Type:               "requestLimitError",
+		Message:            "The maximum request rate is exceeded.",
+		RequestID:          requestID,
+		RetryAfter:         milliseconds(next),
+		RateLimit:          bucket.Capacity(),
+		RateLimitRemaining: bucket.Available(),
+	}
+}
+
+// concurrencyLimitError gives the error sent when the kite handles
+// max requests already.
+func concurrencyLimitError(max int, requestID string) *Error {
+	return &Error{
+		Type:       "requestLimitError",
+		Message:    "The maximum number of concurrent requests is exceeded.",
+		RequestID:  requestID,
+		RetryAfter: milliseconds(DefaultConcurrencyRetryAfter),
+		RateLimit:  int64(max),
+	}
+}
+
+// milliseconds gives d in milliseconds, rounded up.
+func milliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// throttle records the retry hint of the error received from the remote
+// kite, see PooledClient.
+func (c *Client) throttle(err *Error) {
+	d := RetryAfter(err)
+	if d <= 0 {
+		return
+	}
+
+	t := time.Now().Add(d)
+
+	c.retryMu.Lock()
+	if t.After(c.retryAt) {
+		c.retryAt = t
+	}
+	c.retryMu.Unlock()
+}
+
+// waitRetryAfter blocks until the time the remote kite asked to wait before
+// calling it again passes, or the ctx is done.
+func (c *Client) waitRetryAfter(ctx context.Context) error {
+	c.retryMu.Lock()
+	d := c.retryAt.Sub(time.Now())
+	c.retryMu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
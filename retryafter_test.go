@@ -0,0 +1,74 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestRetryAfter(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("retry-server", "0.0.1", cfg)
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	}).Throttle(300*time.Millisecond, 1)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	p := NewConnPool(New("retry-client", "0.0.1"))
+	defer p.Close()
+
+	c, err := p.Get(fmt.Sprintf("%s/kite", ts.URL), nil)
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("echo", "first"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	_, err = c.Client.Tell("echo", "second")
+
+	e, ok := err.(*Error)
+	if !ok || e.Type != "requestLimitError" {
+		t.Fatalf("want requestLimitError, got %#v", err)
+	}
+
+	if d := RetryAfter(err); d <= 0 || d > 300*time.Millisecond {
+		t.Fatalf("want retry hint within the fill interval, got %s", d)
+	}
+
+	if e.RateLimit != 1 || e.RateLimitRemaining != 0 {
+		t.Fatalf("want rate limit 1 with none remaining, got %d and %d", e.RateLimit, e.RateLimitRemaining)
+	}
+
+	// The pooled client waits for the hinted time, so the call succeeds.
+	start := time.Now()
+
+	if _, err := c.Tell("echo", "third"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("want the call to wait for the retry hint, took %s", elapsed)
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	o := &Outbox{RetryInterval: time.Second}
+
+	if d := o.retryDelay(&Error{Type: "timeout"}); d != time.Second {
+		t.Fatalf("want retry interval, got %s", d)
+	}
+
+	if d := o.retryDelay(&Error{Type: "requestLimitError", RetryAfter: 1500}); d != 1500*time.Millisecond {
+		t.Fatalf("want retry hint, got %s", d)
+	}
+}
@@ -0,0 +1,96 @@
+package kite
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+)
+
+// ErrTokenRevoked is returned when authenticating with a token or
+// a kite key that was revoked.
+var ErrTokenRevoked = errors.New("token is revoked")
+
+// RevokeTokens adds the given tokens to the kite's revocation list.
+// Requests authenticated with any of them are rejected until
+// the token expires.
+func (k *Kite) RevokeTokens(tokens ...*protocol.RevokedToken) {
+	now := time.Now().UTC().Unix()
+
+	k.revokedMu.Lock()
+	defer k.revokedMu.Unlock()
+
+	for id, exp := range k.revoked {
+		if exp != 0 && exp < now {
+			delete(k.revoked, id)
+		}
+	}
+
+	for _, t := range tokens {
+		if t.ID == "" {
+			continue
+		}
+
+		k.revoked[t.ID] = t.ExpiresAt
+	}
+}
+
+// TokenRevoked tells whether a token with the given ID (jti claim)
+// is on the kite's revocation list.
+func (k *Kite) TokenRevoked(id string) bool {
+	k.revokedMu.RLock()
+	exp, ok := k.revoked[id]
+	k.revokedMu.RUnlock()
+
+	return ok && (exp == 0 || exp >= time.Now().UTC().Unix())
+}
+
+// verifyRevoked is the default (config.Config).VerifyRevokedFunc.
+func (k *Kite) verifyRevoked(claims *kitekey.KiteClaims) error {
+	if claims.Id != "" && k.TokenRevoked(claims.Id) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// handleRevokeTokens updates the revocation list with tokens
+// pushed by Kontrol.
+func (k *Kite) handleRevokeTokens(r *Request) (interface{}, error) {
+	k.kontrol.Lock()
+	fromKontrol := k.kontrol.Client != nil && r.Client == k.kontrol.Client
+	k.kontrol.Unlock()
+
+	if !fromKontrol {
+		return nil, errors.New("revocations are accepted only from kontrol")
+	}
+
+	var tokens []*protocol.RevokedToken
+
+	if err := r.Args.One().Unmarshal(&tokens); err != nil {
+		return nil, err
+	}
+
+	k.RevokeTokens(tokens...)
+
+	return nil, nil
+}
+
+// syncRevokedTokens fetches the current revocation list from Kontrol.
+func (k *Kite) syncRevokedTokens() {
+	result, err := k.kontrol.TellWithTimeout("getRevokedTokens", k.CallTimeout())
+	if err != nil {
+		k.Log.Warning("unable to fetch revoked tokens: %s", err)
+		return
+	}
+
+	var tokens []*protocol.RevokedToken
+
+	if err := result.Unmarshal(&tokens); err != nil {
+		k.Log.Warning("unable to read revoked tokens: %s", err)
+		return
+	}
+
+	k.RevokeTokens(tokens...)
+}
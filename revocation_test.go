@@ -0,0 +1,41 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+)
+
+func TestRevokeTokens(t *testing.T) {
+	k := New("revocation", "0.0.1")
+
+	now := time.Now().UTC()
+
+	k.RevokeTokens(
+		&protocol.RevokedToken{ID: "active", ExpiresAt: now.Add(time.Hour).Unix()},
+		&protocol.RevokedToken{ID: "expired", ExpiresAt: now.Add(-time.Hour).Unix()},
+	)
+
+	cases := map[string]bool{
+		"active":  true,
+		"expired": false,
+		"unknown": false,
+	}
+
+	for id, want := range cases {
+		if got := k.TokenRevoked(id); got != want {
+			t.Errorf("TokenRevoked(%q)=%t, want %t", id, got, want)
+		}
+
+		claims := &kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{Id: id},
+		}
+
+		if err := k.verifyRevoked(claims); (err == ErrTokenRevoked) != want {
+			t.Errorf("verifyRevoked(%q)=%v", id, err)
+		}
+	}
+}
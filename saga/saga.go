@@ -0,0 +1,302 @@
+// Package saga runs a sequence of calls across multiple kites as a saga:
+// each step has a compensation, which undoes it, and when a step fails,
+// the compensations of the committed steps are run in reverse order.
+//
+// Example:
+//
+//	s := &saga.Saga{}
+//
+//	s.Add("reserve", saga.Call(inventory, "reserve", order)).
+//	    CompensateWith(saga.Call(inventory, "release", order))
+//
+//	s.Add("charge", saga.Call(payments, "charge", order)).
+//	    CompensateWith(saga.Call(payments, "refund", order))
+//
+//	s.Add("ship", saga.Call(shipping, "ship", order))
+//
+//	report, err := s.Run(ctx)
+//	if err != nil {
+//	    log.Printf("order failed, committed steps: %v", report.Committed())
+//	}
+//
+// Calls made with Call carry message IDs unique for the run and the step,
+// so compensations retried after failures are not run twice by kites with
+// Kite.DedupStore set.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// DefaultCompensationTimeout is the time a single attempt of
+	// a compensation may take, if Saga.CompensationTimeout is zero.
+	DefaultCompensationTimeout = 30 * time.Second
+
+	// DefaultCompensationAttempts is the number of attempts made to run
+	// a compensation, if Saga.CompensationAttempts is zero.
+	DefaultCompensationAttempts = 3
+
+	// DefaultCompensationRetryInterval is the time to wait between the
+	// attempts of a compensation, if Saga.CompensationRetryInterval is zero.
+	DefaultCompensationRetryInterval = time.Second
+)
+
+// Func is an action of a step. The result of the step is passed
+// to its compensation.
+type Func func(ctx context.Context, result *dnode.Partial) (*dnode.Partial, error)
+
+// Call gives an action calling the method with args on the client.
+// The result of the step is not passed to the method.
+func Call(c *kite.Client, method string, args ...interface{}) Func {
+	return func(ctx context.Context, _ *dnode.Partial) (*dnode.Partial, error) {
+		return c.TellWithContext(ctx, method, args...)
+	}
+}
+
+// Step is a step of a saga.
+type Step struct {
+	// Name identifies the step in the report.
+	Name string
+
+	// Do runs the step. It is called with nil result.
+	Do Func
+
+	// Compensate undoes the step after a later step failed. It is called
+	// with the result of Do. If nil, the step is not undone.
+	Compensate Func
+}
+
+// CompensateWith sets the compensation of the step.
+func (s *Step) CompensateWith(compensate Func) *Step {
+	s.Compensate = compensate
+	return s
+}
+
+// Status is a status of a step after the saga was run.
+type Status string
+
+const (
+	// Committed is the status of steps, which succeeded and were not undone.
+	Committed Status = "committed"
+
+	// Failed is the status of the step, which failed.
+	Failed Status = "failed"
+
+	// Compensated is the status of steps, which were undone.
+	Compensated Status = "compensated"
+
+	// CompensationFailed is the status of steps, which could not be undone.
+	CompensationFailed Status = "compensationFailed"
+
+	// Skipped is the status of steps, which were not run.
+	Skipped Status = "skipped"
+)
+
+// StepReport reports the outcome of a step.
+type StepReport struct {
+	Name   string         `json:"name"`
+	Status Status         `json:"status"`
+	Result *dnode.Partial `json:"result,omitempty"`
+
+	// Err is the error of the failed step, or the error of the last
+	// attempt of the failed compensation.
+	Err error `json:"-"`
+
+	// Attempts is the number of attempts made to run the compensation.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Report reports outcomes of all steps of the saga.
+type Report struct {
+	// ID identifies the run of the saga.
+	ID string `json:"id"`
+
+	Steps []*StepReport `json:"steps"`
+}
+
+// Committed gives names of the steps, which took effect and were not
+// undone: the committed ones and the ones, which could not be undone.
+func (r *Report) Committed() []string {
+	var names []string
+
+	for _, s := range r.Steps {
+		if s.Status == Committed || s.Status == CompensationFailed {
+			names = append(names, s.Name)
+		}
+	}
+
+	return names
+}
+
+// Error is returned by Saga.Run when a step failed.
+type Error struct {
+	// Step is the name of the failed step.
+	Step string
+
+	// Err is the error of the step.
+	Err error
+
+	// Uncompensated are names of the steps, which could not be undone.
+	Uncompensated []string
+}
+
+// Error implements the built-in error interface.
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("saga: step %q failed: %s", e.Step, e.Err)
+
+	if len(e.Uncompensated) != 0 {
+		msg += fmt.Sprintf(" (unable to compensate %s)", strings.Join(e.Uncompensated, ", "))
+	}
+
+	return msg
+}
+
+// Saga is a sequence of steps run with Run.
+type Saga struct {
+	Steps []*Step
+
+	// CompensationTimeout is the time a single attempt of a compensation
+	// may take. Compensations are not canceled with the ctx given to Run.
+	//
+	// If zero, DefaultCompensationTimeout is used.
+	CompensationTimeout time.Duration
+
+	// CompensationAttempts is the number of attempts made to run
+	// a compensation, before its step is reported as CompensationFailed.
+	//
+	// If zero, DefaultCompensationAttempts is used.
+	CompensationAttempts int
+
+	// CompensationRetryInterval is the time to wait between the attempts
+	// of a compensation.
+	//
+	// If zero, DefaultCompensationRetryInterval is used.
+	CompensationRetryInterval time.Duration
+}
+
+// Add adds a step with the given name and action to the saga.
+func (s *Saga) Add(name string, do Func) *Step {
+	step := &Step{
+		Name: name,
+		Do:   do,
+	}
+
+	s.Steps = append(s.Steps, step)
+
+	return step
+}
+
+// Run runs the steps in order. When a step fails, or the ctx is done,
+// the compensations of the committed steps are run in reverse order and
+// an *Error is returned.
+//
+// The report gives the outcome of each step in either case.
+func (s *Saga) Run(ctx context.Context) (*Report, error) {
+	report := &Report{
+		ID:    uuid.NewV4().String(),
+		Steps: make([]*StepReport, len(s.Steps)),
+	}
+
+	for i, step := range s.Steps {
+		report.Steps[i] = &StepReport{
+			Name:   step.Name,
+			Status: Skipped,
+		}
+	}
+
+	for i, step := range s.Steps {
+		r := report.Steps[i]
+
+		err := ctx.Err()
+		if err == nil {
+			stepCtx := kite.WithMessageID(ctx, report.ID+"/"+step.Name)
+			r.Result, err = step.Do(stepCtx, nil)
+		}
+
+		if err != nil {
+			r.Status = Failed
+			r.Err = err
+
+			return report, s.compensate(report, i, err)
+		}
+
+		r.Status = Committed
+	}
+
+	return report, nil
+}
+
+// compensate undoes the steps committed before the failed one.
+func (s *Saga) compensate(report *Report, failed int, err error) error {
+	sagaErr := &Error{
+		Step: s.Steps[failed].Name,
+		Err:  err,
+	}
+
+	for i := failed - 1; i >= 0; i-- {
+		step, r := s.Steps[i], report.Steps[i]
+
+		if step.Compensate == nil {
+			continue
+		}
+
+		msgID := report.ID + "/" + step.Name + "/compensate"
+
+		for r.Attempts < s.attempts() {
+			if r.Attempts > 0 {
+				time.Sleep(s.retryInterval())
+			}
+
+			r.Attempts++
+
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+			_, r.Err = step.Compensate(kite.WithMessageID(ctx, msgID), r.Result)
+			cancel()
+
+			if r.Err == nil {
+				break
+			}
+		}
+
+		if r.Err != nil {
+			r.Status = CompensationFailed
+			sagaErr.Uncompensated = append(sagaErr.Uncompensated, step.Name)
+		} else {
+			r.Status = Compensated
+		}
+	}
+
+	return sagaErr
+}
+
+func (s *Saga) timeout() time.Duration {
+	if s.CompensationTimeout != 0 {
+		return s.CompensationTimeout
+	}
+
+	return DefaultCompensationTimeout
+}
+
+func (s *Saga) attempts() int {
+	if s.CompensationAttempts != 0 {
+		return s.CompensationAttempts
+	}
+
+	return DefaultCompensationAttempts
+}
+
+func (s *Saga) retryInterval() time.Duration {
+	if s.CompensationRetryInterval != 0 {
+		return s.CompensationRetryInterval
+	}
+
+	return DefaultCompensationRetryInterval
+}
@@ -0,0 +1,140 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/saga"
+)
+
+func TestSaga(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	var mu sync.Mutex
+	var calls []string
+
+	srv := kite.NewWithConfig("saga-server", "0.0.1", cfg)
+	for _, method := range []string{"reserve", "release", "charge", "refund", "ship"} {
+		method := method
+		srv.HandleFunc(method, func(r *kite.Request) (interface{}, error) {
+			mu.Lock()
+			calls = append(calls, method)
+			mu.Unlock()
+
+			if method == "ship" {
+				return nil, errors.New("out of stock")
+			}
+
+			return method + ":" + r.Args.One().MustString(), nil
+		})
+	}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := kite.New("saga-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	var refundAttempts int
+	var refundResult string
+
+	s := &saga.Saga{CompensationRetryInterval: time.Millisecond}
+
+	s.Add("reserve", saga.Call(c, "reserve", "order-1")).
+		CompensateWith(saga.Call(c, "release", "order-1"))
+
+	s.Add("charge", saga.Call(c, "charge", "order-1")).
+		CompensateWith(func(ctx context.Context, result *dnode.Partial) (*dnode.Partial, error) {
+			if refundAttempts++; refundAttempts == 1 {
+				return nil, errors.New("payments unavailable")
+			}
+
+			refundResult = result.MustString()
+
+			return saga.Call(c, "refund", "order-1")(ctx, result)
+		})
+
+	s.Add("notify", saga.Call(c, "reserve", "order-1-notification"))
+	s.Add("ship", saga.Call(c, "ship", "order-1"))
+	s.Add("track", saga.Call(c, "ship", "order-1"))
+
+	report, err := s.Run(context.Background())
+
+	e, ok := err.(*saga.Error)
+	if !ok {
+		t.Fatalf("got %v, want *saga.Error", err)
+	}
+
+	if e.Step != "ship" || len(e.Uncompensated) != 0 {
+		t.Fatalf("got %+v", e)
+	}
+
+	wantCalls := []string{"reserve", "charge", "reserve", "ship", "refund", "release"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Fatalf("got calls %v, want %v", calls, wantCalls)
+	}
+
+	if refundAttempts != 2 || refundResult != "charge:order-1" {
+		t.Fatalf("got %d refund attempts with %q", refundAttempts, refundResult)
+	}
+
+	var statuses []saga.Status
+	for _, step := range report.Steps {
+		statuses = append(statuses, step.Status)
+	}
+
+	wantStatuses := []saga.Status{saga.Compensated, saga.Compensated, saga.Committed, saga.Failed, saga.Skipped}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Fatalf("got statuses %v, want %v", statuses, wantStatuses)
+	}
+
+	if got := report.Committed(); !reflect.DeepEqual(got, []string{"notify"}) {
+		t.Fatalf("got committed steps %v", got)
+	}
+}
+
+func TestSagaCompensationFailed(t *testing.T) {
+	fail := func(context.Context, *dnode.Partial) (*dnode.Partial, error) {
+		return nil, errors.New("failed")
+	}
+
+	ok := func(context.Context, *dnode.Partial) (*dnode.Partial, error) {
+		return nil, nil
+	}
+
+	s := &saga.Saga{
+		CompensationAttempts:      2,
+		CompensationRetryInterval: time.Millisecond,
+	}
+
+	s.Add("first", ok).CompensateWith(fail)
+	s.Add("second", fail)
+
+	report, err := s.Run(context.Background())
+
+	e, isSagaErr := err.(*saga.Error)
+	if !isSagaErr || !reflect.DeepEqual(e.Uncompensated, []string{"first"}) {
+		t.Fatalf("got %v", err)
+	}
+
+	if r := report.Steps[0]; r.Status != saga.CompensationFailed || r.Attempts != 2 {
+		t.Fatalf("got %+v", r)
+	}
+
+	if got := report.Committed(); !reflect.DeepEqual(got, []string{"first"}) {
+		t.Fatalf("got committed steps %v", got)
+	}
+}
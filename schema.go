@@ -0,0 +1,268 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// FieldChange declares a change of a field of objects passed as method
+// arguments, see SchemaEvolution.
+type FieldChange struct {
+	// Method is the method, whose arguments changed. Empty value
+	// means all of the methods.
+	Method string
+
+	// Field is the deprecated name of the field.
+	Field string
+
+	// NewField is the name the field was renamed to, or empty if the
+	// field is deprecated only.
+	NewField string
+
+	// Until is the end of the grace period, after which the deprecated
+	// name is no longer accepted. Zero value means it is accepted
+	// indefinitely.
+	Until time.Time
+}
+
+// FieldUsage tells how many calls used the deprecated field.
+type FieldUsage struct {
+	Method string // method called
+	Field  string // deprecated name of the field
+	Count  int64  // number of calls using it
+}
+
+// SchemaEvolution is an ArgsTransformer, which lets handlers of a kite
+// accept arguments with deprecated field names, so kites sending the old
+// payloads keep working during a rolling upgrade:
+//
+//	s := kite.NewSchemaEvolution(k.Log)
+//	s.Rename("user.get", "user", "username", deadline)
+//	k.TransformArgs(s)
+//
+// Fields of object arguments of incoming calls are renamed before the
+// handlers decode them. A warning is logged the first time a deprecated
+// field is used by calls of a method, Usage gives the number of calls.
+// Outgoing calls are not changed.
+type SchemaEvolution struct {
+	// Log is used to warn about the deprecated fields.
+	//
+	// If nil, nothing is logged.
+	Log Logger
+
+	mu      sync.Mutex
+	changes []*FieldChange
+	usage   map[FieldUsage]int64 // keyed by usage with zero count
+}
+
+var _ ArgsTransformer = (*SchemaEvolution)(nil)
+
+// NewSchemaEvolution gives new schema evolution, which logs with the logger.
+func NewSchemaEvolution(log Logger) *SchemaEvolution {
+	return &SchemaEvolution{
+		Log:   log,
+		usage: make(map[FieldUsage]int64),
+	}
+}
+
+// Change declares the change of the field.
+func (s *SchemaEvolution) Change(change *FieldChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changes = append(s.changes, change)
+}
+
+// Rename declares the field of the method's arguments was renamed, the old
+// name is accepted until the given time. The empty method means all of
+// the methods.
+func (s *SchemaEvolution) Rename(method, field, newField string, until time.Time) {
+	s.Change(&FieldChange{
+		Method:   method,
+		Field:    field,
+		NewField: newField,
+		Until:    until,
+	})
+}
+
+// Deprecate declares the field of the method's arguments is deprecated and
+// is accepted until the given time. The empty method means all of the
+// methods.
+func (s *SchemaEvolution) Deprecate(method, field string, until time.Time) {
+	s.Rename(method, field, "", until)
+}
+
+// Usage gives the number of calls, which used each of the deprecated
+// fields, ordered by the method and field.
+func (s *SchemaEvolution) Usage() []FieldUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := make([]FieldUsage, 0, len(s.usage))
+	for u, n := range s.usage {
+		u.Count = n
+		usage = append(usage, u)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Method != usage[j].Method {
+			return usage[i].Method < usage[j].Method
+		}
+		return usage[i].Field < usage[j].Field
+	})
+
+	return usage
+}
+
+// TransformOut leaves the arguments as they are.
+func (s *SchemaEvolution) TransformOut(method string, args []interface{}) ([]interface{}, error) {
+	return args, nil
+}
+
+// TransformIn renames the deprecated fields of object arguments.
+func (s *SchemaEvolution) TransformIn(method string, args *dnode.Partial) (*dnode.Partial, error) {
+	changes := s.methodChanges(method)
+	if len(changes) == 0 || args == nil {
+		return args, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(args.Raw, &raw); err != nil {
+		return args, nil // leave it for the handler to report
+	}
+
+	specs := args.CallbackSpecs
+	changed := false
+
+	for i, arg := range raw {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(arg, &obj); err != nil || obj == nil {
+			continue
+		}
+
+		renamed := false
+
+		for _, c := range changes {
+			value, ok := obj[c.Field]
+			if !ok {
+				continue
+			}
+
+			s.used(method, c)
+
+			if !c.Until.IsZero() && time.Now().After(c.Until) {
+				continue
+			}
+
+			if _, ok := obj[c.NewField]; c.NewField == "" || ok {
+				continue
+			}
+
+			obj[c.NewField] = value
+			delete(obj, c.Field)
+
+			specs = renameCallbacks(specs, i, c.Field, c.NewField)
+			renamed = true
+		}
+
+		if !renamed {
+			continue
+		}
+
+		p, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		raw[i] = p
+		changed = true
+	}
+
+	if !changed {
+		return args, nil
+	}
+
+	p, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnode.Partial{
+		Raw:           p,
+		CallbackSpecs: specs,
+		Strict:        args.Strict,
+	}, nil
+}
+
+// methodChanges gives the field changes of the method's arguments.
+func (s *SchemaEvolution) methodChanges(method string) []*FieldChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []*FieldChange
+	for _, c := range s.changes {
+		if c.Method == "" || c.Method == method {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes
+}
+
+// used counts the call of the method, which used the deprecated field.
+func (s *SchemaEvolution) used(method string, c *FieldChange) {
+	u := FieldUsage{
+		Method: method,
+		Field:  c.Field,
+	}
+
+	s.mu.Lock()
+	if s.usage == nil {
+		s.usage = make(map[FieldUsage]int64)
+	}
+	s.usage[u]++
+	first := s.usage[u] == 1
+	s.mu.Unlock()
+
+	if !first || s.Log == nil {
+		return
+	}
+
+	switch {
+	case !c.Until.IsZero() && time.Now().After(c.Until):
+		s.Log.Warning("schema: %q field of %q arguments is no longer accepted since %s", c.Field, method, c.Until)
+	case c.NewField != "":
+		s.Log.Warning("schema: %q field of %q arguments is deprecated, use %q instead", c.Field, method, c.NewField)
+	default:
+		s.Log.Warning("schema: %q field of %q arguments is deprecated", c.Field, method)
+	}
+}
+
+// renameCallbacks gives the specs with paths of callbacks within the field
+// of i-th argument changed to the new field.
+func renameCallbacks(specs []dnode.CallbackSpec, i int, field, newField string) []dnode.CallbackSpec {
+	renamed := make([]dnode.CallbackSpec, len(specs))
+
+	for j, spec := range specs {
+		renamed[j] = spec
+
+		path := spec.Path
+		if len(path) < 2 || fmt.Sprint(path[0]) != strconv.Itoa(i) || path[1] != field {
+			continue
+		}
+
+		newPath := make(dnode.Path, len(path))
+		copy(newPath, path)
+		newPath[1] = newField
+
+		renamed[j].Path = newPath
+	}
+
+	return renamed
+}
@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestSchemaEvolution(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("schema-server", "0.0.1", cfg)
+
+	s := NewSchemaEvolution(srv.Log)
+	s.Rename("greet", "user", "username", time.Now().Add(time.Hour))
+	s.Deprecate("", "lang", time.Time{})
+	srv.TransformArgs(s)
+
+	srv.HandleFunc("greet", func(r *Request) (interface{}, error) {
+		var args struct {
+			Username string         `json:"username"`
+			Done     dnode.Function `json:"done"`
+		}
+
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		if args.Done.IsValid() {
+			args.Done.Call("done")
+		}
+
+		return "hello " + args.Username, nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("schema-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	done := make(chan struct{}, 1)
+	old := map[string]interface{}{
+		"user": "alice",
+		"lang": "en",
+		"done": dnode.Callback(func(*dnode.Partial) { done <- struct{}{} }),
+	}
+
+	for _, arg := range []interface{}{old, map[string]string{"username": "bob"}} {
+		if _, err := c.TellWithTimeout("greet", 4*time.Second, arg); err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+	}
+
+	result, err := c.TellWithTimeout("greet", 4*time.Second, map[string]string{"user": "carol"})
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != "hello carol" {
+		t.Fatalf("got %q, want %q", got, "hello carol")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(4 * time.Second):
+		t.Fatal("want callback of the renamed field to be called")
+	}
+
+	want := []FieldUsage{
+		{Method: "greet", Field: "lang", Count: 1},
+		{Method: "greet", Field: "user", Count: 2},
+	}
+
+	if got := s.Usage(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSchemaEvolutionExpired(t *testing.T) {
+	s := NewSchemaEvolution(nil)
+	s.Rename("greet", "user", "username", time.Now().Add(-time.Hour))
+
+	args := &dnode.Partial{Raw: []byte(`[{"user":"alice"}]`)}
+
+	got, err := s.TransformIn("greet", args)
+	if err != nil {
+		t.Fatalf("TransformIn()=%s", err)
+	}
+
+	if string(got.Raw) != string(args.Raw) {
+		t.Fatalf("want the field not renamed after the grace period, got %s", got.Raw)
+	}
+}
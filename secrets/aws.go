@@ -0,0 +1,228 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. Names of
+// secrets are their names or ARNs. The current version of the secret
+// is read, either its string or its binary value.
+//
+// Requests are signed with AWS Signature Version 4.
+type AWSSecretsManager struct {
+	// Region of the secrets, e.g. "eu-central-1".
+	//
+	// If empty, the AWS_REGION environment variable is used.
+	Region string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials
+	// requests are signed with. SessionToken is required only for
+	// temporary credentials.
+	//
+	// If empty, the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN environment variables are used.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint is the URL of the service.
+	//
+	// If empty, the public endpoint of the region is used.
+	Endpoint string
+
+	// Client is used to make requests to the service.
+	//
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Get implements the Provider interface.
+func (a *AWSSecretsManager) Get(name string) ([]byte, error) {
+	region := orEnv(a.Region, "AWS_REGION")
+	if region == "" {
+		return nil, errors.New("aws: region is not set")
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com/"
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	if err := a.sign(req, body, region, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+
+		json.Unmarshal(p, &e)
+
+		// The type may be prefixed with a namespace, like
+		// "com.amazonaws.secretsmanager#ResourceNotFoundException".
+		typ := e.Type[strings.LastIndex(e.Type, "#")+1:]
+
+		if typ == "ResourceNotFoundException" {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("aws: %s: %s %s", resp.Status, typ, e.Message)
+	}
+
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary []byte  `json:"SecretBinary"`
+	}
+
+	if err := json.Unmarshal(p, &secret); err != nil {
+		return nil, err
+	}
+
+	if secret.SecretString != nil {
+		return []byte(*secret.SecretString), nil
+	}
+
+	return secret.SecretBinary, nil
+}
+
+// sign adds the Signature Version 4 authorization to the request.
+func (a *AWSSecretsManager) sign(req *http.Request, body []byte, region string, now time.Time) error {
+	accessKey := orEnv(a.AccessKeyID, "AWS_ACCESS_KEY_ID")
+	secretKey := orEnv(a.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("aws: credentials are not set")
+	}
+
+	token := a.SessionToken
+	if a.AccessKeyID == "" {
+		token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if token != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+
+	sort.Strings(headers)
+
+	var canonicalHeaders bytes.Buffer
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+
+	signedHeaders := strings.Join(headers, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/secretsmanager/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, "secretsmanager", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+
+	return nil
+}
+
+func canonicalQuery(q url.Values) string {
+	// Encode sorts the parameters by keys.
+	return strings.Replace(q.Encode(), "+", "%20", -1)
+}
+
+func hexSHA256(p []byte) string {
+	sum := sha256.Sum256(p)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func orEnv(value, env string) string {
+	if value != "" {
+		return value
+	}
+
+	return os.Getenv(env)
+}
@@ -0,0 +1,318 @@
+// Package secrets loads secrets used by kites, like TLS keys, API keys
+// and token signing keys, from external stores.
+//
+// Secrets are read with a Provider, there are providers for environment
+// variables, files, HashiCorp Vault and AWS Secrets Manager. Watch keeps
+// a secret up to date, so rotated secrets are picked up without restarting
+// the kite:
+//
+//	p := &secrets.Vault{Addr: "https://vault:8200", Token: token}
+//
+//	cert, err := secrets.Watch(p, "kite/tls#cert", time.Minute)
+//	...
+//	key, err := secrets.Watch(p, "kite/tls#key", time.Minute)
+//	...
+//	k.TLSConfig = secrets.TLSConfig(cert, key)
+package secrets
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrNotFound is returned by providers, when the requested secret
+// does not exist.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider reads secrets from a secret store.
+type Provider interface {
+	// Get gives the current value of the secret with the given name.
+	// The format of names depends on the provider.
+	Get(name string) ([]byte, error)
+}
+
+var (
+	_ Provider = (*Env)(nil)
+	_ Provider = (*File)(nil)
+	_ Provider = (*Vault)(nil)
+	_ Provider = (*AWSSecretsManager)(nil)
+)
+
+// Env reads secrets from environment variables. The name of the variable
+// is the upper-cased name of the secret with characters other than
+// letters and digits replaced by underscores, e.g. secret "tls.key"
+// is read from TLS_KEY.
+type Env struct {
+	// Prefix is prepended to names of the variables, e.g. "KITE_".
+	Prefix string
+}
+
+// Get implements the Provider interface.
+func (e *Env) Get(name string) ([]byte, error) {
+	v, ok := os.LookupEnv(e.Prefix + envName(name))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return []byte(v), nil
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// File reads secrets from files, like secrets mounted into containers.
+// Trailing newlines of the files are trimmed.
+type File struct {
+	// Dir is the directory relative names of secrets are resolved in.
+	Dir string
+}
+
+// Get implements the Provider interface.
+func (f *File) Get(name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(f.Dir, name)
+	}
+
+	p, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(p, "\r\n"), nil
+}
+
+// Secret is a secret kept up to date by polling its provider, see Watch.
+type Secret struct {
+	// Name of the secret.
+	Name string
+
+	provider Provider
+
+	mu       sync.RWMutex
+	value    []byte
+	err      error // of the last refresh
+	onChange []func([]byte)
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+// Watch reads the secret with the given name and re-reads it from the
+// provider every interval, until the secret is closed. It fails if the
+// secret cannot be read initially. Zero interval disables polling.
+//
+// Failures of later reads keep the last value of the secret.
+func Watch(p Provider, name string, interval time.Duration) (*Secret, error) {
+	s := &Secret{
+		Name:     name,
+		provider: p,
+		closeC:   make(chan struct{}),
+	}
+
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go s.poll(interval)
+	}
+
+	return s, nil
+}
+
+// Value gives the current value of the secret.
+func (s *Secret) Value() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.value
+}
+
+// Err gives the error of the last read of the secret, or nil
+// if it succeeded.
+func (s *Secret) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// OnChange registers a function, which is called with the new value
+// each time the secret is rotated.
+func (s *Secret) OnChange(fn func(value []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onChange = append(s.onChange, fn)
+}
+
+// Refresh reads the secret from the provider.
+func (s *Secret) Refresh() error {
+	value, err := s.provider.Get(s.Name)
+	if err != nil {
+		err = fmt.Errorf("secret %q: %s", s.Name, err)
+	}
+
+	s.mu.Lock()
+	s.err = err
+
+	if err != nil || bytes.Equal(value, s.value) {
+		s.mu.Unlock()
+		return err
+	}
+
+	rotated := s.value != nil
+	s.value = value
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	if rotated {
+		for _, fn := range onChange {
+			fn(value)
+		}
+	}
+
+	return nil
+}
+
+// Close stops polling the secret.
+func (s *Secret) Close() {
+	s.closeOnce.Do(func() { close(s.closeC) })
+}
+
+func (s *Secret) poll(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.closeC:
+			return
+		case <-t.C:
+			s.Refresh()
+		}
+	}
+}
+
+// TLSConfig gives a TLS configuration serving the PEM-encoded certificate
+// and private key, e.g. for Kite.TLSConfig. Rotated certificates are
+// served to new connections.
+func TLSConfig(cert, key *Secret) *tls.Config {
+	c := &tlsCertificate{cert: cert, key: key}
+
+	return &tls.Config{
+		GetCertificate: c.get,
+	}
+}
+
+type tlsCertificate struct {
+	cert, key *Secret
+
+	mu          sync.Mutex
+	certPEM     []byte
+	keyPEM      []byte
+	certificate *tls.Certificate
+}
+
+func (c *tlsCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certPEM, keyPEM := c.cert.Value(), c.key.Value()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.certificate != nil && bytes.Equal(certPEM, c.certPEM) && bytes.Equal(keyPEM, c.keyPEM) {
+		return c.certificate, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		if c.certificate != nil {
+			// The certificate and the key may be rotated one after
+			// another, keep serving the previous pair meanwhile.
+			return c.certificate, nil
+		}
+
+		return nil, err
+	}
+
+	c.certPEM, c.keyPEM, c.certificate = certPEM, keyPEM, &cert
+
+	return c.certificate, nil
+}
+
+// APIKeys gives a kite authenticator, which accepts API keys given as the
+// authentication key. The keys are mapped by usernames of their owners,
+// the username of the matching key is set as the username of the request.
+//
+//	k.Authenticators["apiKey"] = secrets.APIKeys(map[string]*secrets.Secret{
+//	    "billing": billingKey,
+//	})
+//
+// Rotated keys are accepted right away.
+func APIKeys(keys map[string]*Secret) func(*kite.Request) error {
+	return func(r *kite.Request) error {
+		given := []byte(r.Auth.Key)
+
+		for username, s := range keys {
+			key := s.Value()
+
+			if len(key) != 0 && subtle.ConstantTimeCompare(given, key) == 1 {
+				r.Username = username
+				return nil
+			}
+		}
+
+		return errors.New("invalid API key")
+	}
+}
+
+// SigningKey parses the secret as an Ed25519 private key for
+// Kite.SigningKey. The secret is either a 32-byte seed or a 64-byte
+// private key, raw or encoded with base64.
+func SigningKey(value []byte) (ed25519.PrivateKey, error) {
+	key := value
+
+	if len(key) != ed25519.SeedSize && len(key) != ed25519.PrivateKeySize {
+		p, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+		if err != nil {
+			return nil, errors.New("invalid signing key encoding")
+		}
+
+		key = p
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, fmt.Errorf("invalid signing key size: %d", len(key))
+	}
+}
@@ -0,0 +1,261 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+func TestEnv(t *testing.T) {
+	os.Setenv("KITE_TEST_API_KEY", "s3cret")
+	defer os.Unsetenv("KITE_TEST_API_KEY")
+
+	p := &Env{Prefix: "KITE_"}
+
+	value, err := p.Get("test.api-key")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if string(value) != "s3cret" {
+		t.Fatalf("got %q, want %q", value, "s3cret")
+	}
+
+	if _, err := p.Get("missing"); err != ErrNotFound {
+		t.Fatalf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "key")
+
+	if err := ioutil.WriteFile(file, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Watch(&File{Dir: dir}, "key", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Watch()=%s", err)
+	}
+	defer s.Close()
+
+	if got := string(s.Value()); got != "first" {
+		t.Fatalf("got %q, want %q", got, "first")
+	}
+
+	rotated := make(chan string, 1)
+	s.OnChange(func(value []byte) { rotated <- string(value) })
+
+	if err := ioutil.WriteFile(file, []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-rotated:
+		if got != "second" {
+			t.Fatalf("got %q, want %q", got, "second")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for rotation")
+	}
+
+	// Failed reads keep the last value.
+	os.Remove(file)
+
+	if err := s.Refresh(); err == nil {
+		t.Fatal("expected Refresh() to fail")
+	}
+
+	if got := string(s.Value()); got != "second" {
+		t.Fatalf("got %q, want %q", got, "second")
+	}
+
+	if _, err := Watch(&File{Dir: dir}, "missing", 0); err == nil {
+		t.Fatal("expected Watch() to fail")
+	}
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		if r.URL.Path != "/v1/kv/data/kite/tls" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		w.Write([]byte(`{"data":{"data":{"key":"private","value":"default"},"metadata":{"version":2}}}`))
+	}))
+	defer srv.Close()
+
+	v := &Vault{Addr: srv.URL, Token: "token", Mount: "kv"}
+
+	cases := map[string]string{
+		"kite/tls#key": "private",
+		"kite/tls":     "default",
+	}
+
+	for name, want := range cases {
+		value, err := v.Get(name)
+		if err != nil {
+			t.Fatalf("%s: Get()=%s", name, err)
+		}
+
+		if string(value) != want {
+			t.Fatalf("%s: got %q, want %q", name, value, want)
+		}
+	}
+
+	if _, err := v.Get("kite/missing"); err != ErrNotFound {
+		t.Fatalf("got %v, want %v", err, ErrNotFound)
+	}
+
+	if _, err := v.Get("kite/tls#missing"); err != ErrNotFound {
+		t.Fatalf("got %v, want %v", err, ErrNotFound)
+	}
+
+	v.Token = "invalid"
+
+	if _, err := v.Get("kite/tls"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("got %v, want permission denied", err)
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/eu-central-1/secretsmanager/aws4_request") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target") {
+			t.Errorf("invalid Authorization header: %q", auth)
+		}
+
+		if got := r.Header.Get("X-Amz-Target"); got != "secretsmanager.GetSecretValue" {
+			t.Errorf("got X-Amz-Target %q", got)
+		}
+
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch req.SecretId {
+		case "api-key":
+			w.Write([]byte(`{"Name":"api-key","SecretString":"s3cret"}`))
+		case "tls-key":
+			w.Write([]byte(`{"Name":"tls-key","SecretBinary":"` + base64.StdEncoding.EncodeToString([]byte("binary")) + `"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer srv.Close()
+
+	a := &AWSSecretsManager{
+		Region:          "eu-central-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        srv.URL,
+	}
+
+	cases := map[string]string{
+		"api-key": "s3cret",
+		"tls-key": "binary",
+	}
+
+	for name, want := range cases {
+		value, err := a.Get(name)
+		if err != nil {
+			t.Fatalf("%s: Get()=%s", name, err)
+		}
+
+		if string(value) != want {
+			t.Fatalf("%s: got %q, want %q", name, value, want)
+		}
+	}
+
+	if _, err := a.Get("missing"); err != ErrNotFound {
+		t.Fatalf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	os.Setenv("BILLING_KEY", "first")
+	defer os.Unsetenv("BILLING_KEY")
+
+	s, err := Watch(&Env{}, "billing.key", 0)
+	if err != nil {
+		t.Fatalf("Watch()=%s", err)
+	}
+
+	auth := APIKeys(map[string]*Secret{"billing": s})
+
+	r := &kite.Request{Auth: &kite.Auth{Type: "apiKey", Key: "first"}, Client: &kite.Client{Kite: protocol.Kite{}}}
+
+	if err := auth(r); err != nil {
+		t.Fatalf("auth()=%s", err)
+	}
+
+	if r.Username != "billing" {
+		t.Fatalf("got username %q, want %q", r.Username, "billing")
+	}
+
+	os.Setenv("BILLING_KEY", "second")
+
+	if err := s.Refresh(); err != nil {
+		t.Fatalf("Refresh()=%s", err)
+	}
+
+	if err := auth(r); err == nil {
+		t.Fatal("expected the rotated key to be rejected")
+	}
+
+	r.Auth.Key = "second"
+
+	if err := auth(r); err != nil {
+		t.Fatalf("auth()=%s", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	seed := []byte(strings.Repeat("k", 32))
+
+	raw, err := SigningKey(seed)
+	if err != nil {
+		t.Fatalf("SigningKey()=%s", err)
+	}
+
+	encoded, err := SigningKey([]byte(base64.StdEncoding.EncodeToString(seed) + "\n"))
+	if err != nil {
+		t.Fatalf("SigningKey()=%s", err)
+	}
+
+	if string(raw) != string(encoded) {
+		t.Fatal("keys differ")
+	}
+
+	if _, err := SigningKey([]byte("short")); err == nil {
+		t.Fatal("expected SigningKey() to fail")
+	}
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from the KV version 2 secrets engine of HashiCorp
+// Vault. Names of secrets are paths within the engine, optionally followed
+// by "#" and the field of the secret, e.g. "kite/tls#key".
+type Vault struct {
+	// Addr is the address of Vault, e.g. "https://vault:8200".
+	//
+	// Required.
+	Addr string
+
+	// Token authenticates requests to Vault.
+	//
+	// Required.
+	Token string
+
+	// Mount is the path the KV engine is mounted at.
+	//
+	// If empty, "secret" is used.
+	Mount string
+
+	// Field is the field of secrets read, if their names do not
+	// specify one.
+	//
+	// If empty, "value" is used.
+	Field string
+
+	// Client is used to make requests to Vault.
+	//
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Get implements the Provider interface.
+func (v *Vault) Get(name string) ([]byte, error) {
+	path, field := name, v.Field
+	if i := strings.LastIndex(name, "#"); i != -1 {
+		path, field = name[:i], name[i+1:]
+	}
+
+	if field == "" {
+		field = "value"
+	}
+
+	mount := v.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+
+	url := strings.TrimSuffix(v.Addr, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + strings.TrimPrefix(path, "/")
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("vault: %s: %s", resp.Status, vaultErrors(body))
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, err
+	}
+
+	value, ok := secret.Data.Data[field]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(value)
+}
+
+func (v *Vault) client() *http.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+
+	return http.DefaultClient
+}
+
+func vaultErrors(body []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Errors) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+
+	return strings.Join(resp.Errors, "; ")
+}
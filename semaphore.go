@@ -0,0 +1,258 @@
+package kite
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/protocol"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// DefaultSemaphoreTTL is the time a slot of a semaphore is held
+	// without renewing it, if the ttl passed to NewSemaphore is zero.
+	DefaultSemaphoreTTL = 30 * time.Second
+
+	// DefaultSemaphoreRetryInterval is the time Acquire waits before
+	// retrying, when all slots of a semaphore are taken.
+	DefaultSemaphoreRetryInterval = 500 * time.Millisecond
+)
+
+var (
+	// ErrSemaphoreTimeout is returned by Acquire when no slot of
+	// a semaphore became free within the timeout.
+	ErrSemaphoreTimeout = errors.New("timed out acquiring semaphore")
+
+	// ErrSemaphoreHeld is returned when acquiring a semaphore, which
+	// is already held.
+	ErrSemaphoreHeld = errors.New("semaphore is already held")
+
+	// ErrSemaphoreNotHeld is returned when releasing a semaphore, which
+	// is not held.
+	ErrSemaphoreNotHeld = errors.New("semaphore is not held")
+)
+
+// Semaphore is a named counting semaphore kept by Kontrol, which lets
+// up to Limit holders at once, e.g. kites accessing a shared external
+// resource. Semaphores are shared by all kites of the same username
+// and environment.
+//
+// A slot of the semaphore is held with a lease renewed every third
+// of the TTL. If the lease cannot be renewed, e.g. because Kontrol is
+// not reachable, the channel given by Lost is closed before the lease
+// expires, so the holder can stop accessing the resource.
+//
+// A Semaphore is held by a single holder at once, create a Semaphore
+// for each goroutine competing for it.
+type Semaphore struct {
+	Name  string
+	Limit int
+	TTL   time.Duration
+
+	k     *Kite
+	token string
+
+	mu      sync.Mutex
+	slot    int           // held slot, -1 if not held
+	expires time.Time     // time the lease of the slot expires
+	stop    chan struct{} // stops renewals
+	lost    chan struct{} // closed when the slot is lost
+}
+
+// NewSemaphore gives a semaphore with the given name, which lets up to
+// limit holders at once. If ttl is zero, DefaultSemaphoreTTL is used.
+func (k *Kite) NewSemaphore(name string, limit int, ttl time.Duration) *Semaphore {
+	if ttl == 0 {
+		ttl = DefaultSemaphoreTTL
+	}
+
+	return &Semaphore{
+		Name:  name,
+		Limit: limit,
+		TTL:   ttl,
+		k:     k,
+		token: uuid.NewV4().String(),
+		slot:  -1,
+	}
+}
+
+// NewLock gives a distributed lock with the given name, which is
+// a semaphore with a single holder.
+func (k *Kite) NewLock(name string, ttl time.Duration) *Semaphore {
+	return k.NewSemaphore(name, 1, ttl)
+}
+
+// TryAcquire acquires a slot of the semaphore, if any is free. It
+// tells whether the slot was acquired.
+func (s *Semaphore) TryAcquire() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slot >= 0 {
+		return false, ErrSemaphoreHeld
+	}
+
+	start := time.Now()
+
+	res, err := s.acquire(-1)
+	if err != nil || !res.Acquired {
+		return false, err
+	}
+
+	s.slot = res.Slot
+	s.expires = start.Add(s.TTL)
+	s.stop = make(chan struct{})
+	s.lost = make(chan struct{})
+
+	go s.renew(s.stop, s.lost)
+
+	return true, nil
+}
+
+// Acquire acquires a slot of the semaphore, waiting for a slot to become
+// free up to the given timeout. If timeout is zero, it waits forever.
+func (s *Semaphore) Acquire(timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for {
+		ok, err := s.TryAcquire()
+		if err != nil || ok {
+			return err
+		}
+
+		wait := DefaultSemaphoreRetryInterval
+
+		if !deadline.IsZero() {
+			left := deadline.Sub(time.Now())
+			if left <= 0 {
+				return ErrSemaphoreTimeout
+			}
+
+			if left < wait {
+				wait = left
+			}
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// Release releases the held slot of the semaphore.
+func (s *Semaphore) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slot < 0 {
+		return ErrSemaphoreNotHeld
+	}
+
+	close(s.stop)
+
+	args := s.args(s.slot)
+	s.slot = -1
+
+	_, err := s.k.TellKontrolWithTimeout("kontrol.releaseSemaphore", s.k.CallTimeout(), args)
+
+	return err
+}
+
+// Held tells whether a slot of the semaphore is held.
+func (s *Semaphore) Held() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.slot >= 0
+}
+
+// Lost gives a channel, which is closed when the held slot of the
+// semaphore is lost, because its lease could not be renewed. It gives
+// nil if the semaphore is not held.
+func (s *Semaphore) Lost() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slot < 0 {
+		return nil
+	}
+
+	return s.lost
+}
+
+func (s *Semaphore) args(slot int) *protocol.SemaphoreArgs {
+	return &protocol.SemaphoreArgs{
+		Name:  s.Name,
+		Limit: s.Limit,
+		Token: s.token,
+		Slot:  slot,
+		TTL:   s.TTL,
+	}
+}
+
+func (s *Semaphore) acquire(slot int) (*protocol.SemaphoreResult, error) {
+	result, err := s.k.TellKontrolWithTimeout("kontrol.acquireSemaphore", s.k.CallTimeout(), s.args(slot))
+	if err != nil {
+		return nil, err
+	}
+
+	var res protocol.SemaphoreResult
+
+	if err := result.Unmarshal(&res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// renew renews the lease of the held slot until stop is closed.
+func (s *Semaphore) renew(stop, lost chan struct{}) {
+	t := time.NewTicker(s.TTL / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+
+		s.mu.Lock()
+		slot, expires := s.slot, s.expires
+		s.mu.Unlock()
+
+		start := time.Now()
+
+		res, err := s.acquire(slot)
+		if err == nil && !res.Acquired {
+			err = errors.New("slot was taken over")
+		}
+
+		s.mu.Lock()
+
+		select {
+		case <-stop:
+			// released in the meantime
+			s.mu.Unlock()
+			return
+		default:
+		}
+
+		switch {
+		case err == nil:
+			s.expires = start.Add(s.TTL)
+		case res != nil || time.Now().Add(s.TTL/3).After(expires):
+			// the lease is lost or it would expire before the next renewal
+			s.k.Log.Warning("lost slot of %q semaphore: %s", s.Name, err)
+			s.slot = -1
+			close(stop)
+			close(lost)
+		default:
+			s.k.Log.Warning("unable to renew slot of %q semaphore: %s", s.Name, err)
+		}
+
+		s.mu.Unlock()
+	}
+}
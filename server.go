@@ -21,14 +21,9 @@ func (k *Kite) Run() {
 		os.Exit(0)
 	}
 
-	// An error string equivalent to net.errClosing for using with http.Serve()
-	// during a graceful exit. Needed to declare here again because it is not
-	// exported by "net" package.
-	const errClosing = "use of closed network connection"
-
 	err := k.listenAndServe()
 	if err != nil {
-		if strings.Contains(err.Error(), errClosing) {
+		if isClosing(err) {
 			// The server is closed by Close() method
 			k.Log.Info("Kite server is closed.")
 			return
@@ -54,13 +49,30 @@ func (k *Kite) Close() {
 
 	k.mu.Lock()
 	cache := k.verifyCache
+	listeners := k.listeners
+	k.listeners = nil
 	k.mu.Unlock()
 
+	for _, l := range listeners {
+		l.Close()
+	}
+
 	if cache != nil {
 		cache.StopGC()
 	}
 }
 
+// isClosing tells whether the error was returned by http.Serve, because
+// the listener was closed.
+func isClosing(err error) bool {
+	// An error string equivalent to net.errClosing for using with http.Serve()
+	// during a graceful exit. Needed to declare here again because it is not
+	// exported by "net" package.
+	const errClosing = "use of closed network connection"
+
+	return strings.Contains(err.Error(), errClosing)
+}
+
 func (k *Kite) Addr() string {
 	return net.JoinHostPort(k.Config.IP, strconv.Itoa(k.Config.Port))
 }
@@ -69,11 +81,13 @@ func (k *Kite) Addr() string {
 // calls Serve to handle requests on incoming connectionk.
 func (k *Kite) listenAndServe() error {
 	// create a new one if there doesn't exist
-	l, err := net.Listen("tcp4", k.Addr())
+	l, err := k.listen("tcp4", k.Addr())
 	if err != nil {
 		return err
 	}
 
+	raw := l
+
 	k.Log.Info("New listening: %s", l.Addr())
 
 	if k.TLSConfig != nil {
@@ -84,10 +98,15 @@ func (k *Kite) listenAndServe() error {
 	}
 
 	k.listener = newGracefulListener(l)
+	k.listener.network, k.listener.address, k.listener.raw = "tcp4", k.Addr(), raw
 
 	// listener is ready, notify waiters.
 	close(k.readyC)
 
+	if err := k.UpgradeReady(); err != nil {
+		k.Log.Error("notifying previous process about readiness: %s", err)
+	}
+
 	defer close(k.closeC) // serving is finished, notify waiters.
 	k.Log.Info("Serving...")
 
@@ -163,8 +182,18 @@ func (k *Kite) ServerReadyNotify() chan bool {
 type gracefulListener struct {
 	net.Listener
 
+	// network and address the listener was requested with and the
+	// listener before wrapping with TLS, see ServeHandoff
+	network, address string
+	raw              net.Listener
+
 	conns   map[net.Conn]struct{}
 	connsMu sync.Mutex
+
+	// handedOver is true once the listener was handed over to the new
+	// process of the kite, so Close keeps the accepted connections until
+	// they are drained, see ServeHandoff.
+	handedOver bool
 }
 
 func newGracefulListener(l net.Listener) *gracefulListener {
@@ -198,15 +227,22 @@ func (l *gracefulListener) Close() error {
 	err := l.Listener.Close()
 
 	l.connsMu.Lock()
-	for conn := range l.conns {
-		conn.Close()
+	if !l.handedOver {
+		l.closeConns()
 	}
-	l.conns = nil
 	l.connsMu.Unlock()
 
 	return err
 }
 
+// closeConns closes the accepted connections, connsMu must be held.
+func (l *gracefulListener) closeConns() {
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
 type gracefulConn struct {
 	net.Conn
 
@@ -0,0 +1,258 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is the time a session is kept after it was last
+// modified, if Kite.SessionTTL is zero.
+var DefaultSessionTTL = 30 * time.Minute
+
+var (
+	// ErrSessionNotFound is returned by SessionStore.Get when there is
+	// no session with the given ID or it has expired.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionKeyNotFound is returned by Session.Get when the session
+	// has no value for the given key.
+	ErrSessionKeyNotFound = errors.New("session key not found")
+)
+
+// SessionStore persists session values. Using an external store lets
+// session state survive reconnects to a different kite instance behind
+// a load balancer.
+type SessionStore interface {
+	// Get gives values of the session with the given ID. It returns
+	// ErrSessionNotFound if the session does not exist or has expired.
+	Get(id string) (map[string]json.RawMessage, error)
+
+	// Put stores values of the session, which expire after ttl.
+	Put(id string, values map[string]json.RawMessage, ttl time.Duration) error
+
+	// Delete removes the session with the given ID.
+	Delete(id string) error
+}
+
+// Session holds state bound to an authenticated caller. It is shared by
+// all requests made by the same remote kite instance, also across
+// reconnects.
+//
+// Values are stored JSON-encoded, so Get can decode them to any type
+// compatible with the one passed to Set.
+type Session struct {
+	// ID identifies the session in the store.
+	ID string
+
+	store SessionStore
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	values  map[string]json.RawMessage
+	expires time.Time
+}
+
+func newSession(id string, store SessionStore, ttl time.Duration) *Session {
+	s := &Session{
+		ID:     id,
+		store:  store,
+		ttl:    ttl,
+		values: make(map[string]json.RawMessage),
+	}
+
+	if values, err := store.Get(id); err == nil {
+		s.values = values
+		s.expires = time.Now().Add(ttl)
+	}
+
+	return s
+}
+
+// Get decodes value stored under the given key into v.
+func (s *Session) Get(key string, v interface{}) error {
+	s.mu.Lock()
+	s.expire()
+	p, ok := s.values[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrSessionKeyNotFound
+	}
+
+	return json.Unmarshal(p, v)
+}
+
+// Set stores the value under the given key and extends the session
+// expiration time.
+func (s *Session) Set(key string, v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	s.values[key] = p
+
+	return s.save()
+}
+
+// Delete removes the value stored under the given key.
+func (s *Session) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	delete(s.values, key)
+
+	return s.save()
+}
+
+// Clear removes all the session values.
+func (s *Session) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values = make(map[string]json.RawMessage)
+	s.expires = time.Time{}
+
+	return s.store.Delete(s.ID)
+}
+
+// expire drops the values if the session has expired.
+func (s *Session) expire() {
+	if !s.expires.IsZero() && time.Now().After(s.expires) {
+		s.values = make(map[string]json.RawMessage)
+	}
+}
+
+func (s *Session) save() error {
+	s.expires = time.Now().Add(s.ttl)
+
+	return s.store.Put(s.ID, s.values, s.ttl)
+}
+
+// Session gives the session of the caller. The session is identified
+// by the authenticated username and the ID of the remote kite, so it is
+// available again when the caller reconnects.
+func (r *Request) Session() *Session {
+	c := r.Client
+
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	c.m.RLock()
+	id := r.Username + "/" + c.Kite.ID
+	c.m.RUnlock()
+
+	if c.kiteSession == nil || c.kiteSession.ID != id {
+		c.kiteSession = newSession(id, r.LocalKite.sessionStore(), r.LocalKite.sessionTTL())
+	}
+
+	return c.kiteSession
+}
+
+func (k *Kite) sessionStore() SessionStore {
+	if k.SessionStore != nil {
+		return k.SessionStore
+	}
+
+	return k.defaultSessionStore
+}
+
+func (k *Kite) sessionTTL() time.Duration {
+	if k.SessionTTL != 0 {
+		return k.SessionTTL
+	}
+
+	return DefaultSessionTTL
+}
+
+// MemorySessionStore is an in-memory SessionStore. Sessions are lost
+// when the kite is restarted.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]*memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	values  map[string]json.RawMessage
+	expires time.Time
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore gives new in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*memorySession),
+	}
+}
+
+// Get implements the SessionStore interface.
+func (m *MemorySessionStore) Get(id string) (map[string]json.RawMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	if time.Now().After(s.expires) {
+		delete(m.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+
+	values := make(map[string]json.RawMessage, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+
+	return values, nil
+}
+
+// Put implements the SessionStore interface.
+func (m *MemorySessionStore) Put(id string, values map[string]json.RawMessage, ttl time.Duration) error {
+	now := time.Now()
+
+	valuesCopy := make(map[string]json.RawMessage, len(values))
+	for k, v := range values {
+		valuesCopy[k] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop expired sessions, which are not going to be requested again.
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, s := range m.sessions {
+			if now.After(s.expires) {
+				delete(m.sessions, id)
+			}
+		}
+
+		m.lastSweep = now
+	}
+
+	m.sessions[id] = &memorySession{
+		values:  valuesCopy,
+		expires: now.Add(ttl),
+	}
+
+	return nil
+}
+
+// Delete implements the SessionStore interface.
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package kite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	k := New("session", "0.0.1")
+	k.SessionTTL = 200 * time.Millisecond
+
+	newRequest := func(username, id string) *Request {
+		c := k.NewClient("")
+		c.Kite.ID = id
+
+		return &Request{
+			Username:  username,
+			LocalKite: k,
+			Client:    c,
+		}
+	}
+
+	type cart struct {
+		Items []string `json:"items"`
+	}
+
+	r := newRequest("john", "1")
+
+	if err := r.Session().Set("cart", &cart{Items: []string{"apple"}}); err != nil {
+		t.Fatalf("Set()=%s", err)
+	}
+
+	// Reconnect of the same remote kite gets the same session.
+	var c cart
+	if err := newRequest("john", "1").Session().Get("cart", &c); err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if len(c.Items) != 1 || c.Items[0] != "apple" {
+		t.Fatalf("got %+v, want [apple]", c.Items)
+	}
+
+	// Other users do not see the session.
+	if err := newRequest("jane", "1").Session().Get("cart", &c); err != ErrSessionKeyNotFound {
+		t.Fatalf("got %v, want %v", err, ErrSessionKeyNotFound)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if err := r.Session().Get("cart", &c); err != ErrSessionKeyNotFound {
+		t.Fatalf("got %v, want %v", err, ErrSessionKeyNotFound)
+	}
+
+	if err := newRequest("john", "1").Session().Get("cart", &c); err != ErrSessionKeyNotFound {
+		t.Fatalf("got %v, want %v", err, ErrSessionKeyNotFound)
+	}
+}
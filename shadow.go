@@ -0,0 +1,76 @@
+package kite
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// shadow mirrors calls of a client to a shadow kite.
+type shadow struct {
+	client   *Client
+	fraction float64
+}
+
+// WithShadow makes the client mirror the given fraction, in [0, 1], of its
+// calls to the shadow client, e.g. to validate a rewritten kite against
+// production traffic. Mirrored calls are sent asynchronously, their
+// responses are discarded and errors are only logged, thus they never
+// affect calls of the client.
+//
+// Calls with callbacks are never mirrored, as the callbacks would be called
+// twice, neither are calls of kite.* methods. The shadow client must be
+// dialed by the caller.
+func WithShadow(client *Client, fraction float64) ClientOption {
+	return func(c *Client) {
+		c.shadow = &shadow{
+			client:   client,
+			fraction: fraction,
+		}
+	}
+}
+
+// mirror sends the call to the shadow kite, if it is sampled. If the
+// client has a comparer, it gives the channel the response of the call
+// must be sent to, in order to be compared with the shadow response.
+func (c *Client) mirror(method string, args []interface{}, timeout time.Duration) chan<- *response {
+	s := c.shadow
+	if s == nil || s.fraction <= 0 || strings.HasPrefix(method, "kite.") {
+		return nil
+	}
+
+	if s.fraction < 1 && rand.Float64() >= s.fraction {
+		return nil
+	}
+
+	// Functions fail to encode, callbacks encode as "[Function]".
+	if p, err := json.Marshal(args); err != nil || containsCallbacks(p) {
+		return nil
+	}
+
+	var primary chan *response
+	if c.shadowCmp != nil {
+		primary = make(chan *response, 1)
+	}
+
+	go func() {
+		start := time.Now()
+
+		result, err := s.client.TellWithTimeout(method, timeout, args...)
+
+		if primary == nil {
+			if err != nil {
+				c.logger().Warning("shadow call of %q to %s failed after %s: %s", method, s.client.URL, time.Since(start), err)
+			}
+			return
+		}
+
+		m := c.shadowCmp.compare(method, <-primary, &response{Result: result, Err: err})
+		if m != nil && c.shadowCmp.logged() {
+			c.logger().Warning("shadow call of %q to %s differs: %s", method, s.client.URL, strings.Join(m.Diffs, "; "))
+		}
+	}()
+
+	return primary
+}
@@ -0,0 +1,187 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestShadow(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("shadow-primary", "0.0.1", cfg)
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.MustSlice()[0].MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	mirrored := make(chan string, 10)
+
+	shadowSrv := NewWithConfig("shadow-secondary", "0.0.2", cfg)
+	shadowSrv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		mirrored <- r.Args.One().MustString()
+		return nil, errors.New("rewrite is broken")
+	})
+
+	shadowTS := httptest.NewServer(shadowSrv)
+	defer shadowTS.Close()
+
+	k := New("shadow-client", "0.0.1")
+
+	shadow := k.NewClient(fmt.Sprintf("%s/kite", shadowTS.URL))
+	if err := shadow.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer shadow.Close()
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL), WithShadow(shadow, 1))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.TellWithTimeout("echo", 4*time.Second, "hello")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustString(); got != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+
+	select {
+	case got := <-mirrored:
+		if got != "hello" {
+			t.Fatalf("got %q mirrored, want %q", got, "hello")
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("timed out waiting for the mirrored call")
+	}
+
+	// Calls with callbacks are not mirrored.
+	cb := dnode.Callback(func(*dnode.Partial) {})
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "callback", cb); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	select {
+	case got := <-mirrored:
+		t.Fatalf("got %q mirrored, want call with callback not mirrored", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestShadowComparer(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	handler := func(name string) HandlerFunc {
+		return func(r *Request) (interface{}, error) {
+			result := map[string]interface{}{
+				"id":   r.LocalKite.Id,
+				"name": name,
+			}
+
+			if r.Args.One().MustString() == "same" {
+				result["name"] = "same"
+			}
+
+			return result, nil
+		}
+	}
+
+	srv := NewWithConfig("shadow-primary", "0.0.1", cfg)
+	srv.HandleFunc("get", handler("old"))
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	shadowSrv := NewWithConfig("shadow-secondary", "0.0.2", cfg)
+	shadowSrv.HandleFunc("get", handler("new"))
+
+	shadowTS := httptest.NewServer(shadowSrv)
+	defer shadowTS.Close()
+
+	mismatches := make(chan *ShadowMismatch, 10)
+
+	cmp := &ShadowComparer{
+		Ignore: []string{"id"},
+		OnMismatch: func(m *ShadowMismatch) {
+			mismatches <- m
+		},
+	}
+
+	k := New("shadow-client", "0.0.1")
+
+	shadow := k.NewClient(fmt.Sprintf("%s/kite", shadowTS.URL))
+	if err := shadow.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer shadow.Close()
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL), WithShadow(shadow, 1), WithShadowComparer(cmp))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	for _, arg := range []string{"different", "same"} {
+		if _, err := c.TellWithTimeout("get", 4*time.Second, arg); err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+	}
+
+	deadline := time.Now().Add(4 * time.Second)
+	for v := ShadowCalls.Get("get"); v == nil || v.String() != "2"; v = ShadowCalls.Get("get") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the comparisons")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m := <-mismatches
+	if want := []string{`name: "old" != "new"`}; !reflect.DeepEqual(m.Diffs, want) {
+		t.Fatalf("got %q, want %q", m.Diffs, want)
+	}
+
+	if got := cmp.MismatchRate("get"); got != 0.5 {
+		t.Fatalf("got mismatch rate %v, want 0.5", got)
+	}
+}
+
+func TestShadowComparerDiff(t *testing.T) {
+	cmp := &ShadowComparer{Ignore: []string{"items.*.id"}}
+
+	result := func(s string) *response {
+		return &response{Result: &dnode.Partial{Raw: []byte(s)}}
+	}
+
+	diffs := cmp.diff(
+		result(`{"items":[{"id":1,"n":1},{"id":2,"n":2}],"total":2}`),
+		result(`{"items":[{"id":3,"n":1},{"id":4,"n":3}],"more":true}`),
+	)
+
+	want := []string{"items.1.n: 2 != 3", "more: null != true", "total: 2 != null"}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("got %q, want %q", diffs, want)
+	}
+
+	timeout := &response{Err: &Error{Type: "timeout"}}
+	if diffs := cmp.diff(timeout, &response{Err: &Error{Type: "timeout"}}); diffs != nil {
+		t.Fatalf("got %q, want errors of the same type to match", diffs)
+	}
+
+	if diffs := cmp.diff(timeout, result(`1`)); len(diffs) != 1 {
+		t.Fatalf("got %q, want error mismatch", diffs)
+	}
+}
@@ -0,0 +1,280 @@
+package kite
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultShadowLogFraction is the fraction of mismatches logged by
+// ShadowComparer, if LogFraction is zero.
+var DefaultShadowLogFraction = 0.01
+
+var (
+	// ShadowCalls counts calls compared with shadow calls, by method
+	// names. It is published with the expvar package.
+	ShadowCalls = expvar.NewMap("kite.shadowCalls")
+
+	// ShadowMismatches counts calls, whose responses differed from
+	// responses of shadow calls, by method names. It is published with
+	// the expvar package.
+	ShadowMismatches = expvar.NewMap("kite.shadowMismatches")
+)
+
+// ShadowComparer diffs responses of calls with responses of the calls
+// mirrored to a shadow kite, see WithShadow and WithShadowComparer. It is
+// used to certify a new implementation of a kite behaves like the old one.
+//
+// Mismatches are counted in ShadowMismatches and a sample of them is
+// logged with the differing fields.
+type ShadowComparer struct {
+	// Ignore lists dot-separated paths of fields, which are not compared,
+	// like timestamps or generated IDs. A "*" element matches any field
+	// or index, e.g. "items.*.id".
+	Ignore []string
+
+	// LogFraction is the fraction of mismatches, which are logged.
+	// A negative value disables logging.
+	//
+	// If zero, DefaultShadowLogFraction is used.
+	LogFraction float64
+
+	// OnMismatch, when non-nil, is called with each mismatch.
+	OnMismatch func(*ShadowMismatch)
+
+	mu    sync.Mutex
+	stats map[string]*shadowStats // method -> stats
+}
+
+// ShadowMismatch describes responses of a call and its shadow call,
+// which differ.
+type ShadowMismatch struct {
+	Method string
+
+	// Diffs describe the differing fields, e.g.
+	// `items.0.name: "foo" != "bar"`.
+	Diffs []string
+}
+
+type shadowStats struct {
+	calls      int
+	mismatches int
+}
+
+// WithShadowComparer makes the client compare responses of its calls
+// mirrored with WithShadow using the given comparer.
+func WithShadowComparer(cmp *ShadowComparer) ClientOption {
+	return func(c *Client) {
+		c.shadowCmp = cmp
+	}
+}
+
+// MismatchRate gives the fraction of compared calls of the method, whose
+// responses differed.
+func (cmp *ShadowComparer) MismatchRate(method string) float64 {
+	cmp.mu.Lock()
+	defer cmp.mu.Unlock()
+
+	s, ok := cmp.stats[method]
+	if !ok || s.calls == 0 {
+		return 0
+	}
+
+	return float64(s.mismatches) / float64(s.calls)
+}
+
+// compare diffs the responses of the call and the shadow call, recording
+// the outcome. It gives nil if the responses are equivalent.
+func (cmp *ShadowComparer) compare(method string, primary, shadow *response) *ShadowMismatch {
+	diffs := cmp.diff(primary, shadow)
+
+	cmp.mu.Lock()
+	if cmp.stats == nil {
+		cmp.stats = make(map[string]*shadowStats)
+	}
+
+	s, ok := cmp.stats[method]
+	if !ok {
+		s = &shadowStats{}
+		cmp.stats[method] = s
+	}
+
+	s.calls++
+	if len(diffs) != 0 {
+		s.mismatches++
+	}
+	cmp.mu.Unlock()
+
+	ShadowCalls.Add(method, 1)
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	ShadowMismatches.Add(method, 1)
+
+	m := &ShadowMismatch{
+		Method: method,
+		Diffs:  diffs,
+	}
+
+	if cmp.OnMismatch != nil {
+		cmp.OnMismatch(m)
+	}
+
+	return m
+}
+
+// logged tells whether the mismatch is sampled for logging.
+func (cmp *ShadowComparer) logged() bool {
+	f := cmp.LogFraction
+	if f == 0 {
+		f = DefaultShadowLogFraction
+	}
+
+	return f > 0 && rand.Float64() < f
+}
+
+func (cmp *ShadowComparer) diff(primary, shadow *response) []string {
+	if primary.Err != nil || shadow.Err != nil {
+		if errorType(primary.Err) == errorType(shadow.Err) {
+			return nil
+		}
+
+		return []string{fmt.Sprintf("error: %v != %v", primary.Err, shadow.Err)}
+	}
+
+	a, err := decodeResult(primary.Result)
+	if err != nil {
+		return []string{fmt.Sprintf("result: %s", err)}
+	}
+
+	b, err := decodeResult(shadow.Result)
+	if err != nil {
+		return []string{fmt.Sprintf("shadow result: %s", err)}
+	}
+
+	var diffs []string
+	cmp.diffValues(nil, a, b, &diffs)
+
+	return diffs
+}
+
+func (cmp *ShadowComparer) diffValues(path []string, a, b interface{}, diffs *[]string) {
+	if cmp.ignored(path) {
+		return
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for k := range a {
+				keys = append(keys, k)
+			}
+			for k := range b {
+				if _, ok := a[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				cmp.diffValues(append(path[:len(path):len(path)], k), a[k], b[k], diffs)
+			}
+
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok && len(a) == len(b) {
+			for i := range a {
+				cmp.diffValues(append(path[:len(path):len(path)], strconv.Itoa(i)), a[i], b[i], diffs)
+			}
+
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", pathString(path), encodeValue(a), encodeValue(b)))
+	}
+}
+
+// ignored tells whether the path matches any of the Ignore paths.
+func (cmp *ShadowComparer) ignored(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	for _, pattern := range cmp.Ignore {
+		elems := strings.Split(pattern, ".")
+		if len(elems) != len(path) {
+			continue
+		}
+
+		matched := true
+		for i, e := range elems {
+			if e != "*" && e != path[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeResult(p *dnode.Partial) (interface{}, error) {
+	if p == nil || len(p.Raw) == 0 {
+		return nil, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(p.Raw, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func errorType(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if e, ok := err.(*Error); ok {
+		return e.Type
+	}
+
+	return "genericError"
+}
+
+func pathString(path []string) string {
+	if len(path) == 0 {
+		return "result"
+	}
+
+	return strings.Join(path, ".")
+}
+
+func encodeValue(v interface{}) string {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(p)
+}
@@ -0,0 +1,167 @@
+package kite
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+// DefaultDrainTimeout is the maximum time RunWithSignals waits for
+// requests in flight to finish before the kite is closed.
+var DefaultDrainTimeout = 30 * time.Second
+
+// RunOptions configures the RunWithSignals harness.
+type RunOptions struct {
+	// ConfigFile is a runtime configuration file, which is read
+	// and applied with SetRuntimeConfig on SIGHUP.
+	//
+	// If empty, SIGHUP is ignored.
+	ConfigFile string
+
+	// DrainTimeout is the maximum time to wait for requests in flight
+	// to finish after a termination signal was received.
+	//
+	// If zero, DefaultDrainTimeout is used.
+	DrainTimeout time.Duration
+}
+
+// RunWithSignals is a blocking method, which runs the kite server like
+// Run and integrates it with the process supervisor:
+//
+//   - SIGTERM and SIGINT put the kite into drain mode, wait for requests
+//     in flight to finish and close the kite; a second signal closes
+//     the kite immediately
+//   - SIGHUP reloads opts.ConfigFile
+//   - READY=1, RELOADING=1 and STOPPING=1 states are reported to systemd
+//     when the process is run with NOTIFY_SOCKET set
+//
+// If opts is nil, default options are used.
+func (k *Kite) RunWithSignals(opts *RunOptions) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	done := make(chan struct{})
+	go func() {
+		k.Run()
+		close(done)
+	}()
+
+	select {
+	case <-k.ServerReadyNotify():
+		k.sdNotify("READY=1")
+	case <-done:
+		return
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case s := <-c:
+			k.Log.Info("Got signal: %s", s)
+
+			if s == syscall.SIGHUP {
+				k.reloadConfigFile(opts.ConfigFile)
+				continue
+			}
+
+			k.sdNotify("STOPPING=1")
+			k.drain(opts.DrainTimeout, c)
+			k.Close()
+			<-done
+			return
+		}
+	}
+}
+
+// drain puts the kite into drain mode and waits until there are no
+// requests in flight, the timeout elapses or another signal is received.
+func (k *Kite) drain(timeout time.Duration, c <-chan os.Signal) {
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	k.SetDraining(true)
+
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+
+	deadline := time.After(timeout)
+
+	for atomic.LoadInt64(&k.activeRequests) > 0 {
+		select {
+		case <-t.C:
+		case <-deadline:
+			k.Log.Warning("drain timed out with %d requests in flight", atomic.LoadInt64(&k.activeRequests))
+			return
+		case s := <-c:
+			k.Log.Warning("Got signal: %s, closing immediately", s)
+			return
+		}
+	}
+}
+
+func (k *Kite) reloadConfigFile(file string) {
+	if file == "" {
+		return
+	}
+
+	k.sdNotify("RELOADING=1")
+	defer k.sdNotify("READY=1")
+
+	rc, err := config.ReadRuntimeFile(file)
+	if err != nil {
+		k.Log.Error("config reload: %s", err)
+		return
+	}
+
+	if err := k.SetRuntimeConfig(rc); err != nil {
+		k.Log.Error("config reload: %s", err)
+	}
+}
+
+func (k *Kite) sdNotify(state string) {
+	if err := SdNotify(state); err != nil {
+		k.Log.Warning("sd_notify %q: %s", state, err)
+	}
+}
+
+// SdNotify sends the given state to systemd, as described by sd_notify(3).
+//
+// If the NOTIFY_SOCKET environment variable is not set, SdNotify
+// does nothing and returns nil.
+func SdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	addr := &net.UnixAddr{
+		Name: socket,
+		Net:  "unixgram",
+	}
+
+	// Abstract socket names are prefixed with '@' in the environment.
+	if socket[0] == '@' {
+		addr.Name = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,50 @@
+package kite
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSdNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "kite-sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := &net.UnixAddr{
+		Name: filepath.Join(dir, "notify.sock"),
+		Net:  "unixgram",
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET"))
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Fatalf("SdNotify()=%s", err)
+	}
+
+	p := make([]byte, 64)
+	n, err := conn.Read(p)
+	if err != nil {
+		t.Fatalf("Read()=%s", err)
+	}
+
+	if got := string(p[:n]); got != "READY=1" {
+		t.Fatalf("got %q, want %q", got, "READY=1")
+	}
+}
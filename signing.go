@@ -0,0 +1,335 @@
+package kite
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/koding/kite/cbor"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Encodings of signed envelopes, see Kite.SigningEncoding.
+const (
+	SigningJSON = "json" // canonical JSON
+	SigningCBOR = "cbor" // deterministic CBOR
+)
+
+// Signature algorithms other than Ed25519, see Kite.Signer.
+const (
+	SignatureES256 = "ES256" // ECDSA with P-256 and SHA-256
+	SignatureRS256 = "RS256" // RSASSA-PKCS1-v1_5 with SHA-256
+)
+
+// Signature is a signature of a method call, see Kite.SigningKey
+// and Kite.Signer.
+type Signature struct {
+	// KeyID identifies the public key, which verifies the signature.
+	KeyID string `json:"keyId"`
+
+	// Time is the time the call was signed.
+	Time time.Time `json:"time"`
+
+	// Value is the signature of the canonical envelope of the call.
+	Value []byte `json:"value"`
+
+	// Encoding is the encoding of the signed envelope. Empty value
+	// means SigningJSON.
+	Encoding string `json:"encoding,omitempty"`
+
+	// Algorithm is the signature algorithm, SignatureES256 or
+	// SignatureRS256. Empty value means Ed25519.
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// envelope is the signed part of a method call. It is encoded with sorted
+// keys and with arguments re-encoded, so it does not depend on the
+// formatting of the message on the wire.
+type envelope struct {
+	Method    string          `json:"method"`
+	Kite      protocol.Kite   `json:"kite"`
+	WithArgs  json.RawMessage `json:"withArgs"`
+	MessageID string          `json:"messageId,omitempty"`
+	ExpiresAt int64           `json:"expiresAt,omitempty"`
+	KeyID     string          `json:"keyId"`
+	Time      time.Time       `json:"time"`
+}
+
+// bytes gives the canonical encoding of the envelope.
+func (e *envelope) bytes(encoding string) ([]byte, error) {
+	args, err := dnode.CanonicalJSON(e.WithArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	e.WithArgs = args
+
+	switch encoding {
+	case "", SigningJSON:
+		return json.Marshal(e)
+	case SigningCBOR:
+		return cbor.Marshal(e)
+	default:
+		return nil, fmt.Errorf("unknown signing encoding %q", encoding)
+	}
+}
+
+// AuditRecord describes a call with a verified signature. It holds the signed
+// envelope, so the signature can be verified again later by a third party.
+type AuditRecord struct {
+	RequestID string
+	Method    string
+	Username  string
+	Kite      protocol.Kite
+	Signature *Signature
+	Envelope  []byte // canonical encoding of the signed envelope
+}
+
+// TrustSigningKey makes the kite accept calls signed with the private
+// counterpart of the given key, see Kite.SigningKey.
+func (k *Kite) TrustSigningKey(keyID string, key ed25519.PublicKey) {
+	k.trustKey(keyID, key)
+}
+
+// TrustPublicKey makes the kite accept calls signed with the private
+// counterpart of the given key, see Kite.Signer. The key is either
+// ed25519.PublicKey, *ecdsa.PublicKey with the P-256 curve or
+// *rsa.PublicKey.
+func (k *Kite) TrustPublicKey(keyID string, key crypto.PublicKey) error {
+	switch key := key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return errors.New("ECDSA signing keys must use the P-256 curve")
+		}
+	default:
+		return fmt.Errorf("unsupported signing key type %T", key)
+	}
+
+	k.trustKey(keyID, key)
+
+	return nil
+}
+
+func (k *Kite) trustKey(keyID string, key crypto.PublicKey) {
+	k.signingMu.Lock()
+	defer k.signingMu.Unlock()
+
+	if k.signingKeys == nil {
+		k.signingKeys = make(map[string]crypto.PublicKey)
+	}
+
+	k.signingKeys[keyID] = key
+}
+
+// UntrustSigningKey removes the key added with TrustSigningKey.
+func (k *Kite) UntrustSigningKey(keyID string) {
+	k.signingMu.Lock()
+	defer k.signingMu.Unlock()
+
+	delete(k.signingKeys, keyID)
+}
+
+func (k *Kite) signingKey(keyID string) crypto.PublicKey {
+	k.signingMu.RLock()
+	defer k.signingMu.RUnlock()
+
+	return k.signingKeys[keyID]
+}
+
+// RequireSignature makes the method reject calls, which are not signed with
+// a key trusted by the kite, see Kite.TrustSigningKey.
+func (m *Method) RequireSignature() *Method {
+	m.signed = true
+	return m
+}
+
+// signs tells whether the kite signs method calls.
+func (k *Kite) signs() bool {
+	return k.SigningKey != nil || k.Signer != nil
+}
+
+// sign adds a signature to the wrapped method arguments,
+// if the local kite has a signing key.
+func (c *Client) sign(method string, wrapped []interface{}) error {
+	k := c.LocalKite
+
+	if !k.signs() {
+		return nil
+	}
+
+	options := wrapped[0].(callOptionsOut)
+
+	args, err := json.Marshal(options.WithArgs)
+	if err != nil {
+		return err
+	}
+
+	sig := &Signature{
+		KeyID:    k.SigningKeyID,
+		Time:     time.Now().UTC(),
+		Encoding: k.SigningEncoding,
+	}
+
+	e := &envelope{
+		Method:    method,
+		Kite:      options.Kite,
+		WithArgs:  args,
+		MessageID: options.MessageID,
+		ExpiresAt: options.ExpiresAt,
+		KeyID:     sig.KeyID,
+		Time:      sig.Time,
+	}
+
+	p, err := e.bytes(sig.Encoding)
+	if err != nil {
+		return err
+	}
+
+	if sig.Algorithm, sig.Value, err = k.signBytes(p); err != nil {
+		return err
+	}
+
+	options.Signature = sig
+	wrapped[0] = options
+
+	return nil
+}
+
+// verifySignature verifies the signature of the request, if there is any,
+// and records it with Kite.Audit. It fails if the signature is required
+// but missing.
+func (r *Request) verifySignature(required bool) error {
+	sig := r.options.Signature
+
+	if sig == nil {
+		if required {
+			return errors.New("signature is required")
+		}
+		return nil
+	}
+
+	key := r.LocalKite.signingKey(sig.KeyID)
+	if key == nil {
+		return fmt.Errorf("unknown signing key %q", sig.KeyID)
+	}
+
+	var args []byte
+	if r.Args != nil {
+		args = r.Args.Raw
+	}
+
+	e := &envelope{
+		Method:    r.Method,
+		Kite:      r.options.Kite,
+		WithArgs:  args,
+		MessageID: r.MessageID,
+		ExpiresAt: r.options.ExpiresAt,
+		KeyID:     sig.KeyID,
+		Time:      sig.Time,
+	}
+
+	p, err := e.bytes(sig.Encoding)
+	if err != nil {
+		return err
+	}
+
+	if !verifyBytes(key, sig.Algorithm, p, sig.Value) {
+		return errors.New("invalid signature")
+	}
+
+	if max := r.LocalKite.MaxSignatureAge; max > 0 {
+		age := time.Since(sig.Time.Add(-r.Client.clockOffset()))
+		if age > max || age < -max {
+			return fmt.Errorf("signature time %s is more than %s off", sig.Time.Format(time.RFC3339), max)
+		}
+	}
+
+	r.Signature = sig
+
+	r.LocalKite.audit(&AuditRecord{
+		RequestID: r.ID,
+		Method:    r.Method,
+		Username:  r.Username,
+		Kite:      r.options.Kite,
+		Signature: sig,
+		Envelope:  p,
+	})
+
+	return nil
+}
+
+// signBytes signs the envelope with Kite.Signer or Kite.SigningKey.
+// It gives the signature algorithm, which is empty for Ed25519.
+func (k *Kite) signBytes(p []byte) (string, []byte, error) {
+	if k.Signer == nil {
+		return "", ed25519.Sign(k.SigningKey, p), nil
+	}
+
+	switch k.Signer.Public().(type) {
+	case ed25519.PublicKey:
+		sig, err := k.Signer.Sign(rand.Reader, p, crypto.Hash(0))
+		return "", sig, err
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(p)
+		sig, err := k.Signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+		return SignatureES256, sig, err
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(p)
+		sig, err := k.Signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+		return SignatureRS256, sig, err
+	default:
+		return "", nil, fmt.Errorf("unsupported signer key type %T", k.Signer.Public())
+	}
+}
+
+// verifyBytes verifies the signature of the envelope. The algorithm
+// must match the type of the key.
+func verifyBytes(key crypto.PublicKey, alg string, p, sig []byte) bool {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return alg == "" && ed25519.Verify(key, p, sig)
+	case *ecdsa.PublicKey:
+		var esig struct {
+			R, S *big.Int
+		}
+
+		if alg != SignatureES256 {
+			return false
+		}
+
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) != 0 {
+			return false
+		}
+
+		sum := sha256.Sum256(p)
+		return ecdsa.Verify(key, sum[:], esig.R, esig.S)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(p)
+		return alg == SignatureRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil
+	default:
+		return false
+	}
+}
+
+func (k *Kite) audit(rec *AuditRecord) {
+	if k.Audit != nil {
+		defer nopRecover()
+		k.Audit(rec)
+		return
+	}
+
+	k.Log.Info("audit: %s called %q signed with %q at %s (request %s)", rec.Username,
+		rec.Method, rec.Signature.KeyID, rec.Signature.Time.Format(time.RFC3339), rec.RequestID)
+}
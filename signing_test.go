@@ -0,0 +1,244 @@
+package kite
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestSigning(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, untrusted, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	audited := make(chan *AuditRecord, 1)
+
+	srv := NewWithConfig("signing-server", "0.0.1", cfg)
+	srv.TrustSigningKey("admin", pub)
+	srv.Audit = func(rec *AuditRecord) {
+		audited <- rec
+	}
+	srv.HandleFunc("reboot", func(r *Request) (interface{}, error) {
+		return r.Signature.KeyID, nil
+	}).RequireSignature()
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cases := map[string]struct {
+		key      ed25519.PrivateKey
+		keyID    string
+		encoding string
+		err      string
+	}{
+		"trusted key":        {priv, "admin", "", ""},
+		"trusted key cbor":   {priv, "admin", SigningCBOR, ""},
+		"unsigned":           {nil, "", "", "signature is required"},
+		"unknown key":        {priv, "other", "", `unknown signing key "other"`},
+		"untrusted key":      {untrusted, "admin", "", "invalid signature"},
+		"untrusted key cbor": {untrusted, "admin", SigningCBOR, "invalid signature"},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := New("signing-client", "0.0.1")
+			k.SigningKey = cas.key
+			k.SigningKeyID = cas.keyID
+			k.SigningEncoding = cas.encoding
+
+			c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+			if err := c.Dial(); err != nil {
+				t.Fatalf("Dial()=%s", err)
+			}
+			defer c.Close()
+
+			args := map[string]interface{}{"host": "db-1", "force": true, "delay": 1.5}
+
+			result, err := c.Tell("reboot", args)
+			if cas.err != "" {
+				e, ok := err.(*Error)
+				if !ok || e.Type != "authenticationError" || !strings.Contains(e.Message, cas.err) {
+					t.Fatalf("got %v, want authenticationError containing %q", err, cas.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Tell()=%s", err)
+			}
+
+			if got := result.MustString(); got != cas.keyID {
+				t.Fatalf("got %q, want %q", got, cas.keyID)
+			}
+
+			rec := <-audited
+
+			if rec.Method != "reboot" || rec.Signature.KeyID != cas.keyID {
+				t.Fatalf("got %+v", rec)
+			}
+
+			if !ed25519.Verify(pub, rec.Envelope, rec.Signature.Value) {
+				t.Fatal("want audit record to be verifiable")
+			}
+		})
+	}
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("signer-server", "0.0.1", cfg)
+	srv.HandleFunc("reboot", func(r *Request) (interface{}, error) {
+		return r.Signature.Algorithm, nil
+	}).RequireSignature()
+
+	for keyID, key := range map[string]crypto.PublicKey{
+		"ecdsa":   &ecKey.PublicKey,
+		"rsa":     &rsaKey.PublicKey,
+		"ed25519": edKey.Public(),
+	} {
+		if err := srv.TrustPublicKey(keyID, key); err != nil {
+			t.Fatalf("TrustPublicKey(%q)=%s", keyID, err)
+		}
+	}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cases := map[string]struct {
+		signer crypto.Signer
+		keyID  string
+		alg    string
+		err    string
+	}{
+		"ecdsa":          {ecKey, "ecdsa", SignatureES256, ""},
+		"rsa":            {rsaKey, "rsa", SignatureRS256, ""},
+		"ed25519":        {edKey, "ed25519", "", ""},
+		"key type mixup": {ecKey, "rsa", "", "invalid signature"},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := New("signer-client", "0.0.1")
+			k.Signer = cas.signer
+			k.SigningKeyID = cas.keyID
+
+			c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+			if err := c.Dial(); err != nil {
+				t.Fatalf("Dial()=%s", err)
+			}
+			defer c.Close()
+
+			result, err := c.Tell("reboot", "db-1")
+			if cas.err != "" {
+				if e, ok := err.(*Error); !ok || !strings.Contains(e.Message, cas.err) {
+					t.Fatalf("got %v, want error containing %q", err, cas.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Tell()=%s", err)
+			}
+
+			if got := result.MustString(); got != cas.alg {
+				t.Fatalf("got %q, want %q", got, cas.alg)
+			}
+		})
+	}
+}
+
+func TestSignatureAge(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := New("signing-server", "0.0.1")
+	k.TrustSigningKey("admin", pub)
+	k.MaxSignatureAge = time.Minute
+	k.MaxClockSkew = 5 * time.Minute
+	k.Audit = func(*AuditRecord) {}
+
+	cases := []struct {
+		signed time.Duration // relative to the local clock
+		offset time.Duration // of the caller's clock
+		ok     bool
+	}{
+		{0, 0, true},
+		{-2 * time.Minute, 0, false},                // replayed
+		{2 * time.Minute, 0, false},                 // from the future
+		{2 * time.Minute, 2 * time.Minute, true},    // caller's clock is ahead
+		{-2 * time.Minute, -2 * time.Minute, true},  // caller's clock is behind
+		{10 * time.Minute, 10 * time.Minute, false}, // skew is not tolerated
+	}
+
+	for i, cas := range cases {
+		sig := &Signature{
+			KeyID: "admin",
+			Time:  time.Now().Add(cas.signed).UTC(),
+		}
+
+		e := &envelope{
+			Method: "reboot",
+			KeyID:  sig.KeyID,
+			Time:   sig.Time,
+		}
+
+		p, err := e.bytes("")
+		if err != nil {
+			t.Fatalf("%d: bytes()=%s", i, err)
+		}
+
+		sig.Value = ed25519.Sign(priv, p)
+
+		r := &Request{
+			Method:    "reboot",
+			LocalKite: k,
+			Client: &Client{
+				LocalKite: k,
+				skew:      &ClockSkew{Offset: cas.offset},
+			},
+			options: &callOptions{Signature: sig},
+		}
+
+		if err := r.verifySignature(true); (err == nil) != cas.ok {
+			t.Errorf("%d: got %v, want ok=%t", i, err, cas.ok)
+		}
+	}
+}
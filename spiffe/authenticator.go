@@ -0,0 +1,91 @@
+package spiffe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/koding/kite"
+)
+
+// Authenticator authenticates calls by X.509 SVIDs the calling kites
+// presented in TLS handshakes, see Source.ServerConfig.
+type Authenticator struct {
+	// Source gives the trust bundle SVIDs are verified with.
+	//
+	// Required.
+	Source *Source
+
+	// TrustDomains lists the trust domains callers may belong to.
+	//
+	// If empty, only the trust domain of Source is accepted.
+	TrustDomains []string
+
+	// Mappings map SPIFFE IDs of callers to kite identities. The first
+	// matching mapping is used, callers without a matching mapping are
+	// rejected.
+	//
+	// If empty, callers are authenticated with their SPIFFE IDs as
+	// usernames and without scopes.
+	Mappings []Mapping
+}
+
+// Authenticate is a kite authenticator, which verifies the SVID of the
+// caller and maps its SPIFFE ID to the username and scopes of the request.
+func (a *Authenticator) Authenticate(r *kite.Request) error {
+	state := r.Client.TLSConnectionState()
+	if state == nil {
+		return errors.New("spiffe: connection is not secured with TLS")
+	}
+
+	id, err := a.Source.Verify(state.PeerCertificates)
+	if err != nil {
+		return fmt.Errorf("spiffe: %s", err)
+	}
+
+	if !a.trusted(id.TrustDomain) {
+		return fmt.Errorf("spiffe: trust domain is not trusted: %s", id.TrustDomain)
+	}
+
+	if len(a.Mappings) == 0 {
+		r.Username = id.String()
+		return nil
+	}
+
+	for i := range a.Mappings {
+		m := &a.Mappings[i]
+
+		if !m.matches(id) {
+			continue
+		}
+
+		if m.Name != "" && m.Name != r.Client.Kite.Name {
+			return fmt.Errorf("spiffe: %s may not call as kite %q", id, r.Client.Kite.Name)
+		}
+
+		r.Username = m.Username
+		if r.Username == "" {
+			r.Username = id.String()
+		}
+
+		r.Scopes = m.Scopes
+
+		return nil
+	}
+
+	return fmt.Errorf("spiffe: %s is not mapped to a kite identity", id)
+}
+
+func (a *Authenticator) trusted(domain string) bool {
+	if len(a.TrustDomains) == 0 {
+		return strings.EqualFold(domain, a.Source.ID().TrustDomain)
+	}
+
+	for _, d := range a.TrustDomains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+
+	return false
+}
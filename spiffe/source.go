@@ -0,0 +1,287 @@
+package spiffe
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Source gives the X.509 SVID of the kite and the trust bundle, which
+// verifies SVIDs of other kites. They are read from PEM files written
+// by the SPIRE agent and are reloaded when the agent rotates them.
+type Source struct {
+	// CertFile holds the SVID, optionally followed by intermediate
+	// certificates.
+	CertFile string
+
+	// KeyFile holds the private key of the SVID.
+	KeyFile string
+
+	// BundleFile holds the CA certificates of the trust domain.
+	BundleFile string
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	id     ID
+	bundle *x509.CertPool
+	files  [][]byte // contents of CertFile, KeyFile and BundleFile
+	err    error    // of the last reload
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSource reads the SVID and the trust bundle from the files and
+// re-reads them every interval, until the source is closed. Zero
+// interval disables reloading.
+func NewSource(certFile, keyFile, bundleFile string, interval time.Duration) (*Source, error) {
+	s := &Source{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		BundleFile: bundleFile,
+		closeC:     make(chan struct{}),
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go s.poll(interval)
+	}
+
+	return s, nil
+}
+
+// Reload reads the files of the source. If they cannot be read or parsed,
+// the source keeps the SVID and the bundle read previously.
+func (s *Source) Reload() error {
+	err := s.reload()
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+
+	return err
+}
+
+func (s *Source) reload() error {
+	var files [][]byte
+
+	for _, file := range []string{s.CertFile, s.KeyFile, s.BundleFile} {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, p)
+	}
+
+	s.mu.RLock()
+	unchanged := s.files != nil && bytes.Equal(files[0], s.files[0]) &&
+		bytes.Equal(files[1], s.files[1]) && bytes.Equal(files[2], s.files[2])
+	s.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(files[0], files[1])
+	if err != nil {
+		return fmt.Errorf("spiffe: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("spiffe: %s", err)
+	}
+
+	cert.Leaf = leaf
+
+	id, err := IDFromCertificate(leaf)
+	if err != nil {
+		return fmt.Errorf("spiffe: %s", err)
+	}
+
+	bundle, err := parseBundle(files[2])
+	if err != nil {
+		return fmt.Errorf("spiffe: %s", err)
+	}
+
+	s.mu.Lock()
+	s.cert, s.id, s.bundle, s.files = &cert, id, bundle, files
+	s.mu.Unlock()
+
+	return nil
+}
+
+func parseBundle(p []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	n := 0
+
+	for {
+		var block *pem.Block
+		if block, p = pem.Decode(p); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		pool.AddCert(cert)
+		n++
+	}
+
+	if n == 0 {
+		return nil, errors.New("trust bundle has no certificates")
+	}
+
+	return pool, nil
+}
+
+// ID gives the SPIFFE ID of the kite.
+func (s *Source) ID() ID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.id
+}
+
+// Certificate gives the current SVID of the kite.
+func (s *Source) Certificate() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cert
+}
+
+// Bundle gives the current trust bundle.
+func (s *Source) Bundle() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.bundle
+}
+
+// Err gives the error of the last reload, or nil if it succeeded.
+func (s *Source) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// Close stops reloading the files.
+func (s *Source) Close() {
+	s.closeOnce.Do(func() { close(s.closeC) })
+}
+
+func (s *Source) poll(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.closeC:
+			return
+		case <-t.C:
+			s.Reload()
+		}
+	}
+}
+
+// Verify verifies the certificate chain presented by a peer against the
+// trust bundle and gives the SPIFFE ID of the peer.
+func (s *Source) Verify(chain []*x509.Certificate) (ID, error) {
+	if len(chain) == 0 {
+		return ID{}, errors.New("no certificate presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         s.Bundle(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return ID{}, err
+	}
+
+	return IDFromCertificate(chain[0])
+}
+
+// ServerConfig gives a TLS configuration for Kite.TLSConfig, which serves
+// the SVID and asks clients for theirs. Presented SVIDs are verified against
+// the trust bundle. Clients without SVIDs are accepted, so other
+// authentication types keep working; use Authenticator to authenticate
+// calls by SVIDs.
+func (s *Source) ServerConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.Certificate(), nil
+		},
+		ClientAuth:            tls.RequestClientCert,
+		VerifyPeerCertificate: s.verifyPeer(nil, true),
+	}
+}
+
+// ClientConfig gives a TLS configuration for kite clients, e.g. for
+// Config.Websocket.TLSClientConfig, which presents the SVID to servers.
+// Servers are verified by their SVIDs instead of host names; if authorize
+// is non-nil, it must accept the ID of the server.
+func (s *Source) ClientConfig(authorize func(ID) error) *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.Certificate(), nil
+		},
+		// Host names are not verified, VerifyPeerCertificate verifies
+		// the SVID instead.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: s.verifyPeer(authorize, false),
+	}
+}
+
+func (s *Source) verifyPeer(authorize func(ID) error, optional bool) func([][]byte, [][]*x509.Certificate) error {
+	return func(raw [][]byte, _ [][]*x509.Certificate) error {
+		if len(raw) == 0 && optional {
+			return nil
+		}
+
+		chain := make([]*x509.Certificate, 0, len(raw))
+		for _, p := range raw {
+			cert, err := x509.ParseCertificate(p)
+			if err != nil {
+				return err
+			}
+
+			chain = append(chain, cert)
+		}
+
+		id, err := s.Verify(chain)
+		if err != nil {
+			return fmt.Errorf("spiffe: %s", err)
+		}
+
+		if authorize != nil {
+			return authorize(id)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+// Package spiffe gives kites identities from SPIFFE workload identity
+// documents, so kites in a mesh authenticate each other without a token
+// authority like kontrol.
+//
+// Kites present their X.509 SVIDs in mutually authenticated TLS
+// connections. The SVIDs and trust bundles are read from files written by
+// the SPIRE agent, e.g. with spiffe-helper, and are reloaded when rotated:
+//
+//	src, err := spiffe.NewSource("svid.pem", "svid_key.pem", "bundle.pem", time.Minute)
+//	...
+//	k.TLSConfig = src.ServerConfig()
+//	k.Config.Websocket.TLSClientConfig = src.ClientConfig(nil)
+//
+//	a := &spiffe.Authenticator{
+//	    Source: src,
+//	    Mappings: []spiffe.Mapping{{
+//	        Path:   "/ns/*/sa/billing",
+//	        Name:   "billing",
+//	        Scopes: []string{"invoices:read"},
+//	    }},
+//	}
+//
+//	k.Authenticators["spiffe"] = a.Authenticate
+//
+// Calling kites use the "spiffe" authentication type with an empty key.
+package spiffe
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ID is a SPIFFE ID, like "spiffe://example.org/ns/prod/sa/billing".
+type ID struct {
+	TrustDomain string // e.g. "example.org"
+	Path        string // e.g. "/ns/prod/sa/billing"
+}
+
+// ParseID parses the SPIFFE ID.
+func ParseID(s string) (ID, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ID{}, err
+	}
+
+	if u.Scheme != "spiffe" {
+		return ID{}, fmt.Errorf("invalid SPIFFE ID scheme: %q", s)
+	}
+
+	if u.Host == "" || u.User != nil || u.Port() != "" {
+		return ID{}, fmt.Errorf("invalid SPIFFE ID trust domain: %q", s)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return ID{}, fmt.Errorf("invalid SPIFFE ID: %q", s)
+	}
+
+	return ID{
+		TrustDomain: strings.ToLower(u.Host),
+		Path:        u.Path,
+	}, nil
+}
+
+// String gives the URI form of the ID.
+func (id ID) String() string {
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+// IDFromCertificate gives the SPIFFE ID of the X.509 SVID, which is its
+// only URI subject alternative name.
+func IDFromCertificate(cert *x509.Certificate) (ID, error) {
+	uris, err := certificateURIs(cert)
+	if err != nil {
+		return ID{}, err
+	}
+
+	if len(uris) != 1 {
+		return ID{}, errors.New("certificate is not an SVID: it must have exactly one URI SAN")
+	}
+
+	return ParseID(uris[0])
+}
+
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// certificateURIs gives the URI subject alternative names of the
+// certificate, which crypto/x509 does not parse.
+func certificateURIs(cert *x509.Certificate) ([]string, error) {
+	var uris []string
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil, err
+		} else if len(rest) != 0 {
+			return nil, errors.New("trailing data after subject alternative names")
+		}
+
+		for p := seq.Bytes; len(p) != 0; {
+			var name asn1.RawValue
+
+			rest, err := asn1.Unmarshal(p, &name)
+			if err != nil {
+				return nil, err
+			}
+
+			// uniformResourceIdentifier [6] IA5String
+			if name.Class == asn1.ClassContextSpecific && name.Tag == 6 {
+				uris = append(uris, string(name.Bytes))
+			}
+
+			p = rest
+		}
+	}
+
+	return uris, nil
+}
+
+// Mapping maps SPIFFE IDs to kite identities, see Authenticator.
+type Mapping struct {
+	// TrustDomain is the trust domain of the IDs.
+	//
+	// If empty, IDs of any trusted domain are mapped.
+	TrustDomain string
+
+	// Path is the path pattern of the IDs. A "*" segment matches any
+	// segment and a trailing "/**" matches any number of segments,
+	// e.g. "/ns/*/sa/billing" or "/ns/prod/**".
+	//
+	// Required.
+	Path string
+
+	// Name is the name of the kite, the caller must claim. If empty,
+	// the caller may claim any name.
+	Name string
+
+	// Username is the username of the caller.
+	//
+	// If empty, the SPIFFE ID is used.
+	Username string
+
+	// Scopes are granted to the caller, see kite.Request.Scopes.
+	Scopes []string
+}
+
+// matches tells whether the mapping applies to the ID.
+func (m *Mapping) matches(id ID) bool {
+	if m.TrustDomain != "" && !strings.EqualFold(m.TrustDomain, id.TrustDomain) {
+		return false
+	}
+
+	pattern := strings.Split(strings.Trim(m.Path, "/"), "/")
+	path := strings.Split(strings.Trim(id.Path, "/"), "/")
+
+	if n := len(pattern); n != 0 && pattern[n-1] == "**" {
+		pattern = pattern[:n-1]
+		if len(path) < len(pattern) {
+			return false
+		}
+
+		path = path[:len(pattern)]
+	}
+
+	if len(pattern) != len(path) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
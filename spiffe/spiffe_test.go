@@ -0,0 +1,289 @@
+package spiffe_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/spiffe"
+)
+
+func TestParseID(t *testing.T) {
+	cases := map[string]bool{
+		"spiffe://example.org/ns/prod/sa/billing": true,
+		"spiffe://Example.org":                    true,
+		"https://example.org/ns/prod":             false,
+		"spiffe:///ns/prod":                       false,
+		"spiffe://example.org:8443/ns/prod":       false,
+		"spiffe://example.org/ns/prod?x=1":        false,
+	}
+
+	for s, ok := range cases {
+		id, err := spiffe.ParseID(s)
+		if ok != (err == nil) {
+			t.Fatalf("%s: got err=%v, want ok=%t", s, err, ok)
+		}
+
+		if ok && id.TrustDomain != "example.org" {
+			t.Fatalf("%s: got trust domain %q", s, id.TrustDomain)
+		}
+	}
+}
+
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"SPIRE"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		key:  key,
+		cert: cert,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// svid writes the SVID with the given ID and the trust bundle of the CA
+// into the directory and gives a source reading them.
+func (ca *testCA) svid(t *testing.T, dir, id string) *spiffe.Source {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(id)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(time.Now().UnixNano()),
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Critical: true, Value: san}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"svid.pem":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"svid_key.pem": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		"bundle.pem":   ca.pem,
+	}
+
+	for name, p := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), p, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := spiffe.NewSource(filepath.Join(dir, "svid.pem"), filepath.Join(dir, "svid_key.pem"), filepath.Join(dir, "bundle.pem"), 0)
+	if err != nil {
+		t.Fatalf("NewSource()=%s", err)
+	}
+
+	return src
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spiffe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestAuthenticator(t *testing.T) {
+	ca := newTestCA(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, sub := range []string{"server", "billing", "other"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serverSrc := ca.svid(t, filepath.Join(dir, "server"), "spiffe://example.org/ns/prod/sa/server")
+	billingSrc := ca.svid(t, filepath.Join(dir, "billing"), "spiffe://example.org/ns/prod/sa/billing")
+	otherSrc := ca.svid(t, filepath.Join(dir, "other"), "spiffe://other.org/ns/prod/sa/billing")
+
+	if got := billingSrc.ID().String(); got != "spiffe://example.org/ns/prod/sa/billing" {
+		t.Fatalf("got ID %q", got)
+	}
+
+	a := &spiffe.Authenticator{
+		Source: serverSrc,
+		Mappings: []spiffe.Mapping{{
+			Path:     "/ns/*/sa/billing",
+			Name:     "billing",
+			Username: "billing",
+			Scopes:   []string{"invoices:read"},
+		}},
+	}
+
+	srv := kite.NewWithConfig("server", "0.0.1", config.New())
+	srv.Authenticators["spiffe"] = a.Authenticate
+	srv.TLSConfig = serverSrc.ServerConfig()
+	srv.HandleFunc("whoami", func(r *kite.Request) (interface{}, error) {
+		return map[string]interface{}{
+			"username": r.Username,
+			"scopes":   r.Scopes,
+		}, nil
+	})
+
+	// StartTLS would serve the certificate of httptest instead of the SVID.
+	ts := httptest.NewUnstartedServer(srv)
+	ts.Listener = tls.NewListener(ts.Listener, srv.TLSConfig)
+	ts.Start()
+	defer ts.Close()
+
+	url := strings.Replace(ts.URL, "http://", "https://", 1) + "/kite"
+
+	call := func(name string, src *spiffe.Source) (map[string]interface{}, error) {
+		k := kite.New(name, "0.0.1")
+		k.Config.Websocket = &websocket.Dialer{
+			TLSClientConfig: src.ClientConfig(func(id spiffe.ID) error {
+				if id.Path != "/ns/prod/sa/server" {
+					return fmt.Errorf("unexpected server %s", id)
+				}
+				return nil
+			}),
+		}
+
+		c := k.NewClient(url, kite.WithAuth(&kite.Auth{Type: "spiffe"}))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("%s: Dial()=%s", name, err)
+		}
+		defer c.Close()
+
+		resp, err := c.TellWithTimeout("whoami", 4*time.Second)
+		if err != nil {
+			return nil, err
+		}
+
+		var v map[string]interface{}
+		if err := resp.Unmarshal(&v); err != nil {
+			t.Fatalf("%s: Unmarshal()=%s", name, err)
+		}
+
+		return v, nil
+	}
+
+	got, err := call("billing", billingSrc)
+	if err != nil {
+		t.Fatalf("billing: %s", err)
+	}
+
+	want := map[string]interface{}{
+		"username": "billing",
+		"scopes":   []interface{}{"invoices:read"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// The mapping restricts the kite name the caller may claim.
+	if _, err := call("impostor", billingSrc); err == nil {
+		t.Fatal("expected a caller claiming another name to be rejected")
+	}
+
+	// The caller is not mapped.
+	if _, err := call("server", serverSrc); err == nil {
+		t.Fatal("expected an unmapped caller to be rejected")
+	}
+
+	// The trust domain is not trusted.
+	if _, err := call("billing", otherSrc); err == nil {
+		t.Fatal("expected a caller of another trust domain to be rejected")
+	}
+}
+
+func TestSourceReload(t *testing.T) {
+	ca := newTestCA(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := ca.svid(t, dir, "spiffe://example.org/first")
+
+	ca.svid(t, dir, "spiffe://example.org/second")
+
+	if err := src.Reload(); err != nil {
+		t.Fatalf("Reload()=%s", err)
+	}
+
+	if got := src.ID().Path; got != "/second" {
+		t.Fatalf("got %q, want %q", got, "/second")
+	}
+
+	// Invalid files keep the last SVID.
+	if err := ioutil.WriteFile(src.CertFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Reload(); err == nil {
+		t.Fatal("expected Reload() to fail")
+	}
+
+	if got := src.ID().Path; got != "/second" {
+		t.Fatalf("got %q, want %q", got, "/second")
+	}
+}
@@ -0,0 +1,381 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// DefaultHedgeDelay is the time StickyPool.HedgedTell waits before
+// hedging a call, if HedgeDelay is zero.
+var DefaultHedgeDelay = 100 * time.Millisecond
+
+// StickyPool balances calls between instances of a kite, routing all calls
+// made with the same routing key (e.g. a user ID) to the same instance.
+// This lets stateful backend kites keep per-key state in memory.
+//
+// Instances are mapped to keys with consistent hashing, thus when an
+// instance joins or leaves only a fraction of keys is moved to other
+// instances.
+type StickyPool struct {
+	// Pool holds connections to the instances.
+	//
+	// Required.
+	Pool *ConnPool
+
+	// Query selects the instances from kontrol on Refresh.
+	//
+	// If nil, members must be set with SetMembers.
+	Query *protocol.KontrolQuery
+
+	// CheckHealth, when true, makes Refresh skip instances, which are not
+	// ready according to kite.health. Instances, which do not serve
+	// kite.health, are not skipped.
+	CheckHealth bool
+
+	// HedgeDelay is the time HedgedTell waits for the reply of the
+	// instance a call is routed to, before sending the same call to
+	// the next instance.
+	//
+	// If zero, DefaultHedgeDelay is used.
+	HedgeDelay time.Duration
+
+	// SlowStart is the time over which calls are ramped up to members
+	// added to a non-empty pool. The fraction of keys routed to a new
+	// member grows linearly, so its caches warm up gradually, rest of
+	// the keys keep being routed to the next members on the ring.
+	//
+	// If zero, new members take all of their keys at once.
+	SlowStart time.Duration
+
+	// Outliers, when non-nil, enables temporary ejection of members,
+	// which fail or respond much slower than the other ones.
+	Outliers *OutlierDetection
+
+	// Weigh, when non-nil, gives weights of the instances on Refresh,
+	// see PoolMember.Weight. It may derive them from the registered
+	// kites, e.g. to send fewer calls to instances in remote regions.
+	Weigh func(*protocol.Kite) float64
+
+	ring *HashRing
+
+	mu        sync.Mutex
+	auths     map[string]*Auth        // URL -> auth
+	versions  map[string]string       // URL -> kite version
+	weights   map[string]float64      // URL -> weight
+	split     map[string]float64      // version -> fraction of keys
+	state     map[string]*memberState // URL -> state, see route
+	evaluated time.Time               // last evaluation of outliers
+}
+
+// NewStickyPool gives new sticky pool for instances of the kite matching
+// the given query, which uses connections of the given pool.
+func NewStickyPool(pool *ConnPool, query *protocol.KontrolQuery) *StickyPool {
+	return &StickyPool{
+		Pool:  pool,
+		Query: query,
+		ring:  NewHashRing(0),
+		auths: make(map[string]*Auth),
+		state: make(map[string]*memberState),
+	}
+}
+
+// Refresh updates the pool members with the instances currently
+// registered to kontrol.
+func (s *StickyPool) Refresh() error {
+	clients, err := s.Pool.Kite.GetKites(s.Query)
+	if err != nil && err != ErrNoKitesAvailable {
+		return err
+	}
+
+	members := make(map[string]*Auth, len(clients))
+	for _, c := range clients {
+		members[c.URL] = c.Auth
+	}
+
+	if s.CheckHealth {
+		s.removeUnhealthy(members)
+	}
+
+	// The clients are never dialed, close them to stop token renewers.
+	Close(clients)
+
+	s.SetPoolMembers(s.poolMembers(clients, members))
+
+	return nil
+}
+
+// removeUnhealthy checks the health of the members concurrently,
+// removing those, which are not ready.
+func (s *StickyPool) removeUnhealthy(members map[string]*Auth) {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		unhealthy []string
+	)
+
+	for url, auth := range members {
+		wg.Add(1)
+
+		go func(url string, auth *Auth) {
+			defer wg.Done()
+
+			if err := s.healthy(url, auth); err != nil {
+				s.Pool.Kite.Log.Debug("sticky pool: skipping %s: %s", url, err)
+
+				mu.Lock()
+				unhealthy = append(unhealthy, url)
+				mu.Unlock()
+			}
+		}(url, auth)
+	}
+
+	wg.Wait()
+
+	for _, url := range unhealthy {
+		delete(members, url)
+	}
+}
+
+// healthy gives non-nil error if the instance is not ready.
+func (s *StickyPool) healthy(url string, auth *Auth) error {
+	c, err := s.Pool.Get(url, auth)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	h, err := c.Health()
+	if e, ok := err.(*Error); ok && e.Type == "methodNotFound" {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !h.Ready {
+		return errors.New("not ready")
+	}
+
+	return nil
+}
+
+// SetMembers replaces the pool members with the given ones. The map
+// is keyed by URL of an instance, the auth, which may be nil, is used
+// to connect to it.
+func (s *StickyPool) SetMembers(members map[string]*Auth) {
+	m := make(map[string]*PoolMember, len(members))
+	for url, auth := range members {
+		m[url] = &PoolMember{Auth: auth}
+	}
+
+	s.SetPoolMembers(m)
+}
+
+// setMembers replaces the pool members with the given ones.
+//
+// It must be called with s.mu held.
+func (s *StickyPool) setMembers(members map[string]*PoolMember) {
+	urls := make([]string, 0, len(members))
+	auths := make(map[string]*Auth, len(members))
+	versions := make(map[string]string, len(members))
+	weights := make(map[string]float64, len(members))
+
+	for url, m := range members {
+		urls = append(urls, url)
+		auths[url] = m.Auth
+		versions[url] = m.Version
+
+		weights[url] = m.Weight
+		if m.Weight == 0 {
+			weights[url] = 1
+		}
+	}
+
+	now := time.Now()
+
+	state := make(map[string]*memberState, len(members))
+	for _, url := range urls {
+		m, ok := s.state[url]
+		if !ok {
+			m = &memberState{}
+
+			// Members the pool starts with take all keys at once.
+			if len(s.auths) != 0 {
+				m.added = now
+			}
+		}
+
+		state[url] = m
+	}
+
+	s.auths = auths
+	s.versions = versions
+	s.weights = weights
+	s.state = state
+	s.ring.Set(urls...)
+	s.ring.SetWeights(weights)
+}
+
+// Members gives URLs of the pool members.
+func (s *StickyPool) Members() []string {
+	return s.ring.Members()
+}
+
+// Lookup gives URL of the instance the given key is routed to, or empty
+// string if the pool has no members.
+func (s *StickyPool) Lookup(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if urls := s.route(key, 1); len(urls) != 0 {
+		return urls[0]
+	}
+
+	return ""
+}
+
+// Get gives a client connected to the instance the given key is routed to.
+// If the pool has no members, it is refreshed first.
+//
+// The returned client must be closed when it is no longer used.
+func (s *StickyPool) Get(key string) (*PooledClient, error) {
+	if len(s.ring.Members()) == 0 && s.Query != nil {
+		if err := s.Refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	url := s.Lookup(key)
+	if url == "" {
+		return nil, ErrNoKitesAvailable
+	}
+
+	s.mu.Lock()
+	auth := s.auths[url]
+	s.mu.Unlock()
+
+	return s.Pool.Get(url, auth)
+}
+
+// Tell calls the method of the instance the given key is routed to.
+// Unlike calls made with clients given by Get, outcomes of its calls
+// are taken into account by outlier detection, see Outliers.
+func (s *StickyPool) Tell(key, method string, args ...interface{}) (*dnode.Partial, error) {
+	if len(s.ring.Members()) == 0 && s.Query != nil {
+		if err := s.Refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	url := s.Lookup(key)
+	if url == "" {
+		return nil, ErrNoKitesAvailable
+	}
+
+	s.mu.Lock()
+	auth := s.auths[url]
+	s.mu.Unlock()
+
+	return s.tell(context.Background(), url, auth, method, args...)
+}
+
+// tell calls the method of the member and records the outcome.
+func (s *StickyPool) tell(ctx context.Context, url string, auth *Auth, method string, args ...interface{}) (*dnode.Partial, error) {
+	start := time.Now()
+
+	c, err := s.Pool.Get(url, auth)
+	if err != nil {
+		s.observe(url, time.Since(start), err)
+		return nil, err
+	}
+	defer c.Close()
+
+	result, err := c.TellWithContext(ctx, method, args...)
+
+	// Calls canceled by the caller, e.g. the hedged ones, which lost,
+	// tell nothing about the member.
+	if ctx.Err() == nil {
+		s.observe(url, time.Since(start), err)
+	}
+
+	return result, err
+}
+
+// HedgedTell calls the method of the instance the given key is routed to.
+// If it does not reply within HedgeDelay, the same call is sent to the
+// next instance on the ring and the first reply is used. The other call
+// is canceled, though its handler may still run on the remote kite, thus
+// only idempotent methods may be hedged.
+//
+// It bounds the latency of calls, when single instances are slow, e.g.
+// due to garbage collection pauses.
+func (s *StickyPool) HedgedTell(ctx context.Context, key, method string, args ...interface{}) (*dnode.Partial, error) {
+	if len(s.ring.Members()) == 0 && s.Query != nil {
+		if err := s.Refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	urls := s.route(key, 2)
+	auths := make([]*Auth, len(urls))
+	for i, url := range urls {
+		auths[i] = s.auths[url]
+	}
+	s.mu.Unlock()
+
+	if len(urls) == 0 {
+		return nil, ErrNoKitesAvailable
+	}
+
+	// Cancels the call, which lost.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	replies := make(chan *response, len(urls))
+
+	call := func(i int) {
+		result, err := s.tell(ctx, urls[i], auths[i], method, args...)
+		replies <- &response{Result: result, Err: err}
+	}
+
+	go call(0)
+	pending := 1
+
+	var hedge <-chan time.Time
+	if len(urls) > 1 {
+		delay := s.HedgeDelay
+		if delay == 0 {
+			delay = DefaultHedgeDelay
+		}
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+
+		hedge = t.C
+	}
+
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+
+			s.Pool.Kite.Log.Debug("sticky pool: hedging %q call to %s", method, urls[1])
+
+			go call(1)
+			pending++
+		case resp := <-replies:
+			pending--
+
+			if resp.Err == nil || pending == 0 {
+				return resp.Result, resp.Err
+			}
+		}
+	}
+}
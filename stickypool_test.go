@@ -0,0 +1,272 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestStickyPoolHedgedTell(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		slow = make(map[string]bool)
+	)
+
+	members := make(map[string]*Auth)
+
+	for i := 0; i < 2; i++ {
+		cfg := config.New()
+		cfg.DisableAuthentication = true
+
+		srv := NewWithConfig("hedge-server", "0.0.1", cfg)
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		url := fmt.Sprintf("%s/kite", ts.URL)
+		members[url] = nil
+
+		srv.HandleFunc("get", func(r *Request) (interface{}, error) {
+			mu.Lock()
+			delay := slow[url]
+			mu.Unlock()
+
+			if delay {
+				time.Sleep(2 * time.Second)
+			}
+
+			return url, nil
+		})
+	}
+
+	p := NewConnPool(New("hedge-client", "0.0.1"))
+	defer p.Close()
+
+	s := NewStickyPool(p, nil)
+	s.HedgeDelay = 50 * time.Millisecond
+	s.SetMembers(members)
+
+	primary := s.Lookup("user-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	result, err := s.HedgedTell(ctx, "user-1", "get")
+	if err != nil {
+		t.Fatalf("HedgedTell()=%s", err)
+	}
+
+	if got := result.MustString(); got != primary {
+		t.Fatalf("got reply of %s, want the primary %s", got, primary)
+	}
+
+	mu.Lock()
+	slow[primary] = true
+	mu.Unlock()
+
+	start := time.Now()
+
+	result, err = s.HedgedTell(ctx, "user-1", "get")
+	if err != nil {
+		t.Fatalf("HedgedTell()=%s", err)
+	}
+
+	if got := result.MustString(); got == primary {
+		t.Fatal("want reply of the hedged call")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("want the hedged call to bound the latency, took %s", elapsed)
+	}
+}
+
+func TestHashRingGetN(t *testing.T) {
+	r := NewHashRing(0)
+	r.Set("a", "b", "c")
+
+	got := r.GetN("key", 5)
+	if len(got) != 3 {
+		t.Fatalf("got %v, want all of the members", got)
+	}
+
+	if got[0] != r.Get("key") {
+		t.Fatalf("got %v, want %q first", got, r.Get("key"))
+	}
+}
+
+func TestStickyPoolSlowStart(t *testing.T) {
+	s := NewStickyPool(NewConnPool(New("slowstart-client", "0.0.1")), nil)
+	s.SlowStart = time.Hour
+	s.SetMembers(map[string]*Auth{"a": nil, "b": nil})
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+
+	s.SetMembers(map[string]*Auth{"a": nil, "b": nil, "c": nil})
+
+	for _, key := range keys {
+		if got := s.Lookup(key); got == "c" {
+			t.Fatalf("got %q routed to the new member", key)
+		}
+	}
+
+	// Halfway through the slow start.
+	s.mu.Lock()
+	s.state["c"].added = time.Now().Add(-s.SlowStart / 2)
+	s.mu.Unlock()
+
+	var owned, taken int
+	for _, key := range keys {
+		if s.ring.Get(key) == "c" {
+			owned++
+
+			if s.Lookup(key) == "c" {
+				taken++
+			}
+		}
+	}
+
+	if owned == 0 || taken < owned/4 || taken > owned*3/4 {
+		t.Fatalf("got %d of %d keys routed to the new member, want about half", taken, owned)
+	}
+
+	s.mu.Lock()
+	s.state["c"].added = time.Now().Add(-s.SlowStart)
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		if want := s.ring.Get(key); s.Lookup(key) != want {
+			t.Fatalf("got %q not routed to %s after the slow start", key, want)
+		}
+	}
+}
+
+func TestStickyPoolOutliers(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("outlier-server", "0.0.1", cfg)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	outlier := fmt.Sprintf("%s/kite", ts.URL)
+
+	p := NewConnPool(New("outlier-client", "0.0.1"))
+	defer p.Close()
+
+	s := NewStickyPool(p, nil)
+	s.Outliers = &OutlierDetection{
+		Interval:     time.Minute,
+		EjectionTime: time.Hour,
+		MinRequests:  5,
+	}
+	s.SetMembers(map[string]*Auth{"a": nil, "b": nil, outlier: nil})
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("user-%d", i); s.Lookup(k) == outlier {
+			key = k
+		}
+	}
+
+	timeout := &Error{Type: "timeout"}
+	for i := 0; i < 5; i++ {
+		s.observe("a", time.Millisecond, nil)
+		s.observe("b", time.Millisecond, nil)
+		s.observe(outlier, time.Millisecond, timeout)
+	}
+
+	s.mu.Lock()
+	s.evaluated = time.Now().Add(-time.Minute)
+	s.mu.Unlock()
+
+	if got := s.Lookup(key); got == outlier {
+		t.Fatal("want the outlier to be ejected")
+	}
+
+	// Allows probing the outlier, which is re-admitted once it responds.
+	s.mu.Lock()
+	s.state[outlier].probeAt = time.Now()
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(4 * time.Second)
+	for s.Lookup(key) != outlier {
+		if time.Now().After(deadline) {
+			t.Fatal("want the outlier to be re-admitted")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStickyPoolWeights(t *testing.T) {
+	s := NewStickyPool(NewConnPool(New("weights-client", "0.0.1")), nil)
+	s.SetPoolMembers(map[string]*PoolMember{
+		"a": {Weight: 3},
+		"b": {},
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[s.Lookup(fmt.Sprintf("user-%d", i))]++
+	}
+
+	if counts["a"] < 2*counts["b"] {
+		t.Fatalf("got %v, want about three times as many keys routed to a", counts)
+	}
+
+	s.SetWeight("a", 1)
+
+	counts = make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[s.Lookup(fmt.Sprintf("user-%d", i))]++
+	}
+
+	if counts["a"] > 2*counts["b"] || counts["b"] > 2*counts["a"] {
+		t.Fatalf("got %v, want keys split evenly", counts)
+	}
+}
+
+func TestStickyPoolVersionSplit(t *testing.T) {
+	s := NewStickyPool(NewConnPool(New("canary-client", "0.0.1")), nil)
+	s.SetPoolMembers(map[string]*PoolMember{
+		"a":      {Version: "1.0.0"},
+		"b":      {Version: "1.0.0"},
+		"canary": {Version: "1.1.0"},
+	})
+	s.SetVersionSplit(map[string]float64{"1.1.0": 0.05})
+
+	var canary int
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+
+		url := s.Lookup(key)
+		if url == "canary" {
+			canary++
+		}
+
+		if s.Lookup(key) != url {
+			t.Fatalf("got %q routed to different members", key)
+		}
+	}
+
+	if canary < 100 || canary > 300 {
+		t.Fatalf("got %d of 4000 keys routed to the canary, want about 5%%", canary)
+	}
+
+	s.SetPoolMembers(map[string]*PoolMember{
+		"a": {Version: "1.0.0"},
+	})
+
+	for i := 0; i < 100; i++ {
+		if got := s.Lookup(fmt.Sprintf("user-%d", i)); got != "a" {
+			t.Fatalf("got %q, want keys routed to other versions without canaries", got)
+		}
+	}
+}
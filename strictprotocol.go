@@ -0,0 +1,59 @@
+package kite
+
+import (
+	"expvar"
+	"strings"
+
+	"github.com/koding/kite/dnode"
+)
+
+// CloseProtocolError is the code the session is closed with, when a message
+// deviating from the dnode protocol is received, see Kite.StrictProtocol.
+const CloseProtocolError = 4000
+
+// ProtocolErrors counts connections closed due to messages deviating from
+// the dnode protocol, by the offending top-level fields. It is published with the
+// expvar package.
+var ProtocolErrors = expvar.NewMap("kite.protocolErrors")
+
+// maxCloseReason is the maximum length of the close reason of a WebSocket
+// close frame, see RFC 6455, section 5.5.
+const maxCloseReason = 123
+
+// checkProtocol closes the session, if the message does not conform to
+// the dnode protocol.
+func (c *Client) checkProtocol(p []byte) error {
+	var msg map[string]interface{}
+
+	err := c.codec().Unmarshal(p, &msg)
+	if err == nil {
+		err = dnode.CheckMessage(msg)
+	} else {
+		err = &dnode.ProtocolError{Field: "message", Reason: "malformed message: " + err.Error()}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	// Count by the top-level field, to keep the number of keys bounded.
+	field := "message"
+	if e, ok := err.(*dnode.ProtocolError); ok {
+		field = strings.SplitN(e.Field, ".", 2)[0]
+	}
+
+	ProtocolErrors.Add(field, 1)
+
+	c.logger().Warning("closing connection: %s", err)
+
+	reason := "protocol error: " + err.Error()
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+	}
+
+	if session := c.getSession(); session != nil {
+		session.Close(CloseProtocolError, reason)
+	}
+
+	return err
+}
@@ -0,0 +1,67 @@
+package kite
+
+import (
+	"bytes"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStrictProtocol(t *testing.T) {
+	k := New("strict", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.StrictProtocol = true
+
+	k.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	local := New("client", "0.0.1")
+	local.StrictProtocol = true // messages sent by kites conform
+
+	// Breaks the messages of the "broken" method.
+	local.UseFrameFunc(func(f *Frame) error {
+		if f.Direction == Outgoing && frameMethod(f.Data) == "broken" {
+			f.Data = bytes.Replace(f.Data, []byte(`"method"`), []byte(`"extra":1,"method"`), 1)
+		}
+		return nil
+	})
+
+	c := local.NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	disconnected := make(chan struct{}, 1)
+	c.OnDisconnect(func() {
+		disconnected <- struct{}{}
+	})
+
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	var before int64
+	if v, ok := ProtocolErrors.Get("extra").(*expvar.Int); ok {
+		before = v.Value()
+	}
+
+	if _, err := c.TellWithTimeout("broken", 4*time.Second); err == nil {
+		t.Fatal("want the call to fail")
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be closed")
+	}
+
+	if v, ok := ProtocolErrors.Get("extra").(*expvar.Int); !ok || v.Value() != before+1 {
+		t.Fatalf("got %v, want %d protocol errors", v, before+1)
+	}
+}
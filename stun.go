@@ -0,0 +1,173 @@
+package kite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	// DefaultSTUNServers are the STUN servers asked for the public address
+	// of the kite, if Kite.STUNServers is nil.
+	DefaultSTUNServers = []string{
+		"stun.l.google.com:19302",
+		"stun1.l.google.com:19302",
+	}
+
+	// DefaultSTUNTimeout is the time to wait for the response of
+	// a single STUN server.
+	DefaultSTUNTimeout = 3 * time.Second
+)
+
+// Message types, attributes and the magic cookie of STUN, see RFC 5389.
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+	stunMagicCookie      = 0x2112A442
+	stunHeaderSize       = 20
+)
+
+var errSTUNMismatch = errors.New("stun: unexpected response")
+
+// stunIP asks the STUN server for the address the request was sent
+// from, as seen by the server. The request is retransmitted until
+// the timeout elapses, as datagrams may be lost.
+func stunIP(server string, timeout time.Duration) (net.IP, error) {
+	deadline := time.Now().Add(timeout)
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+
+	if _, err := rand.Read(req[8:]); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1500)
+
+	for {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		retransmit := time.Now().Add(500 * time.Millisecond)
+		if retransmit.After(deadline) {
+			retransmit = deadline
+		}
+
+		conn.SetReadDeadline(retransmit)
+
+		for {
+			n, err := conn.Read(buf)
+			if e, ok := err.(net.Error); ok && e.Timeout() && time.Now().Before(deadline) {
+				break // retransmit
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			ip, err := parseSTUNResponse(buf[:n], req[8:])
+			if err == errSTUNMismatch {
+				continue
+			}
+
+			return ip, err
+		}
+	}
+}
+
+// parseSTUNResponse gives the mapped address from the response to
+// the binding request with the given transaction ID.
+func parseSTUNResponse(p, txID []byte) (net.IP, error) {
+	if len(p) < stunHeaderSize ||
+		binary.BigEndian.Uint16(p[0:]) != stunBindingSuccess ||
+		binary.BigEndian.Uint32(p[4:]) != stunMagicCookie ||
+		!bytes.Equal(p[8:stunHeaderSize], txID) {
+		return nil, errSTUNMismatch
+	}
+
+	attrs := p[stunHeaderSize:]
+
+	if n := int(binary.BigEndian.Uint16(p[2:])); n < len(attrs) {
+		attrs = attrs[:n]
+	}
+
+	var mapped net.IP
+
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+
+		if 4+n > len(attrs) {
+			break
+		}
+
+		value := attrs[4 : 4+n]
+
+		switch typ {
+		case stunXorMappedAddress:
+			// the address is XOR-ed with the magic cookie and the
+			// transaction ID
+			if ip := stunAddress(value, p[4:stunHeaderSize]); ip != nil {
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+
+		// attributes are padded to 4 bytes
+		next := 4 + (n+3)&^3
+		if next > len(attrs) {
+			break
+		}
+
+		attrs = attrs[next:]
+	}
+
+	if mapped == nil {
+		return nil, errors.New("stun: response has no mapped address")
+	}
+
+	return mapped, nil
+}
+
+// stunAddress decodes the IP of the address attribute, XOR-ing it
+// with the key, if non-nil.
+func stunAddress(value, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var ip net.IP
+
+	switch family := value[1]; {
+	case family == 0x01 && len(value) >= 8:
+		ip = make(net.IP, net.IPv4len)
+	case family == 0x02 && len(value) >= 20:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil
+	}
+
+	copy(ip, value[4:])
+
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	return ip
+}
@@ -0,0 +1,83 @@
+package kite
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveSTUN answers binding requests with the given address, dropping
+// the first request to exercise retransmissions.
+func serveSTUN(conn net.PacketConn, mapped net.IP) {
+	buf := make([]byte, 1500)
+	dropped := false
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if n < stunHeaderSize || !dropped {
+			dropped = true
+			continue
+		}
+
+		resp := make([]byte, stunHeaderSize+12)
+		binary.BigEndian.PutUint16(resp[0:], stunBindingSuccess)
+		binary.BigEndian.PutUint16(resp[2:], 12)
+		copy(resp[4:], buf[4:stunHeaderSize])
+
+		attr := resp[stunHeaderSize:]
+		binary.BigEndian.PutUint16(attr[0:], stunXorMappedAddress)
+		binary.BigEndian.PutUint16(attr[2:], 8)
+		attr[5] = 0x01
+
+		for i, b := range mapped.To4() {
+			attr[8+i] = b ^ resp[4+i]
+		}
+
+		conn.WriteTo(resp, addr)
+	}
+}
+
+func TestSTUN(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket()=%s", err)
+	}
+	defer conn.Close()
+
+	want := net.ParseIP("203.0.113.7")
+
+	go serveSTUN(conn, want)
+
+	ip, err := stunIP(conn.LocalAddr().String(), 3*time.Second)
+	if err != nil {
+		t.Fatalf("stunIP()=%s", err)
+	}
+
+	if !ip.Equal(want) {
+		t.Fatalf("got %s, want %s", ip, want)
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"172.20.0.1":  true,
+		"192.168.1.1": true,
+		"100.64.0.1":  true,
+		"127.0.0.1":   true,
+		"fd00::1":     true,
+		"203.0.113.7": false,
+		"2001:db8::1": false,
+	}
+
+	for addr, want := range cases {
+		if got := isPrivateIP(net.ParseIP(addr)); got != want {
+			t.Errorf("%s: got %t, want %t", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package kite
+
+import (
+	"bytes"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Service is a part of a kite process run by a Supervisor.
+type Service interface {
+	// Start starts the service. It returns once the service is ready
+	// to be used by the services depending on it.
+	Start() error
+
+	// Stop stops the service.
+	Stop() error
+}
+
+// ServiceError is an error of a single service of a Supervisor.
+type ServiceError struct {
+	// Service is the name of the service.
+	Service string
+
+	// Op is "start", "run" or "stop".
+	Op string
+
+	Err error
+}
+
+// Error implements the built-in error interface.
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("unable to %s %q service: %s", e.Op, e.Service, e.Err)
+}
+
+// SupervisorError is returned by Supervisor methods, when at least one
+// of the services failed.
+type SupervisorError struct {
+	// Errs holds errors of the services in the order they occurred.
+	Errs []*ServiceError
+}
+
+// Error implements the built-in error interface.
+func (err *SupervisorError) Error() string {
+	if len(err.Errs) == 1 {
+		return err.Errs[0].Error()
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "The following services failed:\n\n")
+
+	for _, e := range err.Errs {
+		fmt.Fprintf(&buf, "\t%s\n", e)
+	}
+
+	return buf.String()
+}
+
+// Supervisor runs the kite server together with services supporting it,
+// like the registration to Kontrol or the metrics endpoint, with a single
+// Start/Stop lifecycle:
+//
+//	s := kite.NewSupervisor(k)
+//	s.Registry = &kite.RegistryOptions{}
+//	s.MetricsAddr = "127.0.0.1:9100"
+//	s.AdminAddr = "127.0.0.1:9101"
+//	s.Add("db", db, "server")
+//
+//	if err := s.Run(); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Services are started in the order of their dependencies, and stopped in
+// the reverse order. The built-in services are:
+//
+//   - "server" runs the kite server, see Run
+//   - "registry" keeps the kite registered to Kontrol, it depends on "server"
+//   - "metrics" serves the metrics published with the expvar package
+//   - "admin" serves the admin API, see Kite.AdminHandler
+//
+// A Supervisor is not restartable, once it was stopped.
+type Supervisor struct {
+	Kite *Kite
+
+	// Registry configures the registration of the kite to Kontrol,
+	// see RegisterToRegistry.
+	//
+	// If nil, the kite is not registered.
+	Registry *RegistryOptions
+
+	// MetricsAddr is the address of the HTTP endpoint serving metrics
+	// published with the expvar package under /debug/vars.
+	//
+	// If empty, the metrics are not served.
+	MetricsAddr string
+
+	// AdminAddr is the address of the HTTP endpoint serving the admin API,
+	// which requires requests to be authorized by an admin of the kite.
+	//
+	// If empty, the admin API is not served.
+	AdminAddr string
+
+	// DrainTimeout is the maximum time to wait for requests in flight
+	// to finish, before the kite server is stopped.
+	//
+	// If zero, DefaultDrainTimeout is used.
+	DrainTimeout time.Duration
+
+	services []*supervisedService
+	started  []*supervisedService
+	server   *serverService
+}
+
+type supervisedService struct {
+	name string
+	deps []string
+	svc  Service
+}
+
+// NewSupervisor gives new supervisor running the given kite.
+func NewSupervisor(k *Kite) *Supervisor {
+	return &Supervisor{
+		Kite: k,
+	}
+}
+
+// Add adds the service with the given name, which is started after the
+// services it depends on and stopped before them. Services must be added
+// before the supervisor is started.
+func (s *Supervisor) Add(name string, svc Service, deps ...string) {
+	s.services = append(s.services, &supervisedService{
+		name: name,
+		deps: deps,
+		svc:  svc,
+	})
+}
+
+// Start starts the services in the order of their dependencies. If any
+// of them fails to start, the ones already started are stopped and
+// a *SupervisorError is returned.
+func (s *Supervisor) Start() error {
+	services, err := s.order(append(s.builtins(), s.services...))
+	if err != nil {
+		return err
+	}
+
+	for _, ss := range services {
+		s.Kite.Log.Debug("starting %q service", ss.name)
+
+		if err := ss.svc.Start(); err != nil {
+			supErr := &SupervisorError{
+				Errs: []*ServiceError{{Service: ss.name, Op: "start", Err: err}},
+			}
+
+			if err, ok := s.Stop().(*SupervisorError); ok {
+				supErr.Errs = append(supErr.Errs, err.Errs...)
+			}
+
+			return supErr
+		}
+
+		s.started = append(s.started, ss)
+	}
+
+	return nil
+}
+
+// Stop stops the started services in the reverse order they were started.
+// All of them are stopped, even if some fail to stop, and
+// a *SupervisorError is returned with their errors.
+func (s *Supervisor) Stop() error {
+	var supErr SupervisorError
+
+	for i := len(s.started) - 1; i >= 0; i-- {
+		ss := s.started[i]
+
+		s.Kite.Log.Debug("stopping %q service", ss.name)
+
+		if err := ss.svc.Stop(); err != nil {
+			supErr.Errs = append(supErr.Errs, &ServiceError{Service: ss.name, Op: "stop", Err: err})
+		}
+	}
+
+	s.started = nil
+
+	if len(supErr.Errs) != 0 {
+		return &supErr
+	}
+
+	return nil
+}
+
+// Run is a blocking method, which starts the services and stops them
+// after SIGTERM or SIGINT was received, or the kite server failed.
+// It returns the errors of the services, if any.
+func (s *Supervisor) Run() error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(c)
+
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	var supErr SupervisorError
+
+	select {
+	case sig := <-c:
+		s.Kite.Log.Info("Got signal: %s", sig)
+	case <-s.server.done:
+		supErr.Errs = append(supErr.Errs, &ServiceError{Service: "server", Op: "run", Err: s.server.failure()})
+	}
+
+	if err, ok := s.Stop().(*SupervisorError); ok {
+		supErr.Errs = append(supErr.Errs, err.Errs...)
+	}
+
+	if len(supErr.Errs) != 0 {
+		return &supErr
+	}
+
+	return nil
+}
+
+func (s *Supervisor) builtins() []*supervisedService {
+	s.server = &serverService{
+		k:            s.Kite,
+		drainTimeout: s.DrainTimeout,
+	}
+
+	services := []*supervisedService{{name: "server", svc: s.server}}
+
+	if s.Registry != nil {
+		services = append(services, &supervisedService{
+			name: "registry",
+			deps: []string{"server"},
+			svc:  &registryService{k: s.Kite, opts: s.Registry},
+		})
+	}
+
+	if s.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+
+		services = append(services, &supervisedService{
+			name: "metrics",
+			svc:  &httpService{addr: s.MetricsAddr, handler: mux},
+		})
+	}
+
+	if s.AdminAddr != "" {
+		services = append(services, &supervisedService{
+			name: "admin",
+			svc:  &httpService{addr: s.AdminAddr, handler: s.Kite.AdminHandler()},
+		})
+	}
+
+	return services
+}
+
+// order sorts the services, so each one follows the services it depends
+// on. Otherwise the services are kept in the order they were added.
+func (s *Supervisor) order(services []*supervisedService) ([]*supervisedService, error) {
+	byName := make(map[string]*supervisedService, len(services))
+
+	for _, ss := range services {
+		if _, ok := byName[ss.name]; ok {
+			return nil, fmt.Errorf("duplicate %q service", ss.name)
+		}
+
+		byName[ss.name] = ss
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(services))
+	ordered := make([]*supervisedService, 0, len(services))
+
+	var visit func(ss *supervisedService) error
+
+	visit = func(ss *supervisedService) error {
+		switch state[ss.name] {
+		case visiting:
+			return fmt.Errorf("%q service depends on itself", ss.name)
+		case visited:
+			return nil
+		}
+
+		state[ss.name] = visiting
+
+		for _, dep := range ss.deps {
+			depSS, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("%q service depends on unknown %q service", ss.name, dep)
+			}
+
+			if err := visit(depSS); err != nil {
+				return err
+			}
+		}
+
+		state[ss.name] = visited
+		ordered = append(ordered, ss)
+
+		return nil
+	}
+
+	for _, ss := range services {
+		if err := visit(ss); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// serverService runs the kite server.
+type serverService struct {
+	k            *Kite
+	drainTimeout time.Duration
+
+	err  error
+	done chan struct{} // closed when the server stopped
+}
+
+func (srv *serverService) Start() error {
+	srv.done = make(chan struct{})
+
+	go func() {
+		if err := srv.k.listenAndServe(); err != nil && !isClosing(err) {
+			srv.err = err
+		}
+
+		close(srv.done)
+	}()
+
+	select {
+	case <-srv.k.ServerReadyNotify():
+		return nil
+	case <-srv.done:
+		return srv.failure()
+	}
+}
+
+func (srv *serverService) Stop() error {
+	select {
+	case <-srv.done:
+		// failed already, reported by Supervisor.Run
+		return nil
+	default:
+	}
+
+	srv.k.drain(srv.drainTimeout, nil)
+	srv.k.Close()
+
+	<-srv.done
+
+	return srv.err
+}
+
+// failure gives the error the server stopped with, when it was not
+// stopped with Stop.
+func (srv *serverService) failure() error {
+	if srv.err != nil {
+		return srv.err
+	}
+
+	return errors.New("server stopped unexpectedly")
+}
+
+// registryService keeps the kite registered to Kontrol.
+type registryService struct {
+	k    *Kite
+	opts *RegistryOptions
+	reg  *Registration
+}
+
+func (rs *registryService) Start() error {
+	reg, err := rs.k.RegisterToRegistry(rs.opts)
+	if reg == nil {
+		return err
+	}
+
+	if err != nil {
+		rs.k.Log.Warning("registration failed, retrying: %s", err)
+	}
+
+	rs.reg = reg
+
+	return nil
+}
+
+func (rs *registryService) Stop() error {
+	return rs.reg.Close()
+}
+
+// httpService serves the handler on the address.
+type httpService struct {
+	addr    string
+	handler http.Handler
+
+	srv  *http.Server
+	done chan error
+}
+
+func (hs *httpService) Start() error {
+	l, err := net.Listen("tcp", hs.addr)
+	if err != nil {
+		return err
+	}
+
+	hs.srv = &http.Server{Handler: hs.handler}
+	hs.done = make(chan error, 1)
+
+	go func() {
+		hs.done <- hs.srv.Serve(l)
+	}()
+
+	return nil
+}
+
+func (hs *httpService) Stop() error {
+	if err := hs.srv.Close(); err != nil {
+		return err
+	}
+
+	if err := <-hs.done; err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
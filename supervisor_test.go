@@ -0,0 +1,155 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/testkeys"
+	"github.com/koding/kite/testutil"
+)
+
+type testService struct {
+	name  string
+	trace *[]string
+	fail  error
+}
+
+func (ts *testService) Start() error {
+	*ts.trace = append(*ts.trace, "start "+ts.name)
+	return ts.fail
+}
+
+func (ts *testService) Stop() error {
+	*ts.trace = append(*ts.trace, "stop "+ts.name)
+	return nil
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func TestSupervisor(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+	cfg.IP = "127.0.0.1"
+	cfg.Port = 0
+	cfg.KontrolKey = testkeys.Public
+
+	k := NewWithConfig("supervised", "0.0.1", cfg)
+
+	var trace []string
+
+	s := NewSupervisor(k)
+	s.MetricsAddr = freeAddr(t)
+	s.AdminAddr = freeAddr(t)
+	s.Add("cache", &testService{name: "cache", trace: &trace}, "db")
+	s.Add("db", &testService{name: "db", trace: &trace}, "server")
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start()=%s", err)
+	}
+
+	if k.Port() == 0 {
+		t.Fatal("expected server to listen")
+	}
+
+	resp, err := http.Get("http://" + s.AdminAddr + "/health")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %d, want %d for unauthenticated request", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, err := http.NewRequest("GET", "http://"+s.AdminAddr+"/health", nil)
+	if err != nil {
+		t.Fatalf("NewRequest()=%s", err)
+	}
+	req.Header.Set("Authorization", "kiteKey "+testutil.NewKiteKeyUsername(cfg.Username).Raw)
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do()=%s", err)
+	}
+
+	var h Health
+	err = json.NewDecoder(resp.Body).Decode(&h)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Decode()=%s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || !h.Ready {
+		t.Fatalf("got %d, %+v, want ready kite", resp.StatusCode, h)
+	}
+
+	resp, err = http.Get("http://" + s.MetricsAddr + "/debug/vars")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop()=%s", err)
+	}
+
+	want := []string{"start db", "start cache", "stop cache", "stop db"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("got %v, want %v", trace, want)
+	}
+
+	if _, err := http.Get("http://" + s.AdminAddr + "/health"); err == nil {
+		t.Fatal("expected admin API to be stopped")
+	}
+}
+
+func TestSupervisorStartError(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+	cfg.IP = "127.0.0.1"
+	cfg.Port = 0
+
+	var trace []string
+
+	s := NewSupervisor(NewWithConfig("supervised", "0.0.1", cfg))
+	s.Add("db", &testService{name: "db", trace: &trace}, "server")
+	s.Add("cache", &testService{name: "cache", trace: &trace, fail: errors.New("no memory")}, "db")
+	s.Add("api", &testService{name: "api", trace: &trace}, "cache")
+
+	err := s.Start()
+
+	supErr, ok := err.(*SupervisorError)
+	if !ok || len(supErr.Errs) != 1 || supErr.Errs[0].Service != "cache" || supErr.Errs[0].Op != "start" {
+		t.Fatalf("got %#v, want start error of cache", err)
+	}
+
+	want := []string{"start db", "start cache", "stop db"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("got %v, want %v", trace, want)
+	}
+
+	s = NewSupervisor(NewWithConfig("supervised", "0.0.1", cfg))
+	s.Add("a", &testService{name: "a", trace: &trace}, "b")
+	s.Add("b", &testService{name: "b", trace: &trace}, "a")
+
+	if err := s.Start(); err == nil {
+		t.Fatal("expected dependency cycle to fail")
+	}
+}
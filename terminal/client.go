@@ -0,0 +1,250 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// ErrClosed is returned when writing to a session after the shell
+// has exited.
+var ErrClosed = errors.New("terminal session is closed")
+
+// Options configures a new terminal session.
+type Options struct {
+	// Cols and Rows are the initial window size of the terminal.
+	//
+	// If zero, the default size of the terminal is used.
+	Cols, Rows int
+}
+
+// Session is a terminal running on a remote kite. It implements
+// io.ReadWriteCloser: reads give the terminal output, writes are
+// the terminal input.
+type Session struct {
+	// ID identifies the session on the remote kite.
+	ID string
+
+	mu       sync.Mutex
+	cond     *sync.Cond   // signals received output and exit
+	c        *kite.Client // connection the session is attached over
+	window   int64        // window of the remote kite
+	buf      []byte       // output not read yet
+	offset   int64        // number of output bytes received
+	consumed int64        // number of output bytes read
+	acked    int64        // offset acknowledged to the remote kite
+	exit     *Exit        // set once the shell exited
+	seq      int64        // sequence number of the next input
+}
+
+// Open starts a new terminal session on the remote kite the client is
+// connected to.
+func Open(c *kite.Client, opts *Options) (*Session, error) {
+	s := &Session{}
+	s.cond = sync.NewCond(&s.mu)
+
+	args := &connectArgs{}
+	if opts != nil {
+		args.Cols = opts.Cols
+		args.Rows = opts.Rows
+	}
+
+	if err := s.connect(c, args); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Attach attaches the session to the client, e.g. after the previous
+// connection was lost. The output is resumed from where it stopped,
+// as long as it is still kept by the remote kite.
+func (s *Session) Attach(c *kite.Client) error {
+	s.mu.Lock()
+	args := &connectArgs{
+		Session: s.ID,
+		Offset:  s.offset,
+	}
+	s.mu.Unlock()
+
+	return s.connect(c, args)
+}
+
+func (s *Session) connect(c *kite.Client, args *connectArgs) error {
+	args.Output = dnode.Callback(func(p *dnode.Partial) {
+		var out Output
+		if err := p.One().Unmarshal(&out); err != nil {
+			c.LocalKite.Log.Warning("terminal: invalid output: %s", err)
+			return
+		}
+
+		s.receive(&out)
+	})
+
+	args.Exit = dnode.Callback(func(p *dnode.Partial) {
+		var exit Exit
+		if err := p.One().Unmarshal(&exit); err != nil {
+			c.LocalKite.Log.Warning("terminal: invalid exit: %s", err)
+			return
+		}
+
+		s.mu.Lock()
+		s.exit = &exit
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+
+	res, err := c.Tell("terminal.connect", args)
+	if err != nil {
+		return err
+	}
+
+	var r connectResult
+	if err := res.Unmarshal(&r); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.ID = r.Session
+	s.c = c
+	s.window = int64(r.Window)
+	s.acked = s.offset
+	s.mu.Unlock()
+
+	return nil
+}
+
+// receive buffers the output, skipping parts received already.
+func (s *Session) receive(out *Output) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := out.Offset + int64(len(out.Data))
+	if end <= s.offset {
+		return // replayed
+	}
+
+	data := out.Data
+	if out.Offset < s.offset {
+		data = data[s.offset-out.Offset:]
+	}
+
+	// A gap means the output was dropped from the scrollback
+	// while the session was detached.
+	s.buf = append(s.buf, data...)
+	s.offset = end
+
+	s.cond.Broadcast()
+}
+
+// Read reads the terminal output. It returns io.EOF once the shell
+// exited and all of its output was read.
+func (s *Session) Read(p []byte) (int, error) {
+	s.mu.Lock()
+
+	for len(s.buf) == 0 && s.exit == nil {
+		s.cond.Wait()
+	}
+
+	if len(s.buf) == 0 {
+		s.mu.Unlock()
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	s.consumed += int64(n)
+
+	// Acknowledge the output once half of the window is read.
+	var ack *ackArgs
+	if s.window > 0 && (s.consumed-s.acked)*2 >= s.window {
+		s.acked = s.consumed
+		ack = &ackArgs{Session: s.ID, Offset: s.consumed}
+	}
+
+	c := s.c
+	s.mu.Unlock()
+
+	if ack != nil {
+		go func() {
+			if _, err := c.Tell("terminal.ack", ack); err != nil {
+				c.LocalKite.Log.Debug("terminal: unable to acknowledge output: %s", err)
+			}
+		}()
+	}
+
+	return n, nil
+}
+
+// Write writes the input to the terminal. Concurrent writes are applied
+// in the order they were called.
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if s.exit != nil {
+		s.mu.Unlock()
+		return 0, ErrClosed
+	}
+
+	args := &inputArgs{
+		Session: s.ID,
+		Seq:     s.seq,
+		Data:    p,
+	}
+	s.seq++
+
+	c := s.c
+	s.mu.Unlock()
+
+	if _, err := c.Tell("terminal.input", args); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Resize changes the window size of the terminal.
+func (s *Session) Resize(cols, rows int) error {
+	_, err := s.client().Tell("terminal.resize", &resizeArgs{
+		Session: s.ID,
+		Cols:    cols,
+		Rows:    rows,
+	})
+
+	return err
+}
+
+// Close terminates the shell.
+func (s *Session) Close() error {
+	_, err := s.client().Tell("terminal.close", &closeArgs{
+		Session: s.ID,
+	})
+
+	return err
+}
+
+// Wait waits for the shell to exit and gives its exit code.
+func (s *Session) Wait() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.exit == nil {
+		s.cond.Wait()
+	}
+
+	if s.exit.Error != "" {
+		return s.exit.Code, fmt.Errorf("terminal: %s", s.exit.Error)
+	}
+
+	return s.exit.Code, nil
+}
+
+func (s *Session) client() *kite.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.c
+}
@@ -0,0 +1,27 @@
+// +build !linux
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errUnsupported = errors.New("terminal: pseudo-terminals are not supported on this platform")
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errUnsupported
+}
+
+func setSize(f *os.File, cols, rows int) error {
+	return errUnsupported
+}
+
+func start(cmd *exec.Cmd, slave *os.File) error {
+	return errUnsupported
+}
+
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
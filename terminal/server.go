@@ -0,0 +1,482 @@
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// Server serves terminal sessions with a kite. It serves the following
+// methods:
+//
+//	terminal.connect - starts a new session or attaches to an existing one
+//	terminal.input   - writes to the terminal
+//	terminal.ack     - acknowledges received output
+//	terminal.resize  - changes the window size
+//	terminal.close   - terminates the session
+type Server struct {
+	// Shell is the command run for each session.
+	//
+	// If empty, the SHELL environment variable is used, or /bin/sh
+	// if it is not set.
+	Shell string
+
+	// Window is the number of output bytes sent to the client, which
+	// were not acknowledged yet, above which reading the output of
+	// the shell is paused.
+	//
+	// If zero, DefaultWindow is used.
+	Window int
+
+	// Scrollback is the number of the most recent output bytes kept
+	// for replaying to a reattached client.
+	//
+	// If zero, DefaultScrollback is used.
+	Scrollback int
+
+	// DetachTimeout is the time a session is kept after its client
+	// disconnects, waiting to be attached again.
+	//
+	// If zero, DefaultDetachTimeout is used.
+	DetachTimeout time.Duration
+
+	k        *kite.Kite
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	id    string
+	owner string
+	srv   *Server
+	cmd   *exec.Cmd
+	pty   *os.File
+
+	mu       sync.Mutex
+	cond     *sync.Cond     // signals acknowledgements, attaching and closing
+	client   *kite.Client   // attached client, nil when detached
+	output   dnode.Function // output callback of the attached client
+	exit     dnode.Function // exit callback of the attached client
+	buf      []byte         // scrollback, it ends at offset
+	offset   int64          // number of bytes read from the terminal
+	acked    int64          // offset acknowledged by the attached client
+	detached *time.Timer    // closes a detached session
+	closed   bool
+
+	inputMu sync.Mutex       // protects input state, serializes writes
+	nextSeq int64            // sequence number of the next input to write
+	pending map[int64][]byte // input received out of order
+}
+
+// NewServer gives new server serving terminals with the given kite.
+func NewServer(k *kite.Kite) *Server {
+	s := &Server{
+		k:        k,
+		sessions: make(map[string]*session),
+	}
+
+	k.HandleFunc("terminal.connect", s.handleConnect)
+	k.HandleFunc("terminal.input", s.handleInput)
+	k.HandleFunc("terminal.ack", s.handleAck)
+	k.HandleFunc("terminal.resize", s.handleResize)
+	k.HandleFunc("terminal.close", s.handleClose)
+
+	return s
+}
+
+func (s *Server) handleConnect(r *kite.Request) (interface{}, error) {
+	var args connectArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if !args.Output.IsValid() {
+		return nil, errors.New("output callback is missing")
+	}
+
+	var (
+		sess *session
+		err  error
+	)
+
+	if args.Session != "" {
+		sess, err = s.session(r, args.Session)
+	} else {
+		sess, err = s.spawn(r.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Cols > 0 && args.Rows > 0 {
+		if err := setSize(sess.pty, args.Cols, args.Rows); err != nil {
+			s.k.Log.Warning("terminal: unable to resize session %s: %s", sess.id, err)
+		}
+	}
+
+	c := r.Client
+	c.OnDisconnect(func() {
+		sess.detach(c)
+	})
+
+	sess.attach(c, &args)
+
+	return &connectResult{
+		Session: sess.id,
+		Window:  s.window(),
+	}, nil
+}
+
+func (s *Server) handleInput(r *kite.Request) (interface{}, error) {
+	var args inputArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.session(r, args.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, sess.input(args.Seq, args.Data)
+}
+
+func (s *Server) handleAck(r *kite.Request) (interface{}, error) {
+	var args ackArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.session(r, args.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mu.Lock()
+	if args.Offset > sess.acked && args.Offset <= sess.offset {
+		sess.acked = args.Offset
+		sess.cond.Broadcast()
+	}
+	sess.mu.Unlock()
+
+	return nil, nil
+}
+
+func (s *Server) handleResize(r *kite.Request) (interface{}, error) {
+	var args resizeArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.session(r, args.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, setSize(sess.pty, args.Cols, args.Rows)
+}
+
+func (s *Server) handleClose(r *kite.Request) (interface{}, error) {
+	var args closeArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.session(r, args.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.close()
+
+	return nil, nil
+}
+
+// session gives the session with the given ID owned by the caller.
+func (s *Server) session(r *kite.Request, id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.owner != r.Username {
+		return nil, ErrSessionNotFound
+	}
+
+	return sess, nil
+}
+
+// spawn starts a shell on a new pseudo-terminal.
+func (s *Server) spawn(owner string) (*session, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(s.shell())
+	cmd.Env = append(os.Environ(), "TERM=xterm")
+
+	err = start(cmd, slave)
+	slave.Close() // the child holds its own copy
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	sess := &session{
+		id:      utils.RandomString(16),
+		owner:   owner,
+		srv:     s,
+		cmd:     cmd,
+		pty:     master,
+		pending: make(map[int64][]byte),
+	}
+	sess.cond = sync.NewCond(&sess.mu)
+
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	go sess.pump()
+
+	return sess, nil
+}
+
+func (s *Server) remove(sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+}
+
+func (s *Server) shell() string {
+	if s.Shell != "" {
+		return s.Shell
+	}
+
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+
+	return "/bin/sh"
+}
+
+func (s *Server) window() int {
+	if s.Window != 0 {
+		return s.Window
+	}
+
+	return DefaultWindow
+}
+
+func (s *Server) scrollback() int {
+	if s.Scrollback != 0 {
+		return s.Scrollback
+	}
+
+	return DefaultScrollback
+}
+
+func (s *Server) detachTimeout() time.Duration {
+	if s.DetachTimeout != 0 {
+		return s.DetachTimeout
+	}
+
+	return DefaultDetachTimeout
+}
+
+// attach makes the client receive the output of the session, starting
+// with the scrollback following the given offset. A client attached
+// before is detached.
+func (sess *session) attach(c *kite.Client, args *connectArgs) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.detached != nil {
+		sess.detached.Stop()
+		sess.detached = nil
+	}
+
+	sess.client = c
+	sess.output = args.Output
+	sess.exit = args.Exit
+
+	from := args.Offset
+	if start := sess.offset - int64(len(sess.buf)); from < start {
+		from = start
+	}
+	if from > sess.offset {
+		from = sess.offset
+	}
+
+	sess.acked = from
+
+	if from < sess.offset {
+		sess.send(from, sess.buf[len(sess.buf)-int(sess.offset-from):])
+	}
+
+	sess.cond.Broadcast()
+}
+
+// detach stops sending the output to the disconnected client. The
+// session is closed unless it is attached again before DetachTimeout.
+func (sess *session) detach(c *kite.Client) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.client != c || sess.closed {
+		return
+	}
+
+	sess.client = nil
+	sess.output = dnode.Function{}
+	sess.exit = dnode.Function{}
+	sess.detached = time.AfterFunc(sess.srv.detachTimeout(), sess.close)
+	sess.cond.Broadcast()
+}
+
+// pump reads the terminal output and sends it to the attached client.
+func (sess *session) pump() {
+	window := int64(sess.srv.window())
+	p := make([]byte, 32*1024)
+
+	for {
+		sess.mu.Lock()
+		for sess.client != nil && !sess.closed && sess.offset-sess.acked >= window {
+			sess.cond.Wait()
+		}
+		sess.mu.Unlock()
+
+		n, err := sess.pty.Read(p)
+		if n > 0 {
+			sess.mu.Lock()
+			sess.record(p[:n])
+			if sess.client != nil {
+				sess.send(sess.offset-int64(n), p[:n])
+			}
+			sess.mu.Unlock()
+		}
+
+		if err != nil {
+			break // EIO once the shell exits
+		}
+	}
+
+	sess.end()
+}
+
+// record appends the output to the scrollback. It is called with
+// sess.mu held.
+func (sess *session) record(p []byte) {
+	sess.buf = append(sess.buf, p...)
+	sess.offset += int64(len(p))
+
+	if max := sess.srv.scrollback(); len(sess.buf) > max {
+		sess.buf = append([]byte(nil), sess.buf[len(sess.buf)-max:]...)
+	}
+}
+
+// send sends the output to the attached client. It is called with
+// sess.mu held, so the output is sent in order.
+func (sess *session) send(offset int64, p []byte) {
+	out := &Output{
+		Offset: offset,
+		Data:   p,
+	}
+
+	if err := sess.output.Call(out); err != nil {
+		sess.srv.k.Log.Debug("terminal: unable to send output of session %s: %s", sess.id, err)
+	}
+}
+
+// input writes the input to the terminal in the order of sequence
+// numbers, buffering the input received out of order.
+func (sess *session) input(seq int64, p []byte) error {
+	sess.inputMu.Lock()
+	defer sess.inputMu.Unlock()
+
+	if seq < sess.nextSeq {
+		return nil // duplicate
+	}
+
+	sess.pending[seq] = p
+
+	for {
+		p, ok := sess.pending[sess.nextSeq]
+		if !ok {
+			return nil
+		}
+
+		delete(sess.pending, sess.nextSeq)
+		sess.nextSeq++
+
+		if _, err := sess.pty.Write(p); err != nil {
+			return err
+		}
+	}
+}
+
+// close terminates the shell. The session ends once its output is read.
+func (sess *session) close() {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return
+	}
+	sess.closed = true
+	sess.cond.Broadcast()
+	sess.mu.Unlock()
+
+	if err := kill(sess.cmd); err != nil {
+		sess.srv.k.Log.Debug("terminal: unable to kill session %s: %s", sess.id, err)
+	}
+}
+
+// end reports the exit of the shell to the attached client and removes
+// the session.
+func (sess *session) end() {
+	err := sess.cmd.Wait()
+	sess.pty.Close()
+	sess.srv.remove(sess)
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	sess.closed = true
+
+	if sess.detached != nil {
+		sess.detached.Stop()
+	}
+
+	if !sess.exit.IsValid() {
+		return
+	}
+
+	exit := &Exit{}
+
+	if err != nil {
+		exit.Code = -1
+		exit.Error = err.Error()
+
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.Exited() {
+				exit.Code = status.ExitStatus()
+				exit.Error = ""
+			}
+		}
+	}
+
+	if err := sess.exit.Call(exit); err != nil {
+		sess.srv.k.Log.Debug("terminal: unable to send exit of session %s: %s", sess.id, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package terminal implements remote terminals over kite RPC.
+//
+// A kite serving terminals spawns a shell on a pseudo-terminal for each
+// session and streams its output to the client. The stream is flow
+// controlled, so a slow client pauses the shell instead of growing
+// buffers without bounds. Input is applied in the order it was written,
+// even if calls are handled concurrently. A session survives the client
+// disconnecting for a while, and can be attached to again with the output
+// resumed from where the client stopped.
+//
+// Server:
+//
+//	k := kite.New("terminal", "1.0.0")
+//	terminal.NewServer(k)
+//	k.Run()
+//
+// Client:
+//
+//	s, err := terminal.Open(c, &terminal.Options{Cols: 80, Rows: 24})
+//	if err != nil {
+//	    return err
+//	}
+//	defer s.Close()
+//
+//	go io.Copy(s, os.Stdin)
+//	io.Copy(os.Stdout, s)
+//
+// Pseudo-terminals are supported on Linux only.
+package terminal
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var (
+	// DefaultWindow is the number of output bytes sent to the client,
+	// which were not acknowledged yet, above which reading the output of
+	// the shell is paused, if Server.Window is zero.
+	DefaultWindow = 64 * 1024
+
+	// DefaultScrollback is the number of the most recent output bytes
+	// kept for replaying to a reattached client, if Server.Scrollback
+	// is zero.
+	DefaultScrollback = 64 * 1024
+
+	// DefaultDetachTimeout is the time a session is kept after its
+	// client disconnects, if Server.DetachTimeout is zero.
+	DefaultDetachTimeout = time.Minute
+)
+
+// ErrSessionNotFound is returned for calls to a session, which does not
+// exist or belongs to other user.
+var ErrSessionNotFound = errors.New("terminal session not found")
+
+// Output is a chunk of the terminal output.
+type Output struct {
+	// Offset is the position of the chunk in the session output.
+	Offset int64 `json:"offset"`
+
+	// Data is the raw output.
+	Data []byte `json:"data"`
+}
+
+// Exit describes the end of a session.
+type Exit struct {
+	// Code is the exit code of the shell.
+	Code int `json:"code"`
+
+	// Error is set when the shell was terminated by a signal or
+	// the session was closed.
+	Error string `json:"error,omitempty"`
+}
+
+type connectArgs struct {
+	Session string         `json:"session,omitempty"`
+	Offset  int64          `json:"offset,omitempty"`
+	Cols    int            `json:"cols,omitempty"`
+	Rows    int            `json:"rows,omitempty"`
+	Output  dnode.Function `json:"output"`
+	Exit    dnode.Function `json:"exit"`
+}
+
+type connectResult struct {
+	Session string `json:"session"`
+	Window  int    `json:"window"`
+}
+
+type inputArgs struct {
+	Session string `json:"session"`
+	Seq     int64  `json:"seq"`
+	Data    []byte `json:"data"`
+}
+
+type ackArgs struct {
+	Session string `json:"session"`
+	Offset  int64  `json:"offset"`
+}
+
+type resizeArgs struct {
+	Session string `json:"session"`
+	Cols    int    `json:"cols"`
+	Rows    int    `json:"rows"`
+}
+
+type closeArgs struct {
+	Session string `json:"session"`
+}
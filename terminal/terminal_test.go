@@ -0,0 +1,124 @@
+// +build linux
+
+package terminal_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/terminal"
+)
+
+func dial(t *testing.T, url string) *kite.Client {
+	c := kite.New("terminal-client", "0.0.1").NewClient(url + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	return c
+}
+
+// expect reads the output until it contains the given string.
+func expect(t *testing.T, r io.Reader, s string) {
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+
+	go func() {
+		p := make([]byte, 1024)
+		for !strings.Contains(buf.String(), s) {
+			n, err := r.Read(p)
+			buf.Write(p[:n])
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("got %q and %s, want %q", buf.String(), err, s)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %q", s)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	k := kite.New("terminal", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv := terminal.NewServer(k)
+	srv.Shell = "/bin/sh"
+	srv.Window = 4096
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := dial(t, ts.URL)
+
+	s, err := terminal.Open(c, &terminal.Options{Cols: 100, Rows: 30})
+	if err != nil {
+		t.Fatalf("Open()=%s", err)
+	}
+
+	// The echoed input does not contain the results.
+	fmt.Fprintf(s, "echo $((40+2))\n")
+	expect(t, s, "42")
+
+	fmt.Fprintf(s, "stty size\n")
+	expect(t, s, "30 100")
+
+	if err := s.Resize(120, 40); err != nil {
+		t.Fatalf("Resize()=%s", err)
+	}
+
+	fmt.Fprintf(s, "stty size\n")
+	expect(t, s, "40 120")
+
+	// Output larger than the window is paused until it is read.
+	fmt.Fprintf(s, "yes | head -n 20000; echo $((1000+234))\n")
+	expect(t, s, "1234")
+
+	// Input is applied in order, regardless of concurrent handling.
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(s, "%d", i)
+	}
+	fmt.Fprintf(s, "\n")
+	expect(t, s, "0123456789")
+
+	// Output produced while detached is replayed after reattaching.
+	fmt.Fprintf(s, "sleep 1; echo $((100+23))\n")
+	c.Close()
+
+	c = dial(t, ts.URL)
+	defer c.Close()
+
+	if err := s.Attach(c); err != nil {
+		t.Fatalf("Attach()=%s", err)
+	}
+
+	expect(t, s, "123")
+
+	fmt.Fprintf(s, "exit 3\n")
+
+	code, err := s.Wait()
+	if err != nil {
+		t.Fatalf("Wait()=%s", err)
+	}
+
+	if code != 3 {
+		t.Fatalf("got exit code %d, want 3", code)
+	}
+
+	if _, err := s.Write([]byte("echo\n")); err != terminal.ErrClosed {
+		t.Fatalf("got %v, want %v", err, terminal.ErrClosed)
+	}
+}
@@ -0,0 +1,147 @@
+package kite
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/kitekey"
+)
+
+// DefaultMaxClockSkew is the clock difference to a remote kite, above
+// which a warning is logged, if Kite.MaxClockSkew is zero.
+var DefaultMaxClockSkew = 30 * time.Second
+
+// ClockSkew describes the clock difference between the local
+// and a remote kite.
+type ClockSkew struct {
+	// Offset is the time to add to the local clock to get the time of
+	// the remote kite. It is positive when the remote clock is ahead.
+	Offset time.Duration
+
+	// RTT is the round-trip time of the measurement. The offset is
+	// accurate to within half of it.
+	RTT time.Duration
+
+	// Time is the local time of the measurement.
+	Time time.Time
+}
+
+// SyncTime measures the clock difference to the remote kite with
+// a kite.time call. A warning is logged when the difference exceeds
+// Kite.MaxClockSkew.
+//
+// The measured skew is used to tolerate clock differences in expiry of
+// calls made by the remote kite and in times of their signatures, see
+// Kite.MaxSignatureAge; the skew of the kite's Kontrol connection when
+// validating and renewing tokens. A difference exceeding Kite.MaxClockSkew
+// is more likely a broken clock or a forged reply than a skew to tolerate,
+// so it is not used.
+func (c *Client) SyncTime() (*ClockSkew, error) {
+	start := time.Now()
+
+	result, err := c.TellWithTimeout("kite.time", c.callTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+
+	var remote time.Time
+	if err := result.Unmarshal(&remote); err != nil {
+		return nil, err
+	}
+
+	rtt := end.Sub(start)
+
+	skew := &ClockSkew{
+		// Assume the remote kite read its clock halfway through the call.
+		Offset: remote.Sub(start.Add(rtt / 2)),
+		RTT:    rtt,
+		Time:   end,
+	}
+
+	c.skewMu.Lock()
+	c.skew = skew
+	c.skewMu.Unlock()
+
+	if abs(skew.Offset) > c.LocalKite.maxClockSkew() {
+		c.logger().Warning("clock of %s differs by %s (rtt %s), not tolerating it", c.URL, skew.Offset, skew.RTT)
+	}
+
+	return skew, nil
+}
+
+// ClockSkew gives the clock difference measured by the last successful
+// SyncTime call. It is nil if the difference was not measured.
+func (c *Client) ClockSkew() *ClockSkew {
+	c.skewMu.Lock()
+	defer c.skewMu.Unlock()
+
+	return c.skew
+}
+
+// clockOffset gives the offset of the clock of the remote kite, as
+// measured by SyncTime. It is zero if the offset was not measured or
+// exceeds Kite.MaxClockSkew.
+func (c *Client) clockOffset() time.Duration {
+	skew := c.ClockSkew()
+	if skew == nil || abs(skew.Offset) > c.LocalKite.maxClockSkew() {
+		return 0
+	}
+
+	return skew.Offset
+}
+
+// handleTime gives the current time of the kite.
+func handleTime(r *Request) (interface{}, error) {
+	return time.Now().UTC(), nil
+}
+
+func (k *Kite) maxClockSkew() time.Duration {
+	if k.MaxClockSkew != 0 {
+		return k.MaxClockSkew
+	}
+
+	return DefaultMaxClockSkew
+}
+
+// kontrolOffset gives the clock offset to Kontrol, which issues tokens.
+// It is zero if the offset was not measured or exceeds MaxClockSkew.
+func (k *Kite) kontrolOffset() time.Duration {
+	k.kontrol.Lock()
+	c := k.kontrol.Client
+	k.kontrol.Unlock()
+
+	if c == nil {
+		return 0
+	}
+
+	return c.clockOffset()
+}
+
+// timeErrors are token validation errors, which may be caused by
+// clock skew between the kite and the token issuer.
+const timeErrors = jwt.ValidationErrorExpired | jwt.ValidationErrorNotValidYet | jwt.ValidationErrorIssuedAt
+
+// validAtKontrolTime tells whether time claims of the token are valid
+// at the current time of Kontrol, which issued it.
+func (k *Kite) validAtKontrolTime(claims *kitekey.KiteClaims) bool {
+	offset := k.kontrolOffset()
+	if offset == 0 {
+		return false
+	}
+
+	now := time.Now().Add(offset).Unix()
+
+	return claims.VerifyExpiresAt(now, false) &&
+		claims.VerifyNotBefore(now, false) &&
+		claims.VerifyIssuedAt(now, false)
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
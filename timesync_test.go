@@ -0,0 +1,84 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
+)
+
+func TestSyncTime(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("time-server", "0.0.1", cfg)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("time-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if skew := c.ClockSkew(); skew != nil {
+		t.Fatalf("got %+v before measurement, want nil", skew)
+	}
+
+	skew, err := c.SyncTime()
+	if err != nil {
+		t.Fatalf("SyncTime()=%s", err)
+	}
+
+	if skew.RTT <= 0 {
+		t.Fatalf("got RTT %s, want positive", skew.RTT)
+	}
+
+	// Both kites share the clock.
+	if abs(skew.Offset) > skew.RTT/2+time.Millisecond {
+		t.Fatalf("got offset %s, want within %s", skew.Offset, skew.RTT/2)
+	}
+
+	if got := c.ClockSkew(); got != skew {
+		t.Fatalf("got %+v, want %+v", got, skew)
+	}
+}
+
+func TestValidAtKontrolTime(t *testing.T) {
+	k := New("time", "0.0.1")
+	k.MaxClockSkew = 5 * time.Minute
+
+	claims := &kitekey.KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+		},
+	}
+
+	if k.validAtKontrolTime(claims) {
+		t.Fatal("want expired token to be invalid without measured skew")
+	}
+
+	k.kontrol.Client = k.NewClient("http://127.0.0.1:1/kite")
+	k.kontrol.Client.skew = &ClockSkew{Offset: -2 * time.Minute}
+
+	if !k.validAtKontrolTime(claims) {
+		t.Fatal("want token to be valid at the time of Kontrol")
+	}
+
+	k.kontrol.Client.skew.Offset = 2 * time.Minute
+
+	if k.validAtKontrolTime(claims) {
+		t.Fatal("want token to be expired at the time of Kontrol")
+	}
+
+	k.kontrol.Client.skew.Offset = -10 * time.Minute
+
+	if k.validAtKontrolTime(claims) {
+		t.Fatal("want offset exceeding MaxClockSkew not to be applied")
+	}
+}
@@ -109,7 +109,10 @@ func (t *TokenRenewer) renewLoop() {
 // The duration from now to the time token needs to be renewed.
 // Needs to be calculated after renewing the token.
 func (t *TokenRenewer) renewDuration() time.Duration {
-	return t.validUntil.Add(-renewBefore).Sub(time.Now().UTC())
+	// The token expires at Kontrol time.
+	now := time.Now().UTC().Add(t.localKite.kontrolOffset())
+
+	return t.validUntil.Add(-renewBefore).Sub(now)
 }
 
 func (t *TokenRenewer) startRenewLoop() {
@@ -0,0 +1,340 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Dialer opens tunnels through the remote kite a client is connected to.
+// All tunnels of the dialer fail once the client disconnects.
+type Dialer struct {
+	c *kite.Client
+
+	mu    sync.Mutex
+	conns map[*Conn]struct{}
+}
+
+// NewDialer gives new dialer for the given client.
+func NewDialer(c *kite.Client) *Dialer {
+	d := &Dialer{
+		c:     c,
+		conns: make(map[*Conn]struct{}),
+	}
+
+	c.OnDisconnect(d.disconnect)
+
+	return d
+}
+
+// Dial opens a tunnel to the target "host:port" address, which is dialed
+// by the remote kite.
+func (d *Dialer) Dial(target string) (*Conn, error) {
+	conn := &Conn{
+		d:      d,
+		target: target,
+	}
+	conn.cond = sync.NewCond(&conn.mu)
+
+	args := &openArgs{
+		Target: target,
+		Data:   dnode.Callback(conn.onData),
+		Close:  dnode.Callback(conn.onClose),
+	}
+
+	res, err := d.c.Tell("tunnel.open", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var r openResult
+	if err := res.Unmarshal(&r); err != nil {
+		return nil, err
+	}
+
+	conn.mu.Lock()
+	conn.id = r.ID
+	conn.window = int64(r.Window)
+	conn.mu.Unlock()
+
+	d.mu.Lock()
+	d.conns[conn] = struct{}{}
+	d.mu.Unlock()
+
+	return conn, nil
+}
+
+// Forward listens on the local address and forwards each accepted
+// connection to the target "host:port" address, which is dialed by
+// the remote kite.
+func (d *Dialer) Forward(local, target string) (*Forwarder, error) {
+	l, err := net.Listen("tcp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Forwarder{
+		d:      d,
+		l:      l,
+		target: target,
+	}
+
+	go f.serve()
+
+	return f, nil
+}
+
+func (d *Dialer) disconnect() {
+	d.mu.Lock()
+	conns := d.conns
+	d.conns = make(map[*Conn]struct{})
+	d.mu.Unlock()
+
+	for conn := range conns {
+		conn.fail(errors.New("tunnel: kite disconnected"))
+	}
+}
+
+func (d *Dialer) remove(conn *Conn) {
+	d.mu.Lock()
+	delete(d.conns, conn)
+	d.mu.Unlock()
+}
+
+// Conn is a tunnel to a target connection of the remote kite.
+type Conn struct {
+	d      *Dialer
+	target string
+
+	mu       sync.Mutex
+	cond     *sync.Cond // signals received data and closing
+	id       string
+	window   int64
+	buf      []byte // received data, which was not read yet
+	consumed int64  // bytes read
+	acked    int64  // bytes acknowledged to the remote kite
+	err      error  // returned by Read once buf is drained
+	closed   bool
+
+	writeMu sync.Mutex // serializes writes
+	seq     int64      // sequence number of the next write
+}
+
+// Read reads data received from the target connection. It returns
+// io.EOF once the target has nothing more to send.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	for len(c.buf) == 0 && c.err == nil && !c.closed {
+		c.cond.Wait()
+	}
+
+	if c.closed {
+		c.mu.Unlock()
+		return 0, ErrClosed
+	}
+
+	if len(c.buf) == 0 {
+		err := c.err
+		c.mu.Unlock()
+		return 0, err
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	c.consumed += int64(n)
+
+	var ack int64
+	if c.consumed-c.acked >= c.window/2 {
+		ack = c.consumed
+		c.acked = c.consumed
+	}
+	c.mu.Unlock()
+
+	if ack != 0 {
+		if _, err := c.d.c.Tell("tunnel.ack", &ackArgs{ID: c.id, Bytes: ack}); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Write writes data to the target connection. It returns once the data
+// was written by the remote kite.
+func (c *Conn) Write(p []byte) (int, error) {
+	var n int
+
+	for len(p) != 0 {
+		chunk := p
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+
+		if err := c.write(&writeArgs{Data: chunk}); err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return n, nil
+}
+
+// CloseWrite closes the writing side of the target connection.
+func (c *Conn) CloseWrite() error {
+	return c.write(&writeArgs{Close: true})
+}
+
+// Close closes the tunnel and the target connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.d.remove(c)
+
+	_, err := c.d.c.Tell("tunnel.close", &closeArgs{ID: c.id})
+	return err
+}
+
+// Target gives the address of the target connection.
+func (c *Conn) Target() string {
+	return c.target
+}
+
+func (c *Conn) write(args *writeArgs) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	args.ID = c.id
+	args.Seq = c.seq
+	c.seq++
+
+	_, err := c.d.c.Tell("tunnel.write", args)
+	return err
+}
+
+func (c *Conn) onData(p *dnode.Partial) {
+	var data []byte
+	if err := p.One().Unmarshal(&data); err != nil {
+		c.d.c.LocalKite.Log.Warning("tunnel: invalid data: %s", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.buf = append(c.buf, data...)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *Conn) onClose(p *dnode.Partial) {
+	var event closeEvent
+	if err := p.One().Unmarshal(&event); err != nil {
+		event.Error = err.Error()
+	}
+
+	err := io.EOF
+	if event.Error != "" {
+		err = errors.New(event.Error)
+	}
+
+	c.fail(err)
+}
+
+// fail makes Read return the error once received data is drained.
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// Forwarder forwards connections accepted on a local address through
+// tunnels.
+type Forwarder struct {
+	d      *Dialer
+	l      net.Listener
+	target string
+}
+
+// Addr gives the local address the forwarder listens on.
+func (f *Forwarder) Addr() net.Addr {
+	return f.l.Addr()
+}
+
+// Close stops accepting new connections. Connections which were already
+// accepted are not closed.
+func (f *Forwarder) Close() error {
+	return f.l.Close()
+}
+
+func (f *Forwarder) serve() {
+	for {
+		local, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+
+		go f.forward(local)
+	}
+}
+
+// forward copies data between the local connection and a tunnel, until
+// both sides are done writing.
+func (f *Forwarder) forward(local net.Conn) {
+	defer local.Close()
+
+	log := f.d.c.LocalKite.Log
+
+	remote, err := f.d.Dial(f.target)
+	if err != nil {
+		log.Warning("tunnel: unable to forward %s to %s: %s", local.RemoteAddr(), f.target, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if _, err := io.Copy(remote, local); err != nil {
+			log.Debug("tunnel: unable to write to %s: %s", f.target, err)
+			remote.Close()
+			return
+		}
+
+		if err := remote.CloseWrite(); err != nil {
+			log.Debug("tunnel: unable to close %s for writing: %s", f.target, err)
+		}
+	}()
+
+	if _, err := io.Copy(local, remote); err != nil {
+		log.Debug("tunnel: unable to read from %s: %s", f.target, err)
+		local.Close()
+	} else if cw, ok := local.(closeWriter); ok {
+		cw.CloseWrite()
+	}
+
+	<-done
+}
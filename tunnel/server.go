@@ -0,0 +1,333 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+)
+
+// Server dials target connections for remote kites. It serves the
+// following methods of the kite:
+//
+//	tunnel.open  - dials the target, streaming its data to a callback
+//	tunnel.write - writes to the target connection, or closes its writing side
+//	tunnel.ack   - acknowledges received data
+//	tunnel.close - closes the tunnel and the target connection
+type Server struct {
+	// Targets is the allowlist of "host:port" addresses, which may be
+	// dialed. Entries may contain patterns of path.Match, for example
+	// "10.0.0.*:22".
+	//
+	// If empty, no target may be dialed.
+	Targets []string
+
+	// Window is the number of bytes sent to the remote kite, which were
+	// not acknowledged yet, above which reading from the target
+	// connection is paused.
+	//
+	// If zero, DefaultWindow is used.
+	Window int
+
+	// DialTimeout is the time to wait for the target connection.
+	//
+	// If zero, DefaultDialTimeout is used.
+	DialTimeout time.Duration
+
+	k       *kite.Kite
+	mu      sync.Mutex
+	tunnels map[string]*tunnel
+}
+
+type tunnel struct {
+	id    string
+	owner string
+	conn  net.Conn
+	srv   *Server
+
+	mu     sync.Mutex
+	cond   *sync.Cond // signals acknowledgements and closing
+	sent   int64      // bytes sent to the remote kite
+	acked  int64      // bytes acknowledged by the remote kite
+	closed bool
+
+	inputMu sync.Mutex           // serializes writes to the target
+	nextSeq int64                // sequence number of the next write
+	pending map[int64]*writeArgs // writes received out of order
+}
+
+// NewServer gives new server dialing targets with the given kite.
+func NewServer(k *kite.Kite) *Server {
+	s := &Server{
+		k:       k,
+		tunnels: make(map[string]*tunnel),
+	}
+
+	k.HandleFunc("tunnel.open", s.handleOpen)
+	k.HandleFunc("tunnel.write", s.handleWrite)
+	k.HandleFunc("tunnel.ack", s.handleAck)
+	k.HandleFunc("tunnel.close", s.handleClose)
+
+	return s
+}
+
+func (s *Server) handleOpen(r *kite.Request) (interface{}, error) {
+	var args openArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if !s.allowed(args.Target) {
+		return nil, ErrNotAllowed
+	}
+
+	conn, err := net.DialTimeout("tcp", args.Target, s.dialTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tunnel{
+		id:      utils.RandomString(16),
+		owner:   r.Username,
+		conn:    conn,
+		srv:     s,
+		pending: make(map[int64]*writeArgs),
+	}
+	t.cond = sync.NewCond(&t.mu)
+
+	s.mu.Lock()
+	s.tunnels[t.id] = t
+	s.mu.Unlock()
+
+	r.Client.OnDisconnect(t.close)
+
+	go t.pump(args.Data, args.Close)
+
+	return &openResult{
+		ID:     t.id,
+		Window: s.window(),
+	}, nil
+}
+
+func (s *Server) handleWrite(r *kite.Request) (interface{}, error) {
+	var args writeArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tunnel(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.write(&args)
+}
+
+func (s *Server) handleAck(r *kite.Request) (interface{}, error) {
+	var args ackArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tunnel(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if args.Bytes > t.acked && args.Bytes <= t.sent {
+		t.acked = args.Bytes
+		t.cond.Broadcast()
+	}
+	t.mu.Unlock()
+
+	return nil, nil
+}
+
+func (s *Server) handleClose(r *kite.Request) (interface{}, error) {
+	var args closeArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tunnel(r, args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.close()
+
+	return nil, nil
+}
+
+// tunnel gives the tunnel with the given ID opened by the caller.
+func (s *Server) tunnel(r *kite.Request, id string) (*tunnel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tunnels[id]
+	if !ok || t.owner != r.Username {
+		return nil, ErrTunnelNotFound
+	}
+
+	return t, nil
+}
+
+// allowed tells whether the target is in the allowlist.
+func (s *Server) allowed(target string) bool {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return false
+	}
+
+	for _, pattern := range s.Targets {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) window() int {
+	if s.Window != 0 {
+		return s.Window
+	}
+
+	return DefaultWindow
+}
+
+func (s *Server) dialTimeout() time.Duration {
+	if s.DialTimeout != 0 {
+		return s.DialTimeout
+	}
+
+	return DefaultDialTimeout
+}
+
+// pump reads the target connection and sends the data to the remote
+// kite, waiting for acknowledgements once the window is full. The
+// close callback is called when there is nothing more to read.
+func (t *tunnel) pump(data, closed dnode.Function) {
+	window := int64(t.srv.window())
+	p := make([]byte, maxChunk)
+
+	var err error
+
+	for {
+		t.mu.Lock()
+		for !t.closed && t.sent-t.acked >= window {
+			t.cond.Wait()
+		}
+		done := t.closed
+		t.mu.Unlock()
+
+		if done {
+			break
+		}
+
+		var n int
+		n, err = t.conn.Read(p)
+		if n > 0 {
+			if e := data.Call(p[:n]); e != nil {
+				err = e
+				break
+			}
+
+			t.mu.Lock()
+			t.sent += int64(n)
+			t.mu.Unlock()
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	// On EOF the target may still read what is written to the tunnel,
+	// which is closed once the remote kite is done writing.
+	if err != io.EOF {
+		t.close()
+	}
+
+	event := &closeEvent{}
+	if err != nil && err != io.EOF && !isClosed(err) {
+		event.Error = err.Error()
+	}
+
+	if closed.IsValid() {
+		if err := closed.Call(event); err != nil {
+			t.srv.k.Log.Debug("tunnel: unable to notify about closing %s: %s", t.id, err)
+		}
+	}
+}
+
+// write writes to the target connection in the order of sequence
+// numbers, buffering the writes received out of order.
+func (t *tunnel) write(args *writeArgs) error {
+	t.inputMu.Lock()
+	defer t.inputMu.Unlock()
+
+	if args.Seq < t.nextSeq {
+		return nil // duplicate
+	}
+
+	t.pending[args.Seq] = args
+
+	for {
+		args, ok := t.pending[t.nextSeq]
+		if !ok {
+			return nil
+		}
+
+		delete(t.pending, t.nextSeq)
+		t.nextSeq++
+
+		if len(args.Data) != 0 {
+			if _, err := t.conn.Write(args.Data); err != nil {
+				return err
+			}
+		}
+
+		if args.Close {
+			if cw, ok := t.conn.(closeWriter); ok {
+				return cw.CloseWrite()
+			}
+		}
+	}
+}
+
+func (t *tunnel) close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+
+	t.conn.Close()
+
+	t.srv.mu.Lock()
+	delete(t.srv.tunnels, t.id)
+	t.srv.mu.Unlock()
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// isClosed tells whether the error was caused by closing the connection.
+func isClosed(err error) bool {
+	e, ok := err.(*net.OpError)
+	return ok && e.Err.Error() == "use of closed network connection"
+}
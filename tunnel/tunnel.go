@@ -0,0 +1,88 @@
+// Package tunnel forwards TCP connections between kites, like ssh -L does.
+//
+// Connections accepted on a local port are forwarded to a host and port
+// dialed by the remote kite. All tunnels are multiplexed over the kite
+// connection; each tunnel is flow controlled on its own, so a slow
+// connection does not stall the others.
+//
+// Remote kite:
+//
+//	k := kite.New("gateway", "1.0.0")
+//	s := tunnel.NewServer(k)
+//	s.Targets = []string{"db.internal:5432"}
+//	k.Run()
+//
+// Local kite:
+//
+//	d := tunnel.NewDialer(c)
+//	f, err := d.Forward("127.0.0.1:5432", "db.internal:5432")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+package tunnel
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var (
+	// DefaultWindow is the number of bytes sent over a tunnel, which were
+	// not acknowledged yet, above which reading from the target connection
+	// is paused, if Server.Window is zero.
+	DefaultWindow = 256 * 1024
+
+	// DefaultDialTimeout is the time to wait for the target connection,
+	// if Server.DialTimeout is zero.
+	DefaultDialTimeout = 10 * time.Second
+)
+
+// maxChunk is the maximum number of bytes sent in a single message.
+const maxChunk = 32 * 1024
+
+var (
+	// ErrNotAllowed is returned for targets, which are not in the
+	// allowlist of the server.
+	ErrNotAllowed = errors.New("target is not allowed")
+
+	// ErrTunnelNotFound is returned for calls to a tunnel, which does
+	// not exist or was opened by other user.
+	ErrTunnelNotFound = errors.New("tunnel not found")
+
+	// ErrClosed is returned when using a closed tunnel.
+	ErrClosed = errors.New("tunnel is closed")
+)
+
+type openArgs struct {
+	Target string         `json:"target"`
+	Data   dnode.Function `json:"data"`
+	Close  dnode.Function `json:"close"`
+}
+
+type openResult struct {
+	ID     string `json:"id"`
+	Window int    `json:"window"`
+}
+
+type writeArgs struct {
+	ID    string `json:"id"`
+	Seq   int64  `json:"seq"`
+	Data  []byte `json:"data,omitempty"`
+	Close bool   `json:"close,omitempty"` // closes the writing side
+}
+
+type ackArgs struct {
+	ID    string `json:"id"`
+	Bytes int64  `json:"bytes"`
+}
+
+type closeArgs struct {
+	ID string `json:"id"`
+}
+
+type closeEvent struct {
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,93 @@
+package tunnel_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/tunnel"
+)
+
+func TestForward(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	k := kite.New("tunnel", "0.0.1")
+	k.Config.DisableAuthentication = true
+
+	srv := tunnel.NewServer(k)
+	srv.Targets = []string{"127.0.0.1:*"}
+	srv.Window = 4096
+
+	ts := httptest.NewServer(k)
+	defer ts.Close()
+
+	c := kite.New("tunnel-client", "0.0.1").NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	d := tunnel.NewDialer(c)
+
+	f, err := d.Forward("127.0.0.1:0", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("Forward()=%s", err)
+	}
+	defer f.Close()
+
+	data := make([]byte, 256*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", f.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			conn.Write(data)
+			conn.(*net.TCPConn).CloseWrite()
+		}()
+
+		got, err := ioutil.ReadAll(conn)
+		conn.Close()
+
+		if err != nil {
+			t.Fatalf("ReadAll()=%s", err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Fatalf("got %d bytes, want %d echoed bytes", len(got), len(data))
+		}
+	}
+
+	_, err = d.Dial("localhost:22")
+	if e, ok := err.(*kite.Error); !ok || e.Message != tunnel.ErrNotAllowed.Error() {
+		t.Fatalf("got %v, want %v", err, tunnel.ErrNotAllowed)
+	}
+}
@@ -0,0 +1,111 @@
+package kite
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// envListeners describes the listeners inherited from the previous
+	// process of the kite, starting at descriptor 3, see Upgrade.
+	envListeners = "KITE_LISTEN_FDS"
+
+	// envUpgradeSocket is the path of the control socket the new process
+	// of the kite signals its readiness on, see UpgradeReady.
+	envUpgradeSocket = "KITE_UPGRADE_SOCKET"
+)
+
+// DefaultUpgradeTimeout is the maximum time Upgrade waits for the new
+// process to become ready, if UpgradeOptions.Timeout is zero.
+var DefaultUpgradeTimeout = time.Minute
+
+// UpgradeOptions configures Upgrade.
+type UpgradeOptions struct {
+	// Path is the path of the new binary.
+	//
+	// If empty, the executable of the current process is used.
+	Path string
+
+	// Args are the arguments of the new process.
+	//
+	// If nil, the arguments of the current process are used.
+	Args []string
+
+	// Env is the environment of the new process.
+	//
+	// If nil, the environment of the current process is used.
+	Env []string
+
+	// Timeout is the maximum time to wait for the new process to become
+	// ready. The new process is killed, if it does not become ready in time.
+	//
+	// If zero, DefaultUpgradeTimeout is used.
+	Timeout time.Duration
+
+	// DrainTimeout is the maximum time to wait for calls in flight to
+	// finish, after the new process became ready.
+	//
+	// If zero, DefaultDrainTimeout is used.
+	DrainTimeout time.Duration
+}
+
+// inheritListeners makes the listeners inherited from the previous process
+// of the kite available to Run and Listen. It is called once.
+func (k *Kite) inheritListeners() {
+	env := os.Getenv(envListeners)
+	if env == "" {
+		return
+	}
+
+	// Processes started by the kite must not inherit them again.
+	os.Unsetenv(envListeners)
+
+	var listeners []HandoffListener
+	if err := json.Unmarshal([]byte(env), &listeners); err != nil {
+		k.Log.Error("invalid %s: %s", envListeners, err)
+		return
+	}
+
+	for i, hl := range listeners {
+		f := os.NewFile(uintptr(3+i), hl.Network+":"+hl.Address)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			k.Log.Error("inheriting %s %s listener: %s", hl.Network, hl.Address, err)
+			continue
+		}
+
+		k.mu.Lock()
+		k.inherited = append(k.inherited, &inheritedListener{
+			HandoffListener: hl,
+			l:               l,
+		})
+		k.mu.Unlock()
+	}
+}
+
+// UpgradeReady tells the previous process of the kite, which started the
+// current one with Upgrade, that the kite is ready to serve, so the previous
+// process stops accepting connections and drains. Run calls it once it
+// listens, kites serving with Listen only must call it themselves.
+//
+// It does nothing if the process was not started by Upgrade.
+func (k *Kite) UpgradeReady() error {
+	path := os.Getenv(envUpgradeSocket)
+	if path == "" {
+		return nil
+	}
+
+	os.Unsetenv(envUpgradeSocket)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{1})
+	return err
+}
@@ -0,0 +1,103 @@
+// +build !windows
+
+package kite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+// envUpgradeTest is the socket the helper process started by TestUpgrade
+// serves on.
+const envUpgradeTest = "KITE_TEST_UPGRADE_SOCKET"
+
+func newVersionKite(version string) *Kite {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	k := NewWithConfig("upgraded", "0.0.1", cfg)
+	k.HandleFunc("version", func(r *Request) (interface{}, error) {
+		return version, nil
+	})
+
+	return k
+}
+
+// TestUpgradeHelper is the new process started by TestUpgrade.
+func TestUpgradeHelper(t *testing.T) {
+	socket := os.Getenv(envUpgradeTest)
+	if socket == "" {
+		t.Skip("started by TestUpgrade only")
+	}
+
+	k := newVersionKite("new")
+
+	k.inheritOnce.Do(k.inheritListeners)
+	if len(k.inherited) != 1 {
+		os.Exit(2)
+	}
+
+	if _, err := k.Listen("unix", socket, nil); err != nil {
+		os.Exit(3)
+	}
+
+	if err := k.UpgradeReady(); err != nil {
+		os.Exit(4)
+	}
+
+	select {}
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-upgrade")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "kite.sock")
+
+	old := newVersionKite("old")
+	defer old.Close()
+
+	if _, err := old.Listen("unix", socket, nil); err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	version := func() string {
+		c := New("client", "0.0.1").NewClient("http://localhost/kite", WithUnixSocket(socket))
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		defer c.Close()
+
+		result, err := c.Tell("version")
+		if err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+
+		return result.MustString()
+	}
+
+	if got := version(); got != "old" {
+		t.Fatalf("got version %q, want %q", got, "old")
+	}
+
+	p, err := old.Upgrade(&UpgradeOptions{
+		Path: os.Args[0],
+		Args: []string{"-test.run=^TestUpgradeHelper$"},
+		Env:  append(os.Environ(), envUpgradeTest+"="+socket),
+	})
+	if err != nil {
+		t.Fatalf("Upgrade()=%s", err)
+	}
+	defer p.Kill()
+
+	if got := version(); got != "new" {
+		t.Fatalf("got version %q, want %q", got, "new")
+	}
+}
@@ -0,0 +1,157 @@
+// +build !windows
+
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Upgrade starts the new binary of the kite, which inherits the listeners
+// of the kite, as done by Run and Listen, enabling binary upgrades without
+// downtime, e.g. on SIGHUP:
+//
+//	if _, err := k.Upgrade(nil); err != nil {
+//	    k.Log.Error("upgrade failed: %s", err)
+//	}
+//
+// The new process uses the inherited listeners, if Run and Listen are
+// called with the same network and address as in the current process.
+// Once it signals its readiness over a control socket, see UpgradeReady,
+// the kite stops accepting connections, drains the calls in flight and
+// closes, while the new process accepts connections meanwhile.
+//
+// If the new process exits or does not become ready within the timeout,
+// the kite keeps serving and an error is returned. See ServeHandoff on
+// handling callbacks across the upgrade.
+func (k *Kite) Upgrade(opts *UpgradeOptions) (*os.Process, error) {
+	if opts == nil {
+		opts = &UpgradeOptions{}
+	}
+
+	path := opts.Path
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		path = exe
+	}
+
+	args := opts.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	env := opts.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultUpgradeTimeout
+	}
+
+	listeners := k.servedListeners()
+
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	desc := make([]HandoffListener, 0, len(listeners))
+
+	for _, l := range listeners {
+		f, err := listenerFile(l)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+		desc = append(desc, HandoffListener{Network: l.network, Address: l.address})
+	}
+
+	p, err := json.Marshal(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	control := filepath.Join(os.TempDir(), fmt.Sprintf("kite-upgrade-%d.sock", os.Getpid()))
+	removeStaleSocket(control)
+
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: control, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	defer ul.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(append([]string(nil), env...),
+		envListeners+"="+string(p),
+		envUpgradeSocket+"="+control,
+	)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		ready <- waitReady(ul, timeout)
+	}()
+
+	select {
+	case err = <-ready:
+	case err = <-exited:
+		if err == nil {
+			err = errors.New("exited")
+		}
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("new process did not become ready: %s", err)
+	}
+
+	k.Log.Info("New process %d is ready, draining", cmd.Process.Pid)
+
+	k.handOver(listeners, opts.DrainTimeout)
+
+	return cmd.Process, nil
+}
+
+// waitReady waits for the new process to signal its readiness on the
+// control socket, see UpgradeReady.
+func waitReady(ul *net.UnixListener, timeout time.Duration) error {
+	if err := ul.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	conn, err := ul.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	return err
+}
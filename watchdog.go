@@ -0,0 +1,214 @@
+package kite
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// DefaultWatchdogInterval is the time between checks of the watchdog,
+	// if WatchdogOptions.Interval is zero.
+	DefaultWatchdogInterval = time.Second
+
+	// DefaultWatchdogRecovery is the fraction of the limits the usage must
+	// drop below for the pressure to end, if WatchdogOptions.Recovery is
+	// zero. It keeps the watchdog from flapping around the limits.
+	DefaultWatchdogRecovery = 0.9
+)
+
+// WatchdogOptions configures the watchdog, see StartWatchdog.
+type WatchdogOptions struct {
+	// MaxHeap is the number of bytes of in-use heap spans, above which
+	// the kite is under pressure.
+	//
+	// If zero, the heap is not limited.
+	MaxHeap uint64
+
+	// MaxGoroutines is the number of goroutines, above which the kite is
+	// under pressure.
+	//
+	// If zero, goroutines are not limited.
+	MaxGoroutines int
+
+	// ShedLoad makes the kite reject new calls with "overloaded" errors,
+	// while it is under pressure. Calls of kite.* methods, like heartbeats
+	// and health checks, are not rejected.
+	ShedLoad bool
+
+	// ForceGC makes the watchdog run a garbage collection and return
+	// freed memory to the OS each check the heap limit is exceeded.
+	ForceGC bool
+
+	// Interval is the time between checks.
+	//
+	// If zero, DefaultWatchdogInterval is used.
+	Interval time.Duration
+
+	// Recovery is the fraction of the limits the usage must drop below
+	// for the pressure to end.
+	//
+	// If zero, DefaultWatchdogRecovery is used.
+	Recovery float64
+}
+
+// Pressure describes the resource usage of the kite, when it comes under
+// or recovers from pressure, see OnPressure.
+type Pressure struct {
+	// Active is true if the kite came under pressure and false if it
+	// recovered.
+	Active bool
+
+	// HeapInuse is the number of bytes of in-use heap spans.
+	HeapInuse uint64
+
+	// Goroutines is the number of goroutines.
+	Goroutines int
+
+	// HeapExceeded and GoroutinesExceeded tell which limits are exceeded.
+	HeapExceeded       bool
+	GoroutinesExceeded bool
+}
+
+// StartWatchdog monitors the heap usage and the number of goroutines of
+// the kite, protecting it from getting killed due to running out of
+// memory during traffic spikes, until the returned function is called.
+//
+// Once the kite exceeds the limits, it is under pressure until the usage
+// drops below a fraction of the limits. The OnPressure callbacks are called
+// when the kite comes under and recovers from pressure. While under pressure
+// the kite rejects new calls, if opts.ShedLoad is true.
+func (k *Kite) StartWatchdog(opts *WatchdogOptions) (stop func()) {
+	w := &watchdog{
+		k:      k,
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	if w.opts.Interval == 0 {
+		w.opts.Interval = DefaultWatchdogInterval
+	}
+
+	if w.opts.Recovery == 0 {
+		w.opts.Recovery = DefaultWatchdogRecovery
+	}
+
+	go w.run()
+
+	return w.stop
+}
+
+// UnderPressure tells whether new calls are rejected, because the kite is
+// under pressure.
+func (k *Kite) UnderPressure() bool {
+	return atomic.LoadInt32(&k.shedding) == 1
+}
+
+// shed tells whether the call of the method is rejected due to pressure.
+func (k *Kite) shed(method string) bool {
+	return k.UnderPressure() && !strings.HasPrefix(method, "kite.")
+}
+
+// overloadedError gives the error sent when the call is rejected due
+// to pressure.
+func overloadedError(requestID string) *Error {
+	return &Error{
+		Type:       "overloaded",
+		Message:    "The kite is overloaded.",
+		RequestID:  requestID,
+		RetryAfter: milliseconds(DefaultWatchdogInterval),
+	}
+}
+
+type watchdog struct {
+	k    *Kite
+	opts WatchdogOptions
+
+	active bool // whether the kite is under pressure
+
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+}
+
+func (w *watchdog) run() {
+	defer close(w.exited)
+
+	t := time.NewTicker(w.opts.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+			w.check()
+		}
+	}
+}
+
+func (w *watchdog) stop() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+
+	<-w.exited
+
+	if w.active && w.opts.ShedLoad {
+		atomic.StoreInt32(&w.k.shedding, 0)
+	}
+}
+
+func (w *watchdog) check() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	p := &Pressure{
+		HeapInuse:  m.HeapInuse,
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	// When under pressure, the limits are lowered until the usage
+	// recovers.
+	limit := 1.0
+	if w.active {
+		limit = w.opts.Recovery
+	}
+
+	p.HeapExceeded = w.opts.MaxHeap != 0 && float64(p.HeapInuse) > limit*float64(w.opts.MaxHeap)
+	p.GoroutinesExceeded = w.opts.MaxGoroutines != 0 && float64(p.Goroutines) > limit*float64(w.opts.MaxGoroutines)
+	p.Active = p.HeapExceeded || p.GoroutinesExceeded
+
+	if p.HeapExceeded && w.opts.ForceGC {
+		debug.FreeOSMemory()
+	}
+
+	if p.Active == w.active {
+		return
+	}
+
+	w.active = p.Active
+
+	if w.opts.ShedLoad {
+		var v int32
+		if p.Active {
+			v = 1
+		}
+		atomic.StoreInt32(&w.k.shedding, v)
+	}
+
+	if p.Active {
+		w.k.Log.Warning("Kite is under pressure: heap=%d goroutines=%d", p.HeapInuse, p.Goroutines)
+	} else {
+		w.k.Log.Info("Kite recovered from pressure: heap=%d goroutines=%d", p.HeapInuse, p.Goroutines)
+	}
+
+	w.k.callOnPressureHandlers(p)
+}
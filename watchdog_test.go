@@ -0,0 +1,72 @@
+package kite
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestWatchdog(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	srv := NewWithConfig("watchdog-server", "0.0.1", cfg)
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		return r.Args.One().MustString(), nil
+	})
+
+	pressure := make(chan *Pressure, 1)
+	srv.OnPressure(func(p *Pressure) {
+		pressure <- p
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := New("watchdog-client", "0.0.1").NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	stop := srv.StartWatchdog(&WatchdogOptions{
+		MaxGoroutines: 1,
+		ShedLoad:      true,
+		Interval:      10 * time.Millisecond,
+	})
+
+	select {
+	case p := <-pressure:
+		if !p.Active || !p.GoroutinesExceeded {
+			t.Fatalf("got %+v, want goroutines limit exceeded", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pressure")
+	}
+
+	_, err := c.TellWithTimeout("echo", 4*time.Second, "hello")
+	if e, ok := err.(*Error); !ok || e.Type != "overloaded" {
+		t.Fatalf("got %#v, want overloaded error", err)
+	}
+
+	if RetryAfter(err) == 0 {
+		t.Fatal("want retry hint on overloaded error")
+	}
+
+	if _, err := c.TellWithTimeout("kite.ping", 4*time.Second); err != nil {
+		t.Fatalf("kite.ping: %s", err)
+	}
+
+	stop()
+
+	if srv.UnderPressure() {
+		t.Fatal("want pressure to end after the watchdog is stopped")
+	}
+
+	if _, err := c.TellWithTimeout("echo", 4*time.Second, "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+}
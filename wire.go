@@ -0,0 +1,179 @@
+package kite
+
+import "encoding/json"
+
+// Direction tells whether a frame is received or sent.
+type Direction int
+
+const (
+	// Incoming frames are received from the remote kite.
+	Incoming Direction = iota
+
+	// Outgoing frames are sent to the remote kite.
+	Outgoing
+)
+
+// String implements the fmt.Stringer interface.
+func (d Direction) String() string {
+	if d == Outgoing {
+		return "outgoing"
+	}
+
+	return "incoming"
+}
+
+// Frame is a raw message exchanged with a remote kite, as it is sent
+// over the wire. Incoming frames are seen by middlewares before they
+// are decoded, outgoing ones after they are encoded.
+type Frame struct {
+	// Client is the connection the frame is exchanged over.
+	Client *Client
+
+	// Direction of the frame.
+	Direction Direction
+
+	// Data is the encoded dnode message. Middlewares may modify it in
+	// place or replace it. Setting it to nil drops the frame.
+	Data []byte
+}
+
+// FrameMiddleware observes and rewrites raw frames, e.g. to translate
+// messages of older kites without touching handler code.
+//
+// An error drops the frame. For outgoing frames it is returned to the
+// caller as a "sendError".
+type FrameMiddleware interface {
+	ServeFrame(*Frame) error
+}
+
+// FrameMiddlewareFunc is a type adapter to allow the use of ordinary
+// functions as frame middlewares.
+type FrameMiddlewareFunc func(*Frame) error
+
+// ServeFrame calls f(frame).
+func (f FrameMiddlewareFunc) ServeFrame(frame *Frame) error {
+	return f(frame)
+}
+
+// UseFrame adds a middleware, which is run for each frame exchanged
+// with remote kites. Middlewares run in the order they were added.
+func (k *Kite) UseFrame(mw FrameMiddleware) {
+	k.framesMu.Lock()
+	k.frameMiddlewares = append(k.frameMiddlewares, mw)
+	k.framesMu.Unlock()
+}
+
+// UseFrameFunc is the same as UseFrame. It accepts a FrameMiddlewareFunc.
+func (k *Kite) UseFrameFunc(mw FrameMiddlewareFunc) {
+	k.UseFrame(mw)
+}
+
+// serveFrame runs frame middlewares over the data. It returns nil
+// data if the frame was dropped.
+func (c *Client) serveFrame(dir Direction, p []byte) ([]byte, error) {
+	c.LocalKite.framesMu.RLock()
+	mws := c.LocalKite.frameMiddlewares
+	c.LocalKite.framesMu.RUnlock()
+
+	if len(mws) == 0 {
+		return p, nil
+	}
+
+	f := &Frame{
+		Client:    c,
+		Direction: dir,
+		Data:      p,
+	}
+
+	for _, mw := range mws {
+		if err := mw.ServeFrame(f); err != nil {
+			return nil, err
+		}
+
+		if f.Data == nil {
+			return nil, nil
+		}
+	}
+
+	return f.Data, nil
+}
+
+// RequestID gives the ID, which matches a call with its response,
+// see Request.ID. It is empty if the frame carries none, e.g. when it
+// is a call of a callback other than the response callback, or it was
+// sent by an older kite.
+func (f *Frame) RequestID() string {
+	var msg struct {
+		Arguments []json.RawMessage `json:"arguments"`
+	}
+
+	if err := json.Unmarshal(f.Data, &msg); err != nil || len(msg.Arguments) == 0 {
+		return ""
+	}
+
+	var arg struct {
+		RequestID string `json:"requestId"`
+	}
+
+	if err := json.Unmarshal(msg.Arguments[0], &arg); err != nil {
+		return ""
+	}
+
+	return arg.RequestID
+}
+
+// frameMethod gives the method of the encoded dnode message,
+// or nil if it cannot be decoded.
+func frameMethod(p []byte) interface{} {
+	var msg struct {
+		Method interface{} `json:"method"`
+	}
+
+	if err := json.Unmarshal(p, &msg); err != nil {
+		return nil
+	}
+
+	return msg.Method
+}
+
+// RenameMethods gives a middleware, which renames methods of incoming
+// calls according to the given old to new name mapping. It allows
+// serving callers that use legacy method names.
+func RenameMethods(names map[string]string) FrameMiddleware {
+	return FrameMiddlewareFunc(func(f *Frame) error {
+		if f.Direction != Incoming {
+			return nil
+		}
+
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(f.Data, &msg); err != nil {
+			return nil // leave it for the decoder to report
+		}
+
+		var method string
+		if err := json.Unmarshal(msg["method"], &method); err != nil {
+			return nil // callback
+		}
+
+		name, ok := names[method]
+		if !ok {
+			return nil
+		}
+
+		p, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+
+		msg["method"] = p
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		f.Data = data
+
+		return nil
+	})
+}
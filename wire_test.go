@@ -0,0 +1,158 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestFrameMiddleware(t *testing.T) {
+	cfg := config.New()
+	cfg.DisableAuthentication = true
+
+	headers := make(chan string, 10)
+
+	srv := NewWithConfig("wire-server", "0.0.1", cfg)
+	srv.HandleFunc("square", func(r *Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	})
+	srv.HandleFunc("hidden", func(r *Request) (interface{}, error) {
+		return nil, nil
+	})
+
+	srv.UseFrame(RenameMethods(map[string]string{"oldSquare": "square"}))
+	srv.UseFrameFunc(func(f *Frame) error {
+		var msg struct {
+			Method interface{} `json:"method"`
+			Header string      `json:"header"`
+		}
+
+		if err := json.Unmarshal(f.Data, &msg); err != nil {
+			return err
+		}
+
+		if msg.Method == "hidden" {
+			f.Data = nil // drop
+			return nil
+		}
+
+		if msg.Header != "" {
+			headers <- msg.Header
+		}
+
+		return nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	k := New("wire-client", "0.0.1")
+
+	// Inject a header into outgoing calls.
+	k.UseFrameFunc(func(f *Frame) error {
+		if f.Direction != Outgoing {
+			return nil
+		}
+
+		if bytes.Contains(f.Data, []byte(`"method":"forbidden"`)) {
+			return errors.New("forbidden")
+		}
+
+		f.Data = append([]byte(`{"header":"v1",`), f.Data[1:]...)
+		return nil
+	})
+
+	c := k.NewClient(fmt.Sprintf("%s/kite", ts.URL))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("oldSquare", 3)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if got := result.MustFloat64(); got != 9 {
+		t.Fatalf("got %v, want 9", got)
+	}
+
+	select {
+	case h := <-headers:
+		if h != "v1" {
+			t.Fatalf("got header %q, want v1", h)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the header")
+	}
+
+	_, err = c.TellWithTimeout("hidden", 200*time.Millisecond)
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("got %v, want timeout for dropped frame", err)
+	}
+
+	_, err = c.Tell("forbidden")
+	if e, ok := err.(*Error); !ok || e.Type != "sendError" {
+		t.Fatalf("got %v, want sendError", err)
+	}
+}
+
+func TestFrameRequestID(t *testing.T) {
+	srv := New("wire-server", "0.0.1")
+	srv.Config.DisableAuthentication = true
+
+	handled := make(chan string, 1)
+	srv.HandleFunc("echo", func(r *Request) (interface{}, error) {
+		handled <- r.ID
+		return r.Args.One().MustString(), nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	sent := make(chan string, 1)
+	received := make(chan string, 1)
+
+	k := New("wire-client", "0.0.1")
+	k.UseFrameFunc(func(f *Frame) error {
+		switch method := frameMethod(f.Data); {
+		case f.Direction == Outgoing && method == "echo":
+			sent <- f.RequestID()
+		case f.Direction == Incoming:
+			if _, ok := method.(float64); ok && f.RequestID() != "" {
+				received <- f.RequestID()
+			}
+		}
+		return nil
+	})
+
+	c := k.NewClient(ts.URL + "/kite")
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("echo", "hello"); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	id := <-sent
+	if id == "" {
+		t.Fatal("want call to carry request ID")
+	}
+
+	if got := <-handled; got != id {
+		t.Fatalf("got request ID %q, want %q", got, id)
+	}
+
+	if got := <-received; got != id {
+		t.Fatalf("got response request ID %q, want %q", got, id)
+	}
+}